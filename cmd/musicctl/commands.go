@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func importDirCommand() *cobra.Command {
+	var ffprobe string
+
+	cmd := &cobra.Command{
+		Use:   "import-dir <directory>",
+		Short: "Add every audio file below a directory to the library, skipping files already imported",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			// Without ffprobe tracks are named after their files.
+			var prober library.AudioProber
+			if path, err := exec.LookPath(ffprobe); err == nil {
+				prober = &service.FFprobeHandler{FFprobePath: path}
+			} else {
+				fmt.Fprintf(cmd.ErrOrStderr(), "ffprobe not found, tracks will be named after their files: %v\n", err)
+			}
+
+			report, err := library.ImportDirectory(ctx, handler, args[0], prober)
+			for _, failure := range report.Failed {
+				fmt.Fprintf(cmd.OutOrStdout(), "%v: %v\n", failure.File, failure.Error)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported %v tracks, skipped %v already imported and %v not audio, %v failed\n",
+				report.Imported, report.Duplicates, report.NotAudio, len(report.Failed))
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&ffprobe, "ffprobe", getEnv("FFPROBE_PATH", "ffprobe"), "ffprobe binary to read the tags of each file with")
+	return cmd
+}
+
+func rebuildIndexesCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rebuild-indexes",
+		Short: "Create any missing database indexes and rebuild search suggestions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			if err := handler.EnsureIndexes(ctx); err != nil {
+				return err
+			}
+			if err := handler.RebuildSuggestions(ctx); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Indexes and search suggestions rebuilt")
+			return nil
+		},
+	}
+}
+
+func migrateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Bring documents stored by earlier versions up to date, in the default database and every tenant's",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			handler.TenantDatabasePrefix = getEnv("TENANT_DATABASE_PREFIX", "tenant_")
+			if err := handler.Migrate(ctx); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Migrations applied")
+			return nil
+		},
+	}
+}
+
+func purgeOrphansCommand() *cobra.Command {
+	var dryRun bool
+	var minAge time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "purge-orphans",
+		Short: "Delete stored audio files no longer referenced by any track",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			orphans, err := library.PurgeOrphans(ctx, handler, dryRun, minAge)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range orphans {
+				fmt.Fprintln(cmd.OutOrStdout(), id.Hex())
+			}
+			if dryRun {
+				fmt.Fprintf(cmd.OutOrStdout(), "Found %v orphaned audio files\n", len(orphans))
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted %v orphaned audio files\n", len(orphans))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list orphaned files without deleting them")
+	cmd.Flags().DurationVar(&minAge, "min-age", time.Hour, "leave files stored more recently, whose upload may still be in progress")
+	return cmd
+}
+
+func exportCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export <directory>",
+		Short: "Write all tracks, audio and playlists to a directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			manifest, err := library.Export(ctx, handler, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Exported %v tracks and %v playlists\n", len(manifest.Tracks), len(manifest.Playlists))
+			return nil
+		},
+	}
+}
+
+func importCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <directory>",
+		Short: "Restore a library written by export",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			tracks, playlists, err := library.Import(ctx, handler, args[0])
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported %v tracks and %v playlists\n", tracks, playlists)
+			return err
+		},
+	}
+}
+
+func createAPIKeyCommand() *cobra.Command {
+	var streamThrottle float64
+	var role string
+
+	cmd := &cobra.Command{
+		Use:   "create-api-key <name>",
+		Short: "Create an API key that can be used in place of a login token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			if !validRole(role) {
+				return fmt.Errorf("unknown role %q, must be one of %v", role, strings.Join(models.Roles, ", "))
+			}
+
+			key, hash, err := service.GenerateAPIKey()
+			if err != nil {
+				return err
+			}
+
+			if err := handler.AddAPIKey(ctx, models.APIKey{
+				ID:             primitive.NewObjectID(),
+				Name:           args[0],
+				KeyHash:        hash,
+				CreatedAt:      time.Now(),
+				StreamThrottle: streamThrottle,
+				Role:           role,
+			}); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), key)
+			return nil
+		},
+	}
+
+	cmd.Flags().Float64Var(&streamThrottle, "stream-throttle", 0, "multiple of a track's bit rate to stream to this key at, overriding STREAM_THROTTLE; negative for no limit")
+	cmd.Flags().StringVar(&role, "role", models.RoleListener, "role whose rate limits the key is held to: "+strings.Join(models.Roles, ", "))
+	return cmd
+}
+
+func validRole(role string) bool {
+	for _, known := range models.Roles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+func reindexSearchCommand() *cobra.Command {
+	search := service.ElasticsearchHandler{HttpClient: http.DefaultClient}
+
+	cmd := &cobra.Command{
+		Use:   "reindex-search",
+		Short: "Copy every track into the Elasticsearch or OpenSearch index",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, handler, disconnect, err := connect(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer disconnect()
+
+			search.URL = strings.TrimSuffix(search.URL, "/")
+			if err := search.EnsureIndex(ctx); err != nil {
+				return err
+			}
+
+			tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+			if err != nil {
+				return err
+			}
+			for _, track := range tracks {
+				if err := search.IndexTrack(ctx, tenant, track); err != nil {
+					return err
+				}
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Indexed %v tracks\n", len(tracks))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&search.URL, "elasticsearch-url", os.Getenv("ELASTICSEARCH_URL"), "Elasticsearch or OpenSearch URL")
+	cmd.Flags().StringVar(&search.Index, "index", getEnv("ELASTICSEARCH_INDEX", "tracks"), "index to copy tracks into")
+	cmd.Flags().StringVar(&search.Username, "username", os.Getenv("ELASTICSEARCH_USERNAME"), "username for basic auth")
+	cmd.Flags().StringVar(&search.Password, "password", os.Getenv("ELASTICSEARCH_PASSWORD"), "password for basic auth")
+	return cmd
+}
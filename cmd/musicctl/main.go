@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"music-stream-api/pkg/dao"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	mongoURI string
+	tenant   string
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:          "musicctl",
+		Short:        "Offline administration for the music stream library",
+		SilenceUsage: true,
+	}
+	root.PersistentFlags().StringVar(&mongoURI, "mongo-uri", os.Getenv("MONGO_URI"), "MongoDB connection string")
+	root.PersistentFlags().StringVar(&tenant, "tenant", "", "tenant whose library to operate on")
+
+	root.AddCommand(
+		importDirCommand(),
+		rebuildIndexesCommand(),
+		migrateCommand(),
+		purgeOrphansCommand(),
+		exportCommand(),
+		importCommand(),
+		createAPIKeyCommand(),
+		reindexSearchCommand(),
+	)
+
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		os.Exit(1)
+	}
+}
+
+// connect opens the same database handler the API server uses, scoped to the tenant flag when one is given. The
+// returned function disconnects from the database.
+func connect(ctx context.Context) (context.Context, *dao.DatabaseHandler, func(), error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+	disconnect := func() {
+		if err := client.Disconnect(context.Background()); err != nil {
+			logrus.WithError(err).Error("Error disconnecting from database")
+		}
+	}
+
+	handler := dao.NewDatabaseHandler(client)
+	if tenant != "" {
+		handler.TenantDatabasePrefix = getEnv("TENANT_DATABASE_PREFIX", "tenant_")
+		if ctx, err = dao.WithTenant(ctx, tenant); err != nil {
+			disconnect()
+			return ctx, nil, nil, err
+		}
+	}
+
+	return ctx, handler, disconnect, nil
+}
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
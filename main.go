@@ -1,11 +1,21 @@
 package main
 
 import (
+	"flag"
+	"os"
+
 	"github.com/sirupsen/logrus"
 	"music-stream-api/pkg/api"
 )
 
 func main() {
+	demo := flag.Bool("demo", false, "keep the library in memory rather than in a database, losing it on exit, and fill it with demo data")
+	flag.Parse()
+	if *demo {
+		os.Setenv("DATABASE_BACKEND", "memory")
+		os.Setenv("SEED_DEMO_DATA", "true")
+	}
+
 	if err := api.ListenAndServe(); err != nil {
 		logrus.WithError(err).Fatal("Could not serve API")
 	}
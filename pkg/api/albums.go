@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// getAlbums lists the albums of the library, grouped by album artist, optionally only those of the ?artist= given.
+func getAlbums(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		albums, err := library.Albums(ctx, handler)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving albums")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		if artist := r.URL.Query().Get("artist"); artist != "" {
+			matching := make([]models.Album, 0)
+			for _, album := range albums {
+				if strings.EqualFold(album.Artist, artist) {
+					matching = append(matching, album)
+				}
+			}
+			albums = matching
+		}
+
+		respondWithSuccess(w, http.StatusOK, albums)
+		return
+	}
+}
+
+func getAlbum(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		albums, err := library.Albums(ctx, handler)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving albums")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		for _, album := range albums {
+			if album.ID == mux.Vars(r)["id"] {
+				respondWithSuccess(w, http.StatusOK, album)
+				return
+			}
+		}
+		respondWithError(w, http.StatusNotFound, "Album not found")
+		return
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_GetAlbums_ShouldListAlbumsOfArtist(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	for _, track := range []models.Track{
+		{Name: "one", Artist: "A", AlbumName: "Hits", IsCompilation: true},
+		{Name: "two", Artist: "B", AlbumName: "Hits", IsCompilation: true},
+		{Name: "three", Artist: "B", AlbumName: "Solo"},
+	} {
+		track.ID = primitive.NewObjectID()
+		require.Nil(t, handler.AddTrack(ctx, track))
+	}
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getAlbums(handler)).
+		ServeHTTP(recorder, guestRequest(t, "/albums?artist=various+artists", "test", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var albums []models.Album
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&albums))
+	require.Len(t, albums, 1)
+	require.Equal(t, "Hits", albums[0].Name)
+	require.Len(t, albums[0].Tracks, 2)
+
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(getAlbum(handler)).
+		ServeHTTP(recorder, guestRequest(t, "/album/{id}", "test", map[string]string{"id": library.AlbumID("b", "solo")}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetAlbum_ShouldReturn404IfAlbumDoesNotExist(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getAlbum(dao.NewMemoryHandler())).
+		ServeHTTP(recorder, guestRequest(t, "/album/{id}", "test", map[string]string{"id": "missing"}))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -7,18 +7,25 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"math"
 	"music-stream-api/pkg/service"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/library"
 	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/scheduler"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -27,15 +34,18 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type YoutubeClient interface {
 	GetVideo(videoId string) (*youtube.Video, error)
-	GetStream(video *youtube.Video, format *youtube.Format) (io.ReadCloser, int64, error)
+	GetStreamContext(ctx context.Context, video *youtube.Video, format *youtube.Format) (io.ReadCloser, int64, error)
 }
 
 func ListenAndServe() error {
+	if err := configureLogging(os.Getenv("LOG_FORMAT"), getEnv("LOG_LEVEL", "info")); err != nil {
+		return err
+	}
+
 	headers := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type"})
 	origins := handlers.AllowedOrigins([]string{"*"})
 	methods := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS", "DELETE"})
@@ -46,65 +56,737 @@ func ListenAndServe() error {
 	}
 
 	server := &http.Server{
-		Handler:      handlers.CORS(headers, origins, methods)(router),
-		Addr:         ":8002",
-		WriteTimeout: 200 * time.Second,
-		ReadTimeout:  200 * time.Second,
+		Handler:     limitWrites(writeTimeout, handlers.CORS(headers, origins, methods)(router)),
+		Addr:        getEnv("LISTEN_ADDR", ":8002"),
+		ReadTimeout: 200 * time.Second,
+		ConnContext: rememberConn,
 	}
 	shutdownGracefully(server)
 
-	logrus.Info("Starting API server...")
-	return server.ListenAndServe()
+	return serve(server, tlsSettingsFromEnv())
 }
 
+// openDatabase opens the metadata store DATABASE_BACKEND selects: MongoDB, the default, PostgreSQL, SQLite with audio
+// on the local filesystem, or memory, which keeps nothing once the process exits. The returned lister finds every
+// tenant's library when multiTenant is set, and is nil otherwise. Nothing is read or written until the returned
+// prepare function, which checks the database can be reached and brings its schema, indexes and documents up to date,
+// has succeeded; it is nil when there is nothing to prepare.
+func openDatabase(multiTenant bool) (dao.DbHandler, tenantLister, func(ctx context.Context) error, error) {
+	backend := getEnv("DATABASE_BACKEND", "mongo")
+	switch backend {
+	case "mongo":
+		settings := mongoSettingsFromEnv()
+		opts, err := settings.clientOptions()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		listReadPref, err := settings.listReadPref()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		// Connecting only checks the options; the server is first contacted by prepare.
+		dbClient, err := mongo.Connect(context.Background(), opts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		database := dao.NewDatabaseHandler(dbClient)
+		database.ReadTimeout = getEnvDuration("MONGO_READ_TIMEOUT", 10*time.Second)
+		database.WriteTimeout = getEnvDuration("MONGO_WRITE_TIMEOUT", 10*time.Second)
+		// Audio files run to tens of megabytes, so moving one takes far longer than any query.
+		database.GridFSTimeout = getEnvDuration("MONGO_GRIDFS_TIMEOUT", 2*time.Minute)
+		database.ListReadPreference = listReadPref
+		if multiTenant {
+			database.TenantDatabasePrefix = getEnv("TENANT_DATABASE_PREFIX", "tenant_")
+		}
+
+		migrationTimeout := getEnvDuration("MONGO_MIGRATION_TIMEOUT", 10*time.Minute)
+		prepare := func(ctx context.Context) error {
+			pingCtx, cancel := context.WithTimeout(ctx, database.ReadTimeout)
+			defer cancel()
+			if err := database.Ping(pingCtx); err != nil {
+				return fmt.Errorf("error pinging database: %w", err)
+			}
+
+			// Documents stored by earlier versions are brought up to date before any are read.
+			ctx, cancel = context.WithTimeout(ctx, migrationTimeout)
+			defer cancel()
+			if err := database.Migrate(ctx); err != nil {
+				return fmt.Errorf("error migrating database: %w", err)
+			}
+			// The indexes are created in the default database and every tenant's; tenants added later have theirs
+			// created when their database is first used.
+			if err := database.EnsureIndexes(ctx); err != nil {
+				return fmt.Errorf("error creating database indexes: %w", err)
+			}
+			return nil
+		}
+
+		// Operations are retried through a failover, and are given up on well within a request's timeout.
+		retrying := &dao.RetryingHandler{
+			DbHandler: database,
+			Attempts:  getEnvInt("MONGO_RETRY_ATTEMPTS", 3),
+			Backoff:   getEnvDuration("MONGO_RETRY_BACKOFF", 250*time.Millisecond),
+		}
+		if !multiTenant {
+			return retrying, nil, prepare, nil
+		}
+		return retrying, database, prepare, nil
+	case "postgres":
+		database, err := dao.NewPostgresHandler(os.Getenv("POSTGRES_URL"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		database.ReadTimeout = getEnvDuration("POSTGRES_READ_TIMEOUT", 10*time.Second)
+		database.WriteTimeout = getEnvDuration("POSTGRES_WRITE_TIMEOUT", 10*time.Second)
+		database.AudioTimeout = getEnvDuration("POSTGRES_AUDIO_TIMEOUT", 2*time.Minute)
+		return openSQLDatabase(database, multiTenant, getEnvDuration("POSTGRES_SCHEMA_TIMEOUT", time.Minute))
+	case "sqlite":
+		// Audio is kept on the local filesystem, so the API needs nothing else running.
+		database, err := dao.NewSQLiteHandler(getEnv("SQLITE_PATH", "music-stream.db"), getEnv("AUDIO_DIR", "audio"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		database.ReadTimeout = getEnvDuration("SQLITE_READ_TIMEOUT", 10*time.Second)
+		database.WriteTimeout = getEnvDuration("SQLITE_WRITE_TIMEOUT", 10*time.Second)
+		database.AudioTimeout = getEnvDuration("SQLITE_AUDIO_TIMEOUT", 2*time.Minute)
+		return openSQLDatabase(database, multiTenant, getEnvDuration("SQLITE_SCHEMA_TIMEOUT", time.Minute))
+	case "memory":
+		logrus.Warn("Keeping the library in memory; everything stored will be lost on exit")
+		database := dao.NewMemoryHandler()
+		if !multiTenant {
+			return database, nil, nil, nil
+		}
+		return database, database, nil, nil
+	}
+	return nil, nil, nil, fmt.Errorf("unknown DATABASE_BACKEND %q, must be mongo, postgres, sqlite or memory", backend)
+}
+
+// openSQLDatabase returns a SQL database along with a prepare function creating its schema, as unlike MongoDB
+// collections, tables are not created on first use, and migrating the documents stored in it.
+func openSQLDatabase(database *dao.SQLHandler, multiTenant bool, schemaTimeout time.Duration) (dao.DbHandler, tenantLister, func(ctx context.Context) error, error) {
+	prepare := func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, schemaTimeout)
+		defer cancel()
+		if err := database.EnsureIndexes(ctx); err != nil {
+			return fmt.Errorf("error creating database schema: %w", err)
+		}
+		if err := database.Migrate(ctx); err != nil {
+			return fmt.Errorf("error migrating database: %w", err)
+		}
+		return nil
+	}
+
+	if !multiTenant {
+		return database, nil, prepare, nil
+	}
+	return database, database, prepare, nil
+}
+
+const (
+	roleAll    = "all"
+	roleAPI    = "api"
+	roleWorker = "worker"
+)
+
 func route() (*mux.Router, error) {
-	dbClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI(os.Getenv("MONGO_URI")))
+	role := getEnv("ROLE", roleAll)
+	if role != roleAll && role != roleAPI && role != roleWorker {
+		return nil, fmt.Errorf("unknown ROLE %q, must be %v, %v or %v", role, roleAll, roleAPI, roleWorker)
+	}
+
+	tenants := tenantResolver{
+		mode:       os.Getenv("TENANT_MODE"),
+		baseDomain: os.Getenv("TENANT_BASE_DOMAIN"),
+		claim:      getEnv("TENANT_CLAIM", "tenant"),
+	}
+	database, lister, prepareDatabase, err := openDatabase(tenants.mode != "")
 	if err != nil {
-		logrus.WithError(err).Error("Error creating database client")
+		logrus.WithError(err).Error("Error opening database")
 		return nil, err
 	}
+	// Requests are held back until the database can be reached, rather than the replica exiting if it starts first.
+	startup := newStartupGate()
+	go startup.open(context.Background(), prepareDatabase,
+		getEnvDuration("DATABASE_RETRY_BACKOFF", time.Second), getEnvDuration("DATABASE_MAX_RETRY_BACKOFF", 30*time.Second))
+
+	var dbHandler dao.DbHandler = database
+	var redis *service.RedisHandler
+	if addr := os.Getenv("REDIS_ADDRESS"); addr != "" {
+		redis = &service.RedisHandler{
+			Address:  addr,
+			Password: os.Getenv("REDIS_PASSWORD"),
+			Database: getEnvInt("REDIS_DATABASE", 0),
+			Timeout:  getEnvDuration("REDIS_TIMEOUT", time.Second),
+		}
+		if ttl := getEnvDuration("CACHE_TTL", 5*time.Minute); ttl > 0 {
+			dbHandler = &dao.CachingHandler{DbHandler: database, Cache: redis, TTL: ttl}
+		}
+	}
 
-	dbHandler := dao.DatabaseHandler{
-		Client:               dbClient,
-		Database:             "db",
-		TrackCollection:      "songs",
-		PlaylistCollection:   "playlists",
-		AudioCollection:      "fs.files",
-		AudioChunkCollection: "fs.chunks",
+	var coordinator interface {
+		service.Locker
+		service.RateCounter
+	} = service.NewLocalCoordinator()
+	if redis != nil {
+		coordinator = redis
 	}
+	locks := importLocks{locker: coordinator, ttl: getEnvDuration("IMPORT_LOCK_TTL", 30*time.Minute)}
 
-	client := youtube.Client{}
+	egress, err := egressSettingsFromEnv().client()
+	if err != nil {
+		return nil, err
+	}
+	youtubeHTTP, err := youtubeAuthFromEnv().client(egress)
+	if err != nil {
+		return nil, err
+	}
+	client := youtube.Client{HTTPClient: youtubeHTTP}
 
-	extHandler := service.ExternalHandler{
+	loginService := &service.ExternalHandler{
 		LoginServiceURL: os.Getenv("LOGIN_URL"),
+		HttpClient:      egress,
+		Cache:           service.NewTokenCache(getEnvDuration("TOKEN_CACHE_TTL", time.Minute), getEnvInt("TOKEN_CACHE_SIZE", 10000)),
+		Timeout:         getEnvDuration("LOGIN_TIMEOUT", 5*time.Second),
+		MaxRetries:      getEnvInt("LOGIN_MAX_RETRIES", 2),
+		RetryBackoff:    getEnvDuration("LOGIN_RETRY_BACKOFF", 100*time.Millisecond),
+		Breaker: &service.CircuitBreaker{
+			Threshold: getEnvInt("LOGIN_BREAKER_THRESHOLD", 5),
+			Cooldown:  getEnvDuration("LOGIN_BREAKER_COOLDOWN", 30*time.Second),
+		},
+	}
+
+	extHandler := service.APIKeyHandler{
+		Keys: dbHandler,
+		Next: loginService,
+	}
+
+	musicBrainz := service.MusicBrainzHandler{
 		HttpClient:      http.DefaultClient,
+		MusicBrainzURL:  getEnv("MUSICBRAINZ_URL", "https://musicbrainz.org/ws/2"),
+		CoverArtURL:     getEnv("COVER_ART_URL", "https://coverartarchive.org"),
+		UserAgent:       getEnv("MUSICBRAINZ_USER_AGENT", "music-stream-api/1.0"),
+		RequestInterval: getEnvDuration("MUSICBRAINZ_REQUEST_INTERVAL", time.Second),
+		CacheTTL:        getEnvDuration("MUSICBRAINZ_CACHE_TTL", 24*time.Hour),
+	}
+
+	trackEnrichers := enrichers{
+		providers: map[string]service.MetadataProvider{"musicbrainz": &musicBrainz},
+	}
+	if getEnvBool("ENRICH_ON_UPLOAD", false) {
+		trackEnrichers.onUpload = &musicBrainz
+	}
+	var spotifyPlaylists service.PlaylistProvider
+	if os.Getenv("SPOTIFY_CLIENT_ID") != "" {
+		spotify := &service.SpotifyHandler{
+			HttpClient:   http.DefaultClient,
+			AccountsURL:  getEnv("SPOTIFY_ACCOUNTS_URL", "https://accounts.spotify.com"),
+			APIURL:       getEnv("SPOTIFY_API_URL", "https://api.spotify.com/v1"),
+			ClientID:     os.Getenv("SPOTIFY_CLIENT_ID"),
+			ClientSecret: os.Getenv("SPOTIFY_CLIENT_SECRET"),
+		}
+		trackEnrichers.providers["spotify"] = spotifyEnricher{spotify}
+		spotifyPlaylists = spotify
+	}
+
+	feeds := service.FeedHandler{
+		HttpClient:      http.DefaultClient,
+		MaxEpisodeBytes: int64(getEnvInt("PODCAST_MAX_EPISODE_MB", 500)) << 20,
+	}
+	maxEpisodes := getEnvInt("PODCAST_MAX_EPISODES", 5)
+	if interval := getEnvDuration("PODCAST_POLL_INTERVAL", time.Hour); interval > 0 {
+		go pollPodcasts(context.Background(), dbHandler, &feeds, lister, interval, maxEpisodes, locks)
+	}
+
+	artwork := &artworkCache{
+		dir:      getEnv("ARTWORK_CACHE_DIR", filepath.Join(os.TempDir(), "music-stream-artwork")),
+		client:   &http.Client{Timeout: getEnvDuration("ARTWORK_FETCH_TIMEOUT", 10*time.Second)},
+		maxBytes: int64(getEnvInt("ARTWORK_MAX_MB", 10)) << 20,
+	}
+	// Audio transcoded on the fly is cached up to TRANSCODE_CACHE_MAX_MB; 0 turns the cache off.
+	var transcodes *transcodeCache
+	if maxBytes := int64(getEnvInt("TRANSCODE_CACHE_MAX_MB", 1024)) << 20; maxBytes > 0 {
+		transcodes = &transcodeCache{
+			dir:      getEnv("TRANSCODE_CACHE_DIR", filepath.Join(os.TempDir(), "music-stream-transcodes")),
+			maxBytes: maxBytes,
+		}
+	}
+	temps := tempFiles{
+		os.TempDir(): {"upload*", "validate-*"},
+		artwork.dir:  {"*.tmp*"},
+	}
+	if transcodes != nil {
+		temps[transcodes.dir] = []string{"*.tmp*"}
+	}
+
+	// An upload stores its audio before its track, so files are only taken for orphans once no upload could still be
+	// under way.
+	orphanMinAge := getEnvDuration("ORPHAN_MIN_AGE", time.Hour)
+	stats := &libraryStats{}
+	// Maintenance tasks are scheduled with cron expressions or "@every <duration>", and disabled with "off".
+	maintenance := scheduler.New()
+	for _, task := range []struct {
+		name string
+		spec string
+		run  scheduler.Func
+	}{
+		{"orphan-cleanup", getEnv("SCHEDULE_ORPHAN_CLEANUP", "0 3 * * *"), purgeAllOrphans(dbHandler, lister, orphanMinAge, locks)},
+		{"temp-sweep", getEnv("SCHEDULE_TEMP_SWEEP", "@hourly"), sweepTempFiles(temps, getEnvDuration("TEMP_FILE_MAX_AGE", 6*time.Hour))},
+		{"artwork-cache-eviction", getEnv("SCHEDULE_ARTWORK_CACHE_EVICTION", "@hourly"), artwork.evict(int64(getEnvInt("ARTWORK_CACHE_MAX_MB", 500)) << 20)},
+		{"transcode-cache-eviction", getEnv("SCHEDULE_TRANSCODE_CACHE_EVICTION", "@hourly"), transcodes.evict()},
+		{"library-stats", getEnv("SCHEDULE_LIBRARY_STATS", "@hourly"), stats.aggregate(dbHandler, lister)},
+	} {
+		if err := maintenance.Add(task.name, task.spec, task.run); err != nil {
+			return nil, err
+		}
+	}
+	// Off-site backups are pushed to S3, or a service compatible with it, once a bucket is configured.
+	var offsite *offsiteBackup
+	if bucket := os.Getenv("S3_BACKUP_BUCKET"); bucket != "" {
+		region := getEnv("S3_BACKUP_REGION", "us-east-1")
+		offsite = &offsiteBackup{
+			store: &service.S3Handler{
+				HttpClient:      &http.Client{Timeout: getEnvDuration("S3_BACKUP_TIMEOUT", 5*time.Minute)},
+				Endpoint:        getEnv("S3_BACKUP_ENDPOINT", "https://s3."+region+".amazonaws.com"),
+				Region:          region,
+				Bucket:          bucket,
+				AccessKeyID:     getEnv("S3_BACKUP_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+				SecretAccessKey: getEnv("S3_BACKUP_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+				PathStyle:       getEnvBool("S3_BACKUP_PATH_STYLE", false),
+			},
+			bucket: bucket,
+			prefix: os.Getenv("S3_BACKUP_PREFIX"),
+		}
+		if err := maintenance.Add("offsite-backup", getEnv("SCHEDULE_OFFSITE_BACKUP", "@daily"), offsite.run(dbHandler, lister, locks)); err != nil {
+			return nil, err
+		}
+	}
+	startup.then(maintenance.Run)
+	artworkUploadSettings := artworkUploads{
+		size:    getEnvInt("ARTWORK_UPLOAD_SIZE", 1000),
+		maxSide: getEnvInt("ARTWORK_MAX_SIDE", 8000),
+	}
+
+	versionRetention := getEnvInt("AUDIO_VERSION_RETENTION", 5)
+	streamURLTTL := getEnvDuration("STREAM_URL_TTL", 15*time.Minute)
+
+	shares := shareSettings{
+		signer:     &service.URLSigner{Secret: signingSecret()},
+		baseURL:    os.Getenv("PUBLIC_BASE_URL"),
+		defaultTTL: getEnvDuration("SHARE_DEFAULT_TTL", 7*24*time.Hour),
+		maxTTL:     getEnvDuration("SHARE_MAX_TTL", 30*24*time.Hour),
+	}
+	guests := guestSettings{
+		signer:     shares.signer,
+		defaultTTL: getEnvDuration("GUEST_TOKEN_DEFAULT_TTL", 6*time.Hour),
+		maxTTL:     getEnvDuration("GUEST_TOKEN_MAX_TTL", 7*24*time.Hour),
+	}
+	streamThrottleMultiple := getEnvFloat("STREAM_THROTTLE", 0)
+	throttle := streamThrottle{
+		multiple:       streamThrottleMultiple,
+		roleMultiples:  roleStreamThrottles(streamThrottleMultiple),
+		defaultBitRate: getEnvInt("STREAM_THROTTLE_DEFAULT_KBPS", 320) * 1000,
+	}
+	playlistFeeds := feedSettings{
+		signer:  shares.signer,
+		baseURL: shares.baseURL,
+		ttl:     getEnvDuration("FEED_URL_TTL", 365*24*time.Hour),
+	}
+	downloads := newDownloadSettings(getEnvInt("DOWNLOAD_MAX_TRACKS", 1000), getEnvInt("DOWNLOAD_MAX_PARALLEL", 2))
+	parties := newPartySessions(getEnvDuration("PARTY_IDLE_TIMEOUT", time.Hour))
+
+	var scanner service.Scanner
+	if addr := os.Getenv("CLAMAV_ADDRESS"); addr != "" {
+		scanner = &service.ClamAVHandler{
+			Address: addr,
+			Timeout: getEnvDuration("CLAMAV_TIMEOUT", time.Minute),
+		}
+	}
+
+	var fingerprinter service.Fingerprinter
+	if fpcalc, err := exec.LookPath(getEnv("FPCALC_PATH", "fpcalc")); err == nil {
+		fingerprinter = &service.ChromaprintHandler{FpcalcPath: fpcalc, MaxLength: getEnvInt("FINGERPRINT_MAX_SECONDS", 900)}
+	} else {
+		logrus.WithError(err).Warn("fpcalc not found, audio fingerprinting is disabled")
+	}
+
+	// Without ffmpeg the server still runs, but everything that converts audio is turned away up front.
+	ffmpeg, err := exec.LookPath(getEnv("FFMPEG_PATH", "ffmpeg"))
+	if err != nil {
+		logrus.WithError(err).Warn("ffmpeg not found, set FFMPEG_PATH to enable YouTube imports, conversion, transcoding and radio")
+		ffmpeg = ""
+	}
+
+	// Without ffprobe uploads are stored unchecked, and a corrupt file is only found when it fails to play.
+	var validator service.AudioValidator
+	if ffprobe, err := exec.LookPath(getEnv("FFPROBE_PATH", "ffprobe")); err == nil {
+		validator = &service.FFprobeHandler{
+			FFprobePath:      ffprobe,
+			FFmpegPath:       ffmpeg,
+			SilenceThreshold: float64(getEnvInt("VALIDATION_SILENCE_DB", -80)),
+		}
+	} else {
+		logrus.WithError(err).Warn("ffprobe not found, uploads will not be checked for corrupt or silent audio")
+	}
+
+	// Radio streams are left out of the pool, as each runs for as long as its listener stays.
+	ffmpegPool := library.NewFFmpegPool(getEnvInt("FFMPEG_MAX_PARALLEL", runtime.NumCPU()), getEnvInt("FFMPEG_MAX_QUEUED", 100))
+
+	var transcoder *library.Transcoder
+	if name := os.Getenv("STREAM_FORMAT"); name != "" {
+		format, ok := library.StreamFormats[name]
+		switch {
+		case !ok:
+			logrus.WithField("format", name).Warn("Unknown STREAM_FORMAT, uploads will not be transcoded")
+		case ffmpeg == "":
+			logrus.Warn("ffmpeg not found, uploads will not be transcoded")
+		default:
+			transcoder = &library.Transcoder{FFmpeg: ffmpeg, Format: format, Pool: ffmpegPool}
+		}
+	}
+
+	// Streams are only transcoded to apply ReplayGain when the request asks for it, unless STREAM_REPLAYGAIN says to by
+	// default.
+	replayGain := &streamGain{
+		ffmpeg: ffmpeg,
+		pool:   ffmpegPool,
+		mode:   getEnv("STREAM_REPLAYGAIN", library.ReplayGainOff),
+		cache:  transcodes,
+	}
+	if !validReplayGainMode(replayGain.mode) {
+		logrus.WithField("mode", replayGain.mode).Warn("Unknown STREAM_REPLAYGAIN, ReplayGain will only be applied when asked for")
+		replayGain.mode = library.ReplayGainOff
+	}
+
+	var filenames *library.FilenameParser
+	if getEnvBool("FILENAME_METADATA", false) {
+		parser, err := library.NewFilenameParser(getEnv("FILENAME_PATTERN", library.DefaultFilenamePattern))
+		if err != nil {
+			logrus.WithError(err).Warn("Invalid FILENAME_PATTERN, details will not be read from file names")
+		}
+		filenames = parser
+	}
+
+	var variants []library.Variant
+	if spec := os.Getenv("AUDIO_VARIANTS"); spec != "" {
+		name := getEnv("AUDIO_VARIANT_FORMAT", "mp3")
+		format, ok := library.StreamFormats[name]
+		switch {
+		case !ok:
+			logrus.WithField("format", name).Warn("Unknown AUDIO_VARIANT_FORMAT, no quality variants will be stored")
+		case ffmpeg == "":
+			logrus.Warn("ffmpeg not found, no quality variants will be stored")
+		default:
+			var err error
+			if variants, err = parseVariants(spec, ffmpeg, format); err != nil {
+				logrus.WithError(err).Warn("Invalid AUDIO_VARIANTS, no quality variants will be stored")
+			}
+			for _, variant := range variants {
+				variant.Transcoder.Pool = ffmpegPool
+			}
+		}
+	}
+
+	var acoustID service.RecordingIdentifier
+	if key := os.Getenv("ACOUSTID_API_KEY"); key != "" {
+		acoustID = &service.AcoustIDHandler{
+			HttpClient: http.DefaultClient,
+			URL:        getEnv("ACOUSTID_URL", "https://api.acoustid.org/v2"),
+			APIKey:     key,
+		}
+	}
+
+	var searchIndex service.SearchIndex
+	var elasticsearch *service.ElasticsearchHandler
+	if addr := os.Getenv("ELASTICSEARCH_URL"); addr != "" {
+		elasticsearch = &service.ElasticsearchHandler{
+			HttpClient: http.DefaultClient,
+			URL:        strings.TrimSuffix(addr, "/"),
+			Index:      getEnv("ELASTICSEARCH_INDEX", "tracks"),
+			Username:   os.Getenv("ELASTICSEARCH_USERNAME"),
+			Password:   os.Getenv("ELASTICSEARCH_PASSWORD"),
+		}
+		if err := elasticsearch.EnsureIndex(context.Background()); err != nil {
+			logrus.WithError(err).Error("Error creating search index")
+		}
+		searchIndex = elasticsearch
+		go mirrorSearchIndex(context.Background(), dbHandler, elasticsearch, getEnvDuration("ELASTICSEARCH_RETRY_INTERVAL", time.Minute))
+	}
+
+	// Events are read from change streams, which need MongoDB to run as a replica set.
+	eventsEnabled := getEnvBool("EVENTS_ENABLED", false) && role != roleWorker
+	events := newEventHub()
+	if eventsEnabled {
+		publishChanges(context.Background(), dbHandler, events, getEnvDuration("EVENTS_RETRY_INTERVAL", 10*time.Second))
+	}
+
+	silence := silenceSettings{
+		threshold:   getEnvInt("SILENCE_THRESHOLD_DB", -50),
+		minDuration: getEnvDuration("SILENCE_MIN_DURATION", 500*time.Millisecond),
+	}
+
+	importer := youtubeImporter{
+		handler:       dbHandler,
+		client:        &client,
+		enrichers:     trackEnrichers,
+		fingerprinter: fingerprinter,
+		silence:       silence,
+		locks:         locks,
+		ffmpeg:        ffmpeg,
+		pool:          ffmpegPool,
+	}
+	importers := map[string]Importer{
+		importSourceYoutube: importer,
+		importSourceURL: urlImporter{
+			handler:       dbHandler,
+			client:        &http.Client{Timeout: getEnvDuration("IMPORT_URL_TIMEOUT", 10*time.Minute)},
+			enrichers:     trackEnrichers,
+			scanner:       scanner,
+			validator:     validator,
+			fingerprinter: fingerprinter,
+			transcoder:    transcoder,
+			variants:      variants,
+			ffmpeg:        ffmpeg,
+			pool:          ffmpegPool,
+			maxBytes:      int64(getEnvInt("IMPORT_URL_MAX_MB", getEnvInt("MAX_UPLOAD_MB", 200))) << 20,
+		},
+		importSourceFile: fileImporter{
+			handler:       dbHandler,
+			enrichers:     trackEnrichers,
+			scanner:       scanner,
+			validator:     validator,
+			fingerprinter: fingerprinter,
+		},
+	}
+
+	// API replicas leave queued jobs to dedicated worker replicas, which serve only /health, /ready and /log-level.
+	if role != roleAPI {
+		hostname, _ := os.Hostname()
+		worker := &jobs.Worker{
+			Handler: dbHandler,
+			ID:      fmt.Sprintf("%v-%v", hostname, os.Getpid()),
+			Funcs: map[string]jobs.Func{
+				jobKindImport: runImportJob(importers),
+				// Jobs queued through /youtube/track before /import replaced it.
+				jobKindYoutubeImport: importer.runJob,
+				jobKindReencode:      runReencodeJob(dbHandler, ffmpeg, ffmpegPool, validator),
+				jobKindReplayGain:    runReplayGainJob(dbHandler, ffmpeg, ffmpegPool),
+			},
+			Lease:        getEnvDuration("JOB_LEASE", 5*time.Minute),
+			PollInterval: getEnvDuration("JOB_POLL_INTERVAL", 5*time.Second),
+			Backoff:      getEnvDuration("JOB_RETRY_BACKOFF", 30*time.Second),
+			MaxBackoff:   getEnvDuration("JOB_MAX_RETRY_BACKOFF", time.Hour),
+			CancelCheck:  getEnvDuration("JOB_CANCEL_CHECK_INTERVAL", 5*time.Second),
+		}
+		startup.then(worker.Run)
+	}
+
+	// Every replica with the watch folder mounted watches it; the lock taken on each file keeps them from importing it
+	// twice.
+	if dir := os.Getenv("WATCH_DIRECTORY"); dir != "" {
+		watch := &watchFolder{
+			handler:   dbHandler,
+			validator: validator,
+			scanner:   scanner,
+			locks:     locks,
+			dir:       dir,
+			archive:   os.Getenv("WATCH_ARCHIVE_DIRECTORY"),
+			rejected:  getEnv("WATCH_REJECTED_DIRECTORY", filepath.Join(dir, "rejected")),
+			settle:    getEnvDuration("WATCH_SETTLE", 5*time.Second),
+		}
+		startup.then(watch.run)
+	}
+
+	uploadLimit := int64(getEnvInt("MAX_UPLOAD_MB", 200)) << 20
+	uploadMemory := int64(getEnvInt("UPLOAD_MEMORY_MB", 32)) << 20
+	limits := bodyLimiter{
+		defaultLimit: int64(getEnvInt("MAX_JSON_BODY_KB", 1024)) << 10,
+		routeLimits: map[string]int64{
+			"/track":            uploadLimit,
+			"/track/{id}/audio": uploadLimit,
+			"/upload":           uploadLimit,
+			"/convert":          uploadLimit,
+			"/identify":         uploadLimit,
+			"/import":           uploadLimit,
+			"/track/{id}/art":   artwork.maxBytes,
+			// A backup holds the whole library, so by default it is not limited.
+			"/admin/restore": int64(getEnvInt("MAX_RESTORE_MB", 0)) << 20,
+		},
 	}
 
 	r := mux.NewRouter()
+	r.Use(requestIDMiddleware, recoverPanics)
+	r.Use(startup.middleware)
+	r.Use(limits.middleware)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if tenants.mode != "" {
+		tenants.signer = shares.signer
+		tenants.adminToken = adminToken
+		tenants.tenants = lister
+		tenants.keys = dbHandler
+		tenants.keyTenants = &sync.Map{}
+		r.Use(tenants.middleware)
+	}
+	r.Use(tokenRoles{
+		adminToken: adminToken,
+		signer:     shares.signer,
+		claim:      os.Getenv("ROLE_CLAIM"),
+	}.middleware)
+	requestLimit := getEnvInt("RATE_LIMIT_REQUESTS", 0)
+	roleLimits := roleRequestLimits(requestLimit)
+	rateLimited := requestLimit > 0
+	for _, limit := range roleLimits {
+		rateLimited = rateLimited || limit > 0
+	}
+	var limiter *rateLimiter
+	if rateLimited {
+		limiter = &rateLimiter{
+			counter:    coordinator,
+			limit:      requestLimit,
+			roleLimits: roleLimits,
+			window:     getEnvDuration("RATE_LIMIT_WINDOW", time.Minute),
+		}
+		r.Use(limiter.middleware)
+	}
+
+	healthChecks := dependencyChecks(dbHandler, loginService, ffmpeg, uint64(getEnvInt("HEALTH_MIN_FREE_DISK_MB", 512))<<20)
+	if clamAV, ok := scanner.(pinger); ok {
+		healthChecks = append(healthChecks, healthCheck{
+			name: "clamav",
+			check: func(ctx context.Context) (string, error) {
+				return "", clamAV.Ping(ctx)
+			},
+		})
+	}
+	if elasticsearch != nil {
+		healthChecks = append(healthChecks, healthCheck{
+			name: "elasticsearch",
+			check: func(ctx context.Context) (string, error) {
+				return "", elasticsearch.Ping(ctx)
+			},
+		})
+	}
+	if redis != nil {
+		healthChecks = append(healthChecks, healthCheck{
+			name: "redis",
+			check: func(ctx context.Context) (string, error) {
+				return "", redis.Ping(ctx)
+			},
+		})
+	}
+	// Operational endpoints belong to the server rather than the API, so they are not versioned.
+	r.HandleFunc("/health", checkHealth(dbHandler, healthChecks...)).Methods(http.MethodGet)
+	r.HandleFunc("/ready", checkReadiness(startup)).Methods(http.MethodGet)
+	r.HandleFunc("/log-level", getLogLevel(adminToken)).Methods(http.MethodGet)
+	r.HandleFunc("/log-level", setLogLevel(adminToken)).Methods(http.MethodPut)
+	if role == roleWorker {
+		return r, nil
+	}
+	deprecated := newDeprecations()
+	r.HandleFunc("/admin/stats", getAdminStats(adminToken, deprecated, stats, offsite)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/schedule", getSchedule(adminToken, maintenance)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/seed", seedDemoData(dbHandler, adminToken)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/reencode", reencodeTracks(dbHandler, adminToken, ffmpeg, ffmpegPool)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/replaygain", analyzeReplayGain(dbHandler, adminToken, ffmpeg)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/orphans", listOrphans(dbHandler, adminToken, orphanMinAge)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/orphans/purge", purgeOrphans(dbHandler, adminToken, orphanMinAge)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/backup", getBackup(dbHandler, adminToken)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/restore", postRestore(dbHandler, adminToken)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/import-directory", postImportDirectory(dbHandler, validator, locks, os.Getenv("IMPORT_DIRECTORY_ROOT"), adminToken)).Methods(http.MethodPost)
+	if getEnvBool("SEED_DEMO_DATA", false) {
+		startup.then(func(ctx context.Context) {
+			seedOnStartup(ctx, dbHandler)
+		})
+	}
 
-	r.HandleFunc("/health", checkHealth(&dbHandler)).Methods(http.MethodGet)
-
-	r.HandleFunc("/track", uploadTrack(&dbHandler, &extHandler)).Methods(http.MethodPost)
-	r.HandleFunc("/track/{id}", getTrackAudio(&dbHandler, &extHandler)).Methods(http.MethodGet)
-	r.HandleFunc("/track/{id}", updateTrack(&dbHandler, &extHandler)).Methods(http.MethodPut)
-	r.HandleFunc("/track/{id}", deleteTrack(&dbHandler, &extHandler)).Methods(http.MethodDelete)
-	r.HandleFunc("/tracks", getTracks(&dbHandler, &extHandler)).Methods(http.MethodGet)
-	r.HandleFunc("/video", getVideo(&extHandler, &client)).Methods(http.MethodPost)
-	r.HandleFunc("/stream", getStream(&extHandler, &client)).Methods(http.MethodPost)
-	r.HandleFunc("/convert", convertStreamToAudio(&extHandler)).Methods(http.MethodPost)
-	r.HandleFunc("/upload", uploadAudioBytes(&dbHandler, &extHandler)).Methods(http.MethodPost)
-
-	r.HandleFunc("/playlist", addPlaylist(&dbHandler, &extHandler)).Methods(http.MethodPost)
-	r.HandleFunc("/playlist/{playlistid}/track/{trackid}", addTrackToPlaylist(&dbHandler, &extHandler)).Methods(http.MethodPost)
-	r.HandleFunc("/playlist/{playlistid}/track/{trackid}", removeTrackFromPlaylist(&dbHandler, &extHandler)).Methods(http.MethodDelete)
-	r.HandleFunc("/playlist/{id}", deletePlaylist(&dbHandler, &extHandler)).Methods(http.MethodDelete)
-	r.HandleFunc("/playlists", getPlaylists(&dbHandler, &extHandler)).Methods(http.MethodGet)
-
-	//Deprecated
-	r.HandleFunc("/youtube/track", uploadTrackFromYoutubeLink(&dbHandler, &client, &extHandler)).Methods(http.MethodPost)
-	r.HandleFunc("/test", test()).Methods(http.MethodPost)
-	r.HandleFunc("/test2", test2()).Methods(http.MethodPost)
+	v1 := []apiRoute{
+		{"/track", http.MethodPost, authUser, uploadTrack(dbHandler, trackEnrichers, scanner, validator, fingerprinter, transcoder, variants, filenames, uploadMemory)},
+		{"/track/{id}", http.MethodGet, authUserOrSigned, throttle.wrap(getTrackAudio(dbHandler, shares.signer, replayGain))},
+		{"/track/{id}", http.MethodPut, authUser, updateTrack(dbHandler)},
+		{"/track/{id}", http.MethodDelete, authUser, deleteTrack(dbHandler)},
+		{"/track/{id}/stream-url", http.MethodGet, authUser, getStreamURL(dbHandler, shares.signer, shares.baseURL, streamURLTTL)},
+		{"/track/{id}/audio", http.MethodPut, authUser, replaceTrackAudio(dbHandler, versionRetention, scanner, validator, fingerprinter)},
+		{"/track/{id}/art", http.MethodGet, authUser, getTrackArtwork(dbHandler, artwork)},
+		{"/track/{id}/art", http.MethodPut, authUser, uploadTrackArtwork(dbHandler, artworkUploadSettings)},
+		{"/track/{id}/info", http.MethodGet, authUser, getTrackInfo(dbHandler, validator)},
+		{"/track/{id}/versions", http.MethodGet, authUser, getTrackVersions(dbHandler)},
+		{"/track/{id}/versions/{versionid}/restore", http.MethodPost, authUser, restoreTrackVersion(dbHandler, versionRetention)},
+		{"/track/{id}/enrich", http.MethodPost, authUser, enrichTrack(dbHandler, &musicBrainz)},
+		{"/track/{id}/tags", http.MethodPost, authUser, addTrackTags(dbHandler)},
+		{"/track/{id}/tags/{tag}", http.MethodDelete, authUser, removeTrackTag(dbHandler)},
+		{"/track/{id}/share", http.MethodPost, authUser, createShare(dbHandler, shares, shareKindTrack)},
+		{"/track/{id}/play", http.MethodPost, authUser, recordPlay(dbHandler)},
+		{"/tracks", http.MethodGet, authUser, secondaryReads(getTracks(dbHandler))},
+		{"/tracks/random", http.MethodGet, authUser, secondaryReads(getRandomTracks(dbHandler, getEnvInt("RANDOM_TRACKS_MAX_COUNT", 500)))},
+		{"/tracks/recent", http.MethodGet, authUser, secondaryReads(getRecentTracks(dbHandler))},
+		{"/search", http.MethodGet, authUser, secondaryReads(searchTracks(dbHandler, searchIndex))},
+		{"/search/suggest", http.MethodGet, authUser, secondaryReads(suggestSearch(dbHandler))},
+		{"/recommendations", http.MethodGet, authUser, secondaryReads(getRecommendations(dbHandler))},
+		{"/artists", http.MethodGet, authUser, secondaryReads(getArtists(dbHandler))},
+		{"/albums", http.MethodGet, authUser, secondaryReads(getAlbums(dbHandler))},
+		{"/album/{id}", http.MethodGet, authUser, getAlbum(dbHandler)},
+		{"/album/{id}/download", http.MethodGet, authUser, downloadAlbum(dbHandler, downloads, artwork)},
+		{"/identify", http.MethodPost, authUser, identifyClip(dbHandler, fingerprinter, acoustID)},
+		{"/import", http.MethodPost, authUser, importTracks(dbHandler, importers)},
+		{"/import/{id}", http.MethodDelete, authUser, cancelImport(dbHandler)},
+		{"/import/{id}/retry", http.MethodPost, authUser, retryImport(dbHandler)},
+
+		{"/playlist", http.MethodPost, authUser, addPlaylist(dbHandler)},
+		{"/playlist/import/spotify", http.MethodPost, authUser, importPlaylist(dbHandler, spotifyPlaylists)},
+		{"/playlist/{playlistid}/track/{trackid}", http.MethodPost, authUser, addTrackToPlaylist(dbHandler)},
+		{"/playlist/{playlistid}/track/{trackid}", http.MethodDelete, authUser, removeTrackFromPlaylist(dbHandler)},
+		{"/playlist/{playlistid}/track/{trackid}/position", http.MethodPost, authUser, movePlaylistTrack(dbHandler)},
+		{"/playlist/{id}/tracks", http.MethodPost, authUser, addTracksToPlaylist(dbHandler)},
+		{"/playlist/{id}/duplicate", http.MethodPost, authUser, duplicatePlaylist(dbHandler)},
+		{"/playlist/{id}", http.MethodGet, authUser, getPlaylist(dbHandler)},
+		{"/playlist/{id}", http.MethodDelete, authUser, deletePlaylist(dbHandler)},
+		{"/playlist/{id}/share", http.MethodPost, authUser, createShare(dbHandler, shares, shareKindPlaylist)},
+		{"/playlist/{id}/guest-token", http.MethodPost, authUser, createGuestToken(dbHandler, guests)},
+		{"/playlist/{id}/download", http.MethodGet, authUser, downloadPlaylist(dbHandler, downloads)},
+		{"/playlist/{id}/feed-url", http.MethodGet, authUser, getFeedURL(dbHandler, playlistFeeds)},
+		{"/playlist/{id}/feed.xml", http.MethodGet, authUserOrSigned, getPlaylistFeed(dbHandler, playlistFeeds)},
+		{"/playlists", http.MethodGet, authUser, secondaryReads(getPlaylists(dbHandler))},
+		{"/party", http.MethodPost, authUser, createPartySession(dbHandler, parties)},
+		{"/party/{id}", http.MethodGet, authUser, getPartySession(parties)},
+		{"/party/{id}", http.MethodDelete, authUser, endPartySession(parties)},
+		{"/party/{id}/join", http.MethodPost, authUser, joinPartySession(parties)},
+		{"/party/{id}/ws", http.MethodGet, authUserOrQuery, partySocket(parties)},
+		{"/me/now-playing", http.MethodPut, authUser, setNowPlaying(dbHandler)},
+		{"/user/{id}/now-playing", http.MethodGet, authUser, getNowPlaying(dbHandler)},
+		{"/shared/{token}", http.MethodGet, authPublic, throttle.wrap(getShared(dbHandler, shares.signer))},
+		{"/shared/{token}/track/{trackid}", http.MethodGet, authPublic, throttle.wrap(getSharedPlaylistTrack(dbHandler, shares.signer))},
+		{"/guest/playlist", http.MethodGet, authPublic, getGuestPlaylist(dbHandler, shares.signer)},
+		{"/oembed", http.MethodGet, authPublic, getOEmbed(dbHandler, shares.signer, oembedSettings{
+			providerName: getEnv("OEMBED_PROVIDER_NAME", "Music Stream"),
+			baseURL:      shares.baseURL,
+		})},
+		{"/guest/track/{id}", http.MethodGet, authPublic, throttle.wrap(streamGuestTrack(dbHandler, shares.signer))},
+		{"/radio", http.MethodGet, authUserOrQuery, requireFFmpeg(ffmpeg, streamRadio(dbHandler, ffmpeg))},
+
+		{"/podcast", http.MethodPost, authUser, subscribePodcast(dbHandler, &feeds, maxEpisodes, locks)},
+		{"/podcast/{id}", http.MethodDelete, authUser, deletePodcast(dbHandler)},
+		{"/podcast/{id}/episodes", http.MethodGet, authUser, getPodcastEpisodes(dbHandler)},
+		{"/podcasts", http.MethodGet, authUser, secondaryReads(getPodcasts(dbHandler))},
+
+		{"/job/{id}", http.MethodGet, authUser, getJob(dbHandler)},
+		{"/jobs", http.MethodGet, authUser, getJobs(dbHandler)},
+
+		//Deprecated: replaced by /import
+		{"/video", http.MethodPost, authUser, getVideo(&client)},
+		{"/stream", http.MethodPost, authUser, getStream(&client)},
+		{"/convert", http.MethodPost, authUser, requireFFmpeg(ffmpeg, convertStreamToAudio(ffmpeg, ffmpegPool))},
+		{"/upload", http.MethodPost, authUser, uploadAudioBytes(dbHandler, trackEnrichers, scanner, validator, fingerprinter)},
+		{"/youtube/track", http.MethodPost, authUser, deprecated.wrap("POST /youtube/track", "/import", sunsetDate("YOUTUBE_TRACK_SUNSET", youtubeTrackSunset),
+			uploadTrackFromYoutubeLink(dbHandler, importer))},
+		{"/test", http.MethodPost, authPublic, test()},
+		{"/test2", http.MethodPost, authPublic, test2()},
+	}
+
+	if eventsEnabled {
+		v1 = append(v1, apiRoute{"/events", http.MethodGet, authUser, streamEvents(events, getEnvDuration("EVENTS_KEEP_ALIVE", 30*time.Second))})
+	}
 
+	mountAPIVersions(r, []apiVersion{{name: "v1", routes: v1}}, authenticator{ext: &extHandler, limiter: limiter})
 	return r, nil
 }
 
@@ -140,126 +822,83 @@ func test2() http.HandlerFunc {
 	}
 }
 
-func checkHealth(handler dao.DbHandler) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer closeRequestBody(r)
-		if err := handler.Ping(r.Context()); err != nil {
-			respondWithError(w, http.StatusInternalServerError, "API is running but unable to connect to database")
-			return
-		}
-		respondWithSuccess(w, http.StatusOK, "API is running and connected to database")
-		return
-	}
-}
-
-func uploadTrack(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+// uploadTrack adds a track from a multipart form carrying its audio as "input" and its details as JSON in "body", as
+// the form fields named in trackFormFields, or both. Details still missing are read from the audio's file name when
+// filenames is set. The audio is held in memory only up to memoryThreshold bytes while it arrives, and spooled to disk
+// past that.
+func uploadTrack(handler dao.DbHandler, enrichers enrichers, scanner service.Scanner, validator service.AudioValidator, fingerprinter service.Fingerprinter, transcoder *library.Transcoder, variants []library.Variant, filenames *library.FilenameParser, memoryThreshold int64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
+		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
-		if err := r.ParseForm(); err != nil {
-			logrus.WithError(err).Error("Error parsing request form")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		f, _, err := r.FormFile("input")
-		if err != nil {
+		upload, err := readMultipartUpload(r, "input", memoryThreshold)
+		if errors.Is(err, http.ErrMissingFile) {
 			logrus.WithError(err).Error("Failed to find file with key 'input'")
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
-		}
-
-		buf := bytes.NewBuffer(nil)
-		if _, err := io.Copy(buf, f); err != nil {
-			logrus.WithError(err).Error("Error reading file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+		} else if err != nil {
+			logrus.WithError(err).Error("Error reading request form")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
 			return
 		}
-
 		defer func() {
-			closeRequestBody(r)
-			if err = f.Close(); err != nil {
-				logrus.WithError(err).Error("Error closing file")
+			if err := upload.Close(); err != nil {
+				logrus.WithError(err).Warn("Error removing spooled upload")
 			}
 		}()
 
-		body := r.FormValue("body")
 		track := models.Track{}
-		if err := json.Unmarshal([]byte(body), &track); err != nil {
-			logrus.WithError(err).Error("Error reading request body")
-			respondWithError(w, http.StatusBadRequest, err.Error())
+		if body := upload.fields["body"]; body != "" {
+			if err := json.Unmarshal([]byte(body), &track); err != nil {
+				logrus.WithError(err).Error("Error reading request body")
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
 		}
+		applyFormFields(&track, upload.fields)
 
-		track.ID = primitive.NewObjectID()
-		if track.Name == "" {
-			track.Name = "Unknown"
-		}
-		if track.Artist == "" {
-			track.Artist = "Unknown Artist"
-		}
-		if track.AlbumName == "" {
-			track.AlbumName = "Unknown Album"
+		if !scanUpload(ctx, w, scanner, upload.open()) {
+			return
 		}
-
-		audioID, err := handler.UploadAudioFile(ctx, buf.Bytes(), track.Name)
-		if err != nil {
-			logrus.WithError(err).Error("Error adding track to database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+		info, ok := validateUpload(ctx, w, validator, upload.open())
+		if !ok {
 			return
 		}
 
-		if _, ok := audioID.(primitive.ObjectID); !ok {
-			logrus.WithError(err).Error("Did not receive valid audioFileID from upload stream")
-			respondWithError(w, http.StatusInternalServerError, "invalid audioID received from handler")
-			return
+		track.ID = primitive.NewObjectID()
+		track.AudioInfo = info
+		track.Fingerprint = fingerprintUpload(ctx, fingerprinter, upload.open())
+		library.ApplyTags(&track)
+		if filenames != nil {
+			filenames.Apply(&track, upload.fileName)
 		}
-		track.AudioFileID = audioID.(primitive.ObjectID)
+		library.ApplyDefaults(&track)
+		enrichOnUpload(ctx, enrichers.onUpload, &track)
 
-		if err := handler.AddTrack(ctx, track); err != nil {
+		stored, err := library.StoreTranscodedTrackStream(ctx, handler, track, upload.open(), transcoder, variants)
+		if errors.Is(err, library.ErrNotAudio) {
+			logrus.WithError(err).Error("Rejected upload that is not audio")
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		} else if err != nil {
 			logrus.WithError(err).Error("Error adding track to database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
-		respondWithSuccess(w, http.StatusOK, "Track added successfully")
+		respondWithSuccess(w, http.StatusCreated, stored)
 		return
 	}
 }
 
-func getVideo(ext service.ExtHandler, client YoutubeClient) http.HandlerFunc {
+func getVideo(client YoutubeClient) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
 		var ytRequest models.YoutubeRequest
 		if err := json.NewDecoder(r.Body).Decode(&ytRequest); err != nil {
 			logrus.WithError(err).Error("Error decoding request into JSON")
-			respondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -268,7 +907,7 @@ func getVideo(ext service.ExtHandler, client YoutubeClient) http.HandlerFunc {
 		video, err := client.GetVideo(videoId)
 		if err != nil {
 			logrus.WithError(err).Error("Error getting video")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
@@ -276,58 +915,32 @@ func getVideo(ext service.ExtHandler, client YoutubeClient) http.HandlerFunc {
 	}
 }
 
-func getStream(ext service.ExtHandler, client YoutubeClient) http.HandlerFunc {
+func getStream(client YoutubeClient) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
 		var video youtube.Video
 		if err := json.NewDecoder(r.Body).Decode(&video); err != nil {
 			logrus.WithError(err).Error("Error decoding request body")
-			respondWithError(w, http.StatusBadRequest, "Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
 			return
 		}
 
-		formatIndex := 0
-		minContentLength := int64(math.MaxInt)
-		for i, format := range video.Formats {
-			if strings.Contains(format.MimeType, "audio/mp4") && format.ContentLength < minContentLength {
-				formatIndex = i
-				minContentLength = format.ContentLength
-				break
-			}
-		}
-
-		stream, size, err := client.GetStream(&video, &video.Formats[formatIndex])
+		formats, err := rankAudioFormats(video.Formats, r.URL.Query().Get("quality"))
 		if err != nil {
-			logrus.WithError(err).Error("Error getting video stream")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error selecting audio format")
+			respondWithStatusError(w, err)
 			return
 		}
 
-		file, err := os.Create("video.mp4")
+		stream, size, err := client.GetStreamContext(r.Context(), &video, &formats[0])
 		if err != nil {
-			logrus.WithError(err).Error("Error creating file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error getting video stream")
+			respondWithStatusError(w, err)
 			return
 		}
 
 		defer func() {
-			if err := file.Close(); err != nil {
-				logrus.WithError(err).Error("Error closing file")
-			}
 			if err := stream.Close(); err != nil {
 				logrus.WithError(err).Error("Error closing stream")
 			}
@@ -336,158 +949,127 @@ func getStream(ext service.ExtHandler, client YoutubeClient) http.HandlerFunc {
 		b := make([]byte, size)
 		if _, err := io.ReadFull(stream, b); err != nil {
 			logrus.WithError(err).Error("Error encoding response body")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
-		if _, err := file.Write(b); err != nil {
-			logrus.WithError(err).Error("Error writing to file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		respondWithSuccess(w, http.StatusOK, "Stream file created successfully")
+		respondWithSuccessBytes(w, http.StatusOK, b)
 	}
 }
 
-func convertStreamToAudio(ext service.ExtHandler) http.HandlerFunc {
+// convertStreamToAudio converts a video, as returned by /stream, to mp3 audio, piping it through ffmpeg rather than
+// writing it to disk.
+func convertStreamToAudio(ffmpeg string, pool *library.FFmpegPool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+		var video []byte
+		if err := json.NewDecoder(r.Body).Decode(&video); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
 			return
 		}
 
-		ffmpeg, err := exec.LookPath("ffmpeg")
+		release, err := acquireFFmpeg(r.Context(), pool)
 		if err != nil {
-			logrus.WithError(err).Error("Error locating ffmpeg")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error waiting for ffmpeg")
+			respondWithStatusError(w, err)
 			return
 		}
+		defer release()
 
-		cmd := exec.Command(ffmpeg, "-y", "-loglevel", "quiet", "-i", "video.mp4", "video.mp3")
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			logrus.WithError(err).Error("Error executing ffmpeg command")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		audioBytes, err := ioutil.ReadFile("video.mp3")
+		audioBytes, err := convertToMp3(r.Context(), ffmpeg, bytes.NewReader(video), 0)
 		if err != nil {
-			logrus.WithError(err).Error("Error reading file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error executing ffmpeg command")
+			respondWithStatusError(w, err)
 			return
 		}
 
-		if err = os.Remove("video.mp4"); err != nil {
-			logrus.WithError(err).Error("Error deleting video file")
-		}
-		if err = os.Remove("video.mp3"); err != nil {
-			logrus.WithError(err).Error("Error deleting audio file")
-		}
-
 		respondWithSuccessBytes(w, http.StatusOK, audioBytes)
 	}
 }
 
-func uploadAudioBytes(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func uploadAudioBytes(handler dao.DbHandler, enrichers enrichers, scanner service.Scanner, validator service.AudioValidator, fingerprinter service.Fingerprinter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
+		var uploadRequest models.UploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&uploadRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		enricher, err := enrichers.forRequest(uploadRequest.Enrichment)
 		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
+			logrus.WithError(err).Error("Invalid enrichment option")
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+		if !scanUpload(ctx, w, scanner, bytes.NewReader(uploadRequest.AudioBytes)) {
 			return
 		}
-
-		var uploadRequest models.UploadRequest
-		if err := json.NewDecoder(r.Body).Decode(&uploadRequest); err != nil {
-			logrus.WithError(err).Error("Error decoding request body")
-			respondWithError(w, http.StatusBadRequest, "Error decoding request body")
+		info, ok := validateUpload(ctx, w, validator, bytes.NewReader(uploadRequest.AudioBytes))
+		if !ok {
 			return
 		}
 
 		track := models.Track{
-			ID:        primitive.NewObjectID(),
-			Name:      uploadRequest.YoutubeRequest.Name,
-			Artist:    uploadRequest.YoutubeRequest.Artist,
-			AlbumName: uploadRequest.YoutubeRequest.AlbumName,
+			ID:              primitive.NewObjectID(),
+			Name:            uploadRequest.YoutubeRequest.Name,
+			Artist:          uploadRequest.YoutubeRequest.Artist,
+			FeaturedArtists: uploadRequest.YoutubeRequest.FeaturedArtists,
+			AlbumName:       uploadRequest.YoutubeRequest.AlbumName,
+			AudioInfo:       info,
+			Fingerprint:     fingerprintUpload(ctx, fingerprinter, bytes.NewReader(uploadRequest.AudioBytes)),
 		}
 
-		if track.Name == "" {
-			track.Name = "Unknown"
-		}
-		if track.Artist == "" {
-			track.Artist = "Unknown Artist"
-		}
-		if track.AlbumName == "" {
-			track.AlbumName = "Unknown Album"
-		}
-
-		audioID, err := handler.UploadAudioFile(ctx, uploadRequest.AudioBytes, track.Name)
-		if err != nil {
-			logrus.WithError(err).Error("Error adding track to database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
+		library.ApplyTags(&track)
+		library.ApplyDefaults(&track)
+		enrichOnUpload(ctx, enricher, &track)
 
-		if _, ok := audioID.(primitive.ObjectID); !ok {
-			logrus.WithError(err).Error("Did not receive valid audioFileID from upload stream")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+		stored, err := library.StoreTrack(ctx, handler, track, uploadRequest.AudioBytes)
+		if errors.Is(err, library.ErrNotAudio) {
+			logrus.WithError(err).Error("Rejected upload that is not audio")
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error())
 			return
-		}
-		track.AudioFileID = audioID.(primitive.ObjectID)
-
-		if err := handler.AddTrack(ctx, track); err != nil {
+		} else if err != nil {
 			logrus.WithError(err).Error("Error adding track to database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
-		respondWithSuccess(w, http.StatusOK, "Track added successfully")
+		respondWithSuccess(w, http.StatusCreated, stored)
 		return
 	}
 }
 
-func getTrackAudio(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+// getTrackAudio streams a track's audio. Requests carrying a "signature" query parameter minted by getStreamURL are
+// authorised by that signature alone, so players that cannot set headers can use the URL directly. When ReplayGain is
+// applied, the X-ReplayGain-Applied header says in which mode, so that the player does not apply it again.
+func getTrackAudio(handler dao.DbHandler, signer *service.URLSigner, gain *streamGain) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		id := mux.Vars(r)["id"]
 
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
+		if signature := r.URL.Query().Get("signature"); signature != "" {
+			claims, err := signer.Verify(signature)
+			if err != nil || claims.Subject != "stream:"+id {
+				logrus.WithError(err).Error("Invalid stream signature")
+				respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+				return
+			}
+			if claims.Tenant != "" {
+				if ctx, err = dao.WithTenant(ctx, claims.Tenant); err != nil {
+					logrus.WithError(err).Error("Invalid stream signature")
+					respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+					return
+				}
+			}
 		}
 
 		objectID, err := primitive.ObjectIDFromHex(id)
@@ -501,97 +1083,104 @@ func getTrackAudio(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFu
 		tracks, err := handler.GetTracks(ctx, filter)
 		if err != nil {
 			logrus.WithError(err).Error("Error getting track")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
 			return
 		}
 
-		audioFileBytes, err := handler.DownloadAudioFile(ctx, tracks[0].AudioFileID)
+		quality := r.URL.Query().Get("quality")
+		if r.URL.Query().Get("original") == "true" {
+			quality = qualityOriginal
+		}
+		mode := r.URL.Query().Get("replaygain")
+		if mode != "" && !validReplayGainMode(mode) {
+			respondWithFieldError(w, "replaygain", `replaygain must be "off", "track" or "album"`)
+			return
+		}
+
+		audioFileBytes, mode, err := gain.audio(ctx, handler, mode, tracks[0], quality)
 		if err != nil {
 			logrus.WithError(err).Error("Error getting audio for track")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
+		if mode != library.ReplayGainOff {
+			w.Header().Set("X-ReplayGain-Applied", mode)
+		}
 
+		throttleStream(w, audioBitRate(tracks[0], quality))
 		reader := bytes.NewReader(audioFileBytes)
 		if _, err := io.Copy(w, reader); err != nil {
 			logrus.WithError(err).Error("Error writing file to response")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 	}
 }
 
-func updateTrack(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func updateTrack(handler dao.DbHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
+			logrus.WithError(err).Error("Error creating objectID from hex")
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
-		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		revision, err := ifMatchRevision(r)
 		if err != nil {
-			logrus.WithError(err).Error("Error creating objectID from hex")
-			respondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithFieldError(w, "If-Match", err.Error())
 			return
 		}
 
-		var updatedTrack models.Track
-		if err := json.NewDecoder(r.Body).Decode(&updatedTrack); err != nil {
+		var request models.TrackUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			logrus.WithError(err).Error("Error decoding request body")
-			respondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if updatedTrack.Name == "" {
-			updatedTrack.Name = "Unknown"
+		// A whole track is written back, so an edit made without knowing the revision could undo someone else's.
+		if revision == dao.AnyRevision && request.Revision != nil {
+			revision = *request.Revision
 		}
-		if updatedTrack.Artist == "" {
-			updatedTrack.Artist = "Unknown Artist"
-		}
-		if updatedTrack.AlbumName == "" {
-			updatedTrack.AlbumName = "Unknown Album"
+		if revision == dao.AnyRevision {
+			respondWithError(w, http.StatusPreconditionRequired, "The track's revision is required, in an If-Match header or the request body")
+			return
 		}
 
-		if err := handler.UpdateTrack(ctx, id, updatedTrack); err != nil {
+		updatedTrack := request.Track
+		library.ApplyDefaults(&updatedTrack)
+
+		if err := handler.UpdateTrack(ctx, id, updatedTrack, revision); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		} else if errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Track has been changed since it was read")
+			return
+		} else if err != nil {
 			logrus.WithError(err).Error("Error updating track in database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
+		setNextRevisionETag(w, revision)
 		respondWithSuccess(w, http.StatusOK, "Track updated successfully")
 		return
 	}
 }
 
-func deleteTrack(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func deleteTrack(handler dao.DbHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
 		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 		if err != nil {
 			logrus.WithError(err).Error("Error creating objectID from hex")
@@ -601,7 +1190,7 @@ func deleteTrack(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc
 
 		if err := handler.DeleteTrack(ctx, id); err != nil {
 			logrus.WithError(err).Error("Error deleting track")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
@@ -610,104 +1199,221 @@ func deleteTrack(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc
 	}
 }
 
-func getTracks(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func getTracks(handler dao.DbHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
+		if err := r.ParseForm(); err != nil {
+			logrus.WithError(err).Error("Error parsing request form")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+		order := r.URL.Query().Get("sort")
+		if _, ok := trackSorts[strings.TrimPrefix(order, "-")]; order != "" && !ok {
+			respondWithFieldError(w, "sort", "sort must be createdAt or lastPlayedAt, prefixed with - for newest first")
 			return
 		}
 
-		if err := r.ParseForm(); err != nil {
-			logrus.WithError(err).Error("Error parsing request form")
+		filters, err := trackFilters(r.URL.Query(), "sort")
+		if err != nil {
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		filters := make(map[string]interface{})
-		query := r.URL.Query()
-		for key, val := range query {
-			filters[key] = val[0]
-		}
-
 		trackList, err := handler.GetTracks(ctx, filters)
 		if err != nil {
 			logrus.WithError(err).Error("Error retrieving tracks")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
+		if order != "" {
+			sortTracks(trackList, order)
+		}
 
 		respondWithSuccess(w, http.StatusOK, trackList)
 		return
 	}
 }
 
-func addPlaylist(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+// trackDateFilters are the query parameters that bound when tracks were added or last played, as RFC 3339 times.
+var trackDateFilters = map[string]struct{ field, operator string }{
+	"addedAfter":   {"createdAt", "$gte"},
+	"addedBefore":  {"createdAt", "$lt"},
+	"playedAfter":  {"lastPlayedAt", "$gte"},
+	"playedBefore": {"lastPlayedAt", "$lt"},
+}
+
+// trackSorts are the times ?sort= can order tracks by, oldest first, or newest first when prefixed with "-". Tracks
+// that have never been played sort as played before any that have.
+var trackSorts = map[string]func(track models.Track) time.Time{
+	"createdAt": func(track models.Track) time.Time { return track.CreatedAt },
+	"lastPlayedAt": func(track models.Track) time.Time {
+		if track.LastPlayedAt == nil {
+			return time.Time{}
+		}
+		return *track.LastPlayedAt
+	},
+}
+
+// sortTracks orders tracks by one of trackSorts, keeping the order of tracks with the same time.
+func sortTracks(tracks []models.Track, order string) {
+	key := trackSorts[strings.TrimPrefix(order, "-")]
+	descending := strings.HasPrefix(order, "-")
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if descending {
+			return key(tracks[i]).After(key(tracks[j]))
+		}
+		return key(tracks[i]).Before(key(tracks[j]))
+	})
+}
+
+// trackFilters turns query parameters into a track filter, matching each parameter against the field of the same name.
+// Each ?tag= narrows the results to tracks carrying every one of the given tags, and the trackDateFilters bound when
+// they were added or played. A track that has never been played counts as played before any time, so ?playedBefore=
+// finds the tracks not listened to since then. ?artist= matches tracks by the artist, whether as its primary artist or
+// featured on it.
+func trackFilters(query url.Values, ignore ...string) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+	for key, val := range query {
+		filters[key] = val[0]
+	}
+	for _, key := range ignore {
+		delete(filters, key)
+	}
+
+	if _, ok := query["tag"]; ok {
+		delete(filters, "tag")
+		tags, err := normalizeTags(query["tag"])
+		if err != nil {
+			return nil, err
+		}
+		filters["tags"] = bson.M{"$all": tags}
+	}
+
+	if artist, ok := filters["artist"]; ok {
+		delete(filters, "artist")
+		filters["$or"] = bson.A{bson.M{"artist": artist}, bson.M{"featuredArtists": artist}}
+	}
+
+	var bounds bson.A
+	for param, bound := range trackDateFilters {
+		if _, ok := query[param]; !ok {
+			continue
+		}
+		delete(filters, param)
+		at, err := time.Parse(time.RFC3339, query.Get(param))
+		if err != nil {
+			return nil, fmt.Errorf("%v must be an RFC 3339 time, such as 2006-01-02T15:04:05Z", param)
+		}
+
+		condition := bson.M{bound.field: bson.M{bound.operator: at}}
+		if param == "playedBefore" {
+			condition = bson.M{"$or": bson.A{condition, bson.M{"lastPlayedAt": bson.M{"$exists": false}}}}
+		}
+		bounds = append(bounds, condition)
+	}
+	if len(bounds) > 0 {
+		filters["$and"] = bounds
+	}
+	return filters, nil
+}
+
+// getRandomTracks samples up to ?count= tracks, 1 by default, at random from those matching the same filters as
+// /tracks, so clients can shuffle without fetching the whole library.
+func getRandomTracks(handler dao.DbHandler, maxCount int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
+		count := 1
+		if value := r.URL.Query().Get("count"); value != "" {
+			var err error
+			if count, err = strconv.Atoi(value); err != nil || count <= 0 || count > maxCount {
+				respondWithFieldError(w, "count", fmt.Sprintf("count must be between 1 and %v", maxCount))
+				return
+			}
+		}
+
+		filters, err := trackFilters(r.URL.Query(), "count")
 		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+		trackList, err := handler.SampleTracks(ctx, filters, count)
+		if err != nil {
+			logrus.WithError(err).Error("Error sampling tracks")
+			respondWithStatusError(w, err)
 			return
 		}
 
+		respondWithSuccess(w, http.StatusOK, trackList)
+		return
+	}
+}
+
+// getRecentTracks lists the tracks added in the last ?days= days, 30 by default, newest first.
+func getRecentTracks(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		days := 30
+		if value := r.URL.Query().Get("days"); value != "" {
+			var err error
+			if days, err = strconv.Atoi(value); err != nil || days <= 0 {
+				respondWithFieldError(w, "days", "days must be a positive integer")
+				return
+			}
+		}
+
+		trackList, err := handler.GetRecentTracks(ctx, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving recent tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, trackList)
+		return
+	}
+}
+
+func addPlaylist(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
 		var playlist models.Playlist
 		if err := json.NewDecoder(r.Body).Decode(&playlist); err != nil {
 			logrus.WithError(err).Error("Error decoding request body")
-			respondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
 			return
 		}
 
+		now := time.Now()
 		playlist.ID = primitive.NewObjectID()
+		playlist.CreatedBy = dao.UserFromContext(ctx)
+		playlist.CreatedAt, playlist.UpdatedAt = now, now
 
 		if err := handler.AddPlaylist(ctx, playlist); err != nil {
 			logrus.WithError(err).Error("Error creating playlist")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
-		respondWithSuccess(w, http.StatusOK, "Playlist created successfully")
+		respondWithSuccess(w, http.StatusCreated, playlist)
 		return
 	}
 }
 
-func addTrackToPlaylist(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func addTrackToPlaylist(handler dao.DbHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
 		playlistId := mux.Vars(r)["playlistid"]
 		trackId := mux.Vars(r)["trackid"]
 
@@ -725,43 +1431,47 @@ func addTrackToPlaylist(handler dao.DbHandler, ext service.ExtHandler) http.Hand
 			return
 		}
 
-		_, err = handler.GetTracks(ctx, map[string]interface{}{"_id": tid})
+		revision, err := ifMatchRevision(r)
+		if err != nil {
+			respondWithFieldError(w, "If-Match", err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": tid})
 		if err != nil {
-			logrus.WithError(err).Error("No track with given ID found in database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error retrieving track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
 			return
 		}
 
 		update := bson.M{"$push": bson.M{"tracks": tid}}
-		if err := handler.UpdatePlaylist(ctx, pid, update); err != nil {
+		if err := handler.UpdatePlaylist(ctx, pid, update, revision); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		} else if errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Playlist has been changed since it was read")
+			return
+		} else if err != nil {
 			logrus.WithError(err).Error("Error adding track to playlist")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
+		setNextRevisionETag(w, revision)
 		respondWithSuccess(w, http.StatusOK, "Track successfully added to playlist")
 		return
 	}
 }
 
-func removeTrackFromPlaylist(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func removeTrackFromPlaylist(handler dao.DbHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
 		playlistId := mux.Vars(r)["playlistid"]
 		trackId := mux.Vars(r)["trackid"]
 
@@ -779,43 +1489,47 @@ func removeTrackFromPlaylist(handler dao.DbHandler, ext service.ExtHandler) http
 			return
 		}
 
-		_, err = handler.GetTracks(ctx, map[string]interface{}{"_id": tid})
+		revision, err := ifMatchRevision(r)
+		if err != nil {
+			respondWithFieldError(w, "If-Match", err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": tid})
 		if err != nil {
-			logrus.WithError(err).Error("No track with given ID found in database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error retrieving track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
 			return
 		}
 
 		update := bson.M{"$pull": bson.M{"tracks": tid}}
-		if err := handler.UpdatePlaylist(ctx, pid, update); err != nil {
+		if err := handler.UpdatePlaylist(ctx, pid, update, revision); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		} else if errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Playlist has been changed since it was read")
+			return
+		} else if err != nil {
 			logrus.WithError(err).Error("Error removing track from playlist")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
+		setNextRevisionETag(w, revision)
 		respondWithSuccess(w, http.StatusOK, "Track successfully removed from playlist")
 		return
 	}
 }
 
-func deletePlaylist(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func deletePlaylist(handler dao.DbHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
 		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 		if err != nil {
 			logrus.WithError(err).Error("Error creating objectID from hex")
@@ -825,7 +1539,7 @@ func deletePlaylist(handler dao.DbHandler, ext service.ExtHandler) http.HandlerF
 
 		if err := handler.DeletePlaylist(ctx, id); err != nil {
 			logrus.WithError(err).Error("Error deleting track")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
@@ -834,27 +1548,14 @@ func deletePlaylist(handler dao.DbHandler, ext service.ExtHandler) http.HandlerF
 	}
 }
 
-func getPlaylists(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFunc {
+func getPlaylists(handler dao.DbHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
 
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
 		if err := r.ParseForm(); err != nil {
 			logrus.WithError(err).Error("Error parsing request form")
-			respondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -867,7 +1568,7 @@ func getPlaylists(handler dao.DbHandler, ext service.ExtHandler) http.HandlerFun
 		playlists, err := handler.GetPlaylists(ctx, filters)
 		if err != nil {
 			logrus.WithError(err).Error("Error retrieving tracks")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithStatusError(w, err)
 			return
 		}
 
@@ -918,18 +1619,6 @@ func respondWithSuccessBytes(w http.ResponseWriter, code int, body []byte) {
 	}
 }
 
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(code)
-	if message == "" {
-		logrus.Error("Body is nil, unable to write response")
-		return
-	}
-	if err := json.NewEncoder(w).Encode(map[string]string{"error": message}); err != nil {
-		logrus.WithError(err).Error("Error encoding response")
-	}
-}
-
 func closeRequestBody(req *http.Request) {
 	if req.Body == nil {
 		return
@@ -950,149 +1639,3 @@ func getAuthToken(r *http.Request) (string, error) {
 	}
 	return strings.Split(tokenHeader, " ")[1], nil
 }
-
-// Deprecated
-func uploadTrackFromYoutubeLink(handler dao.DbHandler, client YoutubeClient, ext service.ExtHandler) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		defer closeRequestBody(r)
-
-		token, err := getAuthToken(r)
-		if err != nil {
-			logrus.WithError(err).Error("Error retrieving auth token")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		if err := ext.ValidateToken(token); err != nil {
-			logrus.WithError(err).Error("Authentication failed")
-			respondWithError(w, http.StatusUnauthorized, "Authentication failed")
-			return
-		}
-
-		var ytRequest models.YoutubeRequest
-		if err := json.NewDecoder(r.Body).Decode(&ytRequest); err != nil {
-			logrus.WithError(err).Error("Error decoding request into JSON")
-			respondWithError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		videoId := strings.Split(strings.Split(ytRequest.YoutubeLink, "v=")[1], "&")[0]
-
-		video, err := client.GetVideo(videoId)
-		if err != nil {
-			logrus.WithError(err).Error("Error getting video")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		formatIndex := 0
-		for i, format := range video.Formats {
-			if strings.Contains(format.MimeType, "audio/mp4") {
-				formatIndex = i
-				break
-			}
-		}
-
-		stream, _, err := client.GetStream(video, &video.Formats[formatIndex])
-		if err != nil {
-			logrus.WithError(err).Error("Error getting video stream")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		file, err := os.Create("video.mp4")
-		if err != nil {
-			logrus.WithError(err).Error("Error creating file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		defer func() {
-			if err := file.Close(); err != nil {
-				logrus.WithError(err).Error("Error closing file")
-			}
-			if err := stream.Close(); err != nil {
-				logrus.WithError(err).Error("Error closing stream")
-			}
-		}()
-
-		if _, err = io.Copy(file, stream); err != nil {
-			logrus.WithError(err).Error("Error encoding response body")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		ffmpeg, err := exec.LookPath("ffmpeg")
-		if err != nil {
-			logrus.WithError(err).Error("Error locating ffmpeg")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		cmd := exec.Command(ffmpeg, "-y", "-loglevel", "quiet", "-i", "video.mp4", "video.mp3")
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			logrus.WithError(err).Error("Error executing ffmpeg command")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		audioBytes, err := ioutil.ReadFile("video.mp3")
-		if err != nil {
-			logrus.WithError(err).Error("Error reading file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		if err = os.Remove("video.mp4"); err != nil {
-			logrus.WithError(err).Error("Error deleting video file")
-		}
-		if err = os.Remove("video.mp3"); err != nil {
-			logrus.WithError(err).Error("Error deleting audio file")
-		}
-
-		track := models.Track{
-			ID:        primitive.NewObjectID(),
-			Name:      ytRequest.Name,
-			Artist:    ytRequest.Artist,
-			AlbumName: ytRequest.AlbumName,
-		}
-
-		if track.Name == "" {
-			track.Name = "Unknown"
-		}
-		if track.Artist == "" {
-			track.Artist = "Unknown Artist"
-		}
-		if track.AlbumName == "" {
-			track.AlbumName = "Unknown Album"
-		}
-
-		audioID, err := handler.UploadAudioFile(ctx, audioBytes, track.Name)
-		if err != nil {
-			logrus.WithError(err).Error("Error adding track to database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		if _, ok := audioID.(primitive.ObjectID); !ok {
-			logrus.WithError(err).Error("Did not receive valid audioFileID from upload stream")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-		track.AudioFileID = audioID.(primitive.ObjectID)
-
-		if err := handler.AddTrack(ctx, track); err != nil {
-			logrus.WithError(err).Error("Error adding track to database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		respondWithSuccess(w, http.StatusOK, "Track added successfully")
-		return
-	}
-}
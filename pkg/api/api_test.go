@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -10,17 +11,34 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
 	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
 	"music-stream-api/pkg/testhelper/mocks"
 
 	"github.com/gorilla/mux"
 	"github.com/kkdai/youtube/v2"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// testAudio is the start of an mp3 file, enough to pass upload format checks.
+var testAudio = []byte("ID3\x04\x00\x00\x00\x00\x00\x00")
+
+// readerOf matches a reader holding audio, rewinding it so the matcher can be asked more than once.
+func readerOf(audio []byte) interface{} {
+	return mock.MatchedBy(func(r io.ReadSeeker) bool {
+		defer r.Seek(0, io.SeekStart)
+		data, err := ioutil.ReadAll(r)
+		return err == nil && bytes.Equal(data, audio)
+	})
+}
+
 func TestApi_CheckHealth_ShouldReturn500IfUnableToConnectToDatabase(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
 	dbHandler.On("Ping", mock.Anything).Return(errors.New("test"))
@@ -47,76 +65,69 @@ func TestApi_CheckHealth_ShouldReturn200OnSuccess(t *testing.T) {
 	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
-func TestApi_UploadTrack_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
+func TestApi_UploadTrack_ShouldReturn400IfErrorOccursParsingForm(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 
 	req, err := http.NewRequest(http.MethodPost, "/track", nil)
 	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_UploadTrack_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_UploadTrack_ShouldReturn400IfNoFileWithKeyInputFound(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
 
-	req, err := http.NewRequest(http.MethodPost, "/track", nil)
+	req, err := http.NewRequest(http.MethodPost, "/track", strings.NewReader("{}"))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_UploadTrack_ShouldReturn400IfErrorOccursParsingForm(t *testing.T) {
+func TestApi_UploadTrack_ShouldReturn422IfFileIsNotAudio(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
-	req, err := http.NewRequest(http.MethodPost, "/track", nil)
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("input", "test.mp3")
 	require.Nil(t, err)
-	req.Header.Set("Authorization", "Bearer test")
 
-	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
-}
+	_, err = io.Copy(part, bytes.NewBuffer([]byte("<html></html>")))
+	require.Nil(t, err)
 
-func TestApi_UploadTrack_ShouldReturn400IfNoFileWithKeyInputFound(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	require.Nil(t, writer.WriteField("body", "{}"))
 
-	req, err := http.NewRequest(http.MethodPost, "/track", strings.NewReader("{}"))
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/track", body)
 	require.Nil(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	dbHandler.AssertNotCalled(t, "UploadAudioStream", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestApi_UploadTrack_ShouldReturn500OnHandlerError(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("UploadAudioStream", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	part, err := writer.CreateFormFile("input", "test.mp3")
 	require.Nil(t, err)
 
-	_, err = io.Copy(part, bytes.NewBuffer([]byte("test")))
+	_, err = io.Copy(part, bytes.NewBuffer(testAudio))
 	require.Nil(t, err)
 
 	require.Nil(t, writer.WriteField("body", "{}"))
@@ -129,23 +140,21 @@ func TestApi_UploadTrack_ShouldReturn500OnHandlerError(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_UploadTrack_ShouldReturn500IfHandlerReturnsInvalidObjectID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return("z", nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("UploadAudioStream", mock.Anything, mock.Anything, mock.Anything).Return("z", nil)
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	part, err := writer.CreateFormFile("input", "test.mp3")
 	require.Nil(t, err)
 
-	_, err = io.Copy(part, bytes.NewBuffer([]byte("test")))
+	_, err = io.Copy(part, bytes.NewBuffer(testAudio))
 	require.Nil(t, err)
 
 	require.Nil(t, writer.WriteField("body", "{}"))
@@ -158,24 +167,22 @@ func TestApi_UploadTrack_ShouldReturn500IfHandlerReturnsInvalidObjectID(t *testi
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_UploadTrack_ShouldReturn500IfErrorOccursAddingTrack(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
+	dbHandler.On("UploadAudioStream", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
 	dbHandler.On("AddTrack", mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	part, err := writer.CreateFormFile("input", "test.mp3")
 	require.Nil(t, err)
 
-	_, err = io.Copy(part, bytes.NewBuffer([]byte("test")))
+	_, err = io.Copy(part, bytes.NewBuffer(testAudio))
 	require.Nil(t, err)
 
 	require.Nil(t, writer.WriteField("body", "{}"))
@@ -188,24 +195,24 @@ func TestApi_UploadTrack_ShouldReturn500IfErrorOccursAddingTrack(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_UploadTrack_ShouldReturn200OnSuccessAddingTrack(t *testing.T) {
+func TestApi_UploadTrack_ShouldReturn201WithCreatedTrack(t *testing.T) {
+	audioID := primitive.NewObjectID()
+
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
+	dbHandler.On("UploadAudioStream", mock.Anything, mock.Anything, mock.Anything).Return(audioID, nil)
 	dbHandler.On("AddTrack", mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	part, err := writer.CreateFormFile("input", "test.mp3")
 	require.Nil(t, err)
 
-	_, err = io.Copy(part, bytes.NewBuffer([]byte("test")))
+	_, err = io.Copy(part, bytes.NewBuffer(testAudio))
 	require.Nil(t, err)
 
 	require.Nil(t, writer.WriteField("body", "{}"))
@@ -218,140 +225,162 @@ func TestApi_UploadTrack_ShouldReturn200OnSuccessAddingTrack(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrack(dbHandler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var track models.Track
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &track))
+	require.False(t, track.ID.IsZero())
+	require.Equal(t, audioID, track.AudioFileID)
 }
 
-func TestApi_UploadTrackFromYoutubeLink_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	client := &mocks.YoutubeClient{}
+func TestApi_UploadTrack_ShouldMergeFormFieldsWithJSONBody(t *testing.T) {
+	handler := dao.NewMemoryHandler()
 
-	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(""))
-	require.Nil(t, err)
+	req := multipartRequest(t, testAudio, map[string]string{
+		"body":   `{"name": "from json", "artist": "json artist", "year": 1999}`,
+		"artist": "form artist",
+		"album":  "form album",
+		"genre":  "jazz",
+	})
+	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, client, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	http.HandlerFunc(uploadTrack(handler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var track models.Track
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &track))
+	require.Equal(t, "from json", track.Name)
+	require.Equal(t, "form artist", track.Artist)
+	require.Equal(t, "form album", track.AlbumName)
+	require.Equal(t, "jazz", track.Genre)
+	require.Equal(t, 1999, track.Year)
 }
 
-func TestApi_UploadTrackFromYoutubeLink_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	client := &mocks.YoutubeClient{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
+func TestApi_UploadTrack_ShouldAcceptFormFieldsWithoutJSONBody(t *testing.T) {
+	handler := dao.NewMemoryHandler()
 
-	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(""))
+	req := multipartRequest(t, testAudio, map[string]string{"name": "plain", "artist": "curl"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(uploadTrack(handler, enrichers{}, nil, nil, nil, nil, nil, nil, 32<<20)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var track models.Track
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &track))
+	require.Equal(t, "plain", track.Name)
+	require.Equal(t, "curl", track.Artist)
+	require.Equal(t, "Unknown Album", track.AlbumName)
+}
+
+func TestApi_UploadTrack_ShouldReadMissingDetailsFromFileName(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+	filenames, err := library.NewFilenameParser(library.DefaultFilenamePattern)
+	require.Nil(t, err)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("input", "04 - Some Band - Some Song.mp3")
+	require.Nil(t, err)
+	_, err = part.Write(testAudio)
 	require.Nil(t, err)
+	require.Nil(t, writer.WriteField("artist", "Given Artist"))
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/track", body)
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, client, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	http.HandlerFunc(uploadTrack(handler, enrichers{}, nil, nil, nil, nil, nil, filenames, 32<<20)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var track models.Track
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &track))
+	require.Equal(t, "Some Song", track.Name)
+	require.Equal(t, "Given Artist", track.Artist)
+	require.Equal(t, 4, track.TrackNumber)
 }
 
 func TestApi_UploadTrackFromYoutubeLink_ShouldReturn400IfErrorOccursDecodingRequestBody(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	client := &mocks.YoutubeClient{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(""))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, client, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_UploadTrackFromYoutubeLink_ShouldReturnErrorIfGetVideoReturnsError(t *testing.T) {
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn400IfEnrichmentOptionIsUnknown(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	client := &mocks.YoutubeClient{}
-	client.On("GetVideo", mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
-	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test&channel=test"}`))
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"https://www.youtube.com/watch?v=test","enrichment":"test"}`))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, client, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_UploadTrackFromYoutubeLink_ShouldReturnErrorIfGetStreamReturnsError(t *testing.T) {
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturnErrorIfGetVideoReturnsError(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	client := &mocks.YoutubeClient{}
-	client.On("GetVideo", mock.Anything).Return(&youtube.Video{Formats: []youtube.Format{{}}}, nil)
-	client.On("GetStream", mock.Anything, mock.Anything).Return(nil, int64(0), errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	client.On("GetVideo", mock.Anything).Return(nil, errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test&channel=test"}`))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, client, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_GetTrackAudio_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-
-	req, err := http.NewRequest(http.MethodGet, "/track/{id}", nil)
-	require.Nil(t, err)
-
-	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
-}
-
-func TestApi_GetTrackAudio_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturnErrorIfGetStreamReturnsError(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
+	client := &mocks.YoutubeClient{}
+	client.On("GetVideo", mock.Anything).Return(&youtube.Video{Formats: []youtube.Format{{MimeType: `audio/mp4; codecs="mp4a.40.2"`}}}, nil)
+	client.On("GetStreamContext", mock.Anything, mock.Anything, mock.Anything).Return(nil, int64(0), errors.New("test"))
 
-	req, err := http.NewRequest(http.MethodGet, "/track/{id}", nil)
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test&channel=test"}`))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_GetTrackAudio_ShouldReturn400IfUnableToCreateObjectIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/track/{id}", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, &service.URLSigner{Secret: []byte("test")}, nil))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_GetTrackAudio_ShouldReturn500IfGetTracksErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/track/{id}", nil)
 	require.Nil(t, err)
@@ -359,17 +388,15 @@ func TestApi_GetTrackAudio_ShouldReturn500IfGetTracksErrors(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, &service.URLSigner{Secret: []byte("test")}, nil))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_GetTrackAudio_ShouldReturn500IfDownloadAudioFileErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{AudioFileID: primitive.NewObjectID()}}, nil)
 	dbHandler.On("DownloadAudioFile", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/track/{id}", nil)
 	require.Nil(t, err)
@@ -377,17 +404,15 @@ func TestApi_GetTrackAudio_ShouldReturn500IfDownloadAudioFileErrors(t *testing.T
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, &service.URLSigner{Secret: []byte("test")}, nil))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_GetTrackAudio_ShouldReturn200IfSuccessful(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{AudioFileID: primitive.NewObjectID()}}, nil)
 	dbHandler.On("DownloadAudioFile", mock.Anything, mock.Anything).Return([]byte{}, nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/track/{id}", nil)
 	require.Nil(t, err)
@@ -395,58 +420,48 @@ func TestApi_GetTrackAudio_ShouldReturn200IfSuccessful(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, &service.URLSigner{Secret: []byte("test")}, nil))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
-func TestApi_UpdateTrack_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-
-	req, err := http.NewRequest(http.MethodPut, "/track/{id}", nil)
-	require.Nil(t, err)
-
-	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(updateTrack(dbHandler, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
-}
+func TestApi_GetTrackAudio_ShouldServeOriginalAudioIfRequested(t *testing.T) {
+	original := primitive.NewObjectID()
 
-func TestApi_UpdateTrack_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{
+		AudioFileID: primitive.NewObjectID(),
+		Original:    &models.OriginalAudio{AudioFileID: original, Container: "flac", Codec: "flac"},
+	}}, nil)
+	dbHandler.On("DownloadAudioFile", mock.Anything, original).Return([]byte("fLaC"), nil)
 
-	req, err := http.NewRequest(http.MethodPut, "/track/{id}", nil)
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}?original=true", nil)
 	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(updateTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, &service.URLSigner{Secret: []byte("test")}, nil))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "fLaC", recorder.Body.String())
 }
 
 func TestApi_UpdateTrack_ShouldReturn400IfUnableToCreateObjectIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodPut, "/track/{id}", ioutil.NopCloser(strings.NewReader("")))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(updateTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(updateTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_UpdateTrack_ShouldReturn500IfUnableToDecodeRequestBody(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodPut, "/track/{id}", ioutil.NopCloser(strings.NewReader("")))
 	require.Nil(t, err)
@@ -454,93 +469,74 @@ func TestApi_UpdateTrack_ShouldReturn500IfUnableToDecodeRequestBody(t *testing.T
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(updateTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(updateTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_UpdateTrack_ShouldReturn500IfUpdateTrackErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UpdateTrack", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("UpdateTrack", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
 
-	req, err := http.NewRequest(http.MethodPut, "/track/{id}", ioutil.NopCloser(strings.NewReader("{}")))
+	req, err := http.NewRequest(http.MethodPut, "/track/{id}", ioutil.NopCloser(strings.NewReader(`{"revision":2}`)))
 	require.Nil(t, err)
 	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(updateTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(updateTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_UpdateTrack_ShouldReturn200IfSuccessful(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UpdateTrack", mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("UpdateTrack", mock.Anything, mock.Anything, mock.Anything, int64(4)).Return(nil)
 
 	req, err := http.NewRequest(http.MethodPut, "/track/{id}", ioutil.NopCloser(strings.NewReader("{}")))
 	require.Nil(t, err)
 	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
 	req.Header.Set("Authorization", "Bearer test")
+	req.Header.Set("If-Match", `"4"`)
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(updateTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(updateTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"5"`, recorder.Header().Get("ETag"))
 }
 
-func TestApi_DeleteTrack_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-
-	req, err := http.NewRequest(http.MethodDelete, "/track/{id}", nil)
-	require.Nil(t, err)
-
-	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deleteTrack(dbHandler, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
-}
-
-func TestApi_DeleteTrack_ShouldReturn401IfErrorsOccursValidatingToken(t *testing.T) {
+func TestApi_DeleteTrack_ShouldReturn400IfUnableToCreateObjectIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodDelete, "/track/{id}", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deleteTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(deleteTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_DeleteTrack_ShouldReturn400IfUnableToCreateObjectIDFromGivenID(t *testing.T) {
+func TestApi_DeleteTrack_ShouldReturn500IfDeleteTrackErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("DeleteTrack", mock.Anything, mock.Anything).Return(errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodDelete, "/track/{id}", nil)
 	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deleteTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(deleteTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_DeleteTrack_ShouldReturn500IfDeleteTrackErrors(t *testing.T) {
+func TestApi_DeleteTrack_ShouldReturn404IfTrackDoesNotExist(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("DeleteTrack", mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("DeleteTrack", mock.Anything, mock.Anything).Return(dao.ErrNotFound)
 
 	req, err := http.NewRequest(http.MethodDelete, "/track/{id}", nil)
 	require.Nil(t, err)
@@ -548,16 +544,14 @@ func TestApi_DeleteTrack_ShouldReturn500IfDeleteTrackErrors(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deleteTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(deleteTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
 }
 
 func TestApi_DeleteTrack_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("DeleteTrack", mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/track/{id}", nil)
 	require.Nil(t, err)
@@ -565,193 +559,188 @@ func TestApi_DeleteTrack_ShouldReturn200OnSuccess(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deleteTrack(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(deleteTrack(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
-func TestApi_GetTracks_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
+func TestApi_GetTracks_ShouldReturn500OnGetTracksError(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
 	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTracks(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getTracks(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_GetTracks_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_GetTracks_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTracks(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getTracks(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
-func TestApi_GetTracks_ShouldReturn500OnGetTracksError(t *testing.T) {
+func TestApi_GetRandomTracks_ShouldReturn400IfCountIsOutOfRange(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
-	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	req, err := http.NewRequest(http.MethodGet, "/tracks/random?count=11", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTracks(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getRandomTracks(dbHandler, 10))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_GetTracks_ShouldReturn200OnSuccess(t *testing.T) {
+func TestApi_GetRandomTracks_ShouldReturn500OnSampleTracksError(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("SampleTracks", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
 
-	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	req, err := http.NewRequest(http.MethodGet, "/tracks/random", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getTracks(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getRandomTracks(dbHandler, 10))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_AddPlaylist_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
+func TestApi_GetRandomTracks_ShouldSampleRequestedCountFromFilteredTracks(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("SampleTracks", mock.Anything, map[string]interface{}{
+		"$or": bson.A{bson.M{"artist": "test"}, bson.M{"featuredArtists": "test"}},
+	}, 5).Return([]models.Track{{}}, nil)
 
-	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader("")))
+	req, err := http.NewRequest(http.MethodGet, "/tracks/random?count=5&artist=test", nil)
 	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getRandomTracks(dbHandler, 10))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertExpectations(t)
 }
 
-func TestApi_AddPlaylist_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_GetRecentTracks_ShouldReturn400IfDaysIsInvalid(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
 
-	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader("")))
+	req, err := http.NewRequest(http.MethodGet, "/tracks/recent?days=-1", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getRecentTracks(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_AddPlaylist_ShouldReturn400IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_GetRecentTracks_ShouldReturn500OnGetRecentTracksError(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("GetRecentTracks", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
 
-	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader("")))
+	req, err := http.NewRequest(http.MethodGet, "/tracks/recent", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getRecentTracks(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_AddPlaylist_ShouldReturn500IfAddPlaylistErrors(t *testing.T) {
+func TestApi_GetRecentTracks_ShouldQueryTracksAddedWithinGivenDays(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("AddPlaylist", mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("GetRecentTracks", mock.Anything, mock.MatchedBy(func(since time.Time) bool {
+		return time.Since(since) > 6*24*time.Hour && time.Since(since) < 8*24*time.Hour
+	})).Return([]models.Track{{}}, nil)
 
-	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader("{}")))
+	req, err := http.NewRequest(http.MethodGet, "/tracks/recent?days=7", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getRecentTracks(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
-func TestApi_AddPlaylist_ShouldReturn200OnSuccess(t *testing.T) {
+func TestApi_AddPlaylist_ShouldReturn400IfErrorOccursValidatingToken(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("AddPlaylist", mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
-	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader("{}")))
+	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader("")))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
-func TestApi_AddTrackToPlaylist_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
+func TestApi_AddPlaylist_ShouldReturn500IfAddPlaylistErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("AddPlaylist", mock.Anything, mock.Anything).Return(errors.New("test"))
 
-	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
+	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader("{}")))
 	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_AddTrackToPlaylist_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_AddPlaylist_ShouldReturn201WithCreatedPlaylist(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
+	dbHandler.On("AddPlaylist", mock.Anything, mock.Anything).Return(nil)
 
-	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
+	req, err := http.NewRequest(http.MethodPost, "/playlist", ioutil.NopCloser(strings.NewReader(`{"createdBy":"someone-else"}`)))
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
+	req = req.WithContext(dao.WithUser(req.Context(), "user-1"))
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var playlist models.Playlist
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &playlist))
+	require.False(t, playlist.ID.IsZero())
+	require.Equal(t, "user-1", playlist.CreatedBy)
 }
 
 func TestApi_AddTrackToPlaylist_ShouldReturn400IfUnableToCreatePlaylistIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_AddTrackToPlaylist_ShouldReturn400IfUnableToCreateTrackIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -759,16 +748,14 @@ func TestApi_AddTrackToPlaylist_ShouldReturn400IfUnableToCreateTrackIDFromGivenI
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_AddTrackToPlaylist_ShouldReturn500IfGetTracksErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -776,17 +763,15 @@ func TestApi_AddTrackToPlaylist_ShouldReturn500IfGetTracksErrors(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_AddTrackToPlaylist_ShouldReturn500IfUpdatePlaylistErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, nil)
-	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -794,17 +779,14 @@ func TestApi_AddTrackToPlaylist_ShouldReturn500IfUpdatePlaylistErrors(t *testing
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_AddTrackToPlaylist_ShouldReturn200OnSuccess(t *testing.T) {
+func TestApi_AddTrackToPlaylist_ShouldReturn404IfTrackNotFound(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, nil)
-	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
 
 	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -812,58 +794,61 @@ func TestApi_AddTrackToPlaylist_ShouldReturn200OnSuccess(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Track not found")
+	dbHandler.AssertNotCalled(t, "UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
-func TestApi_RemoveTrackFromPlaylist_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
+func TestApi_AddTrackToPlaylist_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(dao.ErrNotFound)
 
-	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"playlistid": "603ac4abd9ad8067f54a2778", "trackid": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Playlist not found")
 }
 
-func TestApi_RemoveTrackFromPlaylist_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_AddTrackToPlaylist_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
-	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"playlistid": "603ac4abd9ad8067f54a2778", "trackid": "603ac4abd9ad8067f54a2778"})
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(addTrackToPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
 func TestApi_RemoveTrackFromPlaylist_ShouldReturn400IfUnableToCreatePlaylistIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_RemoveTrackFromPlaylist_ShouldReturn400IfUnableToCreateTrackIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -871,16 +856,14 @@ func TestApi_RemoveTrackFromPlaylist_ShouldReturn400IfUnableToCreateTrackIDFromG
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_RemoveTrackFromPlaylist_ShouldReturn500IfGetTracksErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -888,17 +871,15 @@ func TestApi_RemoveTrackFromPlaylist_ShouldReturn500IfGetTracksErrors(t *testing
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_RemoveTrackFromPlaylist_ShouldReturn500IfUpdatePlaylistErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, nil)
-	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -906,17 +887,14 @@ func TestApi_RemoveTrackFromPlaylist_ShouldReturn500IfUpdatePlaylistErrors(t *te
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_RemoveTrackFromPlaylist_ShouldReturn200OnSuccess(t *testing.T) {
+func TestApi_RemoveTrackFromPlaylist_ShouldReturn404IfTrackNotFound(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, nil)
-	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
@@ -924,59 +902,62 @@ func TestApi_RemoveTrackFromPlaylist_ShouldReturn200OnSuccess(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Track not found")
+	dbHandler.AssertNotCalled(t, "UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
-func TestApi_DeletePlaylist_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
+func TestApi_RemoveTrackFromPlaylist_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(dao.ErrNotFound)
 
-	req, err := http.NewRequest(http.MethodDelete, "/playlist/{id}", nil)
+	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"playlistid": "603ac4abd9ad8067f54a2778", "trackid": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Playlist not found")
 }
 
-func TestApi_DeletePlaylist_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+func TestApi_RemoveTrackFromPlaylist_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
-	req, err := http.NewRequest(http.MethodDelete, "/playlist/{id}", nil)
+	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistId}/track/{trackId}", nil)
 	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"playlistid": "603ac4abd9ad8067f54a2778", "trackid": "603ac4abd9ad8067f54a2778"})
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
 func TestApi_DeletePlaylist_ShouldReturn400IfUnableToCreateObjectIDFromGivenID(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{id}", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusBadRequest, recorder.Code)
 }
 
 func TestApi_DeletePlaylist_ShouldReturn500IfDeletePlaylistErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("DeletePlaylist", mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{id}", nil)
 	require.Nil(t, err)
@@ -984,16 +965,14 @@ func TestApi_DeletePlaylist_ShouldReturn500IfDeletePlaylistErrors(t *testing.T)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_DeletePlaylist_ShouldReturn200IfSuccessful(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("DeletePlaylist", mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/playlist/{id}", nil)
 	require.Nil(t, err)
@@ -1001,67 +980,35 @@ func TestApi_DeletePlaylist_ShouldReturn200IfSuccessful(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(deletePlaylist(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
-func TestApi_GetPlaylists_ShouldReturn400IfNoAuthorizationHeaderFound(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-
-	req, err := http.NewRequest(http.MethodGet, "/playlists", nil)
-	require.Nil(t, err)
-
-	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getPlaylists(dbHandler, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusBadRequest, recorder.Code)
-}
-
-func TestApi_GetPlaylists_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
-	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(errors.New("test"))
-
-	req, err := http.NewRequest(http.MethodGet, "/playlists", nil)
-	require.Nil(t, err)
-	req.Header.Set("Authorization", "Bearer test")
-
-	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getPlaylists(dbHandler, extHandler))
-	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusUnauthorized, recorder.Code)
-}
-
 func TestApi_GetPlaylists_ShouldReturn500IfGetPlaylistErrors(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/playlists", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getPlaylists(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getPlaylists(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
 func TestApi_GetPlaylists_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DbHandler{}
-	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{{}}, nil)
-	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/playlists", nil)
 	require.Nil(t, err)
 	req.Header.Set("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
-	httpHandler := http.HandlerFunc(getPlaylists(dbHandler, extHandler))
+	httpHandler := http.HandlerFunc(getPlaylists(dbHandler))
 	httpHandler.ServeHTTP(recorder, req)
 	require.Equal(t, http.StatusOK, recorder.Code)
 }
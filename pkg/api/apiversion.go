@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	apiVersionHeader = "API-Version"
+	// currentAPIVersion is the version unprefixed legacy paths are served as. They are kept for one release after the
+	// /v1 prefix was introduced.
+	currentAPIVersion = "v1"
+)
+
+var versionPrefixPattern = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+type apiVersionKey struct{}
+
+// apiRoute is an endpoint as route() registers it, without a version prefix.
+type apiRoute struct {
+	path    string
+	method  string
+	auth    authPolicy
+	handler http.HandlerFunc
+}
+
+// apiVersion is a version of the API and the routes it serves. A version with breaking changes lists its own routes,
+// reusing the handlers of the previous version for the endpoints that did not change.
+type apiVersion struct {
+	name   string
+	routes []apiRoute
+}
+
+// mountAPIVersions registers each version's routes under its /vN prefix, followed by the current version's routes on
+// unprefixed legacy paths, which point clients at their /vN successor. Each route's handler is wrapped by authn to
+// enforce the route's auth policy.
+func mountAPIVersions(r *mux.Router, versions []apiVersion, authn authenticator) {
+	for _, version := range versions {
+		router := r.PathPrefix("/" + version.name).Subrouter()
+		router.Use(versionMiddleware(version.name, false))
+		for _, route := range version.routes {
+			router.HandleFunc(route.path, authn.wrap(route.auth, route.handler)).Methods(route.method)
+		}
+	}
+
+	for _, version := range versions {
+		if version.name != currentAPIVersion {
+			continue
+		}
+		legacy := r.NewRoute().Subrouter()
+		legacy.Use(versionMiddleware(version.name, true))
+		for _, route := range version.routes {
+			legacy.HandleFunc(route.path, authn.wrap(route.auth, route.handler)).Methods(route.method)
+		}
+	}
+}
+
+// versionMiddleware records the API version a request is served as, for handlers that build links, and echoes it in
+// the response.
+func versionMiddleware(version string, legacy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(apiVersionHeader, version)
+			if legacy {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Link", "</"+version+r.URL.Path+">; rel=\"successor-version\"")
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+		})
+	}
+}
+
+// apiVersionFromContext returns the API version the request is being served as.
+func apiVersionFromContext(ctx context.Context) string {
+	if version, ok := ctx.Value(apiVersionKey{}).(string); ok {
+		return version
+	}
+	return currentAPIVersion
+}
+
+// versionedPath prefixes a path with the version of the API the request is being served as, for links handed back to
+// clients.
+func versionedPath(ctx context.Context, path string) string {
+	return "/" + apiVersionFromContext(ctx) + path
+}
+
+// unversionedPath strips any /vN prefix from a path, for middleware that treats paths the same in every version.
+func unversionedPath(path string) string {
+	prefix := versionPrefixPattern.FindString(path)
+	if prefix == "" {
+		return path
+	}
+	return "/" + path[len(prefix):]
+}
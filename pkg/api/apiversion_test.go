@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_MountAPIVersions_ShouldServeVersionedAndLegacyPaths(t *testing.T) {
+	var served []string
+	router := mux.NewRouter()
+	mountAPIVersions(router, []apiVersion{{name: "v1", routes: []apiRoute{
+		{"/tracks", http.MethodGet, authPublic, func(w http.ResponseWriter, r *http.Request) {
+			served = append(served, apiVersionFromContext(r.Context()))
+		}},
+	}}}, authenticator{})
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/tracks", nil)
+	require.Nil(t, err)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "v1", recorder.Header().Get(apiVersionHeader))
+	require.Empty(t, recorder.Header().Get("Deprecation"))
+
+	req, err = http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "true", recorder.Header().Get("Deprecation"))
+	require.Equal(t, `</v1/tracks>; rel="successor-version"`, recorder.Header().Get("Link"))
+
+	require.Equal(t, []string{"v1", "v1"}, served)
+}
+
+func TestApi_UnversionedPath_ShouldStripOnlyVersionPrefixes(t *testing.T) {
+	require.Equal(t, "/track/{id}/audio", unversionedPath("/v1/track/{id}/audio"))
+	require.Equal(t, "/", unversionedPath("/v2"))
+	require.Equal(t, "/video", unversionedPath("/video"))
+	require.Equal(t, "/shared/abc", unversionedPath("/shared/abc"))
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+
+	"github.com/sirupsen/logrus"
+)
+
+// getArtists lists the artists of the library, including those only featured on other artists' tracks. The tracks of
+// an artist can be listed with /tracks?artist=, which matches featured artists too.
+func getArtists(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		artists, err := library.Artists(ctx, handler)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving artists")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, artists)
+		return
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_GetTracks_ShouldMatchFeaturedArtists(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	for _, track := range []models.Track{
+		{Name: "own", Artist: "A"},
+		{Name: "guest spot", Artist: "B", FeaturedArtists: []string{"A"}},
+		{Name: "other", Artist: "C"},
+	} {
+		track.ID = primitive.NewObjectID()
+		require.Nil(t, handler.AddTrack(ctx, track))
+	}
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getTracks(handler)).ServeHTTP(recorder, guestRequest(t, "/tracks?artist=A", "test", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var tracks []models.Track
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&tracks))
+	require.Len(t, tracks, 2)
+
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(getArtists(handler)).ServeHTTP(recorder, guestRequest(t, "/artists", "test", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var artists []models.Artist
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&artists))
+	require.Equal(t, []models.Artist{{Name: "A", Tracks: 1, Featured: 1}, {Name: "B", Tracks: 1}, {Name: "C", Tracks: 1}}, artists)
+}
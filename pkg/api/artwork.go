@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/scheduler"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const artworkOriginal = "original"
+
+// artworkSizes are the sizes artwork can be requested at, as the longest side in pixels. Keeping to a few fixed sizes
+// keeps the cache small.
+var artworkSizes = map[string]int{"64": 64, "300": 300}
+
+// artworkCache fetches track artwork from where its URL points and keeps it, and the sizes made from it, on disk.
+// Entries are named after the URL, so tracks sharing a cover share the files.
+type artworkCache struct {
+	dir      string
+	client   *http.Client
+	maxBytes int64
+}
+
+// get returns the artwork at the URL at the given size, fetching and resizing it the first time it is asked for.
+func (c *artworkCache) get(ctx context.Context, artworkURL string, size string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(artworkURL))
+	return c.load(hex.EncodeToString(sum[:]), size, func() ([]byte, error) {
+		return c.fetch(ctx, artworkURL)
+	})
+}
+
+// getUploaded returns artwork uploaded to the audio store at the given size. Uploaded artwork is never changed in
+// place, so it is cached under its file ID.
+func (c *artworkCache) getUploaded(ctx context.Context, handler dao.DbHandler, fileID primitive.ObjectID, size string) ([]byte, error) {
+	return c.load("file-"+fileID.Hex(), size, func() ([]byte, error) {
+		return handler.DownloadAudioFile(ctx, fileID)
+	})
+}
+
+// load returns the cache entry with the given key at the given size, getting the original with load and resizing it
+// the first time it is asked for.
+func (c *artworkCache) load(key string, size string, load func() ([]byte, error)) ([]byte, error) {
+	if artwork, err := ioutil.ReadFile(filepath.Join(c.dir, key+"-"+size)); err == nil {
+		c.touch(key + "-" + size)
+		return artwork, nil
+	}
+
+	original, err := ioutil.ReadFile(filepath.Join(c.dir, key+"-"+artworkOriginal))
+	if err != nil {
+		if original, err = load(); err != nil {
+			return nil, err
+		}
+		c.store(key+"-"+artworkOriginal, original)
+	}
+	if size == artworkOriginal {
+		return original, nil
+	}
+
+	resized, err := library.ResizeArtwork(original, artworkSizes[size])
+	if err != nil {
+		return nil, err
+	}
+	c.store(key+"-"+size, resized)
+	return resized, nil
+}
+
+func (c *artworkCache) fetch(ctx context.Context, artworkURL string) ([]byte, error) {
+	parsed, err := url.Parse(artworkURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, statusError{code: http.StatusBadGateway, err: errors.New("track artwork URL is not an http or https URL")}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, artworkURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, statusError{code: http.StatusBadGateway, err: fmt.Errorf("error fetching artwork: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError{code: http.StatusBadGateway, err: fmt.Errorf("artwork host returned %v", resp.StatusCode)}
+	}
+
+	artwork, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.maxBytes+1))
+	if err != nil {
+		return nil, statusError{code: http.StatusBadGateway, err: fmt.Errorf("error fetching artwork: %w", err)}
+	} else if int64(len(artwork)) > c.maxBytes {
+		return nil, statusError{code: http.StatusBadGateway, err: fmt.Errorf("artwork exceeds the limit of %v bytes", c.maxBytes)}
+	}
+	// Anything else, such as an HTML error page served with a 200, is never cached or passed on.
+	if !strings.HasPrefix(http.DetectContentType(artwork), "image/") {
+		return nil, library.ErrNotImage
+	}
+	return artwork, nil
+}
+
+// touch marks a cache entry as used, so that evict keeps it over entries that have not been used for longer.
+func (c *artworkCache) touch(name string) {
+	if err := touchCacheEntry(filepath.Join(c.dir, name)); err != nil {
+		logrus.WithError(err).Debug("Error marking artwork cache entry used")
+	}
+}
+
+// evict is the scheduled task keeping the cache within maxBytes, deleting the entries used least recently first.
+func (c *artworkCache) evict(maxBytes int64) scheduler.Func {
+	return func(ctx context.Context) error {
+		evicted, err := evictLeastRecentlyUsed(c.dir, maxBytes)
+		if evicted > 0 {
+			logrus.WithField("entries", evicted).Info("Evicted artwork cache entries")
+		}
+		return err
+	}
+}
+
+// store writes a cache entry. Failing to cache is only logged, as the artwork can still be served.
+func (c *artworkCache) store(name string, artwork []byte) {
+	if err := writeCacheEntry(c.dir, name, artwork); err != nil {
+		logrus.WithError(err).Warn("Error caching artwork")
+	}
+}
+
+// getTrackArtwork serves a track's artwork at one of the artworkSizes, or as it was found with size=original, so
+// list views can load small covers. Artwork uploaded for the track is served in place of any at its artwork URL.
+func getTrackArtwork(handler dao.DbHandler, cache *artworkCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		size := r.URL.Query().Get("size")
+		if size == "" {
+			size = artworkOriginal
+		}
+		if _, ok := artworkSizes[size]; !ok && size != artworkOriginal {
+			respondWithFieldError(w, "size", "size must be 64, 300 or original")
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+		var artwork []byte
+		switch {
+		case !tracks[0].ArtworkFileID.IsZero():
+			artwork, err = cache.getUploaded(ctx, handler, tracks[0].ArtworkFileID, size)
+		case tracks[0].ArtworkURL != "":
+			artwork, err = cache.get(ctx, tracks[0].ArtworkURL, size)
+		default:
+			respondWithError(w, http.StatusNotFound, "Track has no artwork")
+			return
+		}
+		if errors.Is(err, library.ErrNotImage) {
+			respondWithError(w, http.StatusBadGateway, err.Error())
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error getting track artwork")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", http.DetectContentType(artwork))
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		if _, err := w.Write(artwork); err != nil {
+			logrus.WithError(err).Error("Error writing artwork to response")
+		}
+	}
+}
+
+// artworkUploads configures the artwork accepted by uploadTrackArtwork.
+type artworkUploads struct {
+	size    int
+	maxSide int
+}
+
+// uploadTrackArtwork sets a track's artwork from a JPEG, PNG, GIF or WebP image sent as the request body. The image is
+// normalised to a square JPEG of a standard size, without its metadata, before it is stored, so covers are served
+// quickly and look alike whatever was uploaded. Any artwork uploaded for the track before is deleted.
+func uploadTrackArtwork(handler dao.DbHandler, settings artworkUploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		upload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logrus.WithError(err).Error("Error reading artwork")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		artwork, err := library.NormalizeArtwork(upload, settings.size, settings.maxSide)
+		if errors.Is(err, library.ErrNotImage) || errors.Is(err, library.ErrArtworkDimensions) {
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error normalising artwork")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		uploaded, err := handler.UploadAudioFile(ctx, artwork, tracks[0].Name+" artwork")
+		if err != nil {
+			logrus.WithError(err).Error("Error storing artwork")
+			respondWithStatusError(w, err)
+			return
+		}
+		fileID, ok := uploaded.(primitive.ObjectID)
+		if !ok {
+			respondWithError(w, http.StatusInternalServerError, library.ErrInvalidAudioID.Error())
+			return
+		}
+
+		if err := handler.UpdateTrack(ctx, id, models.Track{ArtworkFileID: fileID}, dao.AnyRevision); err != nil {
+			logrus.WithError(err).Error("Error setting track artwork")
+			if deleteErr := handler.DeleteAudioFile(ctx, fileID); deleteErr != nil {
+				logrus.WithError(deleteErr).Warn("Error deleting artwork for failed upload")
+			}
+			respondWithStatusError(w, err)
+			return
+		}
+
+		if previous := tracks[0].ArtworkFileID; !previous.IsZero() {
+			if err := handler.DeleteAudioFile(ctx, previous); err != nil {
+				logrus.WithError(err).WithField("artworkFile", previous.Hex()).Warn("Error deleting replaced artwork")
+			}
+		}
+
+		updated, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil || len(updated) == 0 {
+			logrus.WithError(err).Error("Error getting updated track")
+			respondWithError(w, http.StatusInternalServerError, "Error getting updated track")
+			return
+		}
+		respondWithSuccess(w, http.StatusOK, updated[0])
+	}
+}
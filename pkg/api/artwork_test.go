@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func artworkRequest(t *testing.T, size string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}/art?size="+size, nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testTrackID})
+	req.Header.Set("Authorization", "Bearer test")
+	return req
+}
+
+func TestApi_GetTrackArtwork_ShouldResizeAndCacheArtwork(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 500, 500))))
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "artwork")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{ArtworkURL: server.URL + "/cover.png"}}, nil)
+	cache := &artworkCache{dir: dir, client: server.Client(), maxBytes: 1 << 20}
+
+	for _, size := range []string{"64", "64", "300"} {
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(getTrackArtwork(dbHandler, cache))
+		httpHandler.ServeHTTP(recorder, artworkRequest(t, size))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+
+		img, _, err := image.Decode(recorder.Body)
+		require.Nil(t, err)
+		require.Equal(t, artworkSizes[size], img.Bounds().Dx())
+	}
+	require.Equal(t, 1, fetches)
+}
+
+func TestApi_GetTrackArtwork_ShouldReturn400IfSizeIsUnsupported(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTrackArtwork(dbHandler, &artworkCache{}))
+	httpHandler.ServeHTTP(recorder, artworkRequest(t, "1024"))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "GetTracks", mock.Anything, mock.Anything)
+}
+
+func TestApi_GetTrackArtwork_ShouldReturn404IfTrackHasNoArtwork(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTrackArtwork(dbHandler, &artworkCache{}))
+	httpHandler.ServeHTTP(recorder, artworkRequest(t, "64"))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GetTrackArtwork_ShouldReturn502IfArtworkIsNotAnImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>Not found</body></html>"))
+	}))
+	defer server.Close()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{ArtworkURL: server.URL}}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTrackArtwork(dbHandler, &artworkCache{client: server.Client(), maxBytes: 1 << 20}))
+	httpHandler.ServeHTTP(recorder, artworkRequest(t, "original"))
+	require.Equal(t, http.StatusBadGateway, recorder.Code)
+}
+
+func TestApi_UploadTrackArtwork_ShouldStoreNormalisedArtworkAndServeIt(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "cover me"}, testAudio)
+	require.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "artwork")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	require.Nil(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 600, 400))))
+	var fileIDs []primitive.ObjectID
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPut, "/track/{id}/art", bytes.NewReader(buf.Bytes()))
+		require.Nil(t, err)
+		req = mux.SetURLVars(req, map[string]string{"id": track.ID.Hex()})
+		req.Header.Set("Authorization", "Bearer test")
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(uploadTrackArtwork(handler, artworkUploads{size: 200, maxSide: 1000})).ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var updated models.Track
+		require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &updated))
+		require.False(t, updated.ArtworkFileID.IsZero())
+		fileIDs = append(fileIDs, updated.ArtworkFileID)
+	}
+
+	// Replacing the artwork deletes the file it replaced.
+	_, err = handler.DownloadAudioFile(ctx, fileIDs[0])
+	require.NotNil(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}/art?size=64", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": track.ID.Hex()})
+	req.Header.Set("Authorization", "Bearer test")
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getTrackArtwork(handler, &artworkCache{dir: dir})).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "image/jpeg", recorder.Header().Get("Content-Type"))
+
+	config, _, err := image.DecodeConfig(recorder.Body)
+	require.Nil(t, err)
+	require.Equal(t, 64, config.Width)
+	require.Equal(t, 64, config.Height)
+}
+
+func TestApi_UploadTrackArtwork_ShouldReturn422ForArtworkThatIsTooLarge(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "huge"}, testAudio)
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	require.Nil(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2000, 20))))
+	req, err := http.NewRequest(http.MethodPut, "/track/{id}/art", bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": track.ID.Hex()})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(uploadTrackArtwork(handler, artworkUploads{size: 200, maxSide: 1000})).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+// authPolicy is what a route asks of a request's credentials before its handler runs.
+type authPolicy int
+
+const (
+	// authUser requires a bearer token the login service accepts. It is the zero value, so a route only skips the
+	// login service if it says so.
+	authUser authPolicy = iota
+	// authUserOrSigned also lets through requests carrying a ?signature=, which the handler verifies itself.
+	authUserOrSigned
+	// authUserOrQuery also accepts the token as a "token" query parameter, for players that cannot set headers.
+	authUserOrQuery
+	// authPublic leaves any credentials to the handler, as with share links and guest tokens, which are signed rather
+	// than known to the login service.
+	authPublic
+)
+
+type principalKey struct{}
+
+// principal is the caller a request was authenticated as.
+type principal struct {
+	token  string
+	userID string
+	claims map[string]interface{}
+	// apiKey is the key the request was made with, or nil if it was not made with an API key.
+	apiKey *models.APIKey
+}
+
+// principalFromContext returns the caller authenticated by authenticator.wrap. ok is false for public routes and
+// signed requests, which are not made as a user.
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+	return p, ok
+}
+
+// authenticator checks requests against the policy of the route they are made to, so that handlers can take the
+// caller as authenticated.
+type authenticator struct {
+	ext service.ExtHandler
+	// limiter, if set, rate limits requests made with an API key, which the router's rate limiter leaves to be limited
+	// once their key has been looked up here.
+	limiter *rateLimiter
+}
+
+// wrap checks the request's token with the login service before calling next, unless the policy lets the request
+// through without one. The caller is recorded in the context both as a principal and, for attributing what the
+// request creates, as the dao user, and an API key's role replaces the one tokenRoles.middleware guessed for it. A
+// request without a usable token is refused with 401 and a WWW-Authenticate challenge.
+func (a authenticator) wrap(policy authPolicy, next http.HandlerFunc) http.HandlerFunc {
+	if a.limiter != nil {
+		next = a.limiter.limitAPIKeys(next)
+	}
+	if policy == authPublic {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if policy == authUserOrSigned && r.URL.Query().Get("signature") != "" {
+			next(w, r)
+			return
+		}
+
+		var token string
+		if policy == authUserOrQuery {
+			token = r.URL.Query().Get("token")
+		}
+		if token == "" {
+			var err error
+			if token, err = getAuthToken(r); err != nil {
+				logrus.WithError(err).Error("Error retrieving auth token")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				respondWithError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+		}
+
+		identity, err := a.ext.ValidateToken(r.Context(), token)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, principal{
+			token:  token,
+			userID: identity.UserID,
+			claims: identity.Claims,
+			apiKey: identity.APIKey,
+		})
+		if identity.APIKey != nil {
+			role := models.RoleListener
+			if isRole(identity.APIKey.Role) {
+				role = identity.APIKey.Role
+			}
+			ctx = context.WithValue(ctx, tokenRoleKey{}, role)
+		}
+		if identity.UserID != "" {
+			ctx = dao.WithUser(ctx, identity.UserID)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
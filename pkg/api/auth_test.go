@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func serveAuthenticated(t *testing.T, ext service.ExtHandler, policy authPolicy, path string, header string) (*httptest.ResponseRecorder, bool) {
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	require.Nil(t, err)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+
+	served := false
+	recorder := httptest.NewRecorder()
+	authenticator{ext: ext}.wrap(policy, func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}).ServeHTTP(recorder, req)
+	return recorder, served
+}
+
+func TestApi_Authenticator_ShouldReturn401WithChallengeIfNoAuthorizationHeaderFound(t *testing.T) {
+	for _, header := range []string{"", "Basic dGVzdA==", "Bearer"} {
+		recorder, served := serveAuthenticated(t, &mocks.ExtHandler{}, authUser, "/tracks", header)
+		require.False(t, served)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		require.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestApi_Authenticator_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything, "test").Return(models.Identity{}, errors.New("test"))
+
+	recorder, served := serveAuthenticated(t, extHandler, authUser, "/tracks", "Bearer test")
+	require.False(t, served)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, `Bearer error="invalid_token"`, recorder.Header().Get("WWW-Authenticate"))
+}
+
+func TestApi_Authenticator_ShouldReturn503IfLoginServiceUnavailable(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(models.Identity{}, service.ErrLoginServiceUnavailable)
+
+	recorder, served := serveAuthenticated(t, extHandler, authUser, "/tracks", "Bearer test")
+	require.False(t, served)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestApi_Authenticator_ShouldRecordPrincipalOfValidToken(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything, "test").Return(models.Identity{UserID: "user-1", Claims: map[string]interface{}{"sub": "user-1"}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	var caller principal
+	var user string
+	recorder := httptest.NewRecorder()
+	authenticator{ext: extHandler}.wrap(authUser, func(w http.ResponseWriter, r *http.Request) {
+		caller, _ = principalFromContext(r.Context())
+		user = dao.UserFromContext(r.Context())
+	}).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, principal{token: "test", userID: "user-1", claims: map[string]interface{}{"sub": "user-1"}}, caller)
+	require.Equal(t, "user-1", user)
+}
+
+func TestApi_Authenticator_ShouldLeaveSignedRequestsToHandler(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+
+	_, served := serveAuthenticated(t, extHandler, authUserOrSigned, "/track/1?signature=test", "")
+	require.True(t, served)
+	extHandler.AssertNotCalled(t, "ValidateToken", mock.Anything, mock.Anything)
+
+	recorder, served := serveAuthenticated(t, extHandler, authUser, "/track/1?signature=test", "")
+	require.False(t, served)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestApi_Authenticator_ShouldAcceptTokenFromQueryParameterOnlyIfPolicyAllows(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything, "test").Return(models.Identity{}, nil)
+
+	_, served := serveAuthenticated(t, extHandler, authUserOrQuery, "/radio?token=test", "")
+	require.True(t, served)
+
+	recorder, served := serveAuthenticated(t, extHandler, authUser, "/tracks?token=test", "")
+	require.False(t, served)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestApi_Authenticator_ShouldNotCheckPublicRoutes(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+
+	_, served := serveAuthenticated(t, extHandler, authPublic, "/shared/test", "Bearer guest")
+	require.True(t, served)
+	extHandler.AssertNotCalled(t, "ValidateToken", mock.Anything, mock.Anything)
+}
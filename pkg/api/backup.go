@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+
+	"github.com/sirupsen/logrus"
+)
+
+// getBackup streams a tar archive of the library, for self-hosters to back up without going to the database
+// themselves. The comma-separated "include" and "exclude" query parameters pick the sections, out of tracks,
+// playlists, podcasts, shares, apikeys, audio and versions, with everything included by default. Once the archive has
+// started, an error can only be reported by cutting the response short, leaving an archive without its end.
+func getBackup(handler dao.DbHandler, adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		sections, err := library.SelectBackupSections(sectionList(r.URL.Query().Get("include")), sectionList(r.URL.Query().Get("exclude")))
+		if err != nil {
+			respondWithFieldError(w, "include", err.Error())
+			return
+		}
+
+		name := "music-backup"
+		if tenant := dao.TenantFromContext(ctx); tenant != "" {
+			name += "-" + tenant
+		}
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".tar"}))
+
+		tracker := &headerTracker{ResponseWriter: w}
+		header, err := library.WriteBackup(ctx, handler, tracker, sections)
+		if err != nil {
+			logrus.WithError(err).Error("Error writing backup")
+			if !tracker.wroteHeader {
+				w.Header().Del("Content-Disposition")
+				respondWithStatusError(w, err)
+				return
+			}
+			panic(http.ErrAbortHandler)
+		}
+		logrus.WithField("counts", header.Counts).Info("Backup written")
+	}
+}
+
+// postRestore restores a backup archive written by getBackup, sent as the request body, into the library, keeping
+// the IDs of what it holds. The "conflict" query parameter says what to do with an item whose ID the library already
+// has: skip it, which is the default, overwrite it, or add it as a duplicate under a new ID. The response counts what
+// happened to each section. A restore that fails part way leaves what it had restored in place, so it can be repeated
+// with conflicts skipped.
+func postRestore(handler dao.DbHandler, adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		conflict := r.URL.Query().Get("conflict")
+		switch conflict {
+		case "":
+			conflict = library.RestoreSkip
+		case library.RestoreSkip, library.RestoreOverwrite, library.RestoreDuplicate:
+		default:
+			respondWithFieldError(w, "conflict", "must be one of skip, overwrite or duplicate")
+			return
+		}
+
+		report, err := library.RestoreBackup(ctx, handler, r.Body, conflict)
+		if errors.Is(err, library.ErrInvalidBackup) {
+			logrus.WithError(err).Error("Error reading backup")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			logrus.WithError(err).WithField("counts", report.Counts).Error("Error restoring backup")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		logrus.WithField("counts", report.Counts).Info("Backup restored")
+		respondWithSuccess(w, http.StatusOK, report)
+	}
+}
+
+// sectionList splits a comma-separated list of backup sections.
+func sectionList(value string) []string {
+	var sections []string
+	for _, section := range strings.Split(value, ",") {
+		if section = strings.TrimSpace(section); section != "" {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
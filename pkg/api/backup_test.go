@@ -0,0 +1,95 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func backupRequest(t *testing.T, query string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "/admin/backup"+query, nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func TestApi_GetBackup_ShouldStreamTarArchive(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getBackup(dao.NewMemoryHandler(), "secret")).ServeHTTP(recorder, backupRequest(t, "?exclude=apikeys"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/x-tar", recorder.Header().Get("Content-Type"))
+	require.Contains(t, recorder.Header().Get("Content-Disposition"), "music-backup.tar")
+
+	header, err := tar.NewReader(bytes.NewReader(recorder.Body.Bytes())).Next()
+	require.Nil(t, err)
+	require.Equal(t, "backup.json", header.Name)
+}
+
+func TestApi_GetBackup_ShouldRejectUnknownSection(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getBackup(dao.NewMemoryHandler(), "secret")).ServeHTTP(recorder, backupRequest(t, "?include=users"))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetBackup_ShouldRequireAdminToken(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getBackup(dao.NewMemoryHandler(), "other")).ServeHTTP(recorder, backupRequest(t, ""))
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func restoreRequest(t *testing.T, query string, body []byte) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "/admin/restore"+query, bytes.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func TestApi_PostRestore_ShouldRestoreBackupAndReportCounts(t *testing.T) {
+	ctx := context.Background()
+	source := dao.NewMemoryHandler()
+	track := models.Track{ID: primitive.NewObjectID(), Name: "test"}
+	require.Nil(t, source.AddTrack(ctx, track))
+	var archive bytes.Buffer
+	_, err := library.WriteBackup(ctx, source, &archive, library.BackupSections)
+	require.Nil(t, err)
+
+	handler := dao.NewMemoryHandler()
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(postRestore(handler, "secret")).ServeHTTP(recorder, restoreRequest(t, "", archive.Bytes()))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var report models.RestoreReport
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Equal(t, library.RestoreSkip, report.Conflict)
+	require.Equal(t, models.RestoreCounts{Restored: 1}, report.Counts[library.BackupTracks])
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": track.ID})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+}
+
+func TestApi_PostRestore_ShouldRejectUnknownConflictPolicyAndOtherBodies(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(postRestore(dao.NewMemoryHandler(), "secret")).ServeHTTP(recorder, restoreRequest(t, "?conflict=merge", nil))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(postRestore(dao.NewMemoryHandler(), "secret")).ServeHTTP(recorder, restoreRequest(t, "", []byte("not a tar file")))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_PostRestore_ShouldRequireAdminToken(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(postRestore(dao.NewMemoryHandler(), "other")).ServeHTTP(recorder, restoreRequest(t, "", nil))
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
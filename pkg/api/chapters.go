@@ -0,0 +1,87 @@
+package api
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minChapters and minChapterLength are the rules YouTube itself applies before treating timestamps in a description as
+// chapters.
+const (
+	minChapters      = 3
+	minChapterLength = 10 * time.Second
+)
+
+// chapterLinePattern matches a description line starting with a timestamp, such as "03:12 Title", "1:02:03 - Title" or
+// "[00:00] Title".
+var chapterLinePattern = regexp.MustCompile(`^\s*[\[(]?((?:\d+:)?\d{1,2}:\d{2})[\])]?\s*(?:[-–—:|.]\s*)?(.+?)\s*$`)
+
+// chapter is a titled section of a video. A zero end means the chapter runs to the end of the video.
+type chapter struct {
+	title string
+	start time.Duration
+	end   time.Duration
+}
+
+// parseChapters reads chapters from the timestamps in a video description, the way YouTube does: the first must be at
+// 0:00, they must be in order, there must be at least three and each must be at least ten seconds long. Otherwise the
+// video has no chapters and nil is returned.
+func parseChapters(description string, duration time.Duration) []chapter {
+	var chapters []chapter
+	for _, line := range strings.Split(description, "\n") {
+		match := chapterLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		start, ok := parseTimestamp(match[1])
+		if !ok {
+			continue
+		}
+		if len(chapters) == 0 && start != 0 {
+			return nil
+		}
+		if len(chapters) > 0 {
+			previous := &chapters[len(chapters)-1]
+			if start-previous.start < minChapterLength {
+				return nil
+			}
+			previous.end = start
+		}
+		chapters = append(chapters, chapter{title: match[2], start: start})
+	}
+
+	if len(chapters) < minChapters {
+		return nil
+	}
+	if duration > 0 {
+		last := &chapters[len(chapters)-1]
+		if duration-last.start < minChapterLength {
+			return nil
+		}
+		last.end = duration
+	}
+	return chapters
+}
+
+func parseTimestamp(timestamp string) (time.Duration, bool) {
+	var total time.Duration
+	for _, part := range strings.Split(timestamp, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, false
+		}
+		total = total*60 + time.Duration(n)*time.Second
+	}
+	return total, true
+}
+
+// chapterArgs are the ffmpeg output options that cut a chapter out of the audio.
+func chapterArgs(c chapter) []string {
+	args := []string{"-ss", strconv.FormatFloat(c.start.Seconds(), 'f', 3, 64)}
+	if c.end > 0 {
+		args = append(args, "-t", strconv.FormatFloat((c.end-c.start).Seconds(), 'f', 3, 64))
+	}
+	return args
+}
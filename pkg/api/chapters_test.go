@@ -0,0 +1,53 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const albumDescription = `Full album, enjoy!
+
+Tracklist:
+0:00 Intro
+[03:12] - Second Song
+7:45 | Third Song (feat. Someone)
+1:02:03 Finale
+
+Follow us online.`
+
+func TestApi_ParseChapters_ShouldReadTimestampedLines(t *testing.T) {
+	chapters := parseChapters(albumDescription, 65*time.Minute)
+
+	require.Equal(t, []chapter{
+		{title: "Intro", start: 0, end: 3*time.Minute + 12*time.Second},
+		{title: "Second Song", start: 3*time.Minute + 12*time.Second, end: 7*time.Minute + 45*time.Second},
+		{title: "Third Song (feat. Someone)", start: 7*time.Minute + 45*time.Second, end: time.Hour + 2*time.Minute + 3*time.Second},
+		{title: "Finale", start: time.Hour + 2*time.Minute + 3*time.Second, end: 65 * time.Minute},
+	}, chapters)
+}
+
+func TestApi_ParseChapters_ShouldLeaveLastChapterOpenIfDurationIsUnknown(t *testing.T) {
+	chapters := parseChapters(albumDescription, 0)
+
+	require.Equal(t, time.Duration(0), chapters[len(chapters)-1].end)
+}
+
+func TestApi_ParseChapters_ShouldReturnNilIfFirstChapterDoesNotStartAtZero(t *testing.T) {
+	require.Nil(t, parseChapters("0:30 One\n1:00 Two\n2:00 Three", 5*time.Minute))
+}
+
+func TestApi_ParseChapters_ShouldReturnNilIfThereAreTooFewChapters(t *testing.T) {
+	require.Nil(t, parseChapters("0:00 One\n1:00 Two", 5*time.Minute))
+}
+
+func TestApi_ParseChapters_ShouldReturnNilIfChaptersAreTooShortOrOutOfOrder(t *testing.T) {
+	require.Nil(t, parseChapters("0:00 One\n0:05 Two\n2:00 Three", 5*time.Minute))
+	require.Nil(t, parseChapters("0:00 One\n2:00 Two\n1:00 Three", 5*time.Minute))
+}
+
+func TestApi_ChapterArgs_ShouldSeekAndLimitToChapter(t *testing.T) {
+	require.Equal(t, []string{"-ss", "192.000", "-t", "273.000"}, chapterArgs(chapter{start: 192 * time.Second, end: 465 * time.Second}))
+	require.Equal(t, []string{"-ss", "192.000"}, chapterArgs(chapter{start: 192 * time.Second}))
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"crypto/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid value for %v, using default of %v", key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid value for %v, using default of %v", key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid value for %v, using default of %v", key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// signingSecret returns the key used to sign share links and stream URLs. Without SIGNING_SECRET a random key is
+// generated, so links stop working when the server restarts and are not valid across replicas.
+func signingSecret() []byte {
+	if secret := os.Getenv("SIGNING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	logrus.Warn("SIGNING_SECRET is not set, signed links will not survive a restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logrus.WithError(err).Fatal("Error generating signing secret")
+	}
+	return secret
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid value for %v, using default of %v", key, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeTimeout is how long an ordinary response may take to write. It is enforced by limitWrites rather than by the
+// server's WriteTimeout, which a handler could not lift for the responses that last as long as the client listens.
+const writeTimeout = 200 * time.Second
+
+type connKey struct{}
+
+type writeDeadlineKey struct{}
+
+// rememberConn is the server's ConnContext, keeping each connection in the context of the requests that arrive on it.
+func rememberConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// limitWrites gives the connection of each HTTP/1 request a write deadline of timeout from when the request arrives,
+// as the server's WriteTimeout would. An HTTP/2 connection is shared by concurrent requests, so its deadline is left
+// alone and those requests cannot have theirs moved.
+func limitWrites(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := r.Context().Value(connKey{}).(net.Conn)
+		if !ok || r.ProtoMajor != 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			logrus.WithError(err).Warn("Error setting write deadline")
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), writeDeadlineKey{}, conn)))
+	})
+}
+
+// setWriteDeadline moves the write deadline limitWrites gave the request's connection, with the zero time lifting it
+// for a response that lasts as long as the client listens.
+func setWriteDeadline(ctx context.Context, deadline time.Time) {
+	conn, ok := ctx.Value(writeDeadlineKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		logrus.WithError(err).Warn("Error setting write deadline")
+	}
+}
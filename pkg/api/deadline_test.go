@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_LimitWrites_ShouldCutOffResponsesPastTheDeadline(t *testing.T) {
+	server := httptest.NewUnstartedServer(limitWrites(100*time.Millisecond, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			fmt.Fprintln(w, "chunk")
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	})))
+	server.Config.ConnContext = rememberConn
+	server.Start()
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	require.Nil(t, err)
+	defer response.Body.Close()
+
+	_, err = ioutil.ReadAll(response.Body)
+	require.NotNil(t, err)
+}
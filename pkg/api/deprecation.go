@@ -0,0 +1,104 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// youtubeTrackSunset is when /youtube/track, replaced by /import, is due to be removed, unless YOUTUBE_TRACK_SUNSET
+// moves it.
+const youtubeTrackSunset = "2027-04-30"
+
+// deprecations tracks the use of endpoints due to be removed. Counts are kept by each replica since it started.
+type deprecations struct {
+	mu    sync.Mutex
+	usage map[string]*models.DeprecatedEndpointUsage
+	now   func() time.Time
+}
+
+func newDeprecations() *deprecations {
+	return &deprecations{usage: make(map[string]*models.DeprecatedEndpointUsage), now: time.Now}
+}
+
+// wrap marks the responses of a deprecated endpoint with Deprecation and Sunset headers and a Link to the successor
+// path, and counts and logs each call so that it is known when nobody uses the endpoint any more.
+func (d *deprecations) wrap(endpoint string, successor string, sunset time.Time, next http.HandlerFunc) http.HandlerFunc {
+	d.mu.Lock()
+	d.usage[endpoint] = &models.DeprecatedEndpointUsage{Endpoint: endpoint, Successor: successor, Sunset: sunset}
+	d.mu.Unlock()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		w.Header().Set("Link", "<"+versionedPath(r.Context(), successor)+">; rel=\"successor-version\"")
+
+		d.mu.Lock()
+		usage := d.usage[endpoint]
+		usage.Calls++
+		calledAt := d.now()
+		usage.LastCalledAt = &calledAt
+		calls := usage.Calls
+		d.mu.Unlock()
+
+		logrus.WithFields(logrus.Fields{
+			"endpoint": endpoint,
+			"calls":    calls,
+			"client":   rateLimitClient(r),
+		}).Warn("Deprecated endpoint called")
+		next(w, r)
+	}
+}
+
+// stats returns the usage of each deprecated endpoint, sorted by endpoint.
+func (d *deprecations) stats() []models.DeprecatedEndpointUsage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	stats := make([]models.DeprecatedEndpointUsage, 0, len(d.usage))
+	for _, usage := range d.usage {
+		stat := *usage
+		stat.DaysRemaining = int(math.Max(0, math.Ceil(stat.Sunset.Sub(now).Hours()/24)))
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Endpoint < stats[j].Endpoint
+	})
+	return stats
+}
+
+// sunsetDate reads a sunset date, such as 2027-04-30, from the environment.
+func sunsetDate(key string, fallback string) time.Time {
+	sunset, err := time.Parse("2006-01-02", getEnv(key, fallback))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid value for %v, using default of %v", key, fallback)
+		sunset, _ = time.Parse("2006-01-02", fallback)
+	}
+	return sunset
+}
+
+// getAdminStats reports on this replica for operators, such as how much the endpoints due to be removed are still used,
+// the figures for each library as last aggregated, and how off-site backups are going.
+func getAdminStats(adminToken string, deprecated *deprecations, libraries *libraryStats, offsite *offsiteBackup) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, models.AdminStats{
+			DeprecatedEndpoints: deprecated.stats(),
+			Libraries:           libraries.get(),
+			OffsiteBackup:       offsite.get(),
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_Deprecations_ShouldMarkResponsesAndCountCalls(t *testing.T) {
+	now := time.Date(2027, 4, 20, 12, 0, 0, 0, time.UTC)
+	deprecated := newDeprecations()
+	deprecated.now = func() time.Time { return now }
+	sunset := time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC)
+
+	handler := deprecated.wrap("POST /youtube/track", "/import", sunset, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, "/youtube/track", http.NoBody)
+		require.Nil(t, err)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusCreated, recorder.Code)
+		require.Equal(t, "true", recorder.Header().Get("Deprecation"))
+		require.Equal(t, "Fri, 30 Apr 2027 00:00:00 GMT", recorder.Header().Get("Sunset"))
+		require.Equal(t, `</v1/import>; rel="successor-version"`, recorder.Header().Get("Link"))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/admin/stats", http.NoBody)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer admin")
+	recorder := httptest.NewRecorder()
+	getAdminStats("admin", deprecated, &libraryStats{}, nil).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var stats models.AdminStats
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &stats))
+	require.Len(t, stats.DeprecatedEndpoints, 1)
+	usage := stats.DeprecatedEndpoints[0]
+	require.Equal(t, "POST /youtube/track", usage.Endpoint)
+	require.Equal(t, int64(2), usage.Calls)
+	require.Equal(t, 10, usage.DaysRemaining)
+	require.True(t, now.Equal(*usage.LastCalledAt))
+}
+
+func TestApi_GetAdminStats_ShouldReturn403WithoutAdminToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/admin/stats", http.NoBody)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	getAdminStats("admin", newDeprecations(), &libraryStats{}, nil).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
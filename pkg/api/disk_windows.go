@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package api
+
+import "errors"
+
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errors.New("free disk space is not available on windows")
+}
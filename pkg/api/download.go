@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// downloadRetryAfter is how long, in seconds, clients are asked to wait when every download slot is taken.
+const downloadRetryAfter = 30
+
+// downloadSettings limits zip downloads, each of which holds the audio of one track in memory at a time while it is
+// sent. Archives have at most maxTracks tracks, and at most as many are built at once as slots has room for.
+type downloadSettings struct {
+	maxTracks int
+	slots     chan struct{}
+}
+
+func newDownloadSettings(maxTracks int, maxParallel int) downloadSettings {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	return downloadSettings{maxTracks: maxTracks, slots: make(chan struct{}, maxParallel)}
+}
+
+// acquire takes a download slot without waiting, returning the function that gives it back, or false if they are all
+// in use.
+func (d downloadSettings) acquire() (func(), bool) {
+	select {
+	case d.slots <- struct{}{}:
+		return func() { <-d.slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// downloadPlaylist sends the audio of a playlist's tracks as a zip archive, built as it is sent, with files named
+// "NN - Artist - Title.ext" in playlist order.
+func downloadPlaylist(handler dao.DbHandler, settings downloadSettings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+		playlist := playlists[0]
+
+		tracks, err := orderedTracks(ctx, handler, playlist.Tracks)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		sendArchive(w, r, handler, settings, playlist.Name, tracks, nil)
+	}
+}
+
+// downloadAlbum sends the audio of an album's tracks as a zip archive in track number order, along with the album's
+// cover when it has one that can be fetched.
+func downloadAlbum(handler dao.DbHandler, settings downloadSettings, artwork *artworkCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		albums, err := library.Albums(ctx, handler)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving albums")
+			respondWithStatusError(w, err)
+			return
+		}
+		var album *models.Album
+		for i := range albums {
+			if albums[i].ID == mux.Vars(r)["id"] {
+				album = &albums[i]
+				break
+			}
+		}
+		if album == nil {
+			respondWithError(w, http.StatusNotFound, "Album not found")
+			return
+		}
+
+		tracks, err := orderedTracks(ctx, handler, album.Tracks)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving album tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		// A missing cover is not worth failing the download over, so the archive is sent without it.
+		var cover []byte
+		switch {
+		case !album.ArtworkFileID.IsZero():
+			cover, err = artwork.getUploaded(ctx, handler, album.ArtworkFileID, artworkOriginal)
+		case album.ArtworkURL != "":
+			cover, err = artwork.get(ctx, album.ArtworkURL, artworkOriginal)
+		}
+		if err != nil {
+			logrus.WithError(err).Warn("Error getting album artwork for download")
+			cover = nil
+		}
+
+		sendArchive(w, r, handler, settings, album.Artist+" - "+album.Name, tracks, cover)
+	}
+}
+
+// orderedTracks returns the tracks with the given IDs in the order of the IDs, leaving out any that no longer exist.
+func orderedTracks(ctx context.Context, handler dao.DbHandler, ids []primitive.ObjectID) ([]models.Track, error) {
+	found, err := handler.GetTracks(ctx, map[string]interface{}{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.Track, len(found))
+	for _, track := range found {
+		byID[track.ID] = track
+	}
+	var tracks []models.Track
+	for _, id := range ids {
+		if track, ok := byID[id]; ok {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks, nil
+}
+
+// sendArchive streams a zip archive of the given tracks, numbered in order, as an attachment named after the
+// collection they are from, with the collection's cover art first when there is any. Once the archive has started, a failure can no longer be reported with a status, so the
+// connection is dropped instead to keep clients from taking a cut-off archive for a whole one.
+func sendArchive(w http.ResponseWriter, r *http.Request, handler dao.DbHandler, settings downloadSettings, name string, tracks []models.Track, cover []byte) {
+	if settings.maxTracks > 0 && len(tracks) > settings.maxTracks {
+		respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("At most %v tracks can be downloaded at once", settings.maxTracks))
+		return
+	}
+
+	release, ok := settings.acquire()
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(downloadRetryAfter))
+		respondWithError(w, http.StatusServiceUnavailable, "Too many downloads are in progress, try again later")
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": library.SanitizeFileName(name) + ".zip"}))
+
+	// An archive can take far longer to send than the write deadline allows, so each file gets its own instead.
+	setWriteDeadline(r.Context(), time.Now().Add(writeTimeout))
+	archive := library.NewZipWriter(w, handler)
+	if cover != nil {
+		if err := archive.AddCover(cover); err != nil {
+			logrus.WithError(err).Error("Error writing cover to archive")
+			panic(http.ErrAbortHandler)
+		}
+	}
+	for i, track := range tracks {
+		setWriteDeadline(r.Context(), time.Now().Add(writeTimeout))
+		if err := archive.AddTrack(r.Context(), library.TrackFileName(i+1, track), track); err != nil {
+			logrus.WithError(err).Error("Error writing track to archive")
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		logrus.WithError(err).Error("Error finishing archive")
+		panic(http.ErrAbortHandler)
+	}
+}
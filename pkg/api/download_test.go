@@ -0,0 +1,170 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_DownloadPlaylist_ShouldSendTracksAsZipInPlaylistOrder(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	first, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "first", Artist: "AC/DC"}, testAudio)
+	require.Nil(t, err)
+	second, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "second", Artist: "band"}, testAudio)
+	require.Nil(t, err)
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "road trip", Tracks: []primitive.ObjectID{second.ID, first.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(downloadPlaylist(handler, newDownloadSettings(10, 1))).
+		ServeHTTP(recorder, guestRequest(t, "/playlist/{id}/download", "test", map[string]string{"id": playlist.ID.Hex()}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/zip", recorder.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename="road trip.zip"`, recorder.Header().Get("Content-Disposition"))
+
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	require.Nil(t, err)
+	require.Len(t, archive.File, 2)
+	require.Equal(t, "01 - band - second.mp3", archive.File[0].Name)
+	require.Equal(t, "02 - AC_DC - first.mp3", archive.File[1].Name)
+
+	file, err := archive.File[0].Open()
+	require.Nil(t, err)
+	contents, err := io.ReadAll(file)
+	require.Nil(t, err)
+	require.Equal(t, testAudio, contents)
+}
+
+func TestApi_DownloadPlaylist_ShouldReturn422IfPlaylistHasTooManyTracks(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "long"}
+	for i := 0; i < 3; i++ {
+		track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "track"}, testAudio)
+		require.Nil(t, err)
+		playlist.Tracks = append(playlist.Tracks, track.ID)
+	}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(downloadPlaylist(handler, newDownloadSettings(2, 1))).
+		ServeHTTP(recorder, guestRequest(t, "/playlist/{id}/download", "test", map[string]string{"id": playlist.ID.Hex()}))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func TestApi_DownloadPlaylist_ShouldReturn503IfEveryDownloadSlotIsTaken(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "busy"}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	settings := newDownloadSettings(10, 1)
+	release, ok := settings.acquire()
+	require.True(t, ok)
+	defer release()
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(downloadPlaylist(handler, settings)).
+		ServeHTTP(recorder, guestRequest(t, "/playlist/{id}/download", "test", map[string]string{"id": playlist.ID.Hex()}))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Equal(t, "30", recorder.Header().Get("Retry-After"))
+}
+
+func TestApi_DownloadPlaylist_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(downloadPlaylist(dao.NewMemoryHandler(), newDownloadSettings(10, 1))).
+		ServeHTTP(recorder, guestRequest(t, "/playlist/{id}/download", "test", map[string]string{"id": primitive.NewObjectID().Hex()}))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_DownloadAlbum_ShouldSendCoverAndTracksInTrackNumberOrder(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 10, 10))))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "artwork")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	for _, track := range []models.Track{
+		{ID: primitive.NewObjectID(), Name: "closer", Artist: "band", AlbumName: "record", TrackNumber: 2},
+		{ID: primitive.NewObjectID(), Name: "opener", Artist: "band", AlbumName: "record", TrackNumber: 1, ArtworkURL: server.URL + "/cover.png"},
+	} {
+		_, err := library.StoreTrack(ctx, handler, track, testAudio)
+		require.Nil(t, err)
+	}
+	cache := &artworkCache{dir: dir, client: server.Client(), maxBytes: 1 << 20}
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(downloadAlbum(handler, newDownloadSettings(10, 1), cache)).
+		ServeHTTP(recorder, guestRequest(t, "/album/{id}/download", "test", map[string]string{"id": library.AlbumID("band", "record")}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `attachment; filename="band - record.zip"`, recorder.Header().Get("Content-Disposition"))
+
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	require.Nil(t, err)
+	require.Len(t, archive.File, 3)
+	require.Equal(t, "cover.png", archive.File[0].Name)
+	require.Equal(t, "01 - band - opener.mp3", archive.File[1].Name)
+	require.Equal(t, "02 - band - closer.mp3", archive.File[2].Name)
+}
+
+func TestApi_DownloadAlbum_ShouldReturn404IfAlbumNotFound(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(downloadAlbum(dao.NewMemoryHandler(), newDownloadSettings(10, 1), &artworkCache{})).
+		ServeHTTP(recorder, guestRequest(t, "/album/{id}/download", "test", map[string]string{"id": "missing"}))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_DownloadPlaylist_ShouldSendArchivePastWriteDeadline(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "first", Artist: "band"}, testAudio)
+	require.Nil(t, err)
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "road trip", Tracks: []primitive.ObjectID{track.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/playlist/{id}/download", downloadPlaylist(handler, newDownloadSettings(10, 1)))
+	// The deadline has passed before anything is written, so only the archive's own deadlines let it through.
+	server := httptest.NewUnstartedServer(limitWrites(time.Nanosecond, router))
+	server.Config.ConnContext = rememberConn
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/playlist/" + playlist.ID.Hex() + "/download")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.Nil(t, err)
+	require.Len(t, archive.File, 1)
+}
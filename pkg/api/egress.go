@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// egressSettings configures how requests to external services leave the network, for deployments where direct egress
+// is blocked. proxyURL may be an http, https or socks5 URL; when empty the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// variables apply as usual. caBundle is a PEM file of certificates trusted alongside the system's, such as those of a
+// proxy that intercepts TLS.
+type egressSettings struct {
+	proxyURL string
+	caBundle string
+}
+
+func egressSettingsFromEnv() egressSettings {
+	return egressSettings{
+		proxyURL: os.Getenv("OUTBOUND_PROXY_URL"),
+		caBundle: os.Getenv("OUTBOUND_CA_BUNDLE"),
+	}
+}
+
+// client returns an HTTP client that sends requests through the configured proxy and trusts the configured
+// certificates, or http.DefaultClient if neither is configured.
+func (s egressSettings) client() (*http.Client, error) {
+	if s.proxyURL == "" && s.caBundle == "" {
+		return http.DefaultClient, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.proxyURL != "" {
+		proxy, err := url.Parse(s.proxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid OUTBOUND_PROXY_URL %q", s.proxyURL)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid OUTBOUND_PROXY_URL %q, scheme must be http, https or socks5", s.proxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if s.caBundle != "" {
+		pem, err := ioutil.ReadFile(s.caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("error reading OUTBOUND_CA_BUNDLE: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("OUTBOUND_CA_BUNDLE %q contains no PEM certificates", s.caBundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressSettings_Client_ShouldSendRequestsThroughProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	client, err := egressSettings{proxyURL: proxy.URL}.client()
+	require.Nil(t, err)
+
+	resp, err := client.Get("http://login.example.com/token")
+	require.Nil(t, err)
+	require.Nil(t, resp.Body.Close())
+	require.Equal(t, "http://login.example.com/token", proxied)
+}
+
+func TestEgressSettings_Client_ShouldTrustCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.Nil(t, ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	_, err := http.DefaultClient.Get(server.URL)
+	require.NotNil(t, err)
+
+	client, err := egressSettings{caBundle: bundle}.client()
+	require.Nil(t, err)
+	resp, err := client.Get(server.URL)
+	require.Nil(t, err)
+	require.Nil(t, resp.Body.Close())
+}
+
+func TestEgressSettings_Client_ShouldReturnErrorForUnsupportedProxyScheme(t *testing.T) {
+	_, err := egressSettings{proxyURL: "ftp://proxy.example.com"}.client()
+	require.NotNil(t, err)
+}
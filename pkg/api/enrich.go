@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func enrichTrack(handler dao.DbHandler, provider service.MetadataProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		track := tracks[0]
+		metadata, err := provider.LookupTrack(ctx, knownValue(track.Artist), knownValue(track.Name))
+		if err != nil {
+			logrus.WithError(err).Error("Error looking up track metadata")
+			respondWithError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		if metadata == nil {
+			respondWithError(w, http.StatusNotFound, "No metadata found for track")
+			return
+		}
+
+		applyMetadata(&track, metadata)
+
+		// Expecting the revision that was read keeps a lookup from overwriting an edit made while it was running.
+		if err := handler.UpdateTrack(ctx, id, track, track.Revision); errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Track was changed during the lookup, try again")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error updating track in database")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, track)
+		return
+	}
+}
+
+// enrichers holds the metadata providers available for enriching tracks. onUpload is applied to every upload when
+// configured, while providers can be selected by name on individual import requests.
+type enrichers struct {
+	onUpload  service.MetadataProvider
+	providers map[string]service.MetadataProvider
+}
+
+func (e enrichers) forRequest(name string) (service.MetadataProvider, error) {
+	if name == "" {
+		return e.onUpload, nil
+	}
+
+	provider, ok := e.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown enrichment option '%v'", name)
+	}
+	return provider, nil
+}
+
+// enrichOnUpload fills in missing metadata for a track that is about to be stored. Lookup failures are logged rather
+// than returned, since an upload should never fail because a metadata service is unavailable.
+func enrichOnUpload(ctx context.Context, provider service.MetadataProvider, track *models.Track) {
+	if provider == nil || knownValue(track.Name) == "" {
+		return
+	}
+
+	metadata, err := provider.LookupTrack(ctx, knownValue(track.Artist), track.Name)
+	if err != nil {
+		logrus.WithError(err).Warn("Error looking up track metadata, storing track as-is")
+		return
+	}
+	if metadata == nil {
+		return
+	}
+	if spotify, ok := provider.(spotifyEnricher); ok {
+		spotify.apply(track, metadata)
+	} else {
+		applyMetadata(track, metadata)
+	}
+}
+
+// spotifyEnricher matches imports on Spotify for requests that ask for it. Those are mostly YouTube rips still named
+// after the video, such as "Song (Official Video) [HD]", so unlike other providers its match replaces the name the
+// track was imported with rather than only a placeholder.
+type spotifyEnricher struct {
+	service.MetadataProvider
+}
+
+func (s spotifyEnricher) apply(track *models.Track, metadata *models.TrackMetadata) {
+	applyMetadata(track, metadata)
+	if metadata.Name != "" {
+		track.Name = metadata.Name
+	}
+}
+
+// applyMetadata copies looked-up metadata onto a track, filling placeholder values and replacing the artist with its
+// canonical name.
+func applyMetadata(track *models.Track, metadata *models.TrackMetadata) {
+	if knownValue(track.Name) == "" && metadata.Name != "" {
+		track.Name = metadata.Name
+	}
+	if metadata.Artist != "" {
+		track.Artist = metadata.Artist
+	}
+	if knownValue(track.AlbumName) == "" && metadata.AlbumName != "" {
+		track.AlbumName = metadata.AlbumName
+	}
+	if track.Year == 0 {
+		track.Year = metadata.Year
+	}
+	if track.ArtworkURL == "" {
+		track.ArtworkURL = metadata.ArtworkURL
+	}
+	if metadata.MusicBrainzID != "" {
+		track.MusicBrainzID = metadata.MusicBrainzID
+	}
+}
+
+// knownValue returns the given value, or an empty string if it is one of the placeholders assigned to tracks uploaded
+// without metadata.
+func knownValue(value string) string {
+	switch value {
+	case "Unknown", "Unknown Artist", "Unknown Album":
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_EnrichTrack_ShouldReturn404IfTrackNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	provider := &mocks.MetadataProvider{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/enrich", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(enrichTrack(dbHandler, provider))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_EnrichTrack_ShouldReturn502IfLookupErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	provider := &mocks.MetadataProvider{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Name: "test"}}, nil)
+	provider.On("LookupTrack", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/enrich", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(enrichTrack(dbHandler, provider))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadGateway, recorder.Code)
+}
+
+func TestApi_EnrichTrack_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	provider := &mocks.MetadataProvider{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Name: "test", AlbumName: "Unknown Album"}}, nil)
+	dbHandler.On("UpdateTrack", mock.Anything, mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.AlbumName == "Album" && track.Year == 2001
+	}), int64(0)).Return(nil)
+	provider.On("LookupTrack", mock.Anything, mock.Anything, mock.Anything).Return(&models.TrackMetadata{AlbumName: "Album", Year: 2001}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/enrich", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(enrichTrack(dbHandler, provider))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_EnrichOnUpload_ShouldOnlyReplaceImportedNameForSpotify(t *testing.T) {
+	provider := &mocks.MetadataProvider{}
+	provider.On("LookupTrack", mock.Anything, mock.Anything, mock.Anything).Return(&models.TrackMetadata{Name: "Song", Artist: "Band"}, nil)
+
+	track := models.Track{Name: "Band - Song (Official Video) [HD]", Artist: "Unknown Artist"}
+	enrichOnUpload(context.Background(), provider, &track)
+	require.Equal(t, "Band - Song (Official Video) [HD]", track.Name)
+	require.Equal(t, "Band", track.Artist)
+
+	track = models.Track{Name: "Band - Song (Official Video) [HD]", Artist: "Unknown Artist"}
+	enrichOnUpload(context.Background(), spotifyEnricher{provider}, &track)
+	require.Equal(t, "Song", track.Name)
+	require.Equal(t, "Band", track.Artist)
+}
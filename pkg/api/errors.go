@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+const internalErrorMessage = "Internal server error"
+
+// errorCodes are the stable codes reported for each status. Clients should match on these rather than on messages.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusUnauthorized:          "unauthenticated",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal",
+	http.StatusBadGateway:            "upstream_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+}
+
+// statusError is an error that should be reported with a particular HTTP status, for work that can run either in a
+// request or as a job.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e statusError) Unwrap() error {
+	return e.err
+}
+
+// errorStatus picks the status to report err with: the one it carries, or one implied by a well-known cause, such as
+// one of the kinds of error the DAO reports.
+func errorStatus(err error) int {
+	var withStatus statusError
+	switch {
+	case errors.As(err, &withStatus):
+		return withStatus.code
+	case errors.Is(err, dao.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, dao.ErrNoTenant):
+		return http.StatusBadRequest
+	case errors.Is(err, dao.ErrDuplicate), errors.Is(err, dao.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, library.ErrPoolFull), errors.Is(err, dao.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondWithStatusError reports err with the status errorStatus picks for it. A database that stayed out of reach
+// through every retry is reported without the driver's error, and with a hint to try again.
+func respondWithStatusError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dao.ErrUnavailable) {
+		w.Header().Set("Retry-After", "5")
+		respondWithError(w, http.StatusServiceUnavailable, "The database is unavailable, please retry shortly")
+		return
+	}
+	respondWithError(w, errorStatus(err), err.Error())
+}
+
+// respondWithError writes the error envelope. The message of a 500 is replaced with a generic one, since it is usually
+// a raw database or ffmpeg error; callers log the original, and the request ID in the envelope ties the two together.
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	writeErrorResponse(w, code, message, nil)
+}
+
+// respondWithFieldError reports a request rejected because of one of its fields, such as a query parameter out of
+// range.
+func respondWithFieldError(w http.ResponseWriter, field string, message string) {
+	writeErrorResponse(w, http.StatusBadRequest, "Invalid request", []models.FieldError{{Field: field, Message: message}})
+}
+
+// respondWithAuthError reports a failed token validation, distinguishing a login service outage, which clients may
+// retry, from a rejected token.
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrLoginServiceUnavailable) {
+		logrus.WithError(err).Error("Login service unavailable")
+		respondWithError(w, http.StatusServiceUnavailable, "Authentication service unavailable")
+		return
+	}
+
+	logrus.WithError(err).Error("Authentication failed")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+}
+
+func writeErrorResponse(w http.ResponseWriter, code int, message string, details []models.FieldError) {
+	errorCode, ok := errorCodes[code]
+	if !ok {
+		errorCode = "error"
+	}
+	if code == http.StatusInternalServerError || message == "" {
+		message = internalErrorMessage
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(models.ErrorResponse{
+		Code:    errorCode,
+		Message: message,
+		Details: details,
+		// requestIDMiddleware has already put the ID on the response, which saves threading the request through.
+		RequestID: w.Header().Get(requestIDHeader),
+	}); err != nil {
+		logrus.WithError(err).Error("Error encoding response")
+	}
+}
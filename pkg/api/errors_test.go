@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_RespondWithError_ShouldHideInternalErrorsAndIncludeRequestID(t *testing.T) {
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWithError(w, http.StatusInternalServerError, "connection(localhost:27017) incomplete read")
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set(requestIDHeader, "abc-123")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+	var body models.ErrorResponse
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, models.ErrorResponse{Code: "internal", Message: internalErrorMessage, RequestID: "abc-123"}, body)
+}
+
+func TestApi_RespondWithFieldError_ShouldIncludeDetails(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	respondWithFieldError(recorder, "limit", "limit must be between 1 and 100")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var body models.ErrorResponse
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, "invalid_request", body.Code)
+	require.Equal(t, []models.FieldError{{Field: "limit", Message: "limit must be between 1 and 100"}}, body.Details)
+}
+
+func TestApi_ErrorStatus_ShouldMapWellKnownErrors(t *testing.T) {
+	require.Equal(t, http.StatusBadGateway, errorStatus(fmt.Errorf("wrapped: %w", statusError{code: http.StatusBadGateway, err: errors.New("test")})))
+	require.Equal(t, http.StatusNotFound, errorStatus(fmt.Errorf("wrapped: %w", dao.ErrNotFound)))
+	require.Equal(t, http.StatusConflict, errorStatus(fmt.Errorf("%w: E11000 duplicate key error", dao.ErrDuplicate)))
+	require.Equal(t, http.StatusConflict, errorStatus(dao.ErrJobStatus))
+	require.Equal(t, http.StatusGatewayTimeout, errorStatus(context.DeadlineExceeded))
+	require.Equal(t, http.StatusServiceUnavailable, errorStatus(fmt.Errorf("%w: connection reset", dao.ErrUnavailable)))
+	require.Equal(t, http.StatusInternalServerError, errorStatus(errors.New("test")))
+}
+
+func TestApi_RespondWithStatusError_ShouldHideDriverErrorWhenDatabaseUnavailable(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	respondWithStatusError(recorder, fmt.Errorf("%w: server selection error: connection refused", dao.ErrUnavailable))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Equal(t, "5", recorder.Header().Get("Retry-After"))
+
+	var body models.ErrorResponse
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, "unavailable", body.Code)
+	require.NotContains(t, body.Message, "connection refused")
+}
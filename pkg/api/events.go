@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// eventBuffer is how many events a client may fall behind by before further events to it are dropped.
+const eventBuffer = 64
+
+// eventActions names the change stream operations in event types, such as "track.updated".
+var eventActions = map[string]string{
+	"insert":  "created",
+	"update":  "updated",
+	"replace": "updated",
+	"delete":  "deleted",
+}
+
+// eventHub passes events to the clients following the library they belong to.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+}
+
+type eventSubscriber struct {
+	tenant string
+	events chan models.Event
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// subscribe returns the events for the tenant's library, and the function that stops them.
+func (h *eventHub) subscribe(tenant string) (<-chan models.Event, func()) {
+	subscriber := &eventSubscriber{tenant: tenant, events: make(chan models.Event, eventBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[subscriber] = struct{}{}
+
+	return subscriber.events, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers, subscriber)
+	}
+}
+
+// publish passes the event to every subscriber to the tenant's library. A subscriber too far behind misses it rather
+// than holding up the others.
+func (h *eventHub) publish(tenant string, event models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for subscriber := range h.subscribers {
+		if subscriber.tenant != tenant {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+		default:
+			logrus.WithField("event", event.Type).Warn("Dropping event for slow subscriber")
+		}
+	}
+}
+
+// publishChanges publishes changes to tracks and playlists to the hub until the context is cancelled. They are read
+// from change streams, so changes made through other replicas or musicctl reach clients too.
+func publishChanges(ctx context.Context, handler dao.DbHandler, hub *eventHub, retry time.Duration) {
+	go followChanges(ctx, "tracks", retry, func(ctx context.Context) error {
+		return handler.WatchTracks(ctx, func(change models.TrackChange) error {
+			hub.publish(change.Tenant, models.Event{Type: "track." + eventActions[change.Operation], ID: change.TrackID, Track: change.Track})
+			return nil
+		})
+	})
+	go followChanges(ctx, "playlists", retry, func(ctx context.Context) error {
+		return handler.WatchPlaylists(ctx, func(change models.PlaylistChange) error {
+			hub.publish(change.Tenant, models.Event{Type: "playlist." + eventActions[change.Operation], ID: change.PlaylistID, Playlist: change.Playlist})
+			return nil
+		})
+	})
+}
+
+// followChanges runs watch until the context is cancelled, reopening it after retry if it fails. Changes made while it
+// is not running are missed.
+func followChanges(ctx context.Context, name string, retry time.Duration, watch func(ctx context.Context) error) {
+	for {
+		err := watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logrus.WithError(err).WithField("changes", name).Error("Error following changes, retrying")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// streamEvents sends changes to the caller's library as server-sent events until the client goes away. A comment is
+// sent every keepAlive so that proxies do not close an idle stream.
+func streamEvents(hub *eventHub, keepAlive time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondWithError(w, http.StatusInternalServerError, "Streaming is not supported")
+			return
+		}
+
+		events, unsubscribe := hub.subscribe(dao.TenantFromContext(ctx))
+		defer unsubscribe()
+
+		// The stream lasts as long as the client listens, so it must not be cut off by the write deadline.
+		setWriteDeadline(ctx, time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					logrus.WithError(err).Error("Error encoding event")
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: %v\ndata: %s\n\n", event.Type, data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
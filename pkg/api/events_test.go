@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_EventHub_ShouldOnlyPublishToSubscribersOfTheTenant(t *testing.T) {
+	hub := newEventHub()
+	acme, unsubscribeAcme := hub.subscribe("acme")
+	defer unsubscribeAcme()
+	other, unsubscribeOther := hub.subscribe("other")
+	defer unsubscribeOther()
+
+	event := models.Event{Type: "track.created", ID: primitive.NewObjectID()}
+	hub.publish("acme", event)
+
+	require.Equal(t, event, <-acme)
+	require.Len(t, other, 0)
+}
+
+func TestApi_EventHub_ShouldStopPublishingOnceUnsubscribed(t *testing.T) {
+	hub := newEventHub()
+	events, unsubscribe := hub.subscribe("")
+	unsubscribe()
+
+	hub.publish("", models.Event{Type: "track.deleted"})
+	require.Len(t, events, 0)
+}
+
+func TestApi_PublishChanges_ShouldPublishTrackAndPlaylistChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song"}
+	playlistID := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("WatchTracks", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handle := args.Get(1).(func(models.TrackChange) error)
+		handle(models.TrackChange{Operation: "insert", Tenant: "acme", TrackID: track.ID, Track: &track})
+		<-ctx.Done()
+	}).Return(context.Canceled)
+	dbHandler.On("WatchPlaylists", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handle := args.Get(1).(func(models.PlaylistChange) error)
+		handle(models.PlaylistChange{Operation: "delete", Tenant: "acme", PlaylistID: playlistID})
+		<-ctx.Done()
+	}).Return(context.Canceled)
+
+	hub := newEventHub()
+	events, unsubscribe := hub.subscribe("acme")
+	defer unsubscribe()
+	publishChanges(ctx, dbHandler, hub, time.Millisecond)
+
+	received := map[string]models.Event{}
+	for len(received) < 2 {
+		event := <-events
+		received[event.Type] = event
+	}
+	require.Equal(t, models.Event{Type: "track.created", ID: track.ID, Track: &track}, received["track.created"])
+	require.Equal(t, models.Event{Type: "playlist.deleted", ID: playlistID}, received["playlist.deleted"])
+}
+
+func TestApi_StreamEvents_ShouldSendEventsToClient(t *testing.T) {
+
+	hub := newEventHub()
+	server := httptest.NewServer(streamEvents(hub, time.Minute))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+	resp, err := server.Client().Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	id := primitive.NewObjectID()
+	hub.publish("", models.Event{Type: "track.deleted", ID: id})
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.Nil(t, err)
+	require.Equal(t, "event: track.deleted\n", line)
+	line, err = reader.ReadString('\n')
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(line, "data: "))
+	require.Contains(t, line, id.Hex())
+}
+
+func TestApi_StreamEvents_ShouldKeepStreamingPastWriteDeadline(t *testing.T) {
+	hub := newEventHub()
+	server := httptest.NewUnstartedServer(limitWrites(100*time.Millisecond, streamEvents(hub, 20*time.Millisecond)))
+	server.Config.ConnContext = rememberConn
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	time.Sleep(300 * time.Millisecond)
+	id := primitive.NewObjectID()
+	hub.publish("", models.Event{Type: "track.deleted", ID: id})
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		require.Nil(t, err)
+		if strings.HasPrefix(line, "data: ") {
+			require.Contains(t, line, id.Hex())
+			return
+		}
+	}
+}
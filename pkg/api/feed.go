@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// feedSettings configures playlist feeds. baseURL is the externally visible address of the API; when empty it is
+// derived from each request. ttl is how long a feed URL, and so the audio URLs in the feed, can be used.
+type feedSettings struct {
+	signer  *service.URLSigner
+	baseURL string
+	ttl     time.Duration
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Type        string    `xml:"itunes:type"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string       `xml:"title"`
+	Author    string       `xml:"itunes:author,omitempty"`
+	GUID      rssGUID      `xml:"guid"`
+	PubDate   string       `xml:"pubDate"`
+	Enclosure rssEnclosure `xml:"enclosure"`
+	Episode   int          `xml:"itunes:episode"`
+	Duration  int          `xml:"itunes:duration,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// getFeedURL returns a URL for a playlist's podcast feed that works without an Authorization header, for subscribing
+// to the playlist in a podcast app.
+func getFeedURL(handler dao.DbHandler, settings feedSettings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		found, err := shareTargetExists(ctx, handler, shareKindPlaylist, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+
+		expires := time.Now().Add(settings.ttl)
+		signature, err := settings.signer.Sign(service.SignedClaims{
+			Subject: "feed:" + id.Hex(),
+			Tenant:  dao.TenantFromContext(ctx),
+			Expires: expires.Unix(),
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Error signing feed URL")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		path := versionedPath(ctx, "/playlist/"+id.Hex()+"/feed.xml") + "?signature=" + url.QueryEscape(signature)
+		respondWithSuccess(w, http.StatusOK, models.StreamURL{URL: externalURL(r, settings.baseURL, path), ExpiresAt: expires})
+		return
+	}
+}
+
+// getPlaylistFeed serves a playlist as a podcast RSS feed, with a track per episode in playlist order and signed URLs
+// for their audio. Requests carrying a "signature" query parameter minted by getFeedURL are authorised by that
+// signature alone, and the audio URLs in the feed expire with it; as they are signed with the same claims each time,
+// they stay the same from one refresh of the feed to the next.
+func getPlaylistFeed(handler dao.DbHandler, settings feedSettings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		expires := time.Now().Add(settings.ttl)
+		if signature := r.URL.Query().Get("signature"); signature != "" {
+			claims, err := settings.signer.Verify(signature)
+			if err != nil || claims.Subject != "feed:"+mux.Vars(r)["id"] {
+				logrus.WithError(err).Error("Invalid feed signature")
+				respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+				return
+			}
+			if claims.Tenant != "" {
+				if ctx, err = dao.WithTenant(ctx, claims.Tenant); err != nil {
+					logrus.WithError(err).Error("Invalid feed signature")
+					respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+					return
+				}
+			}
+			expires = time.Unix(claims.Expires, 0)
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+		playlist := playlists[0]
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": map[string]interface{}{"$in": playlist.Tracks}})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+		byID := make(map[primitive.ObjectID]models.Track, len(tracks))
+		for _, track := range tracks {
+			byID[track.ID] = track
+		}
+
+		feed := rssFeed{
+			Version: "2.0",
+			ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+			Channel: rssChannel{
+				Title:       playlist.Name,
+				Link:        externalURL(r, settings.baseURL, "/"),
+				Description: fmt.Sprintf("Tracks of the playlist %v", playlist.Name),
+				// Serial feeds are listed in episode order, which keeps the playlist's order.
+				Type: "serial",
+			},
+		}
+		for _, trackID := range playlist.Tracks {
+			track, ok := byID[trackID]
+			if !ok {
+				continue
+			}
+
+			item, err := feedItem(r, settings, track, expires)
+			if err != nil {
+				logrus.WithError(err).Error("Error signing stream URL")
+				respondWithStatusError(w, err)
+				return
+			}
+			item.Episode = len(feed.Channel.Items) + 1
+			feed.Channel.Items = append(feed.Channel.Items, item)
+		}
+
+		body, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			logrus.WithError(err).Error("Error encoding feed")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		if _, err := w.Write(append([]byte(xml.Header), body...)); err != nil {
+			logrus.WithError(err).Error("Error writing feed to response")
+		}
+	}
+}
+
+// feedItem describes a track as a podcast episode, whose enclosure is a signed URL for its audio expiring at expires.
+// The length of the audio is worked out from its probed bit rate and duration, or left as 0 if it has not been probed.
+func feedItem(r *http.Request, settings feedSettings, track models.Track, expires time.Time) (rssItem, error) {
+	signature, err := settings.signer.Sign(service.SignedClaims{
+		Subject: "stream:" + track.ID.Hex(),
+		Tenant:  dao.TenantFromContext(r.Context()),
+		Expires: expires.Unix(),
+	})
+	if err != nil {
+		return rssItem{}, err
+	}
+
+	item := rssItem{
+		Title:   track.Name,
+		Author:  track.Artist,
+		GUID:    rssGUID{Value: track.ID.Hex()},
+		PubDate: track.CreatedAt.UTC().Format(time.RFC1123Z),
+		Enclosure: rssEnclosure{
+			URL:  externalURL(r, settings.baseURL, versionedPath(r.Context(), "/track/"+track.ID.Hex())+"?signature="+url.QueryEscape(signature)),
+			Type: library.MIMEType(track.Container),
+		},
+	}
+	if track.AudioInfo != nil {
+		item.Enclosure.Length = int64(float64(track.AudioInfo.BitRate) * track.AudioInfo.Duration / 8)
+		item.Duration = int(track.AudioInfo.Duration)
+	}
+	return item, nil
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_PlaylistFeed_ShouldListTracksInOrderWithSignedEnclosures(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	first, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "first",
+		AudioInfo: &models.AudioInfo{BitRate: 800000, Duration: 10}}, testAudio)
+	require.Nil(t, err)
+	second, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "second"}, testAudio)
+	require.Nil(t, err)
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "commute", Tracks: []primitive.ObjectID{second.ID, first.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+	settings := feedSettings{signer: &service.URLSigner{Secret: []byte("secret")}, baseURL: "https://music.example.com", ttl: time.Hour}
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getFeedURL(handler, settings)).
+		ServeHTTP(recorder, guestRequest(t, "/playlist/{id}/feed-url", "test", map[string]string{"id": playlist.ID.Hex()}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var feedURL models.StreamURL
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&feedURL))
+
+	req, err := http.NewRequest(http.MethodGet, feedURL.URL, http.NoBody)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": playlist.ID.Hex()})
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(getPlaylistFeed(handler, settings)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/rss+xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+	var feed rssFeed
+	require.Nil(t, xml.Unmarshal(recorder.Body.Bytes(), &feed))
+	require.Equal(t, "commute", feed.Channel.Title)
+	require.Len(t, feed.Channel.Items, 2)
+	require.Equal(t, "second", feed.Channel.Items[0].Title)
+	require.Equal(t, "first", feed.Channel.Items[1].Title)
+	require.Equal(t, "audio/mpeg", feed.Channel.Items[1].Enclosure.Type)
+	require.Equal(t, int64(1000000), feed.Channel.Items[1].Enclosure.Length)
+
+	enclosure, err := url.Parse(feed.Channel.Items[1].Enclosure.URL)
+	require.Nil(t, err)
+	require.Equal(t, "/v1/track/"+first.ID.Hex(), enclosure.Path)
+	claims, err := settings.signer.Verify(enclosure.Query().Get("signature"))
+	require.Nil(t, err)
+	require.Equal(t, "stream:"+first.ID.Hex(), claims.Subject)
+	require.Equal(t, feedURL.ExpiresAt.Unix(), claims.Expires)
+}
+
+func TestApi_PlaylistFeed_ShouldReturn401IfSignatureIsForAnotherPlaylist(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "private"}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	signer := &service.URLSigner{Secret: []byte("secret")}
+	signature, err := signer.Sign(service.SignedClaims{Subject: "feed:" + primitive.NewObjectID().Hex(), Expires: time.Now().Add(time.Hour).Unix()})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "/playlist/"+playlist.ID.Hex()+"/feed.xml?signature="+url.QueryEscape(signature), http.NoBody)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": playlist.ID.Hex()})
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getPlaylistFeed(handler, feedSettings{signer: signer, ttl: time.Hour})).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
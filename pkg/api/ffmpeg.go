@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/library"
+)
+
+// errFFmpegUnavailable is returned for work that needs ffmpeg on a server where it was not found at startup.
+var errFFmpegUnavailable = statusError{
+	code: http.StatusServiceUnavailable,
+	err:  errors.New("ffmpeg is not available on this server, install it or set FFMPEG_PATH to its location"),
+}
+
+// requireFFmpeg turns requests for a handler that needs ffmpeg away with a 503 when it was not found at startup,
+// rather than letting them fail partway through.
+func requireFFmpeg(ffmpeg string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ffmpeg == "" {
+			defer closeRequestBody(r)
+			respondWithStatusError(w, errFFmpegUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// acquireFFmpeg waits for a slot in the ffmpeg pool, keeping the job it runs in, if any, up to date with its place in
+// the queue. A full queue is reported as a 503, for the client or the job to try again later.
+func acquireFFmpeg(ctx context.Context, pool *library.FFmpegPool) (func(), error) {
+	waited := false
+	release, err := pool.Acquire(ctx, func(position int) {
+		waited = true
+		jobs.ReportQueuePosition(ctx, position)
+	})
+	if errors.Is(err, library.ErrPoolFull) {
+		return nil, statusError{code: http.StatusServiceUnavailable, err: err}
+	} else if err != nil {
+		return nil, err
+	}
+	if waited {
+		jobs.ReportQueuePosition(ctx, 0)
+	}
+	return release, nil
+}
+
+// convertToMp3 pipes the input, such as a video stream, through ffmpeg and returns it as mp3 audio, without writing
+// either to disk. Given the duration of the input, it keeps the job it runs in, if any, up to date with how far along
+// the conversion is.
+func convertToMp3(ctx context.Context, ffmpeg string, input io.Reader, duration time.Duration) ([]byte, error) {
+	return runFFmpeg(ctx, ffmpeg, input, duration, "-i", "pipe:0", "-vn", "-f", "mp3", "pipe:1")
+}
+
+// cutAudio copies part of the mp3 audio, chosen by ffmpeg output options such as those from trimArgs or chapterArgs,
+// without re-encoding it.
+func cutAudio(ctx context.Context, ffmpeg string, audio []byte, outputArgs []string) ([]byte, error) {
+	args := append([]string{"-i", "pipe:0"}, outputArgs...)
+	return runFFmpeg(ctx, ffmpeg, bytes.NewReader(audio), 0, append(args, "-c:a", "copy", "-f", "mp3", "pipe:1")...)
+}
+
+// runFFmpeg runs ffmpeg over the input and returns its output. Given the duration of the input, ffmpeg also writes
+// progress reports to a pipe of their own, as stderr is kept for errors, and the percentage done is reported on the job
+// running with the context.
+func runFFmpeg(ctx context.Context, ffmpeg string, input io.Reader, duration time.Duration, args ...string) ([]byte, error) {
+	globalArgs := []string{"-hide_banner", "-loglevel", "error"}
+
+	var progress *os.File
+	var progressDone chan struct{}
+	if duration > 0 {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		progress = writer
+		progressDone = make(chan struct{})
+		go func() {
+			defer close(progressDone)
+			parseFFmpegProgress(reader, duration, func(percent float64) {
+				jobs.ReportProgress(ctx, percent)
+			})
+		}()
+		// The first of ExtraFiles is the child's file descriptor 3.
+		globalArgs = append(globalArgs, "-nostats", "-progress", "pipe:3")
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpeg, append(globalArgs, args...)...)
+	cmd.Stdin = input
+	if progress != nil {
+		cmd.ExtraFiles = []*os.File{progress}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Start()
+	if progress != nil {
+		// Only the child should hold the write end, so the parser sees the pipe close when ffmpeg exits.
+		progress.Close()
+	}
+	if err == nil {
+		err = cmd.Wait()
+	}
+	if progressDone != nil {
+		<-progressDone
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error executing ffmpeg command: %v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseFFmpegProgress reads the key=value reports ffmpeg writes with -progress and reports the share of the duration
+// converted so far as a percentage, each time it passes another whole percent.
+func parseFFmpegProgress(r io.Reader, duration time.Duration, report func(percent float64)) {
+	reported := -1
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value := scanner.Text(), ""
+		if i := strings.IndexByte(key, '='); i >= 0 {
+			key, value = key[:i], key[i+1:]
+		}
+
+		var percent float64
+		switch key {
+		// Despite its name, out_time_ms is in microseconds too. Older versions of ffmpeg only write that one.
+		case "out_time_us", "out_time_ms":
+			micros, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || micros < 0 {
+				continue
+			}
+			percent = math.Min(100, float64(micros)/float64(duration.Microseconds())*100)
+		case "progress":
+			if value != "end" {
+				continue
+			}
+			percent = 100
+		default:
+			continue
+		}
+
+		if int(percent) > reported {
+			reported = int(percent)
+			report(float64(reported))
+		}
+	}
+}
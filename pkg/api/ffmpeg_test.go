@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stubFFmpeg writes a script standing in for ffmpeg that runs the given shell commands.
+func stubFFmpeg(t *testing.T, script string) string {
+	dir, err := ioutil.TempDir("", "ffmpeg")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "ffmpeg")
+	require.Nil(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755))
+	return path
+}
+
+func TestApi_ConvertToMp3_ShouldPipeInputThroughFFmpeg(t *testing.T) {
+	ffmpeg := stubFFmpeg(t, "tr a-z A-Z")
+
+	audio, err := convertToMp3(context.Background(), ffmpeg, strings.NewReader("video"), 0)
+	require.Nil(t, err)
+	require.Equal(t, "VIDEO", string(audio))
+}
+
+func TestApi_CutAudio_ShouldReportFFmpegErrors(t *testing.T) {
+	ffmpeg := stubFFmpeg(t, "echo 'pipe:0: Invalid data found' >&2; exit 1")
+
+	_, err := cutAudio(context.Background(), ffmpeg, []byte("audio"), []string{"-ss", "1.000"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Invalid data found")
+}
+
+func TestApi_RequireFFmpeg_ShouldReturn503WithoutCallingHandlerIfFFmpegIsMissing(t *testing.T) {
+	called := false
+	next := func(w http.ResponseWriter, r *http.Request) { called = true }
+
+	req, err := http.NewRequest(http.MethodPost, "/convert", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	requireFFmpeg("", next).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.False(t, called)
+
+	requireFFmpeg("ffmpeg", next).ServeHTTP(httptest.NewRecorder(), req)
+	require.True(t, called)
+}
+
+func TestApi_ConvertToMp3_ShouldReadProgressFromItsOwnPipe(t *testing.T) {
+	ffmpeg := stubFFmpeg(t, "echo out_time_us=1000000 >&3; echo progress=end >&3; cat")
+
+	audio, err := convertToMp3(context.Background(), ffmpeg, strings.NewReader("audio"), 2*time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "audio", string(audio))
+}
+
+func TestApi_ParseFFmpegProgress_ShouldReportEachWholePercentOnce(t *testing.T) {
+	output := strings.Join([]string{
+		"out_time_us=1000000",
+		"out_time_ms=1004000",
+		"progress=continue",
+		"out_time_us=N/A",
+		"out_time_us=3000000",
+		"progress=end",
+	}, "\n")
+
+	var reported []float64
+	parseFFmpegProgress(strings.NewReader(output), 4*time.Second, func(percent float64) {
+		reported = append(reported, percent)
+	})
+	require.Equal(t, []float64{25, 75, 100}, reported)
+}
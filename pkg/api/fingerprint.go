@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fingerprintUpload computes the raw fingerprint stored with uploaded audio. Fingerprinting is best effort: if it is
+// not configured or fails the track is stored without one and simply cannot be found by /identify.
+func fingerprintUpload(ctx context.Context, fingerprinter service.Fingerprinter, audio io.Reader) []uint32 {
+	if fingerprinter == nil {
+		return nil
+	}
+
+	fingerprint, err := fingerprinter.Fingerprint(ctx, audio)
+	if err != nil {
+		logrus.WithError(err).Warn("Error fingerprinting upload")
+		return nil
+	}
+	return fingerprint.Raw
+}
+
+// identifyClip matches an uploaded clip against the fingerprints in the library. With ?acoustid=true the clip is also
+// looked up on AcoustID, which can name recordings the library does not hold.
+func identifyClip(handler dao.DbHandler, fingerprinter service.Fingerprinter, identifier service.RecordingIdentifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if fingerprinter == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "Audio fingerprinting is not configured")
+			return
+		}
+
+		useAcoustID := r.URL.Query().Get("acoustid") == "true"
+		if useAcoustID && identifier == nil {
+			respondWithError(w, http.StatusBadRequest, "AcoustID lookups are not configured")
+			return
+		}
+
+		f, _, err := r.FormFile("input")
+		if err != nil {
+			logrus.WithError(err).Error("Failed to find file with key 'input'")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				logrus.WithError(err).Error("Error closing file")
+			}
+		}()
+
+		fingerprint, err := fingerprinter.Fingerprint(ctx, f)
+		if err != nil {
+			logrus.WithError(err).Error("Error fingerprinting clip")
+			respondWithError(w, http.StatusUnprocessableEntity, "Unable to fingerprint clip")
+			return
+		}
+
+		matches, err := library.IdentifyTracks(ctx, handler, fingerprint.Raw)
+		if errors.Is(err, library.ErrClipTooShort) {
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error matching clip against library")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		result := models.IdentifyResult{Matches: matches}
+		if useAcoustID {
+			if result.AcoustID, err = identifier.Identify(ctx, fingerprint); err != nil {
+				logrus.WithError(err).Error("Error looking up clip on AcoustID")
+				respondWithError(w, http.StatusBadGateway, err.Error())
+				return
+			}
+		}
+
+		respondWithSuccess(w, http.StatusOK, result)
+		return
+	}
+}
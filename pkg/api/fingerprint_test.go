@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testClipFingerprint() *models.Fingerprint {
+	raw := make([]uint32, 40)
+	for i := range raw {
+		raw[i] = uint32(i) * 2654435761
+	}
+	return &models.Fingerprint{Duration: 5, Raw: raw, Encoded: "AQAA"}
+}
+
+func TestApi_IdentifyClip_ShouldReturn503IfFingerprintingIsNotConfigured(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(identifyClip(dbHandler, nil, nil))
+	httpHandler.ServeHTTP(recorder, audioUploadRequest(t, "/identify"))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestApi_IdentifyClip_ShouldReturn400IfAcoustIDIsRequestedButNotConfigured(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(identifyClip(dbHandler, &mocks.Fingerprinter{}, nil))
+	httpHandler.ServeHTTP(recorder, audioUploadRequest(t, "/identify?acoustid=true"))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_IdentifyClip_ShouldReturn422IfClipCannotBeFingerprinted(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	fingerprinter := &mocks.Fingerprinter{}
+	fingerprinter.On("Fingerprint", mock.Anything, readerOf(testAudio)).Return(nil, errors.New("test"))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(identifyClip(dbHandler, fingerprinter, nil))
+	httpHandler.ServeHTTP(recorder, audioUploadRequest(t, "/identify"))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func TestApi_IdentifyClip_ShouldReturn502IfAcoustIDLookupFails(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	fingerprinter := &mocks.Fingerprinter{}
+	identifier := &mocks.RecordingIdentifier{}
+	fingerprinter.On("Fingerprint", mock.Anything, mock.Anything).Return(testClipFingerprint(), nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
+	identifier.On("Identify", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(identifyClip(dbHandler, fingerprinter, identifier))
+	httpHandler.ServeHTTP(recorder, audioUploadRequest(t, "/identify?acoustid=true"))
+	require.Equal(t, http.StatusBadGateway, recorder.Code)
+}
+
+func TestApi_IdentifyClip_ShouldReturnMatchesOnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	fingerprinter := &mocks.Fingerprinter{}
+	identifier := &mocks.RecordingIdentifier{}
+	fingerprint := testClipFingerprint()
+	fingerprinter.On("Fingerprint", mock.Anything, mock.Anything).Return(fingerprint, nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Name: "Song", Fingerprint: fingerprint.Raw}}, nil)
+	identifier.On("Identify", mock.Anything, fingerprint).Return([]models.AcoustIDMatch{{ID: "a1", Score: 0.9}}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(identifyClip(dbHandler, fingerprinter, identifier))
+	httpHandler.ServeHTTP(recorder, audioUploadRequest(t, "/identify?acoustid=true"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var result models.IdentifyResult
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	require.Len(t, result.Matches, 1)
+	require.Equal(t, "Song", result.Matches[0].Track.Name)
+	require.Equal(t, 1.0, result.Matches[0].Score)
+	require.Equal(t, "a1", result.AcoustID[0].ID)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const (
+	qualityBest = "best"
+	qualityLow  = "low"
+)
+
+// errNoAudioFormat is returned when a video offers no audio-only format, which would otherwise mean downloading the
+// whole video.
+var errNoAudioFormat = statusError{code: http.StatusUnprocessableEntity, err: errors.New("video has no audio-only format")}
+
+// audioCodecRank orders audio codecs by preference: Opus sounds better than AAC at the same bitrate.
+func audioCodecRank(mimeType string) int {
+	switch {
+	case strings.Contains(mimeType, "opus"):
+		return 0
+	case strings.HasPrefix(mimeType, "audio/webm"):
+		return 1
+	case strings.Contains(mimeType, "mp4a"), strings.HasPrefix(mimeType, "audio/mp4"):
+		return 2
+	default:
+		return 3
+	}
+}
+
+func formatBitrate(format youtube.Format) int {
+	if format.AverageBitrate > 0 {
+		return format.AverageBitrate
+	}
+	return format.Bitrate
+}
+
+// checkQuality rejects quality options other than "best" and "low". An empty option means "best".
+func checkQuality(quality string) error {
+	if quality != "" && quality != qualityBest && quality != qualityLow {
+		return statusError{code: http.StatusBadRequest, err: fmt.Errorf("quality must be %v or %v", qualityBest, qualityLow)}
+	}
+	return nil
+}
+
+// rankAudioFormats returns the audio-only formats of a video, best first: by codec preference, then by the highest
+// bitrate for "best" quality or the lowest for "low", which saves data. An empty quality means "best".
+func rankAudioFormats(formats youtube.FormatList, quality string) ([]youtube.Format, error) {
+	if err := checkQuality(quality); err != nil {
+		return nil, err
+	}
+
+	var audio []youtube.Format
+	for _, format := range formats {
+		if strings.HasPrefix(format.MimeType, "audio/") {
+			audio = append(audio, format)
+		}
+	}
+	if len(audio) == 0 {
+		return nil, errNoAudioFormat
+	}
+
+	sort.SliceStable(audio, func(i, j int) bool {
+		if rankI, rankJ := audioCodecRank(audio[i].MimeType), audioCodecRank(audio[j].MimeType); rankI != rankJ {
+			return rankI < rankJ
+		}
+		if quality == qualityLow {
+			return formatBitrate(audio[i]) < formatBitrate(audio[j])
+		}
+		return formatBitrate(audio[i]) > formatBitrate(audio[j])
+	})
+	return audio, nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testFormats = youtube.FormatList{
+	{ItagNo: 18, MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, Bitrate: 500000},
+	{ItagNo: 140, MimeType: `audio/mp4; codecs="mp4a.40.2"`, Bitrate: 130000, AverageBitrate: 129000},
+	{ItagNo: 249, MimeType: `audio/webm; codecs="opus"`, Bitrate: 58000, AverageBitrate: 50000},
+	{ItagNo: 251, MimeType: `audio/webm; codecs="opus"`, Bitrate: 140000, AverageBitrate: 130000},
+}
+
+func itags(formats []youtube.Format) []int {
+	var result []int
+	for _, format := range formats {
+		result = append(result, format.ItagNo)
+	}
+	return result
+}
+
+func TestApi_RankAudioFormats_ShouldPreferOpusAtHighestBitrate(t *testing.T) {
+	formats, err := rankAudioFormats(testFormats, "")
+	require.Nil(t, err)
+	require.Equal(t, []int{251, 249, 140}, itags(formats))
+}
+
+func TestApi_RankAudioFormats_ShouldPreferLowestBitrateForLowQuality(t *testing.T) {
+	formats, err := rankAudioFormats(testFormats, qualityLow)
+	require.Nil(t, err)
+	require.Equal(t, []int{249, 251, 140}, itags(formats))
+}
+
+func TestApi_RankAudioFormats_ShouldReturnErrorIfThereIsNoAudioOnlyFormat(t *testing.T) {
+	_, err := rankAudioFormats(testFormats[:1], "")
+	require.Equal(t, errNoAudioFormat, err)
+}
+
+func TestApi_RankAudioFormats_ShouldReturnErrorIfQualityIsUnknown(t *testing.T) {
+	_, err := rankAudioFormats(testFormats, "test")
+	require.NotNil(t, err)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn422IfVideoHasNoAudioFormat(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+	client.On("GetVideo", mock.Anything).Return(&youtube.Video{Formats: testFormats[:1]}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	client.AssertNotCalled(t, "GetStreamContext", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldStreamBestAudioFormatFirst(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+	var attempted []int
+	client.On("GetVideo", mock.Anything).Return(&youtube.Video{Formats: testFormats}, nil)
+	client.On("GetStreamContext", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		attempted = append(attempted, args.Get(2).(*youtube.Format).ItagNo)
+	}).Return(nil, int64(0), errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, []int{251, 249, 140}, attempted)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldFallBackToNextFormatIfStreamIsTruncated(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	client := &mocks.YoutubeClient{}
+	client.On("GetVideo", mock.Anything).Return(&youtube.Video{Formats: testFormats}, nil)
+	client.On("GetStreamContext", mock.Anything, mock.Anything, mock.MatchedBy(func(format *youtube.Format) bool {
+		return format.ItagNo == 251
+	})).Return(ioutil.NopCloser(bytes.NewReader(testAudio[:3])), int64(len(testAudio)), nil)
+	client.On("GetStreamContext", mock.Anything, mock.Anything, mock.MatchedBy(func(format *youtube.Format) bool {
+		return format.ItagNo == 249
+	})).Return(ioutil.NopCloser(bytes.NewReader(testAudio)), int64(len(testAudio)), nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"name":"Song","youtubeLink":"www.youtube.com?v=test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	importer := youtubeImporter{handler: handler, client: client, ffmpeg: stubFFmpeg(t, "cat"), locks: importLocks{locker: service.NewLocalCoordinator(), ttl: time.Minute}}
+	http.HandlerFunc(uploadTrackFromYoutubeLink(handler, importer)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	audio, err := handler.DownloadAudioFile(ctx, tracks[0].AudioFileID)
+	require.Nil(t, err)
+	require.Equal(t, testAudio, audio)
+}
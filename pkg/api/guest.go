@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// guestSettings configures the guest tokens minted by createGuestToken.
+type guestSettings struct {
+	signer     *service.URLSigner
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// createGuestToken mints a bearer token that can only list and stream the tracks of the playlist identified by the
+// "id" route variable, such as for a jukebox page at a party. Guest tokens are signed rather than stored, so they are
+// checked without the login service and cannot be revoked before they expire.
+func createGuestToken(handler dao.DbHandler, settings guestSettings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var guestRequest models.GuestTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&guestRequest); err != nil && err != io.EOF {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ttl := settings.defaultTTL
+		if guestRequest.ExpiresIn != "" {
+			if ttl, err = time.ParseDuration(guestRequest.ExpiresIn); err != nil || ttl <= 0 {
+				respondWithFieldError(w, "expiresIn", "expiresIn must be a positive duration such as '6h'")
+				return
+			}
+		}
+		if ttl > settings.maxTTL {
+			respondWithFieldError(w, "expiresIn", "expiresIn exceeds the maximum of "+settings.maxTTL.String())
+			return
+		}
+
+		found, err := shareTargetExists(ctx, handler, shareKindPlaylist, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+
+		expiresAt := time.Now().Add(ttl)
+		signed, err := settings.signer.Sign(service.SignedClaims{
+			Subject: "guest:" + id.Hex(),
+			Tenant:  dao.TenantFromContext(ctx),
+			Expires: expiresAt.Unix(),
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Error signing guest token")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, models.GuestToken{Token: signed, PlaylistID: id, ExpiresAt: expiresAt})
+		return
+	}
+}
+
+// getGuestPlaylist returns the name and tracks of the playlist a guest token was minted for.
+func getGuestPlaylist(handler dao.DbHandler, signer *service.URLSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		ctx, playlistID, ok := resolveGuest(w, r, signer)
+		if !ok {
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlistID})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": map[string]interface{}{"$in": playlists[0].Tracks}})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, map[string]interface{}{"name": playlists[0].Name, "tracks": tracks})
+		return
+	}
+}
+
+// streamGuestTrack streams a track of the playlist a guest token was minted for, at the ?quality= asked for.
+func streamGuestTrack(handler dao.DbHandler, signer *service.URLSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		ctx, playlistID, ok := resolveGuest(w, r, signer)
+		if !ok {
+			return
+		}
+
+		trackID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlistID, "tracks": trackID})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found in playlist")
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": trackID})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		quality := r.URL.Query().Get("quality")
+		audio, err := handler.DownloadAudioFile(ctx, audioFileForQuality(tracks[0], quality))
+		if err != nil {
+			logrus.WithError(err).Error("Error getting audio for track")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		throttleStream(w, audioBitRate(tracks[0], quality))
+		if _, err := w.Write(audio); err != nil {
+			logrus.WithError(err).Error("Error writing file to response")
+		}
+	}
+}
+
+// resolveGuest verifies the guest token in the request's bearer token, returning the playlist it grants access to and
+// a context scoped to the tenant it was minted for. If the token cannot be used an error response is written and ok
+// is false.
+func resolveGuest(w http.ResponseWriter, r *http.Request, signer *service.URLSigner) (context.Context, primitive.ObjectID, bool) {
+	ctx := r.Context()
+
+	token, err := getAuthToken(r)
+	if err != nil {
+		logrus.WithError(err).Error("Error retrieving auth token")
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return ctx, primitive.NilObjectID, false
+	}
+
+	claims, err := signer.Verify(token)
+	if err == service.ErrSignatureExpired {
+		respondWithError(w, http.StatusUnauthorized, "Guest token has expired")
+		return ctx, primitive.NilObjectID, false
+	} else if err != nil || !strings.HasPrefix(claims.Subject, "guest:") {
+		respondWithError(w, http.StatusUnauthorized, "Invalid guest token")
+		return ctx, primitive.NilObjectID, false
+	}
+
+	playlistID, err := primitive.ObjectIDFromHex(strings.TrimPrefix(claims.Subject, "guest:"))
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid guest token")
+		return ctx, primitive.NilObjectID, false
+	}
+
+	if claims.Tenant != "" {
+		if ctx, err = dao.WithTenant(ctx, claims.Tenant); err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Invalid guest token")
+			return ctx, primitive.NilObjectID, false
+		}
+	}
+	return ctx, playlistID, true
+}
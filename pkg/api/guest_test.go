@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func guestRequest(t *testing.T, path string, token string, vars map[string]string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, path, http.NoBody)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return mux.SetURLVars(req, vars)
+}
+
+func TestApi_CreateGuestToken_ShouldReturn404IfPlaylistDoesNotExist(t *testing.T) {
+	settings := guestSettings{signer: &service.URLSigner{Secret: []byte("secret")}, defaultTTL: time.Hour, maxTTL: time.Hour}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createGuestToken(dao.NewMemoryHandler(), settings))
+	httpHandler.ServeHTTP(recorder, guestRequest(t, "/playlist/{id}/guest-token", "test", map[string]string{"id": primitive.NewObjectID().Hex()}))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GuestToken_ShouldOnlyGiveAccessToTracksOfItsPlaylist(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	inPlaylist, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "in"}, testAudio)
+	require.Nil(t, err)
+	notInPlaylist, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "out"}, testAudio)
+	require.Nil(t, err)
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "party", Tracks: []primitive.ObjectID{inPlaylist.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+	settings := guestSettings{signer: &service.URLSigner{Secret: []byte("secret")}, defaultTTL: time.Hour, maxTTL: time.Hour}
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(createGuestToken(handler, settings)).
+		ServeHTTP(recorder, guestRequest(t, "/playlist/{id}/guest-token", "test", map[string]string{"id": playlist.ID.Hex()}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var guest models.GuestToken
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&guest))
+	require.Equal(t, playlist.ID, guest.PlaylistID)
+
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(getGuestPlaylist(handler, settings.signer)).ServeHTTP(recorder, guestRequest(t, "/guest/playlist", guest.Token, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), inPlaylist.ID.Hex())
+	require.NotContains(t, recorder.Body.String(), notInPlaylist.ID.Hex())
+
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(streamGuestTrack(handler, settings.signer)).
+		ServeHTTP(recorder, guestRequest(t, "/guest/track/{id}", guest.Token, map[string]string{"id": inPlaylist.ID.Hex()}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, testAudio, recorder.Body.Bytes())
+
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(streamGuestTrack(handler, settings.signer)).
+		ServeHTTP(recorder, guestRequest(t, "/guest/track/{id}", guest.Token, map[string]string{"id": notInPlaylist.ID.Hex()}))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GetGuestPlaylist_ShouldRejectTokensThatAreNotGuestTokens(t *testing.T) {
+	signer := &service.URLSigner{Secret: []byte("secret")}
+	share, err := signer.Sign(service.SignedClaims{Subject: "share:" + primitive.NewObjectID().Hex(), Expires: time.Now().Add(time.Hour).Unix()})
+	require.Nil(t, err)
+	expired, err := signer.Sign(service.SignedClaims{Subject: "guest:" + primitive.NewObjectID().Hex(), Expires: time.Now().Add(-time.Hour).Unix()})
+	require.Nil(t, err)
+
+	for _, token := range []string{share, expired, "test"} {
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(getGuestPlaylist(dao.NewMemoryHandler(), signer)).ServeHTTP(recorder, guestRequest(t, "/guest/playlist", token, nil))
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/dao"
+)
+
+// healthCheck is one dependency reported by /health. A failing critical check means the API cannot serve requests and
+// fails the health check as a whole; any other failure only marks the API as degraded.
+type healthCheck struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) (string, error)
+}
+
+type dependencyHealth struct {
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+type healthReport struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]dependencyHealth `json:"dependencies"`
+}
+
+// checkHealth reports the state of the database and any further dependencies given. All checks run concurrently,
+// each bounded by a short timeout.
+func checkHealth(handler dao.DbHandler, checks ...healthCheck) http.HandlerFunc {
+	checks = append([]healthCheck{{
+		name:     "mongo",
+		critical: true,
+		check: func(ctx context.Context) (string, error) {
+			return "", handler.Ping(ctx)
+		},
+	}}, checks...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		report := healthReport{Status: "ok", Dependencies: make(map[string]dependencyHealth)}
+		failedCritical := false
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, c := range checks {
+			wg.Add(1)
+			go func(c healthCheck) {
+				defer wg.Done()
+
+				start := time.Now()
+				detail, err := c.check(ctx)
+				result := dependencyHealth{Status: "ok", Detail: detail, LatencyMs: time.Since(start).Milliseconds()}
+				if err != nil {
+					result.Status, result.Error = "failed", err.Error()
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				report.Dependencies[c.name] = result
+				if err != nil && c.critical {
+					failedCritical = true
+				} else if err != nil && report.Status == "ok" {
+					report.Status = "degraded"
+				}
+			}(c)
+		}
+		wg.Wait()
+
+		if failedCritical {
+			report.Status = "down"
+			respondWithSuccess(w, http.StatusInternalServerError, report)
+			return
+		}
+		respondWithSuccess(w, http.StatusOK, report)
+		return
+	}
+}
+
+// dependencyChecks returns the health checks beyond the database ping: the GridFS bucket, the login service, ffmpeg and
+// free space in the temp directory. An empty ffmpeg path means it was not found at startup.
+func dependencyChecks(handler dao.DbHandler, login pinger, ffmpeg string, minFreeDisk uint64) []healthCheck {
+	return []healthCheck{
+		{
+			name:     "gridfs",
+			critical: true,
+			check: func(ctx context.Context) (string, error) {
+				return "", handler.PingAudioStore(ctx)
+			},
+		},
+		{
+			name: "loginService",
+			check: func(ctx context.Context) (string, error) {
+				return "", login.Ping(ctx)
+			},
+		},
+		{
+			name: "ffmpeg",
+			check: func(ctx context.Context) (string, error) {
+				if ffmpeg == "" {
+					return "", errors.New("not found, conversion endpoints are disabled until FFMPEG_PATH is set")
+				}
+				return exec.LookPath(ffmpeg)
+			},
+		},
+		{
+			name: "tempDisk",
+			check: func(ctx context.Context) (string, error) {
+				free, err := freeDiskSpace(os.TempDir())
+				if err != nil {
+					return "", err
+				}
+
+				detail := fmt.Sprintf("%v MB free", free>>20)
+				if free < minFreeDisk {
+					return detail, fmt.Errorf("less than %v MB free", minFreeDisk>>20)
+				}
+				return detail, nil
+			},
+		},
+	}
+}
+
+type pinger interface {
+	Ping(ctx context.Context) error
+}
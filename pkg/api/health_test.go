@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_CheckHealth_ShouldReturn200AndDegradedIfNonCriticalCheckFails(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("Ping", mock.Anything).Return(nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/health", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(checkHealth(dbHandler, healthCheck{
+		name: "test",
+		check: func(ctx context.Context) (string, error) {
+			return "", errors.New("test")
+		},
+	}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var report healthReport
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Equal(t, "degraded", report.Status)
+	require.Equal(t, "ok", report.Dependencies["mongo"].Status)
+	require.Equal(t, "failed", report.Dependencies["test"].Status)
+}
+
+func TestApi_CheckHealth_ShouldReturn500IfCriticalCheckFails(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("Ping", mock.Anything).Return(nil)
+	dbHandler.On("PingAudioStore", mock.Anything).Return(errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodGet, "/health", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(checkHealth(dbHandler, dependencyChecks(dbHandler, pingerFunc(func(ctx context.Context) error {
+		return nil
+	}), "ffmpeg", 0)[0]))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+	var report healthReport
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Equal(t, "down", report.Status)
+	require.Equal(t, "failed", report.Dependencies["gridfs"].Status)
+}
+
+type pingerFunc func(ctx context.Context) error
+
+func (p pingerFunc) Ping(ctx context.Context) error {
+	return p(ctx)
+}
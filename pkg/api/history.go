@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordPlay adds a play of the track to the listening history and sets when it was last played. Clients report plays
+// themselves, since a stream being fetched does not mean it was listened to.
+func recordPlay(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		play := models.Play{ID: primitive.NewObjectID(), TrackID: id, PlayedAt: time.Now()}
+		if err := handler.AddPlay(ctx, play); err != nil {
+			logrus.WithError(err).Error("Error recording play")
+			respondWithStatusError(w, err)
+			return
+		}
+		// The play is in the history, so a failure here is not reported, as a retry would record it twice.
+		if err := handler.SetTrackLastPlayed(ctx, id, play.PlayedAt); err != nil {
+			logrus.WithError(err).Warn("Error recording when track was last played")
+		}
+
+		respondWithSuccess(w, http.StatusOK, "Play recorded successfully")
+		return
+	}
+}
+
+// getRecommendations suggests up to ?limit= tracks, 20 by default, from the plays of the last ?days= days, 90 by
+// default.
+func getRecommendations(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		limit, days := 20, 90
+		for name, target := range map[string]*int{"limit": &limit, "days": &days} {
+			if value := r.URL.Query().Get(name); value != "" {
+				var err error
+				if *target, err = strconv.Atoi(value); err != nil || *target <= 0 {
+					respondWithFieldError(w, name, fmt.Sprintf("%v must be a positive integer", name))
+					return
+				}
+			}
+		}
+
+		recommendations, err := library.Recommend(ctx, handler, time.Now().AddDate(0, 0, -days), limit)
+		if err != nil {
+			logrus.WithError(err).Error("Error building recommendations")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, recommendations)
+		return
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_RecordPlay_ShouldReturn400IfUnableToCreateObjectIDFromGivenID(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/play", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(recordPlay(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_RecordPlay_ShouldReturn404IfTrackNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/play", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(recordPlay(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	dbHandler.AssertNotCalled(t, "AddPlay", mock.Anything, mock.Anything)
+}
+
+func TestApi_RecordPlay_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("AddPlay", mock.Anything, mock.MatchedBy(func(play models.Play) bool {
+		return play.TrackID.Hex() == "603ac4abd9ad8067f54a2778" && !play.PlayedAt.IsZero()
+	})).Return(nil)
+	dbHandler.On("SetTrackLastPlayed", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/play", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(recordPlay(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestApi_GetRecommendations_ShouldReturn400IfLimitIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/recommendations?limit=none", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getRecommendations(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetRecommendations_ShouldReturn500IfHistoryCannotBeRead(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlayCounts", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodGet, "/recommendations", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getRecommendations(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_GetRecommendations_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlayCounts", mock.Anything, mock.Anything).Return([]models.PlayCount{}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/recommendations?limit=5&days=30", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getRecommendations(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "[]\n", recorder.Body.String())
+}
+
+func TestApi_GetTracks_ShouldFilterAndSortByWhenTracksWereLastPlayed(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	names := []string{"never", "last year", "yesterday"}
+	ids := make(map[string]primitive.ObjectID)
+	for _, name := range names {
+		track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: name}, testAudio)
+		require.Nil(t, err)
+		ids[name] = track.ID
+	}
+	require.Nil(t, handler.SetTrackLastPlayed(ctx, ids["last year"], time.Now().AddDate(-1, 0, -1)))
+	require.Nil(t, handler.SetTrackLastPlayed(ctx, ids["yesterday"], time.Now().AddDate(0, 0, -1)))
+
+	query := url.Values{"playedBefore": {time.Now().AddDate(-1, 0, 0).Format(time.RFC3339)}, "sort": {"-lastPlayedAt"}}
+	req, err := http.NewRequest(http.MethodGet, "/tracks?"+query.Encode(), http.NoBody)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getTracks(handler)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var tracks []models.Track
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&tracks))
+	require.Len(t, tracks, 2)
+	require.Equal(t, "last year", tracks[0].Name)
+	require.NotNil(t, tracks[0].LastPlayedAt)
+	require.Equal(t, "never", tracks[1].Name)
+}
+
+func TestApi_GetTracks_ShouldReturn400IfSortIsUnknown(t *testing.T) {
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks?sort=name", http.NoBody)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getTracks(&mocks.DbHandler{})).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
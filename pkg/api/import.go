@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	jobKindImport = "import"
+
+	importSourceYoutube = "youtube"
+	importSourceURL     = "url"
+	importSourceFile    = "file"
+)
+
+// Importer imports tracks from one kind of source for POST /import.
+type Importer interface {
+	// Validate checks a request before any work is done on it, so that queued imports are rejected up front.
+	Validate(request models.ImportRequest) error
+	// Import imports the tracks the request names, returning those it stored even if it fails part way through.
+	Import(ctx context.Context, request models.ImportRequest) ([]models.Track, error)
+}
+
+// queueChecker is implemented by importers that cannot queue some requests, because part of the request is not kept
+// with the job.
+type queueChecker interface {
+	checkQueueable(request models.ImportRequest) error
+}
+
+// Validate implements Importer.
+func (y youtubeImporter) Validate(request models.ImportRequest) error {
+	_, _, err := y.validate(request.YoutubeRequest)
+	return err
+}
+
+// Import implements Importer.
+func (y youtubeImporter) Import(ctx context.Context, request models.ImportRequest) ([]models.Track, error) {
+	return y.importTracks(ctx, request.YoutubeRequest)
+}
+
+// fileImporter stores audio uploaded in the request as a track.
+type fileImporter struct {
+	handler       dao.DbHandler
+	enrichers     enrichers
+	scanner       service.Scanner
+	validator     service.AudioValidator
+	fingerprinter service.Fingerprinter
+}
+
+// Validate implements Importer.
+func (f fileImporter) Validate(request models.ImportRequest) error {
+	if _, err := f.enrichers.forRequest(request.Enrichment); err != nil {
+		return statusError{code: http.StatusBadRequest, err: err}
+	}
+	if len(request.AudioBytes) == 0 {
+		return statusError{code: http.StatusBadRequest, err: errors.New("audioBytes is required")}
+	}
+	return nil
+}
+
+func (f fileImporter) checkQueueable(request models.ImportRequest) error {
+	return statusError{code: http.StatusBadRequest, err: errors.New("file imports cannot be queued")}
+}
+
+// Import implements Importer.
+func (f fileImporter) Import(ctx context.Context, request models.ImportRequest) ([]models.Track, error) {
+	if err := f.Validate(request); err != nil {
+		return nil, err
+	}
+	enricher, _ := f.enrichers.forRequest(request.Enrichment)
+
+	if _, err := scanAudio(ctx, f.scanner, bytes.NewReader(request.AudioBytes)); err != nil {
+		return nil, err
+	}
+	info, err := validateAudio(ctx, f.validator, bytes.NewReader(request.AudioBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	track := models.Track{
+		ID:              primitive.NewObjectID(),
+		Name:            request.Name,
+		Artist:          request.Artist,
+		FeaturedArtists: request.FeaturedArtists,
+		AlbumName:       request.AlbumName,
+		AudioInfo:       info,
+		Fingerprint:     fingerprintUpload(ctx, f.fingerprinter, bytes.NewReader(request.AudioBytes)),
+	}
+	library.ApplyTags(&track)
+	library.ApplyDefaults(&track)
+	enrichOnUpload(ctx, enricher, &track)
+
+	stored, err := library.StoreTrack(ctx, f.handler, track, request.AudioBytes)
+	if errors.Is(err, library.ErrNotAudio) {
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: err}
+	} else if err != nil {
+		return nil, fmt.Errorf("error adding track to database: %w", err)
+	}
+	return []models.Track{stored}, nil
+}
+
+// importJobResult reports the outcome of an import run as a job. Errors a client would get a 4xx for are not worth
+// retrying, and neither is an import that stored some of its tracks, as a retry would store them again.
+func importJobResult(tracks []models.Track, err error) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(tracks))
+	for _, track := range tracks {
+		ids = append(ids, track.ID)
+	}
+
+	var withStatus statusError
+	if err != nil && len(ids) > 0 {
+		return ids, jobs.Permanent(err)
+	} else if errors.As(err, &withStatus) && withStatus.code < http.StatusInternalServerError && withStatus.code != http.StatusConflict {
+		return ids, jobs.Permanent(err)
+	} else if err != nil {
+		return ids, err
+	}
+	return ids, nil
+}
+
+// runImportJob runs a queued import with the importer for its source.
+func runImportJob(importers map[string]Importer) jobs.Func {
+	return func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		var request models.ImportRequest
+		if err := bson.Unmarshal(job.Payload, &request); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+
+		importer, ok := importers[request.Source]
+		if !ok {
+			return nil, jobs.Permanent(fmt.Errorf("unknown import source %q", request.Source))
+		}
+		return importJobResult(importer.Import(ctx, request))
+	}
+}
+
+// importTracks imports tracks from the source named in the request. With ?async=true the request is only validated and
+// queued, and the job is returned for the client to follow at /job/{id}.
+func importTracks(handler dao.DbHandler, importers map[string]Importer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		var request models.ImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		importer, ok := importers[request.Source]
+		if !ok {
+			sources := make([]string, 0, len(importers))
+			for source := range importers {
+				sources = append(sources, source)
+			}
+			sort.Strings(sources)
+			respondWithFieldError(w, "source", "source must be one of "+strings.Join(sources, ", "))
+			return
+		}
+
+		if err := importer.Validate(request); err != nil {
+			logrus.WithError(err).Error("Invalid import request")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		if r.URL.Query().Get("async") == "true" {
+			if checker, ok := importer.(queueChecker); ok {
+				if err := checker.checkQueueable(request); err != nil {
+					respondWithStatusError(w, err)
+					return
+				}
+			}
+
+			job, err := jobs.Enqueue(ctx, handler, jobKindImport, request)
+			if err != nil {
+				logrus.WithError(err).Error("Error queueing import")
+				respondWithStatusError(w, err)
+				return
+			}
+
+			respondWithSuccess(w, http.StatusAccepted, job)
+			return
+		}
+
+		tracks, err := importer.Import(ctx, request)
+		if err != nil {
+			logrus.WithError(err).WithField("source", request.Source).Error("Error importing tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusCreated, tracks)
+		return
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+// postImportDirectory imports every audio file below a directory mounted on the server, as musicctl import-dir does,
+// and reports what it did. The directory is given relative to root, and cannot be outside it. Files already in the
+// library are recognised by their checksum and skipped, so the same directory can be imported again as files are
+// added to it. Tags are read from each file with the validator, when there is one.
+func postImportDirectory(handler dao.DbHandler, validator service.AudioValidator, locks importLocks, root string, adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+		if root == "" {
+			respondWithError(w, http.StatusServiceUnavailable, "Directory imports are not configured")
+			return
+		}
+
+		var request models.DirectoryImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		// Cleaning the path as an absolute one drops any ".." that would climb out of root.
+		relative := path.Clean("/" + filepath.ToSlash(request.Path))
+		dir := filepath.Join(root, filepath.FromSlash(relative))
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			respondWithFieldError(w, "path", "Directory not found")
+			return
+		}
+
+		unlock, err := locks.acquire(ctx, "directory", relative)
+		if errors.Is(err, service.ErrLocked) {
+			respondWithError(w, http.StatusConflict, "This import is already in progress")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error acquiring directory import lock")
+			respondWithError(w, http.StatusServiceUnavailable, "Unable to coordinate import")
+			return
+		}
+		defer unlock()
+
+		report, err := library.ImportDirectory(ctx, handler, dir, validator)
+		if err != nil {
+			logrus.WithError(err).WithField("directory", dir).Error("Error importing directory")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"directory":  dir,
+			"imported":   report.Imported,
+			"duplicates": report.Duplicates,
+			"failed":     len(report.Failed),
+		}).Info("Imported directory")
+		respondWithSuccess(w, http.StatusOK, report)
+		return
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func importDirectoryRequest(t *testing.T, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "/admin/import-directory", strings.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func TestApi_PostImportDirectory_ShouldImportDirectoryOnceAndReportSummary(t *testing.T) {
+	root, err := ioutil.TempDir("", "import")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	require.Nil(t, os.Mkdir(filepath.Join(root, "incoming"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, "incoming", "song.mp3"), testAudio, 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, "incoming", "notes.mp3"), []byte("test"), 0644))
+
+	handler := dao.NewMemoryHandler()
+	importDirectory := postImportDirectory(handler, nil, importLocks{}, root, "secret")
+
+	recorder := httptest.NewRecorder()
+	importDirectory.ServeHTTP(recorder, importDirectoryRequest(t, `{"path": "incoming"}`))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var report models.DirectoryImportReport
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Equal(t, models.DirectoryImportReport{Imported: 1, NotAudio: 1}, report)
+
+	recorder = httptest.NewRecorder()
+	importDirectory.ServeHTTP(recorder, importDirectoryRequest(t, `{"path": "/incoming/"}`))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	report = models.DirectoryImportReport{}
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Equal(t, models.DirectoryImportReport{Duplicates: 1, NotAudio: 1}, report)
+
+	tracks, err := handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, "song", tracks[0].Name)
+}
+
+func TestApi_PostImportDirectory_ShouldKeepImportsInsideRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "import")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, "song.mp3"), testAudio, 0644))
+
+	// Climbing out of root only reaches root itself.
+	handler := dao.NewMemoryHandler()
+	recorder := httptest.NewRecorder()
+	postImportDirectory(handler, nil, importLocks{}, root, "secret").ServeHTTP(recorder, importDirectoryRequest(t, `{"path": "../.."}`))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var report models.DirectoryImportReport
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Equal(t, 1, report.Imported)
+
+	recorder = httptest.NewRecorder()
+	postImportDirectory(handler, nil, importLocks{}, root, "secret").ServeHTTP(recorder, importDirectoryRequest(t, `{"path": "missing"}`))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_PostImportDirectory_ShouldRequireAdminTokenAndConfiguredRoot(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	postImportDirectory(dao.NewMemoryHandler(), nil, importLocks{}, "/music", "other").ServeHTTP(recorder, importDirectoryRequest(t, `{}`))
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	postImportDirectory(dao.NewMemoryHandler(), nil, importLocks{}, "", "secret").ServeHTTP(recorder, importDirectoryRequest(t, `{}`))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testImporters(dbHandler *mocks.DbHandler, client *mocks.YoutubeClient) map[string]Importer {
+	return map[string]Importer{
+		importSourceYoutube: youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"},
+		importSourceFile:    fileImporter{handler: dbHandler},
+	}
+}
+
+func importRequest(t *testing.T, url string, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+	return req
+}
+
+func TestApi_ImportTracks_ShouldReturn400IfSourceIsUnknown(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, testImporters(dbHandler, &mocks.YoutubeClient{})))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import", `{"source":"ftp"}`))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var response models.ErrorResponse
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, []models.FieldError{{Field: "source", Message: "source must be one of file, youtube"}}, response.Details)
+}
+
+func TestApi_ImportTracks_ShouldReturn400IfSourceRejectsRequest(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, testImporters(dbHandler, client)))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import", `{"source":"youtube","youtubeLink":"www.youtube.com"}`))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "youtubeLink must contain a video id")
+	client.AssertNotCalled(t, "GetVideo", mock.Anything)
+}
+
+func TestApi_ImportTracks_ShouldQueueJobIfAsync(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+	dbHandler.On("AddJob", mock.Anything, mock.MatchedBy(func(job models.Job) bool {
+		var request models.ImportRequest
+		return job.Kind == jobKindImport && bson.Unmarshal(job.Payload, &request) == nil &&
+			request.Source == importSourceYoutube && request.Name == "Song" && request.YoutubeLink == "www.youtube.com?v=test"
+	})).Return(nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, testImporters(dbHandler, client)))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import?async=true", `{"source":"youtube","name":"Song","youtubeLink":"www.youtube.com?v=test"}`))
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	client.AssertNotCalled(t, "GetVideo", mock.Anything)
+}
+
+func TestApi_ImportTracks_ShouldReturn400IfFileImportIsAsync(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	body, err := json.Marshal(models.ImportRequest{Source: importSourceFile, AudioBytes: testAudio})
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, testImporters(dbHandler, &mocks.YoutubeClient{})))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import?async=true", string(body)))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "AddJob", mock.Anything, mock.Anything)
+}
+
+func TestApi_ImportTracks_ShouldReturn201WithTracksImportedFromFile(t *testing.T) {
+	audioID := primitive.NewObjectID()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(audioID, nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.Name == "Song"
+	})).Return(nil)
+
+	body, err := json.Marshal(models.ImportRequest{Source: importSourceFile, YoutubeRequest: models.YoutubeRequest{Name: "Song"}, AudioBytes: testAudio})
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, testImporters(dbHandler, &mocks.YoutubeClient{})))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import", string(body)))
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var tracks []models.Track
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &tracks))
+	require.Len(t, tracks, 1)
+	require.Equal(t, audioID, tracks[0].AudioFileID)
+}
+
+func TestApi_ImportTracks_ShouldReturn422IfFileIsNotAudio(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, testImporters(dbHandler, &mocks.YoutubeClient{})))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import", `{"source":"file","audioBytes":"bm90IGF1ZGlv"}`))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	dbHandler.AssertNotCalled(t, "UploadAudioFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_RunImportJob_ShouldNotRetryInvalidRequests(t *testing.T) {
+	payload, err := bson.Marshal(models.ImportRequest{Source: importSourceYoutube, YoutubeRequest: models.YoutubeRequest{YoutubeLink: "www.youtube.com"}})
+	require.Nil(t, err)
+
+	_, err = runImportJob(testImporters(&mocks.DbHandler{}, &mocks.YoutubeClient{}))(context.Background(), models.Job{Payload: payload})
+	require.NotNil(t, err)
+	require.Equal(t, "youtubeLink must contain a video id", err.Error())
+	require.True(t, jobs.IsPermanent(err))
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// urlImporter downloads an audio file from a direct link, such as one to a file on a personal server, and stores it as
+// a track. Files in a format that cannot be stored as they are are converted to mp3 first.
+type urlImporter struct {
+	handler       dao.DbHandler
+	client        *http.Client
+	enrichers     enrichers
+	scanner       service.Scanner
+	validator     service.AudioValidator
+	fingerprinter service.Fingerprinter
+	transcoder    *library.Transcoder
+	variants      []library.Variant
+	ffmpeg        string
+	pool          *library.FFmpegPool
+	maxBytes      int64
+}
+
+// Validate implements Importer.
+func (u urlImporter) Validate(request models.ImportRequest) error {
+	if _, err := u.enrichers.forRequest(request.Enrichment); err != nil {
+		return statusError{code: http.StatusBadRequest, err: err}
+	}
+
+	parsed, err := url.Parse(request.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return statusError{code: http.StatusBadRequest, err: errors.New("url must be an http or https URL")}
+	}
+	if request.Password != "" && request.Username == "" {
+		return statusError{code: http.StatusBadRequest, err: errors.New("password requires a username")}
+	}
+	return nil
+}
+
+func (u urlImporter) checkQueueable(request models.ImportRequest) error {
+	if request.Username != "" {
+		return statusError{code: http.StatusBadRequest, err: errors.New("imports from URLs needing credentials cannot be queued")}
+	}
+	return nil
+}
+
+// Import implements Importer.
+func (u urlImporter) Import(ctx context.Context, request models.ImportRequest) ([]models.Track, error) {
+	if err := u.Validate(request); err != nil {
+		return nil, err
+	}
+	enricher, _ := u.enrichers.forRequest(request.Enrichment)
+
+	audio, err := u.download(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := library.DetectFormat(audio); err != nil {
+		if u.ffmpeg == "" {
+			return nil, statusError{code: http.StatusUnprocessableEntity, err: err}
+		}
+		if audio, err = u.convert(ctx, audio); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := scanAudio(ctx, u.scanner, bytes.NewReader(audio)); err != nil {
+		return nil, err
+	}
+	info, err := validateAudio(ctx, u.validator, bytes.NewReader(audio))
+	if err != nil {
+		return nil, err
+	}
+
+	track := models.Track{
+		ID:              primitive.NewObjectID(),
+		Name:            request.Name,
+		Artist:          request.Artist,
+		FeaturedArtists: request.FeaturedArtists,
+		AlbumName:       request.AlbumName,
+		AudioInfo:       info,
+		Fingerprint:     fingerprintUpload(ctx, u.fingerprinter, bytes.NewReader(audio)),
+	}
+	if track.Name == "" {
+		track.Name = fileTitle(request.URL)
+	}
+	library.ApplyTags(&track)
+	library.ApplyDefaults(&track)
+	enrichOnUpload(ctx, enricher, &track)
+
+	stored, err := library.StoreTranscodedTrack(ctx, u.handler, track, audio, u.transcoder, u.variants)
+	if errors.Is(err, library.ErrNotAudio) {
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: err}
+	} else if err != nil {
+		return nil, fmt.Errorf("error adding track to database: %w", err)
+	}
+	return []models.Track{stored}, nil
+}
+
+// convert converts a file DetectFormat does not recognise to mp3, as ffmpeg reads far more, such as WMA or audio inside
+// a video.
+func (u urlImporter) convert(ctx context.Context, audio []byte) ([]byte, error) {
+	release, err := acquireFFmpeg(ctx, u.pool)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	converted, err := convertToMp3(ctx, u.ffmpeg, bytes.NewReader(audio), 0)
+	if err != nil {
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: fmt.Errorf("%v: %w", library.ErrNotAudio, err)}
+	}
+	return converted, nil
+}
+
+// download fetches the file, rejecting it before reading it if the server reports it is too large or is not audio or
+// video, as happens when a link leads to a login page instead.
+func (u urlImporter) download(ctx context.Context, request models.ImportRequest) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, request.URL, nil)
+	if err != nil {
+		return nil, statusError{code: http.StatusBadRequest, err: err}
+	}
+	if request.Username != "" {
+		req.SetBasicAuth(request.Username, request.Password)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, statusError{code: http.StatusBadGateway, err: fmt.Errorf("error downloading file: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: fmt.Errorf("file host refused access with %v", resp.StatusCode)}
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: errors.New("file not found")}
+	case resp.StatusCode != http.StatusOK:
+		return nil, statusError{code: http.StatusBadGateway, err: fmt.Errorf("file host returned %v", resp.StatusCode)}
+	}
+
+	if resp.ContentLength > u.maxBytes {
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: fmt.Errorf("file exceeds the limit of %v bytes", u.maxBytes)}
+	}
+	if contentType := resp.Header.Get("Content-Type"); !isMediaContentType(contentType) {
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: fmt.Errorf("file is %v, not audio", contentType)}
+	}
+
+	audio, err := ioutil.ReadAll(io.LimitReader(resp.Body, u.maxBytes+1))
+	if err != nil {
+		return nil, statusError{code: http.StatusBadGateway, err: fmt.Errorf("error downloading file: %w", err)}
+	} else if int64(len(audio)) > u.maxBytes {
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: fmt.Errorf("file exceeds the limit of %v bytes", u.maxBytes)}
+	}
+	return audio, nil
+}
+
+// isMediaContentType reports whether a file served with the content type could be audio. Servers that do not know
+// what a file is send application/octet-stream or nothing, so those are left to format detection.
+func isMediaContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") ||
+		mediaType == "application/ogg" || mediaType == "application/octet-stream"
+}
+
+// fileTitle names a track after the file a URL points to, without its extension.
+func fileTitle(fileURL string) string {
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(parsed.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_URLImporter_ShouldStoreDownloadedFileWithBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(testAudio)
+	}))
+	defer server.Close()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, testAudio, "Song Title").Return(primitive.NewObjectID(), nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.Anything).Return(nil)
+
+	importer := urlImporter{handler: dbHandler, client: server.Client(), maxBytes: 1 << 20}
+	tracks, err := importer.Import(context.Background(), models.ImportRequest{
+		Source:   importSourceURL,
+		URL:      server.URL + "/music/Song%20Title.mp3",
+		Username: "user",
+		Password: "secret",
+	})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, "Song Title", tracks[0].Name)
+}
+
+func TestApi_URLImporter_ShouldRejectFilesThatAreNotAudio(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>Log in</html>"))
+	}))
+	defer server.Close()
+
+	dbHandler := &mocks.DbHandler{}
+	importer := urlImporter{handler: dbHandler, client: server.Client(), maxBytes: 1 << 20}
+	_, err := importer.Import(context.Background(), models.ImportRequest{Source: importSourceURL, URL: server.URL + "/song.mp3"})
+	require.NotNil(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, errorStatus(err))
+	dbHandler.AssertNotCalled(t, "UploadAudioFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_URLImporter_ShouldRejectFilesOverTheLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testAudio)
+	}))
+	defer server.Close()
+
+	dbHandler := &mocks.DbHandler{}
+	importer := urlImporter{handler: dbHandler, client: server.Client(), maxBytes: int64(len(testAudio) - 1)}
+	_, err := importer.Import(context.Background(), models.ImportRequest{Source: importSourceURL, URL: server.URL + "/song.mp3"})
+	require.NotNil(t, err)
+	require.Equal(t, http.StatusUnprocessableEntity, errorStatus(err))
+	require.Contains(t, err.Error(), "exceeds the limit")
+}
+
+func TestApi_URLImporter_ShouldReturn502IfHostFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	importer := urlImporter{handler: &mocks.DbHandler{}, client: server.Client(), maxBytes: 1 << 20}
+	_, err := importer.Import(context.Background(), models.ImportRequest{Source: importSourceURL, URL: server.URL + "/song.mp3"})
+	require.NotNil(t, err)
+	require.Equal(t, http.StatusBadGateway, errorStatus(err))
+}
+
+func TestApi_ImportTracks_ShouldNotQueueURLImportsWithCredentials(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	importers := map[string]Importer{importSourceURL: urlImporter{handler: dbHandler}}
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, importers))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import?async=true", `{"source":"url","url":"https://example.com/song.mp3","username":"user","password":"secret"}`))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "AddJob", mock.Anything, mock.Anything)
+}
+
+func TestApi_ImportTracks_ShouldReturn400IfURLIsNotHTTP(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	importers := map[string]Importer{importSourceURL: urlImporter{handler: dbHandler}}
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(importTracks(dbHandler, importers))
+	httpHandler.ServeHTTP(recorder, importRequest(t, "/import", `{"source":"url","url":"file:///etc/passwd"}`))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
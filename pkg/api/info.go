@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// getTrackInfo returns the codec, container, bit rate, sample rate, channels and duration of a track's audio. Tracks
+// stored before audio was probed at upload, or whose audio was transcoded, are probed when asked for.
+func getTrackInfo(handler dao.DbHandler, validator service.AudioValidator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		if tracks[0].AudioInfo != nil {
+			respondWithSuccess(w, http.StatusOK, tracks[0].AudioInfo)
+			return
+		}
+		if validator == nil {
+			respondWithError(w, http.StatusNotFound, "Audio info not available, ffprobe is not configured")
+			return
+		}
+
+		audio, err := handler.DownloadAudioFile(ctx, tracks[0].AudioFileID)
+		if err != nil {
+			logrus.WithError(err).Error("Error downloading audio file")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		info, err := validateAudio(ctx, validator, bytes.NewReader(audio))
+		if err != nil {
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, info)
+		return
+	}
+}
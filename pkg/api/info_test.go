@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func trackInfoRequest(t *testing.T, id string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}/info", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+	return mux.SetURLVars(req, map[string]string{"id": id})
+}
+
+func TestApi_GetTrackInfo_ShouldReturnInfoProbedAtUpload(t *testing.T) {
+	dbHandler := dao.NewMemoryHandler()
+	validator := &mocks.AudioValidator{}
+	probed := &models.AudioInfo{Container: "mp3", Codec: "mp3", BitRate: 128000, SampleRate: 44100, Channels: 2, Duration: 1.5}
+	validator.On("Validate", mock.Anything, mock.Anything).Return(probed, nil)
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(uploadAudioBytes(dbHandler, enrichers{}, nil, validator, nil)).ServeHTTP(recorder, audioBytesRequest(t))
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var track models.Track
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&track))
+
+	recorder = httptest.NewRecorder()
+	http.HandlerFunc(getTrackInfo(dbHandler, nil)).ServeHTTP(recorder, trackInfoRequest(t, track.ID.Hex()))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var info models.AudioInfo
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&info))
+	require.Equal(t, *probed, info)
+}
+
+func TestApi_GetTrackInfo_ShouldProbeTrackWithoutStoredInfo(t *testing.T) {
+	dbHandler := dao.NewMemoryHandler()
+	validator := &mocks.AudioValidator{}
+	validator.On("Validate", mock.Anything, readerOf(testAudio)).Return(&models.AudioInfo{Container: "mp3", Codec: "mp3", Duration: 1}, nil)
+
+	track, err := library.StoreTrack(context.Background(), dbHandler, models.Track{Name: "test"}, testAudio)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getTrackInfo(dbHandler, validator)).ServeHTTP(recorder, trackInfoRequest(t, track.ID.Hex()))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	validator.AssertExpectations(t)
+}
+
+func TestApi_GetTrackInfo_ShouldReturn404WithoutInfoOrValidator(t *testing.T) {
+	dbHandler := dao.NewMemoryHandler()
+
+	track, err := library.StoreTrack(context.Background(), dbHandler, models.Track{Name: "test"}, testAudio)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getTrackInfo(dbHandler, nil)).ServeHTTP(recorder, trackInfoRequest(t, track.ID.Hex()))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// importJobKinds are the kinds of job /import/{id} can act on.
+var importJobKinds = map[string]bool{jobKindImport: true, jobKindYoutubeImport: true}
+
+// getJob returns the state of a background job, such as a queued import.
+func getJob(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting id to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		jobs, err := handler.GetJobs(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving job")
+			respondWithStatusError(w, err)
+			return
+		} else if len(jobs) == 0 {
+			respondWithError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, jobs[0])
+		return
+	}
+}
+
+// getJobs lists background jobs, newest first, optionally only those with the ?status= given.
+func getJobs(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		filters := map[string]interface{}{}
+		if status := r.URL.Query().Get("status"); status != "" {
+			switch status {
+			case models.JobQueued, models.JobRunning, models.JobSucceeded, models.JobFailed, models.JobCancelled:
+				filters["status"] = status
+			default:
+				respondWithFieldError(w, "status", "unknown job status")
+				return
+			}
+		}
+
+		jobs, err := handler.GetJobs(ctx, filters)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving jobs")
+			respondWithStatusError(w, err)
+			return
+		}
+		if jobs == nil {
+			jobs = []models.Job{}
+		}
+
+		respondWithSuccess(w, http.StatusOK, jobs)
+		return
+	}
+}
+
+// cancelImport cancels a queued or running import. A running import is stopped by its worker, which notices the
+// cancellation when it next renews its lease; tracks it stored before then are kept and listed on the job.
+func cancelImport(handler dao.DbHandler) http.HandlerFunc {
+	return transitionImport(handler, []string{models.JobQueued, models.JobRunning}, "Import has already finished", func() bson.M {
+		return bson.M{"$set": bson.M{"status": models.JobCancelled, "finishedAt": time.Now()}}
+	})
+}
+
+// retryImport queues a failed or cancelled import to run again from the start, with its attempts reset.
+func retryImport(handler dao.DbHandler) http.HandlerFunc {
+	return transitionImport(handler, []string{models.JobFailed, models.JobCancelled}, "Only failed or cancelled imports can be retried", func() bson.M {
+		return bson.M{
+			"$set":   bson.M{"status": models.JobQueued, "attempts": 0, "runAt": time.Now()},
+			"$unset": bson.M{"error": "", "finishedAt": "", "lockedBy": "", "trackIds": "", "queuePosition": "", "progress": ""},
+		}
+	})
+}
+
+// transitionImport moves an import job of the caller's tenant from one of the given statuses to the one the update
+// sets, responding with the job as updated, or with a 409 and the conflict message if it is in another status.
+func transitionImport(handler dao.DbHandler, from []string, conflict string, update func() bson.M) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting id to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// TransitionJob does not look at tenants, so the job is first looked up in the caller's.
+		jobs, err := handler.GetJobs(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving job")
+			respondWithStatusError(w, err)
+			return
+		} else if len(jobs) == 0 || !importJobKinds[jobs[0].Kind] {
+			respondWithError(w, http.StatusNotFound, "Import not found")
+			return
+		}
+
+		job, err := handler.TransitionJob(ctx, id, from, update())
+		if errors.Is(err, dao.ErrJobStatus) {
+			respondWithError(w, http.StatusConflict, conflict)
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error updating job")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, job)
+		return
+	}
+}
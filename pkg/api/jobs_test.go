@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_GetJob_ShouldReturn404IfJobIsNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetJobs", mock.Anything, mock.Anything).Return([]models.Job{}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/job/"+primitive.NewObjectID().Hex(), nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/job/{id}", getJob(dbHandler))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GetJob_ShouldReturnJob(t *testing.T) {
+	id := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetJobs", mock.Anything, map[string]interface{}{"_id": id}).Return([]models.Job{{ID: id, Status: models.JobRunning}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/job/"+id.Hex(), nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/job/{id}", getJob(dbHandler))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"status":"running"`)
+}
+
+func TestApi_GetJobs_ShouldReturn400IfStatusIsUnknown(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/jobs?status=test", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getJobs(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetJobs_ShouldReturn500IfGetJobsErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetJobs", mock.Anything, map[string]interface{}{"status": models.JobFailed}).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodGet, "/jobs?status=failed", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getJobs(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_CancelImport_ShouldCancelRunningImport(t *testing.T) {
+	id := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetJobs", mock.Anything, map[string]interface{}{"_id": id}).Return([]models.Job{{ID: id, Kind: jobKindImport, Status: models.JobRunning}}, nil)
+	dbHandler.On("TransitionJob", mock.Anything, id, []string{models.JobQueued, models.JobRunning}, mock.MatchedBy(func(update bson.M) bool {
+		return update["$set"].(bson.M)["status"] == models.JobCancelled
+	})).Return(models.Job{ID: id, Kind: jobKindImport, Status: models.JobCancelled}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/import/"+id.Hex(), nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/import/{id}", cancelImport(dbHandler))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"status":"cancelled"`)
+}
+
+func TestApi_CancelImport_ShouldReturn409IfImportHasFinished(t *testing.T) {
+	id := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetJobs", mock.Anything, mock.Anything).Return([]models.Job{{ID: id, Kind: jobKindImport, Status: models.JobSucceeded}}, nil)
+	dbHandler.On("TransitionJob", mock.Anything, id, mock.Anything, mock.Anything).Return(models.Job{}, dao.ErrJobStatus)
+
+	req, err := http.NewRequest(http.MethodDelete, "/import/"+id.Hex(), nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/import/{id}", cancelImport(dbHandler))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestApi_CancelImport_ShouldReturn404IfJobIsNotAnImport(t *testing.T) {
+	id := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetJobs", mock.Anything, mock.Anything).Return([]models.Job{{ID: id, Kind: "other", Status: models.JobRunning}}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/import/"+id.Hex(), nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/import/{id}", cancelImport(dbHandler))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	dbHandler.AssertNotCalled(t, "TransitionJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_RetryImport_ShouldRequeueFailedImport(t *testing.T) {
+	id := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetJobs", mock.Anything, mock.Anything).Return([]models.Job{{ID: id, Kind: jobKindYoutubeImport, Status: models.JobFailed}}, nil)
+	dbHandler.On("TransitionJob", mock.Anything, id, []string{models.JobFailed, models.JobCancelled}, mock.MatchedBy(func(update bson.M) bool {
+		set := update["$set"].(bson.M)
+		return set["status"] == models.JobQueued && set["attempts"] == 0
+	})).Return(models.Job{ID: id, Kind: jobKindYoutubeImport, Status: models.JobQueued}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/import/"+id.Hex()+"/retry", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/import/{id}/retry", retryImport(dbHandler))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertExpectations(t)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// bodyLimiter caps the size of request bodies. Routes listed in routeLimits, keyed by path template without its version
+// prefix, get their own limit, and every other route gets defaultLimit. Requests that declare a larger Content-Length
+// are rejected up front; bodies without one are cut off once they pass the limit, which handlers report through
+// respondWithBodyError.
+type bodyLimiter struct {
+	defaultLimit int64
+	routeLimits  map[string]int64
+}
+
+func (b bodyLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := b.defaultLimit
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				if routeLimit, ok := b.routeLimits[unversionedPath(template)]; ok {
+					limit = routeLimit
+				}
+			}
+		}
+
+		if limit > 0 {
+			if r.ContentLength > limit {
+				respondWithError(w, http.StatusRequestEntityTooLarge, bodyTooLargeMessage(limit))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// respondWithBodyError reports a failure to read the request body, answering 413 if the body was over its size limit
+// and otherwise with the given code and message.
+func respondWithBodyError(w http.ResponseWriter, err error, code int, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, bodyTooLargeMessage(tooLarge.Limit))
+		return
+	}
+	respondWithError(w, code, message)
+}
+
+func bodyTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("Request body exceeds the limit of %v bytes", limit)
+}
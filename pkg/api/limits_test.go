@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_BodyLimiter_ShouldReturn413IfContentLengthExceedsLimit(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(bodyLimiter{defaultLimit: 10}.middleware)
+	router.HandleFunc("/playlist", func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist", strings.NewReader(`{"name": "a long playlist name"}`))
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestApi_BodyLimiter_ShouldApplyRouteLimit(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(bodyLimiter{defaultLimit: 10, routeLimits: map[string]int64{"/upload": 100}}.middleware)
+	router.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{"name": "a long playlist name"}`))
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_AddPlaylist_ShouldReturn413IfBodyWithoutContentLengthExceedsLimit(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	router := mux.NewRouter()
+	router.Use(bodyLimiter{defaultLimit: 10}.middleware)
+	router.HandleFunc("/playlist", addPlaylist(dbHandler))
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist", bytes.NewBufferString(`{"name": "a long playlist name"}`))
+	require.Nil(t, err)
+	req.ContentLength = -1
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
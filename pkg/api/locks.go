@@ -0,0 +1,24 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/service"
+)
+
+// importLocks keeps two replicas, or two requests to one, from running the same import at once. Keys are scoped to
+// the tenant. Without a locker every lock is granted.
+type importLocks struct {
+	locker service.Locker
+	ttl    time.Duration
+}
+
+func (l importLocks) acquire(ctx context.Context, kind string, id string) (func(), error) {
+	if l.locker == nil {
+		return func() {}, nil
+	}
+	return l.locker.Lock(ctx, fmt.Sprintf("lock:%v:%v:%v", dao.TenantFromContext(ctx), kind, id), l.ttl)
+}
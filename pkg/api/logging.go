@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configureLogging sets the log format, text or json, and the starting log level.
+func configureLogging(format string, level string) error {
+	switch strings.ToLower(format) {
+	case "", "text":
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown LOG_FORMAT %q, must be text or json", format)
+	}
+
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	logrus.SetLevel(parsed)
+	return nil
+}
+
+// checkAdminToken reports whether the request carries the admin token. Without a configured token nobody is an admin.
+func checkAdminToken(r *http.Request, adminToken string) bool {
+	token, err := getAuthToken(r)
+	if err != nil || adminToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+func getLogLevel(adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, models.LogLevel{Level: logrus.GetLevel().String()})
+		return
+	}
+}
+
+// setLogLevel changes the log level of this replica until it restarts, for debugging without a redeploy.
+func setLogLevel(adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		var request models.LogLevel
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		level, err := logrus.ParseLevel(request.Level)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		previous := logrus.GetLevel()
+		logrus.SetLevel(level)
+		logrus.WithFields(logrus.Fields{"from": previous.String(), "to": level.String()}).Warn("Log level changed")
+
+		respondWithSuccess(w, http.StatusOK, models.LogLevel{Level: level.String()})
+		return
+	}
+}
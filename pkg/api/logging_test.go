@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_ConfigureLogging_ShouldRejectUnknownFormatAndLevel(t *testing.T) {
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	require.NotNil(t, configureLogging("xml", "info"))
+	require.NotNil(t, configureLogging("json", "loud"))
+	require.Nil(t, configureLogging("json", "warn"))
+	require.IsType(t, &logrus.JSONFormatter{}, logrus.StandardLogger().Formatter)
+	require.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+}
+
+func TestApi_SetLogLevel_ShouldReturn403WithoutAdminToken(t *testing.T) {
+	for _, adminToken := range []string{"", "secret"} {
+		req, err := http.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"level":"debug"}`))
+		require.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer wrong")
+
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(setLogLevel(adminToken))
+		httpHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusForbidden, recorder.Code)
+	}
+}
+
+func TestApi_SetLogLevel_ShouldReturn400IfLevelIsInvalid(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"level":"loud"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(setLogLevel("secret"))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_SetLogLevel_ShouldChangeLevel(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	req, err := http.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"level":"debug"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(setLogLevel("secret"))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+
+	var level models.LogLevel
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &level))
+	require.Equal(t, "debug", level.Level)
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tempFiles are the temporary files the server writes, by directory, which a crash or a kill can leave behind.
+type tempFiles map[string][]string
+
+// sweepTempFiles is the scheduled task deleting the server's temporary files once they are older than maxAge, by when
+// whatever wrote them has finished or died.
+func sweepTempFiles(files tempFiles, maxAge time.Duration) scheduler.Func {
+	return func(ctx context.Context) error {
+		cutoff := time.Now().Add(-maxAge)
+		swept := 0
+		for dir, patterns := range files {
+			for _, pattern := range patterns {
+				matches, err := filepath.Glob(filepath.Join(dir, pattern))
+				if err != nil {
+					return err
+				}
+
+				for _, path := range matches {
+					info, err := os.Lstat(path)
+					if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+						continue
+					}
+					if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+						logrus.WithError(err).WithField("file", path).Warn("Error removing temporary file")
+						continue
+					}
+					swept++
+				}
+			}
+		}
+
+		if swept > 0 {
+			logrus.WithField("files", swept).Info("Removed stale temporary files")
+		}
+		return nil
+	}
+}
+
+// touchCacheEntry marks a file of an on-disk cache as used, so that evictLeastRecentlyUsed keeps it over files that
+// have not been used for longer.
+func touchCacheEntry(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// writeCacheEntry writes a file of an on-disk cache through a temporary file, so a request reading it never sees half
+// of it.
+func writeCacheEntry(dir string, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// evictLeastRecentlyUsed keeps the files of an on-disk cache within maxBytes, deleting those used least recently first,
+// and returns how many it deleted. Files still being written are left to sweepTempFiles.
+func evictLeastRecentlyUsed(dir string, maxBytes int64) (int, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().Before(entries[j].ModTime()) })
+
+	evicted := 0
+	for _, entry := range entries {
+		if total <= maxBytes {
+			break
+		}
+		if !entry.Mode().IsRegular() || strings.Contains(entry.Name(), ".tmp") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return evicted, err
+		}
+		total -= entry.Size()
+		evicted++
+	}
+	return evicted, nil
+}
+
+// libraryStats keeps the figures for each tenant's library, worked out on a schedule rather than on each request for
+// them, since it takes reading every track.
+type libraryStats struct {
+	mu    sync.Mutex
+	stats []models.LibraryStats
+}
+
+func (s *libraryStats) get() []models.LibraryStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// aggregate is the scheduled task working out the figures for every tenant's library.
+func (s *libraryStats) aggregate(handler dao.DbHandler, tenants tenantLister) scheduler.Func {
+	return func(ctx context.Context) error {
+		contexts, err := tenantContexts(ctx, tenants)
+		if err != nil {
+			return err
+		}
+
+		stats := make([]models.LibraryStats, 0, len(contexts))
+		for _, tenantCtx := range contexts {
+			tracks, err := handler.GetTracks(tenantCtx, map[string]interface{}{})
+			if err != nil {
+				return err
+			}
+			playlists, err := handler.GetPlaylists(tenantCtx, map[string]interface{}{})
+			if err != nil {
+				return err
+			}
+			plays, err := handler.GetPlayCounts(tenantCtx, time.Now().AddDate(0, 0, -1))
+			if err != nil {
+				return err
+			}
+
+			tenant := models.LibraryStats{
+				Tenant:       dao.TenantFromContext(tenantCtx),
+				Tracks:       len(tracks),
+				Playlists:    len(playlists),
+				AggregatedAt: time.Now(),
+			}
+			for _, track := range tracks {
+				if track.AudioInfo != nil {
+					tenant.Duration += track.AudioInfo.Duration
+				}
+			}
+			for _, count := range plays {
+				tenant.PlaysLastDay += count.Plays
+			}
+			stats = append(stats, tenant)
+		}
+
+		s.mu.Lock()
+		s.stats = stats
+		s.mu.Unlock()
+		return nil
+	}
+}
+
+// getSchedule reports on this replica's maintenance tasks: when each next runs, and how its last run went.
+func getSchedule(adminToken string, tasks *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, tasks.Status())
+	}
+}
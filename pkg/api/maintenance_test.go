@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeAged writes a file last modified age ago.
+func writeAged(t *testing.T, path string, size int, age time.Duration) {
+	require.Nil(t, ioutil.WriteFile(path, make([]byte, size), 0644))
+	modified := time.Now().Add(-age)
+	require.Nil(t, os.Chtimes(path, modified, modified))
+}
+
+func TestApi_SweepTempFiles_ShouldRemoveOnlyStaleMatchingFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "upload123"), 1, 2*time.Hour)
+	writeAged(t, filepath.Join(dir, "upload456"), 1, time.Minute)
+	writeAged(t, filepath.Join(dir, "other"), 1, 2*time.Hour)
+
+	require.Nil(t, sweepTempFiles(tempFiles{dir: {"upload*"}}, time.Hour)(context.Background()))
+
+	remaining, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{filepath.Join(dir, "upload456"), filepath.Join(dir, "other")}, remaining)
+}
+
+func TestApi_ArtworkCache_Evict_ShouldRemoveLeastRecentlyUsedEntries(t *testing.T) {
+	cache := &artworkCache{dir: t.TempDir()}
+	writeAged(t, filepath.Join(cache.dir, "a-original"), 100, 3*time.Hour)
+	writeAged(t, filepath.Join(cache.dir, "b-original"), 100, 2*time.Hour)
+	writeAged(t, filepath.Join(cache.dir, "c-original"), 100, time.Hour)
+	cache.touch("a-original")
+
+	require.Nil(t, cache.evict(200)(context.Background()))
+
+	remaining, err := filepath.Glob(filepath.Join(cache.dir, "*"))
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{filepath.Join(cache.dir, "a-original"), filepath.Join(cache.dir, "c-original")}, remaining)
+}
+
+func TestApi_ArtworkCache_Evict_ShouldIgnoreMissingCache(t *testing.T) {
+	cache := &artworkCache{dir: filepath.Join(t.TempDir(), "missing")}
+	require.Nil(t, cache.evict(0)(context.Background()))
+}
+
+func TestApi_LibraryStats_ShouldAggregateLibrary(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := library.StoreTrack(ctx, handler, models.Track{Name: "test", AudioInfo: &models.AudioInfo{Duration: 90}}, testAudio)
+	require.Nil(t, err)
+	require.Nil(t, handler.AddPlaylist(ctx, models.Playlist{Name: "test"}))
+	require.Nil(t, handler.AddPlay(ctx, models.Play{TrackID: track.ID, PlayedAt: time.Now()}))
+
+	stats := &libraryStats{}
+	require.Nil(t, stats.aggregate(handler, nil)(ctx))
+
+	aggregated := stats.get()
+	require.Len(t, aggregated, 1)
+	require.Equal(t, 1, aggregated[0].Tracks)
+	require.Equal(t, 1, aggregated[0].Playlists)
+	require.Equal(t, float64(90), aggregated[0].Duration)
+	require.Equal(t, 1, aggregated[0].PlaysLastDay)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// mongoSettings tune the MongoDB driver's connection pool and timeouts. Zero leaves the driver's default, or whatever
+// MONGO_URI sets, in place: a pool of up to 100 connections kept without a minimum, 30 seconds to find a server, and
+// no socket timeout.
+type mongoSettings struct {
+	uri                    string
+	maxPoolSize            int
+	minPoolSize            int
+	serverSelectionTimeout time.Duration
+	socketTimeout          time.Duration
+	// listReadPreference is the read preference for the list endpoints, such as primaryPreferred or secondary. Empty
+	// or primary keeps them on the primary with everything else.
+	listReadPreference string
+}
+
+func mongoSettingsFromEnv() mongoSettings {
+	return mongoSettings{
+		uri:                    os.Getenv("MONGO_URI"),
+		maxPoolSize:            getEnvInt("MONGO_MAX_POOL_SIZE", 0),
+		minPoolSize:            getEnvInt("MONGO_MIN_POOL_SIZE", 0),
+		serverSelectionTimeout: getEnvDuration("MONGO_SERVER_SELECTION_TIMEOUT", 0),
+		socketTimeout:          getEnvDuration("MONGO_SOCKET_TIMEOUT", 0),
+		listReadPreference:     os.Getenv("MONGO_LIST_READ_PREFERENCE"),
+	}
+}
+
+// clientOptions returns the options to connect with, the settings taking precedence over the same options given in
+// the URI. A socket timeout must outlast the longest single database round trip, which for change streams is the time
+// they wait for a change.
+func (s mongoSettings) clientOptions() (*options.ClientOptions, error) {
+	if s.maxPoolSize < 0 || s.minPoolSize < 0 || s.serverSelectionTimeout < 0 || s.socketTimeout < 0 {
+		return nil, errors.New("MongoDB pool sizes and timeouts cannot be negative")
+	}
+	if s.maxPoolSize > 0 && s.minPoolSize > s.maxPoolSize {
+		return nil, fmt.Errorf("MONGO_MIN_POOL_SIZE %v exceeds MONGO_MAX_POOL_SIZE %v", s.minPoolSize, s.maxPoolSize)
+	}
+
+	opts := options.Client().ApplyURI(s.uri)
+	if s.maxPoolSize > 0 {
+		opts.SetMaxPoolSize(uint64(s.maxPoolSize))
+	}
+	if s.minPoolSize > 0 {
+		opts.SetMinPoolSize(uint64(s.minPoolSize))
+	}
+	if s.serverSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(s.serverSelectionTimeout)
+	}
+	if s.socketTimeout > 0 {
+		opts.SetSocketTimeout(s.socketTimeout)
+	}
+	return opts, nil
+}
+
+// listReadPref returns the read preference for the list endpoints, or nil if they are to read from the primary.
+func (s mongoSettings) listReadPref() (*readpref.ReadPref, error) {
+	if s.listReadPreference == "" || strings.EqualFold(s.listReadPreference, "primary") {
+		return nil, nil
+	}
+
+	mode, err := readpref.ModeFromString(s.listReadPreference)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MONGO_LIST_READ_PREFERENCE: %w", err)
+	}
+	return readpref.New(mode)
+}
+
+// secondaryReads lets the queries of a list endpoint go to a replica set secondary, when a list read preference is
+// configured. Only read-only endpoints are wrapped: a listing a moment out of date does no harm, where reading a
+// document before changing it must see the latest revision.
+func secondaryReads(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(dao.WithSecondaryReads(r.Context())))
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestMongoSettings_ClientOptions_ShouldOverrideURIOptions(t *testing.T) {
+	settings := mongoSettings{
+		uri:           "mongodb://localhost:27017/?maxPoolSize=50&serverSelectionTimeoutMS=1000",
+		maxPoolSize:   5,
+		minPoolSize:   1,
+		socketTimeout: time.Minute,
+	}
+
+	opts, err := settings.clientOptions()
+	require.Nil(t, err)
+	require.Equal(t, uint64(5), *opts.MaxPoolSize)
+	require.Equal(t, uint64(1), *opts.MinPoolSize)
+	require.Equal(t, time.Second, *opts.ServerSelectionTimeout)
+	require.Equal(t, time.Minute, *opts.SocketTimeout)
+}
+
+func TestMongoSettings_ClientOptions_ShouldRejectMinPoolLargerThanMax(t *testing.T) {
+	_, err := mongoSettings{uri: "mongodb://localhost:27017", maxPoolSize: 2, minPoolSize: 3}.clientOptions()
+	require.NotNil(t, err)
+
+	_, err = mongoSettings{uri: "mongodb://localhost:27017", socketTimeout: -time.Second}.clientOptions()
+	require.NotNil(t, err)
+}
+
+func TestMongoSettings_ListReadPref_ShouldParseReadPreferenceMode(t *testing.T) {
+	pref, err := mongoSettings{}.listReadPref()
+	require.Nil(t, err)
+	require.Nil(t, pref)
+
+	pref, err = mongoSettings{listReadPreference: "primary"}.listReadPref()
+	require.Nil(t, err)
+	require.Nil(t, pref)
+
+	pref, err = mongoSettings{listReadPreference: "secondaryPreferred"}.listReadPref()
+	require.Nil(t, err)
+	require.Equal(t, readpref.SecondaryPreferredMode, pref.Mode())
+
+	_, err = mongoSettings{listReadPreference: "anywhere"}.listReadPref()
+	require.NotNil(t, err)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// trackFormFields sets the details of an uploaded track from plain form fields, for clients such as curl and HTML forms
+// that cannot easily send them as JSON.
+var trackFormFields = map[string]func(track *models.Track, value string){
+	"name":   func(track *models.Track, value string) { track.Name = value },
+	"artist": func(track *models.Track, value string) { track.Artist = value },
+	"album":  func(track *models.Track, value string) { track.AlbumName = value },
+	"genre":  func(track *models.Track, value string) { track.Genre = value },
+}
+
+// applyFormFields sets the details of a track from those of trackFormFields that were sent, taking precedence over the
+// same details given in the form's JSON body.
+func applyFormFields(track *models.Track, fields map[string]string) {
+	for name, apply := range trackFormFields {
+		if value := strings.TrimSpace(fields[name]); value != "" {
+			apply(track, value)
+		}
+	}
+}
+
+// multipartUpload is a file sent in a multipart form along with the form's other fields. The file is held in memory,
+// or past the threshold in a temporary file, which Close removes.
+type multipartUpload struct {
+	file     io.ReaderAt
+	size     int64
+	fileName string
+	fields   map[string]string
+}
+
+// open returns a reader of the file from its start.
+func (u multipartUpload) open() *io.SectionReader {
+	return io.NewSectionReader(u.file, 0, u.size)
+}
+
+// Close removes the temporary file the upload was spooled to, if it was.
+func (u multipartUpload) Close() error {
+	file, ok := u.file.(*os.File)
+	if !ok {
+		return nil
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// readMultipartUpload reads a multipart form part by part as it arrives, keeping the file sent as fileField and the
+// values of the other fields. ParseMultipartForm would hold the file itself and have it copied out again, taking
+// twice its size and more while the copy grows; here the file is held in memory only while it is no bigger than
+// memoryThreshold, and past that is spooled to a temporary file, which is read from where it is rather than back into
+// memory. Fields other than the file are limited to memoryThreshold bytes each, and http.ErrMissingFile is returned if
+// the file is not sent. The caller closes the returned upload once done with the file.
+func readMultipartUpload(r *http.Request, fileField string, memoryThreshold int64) (multipartUpload, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return multipartUpload{}, err
+	}
+
+	upload := multipartUpload{fields: make(map[string]string)}
+	fail := func(err error) (multipartUpload, error) {
+		if err := upload.Close(); err != nil {
+			logrus.WithError(err).Warn("Error removing spooled upload")
+		}
+		return multipartUpload{}, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(err)
+		}
+
+		if part.FormName() == fileField && part.FileName() != "" {
+			// Only the last file sent is kept.
+			if err := upload.Close(); err != nil {
+				logrus.WithError(err).Warn("Error removing spooled upload")
+			}
+			if upload.file, upload.size, err = spoolPart(part, memoryThreshold); err != nil {
+				return fail(err)
+			}
+			upload.fileName = part.FileName()
+			continue
+		}
+
+		value, err := ioutil.ReadAll(io.LimitReader(part, memoryThreshold+1))
+		if err != nil {
+			return fail(err)
+		} else if int64(len(value)) > memoryThreshold {
+			return fail(fmt.Errorf("form field %q exceeds the limit of %v bytes", part.FormName(), memoryThreshold))
+		}
+		upload.fields[part.FormName()] = string(value)
+	}
+
+	if upload.file == nil {
+		return multipartUpload{}, http.ErrMissingFile
+	}
+	return upload, nil
+}
+
+// spoolPart reads a part into memory if it is no bigger than memoryThreshold, and otherwise into a temporary file,
+// returning where it is held and its size.
+func spoolPart(part io.Reader, memoryThreshold int64) (io.ReaderAt, int64, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(part, memoryThreshold+1))
+	if err != nil {
+		return nil, 0, err
+	} else if n <= memoryThreshold {
+		return bytes.NewReader(buf.Bytes()), n, nil
+	}
+
+	file, err := ioutil.TempFile("", "upload")
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := buf.WriteTo(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, err
+	}
+	size, err := io.Copy(file, part)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, err
+	}
+	return file, n + size, nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func multipartRequest(t *testing.T, file []byte, fields map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		require.Nil(t, writer.WriteField(name, value))
+	}
+	if file != nil {
+		part, err := writer.CreateFormFile("input", "test.mp3")
+		require.Nil(t, err)
+		_, err = part.Write(file)
+		require.Nil(t, err)
+	}
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/track", body)
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestApi_ReadMultipartUpload_ShouldReadFileHeldInMemoryOrSpooledToDisk(t *testing.T) {
+	file := bytes.Repeat([]byte("audio"), 100)
+	for _, threshold := range []int64{1 << 20, 64} {
+		upload, err := readMultipartUpload(multipartRequest(t, file, map[string]string{"body": "{}"}), "input", threshold)
+		require.Nil(t, err)
+		data, err := ioutil.ReadAll(upload.open())
+		require.Nil(t, err)
+		require.Equal(t, file, data)
+		require.Equal(t, map[string]string{"body": "{}"}, upload.fields)
+		require.Nil(t, upload.Close())
+	}
+}
+
+func TestApi_ReadMultipartUpload_ShouldRemoveSpooledFileOnClose(t *testing.T) {
+	upload, err := readMultipartUpload(multipartRequest(t, bytes.Repeat([]byte("audio"), 100), nil), "input", 64)
+	require.Nil(t, err)
+	spooled, ok := upload.file.(*os.File)
+	require.True(t, ok)
+
+	require.Nil(t, upload.Close())
+	_, err = os.Stat(spooled.Name())
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestApi_ReadMultipartUpload_ShouldReturnErrorIfFileIsMissing(t *testing.T) {
+	_, err := readMultipartUpload(multipartRequest(t, nil, map[string]string{"body": "{}"}), "input", 1<<20)
+	require.Equal(t, http.ErrMissingFile, err)
+}
+
+func TestApi_ReadMultipartUpload_ShouldReturnErrorIfFieldExceedsThreshold(t *testing.T) {
+	_, err := readMultipartUpload(multipartRequest(t, []byte("audio"), map[string]string{"body": strings.Repeat("x", 65)}), "input", 64)
+	require.NotNil(t, err)
+}
+
+func TestApi_ReadMultipartUpload_ShouldReturnErrorIfRequestIsNotMultipart(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/track", strings.NewReader("{}"))
+	require.Nil(t, err)
+
+	_, err = readMultipartUpload(req, "input", 1<<20)
+	require.Equal(t, http.ErrNotMultipart, err)
+}
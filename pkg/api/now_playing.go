@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// setNowPlaying records what the caller is listening to, and where they are in it, so that their other devices can
+// take over and, if they choose, others can see it. Clients report it when playback starts, pauses or seeks; the
+// position while playing is worked out from the time of the last report.
+func setNowPlaying(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		user := dao.UserFromContext(ctx)
+		if user == "" {
+			respondWithError(w, http.StatusForbidden, "Now playing is only kept for signed-in users")
+			return
+		}
+
+		var request models.NowPlayingRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+		if request.TrackID.IsZero() {
+			respondWithFieldError(w, "trackId", "trackId is required")
+			return
+		}
+		if request.Position < 0 {
+			respondWithFieldError(w, "position", "position must not be negative")
+			return
+		}
+		switch request.Visibility {
+		case "", models.NowPlayingPrivate, models.NowPlayingPublic:
+		default:
+			respondWithFieldError(w, "visibility", `visibility must be "private" or "public"`)
+			return
+		}
+
+		visibility := request.Visibility
+		if visibility == "" {
+			previous, err := handler.GetNowPlaying(ctx, user)
+			if err != nil && !errors.Is(err, dao.ErrNotFound) {
+				logrus.WithError(err).Error("Error retrieving now playing")
+				respondWithStatusError(w, err)
+				return
+			}
+			visibility = previous.Visibility
+		}
+		if visibility == "" {
+			visibility = models.NowPlayingPrivate
+		}
+
+		state := models.NowPlaying{
+			User:       user,
+			TrackID:    request.TrackID,
+			Position:   request.Position,
+			Playing:    request.Playing,
+			Device:     request.Device,
+			Visibility: visibility,
+			UpdatedAt:  time.Now(),
+		}
+		if err := handler.SetNowPlaying(ctx, state); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error storing now playing")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, state)
+		return
+	}
+}
+
+// getNowPlaying returns what a user is listening to, with the track and the position reached by now. Users see their
+// own whatever its visibility; others see it only if it is public, and are otherwise told, as when there is nothing,
+// that nothing is playing, so that private listening cannot be told apart from none.
+func getNowPlaying(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		user := mux.Vars(r)["id"]
+		state, err := handler.GetNowPlaying(ctx, user)
+		if errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Nothing playing")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error retrieving now playing")
+			respondWithStatusError(w, err)
+			return
+		}
+		if state.Visibility != models.NowPlayingPublic && dao.UserFromContext(ctx) != user {
+			respondWithError(w, http.StatusNotFound, "Nothing playing")
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": state.TrackID})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Nothing playing")
+			return
+		}
+		state.Track = &tracks[0]
+
+		if state.Playing {
+			state.Position += time.Since(state.UpdatedAt).Seconds()
+			if info := state.Track.AudioInfo; info != nil && info.Duration > 0 && state.Position >= info.Duration {
+				state.Position = info.Duration
+				state.Playing = false
+			}
+		}
+
+		respondWithSuccess(w, http.StatusOK, state)
+		return
+	}
+}
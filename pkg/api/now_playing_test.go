@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func nowPlayingRequest(t *testing.T, handler dao.DbHandler, method string, path string, user string, body string) *httptest.ResponseRecorder {
+	r := mux.NewRouter()
+	r.HandleFunc("/me/now-playing", setNowPlaying(handler)).Methods(http.MethodPut)
+	r.HandleFunc("/user/{id}/now-playing", getNowPlaying(handler)).Methods(http.MethodGet)
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req = req.WithContext(dao.WithUser(req.Context(), user))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestApi_NowPlaying_ShouldShareStateOnlyWhenPublic(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+	track := models.Track{ID: primitive.NewObjectID(), Name: "test", AudioInfo: &models.AudioInfo{Duration: 200}}
+	require.Nil(t, handler.AddTrack(context.Background(), track))
+
+	w := nowPlayingRequest(t, handler, http.MethodPut, "/me/now-playing", "alice", `{"trackId": "`+track.ID.Hex()+`", "position": 30, "device": "phone"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var state models.NowPlaying
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&state))
+	require.Equal(t, "alice", state.User)
+	require.Equal(t, models.NowPlayingPrivate, state.Visibility)
+
+	// Others cannot tell private listening from none.
+	w = nowPlayingRequest(t, handler, http.MethodGet, "/user/alice/now-playing", "bob", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = nowPlayingRequest(t, handler, http.MethodGet, "/user/carol/now-playing", "bob", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = nowPlayingRequest(t, handler, http.MethodGet, "/user/alice/now-playing", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&state))
+	require.Equal(t, 30.0, state.Position)
+	require.Equal(t, "phone", state.Device)
+	require.Equal(t, "test", state.Track.Name)
+
+	w = nowPlayingRequest(t, handler, http.MethodPut, "/me/now-playing", "alice", `{"trackId": "`+track.ID.Hex()+`", "position": 30, "visibility": "public"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	// The visibility is kept by reports that leave it out.
+	w = nowPlayingRequest(t, handler, http.MethodPut, "/me/now-playing", "alice", `{"trackId": "`+track.ID.Hex()+`", "position": 40}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = nowPlayingRequest(t, handler, http.MethodGet, "/user/alice/now-playing", "bob", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&state))
+	require.Equal(t, 40.0, state.Position)
+}
+
+func TestApi_NowPlaying_ShouldAdvancePositionWhilePlaying(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track := models.Track{ID: primitive.NewObjectID(), Name: "test", AudioInfo: &models.AudioInfo{Duration: 200}}
+	require.Nil(t, handler.AddTrack(ctx, track))
+
+	require.Nil(t, handler.SetNowPlaying(ctx, models.NowPlaying{User: "alice", TrackID: track.ID, Position: 30, Playing: true, UpdatedAt: time.Now().Add(-time.Minute)}))
+	w := nowPlayingRequest(t, handler, http.MethodGet, "/user/alice/now-playing", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var state models.NowPlaying
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&state))
+	require.InDelta(t, 90.0, state.Position, 1)
+	require.True(t, state.Playing)
+
+	// A track played out long ago is reported as finished.
+	require.Nil(t, handler.SetNowPlaying(ctx, models.NowPlaying{User: "alice", TrackID: track.ID, Playing: true, UpdatedAt: time.Now().Add(-time.Hour)}))
+	w = nowPlayingRequest(t, handler, http.MethodGet, "/user/alice/now-playing", "alice", "")
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&state))
+	require.Equal(t, 200.0, state.Position)
+	require.False(t, state.Playing)
+}
+
+func TestApi_NowPlaying_ShouldRejectInvalidReports(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+	track := models.Track{ID: primitive.NewObjectID(), Name: "test"}
+	require.Nil(t, handler.AddTrack(context.Background(), track))
+
+	w := nowPlayingRequest(t, handler, http.MethodPut, "/me/now-playing", "", `{"trackId": "`+track.ID.Hex()+`"}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = nowPlayingRequest(t, handler, http.MethodPut, "/me/now-playing", "alice", `{"position": 3}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = nowPlayingRequest(t, handler, http.MethodPut, "/me/now-playing", "alice", `{"trackId": "`+track.ID.Hex()+`", "visibility": "friends"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = nowPlayingRequest(t, handler, http.MethodPut, "/me/now-playing", "alice", `{"trackId": "`+primitive.NewObjectID().Hex()+`"}`)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	oembedDefaultWidth = 400
+	// oembedHeight is the height of a browser's audio controls, which do not grow with the space given to them.
+	oembedHeight = 54
+)
+
+// oembedSettings configures the provider getOEmbed reports. baseURL is the externally visible address of the API; when
+// empty it is derived from each request.
+type oembedSettings struct {
+	providerName string
+	baseURL      string
+}
+
+// getOEmbed describes a shared track link as an oEmbed rich object, whose HTML is an audio player for the link, so that
+// chat apps and blogs can show the track inline. As the spec asks, URLs that are not track share links get a 404 and
+// formats other than JSON a 501.
+func getOEmbed(handler dao.DbHandler, signer *service.URLSigner, settings oembedSettings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		query := r.URL.Query()
+		if format := query.Get("format"); format != "" && format != "json" {
+			respondWithError(w, http.StatusNotImplemented, "Only the json format is supported")
+			return
+		}
+
+		width := oembedDefaultWidth
+		if maxWidth := query.Get("maxwidth"); maxWidth != "" {
+			limit, err := strconv.Atoi(maxWidth)
+			if err != nil || limit <= 0 {
+				respondWithFieldError(w, "maxwidth", "maxwidth must be a positive integer")
+				return
+			}
+			if limit < width {
+				width = limit
+			}
+		}
+		if maxHeight := query.Get("maxheight"); maxHeight != "" {
+			if limit, err := strconv.Atoi(maxHeight); err != nil || limit <= 0 {
+				respondWithFieldError(w, "maxheight", "maxheight must be a positive integer")
+				return
+			}
+		}
+
+		link := query.Get("url")
+		token, ok := shareToken(link)
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "URL is not a shared track link")
+			return
+		}
+
+		ctx, share, err := loadShare(r.Context(), handler, signer, token)
+		if err != nil {
+			respondWithStatusError(w, err)
+			return
+		}
+		if share.Kind != shareKindTrack {
+			respondWithError(w, http.StatusNotFound, "URL is not a shared track link")
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": share.ResourceID})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+		track := tracks[0]
+
+		player := fmt.Sprintf(`<audio controls preload="none" src="%v" title="%v" style="width:%dpx"></audio>`,
+			html.EscapeString(link), html.EscapeString(track.Name), width)
+		respondWithSuccess(w, http.StatusOK, models.OEmbed{
+			Type:         "rich",
+			Version:      "1.0",
+			Title:        track.Name,
+			AuthorName:   track.Artist,
+			ProviderName: settings.providerName,
+			ProviderURL:  externalURL(r, settings.baseURL, "/"),
+			CacheAge:     int64(time.Until(share.ExpiresAt).Seconds()),
+			ThumbnailURL: track.ArtworkURL,
+			HTML:         player,
+			Width:        width,
+			Height:       oembedHeight,
+		})
+		return
+	}
+}
+
+// shareToken extracts the signed token from a share link, such as https://example.com/v1/shared/{token}. Links to a
+// track of a shared playlist are not share links of their own, so are not matched.
+func shareToken(link string) (string, bool) {
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", false
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "shared" && i == len(segments)-2 {
+			return segments[i+1], segments[i+1] != ""
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func oembedRequest(t *testing.T, query url.Values) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "/oembed?"+query.Encode(), http.NoBody)
+	require.Nil(t, err)
+	return req
+}
+
+func TestApi_GetOEmbed_ShouldDescribeSharedTrack(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	signer := &service.URLSigner{Secret: []byte("secret")}
+	track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "Song <1>", Artist: "Band"}, testAudio)
+	require.Nil(t, err)
+	share := models.Share{ID: primitive.NewObjectID(), Kind: shareKindTrack, ResourceID: track.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	require.Nil(t, handler.AddShare(ctx, share))
+	token, err := signer.Sign(service.SignedClaims{Subject: "share:" + share.ID.Hex(), Expires: share.ExpiresAt.Unix()})
+	require.Nil(t, err)
+	link := "https://music.example.com/v1/shared/" + token
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getOEmbed(handler, signer, oembedSettings{providerName: "Music Stream", baseURL: "https://music.example.com"}))
+	httpHandler.ServeHTTP(recorder, oembedRequest(t, url.Values{"url": {link}, "maxwidth": {"300"}}))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var oembed models.OEmbed
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&oembed))
+	require.Equal(t, "rich", oembed.Type)
+	require.Equal(t, "Song <1>", oembed.Title)
+	require.Equal(t, "Band", oembed.AuthorName)
+	require.Equal(t, 300, oembed.Width)
+	require.Contains(t, oembed.HTML, `src="`+link+`"`)
+	require.Contains(t, oembed.HTML, `title="Song &lt;1&gt;"`)
+}
+
+func TestApi_GetOEmbed_ShouldReturn404ForOtherURLs(t *testing.T) {
+	httpHandler := http.HandlerFunc(getOEmbed(dao.NewMemoryHandler(), &service.URLSigner{Secret: []byte("secret")}, oembedSettings{}))
+
+	for _, link := range []string{"https://example.com/track/1", "https://example.com/v1/shared/test", "not a url"} {
+		recorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(recorder, oembedRequest(t, url.Values{"url": {link}}))
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestApi_GetOEmbed_ShouldReturn501ForXML(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getOEmbed(dao.NewMemoryHandler(), &service.URLSigner{Secret: []byte("secret")}, oembedSettings{}))
+	httpHandler.ServeHTTP(recorder, oembedRequest(t, url.Values{"url": {"https://example.com/v1/shared/test"}, "format": {"xml"}}))
+	require.Equal(t, http.StatusNotImplemented, recorder.Code)
+}
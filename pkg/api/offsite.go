@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/scheduler"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+// offsiteSections are the sections of each snapshot pushed off site. Audio goes up as objects of its own instead, so
+// that each file is only uploaded once.
+var offsiteSections = []string{library.BackupTracks, library.BackupPlaylists, library.BackupPodcasts, library.BackupShares, library.BackupAPIKeys}
+
+// offsiteManifest is kept beside each tenant's backups in the bucket as latest.json, recording when the last complete
+// run started, which the next one backs up the changes since.
+type offsiteManifest struct {
+	StartedAt time.Time `json:"startedAt"`
+	Snapshot  string    `json:"snapshot"`
+}
+
+// offsiteBackup pushes incremental backups of every tenant's library to an object store. Each run uploads a snapshot
+// of the documents changed since the last complete one, as snapshots/<time>.tar in the format of GET /admin/backup,
+// and each file of the changed tracks the bucket does not have yet as audio/<fileID>. The first run for a tenant
+// uploads everything. The default tenant's objects go under the prefix, and the others' under tenants/<tenant>/.
+type offsiteBackup struct {
+	store  service.ObjectStore
+	bucket string
+	prefix string
+
+	mu     sync.Mutex
+	status models.OffsiteBackupStatus
+}
+
+// get returns the status of the last run, or nil if off-site backups are not configured.
+func (o *offsiteBackup) get() *models.OffsiteBackupStatus {
+	if o == nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	status := o.status
+	status.Bucket = o.bucket
+	return &status
+}
+
+func (o *offsiteBackup) tenantPrefix(ctx context.Context) string {
+	prefix := o.prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if tenant := dao.TenantFromContext(ctx); tenant != "" {
+		prefix += "tenants/" + tenant + "/"
+	}
+	return prefix
+}
+
+// run is the scheduled task backing up every tenant. The tenant's lock keeps replicas from backing it up at the same
+// time.
+func (o *offsiteBackup) run(handler dao.DbHandler, tenants tenantLister, locks importLocks) scheduler.Func {
+	return func(ctx context.Context) error {
+		startedAt := time.Now()
+		contexts, err := tenantContexts(ctx, tenants)
+		if err != nil {
+			o.record(startedAt, 0, 0, err)
+			return err
+		}
+
+		var failed error
+		var documents, files int
+		for _, tenantCtx := range contexts {
+			unlock, err := locks.acquire(tenantCtx, "backup", "offsite")
+			if errors.Is(err, service.ErrLocked) {
+				continue
+			} else if err != nil {
+				logrus.WithError(err).Error("Error acquiring off-site backup lock")
+				failed = err
+				continue
+			}
+
+			tenantDocuments, tenantFiles, err := o.backupTenant(tenantCtx, handler)
+			unlock()
+			documents += tenantDocuments
+			files += tenantFiles
+			if err != nil {
+				logrus.WithError(err).WithField("tenant", dao.TenantFromContext(tenantCtx)).Error("Error pushing off-site backup")
+				failed = err
+			}
+		}
+		o.record(startedAt, documents, files, failed)
+		return failed
+	}
+}
+
+func (o *offsiteBackup) record(startedAt time.Time, documents int, files int, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.status.LastRunAt = &startedAt
+	if err != nil {
+		o.status.LastError = err.Error()
+		return
+	}
+	o.status.LastError = ""
+	o.status.LastSuccessAt = &startedAt
+	o.status.Documents = documents
+	o.status.Files = files
+}
+
+// backupTenant pushes the changes to the tenant's library since its last complete run, returning how many documents
+// and files it uploaded. The manifest is only moved on once everything is up, so a failed run is covered by the next.
+func (o *offsiteBackup) backupTenant(ctx context.Context, handler dao.DbHandler) (int, int, error) {
+	prefix := o.tenantPrefix(ctx)
+	var manifest offsiteManifest
+	body, err := o.store.GetObject(ctx, prefix+"latest.json")
+	if err == nil {
+		if err := json.Unmarshal(body, &manifest); err != nil {
+			return 0, 0, fmt.Errorf("error reading off-site backup manifest: %w", err)
+		}
+	} else if !errors.Is(err, service.ErrObjectNotFound) {
+		return 0, 0, err
+	}
+
+	// Stored times are kept to the millisecond, so the next run takes changes from the start of this one's.
+	startedAt := time.Now().UTC().Truncate(time.Millisecond)
+	var snapshot bytes.Buffer
+	header, err := library.WriteBackupSince(ctx, handler, &snapshot, offsiteSections, manifest.StartedAt)
+	if err != nil {
+		return 0, 0, err
+	}
+	snapshotKey := prefix + "snapshots/" + startedAt.Format("20060102T150405Z") + ".tar"
+	if err := o.store.PutObject(ctx, snapshotKey, snapshot.Bytes(), "application/x-tar"); err != nil {
+		return 0, 0, err
+	}
+	documents := 0
+	for _, count := range header.Counts {
+		documents += count
+	}
+
+	changed := map[string]interface{}{}
+	if !manifest.StartedAt.IsZero() {
+		changed["updatedAt"] = map[string]interface{}{"$gte": manifest.StartedAt}
+	}
+	tracks, err := handler.GetTracks(ctx, changed)
+	if err != nil {
+		return documents, 0, err
+	}
+	files := 0
+	for _, id := range library.BackupFiles(tracks, true, true) {
+		key := prefix + "audio/" + id.Hex()
+		if exists, err := o.store.ObjectExists(ctx, key); err != nil {
+			return documents, files, err
+		} else if exists {
+			continue
+		}
+
+		audio, err := handler.DownloadAudioFile(ctx, id)
+		if errors.Is(err, dao.ErrNotFound) {
+			logrus.WithField("file", id.Hex()).Warn("Audio file missing from store, leaving it out of the off-site backup")
+			continue
+		} else if err != nil {
+			return documents, files, err
+		}
+		if err := o.store.PutObject(ctx, key, audio, "application/octet-stream"); err != nil {
+			return documents, files, err
+		}
+		files++
+	}
+
+	body, err = json.Marshal(offsiteManifest{StartedAt: startedAt, Snapshot: snapshotKey})
+	if err != nil {
+		return documents, files, err
+	}
+	return documents, files, o.store.PutObject(ctx, prefix+"latest.json", body, "application/json")
+}
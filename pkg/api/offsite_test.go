@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryObjectStore is an ObjectStore keeping objects in a map.
+type memoryObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	err     error
+}
+
+func (s *memoryObjectStore) PutObject(ctx context.Context, key string, body []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.objects[key] = body
+	return nil
+}
+
+func (s *memoryObjectStore) GetObject(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.objects[key]
+	if !ok {
+		return nil, service.ErrObjectNotFound
+	}
+	return body, nil
+}
+
+func (s *memoryObjectStore) ObjectExists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[key]
+	return ok, nil
+}
+
+func (s *memoryObjectStore) keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestApi_OffsiteBackup_ShouldPushChangesAndEachFileOnce(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := library.StoreTrack(ctx, handler, models.Track{Name: "test"}, testAudio)
+	require.Nil(t, err)
+
+	store := &memoryObjectStore{objects: make(map[string][]byte)}
+	offsite := &offsiteBackup{store: store, bucket: "backups", prefix: "music"}
+	run := offsite.run(handler, nil, importLocks{})
+
+	require.Nil(t, run(ctx))
+	require.Equal(t, []string{"music/audio/" + track.AudioFileID.Hex()}, store.keys("music/audio/"))
+	require.Len(t, store.keys("music/snapshots/"), 1)
+	var manifest offsiteManifest
+	require.Nil(t, json.Unmarshal(store.objects["music/latest.json"], &manifest))
+	require.Equal(t, "music/snapshots/", manifest.Snapshot[:len("music/snapshots/")])
+
+	status := offsite.get()
+	require.Equal(t, "backups", status.Bucket)
+	require.NotNil(t, status.LastSuccessAt)
+	require.Equal(t, 1, status.Files)
+	require.Equal(t, 1, status.Documents)
+
+	// A track added since is all the next run uploads.
+	added, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "added"}, testAudio)
+	require.Nil(t, err)
+	require.Nil(t, run(ctx))
+	require.Len(t, store.keys("music/audio/"), 2)
+	require.Contains(t, store.objects, "music/audio/"+added.AudioFileID.Hex())
+	require.Equal(t, 1, offsite.get().Files)
+}
+
+func TestApi_OffsiteBackup_ShouldRecordFailure(t *testing.T) {
+	store := &memoryObjectStore{objects: make(map[string][]byte), err: errors.New("access denied")}
+	offsite := &offsiteBackup{store: store, bucket: "backups"}
+
+	require.NotNil(t, offsite.run(dao.NewMemoryHandler(), nil, importLocks{})(context.Background()))
+	status := offsite.get()
+	require.Equal(t, "access denied", status.LastError)
+	require.NotNil(t, status.LastRunAt)
+	require.Nil(t, status.LastSuccessAt)
+}
+
+func TestApi_OffsiteBackup_ShouldReportNothingIfNotConfigured(t *testing.T) {
+	var offsite *offsiteBackup
+	require.Nil(t, offsite.get())
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/scheduler"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// listOrphans reports the stored audio files that no track references and that are old enough to purge, such as those
+// left behind by failed uploads or by a delete that removed the track but not its audio.
+func listOrphans(handler dao.DbHandler, adminToken string, minAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		orphans, err := library.PurgeOrphans(ctx, handler, true, minAge)
+		if err != nil {
+			logrus.WithError(err).Error("Error finding orphaned audio files")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, orphanReport(orphans, false))
+		return
+	}
+}
+
+// purgeOrphans deletes the orphaned audio files listOrphans reports. A dry run only lists them.
+func purgeOrphans(handler dao.DbHandler, adminToken string, minAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		var request models.OrphanPurgeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		orphans, err := library.PurgeOrphans(ctx, handler, request.DryRun, minAge)
+		if err != nil {
+			logrus.WithError(err).Error("Error purging orphaned audio files")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, orphanReport(orphans, !request.DryRun))
+		return
+	}
+}
+
+func orphanReport(orphans []primitive.ObjectID, deleted bool) models.OrphanReport {
+	if orphans == nil {
+		orphans = []primitive.ObjectID{}
+	}
+	return models.OrphanReport{Files: orphans, Deleted: deleted}
+}
+
+// purgeAllOrphans is the scheduled task purging the orphaned audio files of every tenant. The tenant's lock keeps
+// replicas from purging it at the same time.
+func purgeAllOrphans(handler dao.DbHandler, tenants tenantLister, minAge time.Duration, locks importLocks) scheduler.Func {
+	return func(ctx context.Context) error {
+		contexts, err := tenantContexts(ctx, tenants)
+		if err != nil {
+			return err
+		}
+
+		var failed error
+		for _, tenantCtx := range contexts {
+			unlock, err := locks.acquire(tenantCtx, "orphans", "purge")
+			if errors.Is(err, service.ErrLocked) {
+				continue
+			} else if err != nil {
+				logrus.WithError(err).Error("Error acquiring orphan cleanup lock")
+				failed = err
+				continue
+			}
+
+			orphans, err := library.PurgeOrphans(tenantCtx, handler, false, minAge)
+			unlock()
+			if err != nil {
+				logrus.WithError(err).Error("Error purging orphaned audio files")
+				failed = err
+			} else if len(orphans) > 0 {
+				logrus.WithFields(logrus.Fields{"tenant": dao.TenantFromContext(tenantCtx), "files": len(orphans)}).
+					Info("Purged orphaned audio files")
+			}
+		}
+		return failed
+	}
+}
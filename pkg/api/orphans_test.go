@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func orphanedHandler(t *testing.T) (dao.DbHandler, primitive.ObjectID) {
+	handler := dao.NewMemoryHandler()
+	id, err := handler.UploadAudioFile(context.Background(), testAudio, "test")
+	require.Nil(t, err)
+	return handler, id.(primitive.ObjectID)
+}
+
+func TestApi_ListOrphans_ShouldRequireAdminToken(t *testing.T) {
+	handler, _ := orphanedHandler(t)
+	req, err := http.NewRequest(http.MethodGet, "/admin/orphans", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer wrong")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(listOrphans(handler, "secret", 0)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestApi_PurgeOrphans_ShouldOnlyListOnDryRun(t *testing.T) {
+	handler, id := orphanedHandler(t)
+	body, err := json.Marshal(models.OrphanPurgeRequest{DryRun: true})
+	require.Nil(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/admin/orphans/purge", bytes.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(purgeOrphans(handler, "secret", 0)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var report models.OrphanReport
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&report))
+	require.Equal(t, models.OrphanReport{Files: []primitive.ObjectID{id}, Deleted: false}, report)
+
+	_, err = handler.DownloadAudioFile(context.Background(), id)
+	require.Nil(t, err)
+}
+
+func TestApi_PurgeOrphans_ShouldDeleteOrphanedFiles(t *testing.T) {
+	handler, id := orphanedHandler(t)
+	req, err := http.NewRequest(http.MethodPost, "/admin/orphans/purge", http.NoBody)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(purgeOrphans(handler, "secret", 0)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var report models.OrphanReport
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&report))
+	require.Equal(t, models.OrphanReport{Files: []primitive.ObjectID{id}, Deleted: true}, report)
+
+	_, err = handler.DownloadAudioFile(context.Background(), id)
+	require.True(t, errors.Is(err, dao.ErrNotFound))
+}
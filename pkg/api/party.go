@@ -0,0 +1,425 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// partyClientBuffer is how many messages a client may fall behind by before it is disconnected, as a client that
+	// has missed a change would play out of step.
+	partyClientBuffer = 16
+	partyWriteTimeout = 10 * time.Second
+	partyPingInterval = 30 * time.Second
+)
+
+var partyUpgrader = websocket.Upgrader{
+	// Clients authenticate with a token rather than cookies, so a connection from another origin cannot ride on a
+	// user's session, in the same way as the CORS policy allows any origin.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// partySessions holds the group listening sessions of this replica. Sessions are kept in memory, so the clients of a
+// session must reach the replica that created it, as through sticky routing, and sessions end when it restarts. A
+// session nobody has been connected to for idle is dropped.
+type partySessions struct {
+	idle time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*partySession
+}
+
+type partySession struct {
+	tenant     string
+	state      models.PartySession
+	clients    map[*partyClient]struct{}
+	lastActive time.Time
+}
+
+type partyClient struct {
+	user     string
+	messages chan models.PartyMessage
+}
+
+func newPartySessions(idle time.Duration) *partySessions {
+	return &partySessions{idle: idle, sessions: make(map[string]*partySession)}
+}
+
+// find returns the session with the ID in the request's path, if it belongs to the caller's tenant. The caller must
+// hold the lock.
+func (p *partySessions) find(r *http.Request) (*partySession, bool) {
+	now := time.Now()
+	for id, session := range p.sessions {
+		if len(session.clients) == 0 && now.Sub(session.lastActive) > p.idle {
+			delete(p.sessions, id)
+		}
+	}
+
+	session, ok := p.sessions[mux.Vars(r)["id"]]
+	if !ok || session.tenant != dao.TenantFromContext(r.Context()) {
+		return nil, false
+	}
+	return session, true
+}
+
+// broadcast sends a message to every client of the session. The caller must hold the lock.
+func (s *partySession) broadcast(message models.PartyMessage) {
+	for client := range s.clients {
+		s.send(client, message)
+	}
+}
+
+// send sends a message to one client of the session, disconnecting it if it is too far behind to take it. The caller
+// must hold the lock.
+func (s *partySession) send(client *partyClient, message models.PartyMessage) {
+	select {
+	case client.messages <- message:
+	default:
+		logrus.WithFields(logrus.Fields{"session": s.state.ID, "user": client.user}).Warn("Disconnecting slow party client")
+		s.disconnect(client)
+	}
+}
+
+// disconnect ends the messages to a client, which closes its connection once those already sent are written. The
+// caller must hold the lock.
+func (s *partySession) disconnect(client *partyClient) {
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		close(client.messages)
+	}
+}
+
+// snapshot returns the session's state as it is now, with its position brought up to date if it is playing.
+func (s *partySession) snapshot(now time.Time) models.PartySession {
+	state := s.state
+	if state.Playing {
+		state.Position += now.Sub(state.UpdatedAt).Seconds()
+		state.UpdatedAt = now
+	}
+	state.Tracks = append([]primitive.ObjectID(nil), state.Tracks...)
+	state.Listeners = append([]string{}, state.Listeners...)
+	return state
+}
+
+func (s *partySession) stateMessage(now time.Time) models.PartyMessage {
+	state := s.snapshot(now)
+	return models.PartyMessage{Type: "state", Session: &state, ServerTime: now}
+}
+
+func (s *partySession) isListener(user string) bool {
+	if user == s.state.Host {
+		return true
+	}
+	for _, listener := range s.state.Listeners {
+		if listener == user {
+			return true
+		}
+	}
+	return false
+}
+
+// apply carries out a command from the host.
+func (s *partySession) apply(command models.PartyCommand, now time.Time) error {
+	state := s.snapshot(now)
+	switch command.Action {
+	case "play":
+		state.Playing = true
+	case "pause":
+		state.Playing = false
+	case "seek":
+		if command.Position < 0 {
+			return errors.New("position cannot be negative")
+		}
+		state.Position = command.Position
+	case "next", "previous":
+		index := state.Index + 1
+		if command.Action == "previous" {
+			index = state.Index - 1
+		}
+		if index < 0 || index >= len(state.Tracks) {
+			return fmt.Errorf("there is no %v track", command.Action)
+		}
+		state.Index, state.Track, state.Position = index, state.Tracks[index], 0
+	default:
+		return fmt.Errorf("unknown action %q", command.Action)
+	}
+	state.UpdatedAt = now
+	s.state = state
+	return nil
+}
+
+// partyUser returns the user making the request, writing an error response if there is none, as a session needs to
+// know who is hosting and listening.
+func partyUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := dao.UserFromContext(r.Context())
+	if user == "" {
+		respondWithError(w, http.StatusForbidden, "Party sessions are only open to signed-in users")
+		return "", false
+	}
+	return user, true
+}
+
+// createPartySession starts a group listening session of a playlist, hosted by the caller, paused at the start of its
+// first track.
+func createPartySession(handler dao.DbHandler, parties *partySessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		user, ok := partyUser(w, r)
+		if !ok {
+			return
+		}
+
+		var request models.PartySessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": request.Playlist})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+		if len(playlists[0].Tracks) == 0 {
+			respondWithError(w, http.StatusUnprocessableEntity, "Playlist has no tracks")
+			return
+		}
+
+		now := time.Now()
+		session := &partySession{
+			tenant: dao.TenantFromContext(ctx),
+			state: models.PartySession{
+				ID:        primitive.NewObjectID().Hex(),
+				Host:      user,
+				Playlist:  request.Playlist,
+				Tracks:    playlists[0].Tracks,
+				Track:     playlists[0].Tracks[0],
+				Listeners: []string{},
+				UpdatedAt: now,
+			},
+			clients:    make(map[*partyClient]struct{}),
+			lastActive: now,
+		}
+
+		parties.mu.Lock()
+		parties.sessions[session.state.ID] = session
+		state := session.snapshot(now)
+		parties.mu.Unlock()
+
+		respondWithSuccess(w, http.StatusCreated, state)
+		return
+	}
+}
+
+// getPartySession reports the state of a session.
+func getPartySession(parties *partySessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		parties.mu.Lock()
+		defer parties.mu.Unlock()
+		session, ok := parties.find(r)
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Party session not found")
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, session.snapshot(time.Now()))
+		return
+	}
+}
+
+// joinPartySession adds the caller to a session's listeners, who may then connect to its WebSocket.
+func joinPartySession(parties *partySessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		user, ok := partyUser(w, r)
+		if !ok {
+			return
+		}
+
+		parties.mu.Lock()
+		defer parties.mu.Unlock()
+		session, ok := parties.find(r)
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Party session not found")
+			return
+		}
+
+		now := time.Now()
+		if !session.isListener(user) {
+			session.state.Listeners = append(session.state.Listeners, user)
+			session.broadcast(session.stateMessage(now))
+		}
+		session.lastActive = now
+
+		respondWithSuccess(w, http.StatusOK, session.snapshot(now))
+		return
+	}
+}
+
+// endPartySession ends a session, disconnecting its clients. Only the host can end it.
+func endPartySession(parties *partySessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		user, ok := partyUser(w, r)
+		if !ok {
+			return
+		}
+
+		parties.mu.Lock()
+		defer parties.mu.Unlock()
+		session, ok := parties.find(r)
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Party session not found")
+			return
+		}
+		if session.state.Host != user {
+			respondWithError(w, http.StatusForbidden, "Only the host can end a party session")
+			return
+		}
+
+		session.broadcast(models.PartyMessage{Type: "ended", ServerTime: time.Now()})
+		for client := range session.clients {
+			session.disconnect(client)
+		}
+		delete(parties.sessions, session.state.ID)
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+// partySocket connects the host or a listener to a session over a WebSocket. The session's state is sent on connecting
+// and again whenever it changes. The host sends commands over the socket to control playback for everyone; commands
+// from listeners are refused.
+func partySocket(parties *partySessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		user, ok := partyUser(w, r)
+		if !ok {
+			return
+		}
+
+		parties.mu.Lock()
+		session, ok := parties.find(r)
+		if !ok {
+			parties.mu.Unlock()
+			respondWithError(w, http.StatusNotFound, "Party session not found")
+			return
+		}
+		if !session.isListener(user) {
+			parties.mu.Unlock()
+			respondWithError(w, http.StatusForbidden, "Join the party session before connecting to it")
+			return
+		}
+		parties.mu.Unlock()
+
+		conn, err := partyUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already responded.
+			logrus.WithError(err).Error("Error upgrading party connection")
+			return
+		}
+		defer conn.Close()
+		// The server's timeouts are for requests, not for a connection that stays open.
+		conn.SetReadDeadline(time.Time{})
+
+		client := &partyClient{user: user, messages: make(chan models.PartyMessage, partyClientBuffer)}
+		parties.mu.Lock()
+		if _, ok := parties.sessions[session.state.ID]; !ok {
+			parties.mu.Unlock()
+			return
+		}
+		session.clients[client] = struct{}{}
+		session.lastActive = time.Now()
+		client.messages <- session.stateMessage(time.Now())
+		parties.mu.Unlock()
+
+		done := make(chan struct{})
+		go writePartyMessages(conn, client, done)
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+
+			parties.mu.Lock()
+			if _, connected := session.clients[client]; !connected {
+				parties.mu.Unlock()
+				break
+			}
+			now := time.Now()
+			session.lastActive = now
+
+			var command models.PartyCommand
+			if err := json.Unmarshal(data, &command); err != nil {
+				session.send(client, models.PartyMessage{Type: "error", Error: "Error decoding command", ServerTime: now})
+			} else if user != session.state.Host {
+				session.send(client, models.PartyMessage{Type: "error", Error: "Only the host can control playback", ServerTime: now})
+			} else if err := session.apply(command, now); err != nil {
+				session.send(client, models.PartyMessage{Type: "error", Error: err.Error(), ServerTime: now})
+			} else {
+				session.broadcast(session.stateMessage(now))
+			}
+			parties.mu.Unlock()
+		}
+
+		parties.mu.Lock()
+		session.disconnect(client)
+		session.lastActive = time.Now()
+		parties.mu.Unlock()
+		<-done
+	}
+}
+
+// writePartyMessages writes a client's messages to its connection until they are closed, pinging it in between so that
+// proxies keep an idle connection open. The connection is closed when writing fails or the messages end.
+func writePartyMessages(conn *websocket.Conn, client *partyClient, done chan<- struct{}) {
+	defer close(done)
+	defer conn.Close()
+
+	ticker := time.NewTicker(partyPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-client.messages:
+			conn.SetWriteDeadline(time.Now().Add(partyWriteTimeout))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(partyWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
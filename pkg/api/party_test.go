@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newPartyServer serves the party endpoints with the user taken from the X-User header.
+func newPartyServer(t *testing.T, handler dao.DbHandler) *httptest.Server {
+	parties := newPartySessions(time.Hour)
+	r := mux.NewRouter()
+	r.HandleFunc("/party", createPartySession(handler, parties)).Methods(http.MethodPost)
+	r.HandleFunc("/party/{id}", getPartySession(parties)).Methods(http.MethodGet)
+	r.HandleFunc("/party/{id}", endPartySession(parties)).Methods(http.MethodDelete)
+	r.HandleFunc("/party/{id}/join", joinPartySession(parties)).Methods(http.MethodPost)
+	r.HandleFunc("/party/{id}/ws", partySocket(parties)).Methods(http.MethodGet)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeHTTP(w, req.WithContext(dao.WithUser(req.Context(), req.Header.Get("X-User"))))
+	}))
+}
+
+func partyRequest(t *testing.T, server *httptest.Server, method string, path string, user string, body string) *http.Response {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("X-User", user)
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	return resp
+}
+
+func dialParty(t *testing.T, server *httptest.Server, id string, user string) *websocket.Conn {
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/party/"+id+"/ws", http.Header{"X-User": {user}})
+	require.Nil(t, err)
+	resp.Body.Close()
+	return conn
+}
+
+func readPartyMessage(t *testing.T, conn *websocket.Conn) models.PartyMessage {
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var message models.PartyMessage
+	require.Nil(t, conn.ReadJSON(&message))
+	return message
+}
+
+func TestApi_PartySession_ShouldKeepListenersInStepWithHost(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+	tracks := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	for _, id := range tracks {
+		require.Nil(t, handler.AddTrack(context.Background(), models.Track{ID: id, Name: "test"}))
+	}
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "party", Tracks: tracks}
+	require.Nil(t, handler.AddPlaylist(context.Background(), playlist))
+	server := newPartyServer(t, handler)
+	defer server.Close()
+
+	resp := partyRequest(t, server, http.MethodPost, "/party", "host", `{"playlist": "`+playlist.ID.Hex()+`"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var session models.PartySession
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&session))
+	resp.Body.Close()
+	require.Equal(t, "host", session.Host)
+	require.Equal(t, tracks[0], session.Track)
+	require.False(t, session.Playing)
+
+	// Only listeners who have joined can connect.
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/party/"+session.ID+"/ws", http.Header{"X-User": {"guest"}})
+	require.NotNil(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	host := dialParty(t, server, session.ID, "host")
+	defer host.Close()
+	require.Equal(t, "state", readPartyMessage(t, host).Type)
+
+	resp = partyRequest(t, server, http.MethodPost, "/party/"+session.ID+"/join", "guest", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	require.Equal(t, []string{"guest"}, readPartyMessage(t, host).Session.Listeners)
+
+	guest := dialParty(t, server, session.ID, "guest")
+	defer guest.Close()
+	require.Equal(t, "state", readPartyMessage(t, guest).Type)
+
+	require.Nil(t, host.WriteJSON(models.PartyCommand{Action: "seek", Position: 30}))
+	require.Nil(t, host.WriteJSON(models.PartyCommand{Action: "next"}))
+	readPartyMessage(t, guest)
+	message := readPartyMessage(t, guest)
+	require.Equal(t, "state", message.Type)
+	require.Equal(t, 1, message.Session.Index)
+	require.Equal(t, tracks[1], message.Session.Track)
+	require.Equal(t, 0.0, message.Session.Position)
+
+	require.Nil(t, guest.WriteJSON(models.PartyCommand{Action: "play"}))
+	message = readPartyMessage(t, guest)
+	require.Equal(t, "error", message.Type)
+	require.Equal(t, "Only the host can control playback", message.Error)
+
+	resp = partyRequest(t, server, http.MethodDelete, "/party/"+session.ID, "guest", "")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+	resp = partyRequest(t, server, http.MethodDelete, "/party/"+session.ID, "host", "")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp.Body.Close()
+	readPartyMessage(t, host)
+	readPartyMessage(t, host)
+	require.Equal(t, "ended", readPartyMessage(t, host).Type)
+	require.Equal(t, "ended", readPartyMessage(t, guest).Type)
+
+	resp = partyRequest(t, server, http.MethodGet, "/party/"+session.ID, "host", "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestApi_PartySession_ShouldTrackPositionWhilePlaying(t *testing.T) {
+	start := time.Now()
+	session := &partySession{state: models.PartySession{Tracks: []primitive.ObjectID{primitive.NewObjectID()}, UpdatedAt: start}}
+
+	require.Nil(t, session.apply(models.PartyCommand{Action: "play"}, start.Add(time.Minute)))
+	require.Equal(t, 0.0, session.state.Position)
+	require.Equal(t, 10.0, session.snapshot(start.Add(time.Minute+10*time.Second)).Position)
+
+	require.Nil(t, session.apply(models.PartyCommand{Action: "pause"}, start.Add(time.Minute+20*time.Second)))
+	require.Equal(t, 20.0, session.snapshot(start.Add(time.Hour)).Position)
+
+	require.NotNil(t, session.apply(models.PartyCommand{Action: "next"}, start))
+	require.NotNil(t, session.apply(models.PartyCommand{Action: "seek", Position: -1}, start))
+	require.NotNil(t, session.apply(models.PartyCommand{Action: "rewind"}, start))
+}
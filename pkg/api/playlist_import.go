@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// importPlaylist creates a playlist from a public playlist on another service, made of the tracks of the library that
+// match its entries by title and artist. Entries nothing matched are returned with the playlist, for the client to
+// find and add by hand. A nil provider means the service is not configured.
+func importPlaylist(handler dao.DbHandler, provider service.PlaylistProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if provider == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "Playlist imports from this service are not configured")
+			return
+		}
+
+		var request models.PlaylistImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+		if strings.TrimSpace(request.URL) == "" {
+			respondWithFieldError(w, "url", "url is required")
+			return
+		}
+
+		external, err := provider.GetPlaylist(ctx, request.URL)
+		if errors.Is(err, service.ErrInvalidPlaylistURL) {
+			respondWithFieldError(w, "url", err.Error())
+			return
+		} else if errors.Is(err, service.ErrPlaylistNotFound) {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error fetching playlist to import")
+			respondWithError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"podcastId": bson.M{"$exists": false}})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+		matched, unmatched := library.MatchTracks(tracks, external.Tracks)
+
+		now := time.Now()
+		playlist := models.Playlist{
+			ID:        primitive.NewObjectID(),
+			Name:      strings.TrimSpace(request.Name),
+			CreatedBy: dao.UserFromContext(ctx),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if playlist.Name == "" {
+			playlist.Name = external.Name
+		}
+		for _, track := range matched {
+			playlist.Tracks = append(playlist.Tracks, track.ID)
+		}
+
+		if err := handler.AddPlaylist(ctx, playlist); err != nil {
+			logrus.WithError(err).Error("Error creating playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{"playlist": playlist.ID.Hex(), "matched": len(matched), "unmatched": len(unmatched)}).
+			Info("Imported playlist")
+		respondWithSuccess(w, http.StatusCreated, models.PlaylistImport{Playlist: playlist, Matched: len(matched), Unmatched: unmatched})
+		return
+	}
+}
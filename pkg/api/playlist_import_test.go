@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type staticPlaylists map[string]*models.ExternalPlaylist
+
+func (p staticPlaylists) GetPlaylist(ctx context.Context, playlistURL string) (*models.ExternalPlaylist, error) {
+	if !strings.HasPrefix(playlistURL, "https://open.spotify.com/playlist/") {
+		return nil, service.ErrInvalidPlaylistURL
+	}
+	playlist, ok := p[playlistURL]
+	if !ok {
+		return nil, service.ErrPlaylistNotFound
+	}
+	return playlist, nil
+}
+
+func importPlaylistRequest(t *testing.T, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "/playlist/import/spotify", strings.NewReader(body))
+	require.Nil(t, err)
+	return req
+}
+
+func TestApi_ImportPlaylist_ShouldCreatePlaylistOfMatchedTracksAndReturnUnmatched(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song", Artist: "Band"}
+	require.Nil(t, handler.AddTrack(ctx, track))
+	missing := models.ExternalTrack{Position: 2, Name: "Other", Artists: []string{"Band"}}
+	provider := staticPlaylists{"https://open.spotify.com/playlist/1": {
+		Name:   "Mix",
+		Tracks: []models.ExternalTrack{{Position: 1, Name: "Song (Live)", Artists: []string{"The Band"}}, missing},
+	}}
+
+	recorder := httptest.NewRecorder()
+	importPlaylist(handler, provider).ServeHTTP(recorder, importPlaylistRequest(t, `{"url": "https://open.spotify.com/playlist/1"}`))
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var result models.PlaylistImport
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	require.Equal(t, "Mix", result.Playlist.Name)
+	require.Equal(t, []primitive.ObjectID{track.ID}, result.Playlist.Tracks)
+	require.Equal(t, 1, result.Matched)
+	require.Equal(t, []models.ExternalTrack{missing}, result.Unmatched)
+
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": result.Playlist.ID})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+}
+
+func TestApi_ImportPlaylist_ShouldReportBadURLsAndMissingPlaylists(t *testing.T) {
+	provider := staticPlaylists{}
+
+	recorder := httptest.NewRecorder()
+	importPlaylist(dao.NewMemoryHandler(), provider).ServeHTTP(recorder, importPlaylistRequest(t, `{"url": "https://example.com/1"}`))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	importPlaylist(dao.NewMemoryHandler(), provider).ServeHTTP(recorder, importPlaylistRequest(t, `{"url": "https://open.spotify.com/playlist/2"}`))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	importPlaylist(dao.NewMemoryHandler(), nil).ServeHTTP(recorder, importPlaylistRequest(t, `{"url": "https://open.spotify.com/playlist/2"}`))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxPlaylistBatch is the most tracks that can be added to a playlist in one request.
+	maxPlaylistBatch = 500
+	// defaultPlaylistPage and maxPlaylistPage are how many tracks of a playlist are returned at once by default and at
+	// most.
+	defaultPlaylistPage = 100
+	maxPlaylistPage     = 500
+)
+
+// getPlaylist returns a playlist with a page of its tracks filled in: ?limit= tracks, 100 by default, from ?offset=.
+// The total in the response tells clients how many pages there are, so very large playlists can be loaded as they are
+// scrolled through.
+func getPlaylist(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		offset, limit := 0, defaultPlaylistPage
+		if value := r.URL.Query().Get("offset"); value != "" {
+			if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+				respondWithFieldError(w, "offset", "offset must be a non-negative integer")
+				return
+			}
+		}
+		if value := r.URL.Query().Get("limit"); value != "" {
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxPlaylistPage {
+				respondWithFieldError(w, "limit", fmt.Sprintf("limit must be between 1 and %v", maxPlaylistPage))
+				return
+			}
+		}
+
+		page, err := handler.GetPlaylistPage(ctx, id, offset, limit)
+		if errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, page)
+		return
+	}
+}
+
+// addTracksToPlaylist appends several tracks to a playlist in the order given. Nothing is added unless every track
+// exists.
+func addTracksToPlaylist(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		revision, err := ifMatchRevision(r)
+		if err != nil {
+			respondWithFieldError(w, "If-Match", err.Error())
+			return
+		}
+
+		var request models.PlaylistTracksRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+		if len(request.Tracks) == 0 {
+			respondWithFieldError(w, "tracks", "At least one track is required")
+			return
+		} else if len(request.Tracks) > maxPlaylistBatch {
+			respondWithFieldError(w, "tracks", fmt.Sprintf("At most %v tracks can be added at once", maxPlaylistBatch))
+			return
+		}
+
+		found, err := handler.GetTracks(ctx, map[string]interface{}{"_id": bson.M{"$in": request.Tracks}})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+		if missing := missingTracks(request.Tracks, found); len(missing) > 0 {
+			respondWithError(w, http.StatusNotFound, "Tracks not found: "+strings.Join(missing, ", "))
+			return
+		}
+
+		update := bson.M{"$push": bson.M{"tracks": bson.M{"$each": request.Tracks}}}
+		if err := handler.UpdatePlaylist(ctx, id, update, revision); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		} else if errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Playlist has been changed since it was read")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error adding tracks to playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		setNextRevisionETag(w, revision)
+		respondWithSuccess(w, http.StatusOK, fmt.Sprintf("%v tracks added to playlist", len(request.Tracks)))
+		return
+	}
+}
+
+// movePlaylistTrack moves a track of a playlist to the given position, or inserts it there if the playlist does not
+// have it yet, for drag-and-drop reordering. If the track is in the playlist more than once, its first occurrence is
+// moved.
+func movePlaylistTrack(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		pid, err := primitive.ObjectIDFromHex(mux.Vars(r)["playlistid"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectId from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tid, err := primitive.ObjectIDFromHex(mux.Vars(r)["trackid"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectId from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		revision, err := ifMatchRevision(r)
+		if err != nil {
+			respondWithFieldError(w, "If-Match", err.Error())
+			return
+		}
+
+		var request models.PlaylistPositionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+		if request.Index == nil || *request.Index < 0 {
+			respondWithFieldError(w, "index", "index must be a non-negative integer")
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": tid})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		if err := handler.MovePlaylistTrack(ctx, pid, tid, *request.Index, revision); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		} else if errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Playlist has been changed since it was read")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error moving track in playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		setNextRevisionETag(w, revision)
+		respondWithSuccess(w, http.StatusOK, "Track successfully moved in playlist")
+		return
+	}
+}
+
+// missingTracks returns the hex IDs of the requested tracks that were not found, each once.
+func missingTracks(requested []primitive.ObjectID, found []models.Track) []string {
+	exists := make(map[primitive.ObjectID]bool, len(found))
+	for _, track := range found {
+		exists[track.ID] = true
+	}
+
+	var missing []string
+	for _, id := range requested {
+		if !exists[id] {
+			missing = append(missing, id.Hex())
+			exists[id] = true
+		}
+	}
+	return missing
+}
+
+// duplicatePlaylist copies a playlist, named after the original unless a new name is given, so it can be edited
+// without changing the original.
+func duplicatePlaylist(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var request models.DuplicatePlaylistRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+
+		now := time.Now()
+		duplicate := models.Playlist{
+			ID:        primitive.NewObjectID(),
+			Name:      strings.TrimSpace(request.Name),
+			Tracks:    playlists[0].Tracks,
+			CreatedBy: dao.UserFromContext(ctx),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if duplicate.Name == "" {
+			duplicate.Name = playlists[0].Name + " (copy)"
+		}
+
+		if err := handler.AddPlaylist(ctx, duplicate); err != nil {
+			logrus.WithError(err).Error("Error creating playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusCreated, duplicate)
+		return
+	}
+}
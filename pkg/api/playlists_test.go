@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testPlaylistID = "603ac4abd9ad8067f54a2778"
+	testTrackID    = "603ac4abd9ad8067f54a2779"
+	otherTrackID   = "603ac4abd9ad8067f54a277a"
+)
+
+func TestApi_AddTracksToPlaylist_ShouldReturn400IfNoTracksGiven(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/tracks", strings.NewReader(`{"tracks":[]}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTracksToPlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_AddTracksToPlaylist_ShouldReturn404NamingMissingTracks(t *testing.T) {
+	trackID, _ := primitive.ObjectIDFromHex(testTrackID)
+	playlistID, _ := primitive.ObjectIDFromHex(testPlaylistID)
+
+	dbHandler := dao.NewMemoryHandler()
+	require.Nil(t, dbHandler.AddTrack(context.Background(), models.Track{ID: trackID}))
+	require.Nil(t, dbHandler.AddPlaylist(context.Background(), models.Playlist{ID: playlistID}))
+
+	body := `{"tracks":["` + testTrackID + `","` + otherTrackID + `"]}`
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/tracks", strings.NewReader(body))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTracksToPlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), otherTrackID)
+
+	playlists, err := dbHandler.GetPlaylists(context.Background(), map[string]interface{}{"_id": playlistID})
+	require.Nil(t, err)
+	require.Empty(t, playlists[0].Tracks)
+}
+
+func TestApi_AddTracksToPlaylist_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
+	trackID, _ := primitive.ObjectIDFromHex(testTrackID)
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{ID: trackID}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(dao.ErrNotFound)
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/tracks", strings.NewReader(`{"tracks":["`+testTrackID+`"]}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTracksToPlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_AddTracksToPlaylist_ShouldAppendAllTracksInOneUpdate(t *testing.T) {
+	trackID, _ := primitive.ObjectIDFromHex(testTrackID)
+	otherID, _ := primitive.ObjectIDFromHex(otherTrackID)
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{ID: otherID}, {ID: trackID}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, bson.M{
+		"$push": bson.M{"tracks": bson.M{"$each": []primitive.ObjectID{trackID, otherID, trackID}}},
+	}, dao.AnyRevision).Return(nil)
+
+	body := `{"tracks":["` + testTrackID + `","` + otherTrackID + `","` + testTrackID + `"]}`
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/tracks", strings.NewReader(body))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTracksToPlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertNumberOfCalls(t, "UpdatePlaylist", 1)
+}
+
+func TestApi_MovePlaylistTrack_ShouldReturn400IfIndexIsMissingOrNegative(t *testing.T) {
+
+	for _, body := range []string{`{}`, `{"index":-1}`} {
+		req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistid}/track/{trackid}/position", strings.NewReader(body))
+		require.Nil(t, err)
+		req = mux.SetURLVars(req, map[string]string{"playlistid": testPlaylistID, "trackid": testTrackID})
+		req.Header.Set("Authorization", "Bearer test")
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(movePlaylistTrack(&mocks.DbHandler{})).ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestApi_MovePlaylistTrack_ShouldMoveTrackToIndex(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	first := models.Track{ID: primitive.NewObjectID(), Name: "first"}
+	second := models.Track{ID: primitive.NewObjectID(), Name: "second"}
+	require.Nil(t, handler.AddTrack(ctx, first))
+	require.Nil(t, handler.AddTrack(ctx, second))
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Tracks: []primitive.ObjectID{first.ID, second.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{playlistid}/track/{trackid}/position", strings.NewReader(`{"index":1}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"playlistid": playlist.ID.Hex(), "trackid": first.ID.Hex()})
+	req.Header.Set("Authorization", "Bearer test")
+	req.Header.Set("If-Match", `"0"`)
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(movePlaylistTrack(handler)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"1"`, recorder.Header().Get("ETag"))
+
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+	require.Nil(t, err)
+	require.Equal(t, []primitive.ObjectID{second.ID, first.ID}, playlists[0].Tracks)
+}
+
+func TestApi_GetPlaylist_ShouldReturnPageOfTracks(t *testing.T) {
+	playlistID, _ := primitive.ObjectIDFromHex(testPlaylistID)
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlaylistPage", mock.Anything, playlistID, 200, 50).
+		Return(models.PlaylistPage{ID: playlistID, Offset: 200, Total: 1000}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/playlist/{id}?offset=200&limit=50", http.NoBody)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getPlaylist(dbHandler)).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestApi_GetPlaylist_ShouldReturn400IfLimitIsTooLarge(t *testing.T) {
+
+	req, err := http.NewRequest(http.MethodGet, "/playlist/{id}?limit=5000", http.NoBody)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getPlaylist(&mocks.DbHandler{})).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetPlaylist_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
+
+	req, err := http.NewRequest(http.MethodGet, "/playlist/{id}", http.NoBody)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(getPlaylist(dao.NewMemoryHandler())).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_DuplicatePlaylist_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
+	dbHandler := dao.NewMemoryHandler()
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/duplicate", strings.NewReader(""))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testPlaylistID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(duplicatePlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_DuplicatePlaylist_ShouldCopyTracksUnderNewID(t *testing.T) {
+	track := models.Track{ID: primitive.NewObjectID()}
+	original := models.Playlist{ID: primitive.NewObjectID(), Name: "Road trip", Tracks: []primitive.ObjectID{track.ID}}
+
+	dbHandler := dao.NewMemoryHandler()
+	require.Nil(t, dbHandler.AddTrack(context.Background(), track))
+	require.Nil(t, dbHandler.AddPlaylist(context.Background(), original))
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/duplicate", strings.NewReader(""))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": original.ID.Hex()})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(duplicatePlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	playlists, err := dbHandler.GetPlaylists(context.Background(), map[string]interface{}{"name": "Road trip (copy)"})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+	require.NotEqual(t, original.ID, playlists[0].ID)
+	require.Equal(t, original.Tracks, playlists[0].Tracks)
+}
+
+func TestApi_DuplicatePlaylist_ShouldUseGivenName(t *testing.T) {
+	original := models.Playlist{ID: primitive.NewObjectID(), Name: "Road trip"}
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{original}, nil)
+	dbHandler.On("AddPlaylist", mock.Anything, mock.MatchedBy(func(playlist models.Playlist) bool {
+		return playlist.Name == "My road trip"
+	})).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/duplicate", strings.NewReader(`{"name":"My road trip"}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": original.ID.Hex()})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(duplicatePlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+}
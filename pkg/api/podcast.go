@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// subscribePodcast adds a podcast and starts syncing its episodes. The first sync takes the podcast's lock, as
+// pollPodcasts does, so the two never store the same episodes at once.
+func subscribePodcast(handler dao.DbHandler, feeds service.PodcastHandler, maxEpisodes int, locks importLocks) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		var podcast models.Podcast
+		if err := json.NewDecoder(r.Body).Decode(&podcast); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		}
+		if podcast.FeedURL == "" {
+			respondWithFieldError(w, "feedUrl", "feedUrl is required")
+			return
+		}
+
+		existing, err := handler.GetPodcasts(ctx, map[string]interface{}{"feedUrl": podcast.FeedURL})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving podcasts")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(existing) > 0 {
+			respondWithError(w, http.StatusConflict, "Already subscribed to this feed")
+			return
+		}
+
+		feed, err := feeds.FetchFeed(ctx, podcast.FeedURL)
+		if err != nil {
+			logrus.WithError(err).Error("Error fetching podcast feed")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		podcast.ID = primitive.NewObjectID()
+		podcast.Title = feed.Title
+
+		if err := handler.AddPodcast(ctx, podcast); err != nil {
+			logrus.WithError(err).Error("Error adding podcast to database")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		go func() {
+			ctx := dao.DetachTenant(ctx)
+			unlock, err := locks.acquire(ctx, "podcast", podcast.ID.Hex())
+			if errors.Is(err, service.ErrLocked) {
+				return
+			} else if err != nil {
+				logrus.WithError(err).WithField("podcast", podcast.Title).Error("Error acquiring podcast lock")
+				return
+			}
+			defer unlock()
+
+			if err := syncPodcast(ctx, handler, feeds, podcast, maxEpisodes); err != nil {
+				logrus.WithError(err).WithField("podcast", podcast.Title).Error("Error syncing podcast")
+			}
+		}()
+
+		respondWithSuccess(w, http.StatusCreated, podcast)
+		return
+	}
+}
+
+func getPodcasts(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		podcasts, err := handler.GetPodcasts(ctx, map[string]interface{}{})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving podcasts")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, podcasts)
+		return
+	}
+}
+
+func getPodcastEpisodes(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		episodes, err := handler.GetTracks(ctx, map[string]interface{}{"podcastId": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving podcast episodes")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, episodes)
+		return
+	}
+}
+
+func deletePodcast(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := handler.DeletePodcast(ctx, id); err != nil {
+			logrus.WithError(err).Error("Error deleting podcast")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, "Unsubscribed from podcast successfully")
+		return
+	}
+}
+
+// pollPodcasts checks every subscribed feed of every tenant for new episodes each interval until the context is
+// cancelled.
+func pollPodcasts(ctx context.Context, handler dao.DbHandler, feeds service.PodcastHandler, tenants tenantLister, interval time.Duration, maxEpisodes int, locks importLocks) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		contexts, err := tenantContexts(ctx, tenants)
+		if err != nil {
+			logrus.WithError(err).Error("Error listing tenants to poll")
+			continue
+		}
+
+		for _, tenantCtx := range contexts {
+			podcasts, err := handler.GetPodcasts(tenantCtx, map[string]interface{}{})
+			if err != nil {
+				logrus.WithError(err).Error("Error retrieving podcasts to poll")
+				continue
+			}
+
+			for _, podcast := range podcasts {
+				unlock, err := locks.acquire(tenantCtx, "podcast", podcast.ID.Hex())
+				if errors.Is(err, service.ErrLocked) {
+					continue
+				} else if err != nil {
+					logrus.WithError(err).WithField("podcast", podcast.Title).Error("Error acquiring podcast lock")
+					continue
+				}
+
+				if err := syncPodcast(tenantCtx, handler, feeds, podcast, maxEpisodes); err != nil {
+					logrus.WithError(err).WithField("podcast", podcast.Title).Error("Error syncing podcast")
+				}
+				unlock()
+			}
+		}
+	}
+}
+
+// syncPodcast downloads the newest maxEpisodes episodes of a podcast that are not yet in the library and stores them
+// as tracks tagged with the podcast.
+func syncPodcast(ctx context.Context, handler dao.DbHandler, feeds service.PodcastHandler, podcast models.Podcast, maxEpisodes int) error {
+	feed, err := feeds.FetchFeed(ctx, podcast.FeedURL)
+	if err != nil {
+		return err
+	}
+
+	episodes := feed.Episodes
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[i].PublishedAt.After(episodes[j].PublishedAt)
+	})
+	if maxEpisodes > 0 && len(episodes) > maxEpisodes {
+		episodes = episodes[:maxEpisodes]
+	}
+
+	for _, episode := range episodes {
+		existing, err := handler.GetTracks(ctx, map[string]interface{}{"podcastId": podcast.ID, "episodeGuid": episode.GUID})
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		audio, err := feeds.DownloadEpisode(ctx, episode.AudioURL)
+		if err != nil {
+			logrus.WithError(err).WithField("episode", episode.Title).Error("Error downloading podcast episode")
+			continue
+		}
+
+		track := models.Track{
+			ID:          primitive.NewObjectID(),
+			Name:        episode.Title,
+			Artist:      podcast.Title,
+			AlbumName:   podcast.Title,
+			Podcast:     podcast.Title,
+			PodcastID:   podcast.ID,
+			EpisodeGUID: episode.GUID,
+		}
+		library.ApplyDefaults(&track)
+
+		if _, err := library.StoreTrack(ctx, handler, track, audio); errors.Is(err, library.ErrNotAudio) {
+			logrus.WithError(err).WithField("episode", episode.Title).Error("Skipping podcast episode that is not audio")
+			continue
+		} else if err != nil {
+			return err
+		}
+		logrus.WithField("podcast", podcast.Title).WithField("episode", track.Name).Info("Downloaded podcast episode")
+	}
+
+	return handler.UpdatePodcast(ctx, podcast.ID, bson.M{"$set": bson.M{"title": feed.Title, "lastPolled": time.Now()}})
+}
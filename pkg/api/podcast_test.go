@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_SubscribePodcast_ShouldReturn400IfFeedURLIsMissing(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	feeds := &mocks.PodcastHandler{}
+
+	req, err := http.NewRequest(http.MethodPost, "/podcast", strings.NewReader("{}"))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(subscribePodcast(dbHandler, feeds, 5, importLocks{}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_SubscribePodcast_ShouldReturn409IfAlreadySubscribed(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	feeds := &mocks.PodcastHandler{}
+	dbHandler.On("GetPodcasts", mock.Anything, mock.Anything).Return([]models.Podcast{{}}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/podcast", strings.NewReader(`{"feedUrl":"http://test/feed"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(subscribePodcast(dbHandler, feeds, 5, importLocks{}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestApi_SubscribePodcast_ShouldReturn400IfFeedCannotBeFetched(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	feeds := &mocks.PodcastHandler{}
+	dbHandler.On("GetPodcasts", mock.Anything, mock.Anything).Return([]models.Podcast{}, nil)
+	feeds.On("FetchFeed", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodPost, "/podcast", strings.NewReader(`{"feedUrl":"http://test/feed"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(subscribePodcast(dbHandler, feeds, 5, importLocks{}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_SubscribePodcast_ShouldReturn500IfAddPodcastErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	feeds := &mocks.PodcastHandler{}
+	dbHandler.On("GetPodcasts", mock.Anything, mock.Anything).Return([]models.Podcast{}, nil)
+	dbHandler.On("AddPodcast", mock.Anything, mock.Anything).Return(errors.New("test"))
+	feeds.On("FetchFeed", mock.Anything, mock.Anything).Return(&models.PodcastFeed{Title: "Show"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/podcast", strings.NewReader(`{"feedUrl":"http://test/feed"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(subscribePodcast(dbHandler, feeds, 5, importLocks{}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_SubscribePodcast_ShouldReturn201AndSyncUnderPodcastLock(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	feeds := &mocks.PodcastHandler{}
+	locks := importLocks{locker: service.NewLocalCoordinator(), ttl: time.Minute}
+	syncing, release := make(chan struct{}), make(chan struct{})
+	dbHandler.On("GetPodcasts", mock.Anything, mock.Anything).Return([]models.Podcast{}, nil)
+	dbHandler.On("AddPodcast", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("UpdatePodcast", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	feeds.On("FetchFeed", mock.Anything, mock.Anything).Return(&models.PodcastFeed{Title: "Show"}, nil).Once()
+	feeds.On("FetchFeed", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(syncing)
+		<-release
+	}).Return(&models.PodcastFeed{Title: "Show"}, nil).Once()
+
+	req, err := http.NewRequest(http.MethodPost, "/podcast", strings.NewReader(`{"feedUrl":"http://test/feed"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(subscribePodcast(dbHandler, feeds, 5, locks))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var podcast models.Podcast
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &podcast))
+	<-syncing
+	_, err = locks.acquire(context.Background(), "podcast", podcast.ID.Hex())
+	require.Equal(t, service.ErrLocked, err)
+	close(release)
+
+	// The lock is released once the sync is done.
+	require.Eventually(t, func() bool {
+		unlock, err := locks.acquire(context.Background(), "podcast", podcast.ID.Hex())
+		if err != nil {
+			return false
+		}
+		unlock()
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestApi_GetPodcasts_ShouldReturn500IfGetPodcastsErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPodcasts", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodGet, "/podcasts", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getPodcasts(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_GetPodcasts_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPodcasts", mock.Anything, mock.Anything).Return([]models.Podcast{{}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/podcasts", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getPodcasts(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetPodcastEpisodes_ShouldReturn400IfUnableToCreateObjectIDFromGivenID(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/podcast/{id}/episodes", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getPodcastEpisodes(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetPodcastEpisodes_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/podcast/{id}/episodes", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getPodcastEpisodes(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_DeletePodcast_ShouldReturn500IfDeletePodcastErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("DeletePodcast", mock.Anything, mock.Anything).Return(errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodDelete, "/podcast/{id}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(deletePodcast(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_SyncPodcast_ShouldStoreOnlyNewEpisodesUpToLimit(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	feeds := &mocks.PodcastHandler{}
+	podcast := models.Podcast{ID: primitive.NewObjectID(), Title: "Show", FeedURL: "http://test/feed"}
+
+	feeds.On("FetchFeed", mock.Anything, mock.Anything).Return(&models.PodcastFeed{Title: "Show", Episodes: []models.PodcastEpisode{
+		{GUID: "old", PublishedAt: time.Unix(1, 0)},
+		{GUID: "existing", PublishedAt: time.Unix(3, 0)},
+		{GUID: "new", Title: "New", AudioURL: "http://cdn/new.mp3", PublishedAt: time.Unix(2, 0)},
+	}}, nil)
+	feeds.On("DownloadEpisode", mock.Anything, "http://cdn/new.mp3").Return(testAudio, nil)
+	dbHandler.On("GetTracks", mock.Anything, map[string]interface{}{"podcastId": podcast.ID, "episodeGuid": "existing"}).Return([]models.Track{{}}, nil)
+	dbHandler.On("GetTracks", mock.Anything, map[string]interface{}{"podcastId": podcast.ID, "episodeGuid": "new"}).Return([]models.Track{}, nil)
+	dbHandler.On("UploadAudioFile", mock.Anything, testAudio, "New").Return(primitive.NewObjectID(), nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.EpisodeGUID == "new" && track.Podcast == "Show" && track.PodcastID == podcast.ID
+	})).Return(nil)
+	dbHandler.On("UpdatePodcast", mock.Anything, podcast.ID, mock.Anything).Return(nil)
+
+	require.Nil(t, syncPodcast(context.Background(), dbHandler, feeds, podcast, 2))
+	dbHandler.AssertNumberOfCalls(t, "AddTrack", 1)
+}
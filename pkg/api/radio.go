@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// radioPCMArgs describe the raw audio each track is decoded to before it is fed to the radio's encoder, so that tracks
+// stored in different formats can follow one another in the one stream.
+var radioPCMArgs = []string{"-f", "s16le", "-ar", "44100", "-ac", "2"}
+
+// streamRadio serves a never-ending mp3 stream built from a playlist's tracks. Tracks are decoded one after another and
+// fed into a single ffmpeg process which encodes them at real-time speed, so clients see one continuous stream. Since
+// simple players cannot set headers, the auth token may also be given as a "token" query parameter.
+func streamRadio(handler dao.DbHandler, ffmpeg string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		playlistID, err := primitive.ObjectIDFromHex(r.URL.Query().Get("playlist"))
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlistID})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+		if len(playlists[0].Tracks) == 0 {
+			respondWithError(w, http.StatusUnprocessableEntity, "Playlist has no tracks")
+			return
+		}
+
+		args := append([]string{"-hide_banner", "-loglevel", "error", "-re"}, radioPCMArgs...)
+		cmd := exec.CommandContext(ctx, ffmpeg, append(args, "-i", "pipe:0", "-vn", "-f", "mp3", "-b:a", "128k", "pipe:1")...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			logrus.WithError(err).Error("Error opening ffmpeg stdin")
+			respondWithStatusError(w, err)
+			return
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			logrus.WithError(err).Error("Error opening ffmpeg stdout")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		if err := cmd.Start(); err != nil {
+			logrus.WithError(err).Error("Error starting ffmpeg")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		shuffle := r.URL.Query().Get("shuffle") == "true"
+		go feedRadio(ctx, handler, ffmpeg, stdin, playlists[0].Tracks, shuffle)
+
+		// The stream never ends by itself, so it must not be cut off by the write deadline.
+		setWriteDeadline(ctx, time.Time{})
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		if err := copyAndFlush(w, stdout); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Error writing radio stream")
+		}
+
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Error running ffmpeg")
+		}
+	}
+}
+
+// feedRadio decodes the audio of each track to the encoder in turn, starting over once the playlist is exhausted. It
+// stops when the request ends or the encoder stops taking audio, or if a whole pass through the playlist yields no
+// playable audio.
+func feedRadio(ctx context.Context, handler dao.DbHandler, ffmpeg string, encoder io.WriteCloser, trackIDs []primitive.ObjectID, shuffle bool) {
+	defer func() {
+		if err := encoder.Close(); err != nil {
+			logrus.WithError(err).Error("Error closing ffmpeg stdin")
+		}
+	}()
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for ctx.Err() == nil {
+		played := 0
+		for _, id := range radioOrder(trackIDs, shuffle, random) {
+			tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+			if err != nil || len(tracks) == 0 {
+				logrus.WithError(err).WithField("track", id.Hex()).Warn("Skipping unavailable radio track")
+				continue
+			}
+
+			audio, err := handler.DownloadAudioFile(ctx, tracks[0].AudioFileID)
+			if err != nil {
+				logrus.WithError(err).WithField("track", id.Hex()).Warn("Skipping unavailable radio track")
+				continue
+			}
+
+			if err := decodeRadioTrack(ctx, ffmpeg, audio, encoder); errors.Is(err, errEncoderClosed) {
+				return
+			} else if err != nil {
+				logrus.WithError(err).WithField("track", id.Hex()).Warn("Skipping radio track that could not be decoded")
+				continue
+			}
+			played++
+		}
+
+		if played == 0 {
+			logrus.Error("No playable tracks in radio playlist, ending stream")
+			return
+		}
+	}
+}
+
+// errEncoderClosed is returned by decodeRadioTrack once the radio's encoder no longer takes audio.
+var errEncoderClosed = errors.New("radio encoder closed")
+
+// decodeRadioTrack decodes a track's audio, whatever its format, to the raw audio of radioPCMArgs, writing it to the
+// encoder as it goes.
+func decodeRadioTrack(ctx context.Context, ffmpeg string, audio []byte, encoder io.Writer) error {
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-vn"}, radioPCMArgs...)
+	cmd := exec.CommandContext(ctx, ffmpeg, append(args, "pipe:1")...)
+	cmd.Stdin = bytes.NewReader(audio)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := stdout.Read(buf)
+		if n > 0 {
+			if _, err := encoder.Write(buf[:n]); err != nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return errEncoderClosed
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("error decoding track: %v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func radioOrder(trackIDs []primitive.ObjectID, shuffle bool, random *rand.Rand) []primitive.ObjectID {
+	order := make([]primitive.ObjectID, len(trackIDs))
+	copy(order, trackIDs)
+	if shuffle {
+		random.Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+	return order
+}
+
+func copyAndFlush(w http.ResponseWriter, r io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
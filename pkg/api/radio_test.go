@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_StreamRadio_ShouldReturn400IfPlaylistIDIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/radio?playlist=test", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(streamRadio(dbHandler, "ffmpeg"))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_StreamRadio_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/radio?playlist=603ac4abd9ad8067f54a2778", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(streamRadio(dbHandler, "ffmpeg"))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_StreamRadio_ShouldReturn422IfPlaylistHasNoTracks(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{{}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/radio?playlist=603ac4abd9ad8067f54a2778", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(streamRadio(dbHandler, "ffmpeg"))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func TestApi_RadioOrder_ShouldKeepOrderUnlessShuffling(t *testing.T) {
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	random := rand.New(rand.NewSource(1))
+
+	require.Equal(t, ids, radioOrder(ids, false, random))
+
+	shuffled := radioOrder(ids, true, random)
+	require.ElementsMatch(t, ids, shuffled)
+	require.Len(t, ids, 3)
+}
+
+func TestApi_StreamRadio_ShouldStreamPastWriteDeadline(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "test"}, testAudio)
+	require.Nil(t, err)
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "radio", Tracks: []primitive.ObjectID{track.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+	ffmpeg := stubFFmpeg(t, `for i in 1 2 3 4 5; do echo chunk; sleep 0.1; done`)
+
+	server := httptest.NewUnstartedServer(limitWrites(100*time.Millisecond, streamRadio(handler, ffmpeg)))
+	server.Config.ConnContext = rememberConn
+	server.Start()
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/radio?playlist=" + playlist.ID.Hex())
+	require.Nil(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	body, err := ioutil.ReadAll(response.Body)
+	require.Nil(t, err)
+	require.Equal(t, strings.Repeat("chunk\n", 5), string(body))
+}
+
+func TestApi_StreamRadio_ShouldDecodeEachTrackBeforeEncoding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := dao.NewMemoryHandler()
+	mp3, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "mp3"}, testAudio)
+	require.Nil(t, err)
+	flac, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "flac"}, []byte("fLaC\x00\x00\x00\x22"))
+	require.Nil(t, err)
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "radio", Tracks: []primitive.ObjectID{mp3.ID, flac.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+	// The encoder, run at real-time speed, passes on what it is fed; each decoder marks the track it decoded.
+	ffmpeg := stubFFmpeg(t, `case "$*" in *-re*) exec cat ;; *) printf '['; head -c 4; printf ']' ;; esac`)
+
+	server := httptest.NewServer(streamRadio(handler, ffmpeg))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/radio?playlist="+playlist.ID.Hex(), nil)
+	require.Nil(t, err)
+	response, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	body := make([]byte, len("[ID3\x04][fLaC]"))
+	_, err = io.ReadFull(response.Body, body)
+	require.Nil(t, err)
+	require.Equal(t, "[ID3\x04][fLaC]", string(body))
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rateLimiter allows each client limit requests per fixed window, answering 429 past that. Windows are aligned to the
+// clock and counted in a shared RateCounter, so replicas sharing Redis enforce one limit between them. Clients are
+// told apart by their bearer token, or by address for requests without one. Requests are let through if the counter
+// cannot be reached. roleLimits sets the limit of each token role, recorded by tokenRoles.middleware, with a limit of
+// zero leaving that role unlimited; limit applies to requests whose role is not known. Requests made with an API key
+// are limited by limitAPIKeys once authentication has looked up the key's role, rather than looking it up twice.
+type rateLimiter struct {
+	counter    service.RateCounter
+	limit      int
+	roleLimits map[string]int
+	window     time.Duration
+	now        func() time.Time
+}
+
+func (l rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || r.URL.Path == "/ready" || madeWithAPIKey(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l.serve(w, r, next.ServeHTTP)
+	})
+}
+
+// limitAPIKeys rate limits the requests to next made with an API key, by the role authentication recorded for the key.
+// Other requests have already been limited by middleware.
+func (l rateLimiter) limitAPIKeys(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !madeWithAPIKey(r) {
+			next(w, r)
+			return
+		}
+		l.serve(w, r, next)
+	}
+}
+
+func madeWithAPIKey(r *http.Request) bool {
+	token, err := getAuthToken(r)
+	return err == nil && service.IsAPIKey(token)
+}
+
+// serve counts the request against its client's limit, calling next unless the limit is exceeded.
+func (l rateLimiter) serve(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	limit := l.limit
+	if roleLimit, ok := l.roleLimits[roleFromContext(r.Context())]; ok {
+		limit = roleLimit
+	}
+	if limit <= 0 {
+		next(w, r)
+		return
+	}
+
+	now := time.Now
+	if l.now != nil {
+		now = l.now
+	}
+	window := now().UnixNano() / int64(l.window)
+	reset := time.Unix(0, (window+1)*int64(l.window))
+
+	key := fmt.Sprintf("ratelimit:%v:%v", rateLimitClient(r), window)
+	hits, err := l.counter.Increment(r.Context(), key, l.window)
+	if err != nil {
+		logrus.WithError(err).Warn("Error counting request for rate limit")
+		next(w, r)
+		return
+	}
+
+	remaining := int64(limit) - hits
+	if remaining < 0 {
+		remaining = 0
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+	if hits > int64(limit) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now()).Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+		return
+	}
+
+	next(w, r)
+}
+
+// rateLimitClient identifies the client making a request without keeping its token in the counter's keys.
+func rateLimitClient(r *http.Request) string {
+	if token, err := getAuthToken(r); err == nil {
+		hash := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(hash[:16])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type failingCounter struct{}
+
+func (failingCounter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return 0, errors.New("test")
+}
+
+func rateLimitedRouter(limiter rateLimiter) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(limiter.middleware)
+	router.HandleFunc("/tracks", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return router
+}
+
+func TestApi_RateLimiter_ShouldReturn429OnceClientExceedsLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+	router := rateLimitedRouter(rateLimiter{
+		counter: service.NewLocalCoordinator(),
+		limit:   2,
+		window:  time.Minute,
+		now:     func() time.Time { return now },
+	})
+
+	codes := make([]int, 3)
+	for i := range codes {
+		req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+		require.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer test")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		codes[i] = recorder.Code
+		if recorder.Code == http.StatusTooManyRequests {
+			require.Equal(t, "21", recorder.Header().Get("Retry-After"))
+			require.Equal(t, "0", recorder.Header().Get("X-RateLimit-Remaining"))
+		}
+	}
+	require.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestApi_RateLimiter_ShouldCountClientsSeparately(t *testing.T) {
+	router := rateLimitedRouter(rateLimiter{counter: service.NewLocalCoordinator(), limit: 1, window: time.Minute})
+
+	for _, token := range []string{"one", "two"} {
+		req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+		require.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+	}
+}
+
+func TestApi_RateLimiter_ShouldAllowRequestsIfCounterErrors(t *testing.T) {
+	router := rateLimitedRouter(rateLimiter{counter: failingCounter{}, limit: 1, window: time.Minute})
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_RateLimiter_ShouldApplyLimitOfTokenRole(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(tokenRoles{adminToken: "admin"}.middleware)
+	router.Use(rateLimiter{
+		counter:    service.NewLocalCoordinator(),
+		limit:      1,
+		roleLimits: map[string]int{models.RoleAdmin: 3, models.RoleListener: 1},
+		window:     time.Minute,
+	}.middleware)
+	router.HandleFunc("/tracks", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for token, expected := range map[string][]int{
+		"admin":    {http.StatusOK, http.StatusOK, http.StatusOK},
+		"listener": {http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests},
+	} {
+		codes := make([]int, 3)
+		for i := range codes {
+			req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+			require.Nil(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			codes[i] = recorder.Code
+		}
+		require.Equal(t, expected, codes, token)
+	}
+}
+
+func TestApi_RateLimiter_ShouldLimitAPIKeyByItsRoleOnceAuthenticated(t *testing.T) {
+	key, hash, err := service.GenerateAPIKey()
+	require.Nil(t, err)
+	keys := &mocks.DbHandler{}
+	keys.On("GetAPIKeys", mock.Anything, map[string]interface{}{"keyHash": hash}).
+		Return([]models.APIKey{{ID: primitive.NewObjectID(), Name: "sync", KeyHash: hash, Role: models.RoleUploader}}, nil)
+
+	limiter := &rateLimiter{
+		counter:    service.NewLocalCoordinator(),
+		limit:      1,
+		roleLimits: map[string]int{models.RoleUploader: 2, models.RoleListener: 1},
+		window:     time.Minute,
+	}
+	router := mux.NewRouter()
+	router.Use(tokenRoles{adminToken: "admin"}.middleware)
+	router.Use(limiter.middleware)
+	authn := authenticator{ext: &service.APIKeyHandler{Keys: keys}, limiter: limiter}
+	router.HandleFunc("/tracks", authn.wrap(authUser, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 3)
+	for i := range codes {
+		req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+		require.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		codes[i] = recorder.Code
+	}
+	require.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+	keys.AssertNumberOfCalls(t, "GetAPIKeys", 3)
+}
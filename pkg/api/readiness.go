@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// startupGate holds the API back until the database has been reached and brought up to date, so that a replica can
+// start before its database does instead of exiting. Once open it stays open; losing the database later is reported
+// by /health, and the driver reconnects by itself.
+type startupGate struct {
+	once  sync.Once
+	ready chan struct{}
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+func newStartupGate() *startupGate {
+	return &startupGate{ready: make(chan struct{})}
+}
+
+// open calls prepare until it succeeds, waiting backoff after the first failure and doubling the wait after each
+// further one up to maxBackoff, then lets requests through. A nil prepare opens the gate straight away.
+func (g *startupGate) open(ctx context.Context, prepare func(ctx context.Context) error, backoff, maxBackoff time.Duration) {
+	for attempt := 1; prepare != nil; attempt++ {
+		err := prepare(ctx)
+		if err == nil {
+			break
+		}
+
+		g.mu.Lock()
+		g.lastErr = err
+		g.mu.Unlock()
+
+		wait := backoff << (attempt - 1)
+		if wait > maxBackoff || wait <= 0 {
+			wait = maxBackoff
+		}
+		logrus.WithError(err).WithFields(logrus.Fields{"attempt": attempt, "retryIn": wait.String()}).
+			Warn("Database not ready, retrying")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+
+	g.once.Do(func() {
+		logrus.Info("Database ready")
+		close(g.ready)
+	})
+}
+
+func (g *startupGate) isOpen() bool {
+	select {
+	case <-g.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// then runs fn in the background once the gate has opened, for startup work that needs the database.
+func (g *startupGate) then(fn func(ctx context.Context)) {
+	go func() {
+		<-g.ready
+		fn(context.Background())
+	}()
+}
+
+// middleware turns requests away with 503 until the gate opens. The operational endpoints stay reachable, so that a
+// replica that cannot reach its database can still say so.
+func (g *startupGate) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.isOpen() || r.URL.Path == "/health" || r.URL.Path == "/ready" || r.URL.Path == "/log-level" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", "5")
+		respondWithError(w, http.StatusServiceUnavailable, "The server is starting, please retry shortly")
+	})
+}
+
+type readinessReport struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// checkReadiness reports 503 until the gate opens, with the last error met preparing the database, for a readiness
+// probe to keep traffic away from a replica still waiting for it.
+func checkReadiness(gate *startupGate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		if gate.isOpen() {
+			respondWithSuccess(w, http.StatusOK, readinessReport{Status: "ready"})
+			return
+		}
+
+		report := readinessReport{Status: "starting"}
+		gate.mu.Lock()
+		if gate.lastErr != nil {
+			report.Error = gate.lastErr.Error()
+		}
+		gate.mu.Unlock()
+		respondWithSuccess(w, http.StatusServiceUnavailable, report)
+		return
+	}
+}
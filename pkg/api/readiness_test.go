@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_StartupGate_ShouldHoldRequestsBackUntilDatabaseIsPrepared(t *testing.T) {
+	gate := newStartupGate()
+	router := http.NewServeMux()
+	router.HandleFunc("/ready", checkReadiness(gate))
+	router.HandleFunc("/tracks", func(w http.ResponseWriter, r *http.Request) {})
+	handler := gate.middleware(router)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		require.Nil(t, err)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	attempts := 0
+	failing := make(chan struct{})
+	proceed := make(chan struct{})
+	ran := make(chan struct{})
+	gate.then(func(ctx context.Context) { close(ran) })
+	go gate.open(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("connection refused")
+		}
+		close(failing)
+		<-proceed
+		return nil
+	}, time.Millisecond, time.Millisecond)
+
+	<-failing
+	recorder := serve("/tracks")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Equal(t, "5", recorder.Header().Get("Retry-After"))
+
+	recorder = serve("/ready")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	var report readinessReport
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Equal(t, readinessReport{Status: "starting", Error: "connection refused"}, report)
+
+	close(proceed)
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("startup work did not run once the gate opened")
+	}
+	require.Equal(t, 2, attempts)
+	require.Equal(t, http.StatusOK, serve("/tracks").Code)
+	require.Equal(t, http.StatusOK, serve("/ready").Code)
+}
+
+func TestApi_StartupGate_ShouldOpenStraightAwayWithNothingToPrepare(t *testing.T) {
+	gate := newStartupGate()
+	gate.open(context.Background(), nil, time.Second, time.Second)
+	require.True(t, gate.isOpen())
+}
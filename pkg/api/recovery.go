@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// headerTracker notes whether a handler has started its response, after which an error can no longer be sent.
+type headerTracker struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (t *headerTracker) WriteHeader(code int) {
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *headerTracker) Write(b []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *headerTracker) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		t.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// Hijack lets a handler take over the connection, as for a WebSocket, after which no error response can be sent.
+func (t *headerTracker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be taken over")
+	}
+	t.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// recoverPanics turns a panic in a handler into a logged stack trace and a 500 carrying the request ID, rather than a
+// dropped connection. A response that has already started is left as it is.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracker := &headerTracker{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// The server uses this panic to abort a response on purpose, and handles it itself.
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			requestID := requestIDFromContext(r.Context())
+			logrus.WithFields(logrus.Fields{
+				"requestId": requestID,
+				"method":    r.Method,
+				"path":      r.URL.Path,
+				"stack":     string(debug.Stack()),
+			}).Error(fmt.Sprintf("Recovered from panic: %v", recovered))
+
+			if tracker.wroteHeader {
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, internalErrorMessage)
+		}()
+
+		next.ServeHTTP(tracker, r)
+	})
+}
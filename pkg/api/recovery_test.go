@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_RecoverPanics_ShouldReturn500WithRequestID(t *testing.T) {
+	handler := requestIDMiddleware(recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tracks []string
+		_ = tracks[0]
+	})))
+
+	req, err := http.NewRequest(http.MethodGet, "/track/test", nil)
+	require.Nil(t, err)
+	req.Header.Set(requestIDHeader, "abc-123")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, "abc-123", recorder.Header().Get(requestIDHeader))
+
+	var body models.ErrorResponse
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, "internal", body.Code)
+	require.Equal(t, "abc-123", body.RequestID)
+}
+
+func TestApi_RecoverPanics_ShouldLeaveStartedResponseAlone(t *testing.T) {
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("test")
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/radio", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Empty(t, recorder.Body.String())
+}
+
+func TestApi_RequestIDMiddleware_ShouldReplaceUnsafeIDs(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set(requestIDHeader, "bad id\nwith newline")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Len(t, seen, 32)
+	require.Equal(t, seen, recorder.Header().Get(requestIDHeader))
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const jobKindReencode = "reencode"
+
+// reencodeTarget builds the transcoder a re-encode asks for, or returns the field of the request that is invalid.
+func reencodeTarget(request models.ReencodeRequest, ffmpeg string, pool *library.FFmpegPool) (*library.Transcoder, *models.FieldError) {
+	format, ok := library.StreamFormats[request.Format]
+	if !ok {
+		formats := make([]string, 0, len(library.StreamFormats))
+		for name := range library.StreamFormats {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+		return nil, &models.FieldError{Field: "format", Message: "format must be one of " + strings.Join(formats, ", ")}
+	}
+	if request.BitRate != "" && !bitratePattern.MatchString(request.BitRate) {
+		return nil, &models.FieldError{Field: "bitRate", Message: "bit rate must be in kbps, such as 128k"}
+	}
+	if request.Quality != "" && (!qualityNamePattern.MatchString(request.Quality) || request.Quality == qualityOriginal) {
+		return nil, &models.FieldError{Field: "quality", Message: "quality must be a lowercase name other than original"}
+	}
+	return &library.Transcoder{FFmpeg: ffmpeg, Format: format, Bitrate: request.BitRate, Pool: pool}, nil
+}
+
+// reencodeTracks queues the re-encoding of the tracks matching a filter, such as those over 192kbps to opus at
+// 128kbps, and returns the job for the client to follow at /job/{id}. A dry run instead responds with an estimate of
+// the space the re-encode would save.
+func reencodeTracks(handler dao.DbHandler, adminToken string, ffmpeg string, pool *library.FFmpegPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		var request models.ReencodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		target, invalid := reencodeTarget(request, ffmpeg, pool)
+		if invalid != nil {
+			respondWithFieldError(w, invalid.Field, invalid.Message)
+			return
+		}
+
+		if request.DryRun {
+			tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+			if err != nil {
+				logrus.WithError(err).Error("Error getting tracks")
+				respondWithStatusError(w, err)
+				return
+			}
+
+			respondWithSuccess(w, http.StatusOK, library.EstimateReencode(tracks, request, target))
+			return
+		}
+
+		if ffmpeg == "" {
+			respondWithStatusError(w, errFFmpegUnavailable)
+			return
+		}
+
+		job, err := jobs.Enqueue(ctx, handler, jobKindReencode, request)
+		if err != nil {
+			logrus.WithError(err).Error("Error queueing re-encode")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusAccepted, job)
+		return
+	}
+}
+
+// runReencodeJob re-encodes the tracks matching a queued request one at a time, recording the ids of those it
+// re-encoded on the job. A track that fails is skipped, and the job tried again once the rest are done; as tracks
+// already re-encoded no longer match, the retry only works through those left.
+func runReencodeJob(handler dao.DbHandler, ffmpeg string, pool *library.FFmpegPool, validator service.AudioValidator) jobs.Func {
+	return func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		var request models.ReencodeRequest
+		if err := bson.Unmarshal(job.Payload, &request); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		if ffmpeg == "" {
+			return nil, jobs.Permanent(errFFmpegUnavailable)
+		}
+		target, invalid := reencodeTarget(request, ffmpeg, pool)
+		if invalid != nil {
+			return nil, jobs.Permanent(fmt.Errorf("invalid %v: %v", invalid.Field, invalid.Message))
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+
+		var reencoded []primitive.ObjectID
+		failed := 0
+		for i, track := range tracks {
+			ok, err := reencodeTrack(ctx, handler, validator, request, target, track)
+			if ctx.Err() != nil {
+				return reencoded, ctx.Err()
+			} else if err != nil {
+				logrus.WithError(err).WithField("track", track.ID.Hex()).Error("Error re-encoding track")
+				failed++
+			} else if ok {
+				reencoded = append(reencoded, track.ID)
+			}
+			jobs.ReportProgress(ctx, float64(i+1)*100/float64(len(tracks)))
+		}
+
+		if failed > 0 {
+			return reencoded, fmt.Errorf("%d tracks could not be re-encoded", failed)
+		}
+		return reencoded, nil
+	}
+}
+
+// reencodeTrack re-encodes a track if it needs it, reporting whether it did. A track that has not been probed is probed
+// first when the filter is on bit rate, so that tracks stored before audio was probed at upload can match.
+func reencodeTrack(ctx context.Context, handler dao.DbHandler, validator service.AudioValidator, request models.ReencodeRequest, target *library.Transcoder, track models.Track) (bool, error) {
+	var audio []byte
+	if track.AudioInfo == nil && request.Filter.BitRateAbove > 0 && validator != nil {
+		var err error
+		if audio, err = handler.DownloadAudioFile(ctx, track.AudioFileID); err != nil {
+			return false, err
+		}
+		if track.AudioInfo, err = validateAudio(ctx, validator, bytes.NewReader(audio)); err != nil {
+			return false, err
+		}
+	}
+	if !library.NeedsReencode(track, request, target) {
+		return false, nil
+	}
+
+	// Audio transcoded at upload is re-encoded from the original, rather than losing quality to a second lossy encode.
+	if source := audioFileForQuality(track, qualityOriginal); audio == nil || source != track.AudioFileID {
+		var err error
+		if audio, err = handler.DownloadAudioFile(ctx, source); err != nil {
+			return false, err
+		}
+	}
+
+	converted, err := target.Transcode(ctx, audio)
+	if err != nil {
+		return false, err
+	}
+
+	if request.Quality != "" {
+		_, err = library.StoreVariant(ctx, handler, track, request.Quality, converted, target)
+		return err == nil, err
+	}
+	// The info is only for reference, so audio the probe finds fault with is stored without it, as it was before.
+	info, _ := validateAudio(ctx, validator, bytes.NewReader(converted))
+	_, err = library.ReplaceWithReencoded(ctx, handler, track, converted, target, info)
+	return err == nil, err
+}
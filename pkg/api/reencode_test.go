@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func reencodeRequest(t *testing.T, request models.ReencodeRequest) *http.Request {
+	body, err := json.Marshal(request)
+	require.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/admin/reencode", bytes.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func TestApi_ReencodeTracks_ShouldRejectUnknownFormat(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(reencodeTracks(dao.NewMemoryHandler(), "secret", "ffmpeg", nil))
+	httpHandler.ServeHTTP(recorder, reencodeRequest(t, models.ReencodeRequest{Format: "wma"}))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "format")
+}
+
+func TestApi_ReencodeTracks_ShouldEstimateSavingsOnDryRun(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+	track := models.Track{Name: "test", AudioInfo: &models.AudioInfo{BitRate: 320000, Duration: 100}}
+	_, err := library.StoreTrack(context.Background(), handler, track, testAudio)
+	require.Nil(t, err)
+
+	request := models.ReencodeRequest{Filter: models.ReencodeFilter{BitRateAbove: 192000}, Format: "opus", BitRate: "128k", DryRun: true}
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(reencodeTracks(handler, "secret", "", nil))
+	httpHandler.ServeHTTP(recorder, reencodeRequest(t, request))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var estimate models.ReencodeEstimate
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&estimate))
+	require.Equal(t, 1, estimate.Tracks)
+	require.Equal(t, int64(2400000), estimate.SavedBytes)
+
+	jobs, err := handler.GetJobs(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Empty(t, jobs)
+}
+
+func TestApi_ReencodeTracks_ShouldQueueJob(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(reencodeTracks(handler, "secret", "ffmpeg", nil))
+	httpHandler.ServeHTTP(recorder, reencodeRequest(t, models.ReencodeRequest{Format: "opus", Quality: "low"}))
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	var job models.Job
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&job))
+	require.Equal(t, jobKindReencode, job.Kind)
+	require.Equal(t, models.JobQueued, job.Status)
+}
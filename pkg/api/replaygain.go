@@ -0,0 +1,287 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const jobKindReplayGain = "replaygain"
+
+var (
+	integratedLoudnessPattern = regexp.MustCompile(`I:\s+(-?\d+(?:\.\d+)?) LUFS`)
+	truePeakPattern           = regexp.MustCompile(`Peak:\s+(-?(?:\d+(?:\.\d+)?|inf)) dBFS`)
+)
+
+// loudness is what ffmpeg's ebur128 filter measures of audio: its integrated loudness in LUFS, its true peak in dBTP
+// and its duration in seconds.
+type loudness struct {
+	integrated float64
+	truePeak   float64
+	duration   float64
+}
+
+// measureLoudness runs ffmpeg's ebur128 filter over the audio, once there is a slot for it in the pool.
+func measureLoudness(ctx context.Context, ffmpeg string, pool *library.FFmpegPool, audio []byte) (loudness, error) {
+	release, err := acquireFFmpeg(ctx, pool)
+	if err != nil {
+		return loudness{}, err
+	}
+	defer release()
+
+	// framelog=verbose keeps the measurement of every 100ms of audio out of the log, leaving only the summary.
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-i", "pipe:0", "-vn", "-af", "ebur128=peak=true:framelog=verbose", "-f", "null", "-")
+	cmd.Stdin = bytes.NewReader(audio)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return loudness{}, fmt.Errorf("ffmpeg ebur128 failed: %v", err)
+	}
+
+	return parseEBUR128(stderr.String())
+}
+
+// parseEBUR128 reads the integrated loudness and true peak from the summary ebur128 logs at the end of the input, and
+// the input's duration as parseSilenceDetect does. Audio that is silent throughout has a peak of -inf, which is taken
+// as a peak of nothing.
+func parseEBUR128(output string) (loudness, error) {
+	integrated := integratedLoudnessPattern.FindAllStringSubmatch(output, -1)
+	peaks := truePeakPattern.FindAllStringSubmatch(output, -1)
+	if len(integrated) == 0 || len(peaks) == 0 {
+		return loudness{}, errors.New("unable to find loudness summary in ffmpeg output")
+	}
+
+	var measured loudness
+	measured.integrated, _ = strconv.ParseFloat(integrated[len(integrated)-1][1], 64)
+	if peak := peaks[len(peaks)-1][1]; peak == "-inf" {
+		measured.truePeak = math.Inf(-1)
+	} else {
+		measured.truePeak, _ = strconv.ParseFloat(peak, 64)
+	}
+
+	match := durationPattern.FindStringSubmatch(output)
+	if progress := progressTimePattern.FindAllStringSubmatch(output, -1); match == nil && len(progress) > 0 {
+		match = progress[len(progress)-1]
+	}
+	if match != nil {
+		hours, _ := strconv.ParseFloat(match[1], 64)
+		minutes, _ := strconv.ParseFloat(match[2], 64)
+		seconds, _ := strconv.ParseFloat(match[3], 64)
+		measured.duration = hours*3600 + minutes*60 + seconds
+	}
+	return measured, nil
+}
+
+// analyzeReplayGain queues the analysis of the library's loudness, and returns the job for the client to follow at
+// /job/{id}. The body is optional; without one only tracks not yet analysed are.
+func analyzeReplayGain(handler dao.DbHandler, adminToken string, ffmpeg string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		var request models.ReplayGainRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		if ffmpeg == "" {
+			respondWithStatusError(w, errFFmpegUnavailable)
+			return
+		}
+
+		job, err := jobs.Enqueue(ctx, handler, jobKindReplayGain, request)
+		if err != nil {
+			logrus.WithError(err).Error("Error queueing ReplayGain analysis")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusAccepted, job)
+		return
+	}
+}
+
+// runReplayGainJob measures the loudness of the tracks a queued request asks for, one at a time, and then works out the
+// album gains afresh from every analysed track, recording the ids of the tracks it measured on the job. A track that
+// fails is skipped, and the job tried again once the rest are done; as tracks already measured no longer need it, the
+// retry only works through those left.
+func runReplayGainJob(handler dao.DbHandler, ffmpeg string, pool *library.FFmpegPool) jobs.Func {
+	return func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		var request models.ReplayGainRequest
+		if err := bson.Unmarshal(job.Payload, &request); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		if ffmpeg == "" {
+			return nil, jobs.Permanent(errFFmpegUnavailable)
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+
+		var pending []int
+		for i, track := range tracks {
+			if request.All || track.ReplayGain == nil || track.ReplayGain.AudioFileID != track.AudioFileID {
+				pending = append(pending, i)
+			}
+		}
+
+		measured := make(map[int]bool)
+		var ids []primitive.ObjectID
+		failed := 0
+		for n, i := range pending {
+			gain, err := analyzeTrack(ctx, handler, ffmpeg, pool, tracks[i])
+			if ctx.Err() != nil {
+				return ids, ctx.Err()
+			} else if err != nil {
+				logrus.WithError(err).WithField("track", tracks[i].ID.Hex()).Error("Error analysing track loudness")
+				failed++
+			} else {
+				tracks[i].ReplayGain = &gain
+				measured[i] = true
+				ids = append(ids, tracks[i].ID)
+			}
+			jobs.ReportProgress(ctx, float64(n+1)*100/float64(len(pending)))
+		}
+
+		for _, i := range library.SetAlbumGains(tracks) {
+			measured[i] = true
+		}
+		for i := range measured {
+			err := handler.UpdateTrack(ctx, tracks[i].ID, models.Track{ReplayGain: tracks[i].ReplayGain}, dao.AnyRevision)
+			if err != nil && !errors.Is(err, dao.ErrNotFound) {
+				return ids, err
+			}
+		}
+
+		if failed > 0 {
+			return ids, fmt.Errorf("%d tracks could not be analysed", failed)
+		}
+		return ids, nil
+	}
+}
+
+// analyzeTrack measures the loudness of a track's audio.
+func analyzeTrack(ctx context.Context, handler dao.DbHandler, ffmpeg string, pool *library.FFmpegPool, track models.Track) (models.ReplayGain, error) {
+	audio, err := handler.DownloadAudioFile(ctx, track.AudioFileID)
+	if err != nil {
+		return models.ReplayGain{}, err
+	}
+	measured, err := measureLoudness(ctx, ffmpeg, pool, audio)
+	if err != nil {
+		return models.ReplayGain{}, err
+	}
+	if measured.duration == 0 && track.AudioInfo != nil {
+		measured.duration = track.AudioInfo.Duration
+	}
+	return library.NewReplayGain(track.AudioFileID, measured.integrated, measured.truePeak, measured.duration), nil
+}
+
+// streamGain applies ReplayGain to the audio of tracks as it is streamed, when the request asks for it with the
+// "replaygain" query parameter, or mode says to by default. Audio is transcoded to the format it is in, or mp3 if it
+// cannot be written to a pipe, at the bit rate it has. Transcoded audio is kept in cache, if there is one.
+type streamGain struct {
+	ffmpeg string
+	pool   *library.FFmpegPool
+	mode   string
+	cache  *transcodeCache
+}
+
+// audio returns the audio of the track at the given quality with ReplayGain applied in the given mode, or the default
+// mode if it is empty, and the mode applied, which is ReplayGainOff for audio returned as it is: when gain is off, the
+// track has not been analysed, or ffmpeg is missing.
+func (g *streamGain) audio(ctx context.Context, handler dao.DbHandler, mode string, track models.Track, quality string) ([]byte, string, error) {
+	audioFileID := audioFileForQuality(track, quality)
+	transcoder, mode := g.transcoder(mode, track, quality)
+	if transcoder == nil {
+		audio, err := handler.DownloadAudioFile(ctx, audioFileID)
+		return audio, library.ReplayGainOff, err
+	}
+
+	key := transcodeCacheKey(dao.TenantFromContext(ctx), track.ID, audioFileID, transcoder)
+	if converted, ok := g.cache.get(key); ok {
+		return converted, mode, nil
+	}
+
+	audio, err := handler.DownloadAudioFile(ctx, audioFileID)
+	if err != nil {
+		return nil, "", err
+	}
+	converted, err := transcoder.Transcode(ctx, audio)
+	if err != nil {
+		return nil, "", err
+	}
+	g.cache.store(key, converted)
+	return converted, mode, nil
+}
+
+// transcoder returns the transcoder applying ReplayGain to the track's audio at the given quality in the given mode, or
+// the default mode if it is empty, with the mode it applies, or nil if the audio is to be streamed as it is.
+func (g *streamGain) transcoder(mode string, track models.Track, quality string) (*library.Transcoder, string) {
+	if g == nil || g.ffmpeg == "" {
+		return nil, library.ReplayGainOff
+	}
+	if mode == "" {
+		mode = g.mode
+	}
+	gain := library.StreamGain(track.ReplayGain, mode)
+	if gain == 0 {
+		return nil, library.ReplayGainOff
+	}
+
+	container, codec := track.Container, track.Codec
+	for _, variant := range track.Variants {
+		if variant.Quality == quality {
+			container, codec = variant.Container, variant.Codec
+		}
+	}
+	if quality == qualityOriginal && track.Original != nil {
+		container, codec = track.Original.Container, track.Original.Codec
+	}
+	format := library.StreamFormats["mp3"]
+	for _, candidate := range library.StreamFormats {
+		if candidate.Container == container && candidate.Codec == codec {
+			format = candidate
+		}
+	}
+
+	transcoder := &library.Transcoder{FFmpeg: g.ffmpeg, Format: format, Gain: gain, Pool: g.pool}
+	if bitRate := audioBitRate(track, quality); bitRate > 0 {
+		transcoder.Bitrate = strconv.Itoa(bitRate/1000) + "k"
+	}
+	return transcoder, mode
+}
+
+// validReplayGainMode reports whether mode is one of the ways ReplayGain can be applied to streams.
+func validReplayGainMode(mode string) bool {
+	switch mode {
+	case library.ReplayGainOff, library.ReplayGainTrack, library.ReplayGainAlbum:
+		return true
+	}
+	return false
+}
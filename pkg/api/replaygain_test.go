@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const ebur128Summary = `Input #0, mp3, from 'pipe:0':
+  Duration: N/A, start: 0.000000, bitrate: 192 kb/s
+size=N/A time=00:03:00.00 bitrate=N/A speed= 151x
+[Parsed_ebur128_0 @ 0x55d5c0e8a7c0] Summary:
+
+  Integrated loudness:
+    I:         -12.0 LUFS
+    Threshold: -22.3 LUFS
+
+  Loudness range:
+    LRA:         5.1 LU
+    Threshold: -32.4 LUFS
+    LRA low:   -16.2 LUFS
+    LRA high:  -11.1 LUFS
+
+  True peak:
+    Peak:        -1.0 dBFS
+`
+
+func TestApi_ParseEBUR128_ShouldReadSummaryAndDuration(t *testing.T) {
+	measured, err := parseEBUR128(ebur128Summary)
+	require.Nil(t, err)
+	require.Equal(t, loudness{integrated: -12, truePeak: -1, duration: 180}, measured)
+
+	measured, err = parseEBUR128(strings.Replace(ebur128Summary, "-1.0 dBFS", "-inf dBFS", 1))
+	require.Nil(t, err)
+	require.True(t, math.IsInf(measured.truePeak, -1))
+
+	_, err = parseEBUR128("pipe:0: Invalid data found when processing input")
+	require.NotNil(t, err)
+}
+
+func TestApi_RunReplayGainJob_ShouldStoreTrackAndAlbumGains(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	ffmpeg := stubFFmpeg(t, "cat > /dev/null; cat >&2 <<'EOF'\n"+ebur128Summary+"EOF")
+
+	first, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "first", Artist: "Artist", AlbumName: "Album"}, testAudio)
+	require.Nil(t, err)
+	analysed := library.NewReplayGain(first.AudioFileID, -24, -6, 180)
+	require.Nil(t, handler.UpdateTrack(ctx, first.ID, models.Track{ReplayGain: &analysed}, dao.AnyRevision))
+	second, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "second", Artist: "Artist", AlbumName: "Album"}, append(testAudio, 1))
+	require.Nil(t, err)
+
+	payload, err := bson.Marshal(models.ReplayGainRequest{})
+	require.Nil(t, err)
+	ids, err := runReplayGainJob(handler, ffmpeg, nil)(ctx, models.Job{Payload: payload})
+	require.Nil(t, err)
+	require.Equal(t, second.ID, ids[0])
+	require.Len(t, ids, 1)
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 2)
+	for _, track := range tracks {
+		require.NotNil(t, track.ReplayGain)
+		require.InDelta(t, -1.0, 20*math.Log10(track.ReplayGain.AlbumPeak), 1e-9)
+		require.InDelta(t, -18-10*math.Log10((math.Pow(10, -2.4)+math.Pow(10, -1.2))/2), track.ReplayGain.AlbumGain, 1e-9)
+	}
+	require.Equal(t, -6.0, tracks[1].ReplayGain.TrackGain)
+	require.Equal(t, 6.0, tracks[0].ReplayGain.TrackGain)
+}
+
+func TestApi_GetTrackAudio_ShouldApplyReplayGainWhenAsked(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	ffmpeg := stubFFmpeg(t, `cat > /dev/null; echo "$@"`)
+	track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "test"}, testAudio)
+	require.Nil(t, err)
+	gain := library.NewReplayGain(track.AudioFileID, -12, -1, 180)
+	require.Nil(t, handler.UpdateTrack(ctx, track.ID, models.Track{ReplayGain: &gain}, dao.AnyRevision))
+
+	get := func(query string, gain *streamGain) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/track/"+track.ID.Hex()+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": track.ID.Hex()})
+		recorder := httptest.NewRecorder()
+		getTrackAudio(handler, &service.URLSigner{Secret: []byte("test")}, gain).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	gains := &streamGain{ffmpeg: ffmpeg, mode: library.ReplayGainOff}
+	recorder := get("", gains)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, testAudio, recorder.Body.Bytes())
+	require.Empty(t, recorder.Header().Get("X-ReplayGain-Applied"))
+
+	recorder = get("?replaygain=track", gains)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "track", recorder.Header().Get("X-ReplayGain-Applied"))
+	args, err := ioutil.ReadAll(recorder.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(args), "-af volume=-6.00dB")
+
+	recorder = get("?replaygain=loud", gains)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// Without ffmpeg the audio is streamed as it is.
+	recorder = get("?replaygain=album", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, testAudio, recorder.Body.Bytes())
+}
+
+func TestApi_AnalyzeReplayGain_ShouldQueueJobWithoutBody(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/replaygain", nil)
+	recorder := httptest.NewRecorder()
+	analyzeReplayGain(handler, "secret", "ffmpeg").ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	req.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	analyzeReplayGain(handler, "secret", "ffmpeg").ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	jobs, err := handler.GetJobs(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, jobKindReplayGain, jobs[0].Kind)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+)
+
+var errInvalidIfMatch = errors.New(`If-Match must be a revision ETag such as "3"`)
+
+// ifMatchRevision reads the revision a client expects to be changing from the If-Match header, which holds the ETag
+// of a track or playlist as setNextRevisionETag writes it. It returns dao.AnyRevision when there is no header.
+func ifMatchRevision(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		return dao.AnyRevision, nil
+	}
+
+	revision, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(value, "W/"), `"`), 10, 64)
+	if err != nil || revision < 0 {
+		return 0, errInvalidIfMatch
+	}
+	return revision, nil
+}
+
+// setNextRevisionETag reports the revision a track or playlist is at after a change made at the expected revision, for
+// the client to send as If-Match with its next one. A change made at any revision reports nothing, as the revision it
+// led to is not known.
+func setNextRevisionETag(w http.ResponseWriter, expected int64) {
+	if expected == dao.AnyRevision {
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(expected+1, 10)))
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_UpdateTrack_ShouldReturn428WithoutRevision(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodPut, "/track/{id}", strings.NewReader(`{"name":"test"}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testTrackID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateTrack(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusPreconditionRequired, recorder.Code)
+	dbHandler.AssertNotCalled(t, "UpdateTrack", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UpdateTrack_ShouldReturn409IfRevisionIsStale(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UpdateTrack", mock.Anything, mock.Anything, mock.Anything, int64(0)).Return(dao.ErrRevisionMismatch)
+
+	req, err := http.NewRequest(http.MethodPut, "/track/{id}", strings.NewReader(`{"name":"test","revision":0}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testTrackID})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateTrack(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestApi_AddTrackTags_ShouldReturn400IfIfMatchIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/tags", strings.NewReader(`{"tags":["workout"]}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": testTrackID})
+	req.Header.Set("Authorization", "Bearer test")
+	req.Header.Set("If-Match", "latest")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTrackTags(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "If-Match")
+}
+
+func TestApi_RemoveTrackFromPlaylist_ShouldReturn409IfRevisionIsStale(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("UpdatePlaylist", mock.Anything, mock.Anything, mock.Anything, int64(3)).Return(dao.ErrRevisionMismatch)
+
+	req, err := http.NewRequest(http.MethodDelete, "/playlist/{playlistid}/track/{trackid}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"playlistid": testPlaylistID, "trackid": testTrackID})
+	req.Header.Set("Authorization", "Bearer test")
+	req.Header.Set("If-Match", `W/"3"`)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(removeTrackFromPlaylist(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
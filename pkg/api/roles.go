@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+)
+
+// roleScales are how many times the base rate limit and stream throttle each role gets when its own limits are not
+// configured.
+var roleScales = map[string]int{
+	models.RoleAdmin:    10,
+	models.RoleUploader: 4,
+	models.RoleListener: 1,
+	models.RoleGuest:    1,
+}
+
+type tokenRoleKey struct{}
+
+// tokenRoles works out the role of the token a request is made with, so that it can be held to that role's limits:
+// the admin token is an admin's, API keys are a listener's until authenticator.wrap looks them up and records the
+// role they were created with, guest tokens, signed links and
+// requests without a token are a guest's, and login tokens are a listener's unless claim names a claim carrying their
+// role. Like the tenant claim, the role claim is read without verifying the token, which the route's auth policy still
+// validates with the login service, so a forged claim buys nothing but rejected requests.
+type tokenRoles struct {
+	adminToken string
+	signer     *service.URLSigner
+	claim      string
+}
+
+// middleware records the role of the request's token in its context for the rate limiter and stream throttle. It
+// runs after the tenant is resolved, as API keys belong to a tenant.
+func (t tokenRoles) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenRoleKey{}, t.roleOf(r))))
+	})
+}
+
+func (t tokenRoles) roleOf(r *http.Request) string {
+	token, err := getAuthToken(r)
+	if err != nil || r.URL.Query().Get("signature") != "" {
+		return models.RoleGuest
+	}
+	if t.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.adminToken)) == 1 {
+		return models.RoleAdmin
+	}
+
+	if service.IsAPIKey(token) {
+		return models.RoleListener
+	}
+
+	if t.signer != nil {
+		if claims, err := t.signer.Verify(token); err == nil && strings.HasPrefix(claims.Subject, "guest:") {
+			return models.RoleGuest
+		}
+	}
+
+	if t.claim != "" {
+		if role, err := tokenClaim(token, t.claim); err == nil && isRole(role) {
+			return role
+		}
+	}
+	return models.RoleListener
+}
+
+// roleFromContext returns the role recorded by tokenRoles.middleware, or by authenticator.wrap for an API key, or an
+// empty string if neither ran.
+func roleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(tokenRoleKey{}).(string)
+	return role
+}
+
+func isRole(role string) bool {
+	_, ok := roleScales[role]
+	return ok
+}
+
+// roleRequestLimits reads each role's rate limit from RATE_LIMIT_REQUESTS_<ROLE>, such as RATE_LIMIT_REQUESTS_ADMIN,
+// defaulting to its scale of the base limit. A limit of zero leaves the role unlimited.
+func roleRequestLimits(base int) map[string]int {
+	limits := make(map[string]int, len(roleScales))
+	for _, role := range models.Roles {
+		limits[role] = getEnvInt("RATE_LIMIT_REQUESTS_"+strings.ToUpper(role), base*roleScales[role])
+	}
+	return limits
+}
+
+// roleStreamThrottles reads each role's stream throttle from STREAM_THROTTLE_<ROLE>, such as STREAM_THROTTLE_GUEST,
+// defaulting to its scale of the base multiple. A multiple of zero leaves the role's streams unthrottled.
+func roleStreamThrottles(base float64) map[string]float64 {
+	multiples := make(map[string]float64, len(roleScales))
+	for _, role := range models.Roles {
+		multiples[role] = getEnvFloat("STREAM_THROTTLE_"+strings.ToUpper(role), base*float64(roleScales[role]))
+	}
+	return multiples
+}
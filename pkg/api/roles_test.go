@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_TokenRoles_ShouldResolveRoleOfEachKindOfToken(t *testing.T) {
+	// API keys are a listener's until authentication looks them up.
+	apiKey, _, err := service.GenerateAPIKey()
+	require.Nil(t, err)
+
+	signer := &service.URLSigner{Secret: []byte("secret")}
+	guestToken, err := signer.Sign(service.SignedClaims{Subject: "guest:" + primitive.NewObjectID().Hex(), Expires: time.Now().Add(time.Hour).Unix()})
+	require.Nil(t, err)
+
+	roles := tokenRoles{adminToken: "admin-secret", signer: signer, claim: "role"}
+	cases := map[string]string{
+		"admin-secret":                  models.RoleAdmin,
+		apiKey:                          models.RoleListener,
+		guestToken:                      models.RoleGuest,
+		"login-token":                   models.RoleListener,
+		testJWT(`{"role":"uploader"}`):  models.RoleUploader,
+		testJWT(`{"role":"superuser"}`): models.RoleListener,
+		"":                              models.RoleGuest,
+	}
+	for token, expected := range cases {
+		var role string
+		handler := roles.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role = roleFromContext(r.Context())
+		}))
+
+		req, err := http.NewRequest(http.MethodGet, "/tracks", http.NoBody)
+		require.Nil(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		require.Equal(t, expected, role, token)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+// scanUpload runs an uploaded file past the scanner, if one is configured, and reports the verdict in the X-Scan-Result
+// header. It writes an error response and returns false if the file is infected or could not be scanned, since
+// uploads are not accepted unscanned once scanning is enabled.
+func scanUpload(ctx context.Context, w http.ResponseWriter, scanner service.Scanner, audio io.Reader) bool {
+	verdict, err := scanAudio(ctx, scanner, audio)
+	if verdict != "" {
+		w.Header().Set("X-Scan-Result", verdict)
+	}
+	if err != nil {
+		respondWithStatusError(w, err)
+		return false
+	}
+	return true
+}
+
+// scanAudio runs a file past the scanner, if one is configured, returning the verdict as reported in X-Scan-Result and
+// an error carrying the status to reject the file with if it is infected or could not be scanned.
+func scanAudio(ctx context.Context, scanner service.Scanner, audio io.Reader) (string, error) {
+	if scanner == nil {
+		return "", nil
+	}
+
+	counted := &countingReader{r: audio}
+	result, err := scanner.Scan(ctx, counted)
+	if err != nil {
+		logrus.WithError(err).Error("Error scanning upload")
+		return "", statusError{code: http.StatusServiceUnavailable, err: errors.New("Upload scanner unavailable")}
+	}
+
+	log := logrus.WithFields(logrus.Fields{"scanner": result.Scanner, "bytes": counted.n})
+	if !result.Clean {
+		log.WithField("signature", result.Signature).Warn("Rejected infected upload")
+		return fmt.Sprintf("infected; scanner=%v; signature=%v", result.Scanner, result.Signature),
+			statusError{code: http.StatusUnprocessableEntity, err: fmt.Errorf("Upload rejected: %v found", result.Signature)}
+	}
+
+	log.Info("Upload scanned clean")
+	return fmt.Sprintf("clean; scanner=%v", result.Scanner), nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func audioBytesRequest(t *testing.T) *http.Request {
+	body, err := json.Marshal(models.UploadRequest{AudioBytes: testAudio})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+	return req
+}
+
+func TestApi_UploadAudioBytes_ShouldReturn503IfScanFails(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	scanner := &mocks.Scanner{}
+	scanner.On("Scan", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadAudioBytes(dbHandler, enrichers{}, scanner, nil, nil))
+	httpHandler.ServeHTTP(recorder, audioBytesRequest(t))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	dbHandler.AssertNotCalled(t, "UploadAudioFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UploadAudioBytes_ShouldReturn422IfFileIsInfected(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	scanner := &mocks.Scanner{}
+	scanner.On("Scan", mock.Anything, mock.Anything).Return(&models.ScanResult{Scanner: "clamav", Signature: "Eicar-Test-Signature"}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadAudioBytes(dbHandler, enrichers{}, scanner, nil, nil))
+	httpHandler.ServeHTTP(recorder, audioBytesRequest(t))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Eicar-Test-Signature")
+	require.Equal(t, "infected; scanner=clamav; signature=Eicar-Test-Signature", recorder.Header().Get("X-Scan-Result"))
+	dbHandler.AssertNotCalled(t, "UploadAudioFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UploadAudioBytes_ShouldReportScanResultOnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	scanner := &mocks.Scanner{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.Anything).Return(nil)
+	scanner.On("Scan", mock.Anything, mock.Anything).Return(&models.ScanResult{Scanner: "clamav", Clean: true}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadAudioBytes(dbHandler, enrichers{}, scanner, nil, nil))
+	httpHandler.ServeHTTP(recorder, audioBytesRequest(t))
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, "clean; scanner=clamav", recorder.Header().Get("X-Scan-Result"))
+}
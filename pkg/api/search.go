@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxSuggestions   = 50
+	maxSearchResults = 100
+)
+
+// searchTracks returns the tracks matching ?q= by title, artist, album or tag, best match first. Up to ?limit= tracks
+// are returned, 20 by default. When a search index is configured it answers the query, and the MongoDB text index is
+// used otherwise or if the search index cannot be reached.
+func searchTracks(handler dao.DbHandler, index service.SearchIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			respondWithFieldError(w, "q", "q is required")
+			return
+		}
+
+		limit := 20
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxSearchResults {
+				respondWithFieldError(w, "limit", fmt.Sprintf("limit must be between 1 and %v", maxSearchResults))
+				return
+			}
+		}
+
+		if index != nil {
+			tracks, err := searchIndexedTracks(ctx, handler, index, query, limit)
+			if err == nil {
+				respondWithSuccess(w, http.StatusOK, tracks)
+				return
+			}
+			logrus.WithError(err).Warn("Error searching search index, falling back to text search")
+		}
+
+		tracks, err := handler.SearchTracks(ctx, query, limit)
+		if err != nil {
+			logrus.WithError(err).Error("Error searching tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, tracks)
+		return
+	}
+}
+
+// searchIndexedTracks looks the query up in the search index and loads the matching tracks in the order it ranked
+// them. Tracks the index still holds but the library no longer does are left out.
+func searchIndexedTracks(ctx context.Context, handler dao.DbHandler, index service.SearchIndex, query string, limit int) ([]models.Track, error) {
+	ids, err := index.Search(ctx, dao.TenantFromContext(ctx), query, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []models.Track{}, nil
+	}
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]models.Track, len(tracks))
+	for _, track := range tracks {
+		byID[track.ID] = track
+	}
+	ordered := make([]models.Track, 0, len(tracks))
+	for _, id := range ids {
+		if track, ok := byID[id]; ok {
+			ordered = append(ordered, track)
+		}
+	}
+	return ordered, nil
+}
+
+// mirrorSearchIndex keeps the search index in step with the library by following track changes until the context is
+// cancelled. Changes made while the change stream is being reopened are missed; running musicctl reindex-search brings
+// the index back in step.
+func mirrorSearchIndex(ctx context.Context, handler dao.DbHandler, index service.SearchIndex, retry time.Duration) {
+	followChanges(ctx, "search index", retry, func(ctx context.Context) error {
+		return handler.WatchTracks(ctx, func(change models.TrackChange) error {
+			var err error
+			if change.Operation == "delete" || change.Track == nil {
+				err = index.DeleteTrack(ctx, change.Tenant, change.TrackID)
+			} else {
+				err = index.IndexTrack(ctx, change.Tenant, *change.Track)
+			}
+			if err != nil {
+				logrus.WithError(err).WithField("track", change.TrackID.Hex()).Error("Error updating search index")
+			}
+			return nil
+		})
+	})
+}
+
+// suggestSearch returns the track titles, artists and albums starting with ?q=, for type-ahead search. Up to ?limit=
+// suggestions are returned, 10 by default.
+func suggestSearch(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			respondWithFieldError(w, "q", "q is required")
+			return
+		}
+
+		limit := 10
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxSuggestions {
+				respondWithFieldError(w, "limit", fmt.Sprintf("limit must be between 1 and %v", maxSuggestions))
+				return
+			}
+		}
+
+		suggestions, err := handler.GetSuggestions(ctx, query, limit)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving search suggestions")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, suggestions)
+		return
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_SuggestSearch_ShouldReturn400IfQueryIsMissing(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/search/suggest?q=%20", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(suggestSearch(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_SuggestSearch_ShouldReturn400IfLimitIsTooLarge(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/search/suggest?q=be&limit=51", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(suggestSearch(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_SuggestSearch_ShouldReturn500IfGetSuggestionsErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetSuggestions", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodGet, "/search/suggest?q=be", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(suggestSearch(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_SuggestSearch_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetSuggestions", mock.Anything, "be", 10).Return([]models.Suggestion{{Kind: "artist", Value: "Beck", Count: 3}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/search/suggest?q=be", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(suggestSearch(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"value":"Beck"`)
+}
+
+func TestApi_SearchTracks_ShouldReturn400IfQueryIsMissing(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/search", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(searchTracks(dbHandler, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_SearchTracks_ShouldUseTextSearchIfNoIndexIsConfigured(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("SearchTracks", mock.Anything, "beatles", 5).Return([]models.Track{{Name: "Help!"}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/search?q=beatles&limit=5", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(searchTracks(dbHandler, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Help!")
+}
+
+func TestApi_SearchTracks_ShouldReturn500IfTextSearchErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("SearchTracks", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodGet, "/search?q=beatles", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(searchTracks(dbHandler, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_SearchTracks_ShouldReturnIndexedTracksInRankedOrder(t *testing.T) {
+	first, second, removed := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	searchIndex := &mocks.SearchIndex{}
+	searchIndex.On("Search", mock.Anything, "", "beatles", 20).Return([]primitive.ObjectID{second, removed, first}, nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{
+		{ID: first, Name: "First"},
+		{ID: second, Name: "Second"},
+	}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/search?q=beatles", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(searchTracks(dbHandler, searchIndex))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var tracks []models.Track
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &tracks))
+	require.Equal(t, 2, len(tracks))
+	require.Equal(t, "Second", tracks[0].Name)
+	require.Equal(t, "First", tracks[1].Name)
+	dbHandler.AssertNotCalled(t, "SearchTracks", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_SearchTracks_ShouldFallBackToTextSearchIfIndexErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	searchIndex := &mocks.SearchIndex{}
+	searchIndex.On("Search", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+	dbHandler.On("SearchTracks", mock.Anything, "beatles", 20).Return([]models.Track{{Name: "Help!"}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/search?q=beatles", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(searchTracks(dbHandler, searchIndex))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Help!")
+}
+
+func TestApi_MirrorSearchIndex_ShouldIndexChangedTracksAndDeleteRemovedOnes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updated := models.Track{ID: primitive.NewObjectID(), Name: "Updated"}
+	deleted := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	searchIndex := &mocks.SearchIndex{}
+	dbHandler.On("WatchTracks", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handle := args.Get(1).(func(models.TrackChange) error)
+		handle(models.TrackChange{Operation: "update", Tenant: "acme", TrackID: updated.ID, Track: &updated})
+		handle(models.TrackChange{Operation: "delete", Tenant: "acme", TrackID: deleted})
+		cancel()
+	}).Return(context.Canceled)
+	searchIndex.On("IndexTrack", mock.Anything, "acme", updated).Return(nil)
+	searchIndex.On("DeleteTrack", mock.Anything, "acme", deleted).Return(nil)
+
+	mirrorSearchIndex(ctx, dbHandler, searchIndex, time.Millisecond)
+
+	searchIndex.AssertExpectations(t)
+	dbHandler.AssertNumberOfCalls(t, "WatchTracks", 1)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// seedDemoData adds the demo library to the tenant of the request, so a new deployment has something to play.
+func seedDemoData(handler dao.DbHandler, adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkAdminToken(r, adminToken) {
+			respondWithError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		tracks, playlists, err := library.Seed(ctx, handler)
+		if err != nil {
+			logrus.WithError(err).Error("Error seeding demo data")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, models.SeedResult{Tracks: tracks, Playlists: playlists})
+		return
+	}
+}
+
+// seedOnStartup adds the demo library to the default tenant when the server starts. Failing to is logged rather than
+// stopping the server, as the demo library is a convenience.
+func seedOnStartup(ctx context.Context, handler dao.DbHandler) {
+	tracks, playlists, err := library.Seed(ctx, handler)
+	if err != nil {
+		logrus.WithError(err).Error("Error seeding demo data")
+		return
+	}
+	logrus.WithFields(logrus.Fields{"tracks": tracks, "playlists": playlists}).Info("Seeded demo data")
+}
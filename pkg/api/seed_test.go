@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_SeedDemoData_ShouldReturn403WithoutAdminToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/admin/seed", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer wrong")
+
+	handler := dao.NewMemoryHandler()
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(seedDemoData(handler, "secret"))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	tracks, err := handler.GetTracks(req.Context(), nil)
+	require.Nil(t, err)
+	require.Empty(t, tracks)
+}
+
+func TestApi_SeedDemoData_ShouldAddDemoLibrary(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/admin/seed", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	handler := dao.NewMemoryHandler()
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(seedDemoData(handler, "secret"))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var result models.SeedResult
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	require.NotZero(t, result.Tracks)
+	require.NotZero(t, result.Playlists)
+
+	playlists, err := handler.GetPlaylists(req.Context(), nil)
+	require.Nil(t, err)
+	require.Len(t, playlists, result.Playlists)
+}
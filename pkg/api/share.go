@@ -0,0 +1,309 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	shareKindTrack    = "track"
+	shareKindPlaylist = "playlist"
+)
+
+// shareSettings configures the public links minted by createShare. baseURL is the externally visible address of the
+// API; when empty it is derived from each request.
+type shareSettings struct {
+	signer     *service.URLSigner
+	baseURL    string
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// createShare mints a signed link giving unauthenticated access to a single track or playlist, identified by the "id"
+// route variable.
+func createShare(handler dao.DbHandler, settings shareSettings, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var shareRequest models.ShareRequest
+		if err := json.NewDecoder(r.Body).Decode(&shareRequest); err != nil && err != io.EOF {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ttl := settings.defaultTTL
+		if shareRequest.ExpiresIn != "" {
+			if ttl, err = time.ParseDuration(shareRequest.ExpiresIn); err != nil || ttl <= 0 {
+				respondWithFieldError(w, "expiresIn", "expiresIn must be a positive duration such as '24h'")
+				return
+			}
+		}
+		if ttl > settings.maxTTL {
+			respondWithFieldError(w, "expiresIn", "expiresIn exceeds the maximum of "+settings.maxTTL.String())
+			return
+		}
+		if shareRequest.MaxPlays < 0 {
+			respondWithFieldError(w, "maxPlays", "maxPlays cannot be negative")
+			return
+		}
+
+		found, err := shareTargetExists(ctx, handler, kind, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving " + kind)
+			respondWithStatusError(w, err)
+			return
+		}
+		if !found && kind == shareKindTrack {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		} else if !found {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+
+		now := time.Now()
+		share := models.Share{
+			ID:         primitive.NewObjectID(),
+			Kind:       kind,
+			ResourceID: id,
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(ttl),
+			MaxPlays:   shareRequest.MaxPlays,
+		}
+
+		signed, err := settings.signer.Sign(service.SignedClaims{
+			Subject: "share:" + share.ID.Hex(),
+			Tenant:  dao.TenantFromContext(ctx),
+			Expires: share.ExpiresAt.Unix(),
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Error signing share link")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		if err := handler.AddShare(ctx, share); err != nil {
+			logrus.WithError(err).Error("Error adding share to database")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, models.ShareLink{
+			URL:       externalURL(r, settings.baseURL, versionedPath(r.Context(), "/shared/"+signed)),
+			ExpiresAt: share.ExpiresAt,
+			MaxPlays:  share.MaxPlays,
+		})
+		return
+	}
+}
+
+// getShared serves the resource behind a share link without authentication: the audio of a shared track, or the
+// contents of a shared playlist.
+func getShared(handler dao.DbHandler, signer *service.URLSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		ctx, share, ok := resolveShare(w, r, handler, signer)
+		if !ok {
+			return
+		}
+
+		if share.Kind == shareKindTrack {
+			streamSharedTrack(ctx, w, handler, share, share.ResourceID)
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": share.ResourceID})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Playlist not found")
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": map[string]interface{}{"$in": playlists[0].Tracks}})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist tracks")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, map[string]interface{}{"name": playlists[0].Name, "tracks": tracks})
+		return
+	}
+}
+
+// getSharedPlaylistTrack streams one track of a shared playlist.
+func getSharedPlaylistTrack(handler dao.DbHandler, signer *service.URLSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		ctx, share, ok := resolveShare(w, r, handler, signer)
+		if !ok {
+			return
+		}
+		if share.Kind != shareKindPlaylist {
+			respondWithError(w, http.StatusNotFound, "Share link is not for a playlist")
+			return
+		}
+
+		trackID, err := primitive.ObjectIDFromHex(mux.Vars(r)["trackid"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": share.ResourceID, "tracks": trackID})
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving playlist")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(playlists) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found in shared playlist")
+			return
+		}
+
+		streamSharedTrack(ctx, w, handler, share, trackID)
+		return
+	}
+}
+
+// resolveShare verifies the signed token in the "token" route variable and loads the share it refers to, scoping the
+// returned context to the tenant the link was minted for. If the share cannot be used an error response is written
+// and ok is false.
+func resolveShare(w http.ResponseWriter, r *http.Request, handler dao.DbHandler, signer *service.URLSigner) (context.Context, *models.Share, bool) {
+	ctx, share, err := loadShare(r.Context(), handler, signer, mux.Vars(r)["token"])
+	if err != nil {
+		respondWithStatusError(w, err)
+		return ctx, nil, false
+	}
+	return ctx, share, true
+}
+
+// loadShare verifies a share link's signed token and loads the share it refers to, scoping the returned context to the
+// tenant the link was minted for. Links that cannot be used are reported with a statusError.
+func loadShare(ctx context.Context, handler dao.DbHandler, signer *service.URLSigner, token string) (context.Context, *models.Share, error) {
+	notFound := statusError{code: http.StatusNotFound, err: errors.New("Share link not found")}
+	expired := statusError{code: http.StatusGone, err: errors.New("Share link has expired")}
+
+	claims, err := signer.Verify(token)
+	if err == service.ErrSignatureExpired {
+		return ctx, nil, expired
+	} else if err != nil || !strings.HasPrefix(claims.Subject, "share:") {
+		return ctx, nil, notFound
+	}
+
+	if claims.Tenant != "" {
+		if ctx, err = dao.WithTenant(ctx, claims.Tenant); err != nil {
+			return ctx, nil, notFound
+		}
+	}
+
+	id, err := primitive.ObjectIDFromHex(strings.TrimPrefix(claims.Subject, "share:"))
+	if err != nil {
+		return ctx, nil, notFound
+	}
+
+	shares, err := handler.GetShares(ctx, map[string]interface{}{"_id": id})
+	if err != nil {
+		logrus.WithError(err).Error("Error retrieving share")
+		return ctx, nil, err
+	}
+	if len(shares) == 0 {
+		return ctx, nil, notFound
+	}
+	if time.Now().After(shares[0].ExpiresAt) {
+		return ctx, nil, expired
+	}
+
+	return ctx, &shares[0], nil
+}
+
+func streamSharedTrack(ctx context.Context, w http.ResponseWriter, handler dao.DbHandler, share *models.Share, trackID primitive.ObjectID) {
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": trackID})
+	if err != nil {
+		logrus.WithError(err).Error("Error getting track")
+		respondWithStatusError(w, err)
+		return
+	}
+	if len(tracks) == 0 {
+		respondWithError(w, http.StatusNotFound, "Track not found")
+		return
+	}
+
+	audio, err := handler.DownloadAudioFile(ctx, tracks[0].AudioFileID)
+	if err != nil {
+		logrus.WithError(err).Error("Error getting audio for track")
+		respondWithStatusError(w, err)
+		return
+	}
+
+	// The play is only recorded once the audio is fetched, so a failed download does not use up the link.
+	if err := handler.RecordSharePlay(ctx, share.ID); errors.Is(err, dao.ErrNotFound) {
+		respondWithError(w, http.StatusGone, "Share link has reached its play limit")
+		return
+	} else if err != nil {
+		logrus.WithError(err).Error("Error recording share play")
+		respondWithStatusError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", library.MIMEType(tracks[0].Container))
+	throttleStream(w, audioBitRate(tracks[0], ""))
+	if _, err := w.Write(audio); err != nil {
+		logrus.WithError(err).Error("Error writing file to response")
+	}
+}
+
+func shareTargetExists(ctx context.Context, handler dao.DbHandler, kind string, id primitive.ObjectID) (bool, error) {
+	filter := map[string]interface{}{"_id": id}
+	if kind == shareKindTrack {
+		tracks, err := handler.GetTracks(ctx, filter)
+		return len(tracks) > 0, err
+	}
+
+	playlists, err := handler.GetPlaylists(ctx, filter)
+	return len(playlists) > 0, err
+}
+
+// externalURL builds an absolute URL for path, using baseURL if configured and otherwise the scheme and host the
+// request arrived on.
+func externalURL(r *http.Request, baseURL string, path string) string {
+	if baseURL != "" {
+		return strings.TrimRight(baseURL, "/") + path
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
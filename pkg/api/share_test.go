@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testShareSettings() shareSettings {
+	return shareSettings{
+		signer:     &service.URLSigner{Secret: []byte("test")},
+		baseURL:    "https://music.example.com",
+		defaultTTL: time.Hour,
+		maxTTL:     24 * time.Hour,
+	}
+}
+
+func signShare(t *testing.T, signer *service.URLSigner, id primitive.ObjectID, expires time.Time) string {
+	token, err := signer.Sign(service.SignedClaims{Subject: "share:" + id.Hex(), Expires: expires.Unix()})
+	require.Nil(t, err)
+	return token
+}
+
+func TestApi_CreateShare_ShouldReturn400IfExpiryExceedsMaximum(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/share", bytes.NewBufferString(`{"expiresIn": "48h"}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createShare(dbHandler, testShareSettings(), shareKindTrack))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_CreateShare_ShouldReturn404IfPlaylistNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/playlist/{id}/share", http.NoBody)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createShare(dbHandler, testShareSettings(), shareKindPlaylist))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_CreateShare_ShouldReturn200WithSignedLink(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("AddShare", mock.Anything, mock.MatchedBy(func(share models.Share) bool {
+		return share.Kind == shareKindTrack && share.MaxPlays == 3
+	})).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/share", bytes.NewBufferString(`{"maxPlays": 3}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createShare(dbHandler, testShareSettings(), shareKindTrack))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "https://music.example.com/v1/shared/")
+}
+
+func TestApi_GetShared_ShouldReturn404IfSignatureInvalid(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/{token}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"token": "test.test"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getShared(dbHandler, testShareSettings().signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GetShared_ShouldReturn410IfLinkExpired(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	signer := testShareSettings().signer
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/{token}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"token": signShare(t, signer, primitive.NewObjectID(), time.Now().Add(-time.Minute))})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getShared(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusGone, recorder.Code)
+}
+
+func TestApi_GetShared_ShouldReturn410IfPlayLimitReached(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	signer := testShareSettings().signer
+	share := models.Share{ID: primitive.NewObjectID(), Kind: shareKindTrack, ExpiresAt: time.Now().Add(time.Hour), MaxPlays: 1}
+	dbHandler.On("GetShares", mock.Anything, mock.Anything).Return([]models.Share{share}, nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("DownloadAudioFile", mock.Anything, mock.Anything).Return([]byte("test"), nil)
+	dbHandler.On("RecordSharePlay", mock.Anything, share.ID).Return(dao.ErrNotFound)
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/{token}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"token": signShare(t, signer, share.ID, share.ExpiresAt)})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getShared(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusGone, recorder.Code)
+}
+
+func TestApi_GetShared_ShouldNotRecordPlayIfDownloadFails(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	signer := testShareSettings().signer
+	share := models.Share{ID: primitive.NewObjectID(), Kind: shareKindTrack, ExpiresAt: time.Now().Add(time.Hour), MaxPlays: 1}
+	dbHandler.On("GetShares", mock.Anything, mock.Anything).Return([]models.Share{share}, nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("DownloadAudioFile", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/{token}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"token": signShare(t, signer, share.ID, share.ExpiresAt)})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getShared(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	dbHandler.AssertNotCalled(t, "RecordSharePlay", mock.Anything, mock.Anything)
+}
+
+func TestApi_GetShared_ShouldServeSharedTrackWithTypeOfItsContainer(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	signer := testShareSettings().signer
+	share := models.Share{ID: primitive.NewObjectID(), Kind: shareKindTrack, ExpiresAt: time.Now().Add(time.Hour)}
+	dbHandler.On("GetShares", mock.Anything, mock.Anything).Return([]models.Share{share}, nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Container: "flac"}}, nil)
+	dbHandler.On("DownloadAudioFile", mock.Anything, mock.Anything).Return([]byte("fLaC"), nil)
+	dbHandler.On("RecordSharePlay", mock.Anything, share.ID).Return(nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/{token}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"token": signShare(t, signer, share.ID, share.ExpiresAt)})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getShared(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "audio/flac", recorder.Header().Get("Content-Type"))
+}
+
+func TestApi_GetShared_ShouldReturnAudioForSharedTrack(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	signer := testShareSettings().signer
+	share := models.Share{ID: primitive.NewObjectID(), Kind: shareKindTrack, ExpiresAt: time.Now().Add(time.Hour)}
+	dbHandler.On("GetShares", mock.Anything, mock.Anything).Return([]models.Share{share}, nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("RecordSharePlay", mock.Anything, share.ID).Return(nil)
+	dbHandler.On("DownloadAudioFile", mock.Anything, mock.Anything).Return([]byte("test"), nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/{token}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"token": signShare(t, signer, share.ID, share.ExpiresAt)})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getShared(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "test", recorder.Body.String())
+}
+
+func TestApi_GetSharedPlaylistTrack_ShouldReturn404IfTrackNotInPlaylist(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	signer := testShareSettings().signer
+	share := models.Share{ID: primitive.NewObjectID(), Kind: shareKindPlaylist, ExpiresAt: time.Now().Add(time.Hour)}
+	dbHandler.On("GetShares", mock.Anything, mock.Anything).Return([]models.Share{share}, nil)
+	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/{token}/track/{trackid}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{
+		"token":   signShare(t, signer, share.ID, share.ExpiresAt),
+		"trackid": "603ac4abd9ad8067f54a2778",
+	})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getSharedPlaylistTrack(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"music-stream-api/pkg/models"
+)
+
+// silenceEdgeTolerance is how close, in seconds, a silent period must come to the start or end of the audio to count
+// as leading or trailing silence.
+const silenceEdgeTolerance = 0.05
+
+var (
+	durationPattern     = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+	progressTimePattern = regexp.MustCompile(`time=(\d+):(\d+):(\d+(?:\.\d+)?)`)
+	silenceStartPattern = regexp.MustCompile(`silence_start: (-?\d+(?:\.\d+)?)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: (\d+(?:\.\d+)?)`)
+)
+
+// silenceSettings configures ffmpeg's silencedetect filter: audio quieter than threshold, in dB, for at least
+// minDuration counts as silence.
+type silenceSettings struct {
+	threshold   int
+	minDuration time.Duration
+}
+
+// detectSilence runs ffmpeg's silencedetect filter over the audio and reports how much leading and trailing silence
+// could be trimmed from it.
+func detectSilence(ctx context.Context, ffmpeg string, audio []byte, settings silenceSettings) (*models.SilenceTrim, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%vdB:duration=%v", settings.threshold, settings.minDuration.Seconds())
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg, "-i", "pipe:0", "-af", filter, "-f", "null", "-")
+	cmd.Stdin = bytes.NewReader(audio)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg silencedetect failed: %v", err)
+	}
+
+	return parseSilenceDetect(stderr.String())
+}
+
+// parseSilenceDetect reads the input duration and silent periods from silencedetect's log output. Only silence
+// touching either end of the audio is trimmed; pauses within it are left alone.
+func parseSilenceDetect(output string) (*models.SilenceTrim, error) {
+	// Piped input has no duration up front, so it comes from the last progress report instead.
+	match := durationPattern.FindStringSubmatch(output)
+	if progress := progressTimePattern.FindAllStringSubmatch(output, -1); match == nil && len(progress) > 0 {
+		match = progress[len(progress)-1]
+	}
+	if match == nil {
+		return nil, fmt.Errorf("unable to find input duration in ffmpeg output")
+	}
+	hours, _ := strconv.ParseFloat(match[1], 64)
+	minutes, _ := strconv.ParseFloat(match[2], 64)
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	duration := hours*3600 + minutes*60 + seconds
+
+	starts := parseFloats(silenceStartPattern.FindAllStringSubmatch(output, -1))
+	ends := parseFloats(silenceEndPattern.FindAllStringSubmatch(output, -1))
+
+	trim := &models.SilenceTrim{OriginalDuration: duration}
+	if len(starts) > 0 && starts[0] <= silenceEdgeTolerance && len(ends) > 0 {
+		trim.LeadingSilence = ends[0]
+	}
+
+	// Older versions of ffmpeg don't log the end of a silence that runs to the end of the input.
+	if last := len(starts) - 1; last >= 0 && (len(ends) <= last || ends[last] >= duration-silenceEdgeTolerance) {
+		if starts[last] > trim.LeadingSilence {
+			trim.TrailingSilence = duration - starts[last]
+		}
+	}
+
+	// Audio that is silent throughout is kept as it is rather than trimmed to nothing.
+	if trim.LeadingSilence+trim.TrailingSilence >= duration {
+		trim.LeadingSilence, trim.TrailingSilence = 0, 0
+	}
+	trim.TrimmedDuration = duration - trim.LeadingSilence - trim.TrailingSilence
+	return trim, nil
+}
+
+func parseFloats(matches [][]string) []float64 {
+	values := make([]float64, 0, len(matches))
+	for _, match := range matches {
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// trimArgs returns the ffmpeg output options that cut the detected silence from the audio.
+func trimArgs(trim *models.SilenceTrim) []string {
+	if trim == nil || (trim.LeadingSilence == 0 && trim.TrailingSilence == 0) {
+		return nil
+	}
+	return []string{
+		"-ss", strconv.FormatFloat(trim.LeadingSilence, 'f', 3, 64),
+		"-t", strconv.FormatFloat(trim.TrimmedDuration, 'f', 3, 64),
+	}
+}
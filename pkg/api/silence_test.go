@@ -0,0 +1,61 @@
+package api
+
+import (
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+const silenceDetectOutput = `Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'video.mp4':
+  Duration: 00:03:20.00, start: 0.000000, bitrate: 129 kb/s
+[silencedetect @ 0x5581] silence_start: -0.0213
+[silencedetect @ 0x5581] silence_end: 2.5 | silence_duration: 2.5213
+[silencedetect @ 0x5581] silence_start: 95.2
+[silencedetect @ 0x5581] silence_end: 96.1 | silence_duration: 0.9
+[silencedetect @ 0x5581] silence_start: 195.75
+`
+
+func TestApi_ParseSilenceDetect_ShouldReturnErrorIfDurationIsMissing(t *testing.T) {
+	_, err := parseSilenceDetect("silence_start: 0")
+	require.NotNil(t, err)
+}
+
+func TestApi_ParseSilenceDetect_ShouldTrimOnlyLeadingAndTrailingSilence(t *testing.T) {
+	trim, err := parseSilenceDetect(silenceDetectOutput)
+	require.Nil(t, err)
+	require.Equal(t, 200.0, trim.OriginalDuration)
+	require.Equal(t, 2.5, trim.LeadingSilence)
+	require.InDelta(t, 4.25, trim.TrailingSilence, 0.0001)
+	require.InDelta(t, 193.25, trim.TrimmedDuration, 0.0001)
+}
+
+func TestApi_ParseSilenceDetect_ShouldRecogniseTrailingSilenceEndingAtEndOfInput(t *testing.T) {
+	trim, err := parseSilenceDetect(silenceDetectOutput + "[silencedetect @ 0x5581] silence_end: 200 | silence_duration: 4.25\n")
+	require.Nil(t, err)
+	require.InDelta(t, 4.25, trim.TrailingSilence, 0.0001)
+}
+
+func TestApi_ParseSilenceDetect_ShouldUseLastProgressTimeForPipedInput(t *testing.T) {
+	output := "Input #0, mp3, from 'pipe:0':\n  Duration: N/A, start: 0.025057, bitrate: N/A\n" +
+		"silence_start: 0\nsilence_end: 1.5 | silence_duration: 1.5\n" +
+		"size=N/A time=00:01:00.00 bitrate=N/A speed= 120x\rsize=N/A time=00:02:00.00 bitrate=N/A speed= 121x\n"
+
+	trim, err := parseSilenceDetect(output)
+	require.Nil(t, err)
+	require.Equal(t, 120.0, trim.OriginalDuration)
+	require.Equal(t, 1.5, trim.LeadingSilence)
+}
+
+func TestApi_ParseSilenceDetect_ShouldNotTrimAudioThatIsEntirelySilent(t *testing.T) {
+	trim, err := parseSilenceDetect("Duration: 00:00:10.00, start: 0.000000\nsilence_start: 0\nsilence_end: 10 | silence_duration: 10\n")
+	require.Nil(t, err)
+	require.Equal(t, &models.SilenceTrim{OriginalDuration: 10, TrimmedDuration: 10}, trim)
+	require.Nil(t, trimArgs(trim))
+}
+
+func TestApi_TrimArgs_ShouldSeekPastLeadingSilenceAndLimitDuration(t *testing.T) {
+	args := trimArgs(&models.SilenceTrim{OriginalDuration: 200, TrimmedDuration: 193.25, LeadingSilence: 2.5, TrailingSilence: 4.25})
+	require.Equal(t, []string{"-ss", "2.500", "-t", "193.250"}, args)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// getStreamURL returns a short-lived URL for a track's audio that works without an Authorization header, for use as
+// the source of an HTML5 audio element.
+func getStreamURL(handler dao.DbHandler, signer *service.URLSigner, baseURL string, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		expires := time.Now().Add(ttl)
+		signature, err := signer.Sign(service.SignedClaims{
+			Subject: "stream:" + id.Hex(),
+			Tenant:  dao.TenantFromContext(ctx),
+			Expires: expires.Unix(),
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Error signing stream URL")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, models.StreamURL{
+			URL:       externalURL(r, baseURL, versionedPath(r.Context(), "/track/"+id.Hex())+"?signature="+url.QueryEscape(signature)),
+			ExpiresAt: expires,
+		})
+		return
+	}
+}
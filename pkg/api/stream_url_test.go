@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_GetStreamURL_ShouldReturn404IfTrackNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}/stream-url", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getStreamURL(dbHandler, &service.URLSigner{Secret: []byte("test")}, "", time.Minute))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GetStreamURL_ShouldReturnURLAcceptedByGetTrackAudio(t *testing.T) {
+	signer := &service.URLSigner{Secret: []byte("test")}
+	dbHandler := &mocks.DbHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+	dbHandler.On("DownloadAudioFile", mock.Anything, mock.Anything).Return([]byte("test"), nil)
+	extHandler.On("ValidateToken", mock.Anything, mock.Anything).Return(models.Identity{}, nil).Once()
+
+	router := mux.NewRouter()
+	mountAPIVersions(router, []apiVersion{{name: "v1", routes: []apiRoute{
+		{"/track/{id}", http.MethodGet, authUserOrSigned, getTrackAudio(dbHandler, signer, nil)},
+		{"/track/{id}/stream-url", http.MethodGet, authUser, getStreamURL(dbHandler, signer, "", time.Minute)},
+	}}}, authenticator{ext: extHandler})
+
+	req, err := http.NewRequest(http.MethodGet, "/track/603ac4abd9ad8067f54a2778/stream-url", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var streamURL models.StreamURL
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &streamURL))
+
+	req, err = http.NewRequest(http.MethodGet, streamURL.URL, nil)
+	require.Nil(t, err)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "test", recorder.Body.String())
+	extHandler.AssertNumberOfCalls(t, "ValidateToken", 1)
+}
+
+func TestApi_GetTrackAudio_ShouldReturn401IfSignatureIsForAnotherTrack(t *testing.T) {
+	signer := &service.URLSigner{Secret: []byte("test")}
+	signature, err := signer.Sign(service.SignedClaims{Subject: "stream:603ac4abd9ad8067f54a2779", Expires: time.Now().Add(time.Minute).Unix()})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}?signature="+signature, nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTrackAudio(&mocks.DbHandler{}, signer, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestApi_GetTrackAudio_ShouldReturn404IfSignedTrackWasDeleted(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
+	signer := &service.URLSigner{Secret: []byte("test")}
+	signature, err := signer.Sign(service.SignedClaims{Subject: "stream:603ac4abd9ad8067f54a2778", Expires: time.Now().Add(time.Minute).Unix()})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}?signature="+signature, nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTrackAudio(dbHandler, signer, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxTagLength = 64
+
+// normalizeTags trims and lower-cases tags so "Workout" and "workout " are the same label, dropping duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, errors.New("tags cannot be empty")
+		} else if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags cannot be longer than %v characters", maxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+func addTrackTags(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		revision, err := ifMatchRevision(r)
+		if err != nil {
+			respondWithFieldError(w, "If-Match", err.Error())
+			return
+		}
+
+		var request models.TagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithBodyError(w, err, http.StatusBadRequest, "Error decoding request body")
+			return
+		}
+
+		tags, err := normalizeTags(request.Tags)
+		if err != nil {
+			respondWithFieldError(w, "tags", err.Error())
+			return
+		}
+		if len(tags) == 0 {
+			respondWithFieldError(w, "tags", "At least one tag is required")
+			return
+		}
+
+		if err := handler.AddTrackTags(ctx, id, tags, revision); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		} else if errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Track has been changed since it was read")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error adding tags to track")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		setNextRevisionETag(w, revision)
+		respondWithSuccess(w, http.StatusOK, "Tags added successfully")
+		return
+	}
+}
+
+func removeTrackTag(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		revision, err := ifMatchRevision(r)
+		if err != nil {
+			respondWithFieldError(w, "If-Match", err.Error())
+			return
+		}
+
+		tags, err := normalizeTags([]string{mux.Vars(r)["tag"]})
+		if err != nil {
+			respondWithFieldError(w, "tags", err.Error())
+			return
+		}
+
+		if err := handler.RemoveTrackTags(ctx, id, tags, revision); errors.Is(err, dao.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		} else if errors.Is(err, dao.ErrRevisionMismatch) {
+			respondWithError(w, http.StatusConflict, "Track has been changed since it was read")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error removing tag from track")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		setNextRevisionETag(w, revision)
+		respondWithSuccess(w, http.StatusOK, "Tag removed successfully")
+		return
+	}
+}
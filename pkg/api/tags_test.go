@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestApi_AddTrackTags_ShouldReturn400IfTagIsEmpty(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/tags", strings.NewReader(`{"tags":["workout"," "]}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTrackTags(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_AddTrackTags_ShouldReturn404IfTrackNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("AddTrackTags", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(dao.ErrNotFound)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/tags", strings.NewReader(`{"tags":["workout"]}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTrackTags(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_AddTrackTags_ShouldAddNormalizedTagsOnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("AddTrackTags", mock.Anything, mock.Anything, []string{"workout", "vinyl-rip"}, mock.Anything).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/tags", strings.NewReader(`{"tags":["Workout ","vinyl-rip","workout"]}`))
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(addTrackTags(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestApi_RemoveTrackTag_ShouldReturn500IfRemoveTrackTagsErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("RemoveTrackTags", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodDelete, "/track/{id}/tags/{tag}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778", "tag": "workout"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(removeTrackTag(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_RemoveTrackTag_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("RemoveTrackTags", mock.Anything, mock.Anything, []string{"workout"}, mock.Anything).Return(nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/track/{id}/tags/{tag}", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778", "tag": "Workout"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(removeTrackTag(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetTracks_ShouldFilterByAllGivenTags(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, map[string]interface{}{
+		"$or":  bson.A{bson.M{"artist": "test"}, bson.M{"featuredArtists": "test"}},
+		"tags": bson.M{"$all": []string{"workout", "vinyl-rip"}},
+	}).Return([]models.Track{}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks?artist=test&tag=workout&tag=Vinyl-Rip", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTracks(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
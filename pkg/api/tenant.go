@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// signedRoutes are the GET routes that take a "signature" query parameter in place of a bearer token, by path template,
+// with the prefix of the subject their signatures are minted for ahead of the id in the path.
+var signedRoutes = map[string]string{
+	"/track/{id}":             "stream:",
+	"/playlist/{id}/feed.xml": "feed:",
+}
+
+// queryTokenRoutes are the routes, by path template, whose auth policy also accepts the token as a "token" query
+// parameter, so the tenant is resolved from it there too.
+var queryTokenRoutes = map[string]bool{
+	"/radio":         true,
+	"/party/{id}/ws": true,
+}
+
+// tenantResolver works out which tenant's library a request belongs to, either from the first label of the request
+// host below baseDomain or from a claim in the bearer token. The token is only decoded here; it is still validated by
+// the login service when the route's auth policy asks for it, so a forged claim buys nothing but rejected requests. In
+// subdomain mode the token must also carry the subdomain's tenant in its claim, as any token the login service accepts
+// would otherwise reach every tenant's library; API keys need not, as they are only found in their own tenant's
+// library, and neither does the admin token, which is the server's. In token mode, API keys, which carry no claims,
+// are made for the tenant whose library keys finds them in, and the admin token for the tenant named by the X-Tenant
+// header, or for none on the server's own admin routes. Requests to signed routes are made for the tenant their
+// signature was minted for, once signer has verified it.
+type tenantResolver struct {
+	mode       string
+	baseDomain string
+	claim      string
+	signer     *service.URLSigner
+	adminToken string
+	tenants    tenantLister
+	keys       service.APIKeyStore
+	// keyTenants remembers the tenant each API key was found for, by the key's hash, as a key only ever belongs to one.
+	keyTenants *sync.Map
+}
+
+type tenantLister interface {
+	ListTenants(ctx context.Context) ([]string, error)
+}
+
+func (t tenantResolver) resolve(r *http.Request) (string, error) {
+	switch t.mode {
+	case "subdomain":
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		suffix := "." + t.baseDomain
+		if !strings.HasSuffix(host, suffix) {
+			return "", errors.New("request host is not a tenant subdomain")
+		}
+		tenant := strings.TrimSuffix(host, suffix)
+		if tenant == "" {
+			return "", errors.New("request host is not a tenant subdomain")
+		}
+		if err := t.checkMember(r, tenant); err != nil {
+			return "", err
+		}
+		return tenant, nil
+	case "token":
+		token, err := requestToken(r)
+		if err != nil {
+			return "", err
+		}
+		if t.isAdminToken(token) {
+			return r.Header.Get("X-Tenant"), nil
+		}
+		if service.IsAPIKey(token) {
+			return t.keyTenant(r.Context(), token)
+		}
+		return tokenClaim(token, t.claim)
+	}
+	return "", errors.New("unknown tenant mode")
+}
+
+func (t tenantResolver) isAdminToken(token string) bool {
+	return t.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.adminToken)) == 1
+}
+
+// keyTenant finds the tenant whose library holds an API key.
+func (t tenantResolver) keyTenant(ctx context.Context, key string) (string, error) {
+	hash := service.HashAPIKey(key)
+	if t.keyTenants != nil {
+		if tenant, ok := t.keyTenants.Load(hash); ok {
+			return tenant.(string), nil
+		}
+	}
+	if t.tenants == nil || t.keys == nil {
+		return "", errors.New("API keys cannot be used to resolve a tenant")
+	}
+
+	tenants, err := t.tenants.ListTenants(ctx)
+	if err != nil {
+		return "", statusError{errorStatus(err), err}
+	}
+	for _, tenant := range tenants {
+		tenantCtx, err := dao.WithTenant(ctx, tenant)
+		if err != nil {
+			continue
+		}
+		keys, err := t.keys.GetAPIKeys(tenantCtx, map[string]interface{}{"keyHash": hash})
+		if err != nil {
+			return "", statusError{errorStatus(err), err}
+		}
+		if len(keys) > 0 {
+			if t.keyTenants != nil {
+				t.keyTenants.Store(hash, tenant)
+			}
+			return tenant, nil
+		}
+	}
+	return "", statusError{http.StatusUnauthorized, errors.New("API key not found")}
+}
+
+// checkMember checks that the request's token is for the tenant its host names.
+func (t tenantResolver) checkMember(r *http.Request, tenant string) error {
+	token, err := requestToken(r)
+	if err != nil {
+		return err
+	}
+	if service.IsAPIKey(token) || t.isAdminToken(token) {
+		return nil
+	}
+
+	claimed, err := tokenClaim(token, t.claim)
+	if err != nil {
+		return err
+	}
+	if claimed != tenant {
+		return statusError{http.StatusForbidden, errors.New("token is not for this tenant")}
+	}
+	return nil
+}
+
+// requestToken returns the token a request is made with: the bearer token, or on the queryTokenRoutes the "token"
+// query parameter in its place, as authenticator.wrap reads it.
+func requestToken(r *http.Request) (string, error) {
+	if template, ok := routeTemplate(r); ok && queryTokenRoutes[template] {
+		if token := r.URL.Query().Get("token"); token != "" {
+			return token, nil
+		}
+	}
+	return getAuthToken(r)
+}
+
+func (t tenantResolver) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Share links and guest tokens carry their tenant in their signed token, which the handlers read once it has
+		// been verified, as does the share link oEmbed is asked about. The log level belongs to the server rather than
+		// any tenant.
+		path := unversionedPath(r.URL.Path)
+		if path == "/health" || path == "/ready" || path == "/log-level" || path == "/oembed" || strings.HasPrefix(path, "/shared/") ||
+			strings.HasPrefix(path, "/guest/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Signed requests are made for the tenant their signature was minted for, and only once it has been verified.
+		var tenant string
+		if subject, ok := signedSubject(r); ok {
+			claims, err := t.signer.Verify(r.URL.Query().Get("signature"))
+			if err != nil || claims.Subject != subject {
+				logrus.WithError(err).Error("Invalid signature")
+				respondWithError(w, http.StatusUnauthorized, "Authentication failed")
+				return
+			}
+			tenant = claims.Tenant
+		} else {
+			resolved, err := t.resolve(r)
+			if err != nil {
+				logrus.WithError(err).Error("Error resolving tenant")
+				status := http.StatusBadRequest
+				var withStatus statusError
+				if errors.As(err, &withStatus) {
+					status = withStatus.code
+				}
+				respondWithError(w, status, err.Error())
+				return
+			}
+			// Only the admin token is made for no tenant, on the server's own routes.
+			if resolved == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tenant = resolved
+		}
+
+		ctx, err := dao.WithTenant(r.Context(), tenant)
+		if err != nil {
+			logrus.WithError(err).Error("Error resolving tenant")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// signedSubject returns the subject a signed request to one of the signedRoutes must carry a signature for. ok is false
+// for requests without a signature and for other routes, where a signature is no substitute for a bearer token.
+func signedSubject(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet || r.URL.Query().Get("signature") == "" {
+		return "", false
+	}
+	template, ok := routeTemplate(r)
+	if !ok {
+		return "", false
+	}
+	prefix, ok := signedRoutes[template]
+	if !ok {
+		return "", false
+	}
+	return prefix + mux.Vars(r)["id"], true
+}
+
+// routeTemplate returns the path template of the route the request matched, without its version prefix.
+func routeTemplate(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return unversionedPath(template), true
+}
+
+// tokenClaim reads a string claim from the payload of a JWT without verifying its signature.
+func tokenClaim(token string, claim string) (string, error) {
+	claims, err := service.TokenClaims(token)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := claims[claim].(string)
+	if !ok || value == "" {
+		return "", errors.New("token has no " + claim + " claim")
+	}
+	return value, nil
+}
+
+// tenantContexts returns a context per tenant for background work, or just ctx when running single-tenant.
+func tenantContexts(ctx context.Context, tenants tenantLister) ([]context.Context, error) {
+	if tenants == nil {
+		return []context.Context{ctx}, nil
+	}
+
+	names, err := tenants.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var contexts []context.Context
+	for _, name := range names {
+		tenantCtx, err := dao.WithTenant(ctx, name)
+		if err != nil {
+			logrus.WithError(err).WithField("tenant", name).Warn("Skipping tenant with invalid name")
+			continue
+		}
+		contexts = append(contexts, tenantCtx)
+	}
+	return contexts, nil
+}
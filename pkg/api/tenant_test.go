@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testTenantLister struct {
+	tenants []string
+	err     error
+}
+
+func (l testTenantLister) ListTenants(ctx context.Context) ([]string, error) {
+	return l.tenants, l.err
+}
+
+func testJWT(payload string) string {
+	return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+func TestApi_TenantResolver_ShouldResolveTenantFromSubdomain(t *testing.T) {
+	resolver := tenantResolver{mode: "subdomain", baseDomain: "music.example.com", claim: "tenant"}
+
+	req, err := http.NewRequest(http.MethodGet, "http://acme.music.example.com:8002/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user","tenant":"acme"}`))
+
+	tenant, err := resolver.resolve(req)
+	require.Nil(t, err)
+	require.Equal(t, "acme", tenant)
+}
+
+func TestApi_TenantResolver_ShouldRequireSubdomainTokenToBeForTenant(t *testing.T) {
+	resolver := tenantResolver{mode: "subdomain", baseDomain: "music.example.com", claim: "tenant", adminToken: "admin"}
+
+	req, err := http.NewRequest(http.MethodGet, "http://acme.music.example.com/tracks", nil)
+	require.Nil(t, err)
+	_, err = resolver.resolve(req)
+	require.NotNil(t, err)
+
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user","tenant":"other"}`))
+	_, err = resolver.resolve(req)
+	require.Equal(t, http.StatusForbidden, errorStatus(err))
+
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user"}`))
+	_, err = resolver.resolve(req)
+	require.NotNil(t, err)
+
+	// API keys are only found in their own tenant's library, and the admin token is the server's.
+	for _, token := range []string{"msk_key", "admin"} {
+		req.Header.Set("Authorization", "Bearer "+token)
+		tenant, err := resolver.resolve(req)
+		require.Nil(t, err)
+		require.Equal(t, "acme", tenant)
+	}
+}
+
+func TestApi_TenantMiddleware_ShouldResolveTenantFromQueryTokenOnQueryTokenRoutes(t *testing.T) {
+	resolver := tenantResolver{mode: "token", claim: "tenant"}
+	var tenant string
+	router := mux.NewRouter()
+	router.Use(resolver.middleware)
+	router.HandleFunc("/v1/party/{id}/ws", func(w http.ResponseWriter, r *http.Request) {
+		tenant = dao.TenantFromContext(r.Context())
+	})
+	router.HandleFunc("/v1/tracks", func(w http.ResponseWriter, r *http.Request) {
+		tenant = dao.TenantFromContext(r.Context())
+	})
+	token := url.QueryEscape(testJWT(`{"sub":"user","tenant":"acme"}`))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/party/abc/ws?token="+token, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "acme", tenant)
+
+	tenant = ""
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/tracks?token="+token, nil))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Empty(t, tenant)
+}
+
+func TestApi_TenantResolver_ShouldReturnErrorIfHostIsNotATenantSubdomain(t *testing.T) {
+	resolver := tenantResolver{mode: "subdomain", baseDomain: "music.example.com"}
+
+	req, err := http.NewRequest(http.MethodGet, "http://music.example.com/tracks", nil)
+	require.Nil(t, err)
+
+	_, err = resolver.resolve(req)
+	require.NotNil(t, err)
+}
+
+func TestApi_TenantResolver_ShouldResolveTenantFromTokenClaim(t *testing.T) {
+	resolver := tenantResolver{mode: "token", claim: "tenant"}
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user","tenant":"acme"}`))
+
+	tenant, err := resolver.resolve(req)
+	require.Nil(t, err)
+	require.Equal(t, "acme", tenant)
+}
+
+func TestApi_TenantResolver_ShouldReturnErrorIfTokenHasNoTenantClaim(t *testing.T) {
+	resolver := tenantResolver{mode: "token", claim: "tenant"}
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user"}`))
+
+	_, err = resolver.resolve(req)
+	require.NotNil(t, err)
+	require.Equal(t, "token has no tenant claim", err.Error())
+}
+
+func TestApi_TenantResolver_ShouldResolveTenantOfAPIKeyAndAdminTokenInTokenMode(t *testing.T) {
+	keys := dao.NewMemoryHandler()
+	acme, err := dao.WithTenant(context.Background(), "acme")
+	require.Nil(t, err)
+	require.Nil(t, keys.AddAPIKey(acme, models.APIKey{ID: primitive.NewObjectID(), KeyHash: service.HashAPIKey("msk_key")}))
+	resolver := tenantResolver{
+		mode:       "token",
+		claim:      "tenant",
+		adminToken: "admin",
+		tenants:    testTenantLister{tenants: []string{"other", "acme"}},
+		keys:       keys,
+		keyTenants: &sync.Map{},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer msk_key")
+	tenant, err := resolver.resolve(req)
+	require.Nil(t, err)
+	require.Equal(t, "acme", tenant)
+
+	req.Header.Set("Authorization", "Bearer msk_unknown")
+	_, err = resolver.resolve(req)
+	require.Equal(t, http.StatusUnauthorized, errorStatus(err))
+
+	req.Header.Set("Authorization", "Bearer admin")
+	tenant, err = resolver.resolve(req)
+	require.Nil(t, err)
+	require.Empty(t, tenant)
+	req.Header.Set("X-Tenant", "acme")
+	tenant, err = resolver.resolve(req)
+	require.Nil(t, err)
+	require.Equal(t, "acme", tenant)
+}
+
+func TestApi_TenantMiddleware_ShouldLetAdminTokenThroughWithoutTenantInTokenMode(t *testing.T) {
+	resolver := tenantResolver{mode: "token", claim: "tenant", adminToken: "admin"}
+	reached := false
+	handler := resolver.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		require.Empty(t, dao.TenantFromContext(r.Context()))
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/admin/stats", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer admin")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.True(t, reached)
+}
+
+func TestApi_TenantMiddleware_ShouldReturn400IfTenantIsInvalid(t *testing.T) {
+	resolver := tenantResolver{mode: "subdomain", baseDomain: "example.com", claim: "tenant"}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called")
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "http://Bad$Tenant.example.com/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user","tenant":"Bad$Tenant"}`))
+
+	recorder := httptest.NewRecorder()
+	resolver.middleware(next).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_TenantMiddleware_ShouldAddTenantToRequestContext(t *testing.T) {
+	resolver := tenantResolver{mode: "subdomain", baseDomain: "example.com", claim: "tenant"}
+	var tenant string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = dao.TenantFromContext(r.Context())
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "http://acme.example.com/tracks", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user","tenant":"acme"}`))
+
+	recorder := httptest.NewRecorder()
+	resolver.middleware(next).ServeHTTP(recorder, req)
+	require.Equal(t, "acme", tenant)
+}
+
+func TestApi_TenantMiddleware_ShouldSkipHealthEndpoint(t *testing.T) {
+	resolver := tenantResolver{mode: "subdomain", baseDomain: "example.com", claim: "tenant"}
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/health", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	resolver.middleware(next).ServeHTTP(recorder, req)
+	require.True(t, called)
+}
+
+func TestApi_TenantMiddleware_ShouldOnlyTakeTenantFromVerifiedSignatureOnSignedRoutes(t *testing.T) {
+	signer := &service.URLSigner{Secret: []byte("test")}
+	resolver := tenantResolver{mode: "token", claim: "tenant", signer: signer}
+	var tenant string
+	next := func(w http.ResponseWriter, r *http.Request) {
+		tenant = dao.TenantFromContext(r.Context())
+	}
+	router := mux.NewRouter()
+	router.Use(resolver.middleware)
+	router.HandleFunc("/v1/track/{id}", next).Methods(http.MethodGet, http.MethodDelete)
+
+	signature, err := signer.Sign(service.SignedClaims{Subject: "stream:abc", Tenant: "acme", Expires: time.Now().Add(time.Hour).Unix()})
+	require.Nil(t, err)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/track/abc?signature="+url.QueryEscape(signature), nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "acme", tenant)
+
+	// A signature for another track is refused.
+	tenant = ""
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/track/def?signature="+url.QueryEscape(signature), nil))
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Empty(t, tenant)
+
+	// Elsewhere a signature does not stand in for the bearer token's tenant.
+	req := httptest.NewRequest(http.MethodDelete, "/v1/track/abc?signature=x", nil)
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"sub":"user","tenant":"other"}`))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "other", tenant)
+
+	tenant = ""
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/v1/track/abc?signature="+url.QueryEscape(signature), nil))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Empty(t, tenant)
+}
+
+func TestApi_TenantContexts_ShouldReturnContextPerTenant(t *testing.T) {
+	contexts, err := tenantContexts(context.Background(), testTenantLister{tenants: []string{"a", "b"}})
+	require.Nil(t, err)
+	require.Len(t, contexts, 2)
+	require.Equal(t, "b", dao.TenantFromContext(contexts[1]))
+
+	contexts, err = tenantContexts(context.Background(), nil)
+	require.Nil(t, err)
+	require.Len(t, contexts, 1)
+
+	_, err = tenantContexts(context.Background(), testTenantLister{err: errors.New("test")})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// streamThrottleBurst is how much audio is sent before throttling starts, so that playback starts at once.
+	streamThrottleBurst = 10 * time.Second
+	// streamThrottleChunk is how much is written between checks of the rate.
+	streamThrottleChunk = 32 << 10
+)
+
+// streamThrottle limits how fast audio is streamed to each connection to a multiple of the audio's bit rate, so that a
+// client downloading in bulk cannot saturate the server's uplink. roleMultiples sets the multiple of each token role,
+// falling back to multiple when the role is not known, and an API key's own StreamThrottle overrides both, with a
+// negative value lifting the limit for that key. A multiple of zero leaves streams unthrottled. defaultBitRate stands
+// in for the bit rate of audio that has not been probed.
+type streamThrottle struct {
+	multiple       float64
+	roleMultiples  map[string]float64
+	defaultBitRate int
+}
+
+// wrap throttles the responses of a streaming endpoint. The endpoint calls throttleStream with the bit rate of the
+// audio it streams before writing it.
+func (t streamThrottle) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		multiple := t.multipleFor(r)
+		if multiple <= 0 {
+			next(w, r)
+			return
+		}
+		next(&throttledWriter{ResponseWriter: w, ctx: r.Context(), multiple: multiple, bitRate: t.defaultBitRate}, r)
+	}
+}
+
+// multipleFor returns the multiple of the audio's bit rate the request may stream at, from its API key if it uses one
+// that sets its own, or else from the role of its token.
+func (t streamThrottle) multipleFor(r *http.Request) float64 {
+	multiple := t.multiple
+	if roleMultiple, ok := t.roleMultiples[roleFromContext(r.Context())]; ok {
+		multiple = roleMultiple
+	}
+
+	caller, ok := principalFromContext(r.Context())
+	if !ok || caller.apiKey == nil || caller.apiKey.StreamThrottle == 0 {
+		return multiple
+	}
+	return caller.apiKey.StreamThrottle
+}
+
+// throttleStream sets the bit rate of the audio a throttled response streams, which its limit is a multiple of. A
+// bit rate of zero, for audio that has not been probed, keeps the default.
+func throttleStream(w http.ResponseWriter, bitRate int) {
+	if throttled, ok := w.(*throttledWriter); ok && bitRate > 0 {
+		throttled.bitRate = bitRate
+	}
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	multiple float64
+	bitRate  int
+
+	start   time.Time
+	written int64
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	if w.start.IsZero() {
+		w.start = time.Now()
+	}
+	rate := w.multiple * float64(w.bitRate) / 8
+	burst := int64(float64(w.bitRate) / 8 * streamThrottleBurst.Seconds())
+
+	total := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > streamThrottleChunk {
+			chunk = chunk[:streamThrottleChunk]
+		}
+
+		// Sleep until the bytes written with this chunk, less the burst, are within the rate since the stream started.
+		if ahead := w.written + int64(len(chunk)) - burst; ahead > 0 {
+			due := w.start.Add(time.Duration(float64(ahead) / rate * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-w.ctx.Done():
+					timer.Stop()
+					return total, w.ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+
+		// A throttled stream is meant to take longer than the write deadline, so each chunk gets its own instead.
+		setWriteDeadline(w.ctx, time.Now().Add(writeTimeout))
+		n, err := w.ResponseWriter.Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
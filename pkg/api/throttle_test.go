@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStreamThrottle_ShouldLimitStreamToMultipleOfBitRateAfterBurst(t *testing.T) {
+	handler := streamThrottle{multiple: 2, defaultBitRate: 320000}.wrap(func(w http.ResponseWriter, r *http.Request) {
+		// 80kbps at twice realtime is 20000 bytes a second, after a burst of ten seconds of audio, 100000 bytes.
+		throttleStream(w, 80000)
+		_, err := w.Write(make([]byte, 110000))
+		require.Nil(t, err)
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}", http.NoBody)
+	require.Nil(t, err)
+	recorder := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(recorder, req)
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(400*time.Millisecond))
+	require.Equal(t, 110000, recorder.Body.Len())
+}
+
+func TestStreamThrottle_ShouldLetAPIKeyLiftLimit(t *testing.T) {
+	ctx := context.Background()
+	keys := dao.NewMemoryHandler()
+	key, hash, err := service.GenerateAPIKey()
+	require.Nil(t, err)
+	require.Nil(t, keys.AddAPIKey(ctx, models.APIKey{ID: primitive.NewObjectID(), Name: "backup", KeyHash: hash, StreamThrottle: -1}))
+
+	login := &mocks.ExtHandler{}
+	login.On("ValidateToken", mock.Anything, "login-token").Return(models.Identity{UserID: "user"}, nil)
+
+	throttled := map[string]bool{}
+	authn := authenticator{ext: &service.APIKeyHandler{Keys: keys, Next: login}}
+	handler := authn.wrap(authUser, streamThrottle{multiple: 2, defaultBitRate: 320000}.wrap(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(*throttledWriter)
+		throttled[r.Header.Get("Authorization")] = ok
+	}))
+
+	for _, token := range []string{key, "login-token"} {
+		req, err := http.NewRequest(http.MethodGet, "/track/{id}", http.NoBody)
+		require.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Equal(t, map[string]bool{"Bearer " + key: false, "Bearer login-token": true}, throttled)
+}
+
+func TestStreamThrottle_ShouldUseMultipleOfTokenRole(t *testing.T) {
+	var multiple float64
+	handler := tokenRoles{adminToken: "admin"}.middleware(streamThrottle{
+		multiple:       2,
+		roleMultiples:  map[string]float64{models.RoleAdmin: 0, models.RoleGuest: 1},
+		defaultBitRate: 320000,
+	}.wrap(func(w http.ResponseWriter, r *http.Request) {
+		multiple = 0
+		if throttled, ok := w.(*throttledWriter); ok {
+			multiple = throttled.multiple
+		}
+	}))
+
+	for token, expected := range map[string]float64{"admin": 0, "": 1} {
+		req, err := http.NewRequest(http.MethodGet, "/track/{id}", http.NoBody)
+		require.Nil(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		require.Equal(t, expected, multiple, token)
+	}
+}
+
+func TestStreamThrottle_ShouldKeepStreamingPastWriteDeadline(t *testing.T) {
+	handler := streamThrottle{multiple: 2, defaultBitRate: 320000}.wrap(func(w http.ResponseWriter, r *http.Request) {
+		// 80kbps at twice realtime is 20000 bytes a second, so the 4000 bytes past the burst take 200ms.
+		throttleStream(w, 80000)
+		_, err := w.Write(make([]byte, 104000))
+		require.Nil(t, err)
+	})
+	server := httptest.NewUnstartedServer(limitWrites(100*time.Millisecond, handler))
+	server.Config.ConnContext = rememberConn
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Len(t, body, 104000)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsSettings configures optional TLS termination, either from a static certificate and key or from certificates
+// obtained from Let's Encrypt for the listed domains. When TLS is enabled and redirectAddr is set, plain HTTP requests
+// on that address are redirected to HTTPS.
+type tlsSettings struct {
+	certFile        string
+	keyFile         string
+	autocertDomains []string
+	autocertCache   string
+	autocertEmail   string
+	redirectAddr    string
+}
+
+func tlsSettingsFromEnv() tlsSettings {
+	settings := tlsSettings{
+		certFile:      os.Getenv("TLS_CERT_FILE"),
+		keyFile:       os.Getenv("TLS_KEY_FILE"),
+		autocertCache: getEnv("TLS_AUTOCERT_CACHE_DIR", "certs"),
+		autocertEmail: os.Getenv("TLS_AUTOCERT_EMAIL"),
+		redirectAddr:  getEnv("TLS_REDIRECT_ADDR", ":80"),
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			settings.autocertDomains = append(settings.autocertDomains, domain)
+		}
+	}
+	return settings
+}
+
+// serve starts the server, terminating TLS itself if configured to.
+func serve(server *http.Server, settings tlsSettings) error {
+	switch {
+	case len(settings.autocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(settings.autocertDomains...),
+			Cache:      autocert.DirCache(settings.autocertCache),
+			Email:      settings.autocertEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+
+		// The HTTP listener is needed for Let's Encrypt's HTTP-01 challenges even when redirects are not wanted.
+		redirectAddr := settings.redirectAddr
+		if redirectAddr == "" {
+			redirectAddr = ":80"
+		}
+		go serveRedirect(redirectAddr, manager.HTTPHandler(redirectToHTTPS(server.Addr)))
+
+		logrus.WithField("domains", settings.autocertDomains).Info("Starting API server with Let's Encrypt certificates...")
+		return server.ListenAndServeTLS("", "")
+	case settings.certFile != "" || settings.keyFile != "":
+		if settings.redirectAddr != "" {
+			go serveRedirect(settings.redirectAddr, redirectToHTTPS(server.Addr))
+		}
+
+		logrus.Info("Starting API server with TLS...")
+		return server.ListenAndServeTLS(settings.certFile, settings.keyFile)
+	}
+
+	logrus.Info("Starting API server...")
+	return server.ListenAndServe()
+}
+
+func serveRedirect(addr string, handler http.Handler) {
+	redirect := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	if err := redirect.ListenAndServe(); err != nil {
+		logrus.WithError(err).Error("Error serving HTTP redirects")
+	}
+}
+
+// redirectToHTTPS sends requests to the same host and path on the TLS listener at tlsAddr.
+func redirectToHTTPS(tlsAddr string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApi_RedirectToHTTPS_ShouldRedirectToDefaultPort(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://music.example.com/tracks?name=test", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	redirectToHTTPS(":443").ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusMovedPermanently, recorder.Code)
+	require.Equal(t, "https://music.example.com/tracks?name=test", recorder.Header().Get("Location"))
+}
+
+func TestApi_RedirectToHTTPS_ShouldKeepNonDefaultPort(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://music.example.com:8080/tracks", nil)
+	require.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	redirectToHTTPS(":8002").ServeHTTP(recorder, req)
+	require.Equal(t, "https://music.example.com:8002/tracks", recorder.Header().Get("Location"))
+}
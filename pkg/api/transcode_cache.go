@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// transcodeCache keeps audio transcoded on the fly on disk, so that playing a track again in the same format, at the
+// same bit rate and gain, is served without running ffmpeg again. Entries are named after the audio file transcoded
+// rather than the track alone, so audio replaced since is never served from the cache. Each entry stored evicts the
+// entries used least recently once the cache grows past maxBytes.
+type transcodeCache struct {
+	dir      string
+	maxBytes int64
+
+	// evicting is set while an eviction started by a store is running, so that stores made meanwhile don't start more.
+	evicting int32
+}
+
+// transcodeCacheKey names the entry for a track's audio file transcoded by the transcoder.
+func transcodeCacheKey(tenant string, trackID primitive.ObjectID, audioFileID primitive.ObjectID, transcoder *library.Transcoder) string {
+	spec := fmt.Sprintf("%v\x00%v\x00%v\x00%v\x00%v\x00%d\x00%.2f", tenant, trackID.Hex(), audioFileID.Hex(),
+		transcoder.Format.Container, transcoder.Format.Codec, transcoder.BitRate(), transcoder.Gain)
+	sum := sha256.Sum256([]byte(spec))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the cached entry with the given key, if there is one.
+func (c *transcodeCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	audio, err := ioutil.ReadFile(filepath.Join(c.dir, key))
+	if err != nil {
+		return nil, false
+	}
+	if err := touchCacheEntry(filepath.Join(c.dir, key)); err != nil {
+		logrus.WithError(err).Debug("Error marking transcode cache entry used")
+	}
+	return audio, true
+}
+
+// store caches transcoded audio under the given key, making room for it in the background. Failing to cache is only
+// logged, as the audio can still be served.
+func (c *transcodeCache) store(key string, audio []byte) {
+	if c == nil || int64(len(audio)) > c.maxBytes {
+		return
+	}
+	if err := writeCacheEntry(c.dir, key, audio); err != nil {
+		logrus.WithError(err).Warn("Error caching transcoded audio")
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&c.evicting, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&c.evicting, 0)
+			if err := c.evict()(context.Background()); err != nil {
+				logrus.WithError(err).Warn("Error evicting transcode cache entries")
+			}
+		}()
+	}
+}
+
+// evict keeps the cache within maxBytes, deleting the entries used least recently first. It is also scheduled, to
+// catch up after a failed eviction or a lowered limit.
+func (c *transcodeCache) evict() scheduler.Func {
+	return func(ctx context.Context) error {
+		if c == nil {
+			return nil
+		}
+		evicted, err := evictLeastRecentlyUsed(c.dir, c.maxBytes)
+		if evicted > 0 {
+			logrus.WithField("entries", evicted).Info("Evicted transcode cache entries")
+		}
+		return err
+	}
+}
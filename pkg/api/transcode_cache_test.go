@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_StreamGain_ShouldServeRepeatedTranscodesFromCache(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	runs := filepath.Join(t.TempDir(), "runs")
+	ffmpeg := stubFFmpeg(t, `cat > /dev/null; echo run >> `+runs+`; echo "$@"`)
+	track, err := library.StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "test"}, testAudio)
+	require.Nil(t, err)
+	gain := library.NewReplayGain(track.AudioFileID, -12, -1, 180)
+	track.ReplayGain = &gain
+
+	gains := &streamGain{ffmpeg: ffmpeg, mode: library.ReplayGainOff, cache: &transcodeCache{dir: t.TempDir(), maxBytes: 1 << 20}}
+	first, mode, err := gains.audio(ctx, handler, library.ReplayGainTrack, track, "")
+	require.Nil(t, err)
+	require.Equal(t, library.ReplayGainTrack, mode)
+	second, mode, err := gains.audio(ctx, handler, library.ReplayGainTrack, track, "")
+	require.Nil(t, err)
+	require.Equal(t, library.ReplayGainTrack, mode)
+	require.Equal(t, first, second)
+
+	output, err := ioutil.ReadFile(runs)
+	require.Nil(t, err)
+	require.Equal(t, 1, strings.Count(string(output), "run"))
+
+	// Audio streamed as it is never goes through the cache.
+	audio, mode, err := gains.audio(ctx, handler, library.ReplayGainOff, track, "")
+	require.Nil(t, err)
+	require.Equal(t, library.ReplayGainOff, mode)
+	require.Equal(t, testAudio, audio)
+}
+
+func TestApi_TranscodeCacheKey_ShouldDifferByAudioFileAndOutput(t *testing.T) {
+	trackID, audioFileID := primitive.NewObjectID(), primitive.NewObjectID()
+	transcoder := &library.Transcoder{Format: library.StreamFormats["mp3"], Bitrate: "192k", Gain: -6}
+	key := transcodeCacheKey("", trackID, audioFileID, transcoder)
+	require.Equal(t, key, transcodeCacheKey("", trackID, audioFileID, &library.Transcoder{Format: library.StreamFormats["mp3"], Bitrate: "192k", Gain: -6}))
+
+	require.NotEqual(t, key, transcodeCacheKey("other", trackID, audioFileID, transcoder))
+	require.NotEqual(t, key, transcodeCacheKey("", trackID, primitive.NewObjectID(), transcoder))
+	require.NotEqual(t, key, transcodeCacheKey("", trackID, audioFileID, &library.Transcoder{Format: library.StreamFormats["mp3"], Bitrate: "128k", Gain: -6}))
+	require.NotEqual(t, key, transcodeCacheKey("", trackID, audioFileID, &library.Transcoder{Format: library.StreamFormats["mp3"], Bitrate: "192k", Gain: -3}))
+}
+
+func TestApi_TranscodeCache_Evict_ShouldRemoveLeastRecentlyUsedEntries(t *testing.T) {
+	cache := &transcodeCache{dir: t.TempDir(), maxBytes: 200}
+	writeAged(t, filepath.Join(cache.dir, "a"), 100, 3*time.Hour)
+	writeAged(t, filepath.Join(cache.dir, "b"), 100, 2*time.Hour)
+	writeAged(t, filepath.Join(cache.dir, "c"), 100, time.Hour)
+	_, ok := cache.get("a")
+	require.True(t, ok)
+
+	require.Nil(t, cache.evict()(context.Background()))
+
+	remaining, err := filepath.Glob(filepath.Join(cache.dir, "*"))
+	require.Nil(t, err)
+	require.ElementsMatch(t, []string{filepath.Join(cache.dir, "a"), filepath.Join(cache.dir, "c")}, remaining)
+
+	// Entries larger than the whole cache are not kept.
+	cache.store("d", make([]byte, 300))
+	_, ok = cache.get("d")
+	require.False(t, ok)
+}
+
+func TestApi_TranscodeCache_ShouldDoNothingWhenTurnedOff(t *testing.T) {
+	var cache *transcodeCache
+	cache.store("a", testAudio)
+	_, ok := cache.get("a")
+	require.False(t, ok)
+	require.Nil(t, cache.evict()(context.Background()))
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+// validateUpload checks that an uploaded file is audio that can be played, if a validator is configured, and returns
+// what was probed of it. It writes an error response and returns false if the file is corrupt, empty or silent, or
+// could not be checked.
+func validateUpload(ctx context.Context, w http.ResponseWriter, validator service.AudioValidator, audio io.Reader) (*models.AudioInfo, bool) {
+	info, err := validateAudio(ctx, validator, audio)
+	if err != nil {
+		respondWithStatusError(w, err)
+		return nil, false
+	}
+	return info, true
+}
+
+// validateAudio checks that a file is audio that can be played, if a validator is configured, so broken files are
+// turned away when they are added rather than failing when they are played. Files that are not are rejected with a 422
+// giving the reason.
+func validateAudio(ctx context.Context, validator service.AudioValidator, audio io.Reader) (*models.AudioInfo, error) {
+	if validator == nil {
+		return nil, nil
+	}
+
+	info, err := validator.Validate(ctx, audio)
+	if errors.Is(err, service.ErrInvalidAudio) {
+		logrus.WithError(err).Warn("Rejected invalid audio")
+		return nil, statusError{code: http.StatusUnprocessableEntity, err: err}
+	} else if err != nil {
+		logrus.WithError(err).Error("Error validating audio")
+		return nil, fmt.Errorf("error validating audio: %w", err)
+	}
+	return info, nil
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_UploadAudioBytes_ShouldReturn422WithProbeErrorIfAudioIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	validator := &mocks.AudioValidator{}
+	validator.On("Validate", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: moov atom not found", service.ErrInvalidAudio))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadAudioBytes(dbHandler, enrichers{}, nil, validator, nil))
+	httpHandler.ServeHTTP(recorder, audioBytesRequest(t))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "moov atom not found")
+	dbHandler.AssertNotCalled(t, "UploadAudioFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UploadAudioBytes_ShouldReturn500IfValidationFails(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	validator := &mocks.AudioValidator{}
+	validator.On("Validate", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadAudioBytes(dbHandler, enrichers{}, nil, validator, nil))
+	httpHandler.ServeHTTP(recorder, audioBytesRequest(t))
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	dbHandler.AssertNotCalled(t, "UploadAudioFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UploadAudioBytes_ShouldStoreValidAudio(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	validator := &mocks.AudioValidator{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.Anything).Return(nil)
+	validator.On("Validate", mock.Anything, mock.Anything).Return(&models.AudioInfo{Container: "mp3", Codec: "mp3", Duration: 1}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadAudioBytes(dbHandler, enrichers{}, nil, validator, nil))
+	httpHandler.ServeHTTP(recorder, audioBytesRequest(t))
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	validator.AssertExpectations(t)
+}
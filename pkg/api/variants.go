@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const qualityOriginal = "original"
+
+var (
+	qualityNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	bitratePattern     = regexp.MustCompile(`^[0-9]+k$`)
+)
+
+// parseVariants reads the quality variants to store for each upload from a list such as "low=64k,medium=128k", each
+// transcoded to the given format at its bitrate.
+func parseVariants(spec string, ffmpeg string, format library.StreamFormat) ([]library.Variant, error) {
+	var variants []library.Variant
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !qualityNamePattern.MatchString(parts[0]) || !bitratePattern.MatchString(parts[1]) {
+			return nil, fmt.Errorf("invalid audio variant %q, expected a name and a bitrate such as low=64k", entry)
+		}
+		if parts[0] == qualityOriginal || seen[parts[0]] {
+			return nil, fmt.Errorf("audio variant name %q is reserved or repeated", parts[0])
+		}
+		seen[parts[0]] = true
+
+		variants = append(variants, library.Variant{
+			Quality:    parts[0],
+			Transcoder: &library.Transcoder{FFmpeg: ffmpeg, Format: format, Bitrate: parts[1]},
+		})
+	}
+	return variants, nil
+}
+
+// audioFileForQuality picks the file to serve for the requested quality: a variant by name, the original upload, or
+// the track's main audio for an empty quality. Tracks stored before a variant was configured, or that were never
+// transcoded, fall back to their main audio.
+func audioFileForQuality(track models.Track, quality string) primitive.ObjectID {
+	if quality == qualityOriginal && track.Original != nil {
+		return track.Original.AudioFileID
+	}
+	for _, variant := range track.Variants {
+		if variant.Quality == quality {
+			return variant.AudioFileID
+		}
+	}
+	return track.AudioFileID
+}
+
+// audioBitRate returns the bit rate of the file audioFileForQuality picks, or 0 if it has not been probed.
+func audioBitRate(track models.Track, quality string) int {
+	if quality == qualityOriginal && track.Original != nil {
+		if track.Original.AudioInfo != nil {
+			return track.Original.AudioInfo.BitRate
+		}
+		return 0
+	}
+	for _, variant := range track.Variants {
+		if variant.Quality == quality {
+			return variant.BitRate
+		}
+	}
+	if track.AudioInfo != nil {
+		return track.AudioInfo.BitRate
+	}
+	return 0
+}
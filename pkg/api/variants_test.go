@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_ParseVariants_ShouldReadQualitiesAndBitrates(t *testing.T) {
+	variants, err := parseVariants("low=64k, medium=128k", "ffmpeg", library.StreamFormats["opus"])
+	require.Nil(t, err)
+	require.Len(t, variants, 2)
+	require.Equal(t, "low", variants[0].Quality)
+	require.Equal(t, "64k", variants[0].Transcoder.Bitrate)
+	require.Equal(t, "medium", variants[1].Quality)
+	require.Equal(t, "128k", variants[1].Transcoder.Bitrate)
+}
+
+func TestApi_ParseVariants_ShouldRejectInvalidEntries(t *testing.T) {
+	for _, spec := range []string{"low", "low=fast", "original=64k", "low=64k,low=96k"} {
+		_, err := parseVariants(spec, "ffmpeg", library.StreamFormats["mp3"])
+		require.NotNil(t, err, spec)
+	}
+}
+
+func TestApi_AudioFileForQuality_ShouldFallBackToMainAudio(t *testing.T) {
+	track := models.Track{
+		AudioFileID: primitive.NewObjectID(),
+		Original:    &models.OriginalAudio{AudioFileID: primitive.NewObjectID()},
+		Variants:    []models.AudioVariant{{Quality: "low", AudioFileID: primitive.NewObjectID()}},
+	}
+
+	require.Equal(t, track.AudioFileID, audioFileForQuality(track, ""))
+	require.Equal(t, track.Variants[0].AudioFileID, audioFileForQuality(track, "low"))
+	require.Equal(t, track.Original.AudioFileID, audioFileForQuality(track, "original"))
+	require.Equal(t, track.AudioFileID, audioFileForQuality(track, "medium"))
+	require.Equal(t, track.AudioFileID, audioFileForQuality(models.Track{AudioFileID: track.AudioFileID}, "original"))
+}
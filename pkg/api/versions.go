@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/service"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// replaceTrackAudio swaps a track's audio for the uploaded file, keeping the old audio as a version that can be
+// restored later.
+func replaceTrackAudio(handler dao.DbHandler, retain int, scanner service.Scanner, validator service.AudioValidator, fingerprinter service.Fingerprinter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		f, _, err := r.FormFile("input")
+		if err != nil {
+			logrus.WithError(err).Error("Failed to find file with key 'input'")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				logrus.WithError(err).Error("Error closing file")
+			}
+		}()
+
+		buf := bytes.NewBuffer(nil)
+		if _, err := io.Copy(buf, f); err != nil {
+			logrus.WithError(err).Error("Error reading file")
+			respondWithBodyError(w, err, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		if !scanUpload(ctx, w, scanner, bytes.NewReader(buf.Bytes())) {
+			return
+		}
+		info, ok := validateUpload(ctx, w, validator, bytes.NewReader(buf.Bytes()))
+		if !ok {
+			return
+		}
+
+		track, err := library.ReplaceAudio(ctx, handler, tracks[0], buf.Bytes(), fingerprintUpload(ctx, fingerprinter, bytes.NewReader(buf.Bytes())), info, retain)
+		if errors.Is(err, library.ErrNotAudio) {
+			logrus.WithError(err).Error("Rejected upload that is not audio")
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error replacing track audio")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, track)
+		return
+	}
+}
+
+func getTrackVersions(handler dao.DbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, tracks[0].Versions)
+		return
+	}
+}
+
+func restoreTrackVersion(handler dao.DbHandler, retain int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		versionID, err := primitive.ObjectIDFromHex(mux.Vars(r)["versionid"])
+		if err != nil {
+			logrus.WithError(err).Error("Error creating objectID from hex")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			logrus.WithError(err).Error("Error getting track")
+			respondWithStatusError(w, err)
+			return
+		}
+		if len(tracks) == 0 {
+			respondWithError(w, http.StatusNotFound, "Track not found")
+			return
+		}
+
+		track, err := library.RestoreVersion(ctx, handler, tracks[0], versionID, retain)
+		if err == library.ErrVersionNotFound {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error restoring track version")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		respondWithSuccess(w, http.StatusOK, track)
+		return
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func audioUploadRequest(t *testing.T, url string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("input", "test.mp3")
+	require.Nil(t, err)
+	_, err = part.Write(testAudio)
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPut, url, body)
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer test")
+	return req
+}
+
+func TestApi_ReplaceTrackAudio_ShouldReturn400IfNoFileWithKeyInputFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodPut, "/track/{id}/audio", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(replaceTrackAudio(dbHandler, 5, nil, nil, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_ReplaceTrackAudio_ShouldReturn404IfTrackNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
+
+	req := mux.SetURLVars(audioUploadRequest(t, "/track/{id}/audio"), map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(replaceTrackAudio(dbHandler, 5, nil, nil, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_ReplaceTrackAudio_ShouldReturn200AndKeepPreviousAudioAsVersion(t *testing.T) {
+	previous := primitive.NewObjectID()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{AudioFileID: previous}}, nil)
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
+	dbHandler.On("SetTrackAudio", mock.Anything, mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return len(track.Versions) == 1 && track.Versions[0].AudioFileID == previous && track.Container == "mp3"
+	})).Return(nil)
+
+	req := mux.SetURLVars(audioUploadRequest(t, "/track/{id}/audio"), map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(replaceTrackAudio(dbHandler, 5, nil, nil, nil))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetTrackVersions_ShouldReturn400IfInvalidIDProvided(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}/versions", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "test"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTrackVersions(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetTrackVersions_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{
+		Versions: []models.AudioVersion{{AudioFileID: primitive.NewObjectID()}},
+	}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/track/{id}/versions", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getTrackVersions(dbHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_RestoreTrackVersion_ShouldReturn404IfVersionNotFound(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{}}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/versions/{versionid}/restore", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778", "versionid": "603ac4abd9ad8067f54a2779"})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(restoreTrackVersion(dbHandler, 5))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_RestoreTrackVersion_ShouldReturn200OnSuccess(t *testing.T) {
+	version, err := primitive.ObjectIDFromHex("603ac4abd9ad8067f54a2779")
+	require.Nil(t, err)
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{
+		Versions: []models.AudioVersion{{AudioFileID: version}},
+	}}, nil)
+	dbHandler.On("SetTrackAudio", mock.Anything, mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.AudioFileID == version
+	})).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/track/{id}/versions/{versionid}/restore", nil)
+	require.Nil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"id": "603ac4abd9ad8067f54a2778", "versionid": version.Hex()})
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(restoreTrackVersion(dbHandler, 5))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
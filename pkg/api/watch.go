@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/service"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// watchRetryInterval is how long a file the watch folder failed to import for a reason other than the file itself,
+// such as the database or scanner being unreachable, is left before it is tried again.
+const watchRetryInterval = time.Minute
+
+// watchFolder imports audio files dropped into a directory into the default library, as a drop box for rips. Each file
+// is imported once it has been left alone for settle, so that files still being copied in are not picked up half
+// written. Imported files, and those already in the library, are moved to archive, or deleted if there is none; files
+// that are not audio, fail validation or are infected are moved to rejected. Subdirectories are not watched.
+type watchFolder struct {
+	handler   dao.DbHandler
+	validator service.AudioValidator
+	scanner   service.Scanner
+	locks     importLocks
+	dir       string
+	archive   string
+	rejected  string
+	settle    time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+}
+
+// run watches the directory until ctx is done, first picking up any files dropped while the API was not running.
+func (f *watchFolder) run(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.WithError(err).Error("Error starting watch folder")
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(f.dir); err != nil {
+		logrus.WithError(err).WithField("directory", f.dir).Error("Error watching directory")
+		return
+	}
+	logrus.WithField("directory", f.dir).Info("Watching directory for files to import")
+
+	entries, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		logrus.WithError(err).WithField("directory", f.dir).Error("Error listing watched directory")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			f.schedule(ctx, filepath.Join(f.dir, entry.Name()), f.settle)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.stop()
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				f.schedule(ctx, event.Name, f.settle)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logrus.WithError(err).WithField("directory", f.dir).Error("Error watching directory")
+		}
+	}
+}
+
+// schedule imports a file once it has been left alone for wait, putting the import back if the file is written to in
+// the meantime.
+func (f *watchFolder) schedule(ctx context.Context, path string, wait time.Duration) {
+	if ctx.Err() != nil || !library.IsAudioFile(path) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending == nil {
+		f.pending = make(map[string]*time.Timer)
+	}
+	if timer, ok := f.pending[path]; ok {
+		timer.Stop()
+	}
+	f.pending[path] = time.AfterFunc(wait, func() {
+		f.mu.Lock()
+		delete(f.pending, path)
+		f.mu.Unlock()
+
+		if retry := f.process(ctx, path); retry {
+			f.schedule(ctx, path, watchRetryInterval)
+		}
+	})
+}
+
+func (f *watchFolder) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for path, timer := range f.pending {
+		timer.Stop()
+		delete(f.pending, path)
+	}
+}
+
+// process imports a file from the directory, then archives, deletes or rejects it. It returns true if the file should
+// be tried again later, as it could not be imported for a reason other than the file itself.
+func (f *watchFolder) process(ctx context.Context, path string) bool {
+	log := logrus.WithField("file", path)
+
+	unlock, err := f.locks.acquire(ctx, "watch", filepath.Base(path))
+	if errors.Is(err, service.ErrLocked) {
+		// Another replica watching the same directory is importing it.
+		return false
+	} else if err != nil {
+		log.WithError(err).Error("Error acquiring watch folder lock")
+		return true
+	}
+	defer unlock()
+
+	audio, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false
+	} else if err != nil {
+		log.WithError(err).Error("Error reading file to import")
+		return true
+	}
+
+	if _, err := scanAudio(ctx, f.scanner, bytes.NewReader(audio)); err != nil {
+		var status statusError
+		if errors.As(err, &status) && status.code == http.StatusUnprocessableEntity {
+			f.reject(log, path, err)
+			return false
+		}
+		return true
+	}
+
+	track, err := library.ImportFile(ctx, f.handler, filepath.Base(path), audio, f.validator)
+	switch {
+	case errors.Is(err, library.ErrAlreadyImported):
+		log.WithField("track", track.ID.Hex()).Info("Watched file already imported")
+	case errors.Is(err, library.ErrNotAudio) || errors.Is(err, service.ErrInvalidAudio):
+		f.reject(log, path, err)
+		return false
+	case err != nil:
+		log.WithError(err).Error("Error importing watched file")
+		return true
+	default:
+		log.WithField("track", track.ID.Hex()).Info("Imported watched file")
+	}
+
+	if f.archive == "" {
+		if err := os.Remove(path); err != nil {
+			log.WithError(err).Error("Error deleting imported file")
+		}
+	} else if err := moveFile(path, f.archive); err != nil {
+		log.WithError(err).Error("Error archiving imported file")
+	}
+	return false
+}
+
+func (f *watchFolder) reject(log *logrus.Entry, path string, reason error) {
+	log.WithError(reason).Warn("Rejected watched file")
+	if err := moveFile(path, f.rejected); err != nil {
+		log.WithError(err).Error("Error moving rejected file")
+	}
+}
+
+// moveFile moves a file into dir, creating dir if need be. A file of the same name already there is kept, by adding
+// the time to the name of the one moved. Files are copied where they cannot be renamed, as across file systems.
+func moveFile(path string, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(dir, fmt.Sprintf("%v-%v%v", strings.TrimSuffix(name, ext), time.Now().UnixNano(), ext))
+	}
+	if err := os.Rename(path, target); err == nil {
+		return nil
+	}
+
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	copied, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(copied, source); err != nil {
+		copied.Close()
+		return err
+	}
+	if err := copied.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
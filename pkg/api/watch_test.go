@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/stretchr/testify/require"
+)
+
+type rejectingValidator struct{}
+
+func (rejectingValidator) Validate(ctx context.Context, audio io.Reader) (*models.AudioInfo, error) {
+	return nil, fmt.Errorf("%w: the audio is silent", service.ErrInvalidAudio)
+}
+
+func newTestWatchFolder(t *testing.T, handler dao.DbHandler) (*watchFolder, func()) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.Nil(t, err)
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "incoming"), 0755))
+	return &watchFolder{
+		handler:  handler,
+		dir:      filepath.Join(dir, "incoming"),
+		archive:  filepath.Join(dir, "archive"),
+		rejected: filepath.Join(dir, "rejected"),
+		settle:   10 * time.Millisecond,
+	}, func() { os.RemoveAll(dir) }
+}
+
+func TestApi_WatchFolder_ShouldImportDroppedFilesAndArchiveThem(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := dao.NewMemoryHandler()
+	watch, cleanup := newTestWatchFolder(t, handler)
+	defer cleanup()
+
+	// Files already there when the watch starts are picked up as well as those dropped later.
+	require.Nil(t, ioutil.WriteFile(filepath.Join(watch.dir, "before.mp3"), testAudio, 0644))
+	go watch.run(ctx)
+	time.Sleep(50 * time.Millisecond)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(watch.dir, "after.mp3"), append(testAudio, 1), 0644))
+
+	require.Eventually(t, func() bool {
+		tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+		return err == nil && len(tracks) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		archived, _ := ioutil.ReadDir(watch.archive)
+		return len(archived) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	remaining, err := ioutil.ReadDir(watch.dir)
+	require.Nil(t, err)
+	require.Empty(t, remaining)
+}
+
+func TestApi_WatchFolder_ShouldRejectInvalidFilesAndDeleteDuplicatesWithoutArchive(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	watch, cleanup := newTestWatchFolder(t, handler)
+	defer cleanup()
+	watch.archive = ""
+
+	notAudio := filepath.Join(watch.dir, "notes.mp3")
+	require.Nil(t, ioutil.WriteFile(notAudio, []byte("test"), 0644))
+	require.False(t, watch.process(ctx, notAudio))
+	_, err := os.Stat(filepath.Join(watch.rejected, "notes.mp3"))
+	require.Nil(t, err)
+
+	song := filepath.Join(watch.dir, "song.mp3")
+	require.Nil(t, ioutil.WriteFile(song, testAudio, 0644))
+	require.False(t, watch.process(ctx, song))
+	require.Nil(t, ioutil.WriteFile(song, testAudio, 0644))
+	require.False(t, watch.process(ctx, song))
+	_, err = os.Stat(song)
+	require.True(t, os.IsNotExist(err))
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+
+	// A second rejected file of the same name is kept beside the first.
+	watch.validator = rejectingValidator{}
+	require.Nil(t, ioutil.WriteFile(notAudio, append(testAudio, 1), 0644))
+	require.False(t, watch.process(ctx, notAudio))
+	rejected, err := ioutil.ReadDir(watch.rejected)
+	require.Nil(t, err)
+	require.Len(t, rejected, 2)
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/library"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const jobKindYoutubeImport = "youtube-import"
+
+// youtubeImporter downloads the audio of a YouTube video and stores it as a track.
+type youtubeImporter struct {
+	handler       dao.DbHandler
+	client        YoutubeClient
+	enrichers     enrichers
+	fingerprinter service.Fingerprinter
+	silence       silenceSettings
+	locks         importLocks
+	ffmpeg        string
+	pool          *library.FFmpegPool
+}
+
+// validate checks a request before any work is done on it, returning the metadata provider it asks for and the id of
+// the video it names.
+func (y youtubeImporter) validate(ytRequest models.YoutubeRequest) (service.MetadataProvider, string, error) {
+	enricher, err := y.enrichers.forRequest(ytRequest.Enrichment)
+	if err != nil {
+		return nil, "", statusError{code: http.StatusBadRequest, err: err}
+	}
+
+	if err := checkQuality(ytRequest.Quality); err != nil {
+		return nil, "", err
+	}
+	if ytRequest.SplitChapters && ytRequest.TrimSilence {
+		return nil, "", statusError{code: http.StatusBadRequest, err: errors.New("trimSilence cannot be combined with splitChapters")}
+	}
+
+	parts := strings.SplitN(ytRequest.YoutubeLink, "v=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, "", statusError{code: http.StatusBadRequest, err: errors.New("youtubeLink must contain a video id")}
+	}
+	return enricher, strings.Split(parts[1], "&")[0], nil
+}
+
+// importTracks imports the video as a track or, if the request asks to split it and the video has chapters, as one
+// track per chapter.
+func (y youtubeImporter) importTracks(ctx context.Context, ytRequest models.YoutubeRequest) ([]models.Track, error) {
+	enricher, videoId, err := y.validate(ytRequest)
+	if err != nil {
+		return nil, err
+	}
+	if y.ffmpeg == "" {
+		return nil, errFFmpegUnavailable
+	}
+
+	unlock, err := y.locks.acquire(ctx, "youtube", videoId)
+	if errors.Is(err, service.ErrLocked) {
+		return nil, statusError{code: http.StatusConflict, err: errors.New("This import is already in progress")}
+	} else if err != nil {
+		return nil, statusError{code: http.StatusServiceUnavailable, err: fmt.Errorf("unable to coordinate import: %w", err)}
+	}
+	defer unlock()
+
+	video, err := y.client.GetVideo(videoId)
+	if err != nil {
+		return nil, youtubeError(err, "getting video")
+	}
+
+	formats, err := rankAudioFormats(video.Formats, ytRequest.Quality)
+	if err != nil {
+		return nil, err
+	}
+
+	// The slot is held from the download on, as the video is converted while it downloads.
+	release, err := acquireFFmpeg(ctx, y.pool)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// The video is converted as it downloads, and any cuts are made from the converted audio in memory.
+	audio, err := y.downloadAudio(ctx, video, formats)
+	if err != nil {
+		return nil, err
+	}
+
+	var chapters []chapter
+	if ytRequest.SplitChapters {
+		if chapters = parseChapters(video.Description, video.Duration); chapters == nil {
+			logrus.WithField("video", videoId).Info("Video has no chapters, importing it as a single track")
+		}
+	}
+
+	var tracks []models.Track
+	if chapters == nil {
+		var trim *models.SilenceTrim
+		if ytRequest.TrimSilence {
+			if trim, err = detectSilence(ctx, y.ffmpeg, audio, y.silence); err != nil {
+				return nil, fmt.Errorf("error detecting silence: %w", err)
+			}
+		}
+
+		track := models.Track{
+			ID:              primitive.NewObjectID(),
+			Name:            ytRequest.Name,
+			Artist:          ytRequest.Artist,
+			FeaturedArtists: ytRequest.FeaturedArtists,
+			AlbumName:       ytRequest.AlbumName,
+			Trim:            trim,
+		}
+		if track.Name == "" && enricher != nil {
+			track.Name = video.Title
+		}
+		if err := y.storeTrack(ctx, audio, trimArgs(trim), &track, enricher); err != nil {
+			return nil, err
+		}
+		return []models.Track{track}, nil
+	}
+
+	album := ytRequest.AlbumName
+	if album == "" {
+		album = video.Title
+	}
+	for i, c := range chapters {
+		track := models.Track{
+			ID:              primitive.NewObjectID(),
+			Name:            c.title,
+			Artist:          ytRequest.Artist,
+			FeaturedArtists: ytRequest.FeaturedArtists,
+			AlbumName:       album,
+			TrackNumber:     i + 1,
+		}
+		if err := y.storeTrack(ctx, audio, chapterArgs(c), &track, enricher); err != nil {
+			return tracks, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// downloadAudio downloads the video's audio and converts it to mp3, trying each of the formats in turn, best first, as
+// the stream of one format can fail or end early while the others still work. If every format fails, the error lists
+// each failure and carries the status of the last.
+func (y youtubeImporter) downloadAudio(ctx context.Context, video *youtube.Video, formats []youtube.Format) ([]byte, error) {
+	var failures []string
+	var last error
+	for i := range formats {
+		audio, err := y.downloadFormat(ctx, video, &formats[i])
+		if err == nil {
+			return audio, nil
+		} else if ctx.Err() != nil {
+			return nil, err
+		}
+
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"video":   video.ID,
+			"itag":    formats[i].ItagNo,
+			"attempt": i + 1,
+			"formats": len(formats),
+		}).Warn("Error downloading audio format")
+		failures = append(failures, fmt.Sprintf("itag %d: %v", formats[i].ItagNo, err))
+		last = err
+	}
+
+	return nil, statusError{
+		code: errorStatus(last),
+		err:  fmt.Errorf("error downloading audio, all %d formats failed: %v", len(formats), strings.Join(failures, "; ")),
+	}
+}
+
+// downloadFormat downloads the audio of one format of the video, converting it to mp3 as it downloads. A stream that
+// ends before the length YouTube gave for it is reported as an error rather than converted as though it were whole.
+func (y youtubeImporter) downloadFormat(ctx context.Context, video *youtube.Video, format *youtube.Format) ([]byte, error) {
+	stream, size, err := y.client.GetStreamContext(ctx, video, format)
+	if err != nil {
+		return nil, youtubeError(err, "getting video stream")
+	}
+	defer func() {
+		if err := stream.Close(); err != nil {
+			logrus.WithError(err).Error("Error closing stream")
+		}
+	}()
+
+	counted := &countingReader{r: stream}
+	audio, err := convertToMp3(ctx, y.ffmpeg, counted, video.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("error converting video: %w", err)
+	}
+	if size > 0 && counted.n < size {
+		return nil, fmt.Errorf("stream ended after %d of %d bytes", counted.n, size)
+	}
+	return audio, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// storeTrack stores the converted audio as the track, first cutting it with the given ffmpeg output options if there
+// are any.
+func (y youtubeImporter) storeTrack(ctx context.Context, audioBytes []byte, cutArgs []string, track *models.Track, enricher service.MetadataProvider) error {
+	if len(cutArgs) > 0 {
+		var err error
+		if audioBytes, err = cutAudio(ctx, y.ffmpeg, audioBytes, cutArgs); err != nil {
+			return fmt.Errorf("error cutting audio: %w", err)
+		}
+	}
+
+	track.Fingerprint = fingerprintUpload(ctx, y.fingerprinter, bytes.NewReader(audioBytes))
+	library.ApplyDefaults(track)
+	enrichOnUpload(ctx, enricher, track)
+
+	stored, err := library.StoreTrack(ctx, y.handler, *track, audioBytes)
+	if errors.Is(err, library.ErrNotAudio) {
+		return statusError{code: http.StatusUnprocessableEntity, err: err}
+	} else if err != nil {
+		return fmt.Errorf("error adding track to database: %w", err)
+	}
+	*track = stored
+	return nil
+}
+
+// runJob imports the video named in a job queued by /youtube/track.
+func (y youtubeImporter) runJob(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+	var ytRequest models.YoutubeRequest
+	if err := bson.Unmarshal(job.Payload, &ytRequest); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	return importJobResult(y.importTracks(ctx, ytRequest))
+}
+
+// uploadTrackFromYoutubeLink imports a YouTube video as a track, or as a track per chapter with splitChapters. With ?async=true the request is only validated and
+// queued, and the job is returned for the client to follow at /job/{id}.
+// Deprecated: use POST /import with source "youtube".
+func uploadTrackFromYoutubeLink(handler dao.DbHandler, importer youtubeImporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		var ytRequest models.YoutubeRequest
+		if err := json.NewDecoder(r.Body).Decode(&ytRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding request into JSON")
+			respondWithBodyError(w, err, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if r.URL.Query().Get("async") == "true" {
+			if _, _, err := importer.validate(ytRequest); err != nil {
+				logrus.WithError(err).Error("Invalid import request")
+				respondWithStatusError(w, err)
+				return
+			}
+
+			job, err := jobs.Enqueue(ctx, handler, jobKindYoutubeImport, ytRequest)
+			if err != nil {
+				logrus.WithError(err).Error("Error queueing import")
+				respondWithStatusError(w, err)
+				return
+			}
+
+			respondWithSuccess(w, http.StatusAccepted, job)
+			return
+		}
+
+		tracks, err := importer.importTracks(ctx, ytRequest)
+		if err != nil {
+			logrus.WithError(err).Error("Error importing track from YouTube")
+			respondWithStatusError(w, err)
+			return
+		}
+
+		if len(tracks) > 1 {
+			respondWithSuccess(w, http.StatusOK, fmt.Sprintf("%v tracks added successfully", len(tracks)))
+			return
+		}
+		respondWithSuccess(w, http.StatusOK, "Track added successfully")
+		return
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// youtubeAuth configures the credentials sent to YouTube. cookiesFile is a cookies.txt file in the Netscape format
+// browser extensions export, from an account signed in to YouTube, which allows age-restricted videos to be imported.
+// poToken is a proof of origin token, added to audio downloads so that YouTube does not refuse them with a 403.
+type youtubeAuth struct {
+	cookiesFile string
+	poToken     string
+}
+
+func youtubeAuthFromEnv() youtubeAuth {
+	return youtubeAuth{
+		cookiesFile: os.Getenv("YOUTUBE_COOKIES_FILE"),
+		poToken:     os.Getenv("YOUTUBE_PO_TOKEN"),
+	}
+}
+
+// client returns an HTTP client for the YouTube client that sends the configured credentials, and otherwise behaves as
+// base does.
+func (a youtubeAuth) client(base *http.Client) (*http.Client, error) {
+	if a.cookiesFile == "" && a.poToken == "" {
+		return base, nil
+	}
+
+	client := *base
+	if a.cookiesFile != "" {
+		jar, err := loadCookies(a.cookiesFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading YOUTUBE_COOKIES_FILE: %w", err)
+		}
+		client.Jar = jar
+	}
+	if a.poToken != "" {
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		client.Transport = poTokenTransport{token: a.poToken, next: transport}
+	}
+	return &client, nil
+}
+
+// loadCookies reads a Netscape cookies.txt file into a cookie jar. Expired cookies are skipped.
+func loadCookies(path string) (http.CookieJar, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := 0
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		// Cookies only sent over HTTP, unreadable from scripts, are written with this prefix rather than as comments.
+		text = strings.TrimPrefix(text, "#HttpOnly_")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d is not a cookie, expected 7 tab separated fields", line)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d has an invalid expiry %q", line, fields[4])
+		}
+		if expires != 0 && time.Unix(expires, 0).Before(time.Now()) {
+			continue
+		}
+
+		domain := strings.TrimPrefix(fields[0], ".")
+		cookie := &http.Cookie{Name: fields[5], Value: fields[6], Path: fields[2], Secure: fields[3] == "TRUE"}
+		if fields[1] == "TRUE" {
+			cookie.Domain = domain
+		}
+		jar.SetCookies(&url.URL{Scheme: "https", Host: domain, Path: fields[2]}, []*http.Cookie{cookie})
+		loaded++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if loaded == 0 {
+		return nil, errors.New("no unexpired cookies found")
+	}
+	return jar, nil
+}
+
+// poTokenTransport adds a proof of origin token to requests for audio and video streams.
+type poTokenTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t poTokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(r.URL.Hostname(), ".googlevideo.com") {
+		return t.next.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context())
+	query := r.URL.Query()
+	query.Set("pot", t.token)
+	r.URL.RawQuery = query.Encode()
+	return t.next.RoundTrip(r)
+}
+
+// youtubeError describes a failure of the YouTube client with the status it should be reported with, so that videos
+// YouTube will not give out and downloads it refuses are told apart from failures of the API itself.
+func youtubeError(err error, action string) error {
+	var playability *youtube.ErrPlayabiltyStatus
+	var status youtube.ErrUnexpectedStatusCode
+	switch {
+	case errors.Is(err, youtube.ErrLoginRequired):
+		return statusError{code: http.StatusForbidden, err: errors.New("Video is age-restricted, and the server's YouTube cookies are missing or not signed in")}
+	case errors.Is(err, youtube.ErrVideoPrivate):
+		return statusError{code: http.StatusForbidden, err: errors.New("Video is private")}
+	case errors.Is(err, youtube.ErrNotPlayableInEmbed):
+		return statusError{code: http.StatusUnprocessableEntity, err: errors.New("Video cannot be downloaded as its owner has disabled embedding")}
+	case errors.As(err, &playability):
+		return statusError{code: http.StatusUnprocessableEntity, err: fmt.Errorf("Video is unavailable: %v", playability.Reason)}
+	case errors.As(err, &status) && (status == http.StatusForbidden || status == http.StatusTooManyRequests):
+		// Throttling passes with time, so this is reported as a server error for queued imports to be retried.
+		return statusError{code: http.StatusServiceUnavailable, err: fmt.Errorf("YouTube refused the request with status %d, it may be throttling this server", int(status))}
+	default:
+		return fmt.Errorf("error %v: %w", action, err)
+	}
+}
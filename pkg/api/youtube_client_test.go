@@ -0,0 +1,60 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCookies_ShouldLoadUnexpiredCookies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	require.Nil(t, ioutil.WriteFile(path, []byte("# Netscape HTTP Cookie File\n"+
+		".youtube.com\tTRUE\t/\tTRUE\t4102444800\tSID\tsigned-in\n"+
+		"#HttpOnly_.youtube.com\tTRUE\t/\tTRUE\t4102444800\tHSID\thttp-only\n"+
+		".youtube.com\tTRUE\t/\tTRUE\t946684800\tOLD\texpired\n"), 0600))
+
+	jar, err := loadCookies(path)
+	require.Nil(t, err)
+
+	cookies := map[string]string{}
+	for _, cookie := range jar.Cookies(&url.URL{Scheme: "https", Host: "www.youtube.com", Path: "/"}) {
+		cookies[cookie.Name] = cookie.Value
+	}
+	require.Equal(t, map[string]string{"SID": "signed-in", "HSID": "http-only"}, cookies)
+}
+
+func TestLoadCookies_ShouldReturnErrorForMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	require.Nil(t, ioutil.WriteFile(path, []byte("SID=signed-in\n"), 0600))
+
+	_, err := loadCookies(path)
+	require.NotNil(t, err)
+}
+
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, r)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+}
+
+func TestPOTokenTransport_ShouldOnlyAddTokenToStreamRequests(t *testing.T) {
+	recorder := &recordingTransport{}
+	client, err := youtubeAuth{poToken: "token"}.client(&http.Client{Transport: recorder})
+	require.Nil(t, err)
+
+	_, err = client.Get("https://rr1---sn-test.googlevideo.com/videoplayback?itag=140")
+	require.Nil(t, err)
+	_, err = client.Get("https://www.youtube.com/watch?v=test")
+	require.Nil(t, err)
+
+	require.Equal(t, "token", recorder.requests[0].URL.Query().Get("pot"))
+	require.Equal(t, "140", recorder.requests[0].URL.Query().Get("itag"))
+	require.Empty(t, recorder.requests[1].URL.Query().Get("pot"))
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/jobs"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/service"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn409IfVideoIsAlreadyBeingImported(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+
+	locks := importLocks{locker: service.NewLocalCoordinator(), ttl: time.Minute}
+	_, err := locks.acquire(context.Background(), "youtube", "test")
+	require.Nil(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test&channel=test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, locks: locks, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	client.AssertNotCalled(t, "GetVideo", mock.Anything)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn400IfLinkHasNoVideoID(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldQueueJobIfAsync(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+	dbHandler.On("AddJob", mock.Anything, mock.MatchedBy(func(job models.Job) bool {
+		var ytRequest models.YoutubeRequest
+		return job.Kind == jobKindYoutubeImport && job.Status == models.JobQueued &&
+			bson.Unmarshal(job.Payload, &ytRequest) == nil && ytRequest.Name == "Song"
+	})).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track?async=true", strings.NewReader(`{"name":"Song","youtubeLink":"www.youtube.com?v=test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	var job models.Job
+	require.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+	require.Equal(t, models.JobQueued, job.Status)
+	client.AssertNotCalled(t, "GetVideo", mock.Anything)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn400WithoutQueueingIfAsyncRequestIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track?async=true", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test","enrichment":"test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "AddJob", mock.Anything, mock.Anything)
+}
+
+func TestApi_YoutubeImporter_RunJob_ShouldNotRetryInvalidRequests(t *testing.T) {
+	payload, err := bson.Marshal(models.YoutubeRequest{YoutubeLink: "www.youtube.com"})
+	require.Nil(t, err)
+
+	_, err = youtubeImporter{}.runJob(context.Background(), models.Job{Payload: payload})
+	require.NotNil(t, err)
+	require.Equal(t, "youtubeLink must contain a video id", err.Error())
+	require.True(t, jobs.IsPermanent(err))
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn400IfSplittingAndTrimmingAreCombined(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test","splitChapters":true,"trimSilence":true}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	client.AssertNotCalled(t, "GetVideo", mock.Anything)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn503IfFFmpegIsUnavailable(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "FFMPEG_PATH")
+	client.AssertNotCalled(t, "GetVideo", mock.Anything)
+}
+
+func TestApi_UploadTrackFromYoutubeLink_ShouldReturn403IfVideoIsAgeRestricted(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	client := &mocks.YoutubeClient{}
+	client.On("GetVideo", "test").Return(nil, youtube.ErrLoginRequired)
+
+	req, err := http.NewRequest(http.MethodPost, "/youtube/track", strings.NewReader(`{"youtubeLink":"www.youtube.com?v=test"}`))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	locks := importLocks{locker: service.NewLocalCoordinator(), ttl: time.Minute}
+	httpHandler := http.HandlerFunc(uploadTrackFromYoutubeLink(dbHandler, youtubeImporter{handler: dbHandler, client: client, locks: locks, ffmpeg: "ffmpeg"}))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "age-restricted")
+}
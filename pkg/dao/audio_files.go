@@ -0,0 +1,106 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fileAudioStore keeps each audio file as a file named by its ID, in dir for the default tenant and in a directory of
+// their own under dir/tenants for the others.
+type fileAudioStore struct {
+	dir string
+}
+
+func newFileAudioStore(dir string) (fileAudioStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fileAudioStore{}, fmt.Errorf("error creating audio directory: %w", err)
+	}
+	return fileAudioStore{dir: dir}, nil
+}
+
+func (s fileAudioStore) tenantDir(tenant string) string {
+	if tenant == "" {
+		return s.dir
+	}
+	return filepath.Join(s.dir, "tenants", tenant)
+}
+
+// upload writes the file through a temporary file, so a stream reading it never sees half of it.
+func (s fileAudioStore) upload(ctx context.Context, tenant string, id primitive.ObjectID, name string, audio io.Reader) error {
+	dir := s.tenantDir(tenant)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(dir, id.Hex()+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, audio)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(dir, id.Hex()))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (s fileAudioStore) download(ctx context.Context, tenant string, id primitive.ObjectID) ([]byte, error) {
+	audio, err := ioutil.ReadFile(filepath.Join(s.tenantDir(tenant), id.Hex()))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return audio, err
+}
+
+func (s fileAudioStore) delete(ctx context.Context, tenant string, id primitive.ObjectID) error {
+	err := os.Remove(filepath.Join(s.tenantDir(tenant), id.Hex()))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// list returns the IDs of the tenant's files, skipping anything else in the directory, such as temporary files left
+// by an interrupted upload.
+func (s fileAudioStore) list(ctx context.Context, tenant string) ([]primitive.ObjectID, error) {
+	entries, err := ioutil.ReadDir(s.tenantDir(tenant))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ids []primitive.ObjectID
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if id, err := primitive.ObjectIDFromHex(entry.Name()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// ping checks that the directory is still there.
+func (s fileAudioStore) ping(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", s.dir)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package dao
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cache is a shared key-value store such as Redis. Get returns nil for a missing key.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+const (
+	cachedTracks    = "tracks"
+	cachedPlaylists = "playlists"
+)
+
+// CachingHandler answers GetTracks and GetPlaylists from a cache, keyed by a hash of the filters, in front of another
+// DbHandler. Rather than finding and deleting keys, writes bump a per-tenant generation counter that is part of every
+// key, so all replicas sharing the cache stop reading stale entries at once and the old ones simply expire. Writes made
+// around the cache, such as by musicctl, show up once the TTL passes. Cache errors are logged and the database is used.
+type CachingHandler struct {
+	DbHandler
+	Cache Cache
+	TTL   time.Duration
+}
+
+type cachedTrackList struct {
+	Tracks []models.Track `bson:"tracks"`
+}
+
+type cachedPlaylistList struct {
+	Playlists []models.Playlist `bson:"playlists"`
+}
+
+func (c *CachingHandler) GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error) {
+	key := c.key(ctx, cachedTracks, filters)
+	if key != "" {
+		var cached cachedTrackList
+		if c.load(ctx, key, &cached) {
+			return cached.Tracks, nil
+		}
+	}
+
+	tracks, err := c.DbHandler.GetTracks(ctx, filters)
+	if err == nil && key != "" {
+		c.store(ctx, key, cachedTrackList{Tracks: tracks})
+	}
+	return tracks, err
+}
+
+func (c *CachingHandler) GetPlaylists(ctx context.Context, filters map[string]interface{}) ([]models.Playlist, error) {
+	key := c.key(ctx, cachedPlaylists, filters)
+	if key != "" {
+		var cached cachedPlaylistList
+		if c.load(ctx, key, &cached) {
+			return cached.Playlists, nil
+		}
+	}
+
+	playlists, err := c.DbHandler.GetPlaylists(ctx, filters)
+	if err == nil && key != "" {
+		c.store(ctx, key, cachedPlaylistList{Playlists: playlists})
+	}
+	return playlists, err
+}
+
+func (c *CachingHandler) AddTrack(ctx context.Context, track models.Track) error {
+	defer c.invalidate(ctx, cachedTracks)
+	return c.DbHandler.AddTrack(ctx, track)
+}
+
+func (c *CachingHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track, revision int64) error {
+	defer c.invalidate(ctx, cachedTracks)
+	return c.DbHandler.UpdateTrack(ctx, id, updatedTrack, revision)
+}
+
+func (c *CachingHandler) SetTrackAudio(ctx context.Context, id primitive.ObjectID, track models.Track) error {
+	defer c.invalidate(ctx, cachedTracks)
+	return c.DbHandler.SetTrackAudio(ctx, id, track)
+}
+
+func (c *CachingHandler) AddTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	defer c.invalidate(ctx, cachedTracks)
+	return c.DbHandler.AddTrackTags(ctx, id, tags, revision)
+}
+
+func (c *CachingHandler) RemoveTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	defer c.invalidate(ctx, cachedTracks)
+	return c.DbHandler.RemoveTrackTags(ctx, id, tags, revision)
+}
+
+func (c *CachingHandler) SetTrackLastPlayed(ctx context.Context, id primitive.ObjectID, playedAt time.Time) error {
+	defer c.invalidate(ctx, cachedTracks)
+	return c.DbHandler.SetTrackLastPlayed(ctx, id, playedAt)
+}
+
+// DeleteTrack also invalidates playlists, as the track is removed from those it was on.
+func (c *CachingHandler) DeleteTrack(ctx context.Context, id primitive.ObjectID) error {
+	defer c.invalidate(ctx, cachedTracks, cachedPlaylists)
+	return c.DbHandler.DeleteTrack(ctx, id)
+}
+
+func (c *CachingHandler) AddPlaylist(ctx context.Context, playlist models.Playlist) error {
+	defer c.invalidate(ctx, cachedPlaylists)
+	return c.DbHandler.AddPlaylist(ctx, playlist)
+}
+
+func (c *CachingHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M, revision int64) error {
+	defer c.invalidate(ctx, cachedPlaylists)
+	return c.DbHandler.UpdatePlaylist(ctx, playlistId, update, revision)
+}
+
+func (c *CachingHandler) MovePlaylistTrack(ctx context.Context, playlistId primitive.ObjectID, trackId primitive.ObjectID, index int, revision int64) error {
+	defer c.invalidate(ctx, cachedPlaylists)
+	return c.DbHandler.MovePlaylistTrack(ctx, playlistId, trackId, index, revision)
+}
+
+func (c *CachingHandler) DeletePlaylist(ctx context.Context, id primitive.ObjectID) error {
+	defer c.invalidate(ctx, cachedPlaylists)
+	return c.DbHandler.DeletePlaylist(ctx, id)
+}
+
+// RestoreDocument invalidates tracks or playlists if the document is one.
+func (c *CachingHandler) RestoreDocument(ctx context.Context, collection string, doc interface{}, replace bool) error {
+	switch collection {
+	case CollectionTracks:
+		defer c.invalidate(ctx, cachedTracks)
+	case CollectionPlaylists:
+		defer c.invalidate(ctx, cachedPlaylists)
+	}
+	return c.DbHandler.RestoreDocument(ctx, collection, doc, replace)
+}
+
+// key returns the cache key for a query of the given kind, or an empty string if it cannot be cached. Filters are
+// hashed as JSON, which unlike BSON orders map keys, so equal filters share a key.
+func (c *CachingHandler) key(ctx context.Context, kind string, filters map[string]interface{}) string {
+	encoded, err := json.Marshal(filters)
+	if err != nil {
+		return ""
+	}
+
+	generation, err := c.Cache.Get(ctx, c.generationKey(ctx, kind))
+	if err != nil {
+		logrus.WithError(err).Warn("Error reading cache generation")
+		return ""
+	}
+
+	hash := sha256.Sum256(encoded)
+	return fmt.Sprintf("cache:%v:%v:%s:%v", TenantFromContext(ctx), kind, generation, hex.EncodeToString(hash[:]))
+}
+
+func (c *CachingHandler) generationKey(ctx context.Context, kind string) string {
+	return fmt.Sprintf("cache:%v:%v:generation", TenantFromContext(ctx), kind)
+}
+
+func (c *CachingHandler) load(ctx context.Context, key string, value interface{}) bool {
+	encoded, err := c.Cache.Get(ctx, key)
+	if err != nil {
+		logrus.WithError(err).Warn("Error reading from cache")
+		return false
+	}
+	if encoded == nil {
+		return false
+	}
+	if err := bson.Unmarshal(encoded, value); err != nil {
+		logrus.WithError(err).Warn("Error decoding cached value")
+		return false
+	}
+	return true
+}
+
+func (c *CachingHandler) store(ctx context.Context, key string, value interface{}) {
+	encoded, err := bson.Marshal(value)
+	if err != nil {
+		logrus.WithError(err).Warn("Error encoding value to cache")
+		return
+	}
+	if err := c.Cache.Set(ctx, key, encoded, c.TTL); err != nil {
+		logrus.WithError(err).Warn("Error writing to cache")
+	}
+}
+
+// invalidate bumps the generation of the given kinds of cached query even when the write failed, as a failed write
+// may still have been applied.
+func (c *CachingHandler) invalidate(ctx context.Context, kinds ...string) {
+	for _, kind := range kinds {
+		if _, err := c.Cache.Incr(ctx, c.generationKey(ctx, kind)); err != nil {
+			logrus.WithError(err).Warn("Error invalidating cache")
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryCache struct {
+	values map[string][]byte
+	err    error
+}
+
+func (m *memoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return m.values[key], m.err
+}
+
+func (m *memoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.values[key] = value
+	return m.err
+}
+
+func (m *memoryCache) Incr(ctx context.Context, key string) (int64, error) {
+	n, _ := strconv.ParseInt(string(m.values[key]), 10, 64)
+	m.values[key] = []byte(strconv.FormatInt(n+1, 10))
+	return n + 1, m.err
+}
+
+func TestCachingHandler_GetTracks_ShouldServeRepeatedQueriesFromCache(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Name: "Song", Fingerprint: []uint32{1}}}, nil).Once()
+	handler := &CachingHandler{DbHandler: dbHandler, Cache: &memoryCache{values: map[string][]byte{}}, TTL: time.Minute}
+
+	filters := map[string]interface{}{"artist": "Artist", "tags": bson.M{"$all": []string{"rock"}}}
+	_, err := handler.GetTracks(context.Background(), filters)
+	require.Nil(t, err)
+
+	tracks, err := handler.GetTracks(context.Background(), map[string]interface{}{"tags": bson.M{"$all": []string{"rock"}}, "artist": "Artist"})
+	require.Nil(t, err)
+	require.Equal(t, "Song", tracks[0].Name)
+	require.Equal(t, []uint32{1}, tracks[0].Fingerprint)
+	dbHandler.AssertNumberOfCalls(t, "GetTracks", 1)
+}
+
+func TestCachingHandler_GetTracks_ShouldQueryDatabaseAgainAfterWrite(t *testing.T) {
+	id := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Name: "Song"}}, nil)
+	dbHandler.On("UpdateTrack", mock.Anything, id, mock.Anything, mock.Anything).Return(nil)
+	handler := &CachingHandler{DbHandler: dbHandler, Cache: &memoryCache{values: map[string][]byte{}}, TTL: time.Minute}
+
+	_, err := handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Nil(t, handler.UpdateTrack(context.Background(), id, models.Track{}, AnyRevision))
+	_, err = handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+
+	dbHandler.AssertNumberOfCalls(t, "GetTracks", 2)
+}
+
+func TestCachingHandler_DeleteTrack_ShouldInvalidatePlaylists(t *testing.T) {
+	id := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{{Name: "Mix"}}, nil)
+	dbHandler.On("DeleteTrack", mock.Anything, id).Return(nil)
+	handler := &CachingHandler{DbHandler: dbHandler, Cache: &memoryCache{values: map[string][]byte{}}, TTL: time.Minute}
+
+	_, err := handler.GetPlaylists(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Nil(t, handler.DeleteTrack(context.Background(), id))
+	_, err = handler.GetPlaylists(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+
+	dbHandler.AssertNumberOfCalls(t, "GetPlaylists", 2)
+}
+
+func TestCachingHandler_GetTracks_ShouldUseDatabaseIfCacheErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Name: "Song"}}, nil)
+	handler := &CachingHandler{DbHandler: dbHandler, Cache: &memoryCache{values: map[string][]byte{}, err: errors.New("test")}, TTL: time.Minute}
+
+	tracks, err := handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Equal(t, "Song", tracks[0].Name)
+}
+
+func TestCachingHandler_GetTracks_ShouldKeepCachesSeparatePerTenant(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{{Name: "Song"}}, nil)
+	handler := &CachingHandler{DbHandler: dbHandler, Cache: &memoryCache{values: map[string][]byte{}}, TTL: time.Minute}
+
+	acme, err := WithTenant(context.Background(), "acme")
+	require.Nil(t, err)
+	_, err = handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	_, err = handler.GetTracks(acme, map[string]interface{}{})
+	require.Nil(t, err)
+
+	dbHandler.AssertNumberOfCalls(t, "GetTracks", 2)
+}
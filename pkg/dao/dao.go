@@ -2,6 +2,8 @@ package dao
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"music-stream-api/pkg/models"
 
@@ -9,18 +11,68 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// AnyRevision is passed as the expected revision of an update that should apply whatever the stored revision is.
+const AnyRevision int64 = -1
+
+// ErrRevisionMismatch is returned by an update whose expected revision is not the stored one, because someone else
+// changed the document since it was read. It is an ErrConflict.
+var ErrRevisionMismatch error = &kindError{kind: ErrConflict, message: "the document has been changed since it was read"}
+
 type DbHandler interface {
 	Ping(ctx context.Context) error
+	PingAudioStore(ctx context.Context) error
+	EnsureIndexes(ctx context.Context) error
 
 	AddTrack(ctx context.Context, track models.Track) error
 	UploadAudioFile(ctx context.Context, audioFile []byte, trackName string) (interface{}, error)
+	UploadAudioStream(ctx context.Context, audio io.Reader, trackName string) (interface{}, error)
 	DownloadAudioFile(ctx context.Context, audioFileID primitive.ObjectID) ([]byte, error)
-	UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track) error
+	DeleteAudioFile(ctx context.Context, audioFileID primitive.ObjectID) error
+	FindOrphanedAudioFiles(ctx context.Context) ([]primitive.ObjectID, error)
+	UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track, revision int64) error
+	SetTrackAudio(ctx context.Context, id primitive.ObjectID, track models.Track) error
+	AddTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error
+	RemoveTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error
+	SetTrackLastPlayed(ctx context.Context, id primitive.ObjectID, playedAt time.Time) error
 	GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error)
+	SampleTracks(ctx context.Context, filters map[string]interface{}, count int) ([]models.Track, error)
+	GetRecentTracks(ctx context.Context, since time.Time) ([]models.Track, error)
 	DeleteTrack(ctx context.Context, id primitive.ObjectID) error
+	SearchTracks(ctx context.Context, query string, limit int) ([]models.Track, error)
+	WatchTracks(ctx context.Context, handle func(change models.TrackChange) error) error
+	GetSuggestions(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error)
 
 	AddPlaylist(ctx context.Context, playlist models.Playlist) error
-	UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M) error
+	UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M, revision int64) error
+	MovePlaylistTrack(ctx context.Context, playlistId primitive.ObjectID, trackId primitive.ObjectID, index int, revision int64) error
 	DeletePlaylist(ctx context.Context, id primitive.ObjectID) error
 	GetPlaylists(ctx context.Context, filters map[string]interface{}) ([]models.Playlist, error)
+	GetPlaylistPage(ctx context.Context, id primitive.ObjectID, offset int, limit int) (models.PlaylistPage, error)
+	WatchPlaylists(ctx context.Context, handle func(change models.PlaylistChange) error) error
+
+	AddPodcast(ctx context.Context, podcast models.Podcast) error
+	UpdatePodcast(ctx context.Context, id primitive.ObjectID, update bson.M) error
+	DeletePodcast(ctx context.Context, id primitive.ObjectID) error
+	GetPodcasts(ctx context.Context, filters map[string]interface{}) ([]models.Podcast, error)
+
+	AddAPIKey(ctx context.Context, key models.APIKey) error
+	GetAPIKeys(ctx context.Context, filters map[string]interface{}) ([]models.APIKey, error)
+
+	AddShare(ctx context.Context, share models.Share) error
+	GetShares(ctx context.Context, filters map[string]interface{}) ([]models.Share, error)
+	RecordSharePlay(ctx context.Context, id primitive.ObjectID) error
+
+	AddPlay(ctx context.Context, play models.Play) error
+	GetPlayCounts(ctx context.Context, since time.Time) ([]models.PlayCount, error)
+	SetNowPlaying(ctx context.Context, state models.NowPlaying) error
+	GetNowPlaying(ctx context.Context, user string) (models.NowPlaying, error)
+
+	AddJob(ctx context.Context, job models.Job) error
+	ClaimJob(ctx context.Context, worker string, kinds []string, lease time.Duration) (models.Job, error)
+	UpdateJob(ctx context.Context, id primitive.ObjectID, update bson.M) error
+	TransitionJob(ctx context.Context, id primitive.ObjectID, from []string, update bson.M) (models.Job, error)
+	GetJobs(ctx context.Context, filters map[string]interface{}) ([]models.Job, error)
+
+	RestoreDocument(ctx context.Context, collection string, doc interface{}, replace bool) error
+	RestoreAudioFile(ctx context.Context, id primitive.ObjectID, audioFile []byte, name string) error
 }
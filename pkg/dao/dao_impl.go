@@ -4,6 +4,12 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"music-stream-api/pkg/models"
 
@@ -11,37 +17,178 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type DatabaseHandler struct {
 	Client               *mongo.Client
 	Database             string
+	TenantDatabasePrefix string
 	TrackCollection      string
 	PlaylistCollection   string
+	PodcastCollection    string
+	APIKeyCollection     string
+	ShareCollection      string
+	PlayCollection       string
+	NowPlayingCollection string
+	SuggestionCollection string
+	JobCollection        string
 	AudioCollection      string
 	AudioChunkCollection string
+	MigrationCollection  string
+
+	// ReadTimeout, WriteTimeout and GridFSTimeout bound each query, each change and each transfer of audio to or from
+	// GridFS. A timeout of 0 sets no bound.
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	GridFSTimeout time.Duration
+
+	// ListReadPreference, when set, is used in place of the client's read preference for queries made with a context
+	// from WithSecondaryReads, to move listing a large library off the primary of a replica set.
+	ListReadPreference *readpref.ReadPref
+
+	// indexedTenants holds the tenants whose databases this handler has created the indexes in, so that a tenant's
+	// database created after EnsureIndexes last ran is indexed when first used.
+	indexedTenants sync.Map
+}
+
+// NewDatabaseHandler returns a DatabaseHandler for the library database using the standard collection names.
+func NewDatabaseHandler(client *mongo.Client) *DatabaseHandler {
+	return &DatabaseHandler{
+		Client:               client,
+		Database:             "db",
+		TrackCollection:      "songs",
+		PlaylistCollection:   "playlists",
+		PodcastCollection:    "podcasts",
+		APIKeyCollection:     "apikeys",
+		ShareCollection:      "shares",
+		PlayCollection:       "plays",
+		NowPlayingCollection: "nowplaying",
+		SuggestionCollection: "suggestions",
+		JobCollection:        "jobs",
+		AudioCollection:      "fs.files",
+		AudioChunkCollection: "fs.chunks",
+		MigrationCollection:  "migrations",
+	}
+}
+
+// database returns the database holding the library for the tenant in the context, or the default database when no
+// tenant database prefix is configured. With a prefix, a context without a tenant is refused with ErrNoTenant rather
+// than falling back to the default database, which belongs to no tenant.
+func (db *DatabaseHandler) database(ctx context.Context) (*mongo.Database, error) {
+	var opts []*options.DatabaseOptions
+	if db.ListReadPreference != nil && secondaryReadsAllowed(ctx) {
+		opts = append(opts, options.Database().SetReadPreference(db.ListReadPreference))
+	}
+
+	if db.TenantDatabasePrefix != "" {
+		tenant := TenantFromContext(ctx)
+		if tenant == "" {
+			return nil, ErrNoTenant
+		}
+		return db.Client.Database(db.TenantDatabasePrefix+tenant, opts...), nil
+	}
+	return db.Client.Database(db.Database, opts...), nil
+}
+
+// indexTenant creates the indexes in a tenant's database, unless the handler has already.
+func (db *DatabaseHandler) indexTenant(ctx context.Context, tenant string) error {
+	if _, ok := db.indexedTenants.Load(tenant); ok {
+		return nil
+	}
+	if err := db.createIndexes(ctx, db.Client.Database(db.TenantDatabasePrefix+tenant)); err != nil {
+		return err
+	}
+	db.indexedTenants.Store(tenant, true)
+	return nil
+}
+
+// ListTenants returns every tenant that has a database, identified by the tenant database prefix.
+func (db *DatabaseHandler) ListTenants(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	if db.TenantDatabasePrefix == "" {
+		return nil, nil
+	}
+
+	names, err := db.Client.ListDatabaseNames(ctx, bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(db.TenantDatabasePrefix)}})
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := make([]string, len(names))
+	for i, name := range names {
+		tenants[i] = strings.TrimPrefix(name, db.TenantDatabasePrefix)
+	}
+	return tenants, nil
+}
+
+// collection returns the named collection in the database of the tenant in the context, creating the indexes in the
+// tenant's database first if it is new.
+func (db *DatabaseHandler) collection(ctx context.Context, name string) (*mongo.Collection, error) {
+	database, err := db.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tenant := TenantFromContext(ctx); db.TenantDatabasePrefix != "" {
+		if err := db.indexTenant(ctx, tenant); err != nil {
+			return nil, err
+		}
+	}
+	return database.Collection(name), nil
+}
+
+func (db *DatabaseHandler) getTrackCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.TrackCollection)
+}
+
+func (db *DatabaseHandler) getPlaylistCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.PlaylistCollection)
+}
+
+func (db *DatabaseHandler) getPodcastCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.PodcastCollection)
+}
+
+func (db *DatabaseHandler) getAPIKeyCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.APIKeyCollection)
+}
+
+func (db *DatabaseHandler) getShareCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.ShareCollection)
+}
+
+func (db *DatabaseHandler) getPlayCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.PlayCollection)
 }
 
-func (db *DatabaseHandler) getTrackCollection() *mongo.Collection {
-	return db.Client.Database(db.Database).Collection(db.TrackCollection)
+func (db *DatabaseHandler) getNowPlayingCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.NowPlayingCollection)
 }
 
-func (db *DatabaseHandler) getPlaylistCollection() *mongo.Collection {
-	return db.Client.Database(db.Database).Collection(db.PlaylistCollection)
+func (db *DatabaseHandler) getSuggestionCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.SuggestionCollection)
 }
 
-func (db *DatabaseHandler) getAudioCollection() *mongo.Collection {
-	return db.Client.Database(db.Database).Collection(db.AudioCollection)
+func (db *DatabaseHandler) getAudioCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.AudioCollection)
 }
 
-func (db *DatabaseHandler) getAudioChunkCollection() *mongo.Collection {
-	return db.Client.Database(db.Database).Collection(db.AudioChunkCollection)
+func (db *DatabaseHandler) getAudioChunkCollection(ctx context.Context) (*mongo.Collection, error) {
+	return db.collection(ctx, db.AudioChunkCollection)
 }
 
 func (db *DatabaseHandler) GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error) {
-	cursor, err := db.getTrackCollection().Find(ctx, filters)
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filters)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +201,10 @@ func (db *DatabaseHandler) GetTracks(ctx context.Context, filters map[string]int
 }
 
 func (db *DatabaseHandler) UploadAudioFile(ctx context.Context, audioFile []byte, trackName string) (interface{}, error) {
-	bucket, err := gridfs.NewBucket(db.Client.Database(db.Database))
+	ctx, cancel := withTimeout(ctx, db.GridFSTimeout)
+	defer cancel()
+
+	bucket, err := db.audioBucket(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +213,11 @@ func (db *DatabaseHandler) UploadAudioFile(ctx context.Context, audioFile []byte
 	if err != nil {
 		return nil, err
 	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := uploadStream.SetWriteDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
 
 	defer func() {
 		if err := uploadStream.Close(); err != nil {
@@ -78,18 +233,54 @@ func (db *DatabaseHandler) UploadAudioFile(ctx context.Context, audioFile []byte
 	return uploadStream.FileID, nil
 }
 
+func (db *DatabaseHandler) UploadAudioStream(ctx context.Context, audio io.Reader, trackName string) (interface{}, error) {
+	ctx, cancel := withTimeout(ctx, db.GridFSTimeout)
+	defer cancel()
+
+	bucket, err := db.audioBucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := bucket.UploadFromStream(trackName, audio)
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// AddTrack inserts a track, stamping its creation and update times. A creation time that is already set, as on an
+// imported track, is kept.
 func (db *DatabaseHandler) AddTrack(ctx context.Context, track models.Track) error {
-	results, err := db.getTrackCollection().InsertOne(ctx, track)
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	if track.CreatedAt.IsZero() {
+		track.CreatedAt = now
+	}
+	track.UpdatedAt = now
+
+	collection, err := db.getTrackCollection(ctx)
 	if err != nil {
 		return err
+	}
+	results, err := collection.InsertOne(ctx, track)
+	if err != nil {
+		return translateError(err)
 	} else if results.InsertedID == nil {
 		return errors.New("no tracks inserted")
 	}
+
+	db.adjustSuggestions(ctx, track, 1)
 	return nil
 }
 
 func (db *DatabaseHandler) DownloadAudioFile(ctx context.Context, audioFileID primitive.ObjectID) ([]byte, error) {
-	bucket, err := gridfs.NewBucket(db.Client.Database(db.Database))
+	ctx, cancel := withTimeout(ctx, db.GridFSTimeout)
+	defer cancel()
+
+	bucket, err := db.audioBucket(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -97,104 +288,807 @@ func (db *DatabaseHandler) DownloadAudioFile(ctx context.Context, audioFileID pr
 	var buf bytes.Buffer
 	_, err = bucket.DownloadToStream(audioFileID, &buf)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return buf.Bytes(), nil
 }
 
-func (db *DatabaseHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track) error {
-	filter := map[string]interface{}{"_id": id}
+func (db *DatabaseHandler) DeleteAudioFile(ctx context.Context, audioFileID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.GridFSTimeout)
+	defer cancel()
+
+	bucket, err := db.audioBucket(ctx)
+	if err != nil {
+		return err
+	}
+	return translateError(bucket.Delete(audioFileID))
+}
+
+// FindOrphanedAudioFiles returns the IDs of stored audio files that no track references, as its current audio, as the
+// original it was transcoded from, as a quality variant, as a previous version or as its artwork, such as those left
+// behind by an upload that failed after its audio was written.
+func (db *DatabaseHandler) FindOrphanedAudioFiles(ctx context.Context) ([]primitive.ObjectID, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         db.TrackCollection,
+			"localField":   "_id",
+			"foreignField": "audioFileId",
+			"as":           "tracks",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         db.TrackCollection,
+			"localField":   "_id",
+			"foreignField": "versions.audioFileId",
+			"as":           "versionOf",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         db.TrackCollection,
+			"localField":   "_id",
+			"foreignField": "original.audioFileId",
+			"as":           "originalOf",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         db.TrackCollection,
+			"localField":   "_id",
+			"foreignField": "variants.audioFileId",
+			"as":           "variantOf",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         db.TrackCollection,
+			"localField":   "_id",
+			"foreignField": "artworkFileId",
+			"as":           "artworkOf",
+		}}},
+		{{Key: "$match", Value: bson.M{
+			"tracks":     bson.M{"$size": 0},
+			"versionOf":  bson.M{"$size": 0},
+			"originalOf": bson.M{"$size": 0},
+			"variantOf":  bson.M{"$size": 0},
+			"artworkOf":  bson.M{"$size": 0},
+		}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	}
+
+	collection, err := db.getAudioCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
 
-	findResult := db.getTrackCollection().FindOne(ctx, filter)
+	ids := make([]primitive.ObjectID, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids, nil
+}
+
+// UpdateTrack copies the metadata set on updatedTrack onto the stored track, provided it is still at the expected
+// revision.
+func (db *DatabaseHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return err
+	}
+	findResult := collection.FindOne(ctx, bson.M{"_id": id})
 	if findResult.Err() != nil {
-		return findResult.Err()
+		return translateError(findResult.Err())
 	}
 
 	var track models.Track
 	if err := findResult.Decode(&track); err != nil {
 		return err
 	}
+	if revision != AnyRevision && track.Revision != revision {
+		return ErrRevisionMismatch
+	}
+	previous := track
+	mergeTrackMetadata(&track, updatedTrack)
 
+	// The filter on the revision that was read stops a concurrent update from being overwritten between the read and
+	// the write.
+	updateResult := collection.FindOneAndUpdate(ctx, revisionFilter(bson.M{"_id": id}, previous.Revision), bson.M{"$set": track})
+	if updateResult.Err() == mongo.ErrNoDocuments {
+		return db.notMatched(ctx, collection, id, previous.Revision)
+	} else if updateResult.Err() != nil {
+		return updateResult.Err()
+	}
+
+	db.adjustSuggestions(ctx, previous, -1)
+	db.adjustSuggestions(ctx, track, 1)
+	return nil
+}
+
+// mergeTrackMetadata copies the metadata set on updatedTrack onto track and moves it to the next revision.
+func mergeTrackMetadata(track *models.Track, updatedTrack models.Track) {
 	if updatedTrack.Name != "" {
 		track.Name = updatedTrack.Name
 	}
 	if updatedTrack.Artist != "" {
 		track.Artist = updatedTrack.Artist
 	}
+	if updatedTrack.FeaturedArtists != nil {
+		track.FeaturedArtists = updatedTrack.FeaturedArtists
+	}
 	if updatedTrack.AlbumName != "" {
 		track.AlbumName = updatedTrack.AlbumName
 	}
+	if updatedTrack.AlbumArtist != "" {
+		track.AlbumArtist = updatedTrack.AlbumArtist
+	}
+	if updatedTrack.Composer != "" {
+		track.Composer = updatedTrack.Composer
+	}
+	if updatedTrack.IsCompilation {
+		track.IsCompilation = true
+	}
+	if updatedTrack.Year != 0 {
+		track.Year = updatedTrack.Year
+	}
+	if updatedTrack.ArtworkURL != "" {
+		track.ArtworkURL = updatedTrack.ArtworkURL
+	}
+	if !updatedTrack.ArtworkFileID.IsZero() {
+		track.ArtworkFileID = updatedTrack.ArtworkFileID
+	}
+	if updatedTrack.MusicBrainzID != "" {
+		track.MusicBrainzID = updatedTrack.MusicBrainzID
+	}
+	if updatedTrack.ReplayGain != nil {
+		track.ReplayGain = updatedTrack.ReplayGain
+	}
+	track.UpdatedAt = time.Now()
+	track.Revision++
+}
 
-	updateResult := db.getTrackCollection().FindOneAndUpdate(ctx, filter, bson.M{"$set": track})
-	if updateResult.Err() != nil {
-		return updateResult.Err()
+// SetTrackAudio copies the audio file, its format and info, original, variants and fingerprint and the version history
+// from the given track onto the stored one. Files dropped from the history are not deleted here.
+func (db *DatabaseHandler) SetTrackAudio(ctx context.Context, id primitive.ObjectID, track models.Track) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, trackAudioUpdate(track))
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return ErrNotFound
 	}
+	return nil
+}
+
+// trackAudioUpdate returns the update SetTrackAudio applies for the given track.
+func trackAudioUpdate(track models.Track) bson.M {
+	set := bson.M{
+		"audioFileId": track.AudioFileID,
+		"container":   track.Container,
+		"codec":       track.Codec,
+		"versions":    track.Versions,
+		"updatedAt":   time.Now(),
+	}
+	unset := bson.M{}
+	if len(track.Fingerprint) > 0 {
+		set["fingerprint"] = track.Fingerprint
+	} else {
+		unset["fingerprint"] = ""
+	}
+	if track.AudioInfo != nil {
+		set["audioInfo"] = track.AudioInfo
+	} else {
+		unset["audioInfo"] = ""
+	}
+	if track.Original != nil {
+		set["original"] = track.Original
+	} else {
+		unset["original"] = ""
+	}
+	if len(track.Variants) > 0 {
+		set["variants"] = track.Variants
+	} else {
+		unset["variants"] = ""
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"revision": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// AddTrackTags adds tags to a track, ignoring any it already has.
+func (db *DatabaseHandler) AddTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateOne(ctx,
+		revisionFilter(bson.M{"_id": id}, revision),
+		bson.M{
+			"$addToSet": bson.M{"tags": bson.M{"$each": tags}},
+			"$set":      bson.M{"updatedAt": time.Now()},
+			"$inc":      bson.M{"revision": 1},
+		},
+	)
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return db.notMatched(ctx, collection, id, revision)
+	}
+	return nil
+}
+
+// SetTrackLastPlayed records when the track was last played. A play is not an edit, so the revision and updatedAt are
+// left alone.
+func (db *DatabaseHandler) SetTrackLastPlayed(ctx context.Context, id primitive.ObjectID, playedAt time.Time) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastPlayedAt": playedAt}})
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
 
+func (db *DatabaseHandler) RemoveTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateOne(ctx,
+		revisionFilter(bson.M{"_id": id}, revision),
+		bson.M{
+			"$pull": bson.M{"tags": bson.M{"$in": tags}},
+			"$set":  bson.M{"updatedAt": time.Now()},
+			"$inc":  bson.M{"revision": 1},
+		},
+	)
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return db.notMatched(ctx, collection, id, revision)
+	}
 	return nil
 }
 
+// revisionFilter adds the expected revision to the filter of an update. Documents stored before revisions were added
+// have none, and count as revision 0.
+func revisionFilter(filter bson.M, revision int64) bson.M {
+	switch revision {
+	case AnyRevision:
+	case 0:
+		filter["revision"] = bson.M{"$in": bson.A{0, nil}}
+	default:
+		filter["revision"] = revision
+	}
+	return filter
+}
+
+// notMatched explains an update that matched nothing: either the document does not exist, or it does but is no
+// longer at the expected revision.
+func (db *DatabaseHandler) notMatched(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, revision int64) error {
+	if revision == AnyRevision {
+		return ErrNotFound
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	} else if count == 0 {
+		return ErrNotFound
+	}
+	return ErrRevisionMismatch
+}
+
+// SampleTracks returns up to count tracks chosen at random from those matching the filters.
+func (db *DatabaseHandler) SampleTracks(ctx context.Context, filters map[string]interface{}, count int) ([]models.Track, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filters}},
+		{{Key: "$sample", Value: bson.M{"size": count}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Track
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SearchTracks returns up to limit tracks matching the query in the text index over their name, artist, album and tags,
+// best match first.
+func (db *DatabaseHandler) SearchTracks(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	opts := options.Find().SetProjection(score).SetSort(score).SetLimit(int64(limit))
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, bson.M{"$text": bson.M{"$search": query}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Track
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// WatchTracks follows changes to tracks in every tenant's library with a change stream, calling handle for each until
+// the context is cancelled or handle returns an error. Change streams need MongoDB to run as a replica set.
+func (db *DatabaseHandler) WatchTracks(ctx context.Context, handle func(change models.TrackChange) error) error {
+	return db.watch(ctx, db.TrackCollection, func(event changeEvent) error {
+		change := models.TrackChange{Operation: event.Operation, Tenant: event.Tenant, TrackID: event.ID}
+		if event.Document != nil {
+			change.Track = &models.Track{}
+			if err := bson.Unmarshal(event.Document, change.Track); err != nil {
+				return err
+			}
+		}
+		return handle(change)
+	})
+}
+
+// WatchPlaylists follows changes to playlists in every tenant's library in the same way as WatchTracks.
+func (db *DatabaseHandler) WatchPlaylists(ctx context.Context, handle func(change models.PlaylistChange) error) error {
+	return db.watch(ctx, db.PlaylistCollection, func(event changeEvent) error {
+		change := models.PlaylistChange{Operation: event.Operation, Tenant: event.Tenant, PlaylistID: event.ID}
+		if event.Document != nil {
+			change.Playlist = &models.Playlist{}
+			if err := bson.Unmarshal(event.Document, change.Playlist); err != nil {
+				return err
+			}
+		}
+		return handle(change)
+	})
+}
+
+// changeEvent is an insert, update, replace or delete of a document, as read from a change stream. Document holds the
+// document as it is after the change, and is nil once it has been deleted.
+type changeEvent struct {
+	Operation string
+	Tenant    string
+	ID        primitive.ObjectID
+	Document  bson.Raw
+}
+
+// watch follows changes to the named collection in the default database and every tenant's.
+func (db *DatabaseHandler) watch(ctx context.Context, collection string, handle func(event changeEvent) error) error {
+	databases := bson.A{bson.M{"ns.db": db.Database}}
+	if db.TenantDatabasePrefix != "" {
+		databases = append(databases, bson.M{"ns.db": bson.M{"$regex": "^" + regexp.QuoteMeta(db.TenantDatabasePrefix)}})
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"ns.coll":       collection,
+		"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}},
+		"$or":           databases,
+	}}}}
+
+	stream, err := db.Client.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event struct {
+			OperationType string `bson:"operationType"`
+			NS            struct {
+				DB string `bson:"db"`
+			} `bson:"ns"`
+			DocumentKey struct {
+				ID primitive.ObjectID `bson:"_id"`
+			} `bson:"documentKey"`
+			FullDocument bson.Raw `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			return err
+		}
+
+		change := changeEvent{
+			Operation: event.OperationType,
+			ID:        event.DocumentKey.ID,
+			Document:  event.FullDocument,
+		}
+		if event.NS.DB != db.Database {
+			change.Tenant = strings.TrimPrefix(event.NS.DB, db.TenantDatabasePrefix)
+		}
+		if err := handle(change); err != nil {
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+// GetRecentTracks returns the tracks added since the given time, newest first.
+func (db *DatabaseHandler) GetRecentTracks(ctx context.Context, since time.Time) ([]models.Track, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx,
+		bson.M{"createdAt": bson.M{"$gte": since}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Track
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (db *DatabaseHandler) DeleteTrack(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
 	filter := map[string]interface{}{"_id": id}
 
-	result := db.getTrackCollection().FindOneAndDelete(ctx, filter)
+	tracks, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return err
+	}
+	audio, err := db.getAudioCollection(ctx)
+	if err != nil {
+		return err
+	}
+	chunks, err := db.getAudioChunkCollection(ctx)
+	if err != nil {
+		return err
+	}
+	playlists, err := db.getPlaylistCollection(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := tracks.FindOneAndDelete(ctx, filter)
 	if result.Err() != nil {
-		return result.Err()
+		return translateError(result.Err())
 	}
 
 	var track models.Track
 	if err := result.Decode(&track); err != nil {
 		return err
 	}
+	db.adjustSuggestions(ctx, track, -1)
+
+	audioFileIDs := trackAudioFiles(track)
 
-	_, err := db.getAudioCollection().DeleteOne(ctx, map[string]interface{}{"_id": track.AudioFileID})
+	_, err = audio.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": audioFileIDs}})
 	if err != nil {
 		return err
 	}
 
-	_, err = db.getAudioChunkCollection().DeleteMany(ctx, map[string]interface{}{"files_id": track.AudioFileID})
+	_, err = chunks.DeleteMany(ctx, bson.M{"files_id": bson.M{"$in": audioFileIDs}})
 	if err != nil {
 		return err
 	}
 
-	_, err = db.getPlaylistCollection().UpdateMany(ctx,
+	_, err = playlists.UpdateMany(ctx,
 		bson.M{"tracks": track.ID},
-		bson.M{"$pull": bson.M{"tracks": track.ID}},
+		bson.M{"$pull": bson.M{"tracks": track.ID}, "$inc": bson.M{"revision": 1}},
 	)
 
 	return nil
 }
 
+// AddPlaylist inserts a playlist, stamping its creation and update times. A creation time that is already set, as on
+// an imported playlist, is kept.
 func (db *DatabaseHandler) AddPlaylist(ctx context.Context, playlist models.Playlist) error {
-	results, err := db.getPlaylistCollection().InsertOne(ctx, playlist)
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	if playlist.CreatedAt.IsZero() {
+		playlist.CreatedAt = now
+	}
+	playlist.UpdatedAt = now
+
+	collection, err := db.getPlaylistCollection(ctx)
 	if err != nil {
 		return err
+	}
+	results, err := collection.InsertOne(ctx, playlist)
+	if err != nil {
+		return translateError(err)
 	} else if results.InsertedID == nil {
 		return errors.New("no playlist inserted")
 	}
 	return nil
 }
 
-func (db *DatabaseHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M) error {
-	results := db.getPlaylistCollection().FindOneAndUpdate(ctx, map[string]interface{}{"_id": playlistId}, update)
-	if results.Err() != nil {
+// UpdatePlaylist applies an update document to a playlist that is still at the expected revision, adding its update
+// time to any $set it contains and moving it to the next revision.
+func (db *DatabaseHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getPlaylistCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results := collection.FindOneAndUpdate(ctx, revisionFilter(bson.M{"_id": playlistId}, revision), stampPlaylistUpdate(update))
+	if results.Err() == mongo.ErrNoDocuments {
+		return db.notMatched(ctx, collection, playlistId, revision)
+	} else if results.Err() != nil {
+		return results.Err()
+	}
+	return nil
+}
+
+// MovePlaylistTrack moves the first occurrence of a track in a playlist to index, or inserts it there if the playlist
+// does not have it yet. The index is the track's position once moved, and an index past the end moves the track to the
+// end. The move is made by a single pipeline update, so it cannot interleave with other changes to the playlist.
+func (db *DatabaseHandler) MovePlaylistTrack(ctx context.Context, playlistId primitive.ObjectID, trackId primitive.ObjectID, index int, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	// head and tail are the elements of an array before and from an index; $slice rejects the empty ranges at its ends.
+	head := func(array string, n interface{}) bson.M {
+		return bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{n, 0}}, bson.M{"$slice": bson.A{array, n}}, bson.A{}}}
+	}
+	tail := func(array string, from interface{}) bson.M {
+		size := bson.M{"$size": array}
+		return bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{from, size}},
+			bson.M{"$slice": bson.A{array, from, bson.M{"$subtract": bson.A{size, from}}}},
+			bson.A{},
+		}}
+	}
+	let := func(name string, value interface{}, in interface{}) bson.M {
+		return bson.M{"$let": bson.M{"vars": bson.M{name: value}, "in": in}}
+	}
+
+	tracks := let("tracks", bson.M{"$ifNull": bson.A{"$tracks", bson.A{}}},
+		let("position", bson.M{"$indexOfArray": bson.A{"$$tracks", trackId}},
+			let("rest", bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$$position", -1}},
+				"$$tracks",
+				bson.M{"$concatArrays": bson.A{head("$$tracks", "$$position"), tail("$$tracks", bson.M{"$add": bson.A{"$$position", 1}})}},
+			}},
+				let("index", bson.M{"$min": bson.A{index, bson.M{"$size": "$$rest"}}},
+					bson.M{"$concatArrays": bson.A{head("$$rest", "$$index"), bson.A{trackId}, tail("$$rest", "$$index")}}))))
+
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"tracks":    tracks,
+		"updatedAt": time.Now(),
+		"revision":  bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$revision", 0}}, 1}},
+	}}}}
+	collection, err := db.getPlaylistCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results := collection.FindOneAndUpdate(ctx, revisionFilter(bson.M{"_id": playlistId}, revision), update)
+	if results.Err() == mongo.ErrNoDocuments {
+		return db.notMatched(ctx, collection, playlistId, revision)
+	} else if results.Err() != nil {
 		return results.Err()
 	}
 	return nil
 }
 
+// moveTrack returns the tracks of a playlist with the first occurrence of trackId moved to index, or inserted there if
+// the playlist does not have it, as MovePlaylistTrack does.
+func moveTrack(tracks primitive.A, trackId primitive.ObjectID, index int) primitive.A {
+	rest := make(primitive.A, 0, len(tracks)+1)
+	moved := false
+	for _, track := range tracks {
+		if !moved && valuesEqual(track, trackId) {
+			moved = true
+			continue
+		}
+		rest = append(rest, track)
+	}
+	if index > len(rest) {
+		index = len(rest)
+	}
+	return append(rest[:index], append(primitive.A{trackId}, rest[index:]...)...)
+}
+
+// stampPlaylistUpdate returns a copy of a playlist update that also records the update time and moves the playlist to
+// the next revision.
+func stampPlaylistUpdate(update bson.M) bson.M {
+	stamped := bson.M{}
+	for operator, fields := range update {
+		stamped[operator] = fields
+	}
+	set := bson.M{}
+	if fields, ok := update["$set"].(bson.M); ok {
+		for field, value := range fields {
+			set[field] = value
+		}
+	}
+	set["updatedAt"] = time.Now()
+	stamped["$set"] = set
+	stamped["$inc"] = bson.M{"revision": 1}
+	return stamped
+}
+
+// GetPlaylistPage returns a playlist with up to limit of its tracks from offset, or all of them from offset if limit is
+// 0. Only the requested tracks are read: the playlist's track IDs are sliced and joined to the tracks in the database.
+func (db *DatabaseHandler) GetPlaylistPage(ctx context.Context, id primitive.ObjectID, offset int, limit int) (models.PlaylistPage, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	count := limit
+	if count <= 0 {
+		count = math.MaxInt32
+	}
+	tracks := bson.M{"$ifNull": bson.A{"$tracks", bson.A{}}}
+	collection, err := db.getPlaylistCollection(ctx)
+	if err != nil {
+		return models.PlaylistPage{}, err
+	}
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": id}}},
+		{{Key: "$project", Value: bson.M{
+			"name":      1,
+			"revision":  1,
+			"createdAt": 1,
+			"updatedAt": 1,
+			"total":     bson.M{"$size": tracks},
+			"tracks":    bson.M{"$slice": bson.A{tracks, offset, count}},
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         db.TrackCollection,
+			"localField":   "tracks",
+			"foreignField": "_id",
+			"as":           "trackDocuments",
+		}}},
+	})
+	if err != nil {
+		return models.PlaylistPage{}, err
+	}
+
+	var results []struct {
+		models.Playlist `bson:",inline"`
+		Total           int            `bson:"total"`
+		TrackDocuments  []models.Track `bson:"trackDocuments"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return models.PlaylistPage{}, err
+	} else if len(results) == 0 {
+		return models.PlaylistPage{}, ErrNotFound
+	}
+	result := results[0]
+
+	page := newPlaylistPage(result.Playlist, result.Playlist.Tracks, result.TrackDocuments)
+	page.Offset, page.Total = offset, result.Total
+	return page, nil
+}
+
+// newPlaylistPage fills in the page of a playlist with the given IDs from tracks, which may be in any order.
+func newPlaylistPage(playlist models.Playlist, ids []primitive.ObjectID, tracks []models.Track) models.PlaylistPage {
+	byID := make(map[primitive.ObjectID]models.Track, len(tracks))
+	for _, track := range tracks {
+		byID[track.ID] = track
+	}
+
+	page := models.PlaylistPage{
+		ID:        playlist.ID,
+		Name:      playlist.Name,
+		Tracks:    make([]models.Track, 0, len(ids)),
+		Revision:  playlist.Revision,
+		CreatedAt: playlist.CreatedAt,
+		UpdatedAt: playlist.UpdatedAt,
+	}
+	for _, id := range ids {
+		if track, ok := byID[id]; ok {
+			page.Tracks = append(page.Tracks, track)
+		}
+	}
+	return page
+}
+
+// pagePlaylist implements GetPlaylistPage for handlers that read whole documents anyway, by slicing the playlist's
+// tracks and then reading only those.
+func pagePlaylist(ctx context.Context, db DbHandler, id primitive.ObjectID, offset int, limit int) (models.PlaylistPage, error) {
+	playlists, err := db.GetPlaylists(ctx, map[string]interface{}{"_id": id})
+	if err != nil {
+		return models.PlaylistPage{}, err
+	} else if len(playlists) == 0 {
+		return models.PlaylistPage{}, ErrNotFound
+	}
+	playlist := playlists[0]
+
+	ids := playlist.Tracks
+	if offset < len(ids) {
+		ids = ids[offset:]
+	} else {
+		ids = nil
+	}
+	if limit > 0 && limit < len(ids) {
+		ids = ids[:limit]
+	}
+
+	var tracks []models.Track
+	if len(ids) > 0 {
+		if tracks, err = db.GetTracks(ctx, map[string]interface{}{"_id": bson.M{"$in": ids}}); err != nil {
+			return models.PlaylistPage{}, err
+		}
+	}
+
+	page := newPlaylistPage(playlist, ids, tracks)
+	page.Offset, page.Total = offset, len(playlist.Tracks)
+	return page, nil
+}
+
 func (db *DatabaseHandler) DeletePlaylist(ctx context.Context, id primitive.ObjectID) error {
-	results, err := db.getPlaylistCollection().DeleteOne(ctx, map[string]interface{}{"_id": id})
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getPlaylistCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := collection.DeleteOne(ctx, map[string]interface{}{"_id": id})
 	if err != nil {
 		return err
 	} else if results.DeletedCount == 0 {
-		return errors.New("no documents were deleted")
+		return ErrNotFound
 	}
 	return nil
 }
 
 func (db *DatabaseHandler) GetPlaylists(ctx context.Context, filters map[string]interface{}) ([]models.Playlist, error) {
-	cursor, err := db.getPlaylistCollection().Find(ctx, filters)
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getPlaylistCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filters)
 	if err != nil {
 		return nil, err
 	}
@@ -206,6 +1100,347 @@ func (db *DatabaseHandler) GetPlaylists(ctx context.Context, filters map[string]
 	return results, nil
 }
 
+func (db *DatabaseHandler) AddPodcast(ctx context.Context, podcast models.Podcast) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getPodcastCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := collection.InsertOne(ctx, podcast)
+	if err != nil {
+		return translateError(err)
+	} else if results.InsertedID == nil {
+		return errors.New("no podcast inserted")
+	}
+	return nil
+}
+
+func (db *DatabaseHandler) UpdatePodcast(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getPodcastCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results := collection.FindOneAndUpdate(ctx, map[string]interface{}{"_id": id}, update)
+	if results.Err() != nil {
+		return translateError(results.Err())
+	}
+	return nil
+}
+
+func (db *DatabaseHandler) DeletePodcast(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getPodcastCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := collection.DeleteOne(ctx, map[string]interface{}{"_id": id})
+	if err != nil {
+		return err
+	} else if results.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *DatabaseHandler) GetPodcasts(ctx context.Context, filters map[string]interface{}) ([]models.Podcast, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getPodcastCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Podcast
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (db *DatabaseHandler) AddAPIKey(ctx context.Context, key models.APIKey) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getAPIKeyCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := collection.InsertOne(ctx, key)
+	if err != nil {
+		return translateError(err)
+	} else if results.InsertedID == nil {
+		return errors.New("no api key inserted")
+	}
+	return nil
+}
+
+func (db *DatabaseHandler) GetAPIKeys(ctx context.Context, filters map[string]interface{}) ([]models.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getAPIKeyCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.APIKey
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (db *DatabaseHandler) AddShare(ctx context.Context, share models.Share) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getShareCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := collection.InsertOne(ctx, share)
+	if err != nil {
+		return translateError(err)
+	} else if results.InsertedID == nil {
+		return errors.New("no share inserted")
+	}
+	return nil
+}
+
+func (db *DatabaseHandler) GetShares(ctx context.Context, filters map[string]interface{}) ([]models.Share, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getShareCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Share
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// RecordSharePlay counts a play against a share. The check against the share's play limit happens in the same update,
+// so concurrent plays cannot exceed it; ErrNotFound is returned once the limit has been reached.
+func (db *DatabaseHandler) RecordSharePlay(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"maxPlays": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$plays", "$maxPlays"}}},
+		},
+	}
+
+	collection, err := db.getShareCollection(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"plays": 1}})
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EnsureIndexes creates the indexes the API's queries rely on, in the default database and every tenant's. Creating an
+// index that already exists is a no-op.
+func (db *DatabaseHandler) EnsureIndexes(ctx context.Context) error {
+	if err := db.createIndexes(ctx, db.Client.Database(db.Database)); err != nil {
+		return err
+	}
+
+	tenants, err := db.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		db.indexedTenants.Delete(tenant)
+		if err := db.indexTenant(ctx, tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexes creates the indexes of the library's collections in a database, and those of the job queue.
+func (db *DatabaseHandler) createIndexes(ctx context.Context, database *mongo.Database) error {
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		database.Collection(db.TrackCollection): {
+			{Keys: bson.D{{Key: "name", Value: 1}}},
+			{Keys: bson.D{{Key: "artist", Value: 1}}},
+			{Keys: bson.D{{Key: "album", Value: 1}}},
+			{Keys: bson.D{{Key: "audioFileId", Value: 1}}},
+			{Keys: bson.D{{Key: "checksum", Value: 1}}},
+			{Keys: bson.D{{Key: "tags", Value: 1}}},
+			{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+			{
+				Keys: bson.D{
+					{Key: "name", Value: "text"},
+					{Key: "artist", Value: "text"},
+					{Key: "album", Value: "text"},
+					{Key: "tags", Value: "text"},
+				},
+				Options: options.Index().SetWeights(bson.M{"name": 3, "artist": 2, "album": 1, "tags": 1}),
+			},
+			{Keys: bson.D{{Key: "podcastId", Value: 1}, {Key: "episodeGuid", Value: 1}}},
+		},
+		database.Collection(db.PlaylistCollection): {
+			{Keys: bson.D{{Key: "name", Value: 1}}},
+			{Keys: bson.D{{Key: "tracks", Value: 1}}},
+		},
+		database.Collection(db.PodcastCollection): {
+			{Keys: bson.D{{Key: "feedUrl", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		database.Collection(db.APIKeyCollection): {
+			{Keys: bson.D{{Key: "keyHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		database.Collection(db.ShareCollection): {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		database.Collection(db.SuggestionCollection): {
+			{Keys: bson.D{{Key: "normalized", Value: 1}}},
+		},
+		database.Collection(db.PlayCollection): {
+			{Keys: bson.D{{Key: "trackId", Value: 1}, {Key: "playedAt", Value: -1}}},
+			{Keys: bson.D{{Key: "playedAt", Value: -1}}},
+		},
+		db.getJobCollection(): {
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "runAt", Value: 1}}},
+			{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "createdAt", Value: -1}}},
+		},
+	}
+
+	for collection, indexModels := range indexes {
+		if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *DatabaseHandler) Ping(ctx context.Context) error {
 	return db.Client.Ping(ctx, readpref.Primary())
 }
+
+// PingAudioStore checks that the GridFS bucket holding track audio can be read. Health checks are made without a
+// tenant, so the default database's bucket is read then.
+func (db *DatabaseHandler) PingAudioStore(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	database := db.Client.Database(db.Database)
+	if TenantFromContext(ctx) != "" {
+		var err error
+		if database, err = db.database(ctx); err != nil {
+			return err
+		}
+	}
+	err := database.Collection(db.AudioCollection).FindOne(ctx, bson.M{}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	return err
+}
+
+func (db *DatabaseHandler) AddPlay(ctx context.Context, play models.Play) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getPlayCollection(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := collection.InsertOne(ctx, play)
+	if err != nil {
+		return translateError(err)
+	} else if results.InsertedID == nil {
+		return errors.New("no play inserted")
+	}
+	return nil
+}
+
+// GetPlayCounts returns how many times each track has been played since the given time, with the time of its latest
+// play. Tracks without plays are not included.
+func (db *DatabaseHandler) GetPlayCounts(ctx context.Context, since time.Time) ([]models.PlayCount, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	collection, err := db.getPlayCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"playedAt": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$trackId",
+			"plays":      bson.M{"$sum": 1},
+			"lastPlayed": bson.M{"$max": "$playedAt"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.PlayCount
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SetNowPlaying stores what a user is listening to, replacing what they were before.
+func (db *DatabaseHandler) SetNowPlaying(ctx context.Context, state models.NowPlaying) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	collection, err := db.getNowPlayingCollection(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = collection.ReplaceOne(ctx, bson.M{"_id": state.User}, state, options.Replace().SetUpsert(true))
+	return translateError(err)
+}
+
+// GetNowPlaying returns what a user was last listening to, or ErrNotFound if they have never said.
+func (db *DatabaseHandler) GetNowPlaying(ctx context.Context, user string) (models.NowPlaying, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	var state models.NowPlaying
+	collection, err := db.getNowPlayingCollection(ctx)
+	if err != nil {
+		return models.NowPlaying{}, err
+	}
+	if err := collection.FindOne(ctx, bson.M{"_id": user}).Decode(&state); err != nil {
+		return models.NowPlaying{}, translateError(err)
+	}
+	return state, nil
+}
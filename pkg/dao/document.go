@@ -0,0 +1,552 @@
+package dao
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The backends other than MongoDB store each record as a BSON document and evaluate the filters and update documents
+// callers pass to a DbHandler themselves. Only the operators the API uses are supported; anything else is an error
+// rather than being silently ignored.
+
+// toDocument converts a model, filter or update to a document. Going through BSON gives every value the type MongoDB
+// would see, such as int64 for an int or primitive.DateTime for a time.Time, so documents and filters compare alike.
+func toDocument(value interface{}) (bson.M, error) {
+	if m, ok := value.(map[string]interface{}); ok {
+		value = bson.M(m)
+	}
+	encoded, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(encoded, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// fromDocument decodes a document into a model.
+func fromDocument(doc bson.M, out interface{}) error {
+	encoded, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(encoded, out)
+}
+
+// matchFilter reports whether the document matches a filter as MongoDB's find would.
+func matchFilter(doc bson.M, filter map[string]interface{}) (bool, error) {
+	normalized, err := toDocument(filter)
+	if err != nil {
+		return false, err
+	}
+	return matchDocument(doc, normalized)
+}
+
+func matchDocument(doc bson.M, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var matched bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			matched, err = matchLogical(doc, key, condition)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported filter operator %v", key)
+			}
+			matched, err = matchCondition(lookupPath(doc, key), condition)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, operator string, condition interface{}) (bool, error) {
+	clauses, ok := condition.(primitive.A)
+	if !ok {
+		return false, fmt.Errorf("%v needs an array", operator)
+	}
+	for _, clause := range clauses {
+		filter, ok := clause.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("%v needs an array of filters", operator)
+		}
+		matched, err := matchDocument(doc, filter)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case operator == "$and" && !matched:
+			return false, nil
+		case operator == "$or" && matched:
+			return true, nil
+		case operator == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return operator != "$or", nil
+}
+
+// lookupPath returns the values at a dotted path. A path through an array reaches into each of its elements, so
+// "versions.audioFileId" finds the audio file of every version. A missing field has no values.
+func lookupPath(value interface{}, path string) []interface{} {
+	if path == "" {
+		return []interface{}{value}
+	}
+	field, rest := path, ""
+	if i := strings.Index(path, "."); i >= 0 {
+		field, rest = path[:i], path[i+1:]
+	}
+
+	switch v := value.(type) {
+	case bson.M:
+		child, ok := v[field]
+		if !ok {
+			return nil
+		}
+		return lookupPath(child, rest)
+	case primitive.A:
+		var values []interface{}
+		for _, element := range v {
+			if _, ok := element.(bson.M); ok {
+				values = append(values, lookupPath(element, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// matchCondition reports whether the values found for a field satisfy a condition, which is either a document of
+// operators or a value to equal.
+func matchCondition(values []interface{}, condition interface{}) (bool, error) {
+	operators, ok := condition.(bson.M)
+	if !ok || !isOperatorDocument(operators) {
+		return matchesValue(values, condition), nil
+	}
+
+	for operator, operand := range operators {
+		matched, err := matchOperator(values, operator, operand, operators)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func isOperatorDocument(doc bson.M) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func matchOperator(values []interface{}, operator string, operand interface{}, operators bson.M) (bool, error) {
+	switch operator {
+	case "$exists":
+		return truthy(operand) == (len(values) > 0), nil
+	case "$eq":
+		return matchesValue(values, operand), nil
+	case "$ne":
+		return !matchesValue(values, operand), nil
+	case "$in", "$nin", "$all":
+		list, ok := operand.(primitive.A)
+		if !ok {
+			return false, fmt.Errorf("%v needs an array", operator)
+		}
+		if operator == "$all" {
+			for _, want := range list {
+				if !matchesValue(values, want) {
+					return false, nil
+				}
+			}
+			return len(list) > 0, nil
+		}
+		found := false
+		for _, want := range list {
+			if matchesValue(values, want) {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "$in"), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		return anyElement(values, func(value interface{}) bool {
+			order, ok := compareValues(value, operand)
+			if !ok {
+				return false
+			}
+			switch operator {
+			case "$gt":
+				return order > 0
+			case "$gte":
+				return order >= 0
+			case "$lt":
+				return order < 0
+			}
+			return order <= 0
+		}), nil
+	case "$regex":
+		pattern, err := compileRegex(operand, operators["$options"])
+		if err != nil {
+			return false, err
+		}
+		return anyElement(values, func(value interface{}) bool {
+			s, ok := value.(string)
+			return ok && pattern.MatchString(s)
+		}), nil
+	case "$options":
+		return true, nil
+	case "$size":
+		size, ok := toFloat(operand)
+		if !ok {
+			return false, fmt.Errorf("$size needs a number")
+		}
+		for _, value := range values {
+			if array, ok := value.(primitive.A); ok && float64(len(array)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported filter operator %v", operator)
+}
+
+// matchesValue reports whether any of the values equals want, or is an array with an element that does. A nil want
+// also matches a missing field.
+func matchesValue(values []interface{}, want interface{}) bool {
+	if want == nil && len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if valuesEqual(value, want) {
+			return true
+		}
+		if array, ok := value.(primitive.A); ok {
+			if _, wantArray := want.(primitive.A); !wantArray {
+				for _, element := range array {
+					if valuesEqual(element, want) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// anyElement reports whether test holds for any of the values, or any element of one that is an array.
+func anyElement(values []interface{}, test func(value interface{}) bool) bool {
+	for _, value := range values {
+		if array, ok := value.(primitive.A); ok {
+			for _, element := range array {
+				if test(element) {
+					return true
+				}
+			}
+		} else if test(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileRegex(pattern interface{}, options interface{}) (*regexp.Regexp, error) {
+	var expr, flags string
+	switch p := pattern.(type) {
+	case string:
+		expr = p
+	case primitive.Regex:
+		expr, flags = p.Pattern, p.Options
+	default:
+		return nil, fmt.Errorf("$regex needs a string")
+	}
+	if o, ok := options.(string); ok {
+		flags += o
+	}
+	if strings.Contains(flags, "i") {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func valuesEqual(a interface{}, b interface{}) bool {
+	if order, ok := compareValues(a, b); ok {
+		return order == 0
+	}
+	switch av := a.(type) {
+	case primitive.A:
+		bv, ok := b.(primitive.A)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case bson.M:
+		bv, ok := b.(bson.M)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !valuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues orders two values of the same kind: numbers of any type, strings, dates, object IDs or booleans. It
+// reports false for values that are not comparable.
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case primitive.DateTime:
+		if bv, ok := b.(primitive.DateTime); ok {
+			return compareInts(int64(av), int64(bv)), true
+		}
+	case primitive.ObjectID:
+		if bv, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(av[:], bv[:]), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, true
+			case bv:
+				return -1, true
+			}
+			return 1, true
+		}
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func compareInts(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func truthy(value interface{}) bool {
+	if f, ok := toFloat(value); ok {
+		return f != 0
+	}
+	b, ok := value.(bool)
+	return !ok || b
+}
+
+// applyUpdate applies an update document of $set, $unset, $inc, $push, $addToSet and $pull operators to a document.
+func applyUpdate(doc bson.M, update bson.M) error {
+	normalized, err := toDocument(update)
+	if err != nil {
+		return err
+	}
+
+	// Operators are applied in a fixed order so that the result does not depend on map iteration.
+	operators := make([]string, 0, len(normalized))
+	for operator := range normalized {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	for _, operator := range operators {
+		fields, ok := normalized[operator].(bson.M)
+		if !ok {
+			return fmt.Errorf("%v needs a document", operator)
+		}
+		for path, operand := range fields {
+			if err := applyOperator(doc, operator, path, operand); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyOperator(doc bson.M, operator string, path string, operand interface{}) error {
+	parent, field := parentDocument(doc, path, operator != "$unset")
+	if parent == nil {
+		if operator == "$unset" || operator == "$pull" {
+			return nil
+		}
+		return fmt.Errorf("cannot apply %v to %v", operator, path)
+	}
+
+	switch operator {
+	case "$set":
+		parent[field] = operand
+	case "$unset":
+		delete(parent, field)
+	case "$inc":
+		sum, err := addNumbers(parent[field], operand)
+		if err != nil {
+			return fmt.Errorf("cannot apply $inc to %v: %w", path, err)
+		}
+		parent[field] = sum
+	case "$push", "$addToSet":
+		array, err := arrayField(parent, field)
+		if err != nil {
+			return fmt.Errorf("cannot apply %v to %v: %w", operator, path, err)
+		}
+		items := primitive.A{operand}
+		if each, ok := operand.(bson.M); ok {
+			if list, ok := each["$each"].(primitive.A); ok {
+				items = list
+			}
+		}
+		for _, item := range items {
+			if operator == "$addToSet" && matchesValue([]interface{}{array}, item) {
+				continue
+			}
+			array = append(array, item)
+		}
+		parent[field] = array
+	case "$pull":
+		if _, ok := parent[field]; !ok {
+			return nil
+		}
+		array, err := arrayField(parent, field)
+		if err != nil {
+			return fmt.Errorf("cannot apply $pull to %v: %w", path, err)
+		}
+		kept := primitive.A{}
+		for _, element := range array {
+			matched, err := matchCondition([]interface{}{element}, operand)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				kept = append(kept, element)
+			}
+		}
+		parent[field] = kept
+	default:
+		return fmt.Errorf("unsupported update operator %v", operator)
+	}
+	return nil
+}
+
+// parentDocument returns the document holding the last field of a dotted path, and that field's name. Missing
+// documents along the path are created when create is set, and otherwise nil is returned.
+func parentDocument(doc bson.M, path string, create bool) (bson.M, string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := doc[part].(bson.M)
+		if !ok {
+			if !create || doc[part] != nil {
+				return nil, ""
+			}
+			child = bson.M{}
+			doc[part] = child
+		}
+		doc = child
+	}
+	return doc, parts[len(parts)-1]
+}
+
+func arrayField(doc bson.M, field string) (primitive.A, error) {
+	switch v := doc[field].(type) {
+	case nil:
+		return primitive.A{}, nil
+	case primitive.A:
+		return v, nil
+	}
+	return nil, fmt.Errorf("field is not an array")
+}
+
+// addNumbers adds an increment to a number, keeping integers as integers. A missing field counts as 0.
+func addNumbers(current interface{}, delta interface{}) (interface{}, error) {
+	if current == nil {
+		current = int32(0)
+	}
+	switch c := current.(type) {
+	case int32:
+		if d, ok := delta.(int32); ok {
+			return c + d, nil
+		}
+	}
+	ci, cInt := toInt64(current)
+	di, dInt := toInt64(delta)
+	if cInt && dInt {
+		return ci + di, nil
+	}
+	cf, ok := toFloat(current)
+	if !ok {
+		return nil, fmt.Errorf("field is not a number")
+	}
+	df, ok := toFloat(delta)
+	if !ok {
+		return nil, fmt.Errorf("increment is not a number")
+	}
+	return cf + df, nil
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDao_MatchFilter_ShouldMatchLikeMongo(t *testing.T) {
+	audioFile := primitive.NewObjectID()
+	track := models.Track{
+		ID:        primitive.NewObjectID(),
+		Name:      "Song",
+		Year:      2001,
+		Tags:      []string{"rock", "live"},
+		Versions:  []models.AudioVersion{{AudioFileID: audioFile}},
+		CreatedAt: time.Now(),
+	}
+	doc, err := toDocument(track)
+	require.Nil(t, err)
+
+	matching := []map[string]interface{}{
+		{},
+		{"_id": track.ID},
+		{"_id": bson.M{"$in": []primitive.ObjectID{primitive.NewObjectID(), track.ID}}},
+		{"name": "Song", "year": 2001},
+		{"tags": "rock"},
+		{"tags": bson.M{"$all": []string{"live", "rock"}}},
+		{"versions.audioFileId": audioFile},
+		{"fingerprint": bson.M{"$exists": false}},
+		{"podcastId": nil},
+		{"year": bson.M{"$gte": 2000, "$lt": 2002}},
+		{"createdAt": bson.M{"$gte": track.CreatedAt.Add(-time.Minute)}},
+		{"name": bson.M{"$regex": "^so", "$options": "i"}},
+		{"$or": bson.A{bson.M{"name": "Other"}, bson.M{"tags": bson.M{"$size": 2}}}},
+	}
+	for _, filter := range matching {
+		matched, err := matchFilter(doc, filter)
+		require.Nil(t, err)
+		require.True(t, matched, "%v", filter)
+	}
+
+	notMatching := []map[string]interface{}{
+		{"_id": primitive.NewObjectID()},
+		{"name": "Song", "year": 2002},
+		{"tags": bson.M{"$all": []string{"live", "jazz"}}},
+		{"tags": bson.M{"$nin": []string{"live"}}},
+		{"name": bson.M{"$exists": false}},
+		{"year": bson.M{"$gt": 2001}},
+		{"$nor": bson.A{bson.M{"name": "Song"}}},
+	}
+	for _, filter := range notMatching {
+		matched, err := matchFilter(doc, filter)
+		require.Nil(t, err)
+		require.False(t, matched, "%v", filter)
+	}
+}
+
+func TestDao_MatchFilter_ShouldRejectUnsupportedOperators(t *testing.T) {
+	_, err := matchFilter(bson.M{}, map[string]interface{}{"$where": "true"})
+	require.NotNil(t, err)
+
+	_, err = matchFilter(bson.M{}, map[string]interface{}{"name": bson.M{"$elemMatch": bson.M{}}})
+	require.NotNil(t, err)
+}
+
+func TestDao_ApplyUpdate_ShouldApplyOperators(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	doc, err := toDocument(models.Playlist{ID: primitive.NewObjectID(), Name: "Old", Tracks: []primitive.ObjectID{first}, Revision: 2})
+	require.Nil(t, err)
+	doc["tags"] = primitive.A{"a", "b"}
+
+	require.Nil(t, applyUpdate(doc, bson.M{
+		"$set":      bson.M{"name": "New", "trim.leadingSilence": 1.5},
+		"$inc":      bson.M{"revision": 1},
+		"$push":     bson.M{"tracks": bson.M{"$each": []primitive.ObjectID{second, first}}},
+		"$addToSet": bson.M{"tags": bson.M{"$each": []string{"b", "c"}}},
+		"$unset":    bson.M{"createdAt": ""},
+	}))
+	require.Nil(t, applyUpdate(doc, bson.M{"$pull": bson.M{"tracks": first, "tags": bson.M{"$in": []string{"a"}}}}))
+
+	var playlist models.Playlist
+	require.Nil(t, fromDocument(doc, &playlist))
+	require.Equal(t, "New", playlist.Name)
+	require.Equal(t, int64(3), playlist.Revision)
+	require.Equal(t, []primitive.ObjectID{second}, playlist.Tracks)
+	require.Equal(t, primitive.A{"b", "c"}, doc["tags"])
+	require.Equal(t, 1.5, doc["trim"].(bson.M)["leadingSilence"])
+	require.NotContains(t, doc, "createdAt")
+}
+
+func TestDao_ApplyUpdate_ShouldRejectUnsupportedOperators(t *testing.T) {
+	require.NotNil(t, applyUpdate(bson.M{}, bson.M{"$rename": bson.M{"name": "title"}}))
+	require.NotNil(t, applyUpdate(bson.M{"name": "Song"}, bson.M{"$inc": bson.M{"name": 1}}))
+}
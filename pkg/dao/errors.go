@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// The kinds of failure a DbHandler reports, whatever the database behind it. Callers should test for them with
+// errors.Is, as more specific errors such as ErrRevisionMismatch are also of one of these kinds.
+var (
+	// ErrNotFound is returned when the document or file an operation is about does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when an insert would break a unique index, such as adding a podcast feed twice.
+	ErrDuplicate = errors.New("already exists")
+	// ErrConflict is returned when a document exists but is not in the state a change to it expected.
+	ErrConflict = errors.New("conflict")
+)
+
+// kindError is a specific error that is also one of the broader kinds above under errors.Is.
+type kindError struct {
+	kind    error
+	message string
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// translateError turns the driver's errors for a missing document or file, or a duplicate key, into the DAO's own, so
+// that callers do not depend on the driver. Other errors are returned as they are.
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, gridfs.ErrFileNotFound):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	default:
+		return err
+	}
+}
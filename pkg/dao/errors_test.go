@@ -0,0 +1,30 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestDao_TranslateError_ShouldMapDriverErrorsToDaoErrors(t *testing.T) {
+	require.Equal(t, ErrNotFound, translateError(mongo.ErrNoDocuments))
+	require.Equal(t, ErrNotFound, translateError(fmt.Errorf("wrapped: %w", gridfs.ErrFileNotFound)))
+
+	duplicate := translateError(mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}})
+	require.True(t, errors.Is(duplicate, ErrDuplicate))
+	require.Contains(t, duplicate.Error(), "E11000")
+
+	other := errors.New("test")
+	require.Equal(t, other, translateError(other))
+	require.Nil(t, translateError(nil))
+}
+
+func TestDao_ConflictErrors_ShouldBeErrConflict(t *testing.T) {
+	require.True(t, errors.Is(ErrRevisionMismatch, ErrConflict))
+	require.True(t, errors.Is(fmt.Errorf("wrapped: %w", ErrJobStatus), ErrConflict))
+	require.False(t, errors.Is(ErrRevisionMismatch, ErrJobStatus))
+}
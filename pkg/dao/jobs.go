@@ -0,0 +1,147 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrJobStatus is returned for a change to a job that is no longer in a status the change applies to, such as
+// cancelling one that has finished. It is an ErrConflict.
+var ErrJobStatus error = &kindError{kind: ErrConflict, message: "job status does not allow this change"}
+
+// getJobCollection returns the job queue, which lives in the default database for every tenant so one set of workers
+// can serve them all. Jobs record the tenant they belong to instead.
+func (db *DatabaseHandler) getJobCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.JobCollection)
+}
+
+// AddJob queues a job for the tenant in the context.
+func (db *DatabaseHandler) AddJob(ctx context.Context, job models.Job) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	job.Tenant = TenantFromContext(ctx)
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+
+	results, err := db.getJobCollection().InsertOne(ctx, job)
+	if err != nil {
+		return translateError(err)
+	} else if results.InsertedID == nil {
+		return errors.New("no job inserted")
+	}
+	return nil
+}
+
+// ClaimJob hands the worker the longest-waiting job of one of the given kinds that is due to run, or whose previous
+// worker's lease has run out, and leases it to the worker. It returns ErrNotFound if there is none.
+func (db *DatabaseHandler) ClaimJob(ctx context.Context, worker string, kinds []string, lease time.Duration) (models.Job, error) {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"kind": bson.M{"$in": kinds},
+		"$or": bson.A{
+			bson.M{"status": models.JobQueued, "runAt": bson.M{"$lte": now}},
+			bson.M{"status": models.JobRunning, "lockedUntil": bson.M{"$lt": now}},
+		},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "runAt", Value: 1}}).SetReturnDocument(options.After)
+
+	var job models.Job
+	if err := db.getJobCollection().FindOneAndUpdate(ctx, filter, claimJobUpdate(worker, now, lease), opts).Decode(&job); err != nil {
+		return models.Job{}, translateError(err)
+	}
+	return job, nil
+}
+
+// claimJobUpdate returns the update that leases a job to the worker.
+func claimJobUpdate(worker string, now time.Time, lease time.Duration) bson.M {
+	return bson.M{
+		"$set": bson.M{"status": models.JobRunning, "lockedBy": worker, "lockedUntil": now.Add(lease), "updatedAt": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+}
+
+// UpdateJob applies the update to the job, whichever tenant it belongs to, and records when it changed.
+func (db *DatabaseHandler) UpdateJob(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	stampJobUpdate(update)
+
+	return translateError(db.getJobCollection().FindOneAndUpdate(ctx, bson.M{"_id": id}, update).Err())
+}
+
+// TransitionJob applies the update to the job, whichever tenant it belongs to, provided it is in one of the from
+// statuses, and returns the job as updated. The check and the update are a single operation, so a job cannot be
+// changed by two transitions that each expected it in the status it was in before the other. It returns ErrJobStatus
+// if the job is in another status, and ErrNotFound if there is no such job.
+func (db *DatabaseHandler) TransitionJob(ctx context.Context, id primitive.ObjectID, from []string, update bson.M) (models.Job, error) {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	stampJobUpdate(update)
+
+	filter := bson.M{"_id": id, "status": bson.M{"$in": from}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var job models.Job
+	err := db.getJobCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, countErr := db.getJobCollection().CountDocuments(ctx, bson.M{"_id": id})
+		if countErr != nil {
+			return models.Job{}, countErr
+		} else if count > 0 {
+			return models.Job{}, ErrJobStatus
+		}
+	}
+	if err != nil {
+		return models.Job{}, translateError(err)
+	}
+	return job, nil
+}
+
+// stampJobUpdate adds the update time to the $set of a job update.
+func stampJobUpdate(update bson.M) {
+	if set, ok := update["$set"].(bson.M); ok {
+		set["updatedAt"] = time.Now()
+	} else if _, exists := update["$set"]; !exists {
+		update["$set"] = bson.M{"updatedAt": time.Now()}
+	}
+}
+
+// GetJobs returns the jobs of the tenant in the context matching the filters, newest first.
+func (db *DatabaseHandler) GetJobs(ctx context.Context, filters map[string]interface{}) ([]models.Job, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	filter := bson.M{"tenant": TenantFromContext(ctx)}
+	for key, value := range filters {
+		filter[key] = value
+	}
+
+	cursor, err := db.getJobCollection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Job
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
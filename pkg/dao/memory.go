@@ -0,0 +1,1000 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	memoryTracks     = "tracks"
+	memoryPlaylists  = "playlists"
+	memoryPodcasts   = "podcasts"
+	memoryAPIKeys    = "apiKeys"
+	memoryShares     = "shares"
+	memoryPlays      = "plays"
+	memoryNowPlaying = "nowPlaying"
+	memoryJobs       = "jobs"
+)
+
+// memoryWatchBuffer is how many changes a watcher that is busy handling one can fall behind by before further changes
+// are dropped.
+const memoryWatchBuffer = 64
+
+// MemoryHandler is a DbHandler keeping the library in memory, for demos and tests that should run without a
+// database. Everything is lost when the process exits. Records are kept as documents, and the filters and updates
+// callers pass are evaluated over them as MongoDB would, with the same constraints the SQL handlers enforce: IDs and
+// podcast feeds are unique, and playlists and plays must refer to tracks that exist.
+type MemoryHandler struct {
+	mu sync.Mutex
+	// documents holds each collection's documents by tenant, in the order they were added.
+	documents map[string]map[string][]bson.M
+	audio     map[string]map[primitive.ObjectID][]byte
+	watchers  map[string]map[chan memoryChange]bool
+}
+
+// memoryChange is an insert, update or delete of a track or playlist, with the document as it is after the change, or
+// nil once it has been deleted.
+type memoryChange struct {
+	operation string
+	tenant    string
+	id        primitive.ObjectID
+	doc       bson.M
+}
+
+func NewMemoryHandler() *MemoryHandler {
+	return &MemoryHandler{
+		documents: make(map[string]map[string][]bson.M),
+		audio:     make(map[string]map[primitive.ObjectID][]byte),
+		watchers:  make(map[string]map[chan memoryChange]bool),
+	}
+}
+
+// cloneDocument returns a deep copy of a document, so that callers never share the stored one.
+func cloneDocument(doc bson.M) (bson.M, error) {
+	encoded, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var clone bson.M
+	if err := bson.Unmarshal(encoded, &clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+func (db *MemoryHandler) index(collection string, tenant string, id primitive.ObjectID) int {
+	for i, doc := range db.documents[collection][tenant] {
+		if doc["_id"] == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// find returns copies of the tenant's documents in the collection matching the filters. The caller must hold the lock.
+func (db *MemoryHandler) find(collection string, tenant string, filters map[string]interface{}) ([]bson.M, error) {
+	var docs []bson.M
+	for _, doc := range db.documents[collection][tenant] {
+		matched, err := matchFilter(doc, filters)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		clone, err := cloneDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, clone)
+	}
+	return docs, nil
+}
+
+// findOne returns a copy of the tenant's document with the given ID. The caller must hold the lock.
+func (db *MemoryHandler) findOne(collection string, tenant string, id primitive.ObjectID) (bson.M, error) {
+	i := db.index(collection, tenant, id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	return cloneDocument(db.documents[collection][tenant][i])
+}
+
+// insert adds a document, which must have an ID no other document in the collection has. The caller must hold the
+// lock.
+func (db *MemoryHandler) insert(collection string, tenant string, value interface{}) error {
+	doc, err := toDocument(value)
+	if err != nil {
+		return err
+	}
+	id, _ := doc["_id"].(primitive.ObjectID)
+	if db.index(collection, tenant, id) >= 0 {
+		return fmt.Errorf("%w: %v %v already exists", ErrDuplicate, collection, id.Hex())
+	}
+
+	if db.documents[collection] == nil {
+		db.documents[collection] = make(map[string][]bson.M)
+	}
+	db.documents[collection][tenant] = append(db.documents[collection][tenant], doc)
+	db.notify(collection, "insert", tenant, id, doc)
+	return nil
+}
+
+// store replaces the document with the same ID. The caller must hold the lock.
+func (db *MemoryHandler) store(collection string, tenant string, doc bson.M) error {
+	id, _ := doc["_id"].(primitive.ObjectID)
+	i := db.index(collection, tenant, id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	db.documents[collection][tenant][i] = doc
+	db.notify(collection, "update", tenant, id, doc)
+	return nil
+}
+
+// update applies an update to a document that is still at the expected revision, leaving it unchanged if the update
+// fails. check, if not nil, is run on the updated document before it is stored. The caller must hold the lock.
+func (db *MemoryHandler) update(collection string, tenant string, id primitive.ObjectID, revision int64, update bson.M, check func(doc bson.M) error) error {
+	doc, err := db.findOne(collection, tenant, id)
+	if err != nil {
+		return err
+	}
+	if revision != AnyRevision && docRevision(doc) != revision {
+		return ErrRevisionMismatch
+	}
+	if err := applyUpdate(doc, update); err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(doc); err != nil {
+			return err
+		}
+	}
+	return db.store(collection, tenant, doc)
+}
+
+// remove deletes the tenant's document with the given ID. The caller must hold the lock.
+func (db *MemoryHandler) remove(collection string, tenant string, id primitive.ObjectID) error {
+	i := db.index(collection, tenant, id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	docs := db.documents[collection][tenant]
+	db.documents[collection][tenant] = append(docs[:i:i], docs[i+1:]...)
+	db.notify(collection, "delete", tenant, id, nil)
+	return nil
+}
+
+// unique returns ErrDuplicate if one of the tenant's documents in the collection already has the value in the field.
+// The caller must hold the lock.
+func (db *MemoryHandler) unique(collection string, tenant string, field string, value string) error {
+	for _, doc := range db.documents[collection][tenant] {
+		if docString(doc, field) == value {
+			return fmt.Errorf("%w: %v with %v %v already exists", ErrDuplicate, collection, field, value)
+		}
+	}
+	return nil
+}
+
+// checkTracksExist returns ErrNotFound if any of the tracks is not in the tenant's library. The caller must hold the
+// lock.
+func (db *MemoryHandler) checkTracksExist(tenant string, doc bson.M) error {
+	tracks, _ := doc["tracks"].(primitive.A)
+	for _, track := range tracks {
+		id, _ := track.(primitive.ObjectID)
+		if db.index(memoryTracks, tenant, id) < 0 {
+			return fmt.Errorf("%w: track %v does not exist", ErrNotFound, id.Hex())
+		}
+	}
+	return nil
+}
+
+// notify passes a change to tracks or playlists to every watcher of the collection. A watcher too far behind misses
+// it. The caller must hold the lock.
+func (db *MemoryHandler) notify(collection string, operation string, tenant string, id primitive.ObjectID, doc bson.M) {
+	if len(db.watchers[collection]) == 0 {
+		return
+	}
+	change := memoryChange{operation: operation, tenant: tenant, id: id}
+	if doc != nil {
+		clone, err := cloneDocument(doc)
+		if err != nil {
+			logrus.WithError(err).Warn("Error copying changed document")
+			return
+		}
+		change.doc = clone
+	}
+
+	for watcher := range db.watchers[collection] {
+		select {
+		case watcher <- change:
+		default:
+			logrus.WithField("collection", collection).Warn("Dropping change for watcher that has fallen behind")
+		}
+	}
+}
+
+// watch calls handle for each change to the collection until the context is cancelled or handle returns an error.
+func (db *MemoryHandler) watch(ctx context.Context, collection string, handle func(change memoryChange) error) error {
+	changes := make(chan memoryChange, memoryWatchBuffer)
+	db.mu.Lock()
+	if db.watchers[collection] == nil {
+		db.watchers[collection] = make(map[chan memoryChange]bool)
+	}
+	db.watchers[collection][changes] = true
+	db.mu.Unlock()
+
+	defer func() {
+		db.mu.Lock()
+		delete(db.watchers[collection], changes)
+		db.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change := <-changes:
+			if err := handle(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ListTenants returns every tenant with tracks, playlists or podcasts.
+func (db *MemoryHandler) ListTenants(ctx context.Context) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var tenants []string
+	for _, collection := range []string{memoryTracks, memoryPlaylists, memoryPodcasts} {
+		for tenant, docs := range db.documents[collection] {
+			if tenant != "" && len(docs) > 0 && !seen[tenant] {
+				seen[tenant] = true
+				tenants = append(tenants, tenant)
+			}
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+func (db *MemoryHandler) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (db *MemoryHandler) PingAudioStore(ctx context.Context) error {
+	return nil
+}
+
+// EnsureIndexes does nothing, as there is nothing to create.
+func (db *MemoryHandler) EnsureIndexes(ctx context.Context) error {
+	return nil
+}
+
+// AddTrack adds a track, stamping its creation and update times. A creation time that is already set, as on an
+// imported track, is kept.
+func (db *MemoryHandler) AddTrack(ctx context.Context, track models.Track) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	if track.CreatedAt.IsZero() {
+		track.CreatedAt = now
+	}
+	track.UpdatedAt = now
+	return db.insert(memoryTracks, TenantFromContext(ctx), track)
+}
+
+func (db *MemoryHandler) UploadAudioFile(ctx context.Context, audioFile []byte, trackName string) (interface{}, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	if db.audio[tenant] == nil {
+		db.audio[tenant] = make(map[primitive.ObjectID][]byte)
+	}
+	id := primitive.NewObjectID()
+	db.audio[tenant][id] = append([]byte(nil), audioFile...)
+	return id, nil
+}
+
+func (db *MemoryHandler) UploadAudioStream(ctx context.Context, audio io.Reader, trackName string) (interface{}, error) {
+	audioFile, err := ioutil.ReadAll(audio)
+	if err != nil {
+		return nil, err
+	}
+	return db.UploadAudioFile(ctx, audioFile, trackName)
+}
+
+func (db *MemoryHandler) DownloadAudioFile(ctx context.Context, audioFileID primitive.ObjectID) ([]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	audio, ok := db.audio[TenantFromContext(ctx)][audioFileID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), audio...), nil
+}
+
+func (db *MemoryHandler) DeleteAudioFile(ctx context.Context, audioFileID primitive.ObjectID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.deleteAudioFile(TenantFromContext(ctx), audioFileID)
+}
+
+func (db *MemoryHandler) deleteAudioFile(tenant string, audioFileID primitive.ObjectID) error {
+	if _, ok := db.audio[tenant][audioFileID]; !ok {
+		return ErrNotFound
+	}
+	delete(db.audio[tenant], audioFileID)
+	return nil
+}
+
+// FindOrphanedAudioFiles returns the IDs of stored audio files that no track references, as its current audio, as the
+// original it was transcoded from, as a quality variant, as a previous version or as its artwork.
+func (db *MemoryHandler) FindOrphanedAudioFiles(ctx context.Context) ([]primitive.ObjectID, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	docs, err := db.find(memoryTracks, tenant, nil)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := decodeTracks(docs)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[primitive.ObjectID]bool)
+	for _, track := range tracks {
+		for _, id := range trackAudioFiles(track) {
+			referenced[id] = true
+		}
+	}
+
+	var orphaned []primitive.ObjectID
+	for id := range db.audio[tenant] {
+		if !referenced[id] {
+			orphaned = append(orphaned, id)
+		}
+	}
+	return orphaned, nil
+}
+
+// UpdateTrack copies the metadata set on updatedTrack onto the stored track, provided it is still at the expected
+// revision.
+func (db *MemoryHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track, revision int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	doc, err := db.findOne(memoryTracks, tenant, id)
+	if err != nil {
+		return err
+	}
+	var track models.Track
+	if err := fromDocument(doc, &track); err != nil {
+		return err
+	}
+	if revision != AnyRevision && track.Revision != revision {
+		return ErrRevisionMismatch
+	}
+	mergeTrackMetadata(&track, updatedTrack)
+
+	if doc, err = toDocument(track); err != nil {
+		return err
+	}
+	return db.store(memoryTracks, tenant, doc)
+}
+
+// SetTrackAudio copies the audio file, its format and info, original, variants and fingerprint and the version history
+// from the given track onto the stored one. Files dropped from the history are not deleted here.
+func (db *MemoryHandler) SetTrackAudio(ctx context.Context, id primitive.ObjectID, track models.Track) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.update(memoryTracks, TenantFromContext(ctx), id, AnyRevision, trackAudioUpdate(track), nil)
+}
+
+// AddTrackTags adds tags to a track, ignoring any it already has.
+func (db *MemoryHandler) AddTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.update(memoryTracks, TenantFromContext(ctx), id, revision, bson.M{
+		"$addToSet": bson.M{"tags": bson.M{"$each": tags}},
+		"$set":      bson.M{"updatedAt": time.Now()},
+		"$inc":      bson.M{"revision": 1},
+	}, nil)
+}
+
+func (db *MemoryHandler) RemoveTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.update(memoryTracks, TenantFromContext(ctx), id, revision, bson.M{
+		"$pull": bson.M{"tags": bson.M{"$in": tags}},
+		"$set":  bson.M{"updatedAt": time.Now()},
+		"$inc":  bson.M{"revision": 1},
+	}, nil)
+}
+
+func (db *MemoryHandler) SetTrackLastPlayed(ctx context.Context, id primitive.ObjectID, playedAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.update(memoryTracks, TenantFromContext(ctx), id, AnyRevision, bson.M{"$set": bson.M{"lastPlayedAt": playedAt}}, nil)
+}
+
+func (db *MemoryHandler) GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	docs, err := db.find(memoryTracks, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTracks(docs)
+}
+
+// SampleTracks returns up to count tracks chosen at random from those matching the filters.
+func (db *MemoryHandler) SampleTracks(ctx context.Context, filters map[string]interface{}, count int) ([]models.Track, error) {
+	tracks, err := db.GetTracks(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(tracks), func(i, j int) {
+		tracks[i], tracks[j] = tracks[j], tracks[i]
+	})
+	if len(tracks) > count {
+		tracks = tracks[:count]
+	}
+	return tracks, nil
+}
+
+// GetRecentTracks returns the tracks added since the given time, newest first.
+func (db *MemoryHandler) GetRecentTracks(ctx context.Context, since time.Time) ([]models.Track, error) {
+	tracks, err := db.GetTracks(ctx, map[string]interface{}{"createdAt": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].CreatedAt.After(tracks[j].CreatedAt)
+	})
+	return tracks, nil
+}
+
+// DeleteTrack deletes a track with its plays and audio, removing it from the playlists it was on, which move to their
+// next revision.
+func (db *MemoryHandler) DeleteTrack(ctx context.Context, id primitive.ObjectID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	doc, err := db.findOne(memoryTracks, tenant, id)
+	if err != nil {
+		return err
+	}
+	var track models.Track
+	if err := fromDocument(doc, &track); err != nil {
+		return err
+	}
+
+	playlists, err := db.find(memoryPlaylists, tenant, map[string]interface{}{"tracks": id})
+	if err != nil {
+		return err
+	}
+	for _, playlist := range playlists {
+		if err := applyUpdate(playlist, bson.M{"$pull": bson.M{"tracks": id}, "$inc": bson.M{"revision": 1}}); err != nil {
+			return err
+		}
+		if err := db.store(memoryPlaylists, tenant, playlist); err != nil {
+			return err
+		}
+	}
+
+	plays := db.documents[memoryPlays][tenant][:0]
+	for _, play := range db.documents[memoryPlays][tenant] {
+		if play["trackId"] != id {
+			plays = append(plays, play)
+		}
+	}
+	if db.documents[memoryPlays] != nil {
+		db.documents[memoryPlays][tenant] = plays
+	}
+
+	listening := db.documents[memoryNowPlaying][tenant][:0]
+	for _, state := range db.documents[memoryNowPlaying][tenant] {
+		if state["trackId"] != id {
+			listening = append(listening, state)
+		}
+	}
+	if db.documents[memoryNowPlaying] != nil {
+		db.documents[memoryNowPlaying][tenant] = listening
+	}
+
+	for _, audioFileID := range trackAudioFiles(track) {
+		db.deleteAudioFile(tenant, audioFileID)
+	}
+	return db.remove(memoryTracks, tenant, id)
+}
+
+// SearchTracks returns up to limit tracks containing every word of the query in their name, artist, album and tags,
+// best match first.
+func (db *MemoryHandler) SearchTracks(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	terms := searchWords(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	tracks, err := db.GetTracks(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[primitive.ObjectID]int)
+	matching := tracks[:0]
+	for _, track := range tracks {
+		score := searchScore(terms, track.Name, strings.Join(append([]string{track.Artist}, track.FeaturedArtists...), " "), track.AlbumName+" "+strings.Join(track.Tags, " "))
+		if score > 0 {
+			scores[track.ID] = score
+			matching = append(matching, track)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return scores[matching[i].ID] > scores[matching[j].ID]
+	})
+	if len(matching) > limit {
+		matching = matching[:limit]
+	}
+	return matching, nil
+}
+
+// GetSuggestions returns up to limit titles, artists and albums starting with the prefix, ignoring case, with those on
+// the most tracks first. They are counted from the tracks as they are.
+func (db *MemoryHandler) GetSuggestions(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	tracks, err := db.GetTracks(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = strings.ToLower(prefix)
+	byID := make(map[string]*models.Suggestion)
+	var suggestions []*models.Suggestion
+	for _, track := range tracks {
+		for kind, value := range suggestionValues(track) {
+			if !strings.HasPrefix(strings.ToLower(value), prefix) {
+				continue
+			}
+			id := suggestionID(kind, value)
+			if byID[id] == nil {
+				byID[id] = &models.Suggestion{Kind: kind, Value: value}
+				suggestions = append(suggestions, byID[id])
+			}
+			byID[id].Count++
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Count != suggestions[j].Count {
+			return suggestions[i].Count > suggestions[j].Count
+		}
+		return strings.ToLower(suggestions[i].Value) < strings.ToLower(suggestions[j].Value)
+	})
+
+	var results []models.Suggestion
+	for _, suggestion := range suggestions {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, *suggestion)
+	}
+	return results, nil
+}
+
+// WatchTracks follows changes to tracks in every tenant's library, calling handle for each until the context is
+// cancelled or handle returns an error.
+func (db *MemoryHandler) WatchTracks(ctx context.Context, handle func(change models.TrackChange) error) error {
+	return db.watch(ctx, memoryTracks, func(event memoryChange) error {
+		change := models.TrackChange{Operation: event.operation, Tenant: event.tenant, TrackID: event.id}
+		if event.doc != nil {
+			change.Track = &models.Track{}
+			if err := fromDocument(event.doc, change.Track); err != nil {
+				return err
+			}
+		}
+		return handle(change)
+	})
+}
+
+// WatchPlaylists follows changes to playlists in every tenant's library in the same way as WatchTracks.
+func (db *MemoryHandler) WatchPlaylists(ctx context.Context, handle func(change models.PlaylistChange) error) error {
+	return db.watch(ctx, memoryPlaylists, func(event memoryChange) error {
+		change := models.PlaylistChange{Operation: event.operation, Tenant: event.tenant, PlaylistID: event.id}
+		if event.doc != nil {
+			change.Playlist = &models.Playlist{}
+			if err := fromDocument(event.doc, change.Playlist); err != nil {
+				return err
+			}
+		}
+		return handle(change)
+	})
+}
+
+// AddPlaylist adds a playlist, stamping its creation and update times. A creation time that is already set, as on an
+// imported playlist, is kept. Every track on it must exist.
+func (db *MemoryHandler) AddPlaylist(ctx context.Context, playlist models.Playlist) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	if playlist.CreatedAt.IsZero() {
+		playlist.CreatedAt = now
+	}
+	playlist.UpdatedAt = now
+
+	doc, err := toDocument(playlist)
+	if err != nil {
+		return err
+	}
+	tenant := TenantFromContext(ctx)
+	if err := db.checkTracksExist(tenant, doc); err != nil {
+		return err
+	}
+	return db.insert(memoryPlaylists, tenant, doc)
+}
+
+// UpdatePlaylist applies an update document to a playlist that is still at the expected revision, adding its update
+// time to any $set it contains and moving it to the next revision. Every track left on it must exist.
+func (db *MemoryHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M, revision int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	return db.update(memoryPlaylists, tenant, playlistId, revision, stampPlaylistUpdate(update), func(doc bson.M) error {
+		return db.checkTracksExist(tenant, doc)
+	})
+}
+
+func (db *MemoryHandler) MovePlaylistTrack(ctx context.Context, playlistId primitive.ObjectID, trackId primitive.ObjectID, index int, revision int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	doc, err := db.findOne(memoryPlaylists, tenant, playlistId)
+	if err != nil {
+		return err
+	}
+	tracks, err := arrayField(doc, "tracks")
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$set": bson.M{"tracks": moveTrack(tracks, trackId, index)}}
+	return db.update(memoryPlaylists, tenant, playlistId, revision, stampPlaylistUpdate(update), func(doc bson.M) error {
+		return db.checkTracksExist(tenant, doc)
+	})
+}
+
+func (db *MemoryHandler) DeletePlaylist(ctx context.Context, id primitive.ObjectID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.remove(memoryPlaylists, TenantFromContext(ctx), id)
+}
+
+func (db *MemoryHandler) GetPlaylists(ctx context.Context, filters map[string]interface{}) ([]models.Playlist, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	docs, err := db.find(memoryPlaylists, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var playlists []models.Playlist
+	for _, doc := range docs {
+		var playlist models.Playlist
+		if err := fromDocument(doc, &playlist); err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, nil
+}
+
+func (db *MemoryHandler) GetPlaylistPage(ctx context.Context, id primitive.ObjectID, offset int, limit int) (models.PlaylistPage, error) {
+	return pagePlaylist(ctx, db, id, offset, limit)
+}
+
+func (db *MemoryHandler) AddPodcast(ctx context.Context, podcast models.Podcast) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	if err := db.unique(memoryPodcasts, tenant, "feedUrl", podcast.FeedURL); err != nil {
+		return err
+	}
+	return db.insert(memoryPodcasts, tenant, podcast)
+}
+
+func (db *MemoryHandler) UpdatePodcast(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.update(memoryPodcasts, TenantFromContext(ctx), id, AnyRevision, update, nil)
+}
+
+func (db *MemoryHandler) DeletePodcast(ctx context.Context, id primitive.ObjectID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.remove(memoryPodcasts, TenantFromContext(ctx), id)
+}
+
+func (db *MemoryHandler) GetPodcasts(ctx context.Context, filters map[string]interface{}) ([]models.Podcast, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	docs, err := db.find(memoryPodcasts, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var podcasts []models.Podcast
+	for _, doc := range docs {
+		var podcast models.Podcast
+		if err := fromDocument(doc, &podcast); err != nil {
+			return nil, err
+		}
+		podcasts = append(podcasts, podcast)
+	}
+	return podcasts, nil
+}
+
+func (db *MemoryHandler) AddAPIKey(ctx context.Context, key models.APIKey) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	if err := db.unique(memoryAPIKeys, tenant, "keyHash", key.KeyHash); err != nil {
+		return err
+	}
+	return db.insert(memoryAPIKeys, tenant, key)
+}
+
+func (db *MemoryHandler) GetAPIKeys(ctx context.Context, filters map[string]interface{}) ([]models.APIKey, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	docs, err := db.find(memoryAPIKeys, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	for _, doc := range docs {
+		var key models.APIKey
+		if err := fromDocument(doc, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// AddShare adds a share, first deleting the tenant's expired ones as MongoDB's TTL index would.
+func (db *MemoryHandler) AddShare(ctx context.Context, share models.Share) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	expired, err := db.find(memoryShares, tenant, map[string]interface{}{"expiresAt": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		return err
+	}
+	for _, doc := range expired {
+		id, _ := doc["_id"].(primitive.ObjectID)
+		db.remove(memoryShares, tenant, id)
+	}
+	return db.insert(memoryShares, tenant, share)
+}
+
+func (db *MemoryHandler) GetShares(ctx context.Context, filters map[string]interface{}) ([]models.Share, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	docs, err := db.find(memoryShares, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var shares []models.Share
+	for _, doc := range docs {
+		var share models.Share
+		if err := fromDocument(doc, &share); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// RecordSharePlay counts a play against a share, returning ErrNotFound once its play limit has been reached.
+func (db *MemoryHandler) RecordSharePlay(ctx context.Context, id primitive.ObjectID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.update(memoryShares, TenantFromContext(ctx), id, AnyRevision, bson.M{"$inc": bson.M{"plays": 1}}, func(doc bson.M) error {
+		var share models.Share
+		if err := fromDocument(doc, &share); err != nil {
+			return err
+		}
+		if share.MaxPlays != 0 && share.Plays > share.MaxPlays {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// AddPlay records a play of a track, which must exist.
+func (db *MemoryHandler) AddPlay(ctx context.Context, play models.Play) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	if db.index(memoryTracks, tenant, play.TrackID) < 0 {
+		return fmt.Errorf("%w: track %v does not exist", ErrNotFound, play.TrackID.Hex())
+	}
+	return db.insert(memoryPlays, tenant, play)
+}
+
+// GetPlayCounts returns how many times each track has been played since the given time, with the time of its latest
+// play. Tracks without plays are not included.
+func (db *MemoryHandler) GetPlayCounts(ctx context.Context, since time.Time) ([]models.PlayCount, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	docs, err := db.find(memoryPlays, TenantFromContext(ctx), map[string]interface{}{"playedAt": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, err
+	}
+
+	byTrack := make(map[primitive.ObjectID]int)
+	var results []models.PlayCount
+	for _, doc := range docs {
+		var play models.Play
+		if err := fromDocument(doc, &play); err != nil {
+			return nil, err
+		}
+		i, ok := byTrack[play.TrackID]
+		if !ok {
+			i = len(results)
+			byTrack[play.TrackID] = i
+			results = append(results, models.PlayCount{TrackID: play.TrackID})
+		}
+		results[i].Plays++
+		if play.PlayedAt.After(results[i].LastPlayed) {
+			results[i].LastPlayed = play.PlayedAt
+		}
+	}
+	return results, nil
+}
+
+// SetNowPlaying stores what a user is listening to, replacing what they were before. The track must exist.
+func (db *MemoryHandler) SetNowPlaying(ctx context.Context, state models.NowPlaying) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	if db.index(memoryTracks, tenant, state.TrackID) < 0 {
+		return fmt.Errorf("%w: track %v does not exist", ErrNotFound, state.TrackID.Hex())
+	}
+	doc, err := toDocument(state)
+	if err != nil {
+		return err
+	}
+
+	if db.documents[memoryNowPlaying] == nil {
+		db.documents[memoryNowPlaying] = make(map[string][]bson.M)
+	}
+	docs := db.documents[memoryNowPlaying][tenant]
+	for i := range docs {
+		if docs[i]["_id"] == state.User {
+			docs[i] = doc
+			return nil
+		}
+	}
+	db.documents[memoryNowPlaying][tenant] = append(docs, doc)
+	return nil
+}
+
+// GetNowPlaying returns what a user was last listening to, or ErrNotFound if they have never said.
+func (db *MemoryHandler) GetNowPlaying(ctx context.Context, user string) (models.NowPlaying, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var state models.NowPlaying
+	for _, doc := range db.documents[memoryNowPlaying][TenantFromContext(ctx)] {
+		if doc["_id"] == user {
+			err := fromDocument(doc, &state)
+			return state, err
+		}
+	}
+	return state, ErrNotFound
+}
+
+// RestoreDocument stores a document as it is, keeping its ID, revision and times, for restoring a backup. Unless
+// replace is set it is inserted, returning ErrDuplicate if a document with its ID exists; otherwise it replaces that
+// document, returning ErrNotFound if there is none. The same constraints hold as for adding the document.
+func (db *MemoryHandler) RestoreDocument(ctx context.Context, collection string, doc interface{}, replace bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var memoryCollection, uniqueField string
+	switch collection {
+	case CollectionTracks:
+		memoryCollection = memoryTracks
+	case CollectionPlaylists:
+		memoryCollection = memoryPlaylists
+	case CollectionPodcasts:
+		memoryCollection, uniqueField = memoryPodcasts, "feedUrl"
+	case CollectionShares:
+		memoryCollection = memoryShares
+	case CollectionAPIKeys:
+		memoryCollection, uniqueField = memoryAPIKeys, "keyHash"
+	default:
+		return unknownCollection(collection)
+	}
+
+	restored, err := toDocument(doc)
+	if err != nil {
+		return err
+	}
+	tenant := TenantFromContext(ctx)
+	if uniqueField != "" {
+		for _, existing := range db.documents[memoryCollection][tenant] {
+			if existing["_id"] != restored["_id"] && docString(existing, uniqueField) == docString(restored, uniqueField) {
+				return fmt.Errorf("%w: %v with %v %v already exists", ErrDuplicate, memoryCollection, uniqueField, docString(restored, uniqueField))
+			}
+		}
+	}
+	if collection == CollectionPlaylists {
+		if err := db.checkTracksExist(tenant, restored); err != nil {
+			return err
+		}
+	}
+
+	if replace {
+		return db.store(memoryCollection, tenant, restored)
+	}
+	return db.insert(memoryCollection, tenant, restored)
+}
+
+// RestoreAudioFile stores audio under the ID it had in a backup, replacing any file already stored with that ID.
+func (db *MemoryHandler) RestoreAudioFile(ctx context.Context, id primitive.ObjectID, audioFile []byte, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	if db.audio[tenant] == nil {
+		db.audio[tenant] = make(map[primitive.ObjectID][]byte)
+	}
+	db.audio[tenant][id] = append([]byte(nil), audioFile...)
+	return nil
+}
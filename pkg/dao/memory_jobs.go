@@ -0,0 +1,159 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddJob queues a job for the tenant in the context.
+func (db *MemoryHandler) AddJob(ctx context.Context, job models.Job) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	job.Tenant = TenantFromContext(ctx)
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	return db.insert(memoryJobs, job.Tenant, job)
+}
+
+// ClaimJob hands the worker the longest-waiting job of one of the given kinds that is due to run, or whose previous
+// worker's lease has run out, and leases it to the worker. It returns ErrNotFound if there is none.
+func (db *MemoryHandler) ClaimJob(ctx context.Context, worker string, kinds []string, lease time.Duration) (models.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	filter := map[string]interface{}{
+		"kind": bson.M{"$in": kinds},
+		"$or": bson.A{
+			bson.M{"status": models.JobQueued, "runAt": bson.M{"$lte": now}},
+			bson.M{"status": models.JobRunning, "lockedUntil": bson.M{"$lt": now}},
+		},
+	}
+
+	var due []models.Job
+	for tenant := range db.documents[memoryJobs] {
+		docs, err := db.find(memoryJobs, tenant, filter)
+		if err != nil {
+			return models.Job{}, err
+		}
+		for _, doc := range docs {
+			var job models.Job
+			if err := fromDocument(doc, &job); err != nil {
+				return models.Job{}, err
+			}
+			due = append(due, job)
+		}
+	}
+	if len(due) == 0 {
+		return models.Job{}, ErrNotFound
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+
+	return db.updateJob(due[0].ID, claimJobUpdate(worker, now, lease))
+}
+
+// UpdateJob applies the update to the job, whichever tenant it belongs to, and records when it changed.
+func (db *MemoryHandler) UpdateJob(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stampJobUpdate(update)
+	_, err := db.updateJob(id, update)
+	return err
+}
+
+// TransitionJob applies the update to the job, whichever tenant it belongs to, provided it is in one of the from
+// statuses, and returns the job as updated. It returns ErrJobStatus if the job is in another status, and ErrNotFound
+// if there is no such job.
+func (db *MemoryHandler) TransitionJob(ctx context.Context, id primitive.ObjectID, from []string, update bson.M) (models.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant, ok := db.jobTenant(id)
+	if !ok {
+		return models.Job{}, ErrNotFound
+	}
+	doc, err := db.findOne(memoryJobs, tenant, id)
+	if err != nil {
+		return models.Job{}, err
+	}
+	allowed := false
+	for _, status := range from {
+		if docString(doc, "status") == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return models.Job{}, ErrJobStatus
+	}
+	stampJobUpdate(update)
+	return db.updateJob(id, update)
+}
+
+// jobTenant returns the tenant the job belongs to. The caller must hold the lock.
+func (db *MemoryHandler) jobTenant(id primitive.ObjectID) (string, bool) {
+	for tenant := range db.documents[memoryJobs] {
+		if db.index(memoryJobs, tenant, id) >= 0 {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+// updateJob applies the update to the job, whichever tenant it belongs to, and returns the job as updated. The caller
+// must hold the lock.
+func (db *MemoryHandler) updateJob(id primitive.ObjectID, update bson.M) (models.Job, error) {
+	tenant, ok := db.jobTenant(id)
+	if !ok {
+		return models.Job{}, ErrNotFound
+	}
+	if err := db.update(memoryJobs, tenant, id, AnyRevision, update, nil); err != nil {
+		return models.Job{}, err
+	}
+	doc, err := db.findOne(memoryJobs, tenant, id)
+	if err != nil {
+		return models.Job{}, err
+	}
+	var job models.Job
+	if err := fromDocument(doc, &job); err != nil {
+		return models.Job{}, err
+	}
+	return job, nil
+}
+
+// GetJobs returns the jobs of the tenant in the context matching the filters, newest first.
+func (db *MemoryHandler) GetJobs(ctx context.Context, filters map[string]interface{}) ([]models.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	docs, err := db.find(memoryJobs, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []models.Job
+	for _, doc := range docs {
+		var job models.Job
+		if err := fromDocument(doc, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
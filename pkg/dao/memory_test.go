@@ -0,0 +1,314 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDao_MemoryHandler_ShouldStoreTracksAndPlaylists(t *testing.T) {
+	handler := NewMemoryHandler()
+	ctx := context.Background()
+
+	song := models.Track{ID: primitive.NewObjectID(), Name: "Blue Song", Artist: "Band", Tags: []string{"rock"}}
+	other := models.Track{ID: primitive.NewObjectID(), Name: "Other", Artist: "Blue"}
+	require.Nil(t, handler.AddTrack(ctx, song))
+	require.Nil(t, handler.AddTrack(ctx, other))
+	require.True(t, errors.Is(handler.AddTrack(ctx, song), ErrDuplicate))
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"tags": "rock"})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, song.ID, tracks[0].ID)
+
+	tracks, err = handler.SearchTracks(ctx, "blue", 10)
+	require.Nil(t, err)
+	require.Len(t, tracks, 2)
+	require.Equal(t, song.ID, tracks[0].ID)
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix", Tracks: []primitive.ObjectID{song.ID, other.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+	missing := models.Playlist{ID: primitive.NewObjectID(), Tracks: []primitive.ObjectID{primitive.NewObjectID()}}
+	require.True(t, errors.Is(handler.AddPlaylist(ctx, missing), ErrNotFound))
+
+	require.Nil(t, handler.DeleteTrack(ctx, song.ID))
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+	require.Equal(t, []primitive.ObjectID{other.ID}, playlists[0].Tracks)
+	require.Equal(t, int64(1), playlists[0].Revision)
+
+	require.Nil(t, handler.UpdatePlaylist(ctx, playlist.ID, bson.M{"$set": bson.M{"name": "New"}}, 1))
+	require.Equal(t, ErrRevisionMismatch, handler.UpdatePlaylist(ctx, playlist.ID, bson.M{"$set": bson.M{"name": "Old"}}, 1))
+}
+
+func TestDao_MemoryHandler_ShouldKeepTenantsApart(t *testing.T) {
+	handler := NewMemoryHandler()
+	acme := context.WithValue(context.Background(), tenantKey{}, "acme")
+
+	require.Nil(t, handler.AddTrack(acme, models.Track{ID: primitive.NewObjectID(), Name: "Song"}))
+
+	tracks, err := handler.GetTracks(context.Background(), nil)
+	require.Nil(t, err)
+	require.Empty(t, tracks)
+	tenants, err := handler.ListTenants(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, []string{"acme"}, tenants)
+}
+
+func TestDao_MemoryHandler_ShouldStoreAudioAndPlays(t *testing.T) {
+	handler := NewMemoryHandler()
+	ctx := context.Background()
+
+	id, err := handler.UploadAudioFile(ctx, []byte("audio"), "Song")
+	require.Nil(t, err)
+	audioFileID := id.(primitive.ObjectID)
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song", AudioFileID: audioFileID}
+	require.Nil(t, handler.AddTrack(ctx, track))
+
+	playedAt := time.Now().Add(-time.Minute)
+	require.Nil(t, handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: track.ID, PlayedAt: playedAt}))
+	require.Nil(t, handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: track.ID, PlayedAt: playedAt.Add(-time.Hour)}))
+	require.True(t, errors.Is(handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: primitive.NewObjectID()}), ErrNotFound))
+	counts, err := handler.GetPlayCounts(ctx, playedAt.Add(-time.Hour))
+	require.Nil(t, err)
+	require.Len(t, counts, 1)
+	require.Equal(t, 2, counts[0].Plays)
+
+	require.Nil(t, handler.DeleteTrack(ctx, track.ID))
+	_, err = handler.DownloadAudioFile(ctx, audioFileID)
+	require.Equal(t, ErrNotFound, err)
+	counts, err = handler.GetPlayCounts(ctx, time.Time{})
+	require.Nil(t, err)
+	require.Empty(t, counts)
+}
+
+func TestDao_MemoryHandler_ShouldClaimJobsOnce(t *testing.T) {
+	handler := NewMemoryHandler()
+	ctx := context.Background()
+
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "import", Status: models.JobQueued}
+	require.Nil(t, handler.AddJob(ctx, job))
+
+	claimed, err := handler.ClaimJob(ctx, "worker", []string{"import"}, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, job.ID, claimed.ID)
+	require.Equal(t, models.JobRunning, claimed.Status)
+	require.Equal(t, 1, claimed.Attempts)
+
+	_, err = handler.ClaimJob(ctx, "worker", []string{"import"}, time.Minute)
+	require.Equal(t, ErrNotFound, err)
+
+	_, err = handler.TransitionJob(ctx, job.ID, []string{models.JobQueued}, bson.M{"$set": bson.M{"status": models.JobFailed}})
+	require.Equal(t, ErrJobStatus, err)
+}
+
+func TestDao_MemoryHandler_ShouldWatchChanges(t *testing.T) {
+	handler := NewMemoryHandler()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changes := make(chan models.PlaylistChange, 1)
+	watching := make(chan struct{})
+	go handler.WatchPlaylists(ctx, func(change models.PlaylistChange) error {
+		changes <- change
+		return nil
+	})
+	go func() {
+		for {
+			handler.mu.Lock()
+			n := len(handler.watchers[memoryPlaylists])
+			handler.mu.Unlock()
+			if n > 0 {
+				close(watching)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	<-watching
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix"}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	select {
+	case change := <-changes:
+		require.Equal(t, "insert", change.Operation)
+		require.Equal(t, playlist.ID, change.PlaylistID)
+		require.Equal(t, "Mix", change.Playlist.Name)
+	case <-ctx.Done():
+		t.Fatal("no change seen")
+	}
+}
+
+// testMovePlaylistTrack checks MovePlaylistTrack against a handler, as each of them should behave the same.
+func testMovePlaylistTrack(t *testing.T, handler DbHandler) {
+	ctx := context.Background()
+	var ids []primitive.ObjectID
+	for _, name := range []string{"a", "b", "c", "d"} {
+		track := models.Track{ID: primitive.NewObjectID(), Name: name}
+		require.Nil(t, handler.AddTrack(ctx, track))
+		ids = append(ids, track.ID)
+	}
+	a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix", Tracks: []primitive.ObjectID{a, b, c}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	tracks := func() []primitive.ObjectID {
+		playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+		require.Nil(t, err)
+		require.Len(t, playlists, 1)
+		return playlists[0].Tracks
+	}
+
+	require.Nil(t, handler.MovePlaylistTrack(ctx, playlist.ID, a, 2, 0))
+	require.Equal(t, []primitive.ObjectID{b, c, a}, tracks())
+	require.Nil(t, handler.MovePlaylistTrack(ctx, playlist.ID, a, 0, AnyRevision))
+	require.Equal(t, []primitive.ObjectID{a, b, c}, tracks())
+	require.Nil(t, handler.MovePlaylistTrack(ctx, playlist.ID, d, 1, AnyRevision))
+	require.Equal(t, []primitive.ObjectID{a, d, b, c}, tracks())
+	require.Nil(t, handler.MovePlaylistTrack(ctx, playlist.ID, b, 10, AnyRevision))
+	require.Equal(t, []primitive.ObjectID{a, d, c, b}, tracks())
+
+	require.Equal(t, ErrRevisionMismatch, handler.MovePlaylistTrack(ctx, playlist.ID, a, 1, 0))
+	require.Equal(t, ErrNotFound, handler.MovePlaylistTrack(ctx, primitive.NewObjectID(), a, 0, AnyRevision))
+}
+
+func TestDao_MemoryHandler_MovePlaylistTrack_ShouldMoveOrInsertTrack(t *testing.T) {
+	testMovePlaylistTrack(t, NewMemoryHandler())
+}
+
+func TestDao_MemoryHandler_GetPlaylistPage_ShouldReturnSliceOfTracksInOrder(t *testing.T) {
+	handler := NewMemoryHandler()
+	ctx := context.Background()
+
+	var ids []primitive.ObjectID
+	for _, name := range []string{"a", "b", "c", "d"} {
+		track := models.Track{ID: primitive.NewObjectID(), Name: name}
+		require.Nil(t, handler.AddTrack(ctx, track))
+		ids = append(ids, track.ID)
+	}
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix", Tracks: []primitive.ObjectID{ids[3], ids[1], ids[2], ids[0]}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	page, err := handler.GetPlaylistPage(ctx, playlist.ID, 1, 2)
+	require.Nil(t, err)
+	require.Equal(t, "Mix", page.Name)
+	require.Equal(t, 1, page.Offset)
+	require.Equal(t, 4, page.Total)
+	require.Len(t, page.Tracks, 2)
+	require.Equal(t, "b", page.Tracks[0].Name)
+	require.Equal(t, "c", page.Tracks[1].Name)
+
+	page, err = handler.GetPlaylistPage(ctx, playlist.ID, 10, 2)
+	require.Nil(t, err)
+	require.Empty(t, page.Tracks)
+	require.Equal(t, 4, page.Total)
+
+	_, err = handler.GetPlaylistPage(ctx, primitive.NewObjectID(), 0, 0)
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestDao_MemoryHandler_ShouldKeepArtworkUntilTrackIsDeleted(t *testing.T) {
+	handler := NewMemoryHandler()
+	ctx := context.Background()
+
+	audio, err := handler.UploadAudioFile(ctx, []byte("audio"), "Song")
+	require.Nil(t, err)
+	artwork, err := handler.UploadAudioFile(ctx, []byte("artwork"), "Song artwork")
+	require.Nil(t, err)
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song", AudioFileID: audio.(primitive.ObjectID)}
+	require.Nil(t, handler.AddTrack(ctx, track))
+	require.Nil(t, handler.UpdateTrack(ctx, track.ID, models.Track{ArtworkFileID: artwork.(primitive.ObjectID)}, AnyRevision))
+
+	orphaned, err := handler.FindOrphanedAudioFiles(ctx)
+	require.Nil(t, err)
+	require.Empty(t, orphaned)
+
+	require.Nil(t, handler.DeleteTrack(ctx, track.ID))
+	_, err = handler.DownloadAudioFile(ctx, artwork.(primitive.ObjectID))
+	require.True(t, errors.Is(err, ErrNotFound))
+}
+
+func testRestoreDocument(t *testing.T, handler DbHandler) {
+	ctx := context.Background()
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song", Revision: 4, CreatedAt: time.Unix(1000, 0)}
+	require.Nil(t, handler.RestoreDocument(ctx, CollectionTracks, track, false))
+	require.True(t, errors.Is(handler.RestoreDocument(ctx, CollectionTracks, track, false), ErrDuplicate))
+
+	track.Name = "Restored"
+	require.Nil(t, handler.RestoreDocument(ctx, CollectionTracks, track, true))
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": track.ID})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, "Restored", tracks[0].Name)
+	require.Equal(t, int64(4), tracks[0].Revision)
+	require.Equal(t, int64(1000), tracks[0].CreatedAt.Unix())
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "List", Tracks: []primitive.ObjectID{track.ID}}
+	require.True(t, errors.Is(handler.RestoreDocument(ctx, CollectionPlaylists, playlist, true), ErrNotFound))
+	require.Nil(t, handler.RestoreDocument(ctx, CollectionPlaylists, playlist, false))
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+	require.Equal(t, []primitive.ObjectID{track.ID}, playlists[0].Tracks)
+
+	require.Nil(t, handler.RestoreDocument(ctx, CollectionPodcasts, models.Podcast{ID: primitive.NewObjectID(), FeedURL: "feed"}, false))
+	require.True(t, errors.Is(handler.RestoreDocument(ctx, CollectionPodcasts, models.Podcast{ID: primitive.NewObjectID(), FeedURL: "feed"}, false), ErrDuplicate))
+
+	id := primitive.NewObjectID()
+	require.Nil(t, handler.RestoreAudioFile(ctx, id, []byte("old"), "Song"))
+	require.Nil(t, handler.RestoreAudioFile(ctx, id, []byte("new"), "Song"))
+	audio, err := handler.DownloadAudioFile(ctx, id)
+	require.Nil(t, err)
+	require.Equal(t, []byte("new"), audio)
+}
+
+func TestDao_MemoryHandler_RestoreDocument_ShouldKeepIDsAndResolveClashes(t *testing.T) {
+	testRestoreDocument(t, NewMemoryHandler())
+}
+
+func testNowPlaying(t *testing.T, handler DbHandler) {
+	ctx := context.Background()
+	_, err := handler.GetNowPlaying(ctx, "alice")
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	song := models.Track{ID: primitive.NewObjectID(), Name: "Song"}
+	other := models.Track{ID: primitive.NewObjectID(), Name: "Other"}
+	require.Nil(t, handler.AddTrack(ctx, song))
+	require.Nil(t, handler.AddTrack(ctx, other))
+	missing := models.NowPlaying{User: "alice", TrackID: primitive.NewObjectID()}
+	require.True(t, errors.Is(handler.SetNowPlaying(ctx, missing), ErrNotFound))
+
+	updatedAt := time.Unix(1000, 0).UTC()
+	require.Nil(t, handler.SetNowPlaying(ctx, models.NowPlaying{User: "alice", TrackID: song.ID, Position: 12, Playing: true, UpdatedAt: updatedAt}))
+	require.Nil(t, handler.SetNowPlaying(ctx, models.NowPlaying{User: "bob", TrackID: song.ID}))
+	require.Nil(t, handler.SetNowPlaying(ctx, models.NowPlaying{User: "alice", TrackID: other.ID, Position: 3, Visibility: models.NowPlayingPublic, UpdatedAt: updatedAt}))
+
+	state, err := handler.GetNowPlaying(ctx, "alice")
+	require.Nil(t, err)
+	require.Equal(t, other.ID, state.TrackID)
+	require.Equal(t, 3.0, state.Position)
+	require.False(t, state.Playing)
+	require.Equal(t, models.NowPlayingPublic, state.Visibility)
+	require.True(t, updatedAt.Equal(state.UpdatedAt))
+
+	// Deleting the track clears the state of those listening to it.
+	require.Nil(t, handler.DeleteTrack(ctx, song.ID))
+	_, err = handler.GetNowPlaying(ctx, "bob")
+	require.True(t, errors.Is(err, ErrNotFound))
+	_, err = handler.GetNowPlaying(ctx, "alice")
+	require.Nil(t, err)
+}
+
+func TestDao_MemoryHandler_NowPlaying_ShouldKeepLatestStatePerUser(t *testing.T) {
+	testNowPlaying(t, NewMemoryHandler())
+}
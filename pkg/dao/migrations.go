@@ -0,0 +1,165 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration rewrites the stored tracks into the shape the models now have. Migrations are applied in order and
+// recorded once applied, so each runs once per database. As two replicas starting together may both apply one, rewrite
+// must leave a document it has already rewritten alone, and report whether it changed anything. In MongoDB, where
+// other replicas may already be serving while one migrates, the tracks filter matches, those still in the old shape,
+// are rewritten by update on the server instead, so a change made to a track meanwhile is never written over.
+type migration struct {
+	id      string
+	rewrite func(doc bson.M) bool
+	filter  bson.M
+	update  mongo.Pipeline
+	// dropIndexes names MongoDB indexes on fields the migration removes.
+	dropIndexes []string
+}
+
+var migrations = []migration{
+	{
+		id:      "0001-audio-file-id",
+		rewrite: renameAudioFileFields,
+		filter: bson.M{"$or": bson.A{
+			bson.M{"audioFile": bson.M{"$exists": true}},
+			bson.M{"original.audioFile": bson.M{"$exists": true}},
+			bson.M{"variants.audioFile": bson.M{"$exists": true}},
+			bson.M{"versions.audioFile": bson.M{"$exists": true}},
+		}},
+		update: mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"audioFileId": audioFileIDOf("$$ROOT"),
+				"original":    withAudioFileID("$original"),
+				"variants":    eachWithAudioFileID("$variants"),
+				"versions":    eachWithAudioFileID("$versions"),
+			}}},
+			{{Key: "$unset", Value: bson.A{"audioFile", "original.audioFile", "variants.audioFile", "versions.audioFile"}}},
+		},
+		dropIndexes: []string{"audioFile_1"},
+	},
+}
+
+// audioFileIDOf is the expression for the audio file ID of the document at path, kept under audioFileId if it has one
+// there already and otherwise taken from audioFile.
+func audioFileIDOf(path string) bson.M {
+	return bson.M{"$ifNull": bson.A{path + ".audioFileId", bson.M{"$ifNull": bson.A{path + ".audioFile", "$$REMOVE"}}}}
+}
+
+// withAudioFileID is the expression for the document at path with its audio file ID under audioFileId, as
+// renameAudioFileFields leaves it. Anything at path other than a document, including nothing, is left as it is.
+func withAudioFileID(path string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": path}, "object"}},
+		bson.M{"$mergeObjects": bson.A{path, bson.M{"audioFileId": audioFileIDOf(path)}}},
+		path,
+	}}
+}
+
+// eachWithAudioFileID is the expression for the array at path with withAudioFileID applied to each of its elements.
+// Anything at path other than an array, including nothing, is left as it is.
+func eachWithAudioFileID(path string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$isArray": path},
+		bson.M{"$map": bson.M{"input": path, "as": "element", "in": withAudioFileID("$$element")}},
+		path,
+	}}
+}
+
+// renameAudioFileFields moves a track's audio file IDs, and those of its original, variants and versions, from
+// audioFile to audioFileId, in line with the other ID fields.
+func renameAudioFileFields(doc bson.M) bool {
+	changed := renameField(doc, "audioFile", "audioFileId")
+	if original, ok := doc["original"].(bson.M); ok {
+		changed = renameField(original, "audioFile", "audioFileId") || changed
+	}
+	for _, field := range []string{"variants", "versions"} {
+		elements, _ := doc[field].(primitive.A)
+		for _, element := range elements {
+			if element, ok := element.(bson.M); ok {
+				changed = renameField(element, "audioFile", "audioFileId") || changed
+			}
+		}
+	}
+	return changed
+}
+
+// renameField moves a field's value to a new name, unless the document already has a value under it.
+func renameField(doc bson.M, from string, to string) bool {
+	value, ok := doc[from]
+	if !ok {
+		return false
+	}
+	delete(doc, from)
+	if _, ok := doc[to]; !ok {
+		doc[to] = value
+	}
+	return true
+}
+
+// Migrate applies the migrations the default database and every tenant's have not had yet.
+func (db *DatabaseHandler) Migrate(ctx context.Context) error {
+	databases := []*mongo.Database{db.Client.Database(db.Database)}
+	tenants, err := db.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		databases = append(databases, db.Client.Database(db.TenantDatabasePrefix+tenant))
+	}
+
+	for _, database := range databases {
+		for _, m := range migrations {
+			if err := db.migrate(ctx, database, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrate applies a migration to the tracks of one database, unless it has been already.
+func (db *DatabaseHandler) migrate(ctx context.Context, database *mongo.Database, m migration) error {
+	applied := database.Collection(db.MigrationCollection)
+	err := applied.FindOne(ctx, bson.M{"_id": m.id}).Err()
+	if err == nil {
+		return nil
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	tracks := database.Collection(db.TrackCollection)
+	if _, err := tracks.UpdateMany(ctx, m.filter, m.update); err != nil {
+		return err
+	}
+
+	for _, name := range m.dropIndexes {
+		if _, err := tracks.Indexes().DropOne(ctx, name); err != nil && !isIndexNotFound(err) {
+			return err
+		}
+	}
+
+	_, err = applied.UpdateOne(ctx,
+		bson.M{"_id": m.id},
+		bson.M{"$setOnInsert": bson.M{"appliedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// isIndexNotFound reports whether dropping an index failed because there was no such index, or no such collection.
+func isIndexNotFound(err error) bool {
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) {
+		return commandErr.Name == "IndexNotFound" || commandErr.Name == "NamespaceNotFound"
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// legacyTrack returns a track document as stored before audio file IDs were named audioFileId.
+func legacyTrack() bson.M {
+	return bson.M{
+		"_id":       primitive.NewObjectID(),
+		"name":      "Song",
+		"audioFile": primitive.NewObjectID(),
+		"original":  bson.M{"audioFile": primitive.NewObjectID(), "codec": "flac"},
+		"variants":  primitive.A{bson.M{"quality": "low", "audioFile": primitive.NewObjectID()}},
+		"versions":  primitive.A{bson.M{"audioFile": primitive.NewObjectID()}},
+	}
+}
+
+func TestDao_RenameAudioFileFields_ShouldRenameEveryAudioFileOnce(t *testing.T) {
+	doc := legacyTrack()
+	audioFileID := doc["audioFile"]
+
+	require.True(t, renameAudioFileFields(doc))
+	require.Equal(t, audioFileID, doc["audioFileId"])
+	require.NotContains(t, doc, "audioFile")
+	require.Contains(t, doc["original"], "audioFileId")
+	require.Contains(t, doc["variants"].(primitive.A)[0], "audioFileId")
+	require.Contains(t, doc["versions"].(primitive.A)[0], "audioFileId")
+
+	require.False(t, renameAudioFileFields(doc))
+}
+
+func TestDao_Migrations_ShouldRewriteMongoTracksOnTheServer(t *testing.T) {
+	for _, m := range migrations {
+		require.NotEmpty(t, m.filter, m.id)
+		require.NotEmpty(t, m.update, m.id)
+	}
+}
+
+func TestDao_SQLiteHandler_Migrate_ShouldRewriteLegacyTracks(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	ctx := context.Background()
+
+	doc := legacyTrack()
+	require.Nil(t, handler.insert(ctx, handler.DB, tracksTable, "", doc))
+
+	require.Nil(t, handler.Migrate(ctx))
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": doc["_id"]})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, doc["audioFile"], tracks[0].AudioFileID)
+	require.Equal(t, doc["original"].(bson.M)["audioFile"], tracks[0].Original.AudioFileID)
+	require.Equal(t, doc["versions"].(primitive.A)[0].(bson.M)["audioFile"], tracks[0].Versions[0].AudioFileID)
+
+	var applied int
+	require.Nil(t, handler.DB.QueryRow("SELECT count(*) FROM migrations").Scan(&applied))
+	require.Equal(t, len(migrations), applied)
+	require.Nil(t, handler.Migrate(ctx))
+}
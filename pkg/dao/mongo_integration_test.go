@@ -0,0 +1,306 @@
+//go:build integration
+// +build integration
+
+package dao
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testMongo is the server the DatabaseHandler tests run against, or nil if there is none to be had.
+var testMongo *testhelper.Mongo
+
+func TestMain(m *testing.M) {
+	server, err := testhelper.StartMongo(context.Background())
+	if err != nil && !errors.Is(err, testhelper.ErrNoMongo) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testMongo = server
+
+	code := m.Run()
+	if testMongo != nil {
+		testMongo.Close()
+	}
+	os.Exit(code)
+}
+
+// newTestMongoHandler returns a DatabaseHandler for a database of the test's own, which is dropped once it finishes.
+func newTestMongoHandler(t *testing.T) *DatabaseHandler {
+	if testMongo == nil {
+		t.Skip(testhelper.ErrNoMongo)
+	}
+
+	handler := NewDatabaseHandler(testMongo.Client)
+	handler.Database = "test_" + primitive.NewObjectID().Hex()
+	handler.TenantDatabasePrefix = handler.Database + "_tenant_"
+	t.Cleanup(func() {
+		tenants, _ := handler.ListTenants(context.Background())
+		for _, tenant := range tenants {
+			testMongo.Client.Database(handler.TenantDatabasePrefix + tenant).Drop(context.Background())
+		}
+		testMongo.Client.Database(handler.Database).Drop(context.Background())
+	})
+	require.Nil(t, handler.EnsureIndexes(context.Background()))
+	return handler
+}
+
+func TestDao_DatabaseHandler_ShouldStoreTracksAndPlaylists(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx := context.Background()
+
+	song := models.Track{ID: primitive.NewObjectID(), Name: "Blue Song", Artist: "Band", Tags: []string{"rock"}}
+	other := models.Track{ID: primitive.NewObjectID(), Name: "Other", Artist: "Blue"}
+	require.Nil(t, handler.AddTrack(ctx, song))
+	require.Nil(t, handler.AddTrack(ctx, other))
+	require.True(t, errors.Is(handler.AddTrack(ctx, song), ErrDuplicate))
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"tags": "rock"})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, song.ID, tracks[0].ID)
+
+	tracks, err = handler.SearchTracks(ctx, "blue", 10)
+	require.Nil(t, err)
+	require.Len(t, tracks, 2)
+	require.Equal(t, song.ID, tracks[0].ID)
+
+	require.Nil(t, handler.UpdateTrack(ctx, song.ID, models.Track{Name: "Red Song"}, 0))
+	require.Equal(t, ErrRevisionMismatch, handler.UpdateTrack(ctx, song.ID, models.Track{Name: "Green Song"}, 0))
+	require.Equal(t, ErrNotFound, handler.UpdateTrack(ctx, primitive.NewObjectID(), models.Track{Name: "Song"}, AnyRevision))
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix", Tracks: []primitive.ObjectID{song.ID, other.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+	require.Nil(t, handler.UpdatePlaylist(ctx, playlist.ID, bson.M{"$set": bson.M{"name": "New"}}, 0))
+	require.Equal(t, ErrRevisionMismatch, handler.UpdatePlaylist(ctx, playlist.ID, bson.M{"$set": bson.M{"name": "Old"}}, 0))
+
+	require.Nil(t, handler.DeletePlaylist(ctx, playlist.ID))
+	require.Equal(t, ErrNotFound, handler.DeletePlaylist(ctx, playlist.ID))
+}
+
+func TestDao_DatabaseHandler_DeleteTrack_ShouldCascadeToAudioAndPlaylists(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx := context.Background()
+
+	var audioFileIDs []primitive.ObjectID
+	for i := 0; i < 3; i++ {
+		id, err := handler.UploadAudioFile(ctx, []byte("audio"), "Song")
+		require.Nil(t, err)
+		audioFileIDs = append(audioFileIDs, id.(primitive.ObjectID))
+	}
+	track := models.Track{
+		ID:          primitive.NewObjectID(),
+		Name:        "Song",
+		AudioFileID: audioFileIDs[0],
+		Original:    &models.OriginalAudio{AudioFileID: audioFileIDs[1]},
+		Versions:    []models.AudioVersion{{AudioFileID: audioFileIDs[2]}},
+	}
+	other := models.Track{ID: primitive.NewObjectID(), Name: "Other"}
+	require.Nil(t, handler.AddTrack(ctx, track))
+	require.Nil(t, handler.AddTrack(ctx, other))
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix", Tracks: []primitive.ObjectID{track.ID, other.ID, track.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	require.Nil(t, handler.DeleteTrack(ctx, track.ID))
+	require.Equal(t, ErrNotFound, handler.DeleteTrack(ctx, track.ID))
+
+	for _, id := range audioFileIDs {
+		_, err := handler.DownloadAudioFile(ctx, id)
+		require.Equal(t, ErrNotFound, err)
+	}
+	chunks, err := handler.getAudioChunkCollection(ctx).CountDocuments(ctx, bson.M{"files_id": bson.M{"$in": audioFileIDs}})
+	require.Nil(t, err)
+	require.Zero(t, chunks)
+
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+	require.Equal(t, []primitive.ObjectID{other.ID}, playlists[0].Tracks)
+	require.Equal(t, int64(1), playlists[0].Revision)
+}
+
+func TestDao_DatabaseHandler_ShouldRoundTripAudioThroughGridFS(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx := context.Background()
+
+	// Larger than GridFS's 255kB chunks, so the file is split and put back together.
+	audio := bytes.Repeat([]byte("0123456789abcdef"), 50000)
+	id, err := handler.UploadAudioFile(ctx, audio, "Song")
+	require.Nil(t, err)
+	audioFileID := id.(primitive.ObjectID)
+
+	downloaded, err := handler.DownloadAudioFile(ctx, audioFileID)
+	require.Nil(t, err)
+	require.Equal(t, audio, downloaded)
+	require.Nil(t, handler.PingAudioStore(ctx))
+
+	orphaned, err := handler.FindOrphanedAudioFiles(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []primitive.ObjectID{audioFileID}, orphaned)
+
+	require.Nil(t, handler.AddTrack(ctx, models.Track{ID: primitive.NewObjectID(), Name: "Song", AudioFileID: audioFileID}))
+	orphaned, err = handler.FindOrphanedAudioFiles(ctx)
+	require.Nil(t, err)
+	require.Empty(t, orphaned)
+
+	require.Nil(t, handler.DeleteAudioFile(ctx, audioFileID))
+	require.Equal(t, ErrNotFound, handler.DeleteAudioFile(ctx, audioFileID))
+	_, err = handler.DownloadAudioFile(ctx, primitive.NewObjectID())
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestDao_DatabaseHandler_ShouldCountPlays(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx := context.Background()
+
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song"}
+	require.Nil(t, handler.AddTrack(ctx, track))
+
+	playedAt := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	require.Nil(t, handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: track.ID, PlayedAt: playedAt}))
+	require.Nil(t, handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: track.ID, PlayedAt: playedAt.Add(-time.Hour)}))
+	require.Nil(t, handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: track.ID, PlayedAt: playedAt.Add(-48 * time.Hour)}))
+
+	counts, err := handler.GetPlayCounts(ctx, playedAt.Add(-time.Hour))
+	require.Nil(t, err)
+	require.Len(t, counts, 1)
+	require.Equal(t, 2, counts[0].Plays)
+	require.True(t, playedAt.Equal(counts[0].LastPlayed))
+}
+
+func TestDao_DatabaseHandler_ShouldKeepTenantsApart(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	acme, err := WithTenant(context.Background(), "acme")
+	require.Nil(t, err)
+
+	require.Nil(t, handler.AddTrack(acme, models.Track{ID: primitive.NewObjectID(), Name: "Song"}))
+
+	tracks, err := handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Empty(t, tracks)
+	tracks, err = handler.GetTracks(acme, map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+
+	tenants, err := handler.ListTenants(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, []string{"acme"}, tenants)
+}
+
+func TestDao_DatabaseHandler_ShouldIndexTenantDatabaseOnFirstUse(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	acme, err := WithTenant(context.Background(), "acme")
+	require.Nil(t, err)
+
+	require.Nil(t, handler.AddTrack(acme, models.Track{ID: primitive.NewObjectID(), Name: "Blue Song"}))
+
+	tracks, err := handler.SearchTracks(acme, "blue", 10)
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+}
+
+func TestDao_DatabaseHandler_ShouldClaimJobsOnce(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx := context.Background()
+
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "import", Status: models.JobQueued}
+	require.Nil(t, handler.AddJob(ctx, job))
+
+	claimed, err := handler.ClaimJob(ctx, "worker", []string{"import"}, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, job.ID, claimed.ID)
+	require.Equal(t, models.JobRunning, claimed.Status)
+	require.Equal(t, 1, claimed.Attempts)
+
+	_, err = handler.ClaimJob(ctx, "worker", []string{"import"}, time.Minute)
+	require.Equal(t, ErrNotFound, err)
+
+	_, err = handler.TransitionJob(ctx, job.ID, []string{models.JobQueued}, bson.M{"$set": bson.M{"status": models.JobFailed}})
+	require.Equal(t, ErrJobStatus, err)
+}
+
+func TestDao_DatabaseHandler_ShouldWatchChanges(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changes := make(chan models.PlaylistChange, 1)
+	go handler.WatchPlaylists(ctx, func(change models.PlaylistChange) error {
+		changes <- change
+		return nil
+	})
+	// Give the change stream time to open, as it only sees changes made after it does.
+	time.Sleep(time.Second)
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix"}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	select {
+	case change := <-changes:
+		require.Equal(t, "insert", change.Operation)
+		require.Equal(t, playlist.ID, change.PlaylistID)
+		require.Equal(t, "Mix", change.Playlist.Name)
+	case <-ctx.Done():
+		t.Fatal("no change seen")
+	}
+}
+
+func TestDao_DatabaseHandler_Migrate_ShouldRewriteLegacyTracks(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx := context.Background()
+
+	doc := legacyTrack()
+	_, err := handler.getTrackCollection(ctx).InsertOne(ctx, doc)
+	require.Nil(t, err)
+
+	require.Nil(t, handler.Migrate(ctx))
+	require.Nil(t, handler.Migrate(ctx))
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"audioFileId": doc["audioFile"]})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, doc["original"].(bson.M)["audioFile"], tracks[0].Original.AudioFileID)
+	require.Equal(t, doc["variants"].(primitive.A)[0].(bson.M)["audioFile"], tracks[0].Variants[0].AudioFileID)
+}
+
+func TestDao_DatabaseHandler_MovePlaylistTrack_ShouldMoveOrInsertTrack(t *testing.T) {
+	testMovePlaylistTrack(t, newTestMongoHandler(t))
+}
+
+func TestDao_DatabaseHandler_GetPlaylistPage_ShouldReturnSliceOfTracksInOrder(t *testing.T) {
+	handler := newTestMongoHandler(t)
+	ctx := context.Background()
+
+	var ids []primitive.ObjectID
+	for _, name := range []string{"a", "b", "c"} {
+		track := models.Track{ID: primitive.NewObjectID(), Name: name}
+		require.Nil(t, handler.AddTrack(ctx, track))
+		ids = append(ids, track.ID)
+	}
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix", Tracks: []primitive.ObjectID{ids[2], ids[0], ids[1]}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	page, err := handler.GetPlaylistPage(ctx, playlist.ID, 1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 3, page.Total)
+	require.Len(t, page.Tracks, 2)
+	require.Equal(t, ids[0], page.Tracks[0].ID)
+	require.Equal(t, ids[1], page.Tracks[1].ID)
+
+	_, err = handler.GetPlaylistPage(ctx, primitive.NewObjectID(), 0, 10)
+	require.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,313 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewPostgresHandler returns a SQLHandler for the PostgreSQL database at the given connection string, which stores
+// audio in the database as well. No connection is made until the handler is first used; EnsureIndexes creates the
+// schema, which needs PostgreSQL 12 or later.
+func NewPostgresHandler(url string) (*SQLHandler, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLHandler{DB: db, dialect: postgresDialect{url: url}, audio: tableAudioStore{db: db}}, nil
+}
+
+// changeChannel is the channel the triggers on tracks and playlists notify of changes on.
+const changeChannel = "library_changes"
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS tracks (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	artist TEXT NOT NULL DEFAULT '',
+	album TEXT NOT NULL DEFAULT '',
+	tags TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ,
+	document BYTEA NOT NULL,
+	search TSVECTOR GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', name), 'A') ||
+		setweight(to_tsvector('simple', artist), 'B') ||
+		setweight(to_tsvector('simple', album || ' ' || tags), 'C')
+	) STORED,
+	PRIMARY KEY (tenant, id)
+);
+CREATE INDEX IF NOT EXISTS tracks_search ON tracks USING GIN (search);
+CREATE INDEX IF NOT EXISTS tracks_created_at ON tracks (tenant, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS playlists (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ,
+	document BYTEA NOT NULL,
+	PRIMARY KEY (tenant, id)
+);
+
+CREATE TABLE IF NOT EXISTS playlist_tracks (
+	tenant TEXT NOT NULL,
+	playlist_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	track_id TEXT NOT NULL,
+	PRIMARY KEY (tenant, playlist_id, position),
+	FOREIGN KEY (tenant, playlist_id) REFERENCES playlists (tenant, id) ON DELETE CASCADE,
+	FOREIGN KEY (tenant, track_id) REFERENCES tracks (tenant, id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS playlist_tracks_track ON playlist_tracks (tenant, track_id);
+
+CREATE TABLE IF NOT EXISTS plays (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	track_id TEXT NOT NULL,
+	played_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tenant, id),
+	FOREIGN KEY (tenant, track_id) REFERENCES tracks (tenant, id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS plays_played_at ON plays (tenant, played_at DESC);
+
+CREATE TABLE IF NOT EXISTS now_playing (
+	tenant TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	track_id TEXT NOT NULL,
+	document BYTEA NOT NULL,
+	PRIMARY KEY (tenant, user_id),
+	FOREIGN KEY (tenant, track_id) REFERENCES tracks (tenant, id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS podcasts (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	feed_url TEXT NOT NULL,
+	document BYTEA NOT NULL,
+	PRIMARY KEY (tenant, id),
+	UNIQUE (tenant, feed_url)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	key_hash TEXT NOT NULL,
+	document BYTEA NOT NULL,
+	PRIMARY KEY (tenant, id),
+	UNIQUE (tenant, key_hash)
+);
+
+CREATE TABLE IF NOT EXISTS shares (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	document BYTEA NOT NULL,
+	PRIMARY KEY (tenant, id)
+);
+
+CREATE TABLE IF NOT EXISTS migrations (
+	id TEXT PRIMARY KEY,
+	applied_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	tenant TEXT NOT NULL,
+	id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL,
+	document BYTEA NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_claim ON jobs (status, run_at);
+CREATE INDEX IF NOT EXISTS jobs_tenant ON jobs (tenant, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS audio_files (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	data BYTEA NOT NULL,
+	uploaded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant, id)
+);
+
+CREATE OR REPLACE FUNCTION notify_library_change() RETURNS trigger AS $$
+DECLARE
+	changed RECORD;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		changed := OLD;
+	ELSE
+		changed := NEW;
+	END IF;
+	PERFORM pg_notify('` + changeChannel + `', json_build_object(
+		'table', TG_TABLE_NAME, 'operation', lower(TG_OP), 'tenant', changed.tenant, 'id', changed.id)::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'tracks_notify') THEN
+		CREATE TRIGGER tracks_notify AFTER INSERT OR UPDATE OR DELETE ON tracks
+			FOR EACH ROW EXECUTE FUNCTION notify_library_change();
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'playlists_notify') THEN
+		CREATE TRIGGER playlists_notify AFTER INSERT OR UPDATE OR DELETE ON playlists
+			FOR EACH ROW EXECUTE FUNCTION notify_library_change();
+	END IF;
+END;
+$$;
+`
+
+// postgresDialect is the sqlDialect of PostgreSQL. Its url is the connection string, which change feeds use to open
+// connections of their own.
+type postgresDialect struct {
+	url string
+}
+
+func (postgresDialect) schema() string {
+	return postgresSchema
+}
+
+func (postgresDialect) bind(query string) string {
+	return query
+}
+
+func (postgresDialect) lock(skipLocked bool) string {
+	if skipLocked {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return " FOR UPDATE"
+}
+
+// searchTracks ranks the tenant's tracks against the query with PostgreSQL's full text search.
+func (postgresDialect) searchTracks(ctx context.Context, db *SQLHandler, tenant string, query string, limit int) ([]bson.M, error) {
+	return db.selectDocuments(ctx, db.DB, `
+		SELECT document FROM tracks, plainto_tsquery('simple', $2) query
+		WHERE tenant = $1 AND search @@ query
+		ORDER BY ts_rank(search, query) DESC
+		LIMIT $3`,
+		tenant, query, limit)
+}
+
+// changes listens for the notifications the triggers on tracks and playlists send. Changes made while the listening
+// connection is being re-established are missed.
+func (d postgresDialect) changes(ctx context.Context, db *SQLHandler, table sqlTable, handle func(change sqlChange) error) error {
+	listener := pq.NewListener(d.url, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logrus.WithError(err).Warn("Error on change notification connection")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(changeChannel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case notification, ok := <-listener.Notify:
+			if !ok {
+				return errors.New("change notification connection closed")
+			}
+			// A nil notification means the connection was re-established.
+			if notification == nil {
+				continue
+			}
+
+			var change sqlChange
+			if err := json.Unmarshal([]byte(notification.Extra), &change); err != nil {
+				return err
+			}
+			if change.Table != table.name {
+				continue
+			}
+			if err := handle(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// tableAudioStore keeps audio in the audio_files table.
+type tableAudioStore struct {
+	db *sql.DB
+}
+
+// upload reads the whole file into memory, as a bytea value is sent in one piece.
+func (s tableAudioStore) upload(ctx context.Context, tenant string, id primitive.ObjectID, name string, audio io.Reader) error {
+	data, err := ioutil.ReadAll(audio)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT INTO audio_files (tenant, id, name, data) VALUES ($1, $2, $3, $4)",
+		tenant, id.Hex(), name, data)
+	return translateSQLError(err)
+}
+
+func (s tableAudioStore) download(ctx context.Context, tenant string, id primitive.ObjectID) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM audio_files WHERE tenant = $1 AND id = $2", tenant, id.Hex()).Scan(&data)
+	if err != nil {
+		return nil, translateSQLError(err)
+	}
+	return data, nil
+}
+
+func (s tableAudioStore) delete(ctx context.Context, tenant string, id primitive.ObjectID) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM audio_files WHERE tenant = $1 AND id = $2", tenant, id.Hex())
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s tableAudioStore) list(ctx context.Context, tenant string) ([]primitive.ObjectID, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM audio_files WHERE tenant = $1", tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []primitive.ObjectID
+	for rows.Next() {
+		var hex string
+		if err := rows.Scan(&hex); err != nil {
+			return nil, err
+		}
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ping checks that the table can be read.
+func (s tableAudioStore) ping(ctx context.Context) error {
+	var one int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM audio_files LIMIT 1").Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
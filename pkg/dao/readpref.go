@@ -0,0 +1,16 @@
+package dao
+
+import "context"
+
+type secondaryReadsKey struct{}
+
+// WithSecondaryReads returns a context whose queries may be served by the DatabaseHandler's ListReadPreference, for
+// reads that can tolerate data a little behind the primary. Writes always go to the primary.
+func WithSecondaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, secondaryReadsKey{}, true)
+}
+
+func secondaryReadsAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(secondaryReadsKey{}).(bool)
+	return allowed
+}
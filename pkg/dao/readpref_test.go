@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestDao_Database_ShouldUseListReadPreferenceOnlyForSecondaryReads(t *testing.T) {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.Nil(t, err)
+	handler := NewDatabaseHandler(client)
+	handler.TenantDatabasePrefix = "tenant_"
+	handler.ListReadPreference = readpref.SecondaryPreferred()
+
+	ctx, err := WithTenant(context.Background(), "test")
+	require.Nil(t, err)
+	database, err := handler.database(ctx)
+	require.Nil(t, err)
+	require.Equal(t, "tenant_test", database.Name())
+	require.Equal(t, readpref.PrimaryMode, database.ReadPreference().Mode())
+
+	database, err = handler.database(WithSecondaryReads(ctx))
+	require.Nil(t, err)
+	require.Equal(t, "tenant_test", database.Name())
+	require.Equal(t, readpref.SecondaryPreferredMode, database.ReadPreference().Mode())
+}
+
+func TestDao_Database_ShouldRefuseContextWithoutTenantWhenMultiTenant(t *testing.T) {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.Nil(t, err)
+	handler := NewDatabaseHandler(client)
+
+	database, err := handler.database(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, "db", database.Name())
+
+	handler.TenantDatabasePrefix = "tenant_"
+	_, err = handler.database(context.Background())
+	require.Equal(t, ErrNoTenant, err)
+	_, err = handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Equal(t, ErrNoTenant, err)
+}
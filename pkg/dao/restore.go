@@ -0,0 +1,105 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The collections RestoreDocument can store into.
+const (
+	CollectionTracks    = "tracks"
+	CollectionPlaylists = "playlists"
+	CollectionPodcasts  = "podcasts"
+	CollectionShares    = "shares"
+	CollectionAPIKeys   = "apikeys"
+)
+
+// unknownCollection is returned by RestoreDocument for a collection it cannot store into.
+func unknownCollection(collection string) error {
+	return fmt.Errorf("unknown collection %q", collection)
+}
+
+func (db *DatabaseHandler) restoreCollection(ctx context.Context, collection string) (*mongo.Collection, error) {
+	switch collection {
+	case CollectionTracks:
+		return db.getTrackCollection(ctx)
+	case CollectionPlaylists:
+		return db.getPlaylistCollection(ctx)
+	case CollectionPodcasts:
+		return db.getPodcastCollection(ctx)
+	case CollectionShares:
+		return db.getShareCollection(ctx)
+	case CollectionAPIKeys:
+		return db.getAPIKeyCollection(ctx)
+	default:
+		return nil, unknownCollection(collection)
+	}
+}
+
+// RestoreDocument stores a document as it is, keeping its ID, revision and times, for restoring a backup. Unless
+// replace is set it is inserted, returning ErrDuplicate if a document with its ID exists; otherwise it replaces that
+// document, returning ErrNotFound if there is none. The search suggestions follow a restored track.
+func (db *DatabaseHandler) RestoreDocument(ctx context.Context, collection string, doc interface{}, replace bool) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	coll, err := db.restoreCollection(ctx, collection)
+	if err != nil {
+		return err
+	}
+	restored, err := toDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	if !replace {
+		if _, err := coll.InsertOne(ctx, restored); err != nil {
+			return translateError(err)
+		}
+		if collection == CollectionTracks {
+			var track models.Track
+			if err := fromDocument(restored, &track); err == nil {
+				db.adjustSuggestions(ctx, track, 1)
+			}
+		}
+		return nil
+	}
+
+	result := coll.FindOneAndReplace(ctx, bson.M{"_id": restored["_id"]}, restored)
+	if result.Err() != nil {
+		return translateError(result.Err())
+	}
+	if collection == CollectionTracks {
+		var previous, track models.Track
+		if err := result.Decode(&previous); err == nil {
+			db.adjustSuggestions(ctx, previous, -1)
+		}
+		if err := fromDocument(restored, &track); err == nil {
+			db.adjustSuggestions(ctx, track, 1)
+		}
+	}
+	return nil
+}
+
+// RestoreAudioFile stores audio under the ID it had in a backup, replacing any file already stored with that ID.
+func (db *DatabaseHandler) RestoreAudioFile(ctx context.Context, id primitive.ObjectID, audioFile []byte, name string) error {
+	ctx, cancel := withTimeout(ctx, db.GridFSTimeout)
+	defer cancel()
+
+	bucket, err := db.audioBucket(ctx)
+	if err != nil {
+		return err
+	}
+	if err := translateError(bucket.Delete(id)); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return bucket.UploadFromStreamWithID(id, name, bytes.NewReader(audioFile))
+}
@@ -0,0 +1,379 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// ErrUnavailable is returned when the database could not be reached, or was between primaries, for as long as an
+// operation was retried. Unlike other failures it is worth the caller trying again later.
+var ErrUnavailable = errors.New("database unavailable")
+
+// notPrimaryCodes are the server error codes for an operation sent to a member that is not, or is no longer, the
+// primary, as during a failover. The operation was not applied.
+var notPrimaryCodes = []int{10107, 13435, 13436, 11600, 11602, 189, 91}
+
+// RetryingHandler retries the operations of another DbHandler that fail because MongoDB is briefly out of reach, such
+// as while a replica set elects a new primary. Reads are retried on any transient error. Writes are retried only when
+// the error shows they were not applied, since after a dropped connection an insert may or may not have been made.
+// Attempts includes the first, and the wait between them doubles from Backoff. An operation still failing transiently
+// once the attempts run out returns an ErrUnavailable. Pings and change streams are left to the wrapped handler.
+type RetryingHandler struct {
+	DbHandler
+	Attempts int
+	Backoff  time.Duration
+}
+
+// unapplied reports whether err shows that the operation never took effect, so that even a write can be sent again.
+func unapplied(err error) bool {
+	var selection topology.ServerSelectionError
+	if errors.As(err, &selection) {
+		return true
+	}
+
+	var server mongo.ServerError
+	if !errors.As(err, &server) {
+		return false
+	}
+	if server.HasErrorLabel("RetryableWriteError") {
+		return true
+	}
+	for _, code := range notPrimaryCodes {
+		if server.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// transient reports whether err is from the database being out of reach rather than from the operation itself. The
+// caller's own deadline or cancellation is not transient.
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return unapplied(err) || mongo.IsNetworkError(err)
+}
+
+func (r *RetryingHandler) read(ctx context.Context, op func() error) error {
+	return r.retry(ctx, transient, op)
+}
+
+func (r *RetryingHandler) write(ctx context.Context, op func() error) error {
+	return r.retry(ctx, unapplied, op)
+}
+
+func (r *RetryingHandler) retry(ctx context.Context, retryable func(error) bool, op func() error) error {
+	wait := r.Backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !transient(err) {
+			return err
+		}
+		if attempt >= r.Attempts || !retryable(err) {
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+
+		logrus.WithError(err).WithField("attempt", attempt).Warn("Transient database error, retrying")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (r *RetryingHandler) EnsureIndexes(ctx context.Context) error {
+	return r.write(ctx, func() error { return r.DbHandler.EnsureIndexes(ctx) })
+}
+
+func (r *RetryingHandler) AddTrack(ctx context.Context, track models.Track) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddTrack(ctx, track) })
+}
+
+func (r *RetryingHandler) UploadAudioFile(ctx context.Context, audioFile []byte, trackName string) (interface{}, error) {
+	var id interface{}
+	err := r.write(ctx, func() (err error) {
+		id, err = r.DbHandler.UploadAudioFile(ctx, audioFile, trackName)
+		return err
+	})
+	return id, err
+}
+
+// UploadAudioStream retries only when the stream can be rewound, since a failed attempt may have read part of it.
+func (r *RetryingHandler) UploadAudioStream(ctx context.Context, audio io.Reader, trackName string) (interface{}, error) {
+	seeker, rewindable := audio.(io.Seeker)
+	retryable := unapplied
+	if !rewindable {
+		retryable = func(error) bool { return false }
+	}
+
+	var id interface{}
+	err := r.retry(ctx, retryable, func() (err error) {
+		if rewindable {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		id, err = r.DbHandler.UploadAudioStream(ctx, audio, trackName)
+		return err
+	})
+	return id, err
+}
+
+func (r *RetryingHandler) DownloadAudioFile(ctx context.Context, audioFileID primitive.ObjectID) ([]byte, error) {
+	var audio []byte
+	err := r.read(ctx, func() (err error) {
+		audio, err = r.DbHandler.DownloadAudioFile(ctx, audioFileID)
+		return err
+	})
+	return audio, err
+}
+
+func (r *RetryingHandler) DeleteAudioFile(ctx context.Context, audioFileID primitive.ObjectID) error {
+	return r.write(ctx, func() error { return r.DbHandler.DeleteAudioFile(ctx, audioFileID) })
+}
+
+func (r *RetryingHandler) FindOrphanedAudioFiles(ctx context.Context) ([]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	err := r.read(ctx, func() (err error) {
+		ids, err = r.DbHandler.FindOrphanedAudioFiles(ctx)
+		return err
+	})
+	return ids, err
+}
+
+func (r *RetryingHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track, revision int64) error {
+	return r.write(ctx, func() error { return r.DbHandler.UpdateTrack(ctx, id, updatedTrack, revision) })
+}
+
+func (r *RetryingHandler) SetTrackAudio(ctx context.Context, id primitive.ObjectID, track models.Track) error {
+	return r.write(ctx, func() error { return r.DbHandler.SetTrackAudio(ctx, id, track) })
+}
+
+func (r *RetryingHandler) AddTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddTrackTags(ctx, id, tags, revision) })
+}
+
+func (r *RetryingHandler) RemoveTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	return r.write(ctx, func() error { return r.DbHandler.RemoveTrackTags(ctx, id, tags, revision) })
+}
+
+func (r *RetryingHandler) SetTrackLastPlayed(ctx context.Context, id primitive.ObjectID, playedAt time.Time) error {
+	return r.write(ctx, func() error { return r.DbHandler.SetTrackLastPlayed(ctx, id, playedAt) })
+}
+
+func (r *RetryingHandler) GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error) {
+	var tracks []models.Track
+	err := r.read(ctx, func() (err error) {
+		tracks, err = r.DbHandler.GetTracks(ctx, filters)
+		return err
+	})
+	return tracks, err
+}
+
+func (r *RetryingHandler) SampleTracks(ctx context.Context, filters map[string]interface{}, count int) ([]models.Track, error) {
+	var tracks []models.Track
+	err := r.read(ctx, func() (err error) {
+		tracks, err = r.DbHandler.SampleTracks(ctx, filters, count)
+		return err
+	})
+	return tracks, err
+}
+
+func (r *RetryingHandler) GetRecentTracks(ctx context.Context, since time.Time) ([]models.Track, error) {
+	var tracks []models.Track
+	err := r.read(ctx, func() (err error) {
+		tracks, err = r.DbHandler.GetRecentTracks(ctx, since)
+		return err
+	})
+	return tracks, err
+}
+
+func (r *RetryingHandler) DeleteTrack(ctx context.Context, id primitive.ObjectID) error {
+	return r.write(ctx, func() error { return r.DbHandler.DeleteTrack(ctx, id) })
+}
+
+func (r *RetryingHandler) SearchTracks(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	var tracks []models.Track
+	err := r.read(ctx, func() (err error) {
+		tracks, err = r.DbHandler.SearchTracks(ctx, query, limit)
+		return err
+	})
+	return tracks, err
+}
+
+func (r *RetryingHandler) GetSuggestions(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	var suggestions []models.Suggestion
+	err := r.read(ctx, func() (err error) {
+		suggestions, err = r.DbHandler.GetSuggestions(ctx, prefix, limit)
+		return err
+	})
+	return suggestions, err
+}
+
+func (r *RetryingHandler) AddPlaylist(ctx context.Context, playlist models.Playlist) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddPlaylist(ctx, playlist) })
+}
+
+func (r *RetryingHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M, revision int64) error {
+	return r.write(ctx, func() error { return r.DbHandler.UpdatePlaylist(ctx, playlistId, update, revision) })
+}
+
+func (r *RetryingHandler) MovePlaylistTrack(ctx context.Context, playlistId primitive.ObjectID, trackId primitive.ObjectID, index int, revision int64) error {
+	return r.write(ctx, func() error { return r.DbHandler.MovePlaylistTrack(ctx, playlistId, trackId, index, revision) })
+}
+
+func (r *RetryingHandler) DeletePlaylist(ctx context.Context, id primitive.ObjectID) error {
+	return r.write(ctx, func() error { return r.DbHandler.DeletePlaylist(ctx, id) })
+}
+
+func (r *RetryingHandler) GetPlaylists(ctx context.Context, filters map[string]interface{}) ([]models.Playlist, error) {
+	var playlists []models.Playlist
+	err := r.read(ctx, func() (err error) {
+		playlists, err = r.DbHandler.GetPlaylists(ctx, filters)
+		return err
+	})
+	return playlists, err
+}
+
+func (r *RetryingHandler) GetPlaylistPage(ctx context.Context, id primitive.ObjectID, offset int, limit int) (models.PlaylistPage, error) {
+	var page models.PlaylistPage
+	err := r.read(ctx, func() (err error) {
+		page, err = r.DbHandler.GetPlaylistPage(ctx, id, offset, limit)
+		return err
+	})
+	return page, err
+}
+
+func (r *RetryingHandler) AddPodcast(ctx context.Context, podcast models.Podcast) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddPodcast(ctx, podcast) })
+}
+
+func (r *RetryingHandler) UpdatePodcast(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	return r.write(ctx, func() error { return r.DbHandler.UpdatePodcast(ctx, id, update) })
+}
+
+func (r *RetryingHandler) DeletePodcast(ctx context.Context, id primitive.ObjectID) error {
+	return r.write(ctx, func() error { return r.DbHandler.DeletePodcast(ctx, id) })
+}
+
+func (r *RetryingHandler) GetPodcasts(ctx context.Context, filters map[string]interface{}) ([]models.Podcast, error) {
+	var podcasts []models.Podcast
+	err := r.read(ctx, func() (err error) {
+		podcasts, err = r.DbHandler.GetPodcasts(ctx, filters)
+		return err
+	})
+	return podcasts, err
+}
+
+func (r *RetryingHandler) AddAPIKey(ctx context.Context, key models.APIKey) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddAPIKey(ctx, key) })
+}
+
+func (r *RetryingHandler) GetAPIKeys(ctx context.Context, filters map[string]interface{}) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.read(ctx, func() (err error) {
+		keys, err = r.DbHandler.GetAPIKeys(ctx, filters)
+		return err
+	})
+	return keys, err
+}
+
+func (r *RetryingHandler) AddShare(ctx context.Context, share models.Share) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddShare(ctx, share) })
+}
+
+func (r *RetryingHandler) GetShares(ctx context.Context, filters map[string]interface{}) ([]models.Share, error) {
+	var shares []models.Share
+	err := r.read(ctx, func() (err error) {
+		shares, err = r.DbHandler.GetShares(ctx, filters)
+		return err
+	})
+	return shares, err
+}
+
+func (r *RetryingHandler) RecordSharePlay(ctx context.Context, id primitive.ObjectID) error {
+	return r.write(ctx, func() error { return r.DbHandler.RecordSharePlay(ctx, id) })
+}
+
+func (r *RetryingHandler) RestoreDocument(ctx context.Context, collection string, doc interface{}, replace bool) error {
+	return r.write(ctx, func() error { return r.DbHandler.RestoreDocument(ctx, collection, doc, replace) })
+}
+
+func (r *RetryingHandler) RestoreAudioFile(ctx context.Context, id primitive.ObjectID, audioFile []byte, name string) error {
+	return r.write(ctx, func() error { return r.DbHandler.RestoreAudioFile(ctx, id, audioFile, name) })
+}
+
+func (r *RetryingHandler) AddPlay(ctx context.Context, play models.Play) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddPlay(ctx, play) })
+}
+
+func (r *RetryingHandler) GetPlayCounts(ctx context.Context, since time.Time) ([]models.PlayCount, error) {
+	var counts []models.PlayCount
+	err := r.read(ctx, func() (err error) {
+		counts, err = r.DbHandler.GetPlayCounts(ctx, since)
+		return err
+	})
+	return counts, err
+}
+
+func (r *RetryingHandler) SetNowPlaying(ctx context.Context, state models.NowPlaying) error {
+	return r.write(ctx, func() error { return r.DbHandler.SetNowPlaying(ctx, state) })
+}
+
+func (r *RetryingHandler) GetNowPlaying(ctx context.Context, user string) (models.NowPlaying, error) {
+	var state models.NowPlaying
+	err := r.read(ctx, func() (err error) {
+		state, err = r.DbHandler.GetNowPlaying(ctx, user)
+		return err
+	})
+	return state, err
+}
+
+func (r *RetryingHandler) AddJob(ctx context.Context, job models.Job) error {
+	return r.write(ctx, func() error { return r.DbHandler.AddJob(ctx, job) })
+}
+
+func (r *RetryingHandler) ClaimJob(ctx context.Context, worker string, kinds []string, lease time.Duration) (models.Job, error) {
+	var job models.Job
+	err := r.write(ctx, func() (err error) {
+		job, err = r.DbHandler.ClaimJob(ctx, worker, kinds, lease)
+		return err
+	})
+	return job, err
+}
+
+func (r *RetryingHandler) UpdateJob(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	return r.write(ctx, func() error { return r.DbHandler.UpdateJob(ctx, id, update) })
+}
+
+func (r *RetryingHandler) TransitionJob(ctx context.Context, id primitive.ObjectID, from []string, update bson.M) (models.Job, error) {
+	var job models.Job
+	err := r.write(ctx, func() (err error) {
+		job, err = r.DbHandler.TransitionJob(ctx, id, from, update)
+		return err
+	})
+	return job, err
+}
+
+func (r *RetryingHandler) GetJobs(ctx context.Context, filters map[string]interface{}) ([]models.Job, error) {
+	var jobs []models.Job
+	err := r.read(ctx, func() (err error) {
+		jobs, err = r.DbHandler.GetJobs(ctx, filters)
+		return err
+	})
+	return jobs, err
+}
@@ -0,0 +1,120 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// flakyHandler fails each operation with the next of its errors before handing it to the in-memory handler.
+type flakyHandler struct {
+	DbHandler
+	errs  []error
+	calls int
+}
+
+func (f *flakyHandler) fail() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyHandler) GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.DbHandler.GetTracks(ctx, filters)
+}
+
+func (f *flakyHandler) AddTrack(ctx context.Context, track models.Track) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+	return f.DbHandler.AddTrack(ctx, track)
+}
+
+// UploadAudioStream reads part of the stream before failing, as an upload cut off partway would.
+func (f *flakyHandler) UploadAudioStream(ctx context.Context, audio io.Reader, trackName string) (interface{}, error) {
+	if err := f.fail(); err != nil {
+		audio.Read(make([]byte, 2))
+		return nil, err
+	}
+	return f.DbHandler.UploadAudioStream(ctx, audio, trackName)
+}
+
+var (
+	errNetwork    = mongo.CommandError{Message: "connection reset", Labels: []string{"NetworkError"}}
+	errNotPrimary = mongo.CommandError{Code: 10107, Message: "not master"}
+)
+
+func TestDao_RetryingHandler_ShouldRetryReadsThroughFailover(t *testing.T) {
+	flaky := &flakyHandler{DbHandler: NewMemoryHandler(), errs: []error{errNetwork, errNotPrimary}}
+	handler := &RetryingHandler{DbHandler: flaky, Attempts: 3}
+
+	_, err := handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Nil(t, err)
+	require.Equal(t, 3, flaky.calls)
+}
+
+func TestDao_RetryingHandler_ShouldNotRetryWritesThatMayHaveBeenApplied(t *testing.T) {
+	flaky := &flakyHandler{DbHandler: NewMemoryHandler(), errs: []error{errNetwork}}
+	handler := &RetryingHandler{DbHandler: flaky, Attempts: 3}
+
+	err := handler.AddTrack(context.Background(), models.Track{Name: "test"})
+	require.True(t, errors.Is(err, ErrUnavailable))
+	require.Equal(t, 1, flaky.calls)
+
+	flaky.errs = []error{errNotPrimary}
+	require.Nil(t, handler.AddTrack(context.Background(), models.Track{Name: "test"}))
+	require.Equal(t, 3, flaky.calls)
+}
+
+func TestDao_RetryingHandler_ShouldReportUnavailableOnceAttemptsRunOut(t *testing.T) {
+	flaky := &flakyHandler{DbHandler: NewMemoryHandler(), errs: []error{errNetwork, errNetwork, errNetwork}}
+	handler := &RetryingHandler{DbHandler: flaky, Attempts: 2}
+
+	_, err := handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.True(t, errors.Is(err, ErrUnavailable))
+	require.Contains(t, err.Error(), "connection reset")
+	require.Equal(t, 2, flaky.calls)
+}
+
+func TestDao_RetryingHandler_ShouldReturnOtherErrorsAsTheyAre(t *testing.T) {
+	other := errors.New("test")
+	flaky := &flakyHandler{DbHandler: NewMemoryHandler(), errs: []error{other}}
+	handler := &RetryingHandler{DbHandler: flaky, Attempts: 3}
+
+	_, err := handler.GetTracks(context.Background(), map[string]interface{}{})
+	require.Equal(t, other, err)
+	require.Equal(t, 1, flaky.calls)
+}
+
+func TestDao_RetryingHandler_ShouldRewindStreamsBeforeRetryingUploads(t *testing.T) {
+	flaky := &flakyHandler{DbHandler: NewMemoryHandler(), errs: []error{errNotPrimary}}
+	handler := &RetryingHandler{DbHandler: flaky, Attempts: 3}
+
+	id, err := handler.UploadAudioStream(context.Background(), strings.NewReader("audio"), "Song")
+	require.Nil(t, err)
+	require.Equal(t, 2, flaky.calls)
+	audio, err := handler.DownloadAudioFile(context.Background(), id.(primitive.ObjectID))
+	require.Nil(t, err)
+	require.Equal(t, []byte("audio"), audio)
+
+	// A stream that cannot be rewound is only tried once.
+	flaky.errs = []error{errNotPrimary}
+	_, err = handler.UploadAudioStream(context.Background(), io.MultiReader(strings.NewReader("audio")), "Song")
+	require.True(t, errors.Is(err, ErrUnavailable))
+	require.Equal(t, 3, flaky.calls)
+}
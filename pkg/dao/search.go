@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchScore scores a track by the words of a search it contains, weighting its name above its artist and its artist
+// above the rest of its text, as PostgreSQL's full text search does. It is 0 unless the track contains every word.
+func searchScore(terms []string, name string, artist string, other string) int {
+	fields := []struct {
+		words  map[string]bool
+		weight int
+	}{
+		{wordSet(name), 3},
+		{wordSet(artist), 2},
+		{wordSet(other), 1},
+	}
+
+	score := 0
+	for _, term := range terms {
+		termScore := 0
+		for _, field := range fields {
+			if field.words[term] {
+				termScore += field.weight
+			}
+		}
+		if termScore == 0 {
+			return 0
+		}
+		score += termScore
+	}
+	return score
+}
+
+// searchWords splits text into lower case words.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range searchWords(text) {
+		words[word] = true
+	}
+	return words
+}
@@ -0,0 +1,1293 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SQLHandler is a DbHandler keeping the library in a SQL database, PostgreSQL or SQLite, for deployments that would
+// rather not run MongoDB. Tracks, playlists and the tracks on each playlist are tables of their own, with foreign keys
+// tying playlists and plays to the tracks they refer to. The columns queries and constraints need are kept beside each
+// record's full document, stored as BSON, and the filters callers pass are evaluated over those documents. Every
+// tenant shares the same tables, keyed by tenant.
+type SQLHandler struct {
+	DB *sql.DB
+
+	// ReadTimeout, WriteTimeout and AudioTimeout bound each query, each change and each transfer of audio to or from
+	// the audio store. A timeout of 0 sets no bound.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	AudioTimeout time.Duration
+
+	dialect sqlDialect
+	audio   audioStore
+}
+
+// sqlDialect is what differs between the databases a SQLHandler supports.
+type sqlDialect interface {
+	// schema returns the statements creating the tables, indexes and triggers the handler relies on.
+	schema() string
+	// bind rewrites a query written with PostgreSQL's $1 placeholders for the database.
+	bind(query string) string
+	// lock returns the clause locking the rows a query selects until the end of the transaction, skipping those
+	// already locked if skipLocked is set.
+	lock(skipLocked bool) string
+	// searchTracks returns the documents of up to limit of the tenant's tracks matching the query, best match first.
+	searchTracks(ctx context.Context, db *SQLHandler, tenant string, query string, limit int) ([]bson.M, error)
+	// changes calls handle for each change to the table until the context is cancelled or handle returns an error.
+	changes(ctx context.Context, db *SQLHandler, table sqlTable, handle func(change sqlChange) error) error
+}
+
+// audioStore holds the audio files of a SQLHandler's tracks.
+type audioStore interface {
+	upload(ctx context.Context, tenant string, id primitive.ObjectID, name string, audio io.Reader) error
+	download(ctx context.Context, tenant string, id primitive.ObjectID) ([]byte, error)
+	delete(ctx context.Context, tenant string, id primitive.ObjectID) error
+	list(ctx context.Context, tenant string) ([]primitive.ObjectID, error)
+	ping(ctx context.Context) error
+}
+
+// sqlChange is an insert, update or delete of a row of tracks or playlists.
+type sqlChange struct {
+	Table     string             `json:"table"`
+	Operation string             `json:"operation"`
+	Tenant    string             `json:"tenant"`
+	ID        primitive.ObjectID `json:"id"`
+}
+
+// sqlTable describes a table holding documents: the columns kept beside the document, and how their values are read
+// from it.
+type sqlTable struct {
+	name    string
+	columns []string
+	values  func(doc bson.M) []interface{}
+}
+
+var (
+	tracksTable = sqlTable{
+		name:    "tracks",
+		columns: []string{"name", "artist", "album", "tags", "created_at"},
+		values: func(doc bson.M) []interface{} {
+			tags, _ := doc["tags"].(primitive.A)
+			words := make([]string, 0, len(tags))
+			for _, tag := range tags {
+				words = append(words, fmt.Sprint(tag))
+			}
+			return []interface{}{docString(doc, "name"), docString(doc, "artist"), docString(doc, "album"), strings.Join(words, " "), docTime(doc, "createdAt")}
+		},
+	}
+	playlistsTable = sqlTable{
+		name:    "playlists",
+		columns: []string{"name", "created_at"},
+		values: func(doc bson.M) []interface{} {
+			return []interface{}{docString(doc, "name"), docTime(doc, "createdAt")}
+		},
+	}
+	podcastsTable = sqlTable{
+		name:    "podcasts",
+		columns: []string{"feed_url"},
+		values: func(doc bson.M) []interface{} {
+			return []interface{}{docString(doc, "feedUrl")}
+		},
+	}
+	apiKeysTable = sqlTable{
+		name:    "api_keys",
+		columns: []string{"key_hash"},
+		values: func(doc bson.M) []interface{} {
+			return []interface{}{docString(doc, "keyHash")}
+		},
+	}
+	sharesTable = sqlTable{
+		name:    "shares",
+		columns: []string{"expires_at"},
+		values: func(doc bson.M) []interface{} {
+			return []interface{}{docTime(doc, "expiresAt")}
+		},
+	}
+	jobsTable = sqlTable{
+		name:    "jobs",
+		columns: []string{"kind", "status", "run_at", "locked_until", "created_at"},
+		values: func(doc bson.M) []interface{} {
+			return []interface{}{docString(doc, "kind"), docString(doc, "status"), docTime(doc, "runAt"), docTime(doc, "lockedUntil"), docTime(doc, "createdAt")}
+		},
+	}
+)
+
+func docString(doc bson.M, field string) string {
+	s, _ := doc[field].(string)
+	return s
+}
+
+// docTime returns a time field of a document in UTC, or nil if it is missing so that the column is NULL. SQLite
+// stores times as text, which only sorts in time order if every time has the same offset.
+func docTime(doc bson.M, field string) interface{} {
+	if t, ok := doc[field].(primitive.DateTime); ok {
+		return t.Time().UTC()
+	}
+	return nil
+}
+
+func docID(doc bson.M) string {
+	id, _ := doc["_id"].(primitive.ObjectID)
+	return id.Hex()
+}
+
+// docRevision returns the revision of a document, which is 0 for one stored before revisions were added.
+func docRevision(doc bson.M) int64 {
+	revision, _ := toInt64(doc["revision"])
+	return revision
+}
+
+// scannedTime reads a time, which SQLite returns as text when it is computed rather than read from a column.
+type scannedTime struct {
+	time.Time
+}
+
+func (t *scannedTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		value = string(v)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("cannot read %T as a time", value)
+	}
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if parsed, err := time.Parse(format, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot read %q as a time", s)
+}
+
+// querier is what a SQLHandler needs of a connection, so that the same queries can run in a transaction or not.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (db *SQLHandler) exec(ctx context.Context, q querier, query string, args ...interface{}) (sql.Result, error) {
+	return q.ExecContext(ctx, db.dialect.bind(query), args...)
+}
+
+func (db *SQLHandler) query(ctx context.Context, q querier, query string, args ...interface{}) (*sql.Rows, error) {
+	return q.QueryContext(ctx, db.dialect.bind(query), args...)
+}
+
+func (db *SQLHandler) queryRow(ctx context.Context, q querier, query string, args ...interface{}) *sql.Row {
+	return q.QueryRowContext(ctx, db.dialect.bind(query), args...)
+}
+
+// inList returns the placeholders for a list of values, numbered from first, for use in an IN clause.
+func inList(first int, values []string) (string, []interface{}) {
+	placeholders := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		placeholders[i] = fmt.Sprintf("$%d", first+i)
+		args[i] = value
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// translateSQLError turns a missing row, a duplicate key or a reference to a missing row into the DAO's own errors.
+// Other errors are returned as they are.
+func translateSQLError(err error) error {
+	var pqErr *pq.Error
+	var sqliteErr sqlite3.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case errors.As(err, &pqErr) && pqErr.Code == "23505",
+		errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey):
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	case errors.As(err, &pqErr) && pqErr.Code == "23503",
+		errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey:
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	default:
+		return err
+	}
+}
+
+// inTransaction runs fn in a transaction, committing it if fn succeeds.
+func (db *SQLHandler) inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.WithError(rollbackErr).Error("Error rolling back transaction")
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert adds a document to a table.
+func (db *SQLHandler) insert(ctx context.Context, q querier, table sqlTable, tenant string, doc bson.M) error {
+	encoded, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	columns := append([]string{"tenant", "id", "document"}, table.columns...)
+	args := append([]interface{}{tenant, docID(doc), encoded}, table.values(doc)...)
+	placeholders := make([]string, len(args))
+	for i := range args {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", table.name, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	_, err = db.exec(ctx, q, query, args...)
+	return translateSQLError(err)
+}
+
+// replace stores a changed document over the one with the same ID.
+func (db *SQLHandler) replace(ctx context.Context, q querier, table sqlTable, tenant string, doc bson.M) error {
+	encoded, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	assignments := []string{"document = $3"}
+	for i, column := range table.columns {
+		assignments = append(assignments, fmt.Sprintf("%v = $%d", column, i+4))
+	}
+	args := append([]interface{}{tenant, docID(doc), encoded}, table.values(doc)...)
+
+	query := fmt.Sprintf("UPDATE %v SET %v WHERE tenant = $1 AND id = $2", table.name, strings.Join(assignments, ", "))
+	result, err := db.exec(ctx, q, query, args...)
+	if err != nil {
+		return translateSQLError(err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// selectDocuments runs a query selecting a single column of documents.
+func (db *SQLHandler) selectDocuments(ctx context.Context, q querier, query string, args ...interface{}) ([]bson.M, error) {
+	rows, err := db.query(ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []bson.M
+	for rows.Next() {
+		var encoded []byte
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, err
+		}
+		var doc bson.M
+		if err := bson.Unmarshal(encoded, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// selectDocument returns the document with the given ID in the tenant's library, locking its row until the end of
+// the transaction.
+func (db *SQLHandler) selectDocument(ctx context.Context, tx *sql.Tx, table sqlTable, tenant string, id primitive.ObjectID) (bson.M, error) {
+	var encoded []byte
+	query := fmt.Sprintf("SELECT document FROM %v WHERE tenant = $1 AND id = $2", table.name) + db.dialect.lock(false)
+	if err := db.queryRow(ctx, tx, query, tenant, id.Hex()).Scan(&encoded); err != nil {
+		return nil, translateSQLError(err)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(encoded, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// findDocuments returns the documents in the tenant's library matching the filters, in the order they were created.
+// Only filters on _id narrow the query itself; the rest are evaluated over the documents it returns.
+func (db *SQLHandler) findDocuments(ctx context.Context, table sqlTable, tenant string, filters map[string]interface{}) ([]bson.M, error) {
+	query := fmt.Sprintf("SELECT document FROM %v WHERE tenant = $1", table.name)
+	args := []interface{}{tenant}
+	if ids, ok := filterIDs(filters); ok {
+		if len(ids) == 0 {
+			return nil, nil
+		}
+		placeholders, idArgs := inList(2, ids)
+		query += " AND id IN (" + placeholders + ")"
+		args = append(args, idArgs...)
+	}
+	if table.name == tracksTable.name || table.name == playlistsTable.name {
+		query += " ORDER BY created_at, id"
+	}
+
+	docs, err := db.selectDocuments(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if table.name == playlistsTable.name {
+		if err := db.attachPlaylistTracks(ctx, db.DB, tenant, docs); err != nil {
+			return nil, err
+		}
+	}
+	return matchDocuments(docs, filters)
+}
+
+func matchDocuments(docs []bson.M, filters map[string]interface{}) ([]bson.M, error) {
+	matching := docs[:0]
+	for _, doc := range docs {
+		matched, err := matchFilter(doc, filters)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matching = append(matching, doc)
+		}
+	}
+	return matching, nil
+}
+
+// filterIDs returns the IDs a filter on _id, by value or with $in, limits a query to.
+func filterIDs(filters map[string]interface{}) ([]string, bool) {
+	condition, ok := filters["_id"]
+	if !ok {
+		return nil, false
+	}
+	normalized, err := toDocument(map[string]interface{}{"_id": condition})
+	if err != nil {
+		return nil, false
+	}
+
+	var values primitive.A
+	switch v := normalized["_id"].(type) {
+	case primitive.ObjectID:
+		values = primitive.A{v}
+	case bson.M:
+		in, ok := v["$in"].(primitive.A)
+		if !ok || len(v) != 1 {
+			return nil, false
+		}
+		values = in
+	default:
+		return nil, false
+	}
+
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		id, ok := value.(primitive.ObjectID)
+		if !ok {
+			return nil, false
+		}
+		ids = append(ids, id.Hex())
+	}
+	return ids, true
+}
+
+// updateDocument applies an update to a document in the tenant's library that is still at the expected revision.
+func (db *SQLHandler) updateDocument(ctx context.Context, table sqlTable, tenant string, id primitive.ObjectID, revision int64, update bson.M) error {
+	return db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectDocument(ctx, tx, table, tenant, id)
+		if err != nil {
+			return err
+		}
+		if revision != AnyRevision && docRevision(doc) != revision {
+			return ErrRevisionMismatch
+		}
+		if err := applyUpdate(doc, update); err != nil {
+			return err
+		}
+		return db.replace(ctx, tx, table, tenant, doc)
+	})
+}
+
+func (db *SQLHandler) deleteRow(ctx context.Context, table sqlTable, id primitive.ObjectID) error {
+	query := fmt.Sprintf("DELETE FROM %v WHERE tenant = $1 AND id = $2", table.name)
+	result, err := db.exec(ctx, db.DB, query, TenantFromContext(ctx), id.Hex())
+	if err != nil {
+		return translateSQLError(err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListTenants returns every tenant with tracks, playlists or podcasts in the database.
+func (db *SQLHandler) ListTenants(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	rows, err := db.query(ctx, db.DB, `
+		SELECT tenant FROM tracks WHERE tenant <> ''
+		UNION SELECT tenant FROM playlists WHERE tenant <> ''
+		UNION SELECT tenant FROM podcasts WHERE tenant <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var tenant string
+		if err := rows.Scan(&tenant); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+func (db *SQLHandler) Ping(ctx context.Context) error {
+	return db.DB.PingContext(ctx)
+}
+
+// PingAudioStore checks that the audio store can be read.
+func (db *SQLHandler) PingAudioStore(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	return db.audio.ping(ctx)
+}
+
+// EnsureIndexes creates the tables, indexes and triggers the handler relies on. Creating any that already exist is a
+// no-op.
+func (db *SQLHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := db.DB.ExecContext(ctx, db.dialect.schema())
+	return err
+}
+
+func (db *SQLHandler) GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	docs, err := db.findDocuments(ctx, tracksTable, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTracks(docs)
+}
+
+func decodeTracks(docs []bson.M) ([]models.Track, error) {
+	var tracks []models.Track
+	for _, doc := range docs {
+		var track models.Track
+		if err := fromDocument(doc, &track); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// AddTrack inserts a track, stamping its creation and update times. A creation time that is already set, as on an
+// imported track, is kept.
+func (db *SQLHandler) AddTrack(ctx context.Context, track models.Track) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	if track.CreatedAt.IsZero() {
+		track.CreatedAt = now
+	}
+	track.UpdatedAt = now
+
+	doc, err := toDocument(track)
+	if err != nil {
+		return err
+	}
+	return db.insert(ctx, db.DB, tracksTable, TenantFromContext(ctx), doc)
+}
+
+func (db *SQLHandler) UploadAudioFile(ctx context.Context, audioFile []byte, trackName string) (interface{}, error) {
+	ctx, cancel := withTimeout(ctx, db.AudioTimeout)
+	defer cancel()
+
+	id := primitive.NewObjectID()
+	if err := db.audio.upload(ctx, TenantFromContext(ctx), id, trackName, bytes.NewReader(audioFile)); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (db *SQLHandler) UploadAudioStream(ctx context.Context, audio io.Reader, trackName string) (interface{}, error) {
+	ctx, cancel := withTimeout(ctx, db.AudioTimeout)
+	defer cancel()
+
+	id := primitive.NewObjectID()
+	if err := db.audio.upload(ctx, TenantFromContext(ctx), id, trackName, audio); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (db *SQLHandler) DownloadAudioFile(ctx context.Context, audioFileID primitive.ObjectID) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, db.AudioTimeout)
+	defer cancel()
+
+	return db.audio.download(ctx, TenantFromContext(ctx), audioFileID)
+}
+
+func (db *SQLHandler) DeleteAudioFile(ctx context.Context, audioFileID primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.AudioTimeout)
+	defer cancel()
+
+	return db.audio.delete(ctx, TenantFromContext(ctx), audioFileID)
+}
+
+// trackAudioFiles returns the IDs of every file a track references in the audio store, including its uploaded
+// artwork.
+func trackAudioFiles(track models.Track) []primitive.ObjectID {
+	ids := []primitive.ObjectID{track.AudioFileID}
+	if track.Original != nil {
+		ids = append(ids, track.Original.AudioFileID)
+	}
+	for _, variant := range track.Variants {
+		ids = append(ids, variant.AudioFileID)
+	}
+	for _, version := range track.Versions {
+		ids = append(ids, version.AudioFileID)
+	}
+	if !track.ArtworkFileID.IsZero() {
+		ids = append(ids, track.ArtworkFileID)
+	}
+	return ids
+}
+
+// FindOrphanedAudioFiles returns the IDs of stored audio files that no track references, as its current audio, as the
+// original it was transcoded from, as a quality variant, as a previous version or as its artwork.
+func (db *SQLHandler) FindOrphanedAudioFiles(ctx context.Context) ([]primitive.ObjectID, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	docs, err := db.selectDocuments(ctx, db.DB, "SELECT document FROM tracks WHERE tenant = $1", tenant)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := decodeTracks(docs)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[primitive.ObjectID]bool)
+	for _, track := range tracks {
+		for _, id := range trackAudioFiles(track) {
+			referenced[id] = true
+		}
+	}
+
+	stored, err := db.audio.list(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	var orphaned []primitive.ObjectID
+	for _, id := range stored {
+		if !referenced[id] {
+			orphaned = append(orphaned, id)
+		}
+	}
+	return orphaned, nil
+}
+
+// UpdateTrack copies the metadata set on updatedTrack onto the stored track, provided it is still at the expected
+// revision.
+func (db *SQLHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	return db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectDocument(ctx, tx, tracksTable, tenant, id)
+		if err != nil {
+			return err
+		}
+		var track models.Track
+		if err := fromDocument(doc, &track); err != nil {
+			return err
+		}
+		if revision != AnyRevision && track.Revision != revision {
+			return ErrRevisionMismatch
+		}
+		mergeTrackMetadata(&track, updatedTrack)
+
+		if doc, err = toDocument(track); err != nil {
+			return err
+		}
+		return db.replace(ctx, tx, tracksTable, tenant, doc)
+	})
+}
+
+// SetTrackAudio copies the audio file, its format and info, original, variants and fingerprint and the version history
+// from the given track onto the stored one. Files dropped from the history are not deleted here.
+func (db *SQLHandler) SetTrackAudio(ctx context.Context, id primitive.ObjectID, track models.Track) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	return db.updateDocument(ctx, tracksTable, TenantFromContext(ctx), id, AnyRevision, trackAudioUpdate(track))
+}
+
+// AddTrackTags adds tags to a track, ignoring any it already has.
+func (db *SQLHandler) AddTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	return db.updateDocument(ctx, tracksTable, TenantFromContext(ctx), id, revision, bson.M{
+		"$addToSet": bson.M{"tags": bson.M{"$each": tags}},
+		"$set":      bson.M{"updatedAt": time.Now()},
+		"$inc":      bson.M{"revision": 1},
+	})
+}
+
+func (db *SQLHandler) RemoveTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	return db.updateDocument(ctx, tracksTable, TenantFromContext(ctx), id, revision, bson.M{
+		"$pull": bson.M{"tags": bson.M{"$in": tags}},
+		"$set":  bson.M{"updatedAt": time.Now()},
+		"$inc":  bson.M{"revision": 1},
+	})
+}
+
+func (db *SQLHandler) SetTrackLastPlayed(ctx context.Context, id primitive.ObjectID, playedAt time.Time) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	return db.updateDocument(ctx, tracksTable, TenantFromContext(ctx), id, AnyRevision, bson.M{"$set": bson.M{"lastPlayedAt": playedAt}})
+}
+
+// SampleTracks returns up to count tracks chosen at random from those matching the filters.
+func (db *SQLHandler) SampleTracks(ctx context.Context, filters map[string]interface{}, count int) ([]models.Track, error) {
+	tracks, err := db.GetTracks(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(tracks), func(i, j int) {
+		tracks[i], tracks[j] = tracks[j], tracks[i]
+	})
+	if len(tracks) > count {
+		tracks = tracks[:count]
+	}
+	return tracks, nil
+}
+
+// GetRecentTracks returns the tracks added since the given time, newest first.
+func (db *SQLHandler) GetRecentTracks(ctx context.Context, since time.Time) ([]models.Track, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	docs, err := db.selectDocuments(ctx, db.DB,
+		"SELECT document FROM tracks WHERE tenant = $1 AND created_at >= $2 ORDER BY created_at DESC",
+		TenantFromContext(ctx), since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return decodeTracks(docs)
+}
+
+// DeleteTrack deletes a track and then its audio. The foreign keys remove it from playlists and drop its plays, and the
+// playlists it was on move to their next revision.
+func (db *SQLHandler) DeleteTrack(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	var track models.Track
+	err := db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectDocument(ctx, tx, tracksTable, tenant, id)
+		if err != nil {
+			return err
+		}
+		if err := fromDocument(doc, &track); err != nil {
+			return err
+		}
+
+		playlists, err := db.selectDocuments(ctx, tx, `
+			SELECT document FROM playlists
+			WHERE tenant = $1 AND id IN (SELECT playlist_id FROM playlist_tracks WHERE tenant = $1 AND track_id = $2)`+db.dialect.lock(false),
+			tenant, id.Hex())
+		if err != nil {
+			return err
+		}
+		for _, playlist := range playlists {
+			if err := applyUpdate(playlist, bson.M{"$inc": bson.M{"revision": 1}}); err != nil {
+				return err
+			}
+			if err := db.replace(ctx, tx, playlistsTable, tenant, playlist); err != nil {
+				return err
+			}
+		}
+
+		_, err = db.exec(ctx, tx, "DELETE FROM tracks WHERE tenant = $1 AND id = $2", tenant, id.Hex())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, audioFileID := range trackAudioFiles(track) {
+		if err := db.audio.delete(ctx, tenant, audioFileID); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchTracks returns up to limit tracks matching the query in their name, artist, album and tags, best match first.
+func (db *SQLHandler) SearchTracks(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	docs, err := db.dialect.searchTracks(ctx, db, TenantFromContext(ctx), query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTracks(docs)
+}
+
+// GetSuggestions returns up to limit titles, artists and albums starting with the prefix, ignoring case, with those on
+// the most tracks first. They are counted from the tracks as they are, so unlike with MongoDB there is nothing to keep
+// up to date or rebuild.
+func (db *SQLHandler) GetSuggestions(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	names := make([]string, 0, len(placeholderNames))
+	for name := range placeholderNames {
+		names = append(names, name)
+	}
+	excluded, excludedArgs := inList(3, names)
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix)) + "%"
+
+	args := append([]interface{}{TenantFromContext(ctx), pattern}, excludedArgs...)
+	rows, err := db.query(ctx, db.DB, fmt.Sprintf(`
+		SELECT kind, min(value), count(*) FROM (
+			SELECT 'track' AS kind, trim(name) AS value FROM tracks WHERE tenant = $1
+			UNION ALL SELECT 'artist', trim(artist) FROM tracks WHERE tenant = $1
+			UNION ALL SELECT 'album', trim(album) FROM tracks WHERE tenant = $1
+		) suggestions
+		WHERE value <> '' AND lower(value) LIKE $2 ESCAPE '\' AND lower(value) NOT IN (%v)
+		GROUP BY kind, lower(value)
+		ORDER BY count(*) DESC, lower(value)
+		LIMIT %d`, excluded, limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.Suggestion
+	for rows.Next() {
+		var suggestion models.Suggestion
+		if err := rows.Scan(&suggestion.Kind, &suggestion.Value, &suggestion.Count); err != nil {
+			return nil, err
+		}
+		results = append(results, suggestion)
+	}
+	return results, rows.Err()
+}
+
+// WatchTracks follows changes to tracks in every tenant's library, calling handle for each until the context is
+// cancelled or handle returns an error.
+func (db *SQLHandler) WatchTracks(ctx context.Context, handle func(change models.TrackChange) error) error {
+	return db.watch(ctx, tracksTable, func(event sqlChange, doc bson.M) error {
+		change := models.TrackChange{Operation: event.Operation, Tenant: event.Tenant, TrackID: event.ID}
+		if doc != nil {
+			change.Track = &models.Track{}
+			if err := fromDocument(doc, change.Track); err != nil {
+				return err
+			}
+		}
+		return handle(change)
+	})
+}
+
+// WatchPlaylists follows changes to playlists in every tenant's library in the same way as WatchTracks.
+func (db *SQLHandler) WatchPlaylists(ctx context.Context, handle func(change models.PlaylistChange) error) error {
+	return db.watch(ctx, playlistsTable, func(event sqlChange, doc bson.M) error {
+		change := models.PlaylistChange{Operation: event.Operation, Tenant: event.Tenant, PlaylistID: event.ID}
+		if doc != nil {
+			change.Playlist = &models.Playlist{}
+			if err := fromDocument(doc, change.Playlist); err != nil {
+				return err
+			}
+		}
+		return handle(change)
+	})
+}
+
+// watch passes handle each change to the table with the document as it is now, or nil once it has been deleted.
+func (db *SQLHandler) watch(ctx context.Context, table sqlTable, handle func(event sqlChange, doc bson.M) error) error {
+	return db.dialect.changes(ctx, db, table, func(event sqlChange) error {
+		var doc bson.M
+		if event.Operation != "delete" {
+			docs, err := db.findDocuments(ctx, table, event.Tenant, map[string]interface{}{"_id": event.ID})
+			if err != nil {
+				return err
+			}
+			if len(docs) > 0 {
+				doc = docs[0]
+			}
+		}
+		return handle(event, doc)
+	})
+}
+
+// AddPlaylist inserts a playlist, stamping its creation and update times. A creation time that is already set, as on
+// an imported playlist, is kept. Every track on it must exist.
+func (db *SQLHandler) AddPlaylist(ctx context.Context, playlist models.Playlist) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	if playlist.CreatedAt.IsZero() {
+		playlist.CreatedAt = now
+	}
+	playlist.UpdatedAt = now
+
+	doc, err := toDocument(playlist)
+	if err != nil {
+		return err
+	}
+	tenant := TenantFromContext(ctx)
+	return db.inTransaction(ctx, func(tx *sql.Tx) error {
+		return db.storePlaylist(ctx, tx, tenant, doc, true)
+	})
+}
+
+// storePlaylist inserts or replaces a playlist, keeping its tracks in playlist_tracks rather than in the document.
+func (db *SQLHandler) storePlaylist(ctx context.Context, tx *sql.Tx, tenant string, doc bson.M, insert bool) error {
+	tracks, _ := doc["tracks"].(primitive.A)
+	delete(doc, "tracks")
+
+	if insert {
+		if err := db.insert(ctx, tx, playlistsTable, tenant, doc); err != nil {
+			return err
+		}
+	} else {
+		if err := db.replace(ctx, tx, playlistsTable, tenant, doc); err != nil {
+			return err
+		}
+		if _, err := db.exec(ctx, tx, "DELETE FROM playlist_tracks WHERE tenant = $1 AND playlist_id = $2", tenant, docID(doc)); err != nil {
+			return err
+		}
+	}
+
+	for position, track := range tracks {
+		trackID, ok := track.(primitive.ObjectID)
+		if !ok {
+			return fmt.Errorf("playlist track %v is not an ID", track)
+		}
+		_, err := db.exec(ctx, tx, "INSERT INTO playlist_tracks (tenant, playlist_id, position, track_id) VALUES ($1, $2, $3, $4)",
+			tenant, docID(doc), position, trackID.Hex())
+		if err != nil {
+			return translateSQLError(err)
+		}
+	}
+	return nil
+}
+
+// attachPlaylistTracks adds the tracks on each playlist to its document, in order.
+func (db *SQLHandler) attachPlaylistTracks(ctx context.Context, q querier, tenant string, docs []bson.M) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	byID := make(map[string]bson.M, len(docs))
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		byID[docID(doc)] = doc
+		ids = append(ids, docID(doc))
+	}
+
+	placeholders, idArgs := inList(2, ids)
+	rows, err := db.query(ctx, q,
+		"SELECT playlist_id, track_id FROM playlist_tracks WHERE tenant = $1 AND playlist_id IN ("+placeholders+") ORDER BY playlist_id, position",
+		append([]interface{}{tenant}, idArgs...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var playlistID, trackHex string
+		if err := rows.Scan(&playlistID, &trackHex); err != nil {
+			return err
+		}
+		trackID, err := primitive.ObjectIDFromHex(trackHex)
+		if err != nil {
+			return err
+		}
+		doc := byID[playlistID]
+		tracks, _ := doc["tracks"].(primitive.A)
+		doc["tracks"] = append(tracks, trackID)
+	}
+	return rows.Err()
+}
+
+// UpdatePlaylist applies an update document to a playlist that is still at the expected revision, adding its update
+// time to any $set it contains and moving it to the next revision. Every track left on it must exist.
+func (db *SQLHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update bson.M, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	return db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectDocument(ctx, tx, playlistsTable, tenant, playlistId)
+		if err != nil {
+			return err
+		}
+		if err := db.attachPlaylistTracks(ctx, tx, tenant, []bson.M{doc}); err != nil {
+			return err
+		}
+		if revision != AnyRevision && docRevision(doc) != revision {
+			return ErrRevisionMismatch
+		}
+		if err := applyUpdate(doc, stampPlaylistUpdate(update)); err != nil {
+			return err
+		}
+		return db.storePlaylist(ctx, tx, tenant, doc, false)
+	})
+}
+
+func (db *SQLHandler) MovePlaylistTrack(ctx context.Context, playlistId primitive.ObjectID, trackId primitive.ObjectID, index int, revision int64) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	return db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectDocument(ctx, tx, playlistsTable, tenant, playlistId)
+		if err != nil {
+			return err
+		}
+		if err := db.attachPlaylistTracks(ctx, tx, tenant, []bson.M{doc}); err != nil {
+			return err
+		}
+		if revision != AnyRevision && docRevision(doc) != revision {
+			return ErrRevisionMismatch
+		}
+		tracks, err := arrayField(doc, "tracks")
+		if err != nil {
+			return err
+		}
+		update := bson.M{"$set": bson.M{"tracks": moveTrack(tracks, trackId, index)}}
+		if err := applyUpdate(doc, stampPlaylistUpdate(update)); err != nil {
+			return err
+		}
+		return db.storePlaylist(ctx, tx, tenant, doc, false)
+	})
+}
+
+func (db *SQLHandler) DeletePlaylist(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	return db.deleteRow(ctx, playlistsTable, id)
+}
+
+func (db *SQLHandler) GetPlaylists(ctx context.Context, filters map[string]interface{}) ([]models.Playlist, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	docs, err := db.findDocuments(ctx, playlistsTable, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var playlists []models.Playlist
+	for _, doc := range docs {
+		var playlist models.Playlist
+		if err := fromDocument(doc, &playlist); err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, nil
+}
+
+func (db *SQLHandler) GetPlaylistPage(ctx context.Context, id primitive.ObjectID, offset int, limit int) (models.PlaylistPage, error) {
+	return pagePlaylist(ctx, db, id, offset, limit)
+}
+
+func (db *SQLHandler) AddPodcast(ctx context.Context, podcast models.Podcast) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	doc, err := toDocument(podcast)
+	if err != nil {
+		return err
+	}
+	return db.insert(ctx, db.DB, podcastsTable, TenantFromContext(ctx), doc)
+}
+
+func (db *SQLHandler) UpdatePodcast(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	return db.updateDocument(ctx, podcastsTable, TenantFromContext(ctx), id, AnyRevision, update)
+}
+
+func (db *SQLHandler) DeletePodcast(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	return db.deleteRow(ctx, podcastsTable, id)
+}
+
+func (db *SQLHandler) GetPodcasts(ctx context.Context, filters map[string]interface{}) ([]models.Podcast, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	docs, err := db.findDocuments(ctx, podcastsTable, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var podcasts []models.Podcast
+	for _, doc := range docs {
+		var podcast models.Podcast
+		if err := fromDocument(doc, &podcast); err != nil {
+			return nil, err
+		}
+		podcasts = append(podcasts, podcast)
+	}
+	return podcasts, nil
+}
+
+func (db *SQLHandler) AddAPIKey(ctx context.Context, key models.APIKey) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	doc, err := toDocument(key)
+	if err != nil {
+		return err
+	}
+	return db.insert(ctx, db.DB, apiKeysTable, TenantFromContext(ctx), doc)
+}
+
+func (db *SQLHandler) GetAPIKeys(ctx context.Context, filters map[string]interface{}) ([]models.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	docs, err := db.findDocuments(ctx, apiKeysTable, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	for _, doc := range docs {
+		var key models.APIKey
+		if err := fromDocument(doc, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// AddShare inserts a share, first deleting the tenant's expired ones as MongoDB's TTL index would.
+func (db *SQLHandler) AddShare(ctx context.Context, share models.Share) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	if _, err := db.exec(ctx, db.DB, "DELETE FROM shares WHERE tenant = $1 AND expires_at <= $2", tenant, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	doc, err := toDocument(share)
+	if err != nil {
+		return err
+	}
+	return db.insert(ctx, db.DB, sharesTable, tenant, doc)
+}
+
+func (db *SQLHandler) GetShares(ctx context.Context, filters map[string]interface{}) ([]models.Share, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	docs, err := db.findDocuments(ctx, sharesTable, TenantFromContext(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var shares []models.Share
+	for _, doc := range docs {
+		var share models.Share
+		if err := fromDocument(doc, &share); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// RecordSharePlay counts a play against a share. The share's row is locked while its play limit is checked, so
+// concurrent plays cannot exceed it; ErrNotFound is returned once the limit has been reached.
+func (db *SQLHandler) RecordSharePlay(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	return db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectDocument(ctx, tx, sharesTable, tenant, id)
+		if err != nil {
+			return err
+		}
+		var share models.Share
+		if err := fromDocument(doc, &share); err != nil {
+			return err
+		}
+		if share.MaxPlays != 0 && share.Plays >= share.MaxPlays {
+			return ErrNotFound
+		}
+		if err := applyUpdate(doc, bson.M{"$inc": bson.M{"plays": 1}}); err != nil {
+			return err
+		}
+		return db.replace(ctx, tx, sharesTable, tenant, doc)
+	})
+}
+
+func (db *SQLHandler) AddPlay(ctx context.Context, play models.Play) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	_, err := db.exec(ctx, db.DB, "INSERT INTO plays (tenant, id, track_id, played_at) VALUES ($1, $2, $3, $4)",
+		TenantFromContext(ctx), play.ID.Hex(), play.TrackID.Hex(), play.PlayedAt.UTC())
+	return translateSQLError(err)
+}
+
+// GetPlayCounts returns how many times each track has been played since the given time, with the time of its latest
+// play. Tracks without plays are not included.
+func (db *SQLHandler) GetPlayCounts(ctx context.Context, since time.Time) ([]models.PlayCount, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	rows, err := db.query(ctx, db.DB,
+		"SELECT track_id, count(*), max(played_at) FROM plays WHERE tenant = $1 AND played_at >= $2 GROUP BY track_id",
+		TenantFromContext(ctx), since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.PlayCount
+	for rows.Next() {
+		var trackHex string
+		var lastPlayed scannedTime
+		var count models.PlayCount
+		if err := rows.Scan(&trackHex, &count.Plays, &lastPlayed); err != nil {
+			return nil, err
+		}
+		if count.TrackID, err = primitive.ObjectIDFromHex(trackHex); err != nil {
+			return nil, err
+		}
+		count.LastPlayed = lastPlayed.Time
+		results = append(results, count)
+	}
+	return results, rows.Err()
+}
+
+// SetNowPlaying stores what a user is listening to, replacing what they were before. The track must exist.
+func (db *SQLHandler) SetNowPlaying(ctx context.Context, state models.NowPlaying) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	encoded, err := bson.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = db.exec(ctx, db.DB, `INSERT INTO now_playing (tenant, user_id, track_id, document) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant, user_id) DO UPDATE SET track_id = excluded.track_id, document = excluded.document`,
+		TenantFromContext(ctx), state.User, state.TrackID.Hex(), encoded)
+	return translateSQLError(err)
+}
+
+// GetNowPlaying returns what a user was last listening to, or ErrNotFound if they have never said.
+func (db *SQLHandler) GetNowPlaying(ctx context.Context, user string) (models.NowPlaying, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	var encoded []byte
+	if err := db.queryRow(ctx, db.DB, "SELECT document FROM now_playing WHERE tenant = $1 AND user_id = $2",
+		TenantFromContext(ctx), user).Scan(&encoded); err != nil {
+		return models.NowPlaying{}, translateSQLError(err)
+	}
+	var state models.NowPlaying
+	err := bson.Unmarshal(encoded, &state)
+	return state, err
+}
+
+// RestoreDocument stores a document as it is, keeping its ID, revision and times, for restoring a backup. Unless
+// replace is set it is inserted, returning ErrDuplicate if a document with its ID exists; otherwise it replaces that
+// document, returning ErrNotFound if there is none.
+func (db *SQLHandler) RestoreDocument(ctx context.Context, collection string, doc interface{}, replace bool) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	var table sqlTable
+	switch collection {
+	case CollectionTracks:
+		table = tracksTable
+	case CollectionPlaylists:
+		table = playlistsTable
+	case CollectionPodcasts:
+		table = podcastsTable
+	case CollectionShares:
+		table = sharesTable
+	case CollectionAPIKeys:
+		table = apiKeysTable
+	default:
+		return unknownCollection(collection)
+	}
+
+	restored, err := toDocument(doc)
+	if err != nil {
+		return err
+	}
+	tenant := TenantFromContext(ctx)
+	if collection == CollectionPlaylists {
+		return db.inTransaction(ctx, func(tx *sql.Tx) error {
+			return db.storePlaylist(ctx, tx, tenant, restored, !replace)
+		})
+	}
+	if replace {
+		return db.replace(ctx, db.DB, table, tenant, restored)
+	}
+	return db.insert(ctx, db.DB, table, tenant, restored)
+}
+
+// RestoreAudioFile stores audio under the ID it had in a backup, replacing any file already stored with that ID.
+func (db *SQLHandler) RestoreAudioFile(ctx context.Context, id primitive.ObjectID, audioFile []byte, name string) error {
+	ctx, cancel := withTimeout(ctx, db.AudioTimeout)
+	defer cancel()
+
+	tenant := TenantFromContext(ctx)
+	if err := db.audio.delete(ctx, tenant, id); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return db.audio.upload(ctx, tenant, id, name, bytes.NewReader(audioFile))
+}
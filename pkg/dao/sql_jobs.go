@@ -0,0 +1,172 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddJob queues a job for the tenant in the context.
+func (db *SQLHandler) AddJob(ctx context.Context, job models.Job) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	job.Tenant = TenantFromContext(ctx)
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+
+	doc, err := toDocument(job)
+	if err != nil {
+		return err
+	}
+	return db.insert(ctx, db.DB, jobsTable, job.Tenant, doc)
+}
+
+// ClaimJob hands the worker the longest-waiting job of one of the given kinds that is due to run, or whose previous
+// worker's lease has run out, and leases it to the worker. Rows other workers are claiming are skipped rather than
+// waited for where the database supports it. It returns ErrNotFound if there is none.
+func (db *SQLHandler) ClaimJob(ctx context.Context, worker string, kinds []string, lease time.Duration) (models.Job, error) {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	if len(kinds) == 0 {
+		return models.Job{}, ErrNotFound
+	}
+
+	now := time.Now()
+	placeholders, kindArgs := inList(4, kinds)
+	var job models.Job
+	err := db.inTransaction(ctx, func(tx *sql.Tx) error {
+		docs, err := db.selectDocuments(ctx, tx, `
+			SELECT document FROM jobs
+			WHERE ((status = $1 AND run_at <= $3) OR (status = $2 AND locked_until < $3)) AND kind IN (`+placeholders+`)
+			ORDER BY run_at
+			LIMIT 1`+db.dialect.lock(true),
+			append([]interface{}{models.JobQueued, models.JobRunning, now.UTC()}, kindArgs...)...)
+		if err != nil {
+			return err
+		} else if len(docs) == 0 {
+			return ErrNotFound
+		}
+
+		return db.storeJobUpdate(ctx, tx, docs[0], claimJobUpdate(worker, now, lease), &job)
+	})
+	return job, err
+}
+
+// UpdateJob applies the update to the job, whichever tenant it belongs to, and records when it changed.
+func (db *SQLHandler) UpdateJob(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	stampJobUpdate(update)
+
+	return db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectJob(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.storeJobUpdate(ctx, tx, doc, update, nil)
+	})
+}
+
+// TransitionJob applies the update to the job, whichever tenant it belongs to, provided it is in one of the from
+// statuses, and returns the job as updated. The job's row is locked between the check and the update, so a job cannot
+// be changed by two transitions that each expected it in the status it was in before the other. It returns
+// ErrJobStatus if the job is in another status, and ErrNotFound if there is no such job.
+func (db *SQLHandler) TransitionJob(ctx context.Context, id primitive.ObjectID, from []string, update bson.M) (models.Job, error) {
+	ctx, cancel := withTimeout(ctx, db.WriteTimeout)
+	defer cancel()
+
+	stampJobUpdate(update)
+
+	var job models.Job
+	err := db.inTransaction(ctx, func(tx *sql.Tx) error {
+		doc, err := db.selectJob(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		allowed := false
+		for _, status := range from {
+			if docString(doc, "status") == status {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return ErrJobStatus
+		}
+		return db.storeJobUpdate(ctx, tx, doc, update, &job)
+	})
+	return job, err
+}
+
+// selectJob returns the job with the given ID, whichever tenant it belongs to, locking its row until the end of the
+// transaction.
+func (db *SQLHandler) selectJob(ctx context.Context, tx *sql.Tx, id primitive.ObjectID) (bson.M, error) {
+	docs, err := db.selectDocuments(ctx, tx, "SELECT document FROM jobs WHERE id = $1"+db.dialect.lock(false), id.Hex())
+	if err != nil {
+		return nil, err
+	} else if len(docs) == 0 {
+		return nil, ErrNotFound
+	}
+	return docs[0], nil
+}
+
+// storeJobUpdate applies the update to a job's document and stores it, decoding the result into job if it is not nil.
+func (db *SQLHandler) storeJobUpdate(ctx context.Context, tx *sql.Tx, doc bson.M, update bson.M, job *models.Job) error {
+	if err := applyUpdate(doc, update); err != nil {
+		return err
+	}
+	if err := db.replace(ctx, tx, jobsTable, docString(doc, "tenant"), doc); err != nil {
+		return err
+	}
+	if job == nil {
+		return nil
+	}
+	return fromDocument(doc, job)
+}
+
+// GetJobs returns the jobs of the tenant in the context matching the filters, newest first.
+func (db *SQLHandler) GetJobs(ctx context.Context, filters map[string]interface{}) ([]models.Job, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	query := "SELECT document FROM jobs WHERE tenant = $1"
+	args := []interface{}{TenantFromContext(ctx)}
+	if ids, ok := filterIDs(filters); ok {
+		if len(ids) == 0 {
+			return nil, nil
+		}
+		placeholders, idArgs := inList(2, ids)
+		query += " AND id IN (" + placeholders + ")"
+		args = append(args, idArgs...)
+	}
+
+	docs, err := db.selectDocuments(ctx, db.DB, query+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	if docs, err = matchDocuments(docs, filters); err != nil {
+		return nil, err
+	}
+
+	var jobs []models.Job
+	for _, doc := range docs {
+		var job models.Job
+		if err := fromDocument(doc, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,73 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Migrate applies the migrations the database has not had yet. The tables hold every tenant's library, so each
+// migration is applied once for all of them.
+func (db *SQLHandler) Migrate(ctx context.Context) error {
+	for _, m := range migrations {
+		if err := db.inTransaction(ctx, func(tx *sql.Tx) error {
+			return db.migrate(ctx, tx, m)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate applies a migration to the stored tracks, unless it has been already. Recording the migration first makes a
+// replica applying it at the same time wait for this transaction, and then find it applied.
+func (db *SQLHandler) migrate(ctx context.Context, tx *sql.Tx, m migration) error {
+	result, err := db.exec(ctx, tx, "INSERT INTO migrations (id, applied_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING", m.id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if recorded, err := result.RowsAffected(); err != nil {
+		return err
+	} else if recorded == 0 {
+		return nil
+	}
+
+	rows, err := db.query(ctx, tx, "SELECT tenant, document FROM tracks"+db.dialect.lock(false))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type rewritten struct {
+		tenant string
+		doc    bson.M
+	}
+	var changed []rewritten
+	for rows.Next() {
+		var tenant string
+		var encoded []byte
+		if err := rows.Scan(&tenant, &encoded); err != nil {
+			return err
+		}
+		var doc bson.M
+		if err := bson.Unmarshal(encoded, &doc); err != nil {
+			return err
+		}
+		if m.rewrite(doc) {
+			changed = append(changed, rewritten{tenant: tenant, doc: doc})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, track := range changed {
+		if err := db.replace(ctx, tx, tracksTable, track.tenant, track.doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
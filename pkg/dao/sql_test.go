@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDao_TranslateSQLError_ShouldMapDriverErrorsToDaoErrors(t *testing.T) {
+	require.Equal(t, ErrNotFound, translateSQLError(sql.ErrNoRows))
+	require.True(t, errors.Is(translateSQLError(&pq.Error{Code: "23505"}), ErrDuplicate))
+	require.True(t, errors.Is(translateSQLError(&pq.Error{Code: "23503"}), ErrNotFound))
+	require.True(t, errors.Is(translateSQLError(sqlite3.Error{ExtendedCode: sqlite3.ErrConstraintUnique}), ErrDuplicate))
+	require.True(t, errors.Is(translateSQLError(sqlite3.Error{ExtendedCode: sqlite3.ErrConstraintPrimaryKey}), ErrDuplicate))
+	require.True(t, errors.Is(translateSQLError(sqlite3.Error{ExtendedCode: sqlite3.ErrConstraintForeignKey}), ErrNotFound))
+
+	other := errors.New("test")
+	require.Equal(t, other, translateSQLError(other))
+	require.Nil(t, translateSQLError(nil))
+}
+
+func TestDao_FilterIDs_ShouldReturnIDsOnlyForFiltersOnIDs(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+	ids, ok := filterIDs(map[string]interface{}{"_id": first, "name": "Song"})
+	require.True(t, ok)
+	require.Equal(t, []string{first.Hex()}, ids)
+
+	ids, ok = filterIDs(map[string]interface{}{"_id": bson.M{"$in": []primitive.ObjectID{first, second}}})
+	require.True(t, ok)
+	require.Equal(t, []string{first.Hex(), second.Hex()}, ids)
+
+	_, ok = filterIDs(map[string]interface{}{"name": "Song"})
+	require.False(t, ok)
+	_, ok = filterIDs(map[string]interface{}{"_id": bson.M{"$nin": []primitive.ObjectID{first}}})
+	require.False(t, ok)
+}
@@ -0,0 +1,293 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sqlitePollInterval is how often change feeds look for new rows in the changes table.
+const sqlitePollInterval = time.Second
+
+// NewSQLiteHandler returns a SQLHandler for the SQLite database at the given path, which is created if it does not
+// exist, storing audio as files under audioDir. Together they need nothing but the local filesystem, so the API can
+// run as a single binary. EnsureIndexes creates the schema.
+func NewSQLiteHandler(path string, audioDir string) (*SQLHandler, error) {
+	audio, err := newFileAudioStore(audioDir)
+	if err != nil {
+		return nil, err
+	}
+	// Transactions take the write lock when they begin rather than on their first write, so that two transactions
+	// reading a row and then changing it wait for each other instead of one failing.
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=1&_busy_timeout=5000&_txlock=immediate&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLHandler{DB: db, dialect: sqliteDialect{}, audio: audio}, nil
+}
+
+// sqliteSchema mirrors postgresSchema. SQLite has no notifications, so triggers record each change to tracks and
+// playlists in the changes table instead, where change feeds poll for them; rows older than an hour are pruned.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tracks (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	artist TEXT NOT NULL DEFAULT '',
+	album TEXT NOT NULL DEFAULT '',
+	tags TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP,
+	document BLOB NOT NULL,
+	PRIMARY KEY (tenant, id)
+);
+CREATE INDEX IF NOT EXISTS tracks_created_at ON tracks (tenant, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS playlists (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP,
+	document BLOB NOT NULL,
+	PRIMARY KEY (tenant, id)
+);
+
+CREATE TABLE IF NOT EXISTS playlist_tracks (
+	tenant TEXT NOT NULL,
+	playlist_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	track_id TEXT NOT NULL,
+	PRIMARY KEY (tenant, playlist_id, position),
+	FOREIGN KEY (tenant, playlist_id) REFERENCES playlists (tenant, id) ON DELETE CASCADE,
+	FOREIGN KEY (tenant, track_id) REFERENCES tracks (tenant, id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS playlist_tracks_track ON playlist_tracks (tenant, track_id);
+
+CREATE TABLE IF NOT EXISTS plays (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	track_id TEXT NOT NULL,
+	played_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (tenant, id),
+	FOREIGN KEY (tenant, track_id) REFERENCES tracks (tenant, id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS plays_played_at ON plays (tenant, played_at DESC);
+
+CREATE TABLE IF NOT EXISTS now_playing (
+	tenant TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	track_id TEXT NOT NULL,
+	document BLOB NOT NULL,
+	PRIMARY KEY (tenant, user_id),
+	FOREIGN KEY (tenant, track_id) REFERENCES tracks (tenant, id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS podcasts (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	feed_url TEXT NOT NULL,
+	document BLOB NOT NULL,
+	PRIMARY KEY (tenant, id),
+	UNIQUE (tenant, feed_url)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	key_hash TEXT NOT NULL,
+	document BLOB NOT NULL,
+	PRIMARY KEY (tenant, id),
+	UNIQUE (tenant, key_hash)
+);
+
+CREATE TABLE IF NOT EXISTS shares (
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	document BLOB NOT NULL,
+	PRIMARY KEY (tenant, id)
+);
+
+CREATE TABLE IF NOT EXISTS migrations (
+	id TEXT PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	tenant TEXT NOT NULL,
+	id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL,
+	run_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	document BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_claim ON jobs (status, run_at);
+CREATE INDEX IF NOT EXISTS jobs_tenant ON jobs (tenant, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS changes (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	table_name TEXT NOT NULL,
+	operation TEXT NOT NULL,
+	tenant TEXT NOT NULL,
+	id TEXT NOT NULL,
+	changed_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS changes_changed_at ON changes (changed_at);
+
+CREATE TRIGGER IF NOT EXISTS changes_prune AFTER INSERT ON changes BEGIN
+	DELETE FROM changes WHERE changed_at < datetime('now', '-1 hour');
+END;
+CREATE TRIGGER IF NOT EXISTS tracks_insert AFTER INSERT ON tracks BEGIN
+	INSERT INTO changes (table_name, operation, tenant, id) VALUES ('tracks', 'insert', NEW.tenant, NEW.id);
+END;
+CREATE TRIGGER IF NOT EXISTS tracks_update AFTER UPDATE ON tracks BEGIN
+	INSERT INTO changes (table_name, operation, tenant, id) VALUES ('tracks', 'update', NEW.tenant, NEW.id);
+END;
+CREATE TRIGGER IF NOT EXISTS tracks_delete AFTER DELETE ON tracks BEGIN
+	INSERT INTO changes (table_name, operation, tenant, id) VALUES ('tracks', 'delete', OLD.tenant, OLD.id);
+END;
+CREATE TRIGGER IF NOT EXISTS playlists_insert AFTER INSERT ON playlists BEGIN
+	INSERT INTO changes (table_name, operation, tenant, id) VALUES ('playlists', 'insert', NEW.tenant, NEW.id);
+END;
+CREATE TRIGGER IF NOT EXISTS playlists_update AFTER UPDATE ON playlists BEGIN
+	INSERT INTO changes (table_name, operation, tenant, id) VALUES ('playlists', 'update', NEW.tenant, NEW.id);
+END;
+CREATE TRIGGER IF NOT EXISTS playlists_delete AFTER DELETE ON playlists BEGIN
+	INSERT INTO changes (table_name, operation, tenant, id) VALUES ('playlists', 'delete', OLD.tenant, OLD.id);
+END;
+`
+
+// sqliteDialect is the sqlDialect of SQLite.
+type sqliteDialect struct{}
+
+var numberedPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+func (sqliteDialect) schema() string {
+	return sqliteSchema
+}
+
+// bind rewrites $1 as ?1, which SQLite binds to the same argument.
+func (sqliteDialect) bind(query string) string {
+	return numberedPlaceholder.ReplaceAllString(query, "?$1")
+}
+
+// lock returns nothing, as every transaction holds the database's write lock from when it begins.
+func (sqliteDialect) lock(skipLocked bool) string {
+	return ""
+}
+
+// searchTracks scores each of the tenant's tracks with searchScore, as SQLite's own full text search is not built in.
+func (sqliteDialect) searchTracks(ctx context.Context, db *SQLHandler, tenant string, query string, limit int) ([]bson.M, error) {
+	terms := searchWords(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.query(ctx, db.DB, "SELECT document, name, artist, album, tags FROM tracks WHERE tenant = $1 ORDER BY created_at, id", tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type result struct {
+		doc   bson.M
+		score int
+	}
+	var results []result
+	for rows.Next() {
+		var encoded []byte
+		var name, artist, album, tags string
+		if err := rows.Scan(&encoded, &name, &artist, &album, &tags); err != nil {
+			return nil, err
+		}
+
+		score := searchScore(terms, name, artist, album+" "+tags)
+		if score == 0 {
+			continue
+		}
+
+		var doc bson.M
+		if err := bson.Unmarshal(encoded, &doc); err != nil {
+			return nil, err
+		}
+		results = append(results, result{doc: doc, score: score})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	docs := make([]bson.M, len(results))
+	for i, result := range results {
+		docs[i] = result.doc
+	}
+	return docs, nil
+}
+
+// changes polls the changes table for rows recorded after it started. As the table is written by triggers, changes
+// made by other processes using the same database are seen as well.
+func (sqliteDialect) changes(ctx context.Context, db *SQLHandler, table sqlTable, handle func(change sqlChange) error) error {
+	var last int64
+	if err := db.DB.QueryRowContext(ctx, "SELECT coalesce(max(seq), 0) FROM changes").Scan(&last); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(sqlitePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		changes, err := changesSince(ctx, db, table, &last)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			if err := handle(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// changesSince returns the changes to the table recorded after the sequence number last, moving last on to the
+// latest change to any table.
+func changesSince(ctx context.Context, db *SQLHandler, table sqlTable, last *int64) ([]sqlChange, error) {
+	rows, err := db.query(ctx, db.DB, "SELECT seq, table_name, operation, tenant, id FROM changes WHERE seq > $1 ORDER BY seq", *last)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []sqlChange
+	for rows.Next() {
+		var change sqlChange
+		var hex string
+		if err := rows.Scan(last, &change.Table, &change.Operation, &change.Tenant, &hex); err != nil {
+			return nil, err
+		}
+		if change.Table != table.name {
+			continue
+		}
+		if change.ID, err = primitive.ObjectIDFromHex(hex); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
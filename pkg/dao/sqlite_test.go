@@ -0,0 +1,158 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestSQLiteHandler(t *testing.T) *SQLHandler {
+	dir := t.TempDir()
+	handler, err := NewSQLiteHandler(filepath.Join(dir, "music.db"), filepath.Join(dir, "audio"))
+	require.Nil(t, err)
+	t.Cleanup(func() { handler.DB.Close() })
+	require.Nil(t, handler.EnsureIndexes(context.Background()))
+	return handler
+}
+
+func TestDao_SQLiteHandler_ShouldStoreTracksAndPlaylists(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	ctx := context.Background()
+
+	song := models.Track{ID: primitive.NewObjectID(), Name: "Blue Song", Artist: "Band", Tags: []string{"rock"}}
+	other := models.Track{ID: primitive.NewObjectID(), Name: "Other", Artist: "Blue"}
+	require.Nil(t, handler.AddTrack(ctx, song))
+	require.Nil(t, handler.AddTrack(ctx, other))
+	require.True(t, errors.Is(handler.AddTrack(ctx, song), ErrDuplicate))
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"tags": "rock"})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, song.ID, tracks[0].ID)
+
+	tracks, err = handler.SearchTracks(ctx, "blue", 10)
+	require.Nil(t, err)
+	require.Len(t, tracks, 2)
+	require.Equal(t, song.ID, tracks[0].ID)
+
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "Mix", Tracks: []primitive.ObjectID{song.ID, other.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+	missing := models.Playlist{ID: primitive.NewObjectID(), Tracks: []primitive.ObjectID{primitive.NewObjectID()}}
+	require.True(t, errors.Is(handler.AddPlaylist(ctx, missing), ErrNotFound))
+
+	require.Nil(t, handler.DeleteTrack(ctx, song.ID))
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+	require.Equal(t, []primitive.ObjectID{other.ID}, playlists[0].Tracks)
+	require.Equal(t, int64(1), playlists[0].Revision)
+
+	require.Nil(t, handler.UpdatePlaylist(ctx, playlist.ID, bson.M{"$set": bson.M{"name": "New"}}, 1))
+	require.Equal(t, ErrRevisionMismatch, handler.UpdatePlaylist(ctx, playlist.ID, bson.M{"$set": bson.M{"name": "Old"}}, 1))
+}
+
+func TestDao_SQLiteHandler_ShouldStoreAudioFromStream(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	ctx := context.Background()
+
+	id, err := handler.UploadAudioStream(ctx, strings.NewReader("audio"), "Song")
+	require.Nil(t, err)
+	audio, err := handler.DownloadAudioFile(ctx, id.(primitive.ObjectID))
+	require.Nil(t, err)
+	require.Equal(t, []byte("audio"), audio)
+}
+
+func TestDao_SQLiteHandler_ShouldStoreAudioAndPlays(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	ctx := context.Background()
+
+	id, err := handler.UploadAudioFile(ctx, []byte("audio"), "Song")
+	require.Nil(t, err)
+	audioFileID := id.(primitive.ObjectID)
+	audio, err := handler.DownloadAudioFile(ctx, audioFileID)
+	require.Nil(t, err)
+	require.Equal(t, []byte("audio"), audio)
+
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song", AudioFileID: audioFileID}
+	require.Nil(t, handler.AddTrack(ctx, track))
+	orphaned, err := handler.FindOrphanedAudioFiles(ctx)
+	require.Nil(t, err)
+	require.Empty(t, orphaned)
+
+	playedAt := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	require.Nil(t, handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: track.ID, PlayedAt: playedAt}))
+	require.Nil(t, handler.AddPlay(ctx, models.Play{ID: primitive.NewObjectID(), TrackID: track.ID, PlayedAt: playedAt.Add(-time.Hour)}))
+	counts, err := handler.GetPlayCounts(ctx, playedAt.Add(-time.Hour))
+	require.Nil(t, err)
+	require.Len(t, counts, 1)
+	require.Equal(t, 2, counts[0].Plays)
+	require.True(t, playedAt.Equal(counts[0].LastPlayed))
+
+	require.Nil(t, handler.DeleteTrack(ctx, track.ID))
+	_, err = handler.DownloadAudioFile(ctx, audioFileID)
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestDao_SQLiteHandler_ShouldClaimJobsOnce(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	ctx := context.Background()
+
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "import", Status: models.JobQueued}
+	require.Nil(t, handler.AddJob(ctx, job))
+
+	claimed, err := handler.ClaimJob(ctx, "worker", []string{"import", "transcode"}, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, job.ID, claimed.ID)
+	require.Equal(t, models.JobRunning, claimed.Status)
+
+	_, err = handler.ClaimJob(ctx, "worker", []string{"import"}, time.Minute)
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestDao_SQLiteHandler_ShouldWatchChanges(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changes := make(chan models.TrackChange, 1)
+	go handler.WatchTracks(ctx, func(change models.TrackChange) error {
+		changes <- change
+		return nil
+	})
+	// Give the watcher time to note where the feed starts.
+	time.Sleep(100 * time.Millisecond)
+
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song"}
+	require.Nil(t, handler.AddTrack(ctx, track))
+	require.Nil(t, handler.AddPlaylist(ctx, models.Playlist{ID: primitive.NewObjectID()}))
+
+	select {
+	case change := <-changes:
+		require.Equal(t, "insert", change.Operation)
+		require.Equal(t, track.ID, change.TrackID)
+		require.Equal(t, "Song", change.Track.Name)
+	case <-ctx.Done():
+		t.Fatal("no change seen")
+	}
+}
+
+func TestDao_SQLiteHandler_MovePlaylistTrack_ShouldMoveOrInsertTrack(t *testing.T) {
+	testMovePlaylistTrack(t, newTestSQLiteHandler(t))
+}
+
+func TestDao_SQLiteHandler_RestoreDocument_ShouldKeepIDsAndResolveClashes(t *testing.T) {
+	testRestoreDocument(t, newTestSQLiteHandler(t))
+}
+
+func TestDao_SQLiteHandler_NowPlaying_ShouldKeepLatestStatePerUser(t *testing.T) {
+	testNowPlaying(t, newTestSQLiteHandler(t))
+}
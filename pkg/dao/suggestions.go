@@ -0,0 +1,154 @@
+package dao
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// placeholderNames are the values given to tracks stored without metadata, which are not worth suggesting.
+var placeholderNames = map[string]bool{"unknown": true, "unknown artist": true, "unknown album": true}
+
+// suggestionValues returns the titles, artists and albums a track contributes to search suggestions, by kind.
+func suggestionValues(track models.Track) map[string]string {
+	values := make(map[string]string)
+	for kind, value := range map[string]string{"track": track.Name, "artist": track.Artist, "album": track.AlbumName} {
+		value = strings.TrimSpace(value)
+		if value != "" && !placeholderNames[strings.ToLower(value)] {
+			values[kind] = value
+		}
+	}
+	return values
+}
+
+func suggestionID(kind string, value string) string {
+	return kind + ":" + strings.ToLower(value)
+}
+
+// adjustSuggestions adds the track's values to the suggestions collection, or removes them for a negative delta. Each
+// suggestion counts the tracks it appears on, so it disappears with the last of them and more common values rank
+// first. Suggestions are a convenience, so failures are logged rather than failing the change to the track.
+func (db *DatabaseHandler) adjustSuggestions(ctx context.Context, track models.Track, delta int) {
+	values := suggestionValues(track)
+	if len(values) == 0 {
+		return
+	}
+
+	var writes []mongo.WriteModel
+	var ids []string
+	for kind, value := range values {
+		id := suggestionID(kind, value)
+		ids = append(ids, id)
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{
+				"$inc": bson.M{"count": delta},
+				"$set": bson.M{"kind": kind, "value": value, "normalized": strings.ToLower(value)},
+			}).
+			SetUpsert(true))
+	}
+
+	collection, err := db.getSuggestionCollection(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Error updating search suggestions")
+		return
+	}
+	if _, err := collection.BulkWrite(ctx, writes); err != nil {
+		logrus.WithError(err).Warn("Error updating search suggestions")
+		return
+	}
+	if delta < 0 {
+		if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "count": bson.M{"$lte": 0}}); err != nil {
+			logrus.WithError(err).Warn("Error removing search suggestions")
+		}
+	}
+}
+
+// GetSuggestions returns up to limit titles, artists and albums starting with the prefix, ignoring case, with those on
+// the most tracks first.
+func (db *DatabaseHandler) GetSuggestions(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	ctx, cancel := withTimeout(ctx, db.ReadTimeout)
+	defer cancel()
+
+	filter := bson.M{"normalized": bson.M{"$regex": "^" + regexp.QuoteMeta(strings.ToLower(prefix))}}
+	opts := options.Find().SetSort(bson.D{{Key: "count", Value: -1}, {Key: "normalized", Value: 1}}).SetLimit(int64(limit))
+
+	collection, err := db.getSuggestionCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Suggestion
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// RebuildSuggestions recreates the suggestions collection from the tracks in the library, for libraries that predate
+// it or have drifted.
+func (db *DatabaseHandler) RebuildSuggestions(ctx context.Context) error {
+	opts := options.Find().SetProjection(bson.M{"name": 1, "artist": 1, "album": 1})
+	tracks, err := db.getTrackCollection(ctx)
+	if err != nil {
+		return err
+	}
+	cursor, err := tracks.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	suggestions := make(map[string]*models.Suggestion)
+	for cursor.Next(ctx) {
+		var track models.Track
+		if err := cursor.Decode(&track); err != nil {
+			return err
+		}
+		for kind, value := range suggestionValues(track) {
+			id := suggestionID(kind, value)
+			if suggestions[id] == nil {
+				suggestions[id] = &models.Suggestion{Kind: kind, Value: value}
+			}
+			suggestions[id].Count++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	collection, err := db.getSuggestionCollection(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := collection.DeleteMany(ctx, bson.M{}); err != nil {
+		return err
+	}
+
+	documents := make([]interface{}, 0, len(suggestions))
+	for id, suggestion := range suggestions {
+		documents = append(documents, bson.M{
+			"_id":        id,
+			"kind":       suggestion.Kind,
+			"value":      suggestion.Value,
+			"normalized": strings.ToLower(suggestion.Value),
+			"count":      suggestion.Count,
+		})
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+	_, err = collection.InsertMany(ctx, documents)
+	return err
+}
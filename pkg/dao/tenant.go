@@ -0,0 +1,37 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+type tenantKey struct{}
+
+var validTenant = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,47}$`)
+
+// ErrNoTenant is returned by a handler serving several tenants for an operation on a library made with a context that
+// names no tenant, which would otherwise read or write a library belonging to none of them.
+var ErrNoTenant = errors.New("no tenant in context")
+
+// WithTenant returns a context scoping database operations to the given tenant's library.
+func WithTenant(ctx context.Context, tenant string) (context.Context, error) {
+	if !validTenant.MatchString(tenant) {
+		return ctx, errors.New("invalid tenant name")
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant), nil
+}
+
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// DetachTenant returns a background context carrying the same tenant as ctx, for work that must outlive the request
+// that started it.
+func DetachTenant(ctx context.Context) context.Context {
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		return context.WithValue(context.Background(), tenantKey{}, tenant)
+	}
+	return context.Background()
+}
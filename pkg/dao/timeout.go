@@ -0,0 +1,41 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// withTimeout bounds a database call by the timeout for its class of operation, so that a slow query gives up instead
+// of holding a connection for as long as the caller is prepared to wait. An earlier deadline on the context still
+// applies, and a timeout of 0 or less sets none.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// audioBucket opens the GridFS bucket holding the audio of the tenant in the context. GridFS calls take no context, so
+// the context's deadline, if it has one, is set as the bucket's own.
+func (db *DatabaseHandler) audioBucket(ctx context.Context) (*gridfs.Bucket, error) {
+	database, err := db.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := gridfs.NewBucket(database)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := bucket.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		if err := bucket.SetWriteDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	return bucket, nil
+}
@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDao_WithTimeout_ShouldBoundContextByTimeout(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+}
+
+func TestDao_WithTimeout_ShouldKeepEarlierDeadline(t *testing.T) {
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	expected, _ := parent.Deadline()
+
+	ctx, cancel := withTimeout(parent, time.Minute)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	require.Equal(t, expected, deadline)
+}
+
+func TestDao_WithTimeout_ShouldSetNoDeadlineForZeroTimeout(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), 0)
+	defer cancel()
+
+	_, ok := ctx.Deadline()
+	require.False(t, ok)
+}
@@ -0,0 +1,17 @@
+package dao
+
+import "context"
+
+type userKey struct{}
+
+// WithUser returns a context recording the user on whose behalf database operations are made, so that what they
+// create can be attributed to them.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFromContext returns the user recorded by WithUser, or an empty string if there is none.
+func UserFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey{}).(string)
+	return userID
+}
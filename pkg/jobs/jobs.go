@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultMaxAttempts is how many times a job is tried before it is marked failed, unless it is enqueued with its own
+// limit.
+const DefaultMaxAttempts = 3
+
+// Func runs a job, returning the ids of any tracks it created.
+type Func func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error)
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that retrying will not fix, such as a bad request, so the job fails straight away.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	return errors.As(err, &permanentError{})
+}
+
+type reporterKey struct{}
+
+// reporter records what a running job reports about itself on the job, for clients following it.
+type reporter struct {
+	handler dao.DbHandler
+	id      primitive.ObjectID
+}
+
+func (r reporter) set(ctx context.Context, set bson.M) {
+	if err := r.handler.UpdateJob(ctx, r.id, bson.M{"$set": set}); err != nil && ctx.Err() == nil {
+		logrus.WithError(err).WithField("job", r.id.Hex()).Warn("Error updating job status")
+	}
+}
+
+// ReportQueuePosition records the place of the job running with the context in a queue it is waiting in, such as for
+// an ffmpeg slot, with 0 once it is no longer waiting. Outside a job it does nothing.
+func ReportQueuePosition(ctx context.Context, position int) {
+	if r, ok := ctx.Value(reporterKey{}).(reporter); ok {
+		r.set(ctx, bson.M{"queuePosition": position})
+	}
+}
+
+// ReportProgress records how far along the job running with the context is, as a percentage. Outside a job it does
+// nothing.
+func ReportProgress(ctx context.Context, percent float64) {
+	if r, ok := ctx.Value(reporterKey{}).(reporter); ok {
+		r.set(ctx, bson.M{"progress": percent})
+	}
+}
+
+// Enqueue queues a job of the given kind for the tenant and on behalf of the user in the context, with the payload
+// stored as BSON for the worker to decode.
+func Enqueue(ctx context.Context, handler dao.DbHandler, kind string, payload interface{}) (models.Job, error) {
+	encoded, err := bson.Marshal(payload)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	job := models.Job{
+		ID:          primitive.NewObjectID(),
+		Kind:        kind,
+		Status:      models.JobQueued,
+		Payload:     encoded,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       time.Now(),
+		CreatedBy:   dao.UserFromContext(ctx),
+	}
+	if err := handler.AddJob(ctx, job); err != nil {
+		return models.Job{}, err
+	}
+	job.Tenant = dao.TenantFromContext(ctx)
+	return job, nil
+}
+
+// Worker claims queued jobs of the kinds it has a Func for and runs them one at a time. Any number of workers, in any
+// number of processes, can share a queue. While a job runs its lease is renewed, and failed attempts are retried with
+// exponential backoff starting at Backoff and capped at MaxBackoff. A running job that is cancelled has its context
+// cancelled once the worker next renews the lease, which it does at least every CancelCheck.
+type Worker struct {
+	Handler      dao.DbHandler
+	ID           string
+	Funcs        map[string]Func
+	Lease        time.Duration
+	PollInterval time.Duration
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+	CancelCheck  time.Duration
+}
+
+// Run works through the queue until the context is cancelled, waiting PollInterval whenever it is empty.
+func (w *Worker) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(w.Funcs))
+	for kind := range w.Funcs {
+		kinds = append(kinds, kind)
+	}
+
+	for ctx.Err() == nil {
+		worked, err := w.RunOne(ctx, kinds)
+		if err != nil {
+			logrus.WithError(err).Error("Error claiming job")
+		}
+		if worked {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+// RunOne claims and runs a single job, reporting whether there was one to run.
+func (w *Worker) RunOne(ctx context.Context, kinds []string) (bool, error) {
+	job, err := w.Handler.ClaimJob(ctx, w.ID, kinds, w.Lease)
+	if errors.Is(err, dao.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	jobCtx := ctx
+	if job.Tenant != "" {
+		if jobCtx, err = dao.WithTenant(ctx, job.Tenant); err != nil {
+			w.finish(ctx, job, nil, Permanent(err))
+			return true, nil
+		}
+	}
+	if job.CreatedBy != "" {
+		jobCtx = dao.WithUser(jobCtx, job.CreatedBy)
+	}
+	jobCtx = context.WithValue(jobCtx, reporterKey{}, reporter{handler: w.Handler, id: job.ID})
+	jobCtx, cancel := context.WithCancel(jobCtx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		w.renewLease(jobCtx, cancel, job.ID)
+	}()
+
+	logger := logrus.WithField("job", job.ID.Hex()).WithField("kind", job.Kind)
+	logger.Info("Running job")
+	trackIDs, err := w.Funcs[job.Kind](jobCtx, job)
+	cancel()
+	<-renewed
+
+	if err != nil {
+		logger.WithError(err).Error("Job failed")
+	}
+	w.finish(ctx, job, trackIDs, err)
+	return true, nil
+}
+
+// renewLease extends the lease on a running job until its context is done, cancelling the context if the job is found
+// to have been cancelled.
+func (w *Worker) renewLease(ctx context.Context, cancel context.CancelFunc, id primitive.ObjectID) {
+	interval := w.Lease / 2
+	if w.CancelCheck > 0 && w.CancelCheck < interval {
+		interval = w.CancelCheck
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			update := bson.M{"$set": bson.M{"lockedUntil": time.Now().Add(w.Lease)}}
+			_, err := w.Handler.TransitionJob(ctx, id, []string{models.JobRunning}, update)
+			if errors.Is(err, dao.ErrJobStatus) {
+				logrus.WithField("job", id.Hex()).Info("Job cancelled, stopping it")
+				cancel()
+				return
+			} else if err != nil && ctx.Err() == nil {
+				logrus.WithError(err).WithField("job", id.Hex()).Warn("Error renewing job lease")
+			}
+		}
+	}
+}
+
+// finish records the outcome of an attempt: success, another try after a backoff, or failure once the job is out of
+// attempts or the error is permanent. Tracks created by the attempt are recorded either way, including when the job
+// was cancelled while it ran, which leaves it cancelled.
+func (w *Worker) finish(ctx context.Context, job models.Job, trackIDs []primitive.ObjectID, err error) {
+	now := time.Now()
+	set := bson.M{"lockedUntil": now}
+	if len(trackIDs) > 0 {
+		set["trackIds"] = trackIDs
+	}
+	switch {
+	case err == nil:
+		set["status"] = models.JobSucceeded
+		set["finishedAt"] = now
+	case IsPermanent(err) || job.Attempts >= job.MaxAttempts:
+		set["status"] = models.JobFailed
+		set["error"] = err.Error()
+		set["finishedAt"] = now
+	default:
+		set["status"] = models.JobQueued
+		set["error"] = err.Error()
+		set["runAt"] = now.Add(w.backoff(job.Attempts))
+	}
+
+	_, err = w.Handler.TransitionJob(ctx, job.ID, []string{models.JobRunning}, bson.M{"$set": set, "$unset": bson.M{"lockedBy": "", "queuePosition": ""}})
+	if errors.Is(err, dao.ErrJobStatus) {
+		logrus.WithField("job", job.ID.Hex()).Info("Job was cancelled while running")
+		if len(trackIDs) > 0 {
+			err = w.Handler.UpdateJob(ctx, job.ID, bson.M{"$set": bson.M{"trackIds": trackIDs}})
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("job", job.ID.Hex()).Error("Error recording job outcome")
+	}
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	backoff := w.Backoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if w.MaxBackoff > 0 && backoff >= w.MaxBackoff {
+			return w.MaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testWorker(handler *mocks.DbHandler, fn Func) *Worker {
+	return &Worker{
+		Handler:    handler,
+		ID:         "test",
+		Funcs:      map[string]Func{"test": fn},
+		Lease:      time.Minute,
+		Backoff:    time.Second,
+		MaxBackoff: 4 * time.Second,
+	}
+}
+
+// setOf returns the $set part of an update recorded by the mock.
+func setOf(update bson.M) bson.M {
+	return update["$set"].(bson.M)
+}
+
+func TestWorker_RunOne_ShouldReturnFalseIfQueueIsEmpty(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, "test", []string{"test"}, time.Minute).Return(models.Job{}, dao.ErrNotFound)
+
+	worked, err := testWorker(dbHandler, nil).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	require.False(t, worked)
+}
+
+func TestWorker_RunOne_ShouldRecordTracksOfSuccessfulJob(t *testing.T) {
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "test", Attempts: 1, MaxAttempts: 3}
+	trackID := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("TransitionJob", mock.Anything, job.ID, []string{models.JobRunning}, mock.MatchedBy(func(update bson.M) bool {
+		set := setOf(update)
+		return set["status"] == models.JobSucceeded && set["trackIds"].([]primitive.ObjectID)[0] == trackID
+	})).Return(models.Job{}, nil)
+
+	worked, err := testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		return []primitive.ObjectID{trackID}, nil
+	}).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	require.True(t, worked)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestWorker_RunOne_ShouldRequeueFailedJobWithBackoff(t *testing.T) {
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "test", Attempts: 2, MaxAttempts: 3}
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("TransitionJob", mock.Anything, job.ID, []string{models.JobRunning}, mock.MatchedBy(func(update bson.M) bool {
+		set := setOf(update)
+		delay := time.Until(set["runAt"].(time.Time))
+		return set["status"] == models.JobQueued && set["error"] == "test" && delay > time.Second && delay <= 2*time.Second
+	})).Return(models.Job{}, nil)
+
+	_, err := testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		return nil, errors.New("test")
+	}).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestWorker_RunOne_ShouldFailJobOutOfAttempts(t *testing.T) {
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "test", Attempts: 3, MaxAttempts: 3}
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("TransitionJob", mock.Anything, job.ID, []string{models.JobRunning}, mock.MatchedBy(func(update bson.M) bool {
+		return setOf(update)["status"] == models.JobFailed
+	})).Return(models.Job{}, nil)
+
+	_, err := testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		return nil, errors.New("test")
+	}).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestWorker_RunOne_ShouldFailJobWithPermanentErrorImmediately(t *testing.T) {
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "test", Attempts: 1, MaxAttempts: 3}
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("TransitionJob", mock.Anything, job.ID, []string{models.JobRunning}, mock.MatchedBy(func(update bson.M) bool {
+		return setOf(update)["status"] == models.JobFailed
+	})).Return(models.Job{}, nil)
+
+	_, err := testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		return nil, Permanent(errors.New("test"))
+	}).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestWorker_RunOne_ShouldRunJobInItsTenant(t *testing.T) {
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "test", Tenant: "acme", Attempts: 1, MaxAttempts: 3}
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("TransitionJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(models.Job{}, nil)
+
+	var tenant string
+	_, err := testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		tenant = dao.TenantFromContext(ctx)
+		return nil, nil
+	}).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	require.Equal(t, "acme", tenant)
+}
+
+func TestWorker_RunOne_ShouldRunJobOnBehalfOfItsCreator(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("AddJob", mock.Anything, mock.Anything).Return(nil)
+	job, err := Enqueue(dao.WithUser(context.Background(), "user-1"), dbHandler, "test", bson.M{})
+	require.Nil(t, err)
+	require.Equal(t, "user-1", job.CreatedBy)
+
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("TransitionJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(models.Job{}, nil)
+
+	var user string
+	_, err = testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		user = dao.UserFromContext(ctx)
+		return nil, nil
+	}).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	require.Equal(t, "user-1", user)
+}
+
+func TestWorker_RunOne_ShouldStopCancelledJobAndKeepItCancelled(t *testing.T) {
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "test", Attempts: 1, MaxAttempts: 3}
+	trackID := primitive.NewObjectID()
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("TransitionJob", mock.Anything, job.ID, []string{models.JobRunning}, mock.Anything).Return(models.Job{}, dao.ErrJobStatus)
+	dbHandler.On("UpdateJob", mock.Anything, job.ID, bson.M{"$set": bson.M{"trackIds": []primitive.ObjectID{trackID}}}).Return(nil)
+
+	worker := testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		<-ctx.Done()
+		return []primitive.ObjectID{trackID}, ctx.Err()
+	})
+	worker.CancelCheck = 10 * time.Millisecond
+
+	_, err := worker.RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestWorker_RunOne_ShouldRecordQueuePositionReportedByJob(t *testing.T) {
+	job := models.Job{ID: primitive.NewObjectID(), Kind: "test", Attempts: 1, MaxAttempts: 3}
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(job, nil)
+	dbHandler.On("UpdateJob", mock.Anything, job.ID, bson.M{"$set": bson.M{"queuePosition": 2}}).Return(nil)
+	dbHandler.On("TransitionJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(models.Job{}, nil)
+
+	_, err := testWorker(dbHandler, func(ctx context.Context, job models.Job) ([]primitive.ObjectID, error) {
+		ReportQueuePosition(ctx, 2)
+		return nil, nil
+	}).RunOne(context.Background(), []string{"test"})
+	require.Nil(t, err)
+	dbHandler.AssertExpectations(t)
+}
+
+func TestWorker_Backoff_ShouldDoubleUpToMaximum(t *testing.T) {
+	worker := &Worker{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	require.Equal(t, time.Second, worker.backoff(1))
+	require.Equal(t, 2*time.Second, worker.backoff(2))
+	require.Equal(t, 4*time.Second, worker.backoff(3))
+	require.Equal(t, 5*time.Second, worker.backoff(4))
+}
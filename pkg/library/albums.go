@@ -0,0 +1,97 @@
+package library
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VariousArtists is the album artist of compilations whose tracks do not name one.
+const VariousArtists = "Various Artists"
+
+// AlbumArtist is the artist a track's album is listed under: its album artist if it has one, "Various Artists" if it
+// is from a compilation, and otherwise the track's own artist.
+func AlbumArtist(track models.Track) string {
+	if track.AlbumArtist != "" {
+		return track.AlbumArtist
+	} else if track.IsCompilation {
+		return VariousArtists
+	}
+	return track.Artist
+}
+
+// AlbumID identifies the album of the given artist and name. Case is ignored, so tracks tagged "The Album" and "the
+// album" end up on the same album.
+func AlbumID(artist string, name string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(artist) + "\x00" + strings.ToLower(name)))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Albums groups the tracks of the library into albums by album artist and album name, so that the tracks of a
+// compilation stay on one album rather than making an album for each of their artists. Tracks without an album, and
+// podcast episodes, are left out. Albums are sorted by artist and then name.
+func Albums(ctx context.Context, handler dao.DbHandler) ([]models.Album, error) {
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"podcastId": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	return groupAlbums(tracks), nil
+}
+
+func groupAlbums(tracks []models.Track) []models.Album {
+	albums := make([]models.Album, 0)
+	albumTracks := make(map[string][]models.Track)
+	indexes := make(map[string]int)
+	for _, track := range tracks {
+		if track.AlbumName == "" || track.AlbumName == "Unknown Album" {
+			continue
+		}
+
+		artist := AlbumArtist(track)
+		id := AlbumID(artist, track.AlbumName)
+		i, ok := indexes[id]
+		if !ok {
+			i = len(albums)
+			indexes[id] = i
+			albums = append(albums, models.Album{ID: id, Name: track.AlbumName, Artist: artist})
+		}
+
+		album := &albums[i]
+		album.IsCompilation = album.IsCompilation || track.IsCompilation
+		if album.Year == 0 {
+			album.Year = track.Year
+		}
+		if album.ArtworkURL == "" {
+			album.ArtworkURL = track.ArtworkURL
+		}
+		if album.ArtworkFileID.IsZero() {
+			album.ArtworkFileID = track.ArtworkFileID
+		}
+		albumTracks[id] = append(albumTracks[id], track)
+	}
+
+	for i := range albums {
+		tracks := albumTracks[albums[i].ID]
+		sort.SliceStable(tracks, func(a, b int) bool {
+			return tracks[a].TrackNumber < tracks[b].TrackNumber
+		})
+		for _, track := range tracks {
+			albums[i].Tracks = append(albums[i].Tracks, track.ID)
+		}
+	}
+
+	sort.SliceStable(albums, func(i, j int) bool {
+		if artistI, artistJ := strings.ToLower(albums[i].Artist), strings.ToLower(albums[j].Artist); artistI != artistJ {
+			return artistI < artistJ
+		}
+		return strings.ToLower(albums[i].Name) < strings.ToLower(albums[j].Name)
+	})
+	return albums
+}
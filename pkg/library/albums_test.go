@@ -0,0 +1,64 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLibrary_ApplyTags_ShouldFillInAlbumArtistComposerAndCompilation(t *testing.T) {
+	track := models.Track{AudioInfo: &models.AudioInfo{Tags: map[string]string{
+		"album_artist": "Various Artists",
+		"composer":     "Someone",
+		"compilation":  "1",
+	}}}
+	ApplyTags(&track)
+	require.Equal(t, "Various Artists", track.AlbumArtist)
+	require.Equal(t, "Someone", track.Composer)
+	require.True(t, track.IsCompilation)
+
+	track = models.Track{AlbumArtist: "Given", AudioInfo: &models.AudioInfo{Tags: map[string]string{"albumartist": "Tagged"}}}
+	ApplyTags(&track)
+	require.Equal(t, "Given", track.AlbumArtist)
+	require.False(t, track.IsCompilation)
+}
+
+func TestLibrary_Albums_ShouldGroupCompilationsByAlbumArtist(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	tracks := []models.Track{
+		{Name: "second", Artist: "B", AlbumName: "Hits", IsCompilation: true, TrackNumber: 2},
+		{Name: "first", Artist: "A", AlbumName: "Hits", IsCompilation: true, TrackNumber: 1, Year: 1999},
+		{Name: "solo", Artist: "A", AlbumName: "Debut"},
+		{Name: "guest", Artist: "C feat. A", AlbumArtist: "A", AlbumName: "debut", TrackNumber: 2},
+		{Name: "loose", Artist: "A", AlbumName: "Unknown Album"},
+	}
+	for i := range tracks {
+		tracks[i].ID = primitive.NewObjectID()
+		require.Nil(t, handler.AddTrack(ctx, tracks[i]))
+	}
+
+	albums, err := Albums(ctx, handler)
+	require.Nil(t, err)
+	require.Equal(t, []models.Album{
+		{
+			ID:     AlbumID("A", "Debut"),
+			Name:   "Debut",
+			Artist: "A",
+			Tracks: []primitive.ObjectID{tracks[2].ID, tracks[3].ID},
+		},
+		{
+			ID:            AlbumID(VariousArtists, "Hits"),
+			Name:          "Hits",
+			Artist:        VariousArtists,
+			IsCompilation: true,
+			Year:          1999,
+			Tracks:        []primitive.ObjectID{tracks[1].ID, tracks[0].ID},
+		},
+	}, albums)
+}
@@ -0,0 +1,98 @@
+package library
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+)
+
+// ZipWriter streams a zip archive of tracks' audio to a writer as it is built, so an archive of any size can be sent
+// without being put together in memory or on disk first. Only the audio of the track being added is held at a time.
+// Audio is already compressed, so files are stored rather than deflated, which keeps the CPU cost down and the writer
+// free of compression buffers.
+type ZipWriter struct {
+	handler dao.DbHandler
+	zip     *zip.Writer
+}
+
+// NewZipWriter returns a ZipWriter writing to w, reading audio from handler. The archive is only complete once Close
+// has been called.
+func NewZipWriter(w io.Writer, handler dao.DbHandler) *ZipWriter {
+	return &ZipWriter{handler: handler, zip: zip.NewWriter(w)}
+}
+
+// AddTrack adds the audio of a track to the archive under the given name.
+func (z *ZipWriter) AddTrack(ctx context.Context, name string, track models.Track) error {
+	audio, err := z.handler.DownloadAudioFile(ctx, track.AudioFileID)
+	if err != nil {
+		return fmt.Errorf("error getting audio for track %v: %w", track.ID.Hex(), err)
+	}
+
+	modified := track.UpdatedAt
+	if modified.IsZero() {
+		modified = track.CreatedAt
+	}
+	return z.AddFile(name, audio, modified)
+}
+
+// AddFile adds a file with the given contents to the archive.
+func (z *ZipWriter) AddFile(name string, contents []byte, modified time.Time) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Store, Modified: modified}
+	if modified.IsZero() {
+		header.Modified = time.Now()
+	}
+	file, err := z.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(contents)
+	return err
+}
+
+// AddCover adds cover art to the archive as cover.jpg, cover.png or cover.gif, whichever its contents are.
+func (z *ZipWriter) AddCover(artwork []byte) error {
+	extension := ".jpg"
+	switch http.DetectContentType(artwork) {
+	case "image/png":
+		extension = ".png"
+	case "image/gif":
+		extension = ".gif"
+	}
+	return z.AddFile("cover"+extension, artwork, time.Time{})
+}
+
+// Close finishes the archive by writing its central directory. It does not close the underlying writer.
+func (z *ZipWriter) Close() error {
+	return z.zip.Close()
+}
+
+// TrackFileName names the file of a track in an archive as "NN - Artist - Title.ext", where NN is its number, padded
+// to at least two digits. Characters that are not allowed in file names on common systems are replaced.
+func TrackFileName(number int, track models.Track) string {
+	name := fmt.Sprintf("%02d - %v - %v", number, SanitizeFileName(track.Artist), SanitizeFileName(track.Name))
+	return name + FileExtension(track.Container)
+}
+
+// SanitizeFileName makes a name safe to use as a file name, replacing path separators, characters Windows does not
+// allow in file names and control characters with underscores, and trimming the spaces and dots Windows drops from the
+// end of names.
+func SanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if name == "" {
+		return "Unknown"
+	}
+	return name
+}
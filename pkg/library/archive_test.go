@@ -0,0 +1,28 @@
+package library
+
+import (
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary_TrackFileName_ShouldNumberAndSanitiseName(t *testing.T) {
+	track := models.Track{Name: "What? Now.", Artist: "AC/DC", Container: "flac"}
+	require.Equal(t, "07 - AC_DC - What_ Now.flac", TrackFileName(7, track))
+	require.Equal(t, "123 - Unknown - Unknown.mp3", TrackFileName(123, models.Track{}))
+}
+
+func TestLibrary_SanitizeFileName_ShouldReplaceCharactersNotAllowedInFileNames(t *testing.T) {
+	cases := map[string]string{
+		"plain":         "plain",
+		`a\b:c*d"e<f>|`: "a_b_c_d_e_f__",
+		"tab\there":     "tab_here",
+		" trailing. . ": "trailing",
+		"...":           "Unknown",
+	}
+	for name, expected := range cases {
+		require.Equal(t, expected, SanitizeFileName(name))
+	}
+}
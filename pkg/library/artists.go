@@ -0,0 +1,56 @@
+package library
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TrackArtists returns every artist credited on a track, its primary artist first.
+func TrackArtists(track models.Track) []string {
+	return append([]string{track.Artist}, track.FeaturedArtists...)
+}
+
+// Artists lists the artists of the library, counting the tracks each is the primary artist of and those they are
+// featured on, so that artists who only ever feature on others' tracks are listed too. Artists whose names differ only
+// in case are counted together. Podcast episodes are left out, and artists are sorted by name.
+func Artists(ctx context.Context, handler dao.DbHandler) ([]models.Artist, error) {
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"podcastId": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+
+	artists := make([]models.Artist, 0)
+	indexes := make(map[string]int)
+	for _, track := range tracks {
+		for i, name := range TrackArtists(track) {
+			name = strings.TrimSpace(name)
+			if name == "" || name == "Unknown Artist" {
+				continue
+			}
+
+			key := strings.ToLower(name)
+			index, ok := indexes[key]
+			if !ok {
+				index = len(artists)
+				indexes[key] = index
+				artists = append(artists, models.Artist{Name: name})
+			}
+			if i == 0 {
+				artists[index].Tracks++
+			} else {
+				artists[index].Featured++
+			}
+		}
+	}
+
+	sort.SliceStable(artists, func(i, j int) bool {
+		return strings.ToLower(artists[i].Name) < strings.ToLower(artists[j].Name)
+	})
+	return artists, nil
+}
@@ -0,0 +1,34 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLibrary_Artists_ShouldCountFeaturedArtists(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	for _, track := range []models.Track{
+		{Name: "one", Artist: "B"},
+		{Name: "two", Artist: "B", FeaturedArtists: []string{"a", "C"}},
+		{Name: "three", Artist: "A"},
+		{Name: "four", Artist: "Unknown Artist"},
+	} {
+		track.ID = primitive.NewObjectID()
+		require.Nil(t, handler.AddTrack(ctx, track))
+	}
+
+	artists, err := Artists(ctx, handler)
+	require.Nil(t, err)
+	require.Len(t, artists, 3)
+	require.Equal(t, models.Artist{Name: "B", Tracks: 2}, artists[1])
+	require.Equal(t, models.Artist{Name: "C", Featured: 1}, artists[2])
+	require.Equal(t, 1, artists[0].Tracks)
+	require.Equal(t, 1, artists[0].Featured)
+}
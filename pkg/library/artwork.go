@@ -0,0 +1,135 @@
+package library
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrNotImage is returned for artwork that is not a JPEG, PNG, GIF or WebP image.
+var ErrNotImage = errors.New("artwork is not a supported image")
+
+// ErrArtworkDimensions is returned by NormalizeArtwork for artwork too large to decode safely or too small to be
+// worth showing.
+var ErrArtworkDimensions = errors.New("artwork dimensions are out of range")
+
+// minArtworkSide is the shortest side artwork can have.
+const minArtworkSide = 16
+
+// ResizeArtwork scales artwork down so that neither side is longer than size, averaging the pixels each output pixel
+// covers. Artwork that already fits is returned as it is. JPEGs stay JPEGs, and anything else becomes a PNG so that
+// transparency is kept.
+func ResizeArtwork(artwork []byte, size int) ([]byte, error) {
+	img, format, err := image.Decode(bytes.NewReader(artwork))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return artwork, nil
+	}
+
+	newWidth, newHeight := size, size
+	if width > height {
+		newHeight = height * size / width
+	} else {
+		newWidth = width * size / height
+	}
+	if newWidth < 1 {
+		newWidth = 1
+	}
+	if newHeight < 1 {
+		newHeight = 1
+	}
+
+	resized := scaleImage(img, bounds, newWidth, newHeight)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, resized)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NormalizeArtwork turns uploaded artwork into a square JPEG of size pixels a side, cropping it to its centre square
+// and scaling it, up or down, to fit. Only the pixels are kept, so EXIF and any other metadata, such as the location a
+// photo was taken at, is dropped. Artwork with a side longer than maxSide, or shorter than 16 pixels, is rejected with
+// ErrArtworkDimensions before it is decoded, so that a small file claiming huge dimensions cannot exhaust memory.
+func NormalizeArtwork(artwork []byte, size int, maxSide int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(artwork))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	if config.Width > maxSide || config.Height > maxSide || config.Width < minArtworkSide || config.Height < minArtworkSide {
+		return nil, fmt.Errorf("%w: %vx%v, sides must be between %v and %v pixels", ErrArtworkDimensions,
+			config.Width, config.Height, minArtworkSide, maxSide)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(artwork))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	left, top := bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2
+	square := image.Rect(left, top, left+side, top+side)
+
+	// JPEG has no transparency, so transparent artwork is laid over white rather than black.
+	flattened := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(flattened, flattened.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flattened, flattened.Bounds(), scaleImage(img, square, size, size), image.Point{}, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flattened, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleImage scales the part of img within bounds to newWidth by newHeight pixels. Each output pixel is the average of
+// the pixels it covers, or when scaling up, the pixel it falls on.
+func scaleImage(img image.Image, bounds image.Rectangle, newWidth int, newHeight int) *image.RGBA64 {
+	width, height := bounds.Dx(), bounds.Dy()
+	scaled := image.NewRGBA64(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		top, bottom := bounds.Min.Y+y*height/newHeight, bounds.Min.Y+(y+1)*height/newHeight
+		if bottom == top {
+			bottom = top + 1
+		}
+		for x := 0; x < newWidth; x++ {
+			left, right := bounds.Min.X+x*width/newWidth, bounds.Min.X+(x+1)*width/newWidth
+			if right == left {
+				right = left + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			scaled.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return scaled
+}
@@ -0,0 +1,98 @@
+package library
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testArtwork(t *testing.T, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.Nil(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestLibrary_ResizeArtwork_ShouldKeepAspectRatio(t *testing.T) {
+	resized, err := ResizeArtwork(testArtwork(t, 600, 300), 64)
+	require.Nil(t, err)
+
+	img, format, err := image.Decode(bytes.NewReader(resized))
+	require.Nil(t, err)
+	require.Equal(t, "png", format)
+	require.Equal(t, image.Rect(0, 0, 64, 32), img.Bounds())
+	r, _, _, a := img.At(10, 10).RGBA()
+	require.Equal(t, uint32(200), r>>8)
+	require.Equal(t, uint32(255), a>>8)
+}
+
+func TestLibrary_ResizeArtwork_ShouldReturnSmallArtworkUnchanged(t *testing.T) {
+	artwork := testArtwork(t, 48, 48)
+	resized, err := ResizeArtwork(artwork, 64)
+	require.Nil(t, err)
+	require.Equal(t, artwork, resized)
+}
+
+func TestLibrary_ResizeArtwork_ShouldRejectNonImages(t *testing.T) {
+	_, err := ResizeArtwork([]byte("<html></html>"), 64)
+	require.Equal(t, ErrNotImage, err)
+}
+
+func TestLibrary_NormalizeArtwork_ShouldCropToCentredSquareJPEG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			c := color.RGBA{B: 200, A: 255}
+			if x >= 100 && x < 200 {
+				c = color.RGBA{R: 200, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	require.Nil(t, png.Encode(&buf, img))
+
+	normalized, err := NormalizeArtwork(buf.Bytes(), 50, 1000)
+	require.Nil(t, err)
+
+	decoded, format, err := image.Decode(bytes.NewReader(normalized))
+	require.Nil(t, err)
+	require.Equal(t, "jpeg", format)
+	require.Equal(t, image.Rect(0, 0, 50, 50), decoded.Bounds())
+	for _, point := range []image.Point{{2, 2}, {47, 47}} {
+		r, _, b, _ := decoded.At(point.X, point.Y).RGBA()
+		require.InDelta(t, 200, r>>8, 10)
+		require.InDelta(t, 0, b>>8, 10)
+	}
+}
+
+func TestLibrary_NormalizeArtwork_ShouldScaleUpSmallArtwork(t *testing.T) {
+	normalized, err := NormalizeArtwork(testArtwork(t, 20, 20), 100, 1000)
+	require.Nil(t, err)
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(normalized))
+	require.Nil(t, err)
+	require.Equal(t, 100, config.Width)
+	require.Equal(t, 100, config.Height)
+}
+
+func TestLibrary_NormalizeArtwork_ShouldRejectArtworkOutOfRange(t *testing.T) {
+	_, err := NormalizeArtwork(testArtwork(t, 400, 20), 100, 300)
+	require.True(t, errors.Is(err, ErrArtworkDimensions))
+
+	_, err = NormalizeArtwork(testArtwork(t, 8, 8), 100, 300)
+	require.True(t, errors.Is(err, ErrArtworkDimensions))
+
+	_, err = NormalizeArtwork([]byte("<html></html>"), 100, 300)
+	require.Equal(t, ErrNotImage, err)
+}
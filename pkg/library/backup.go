@@ -0,0 +1,260 @@
+package library
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BackupFormat is the version of the layout WriteBackup writes, recorded in the backup's header.
+const BackupFormat = 1
+
+// The sections a backup can be made of. Those holding documents are named after the collection they are restored into.
+// Audio is every file a track uses other than its previous versions, which are the versions section.
+const (
+	BackupTracks    = dao.CollectionTracks
+	BackupPlaylists = dao.CollectionPlaylists
+	BackupPodcasts  = dao.CollectionPodcasts
+	BackupShares    = dao.CollectionShares
+	BackupAPIKeys   = dao.CollectionAPIKeys
+	BackupAudio     = "audio"
+	BackupVersions  = "versions"
+)
+
+// BackupSections are all the sections of a backup, in the order they are written.
+var BackupSections = []string{BackupTracks, BackupPlaylists, BackupPodcasts, BackupShares, BackupAPIKeys, BackupAudio, BackupVersions}
+
+const backupHeaderName = "backup.json"
+
+// BackupHeader is the first entry of a backup, saying what it holds. Since is set on an incremental backup, holding
+// only what changed after it.
+type BackupHeader struct {
+	Format    int            `json:"format"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Since     *time.Time     `json:"since,omitempty"`
+	Sections  []string       `json:"sections"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// SelectBackupSections returns the sections to back up: those included, or all of them if none are, less those
+// excluded.
+func SelectBackupSections(include []string, exclude []string) ([]string, error) {
+	known := make(map[string]bool, len(BackupSections))
+	for _, section := range BackupSections {
+		known[section] = true
+	}
+
+	selected := make(map[string]bool)
+	for _, section := range include {
+		if !known[section] {
+			return nil, fmt.Errorf("unknown backup section %q", section)
+		}
+		selected[section] = true
+	}
+	if len(include) == 0 {
+		selected = known
+	}
+	for _, section := range exclude {
+		if !known[section] {
+			return nil, fmt.Errorf("unknown backup section %q", section)
+		}
+		delete(selected, section)
+	}
+
+	var sections []string
+	for _, section := range BackupSections {
+		if selected[section] {
+			sections = append(sections, section)
+		}
+	}
+	if len(sections) == 0 {
+		return nil, errors.New("no backup sections selected")
+	}
+	return sections, nil
+}
+
+// WriteBackup streams a tar archive of the library to w: a backup.json header, then a <section>.jsonl file for each
+// collection backed up, with a document per line as MongoDB Extended JSON so that every stored field and type is kept,
+// then each audio file as audio/<fileID>. Only the audio of the file being written is held at a time. Referenced audio
+// that is missing from the store is logged and left out.
+func WriteBackup(ctx context.Context, handler dao.DbHandler, w io.Writer, sections []string) (BackupHeader, error) {
+	return writeBackup(ctx, handler, w, sections, time.Time{})
+}
+
+// WriteBackupSince writes an incremental backup in the layout of WriteBackup, holding the tracks and playlists updated
+// at or after since and the audio of those tracks, along with every podcast, share and API key, which record no update
+// time. Deletions are not recorded.
+func WriteBackupSince(ctx context.Context, handler dao.DbHandler, w io.Writer, sections []string, since time.Time) (BackupHeader, error) {
+	return writeBackup(ctx, handler, w, sections, since)
+}
+
+func writeBackup(ctx context.Context, handler dao.DbHandler, w io.Writer, sections []string, since time.Time) (BackupHeader, error) {
+	header := BackupHeader{Format: BackupFormat, CreatedAt: time.Now().UTC(), Sections: sections, Counts: make(map[string]int)}
+	changed := map[string]interface{}{}
+	if !since.IsZero() {
+		since = since.UTC()
+		header.Since = &since
+		changed = map[string]interface{}{"updatedAt": map[string]interface{}{"$gte": since}}
+	}
+	included := make(map[string]bool, len(sections))
+	for _, section := range sections {
+		included[section] = true
+	}
+
+	documents := make(map[string][]interface{})
+	var tracks []models.Track
+	if included[BackupTracks] || included[BackupAudio] || included[BackupVersions] {
+		var err error
+		if tracks, err = handler.GetTracks(ctx, changed); err != nil {
+			return header, err
+		}
+		if included[BackupTracks] {
+			for _, track := range tracks {
+				documents[BackupTracks] = append(documents[BackupTracks], track)
+			}
+		}
+	}
+	if included[BackupPlaylists] {
+		playlists, err := handler.GetPlaylists(ctx, changed)
+		if err != nil {
+			return header, err
+		}
+		for _, playlist := range playlists {
+			documents[BackupPlaylists] = append(documents[BackupPlaylists], playlist)
+		}
+	}
+	if included[BackupPodcasts] {
+		podcasts, err := handler.GetPodcasts(ctx, map[string]interface{}{})
+		if err != nil {
+			return header, err
+		}
+		for _, podcast := range podcasts {
+			documents[BackupPodcasts] = append(documents[BackupPodcasts], podcast)
+		}
+	}
+	if included[BackupShares] {
+		shares, err := handler.GetShares(ctx, map[string]interface{}{})
+		if err != nil {
+			return header, err
+		}
+		for _, share := range shares {
+			documents[BackupShares] = append(documents[BackupShares], share)
+		}
+	}
+	if included[BackupAPIKeys] {
+		keys, err := handler.GetAPIKeys(ctx, map[string]interface{}{})
+		if err != nil {
+			return header, err
+		}
+		for _, key := range keys {
+			documents[BackupAPIKeys] = append(documents[BackupAPIKeys], key)
+		}
+	}
+	files := BackupFiles(tracks, included[BackupAudio], included[BackupVersions])
+
+	for section, docs := range documents {
+		header.Counts[section] = len(docs)
+	}
+	header.Counts[BackupAudio] = len(files)
+
+	archive := tar.NewWriter(w)
+	body, err := json.MarshalIndent(header, "", "  ")
+	if err != nil {
+		return header, err
+	}
+	if err := writeTarFile(archive, backupHeaderName, body, header.CreatedAt); err != nil {
+		return header, err
+	}
+
+	for _, section := range BackupSections {
+		docs, ok := documents[section]
+		if !ok {
+			continue
+		}
+
+		var lines bytes.Buffer
+		for _, doc := range docs {
+			line, err := bson.MarshalExtJSON(doc, true, false)
+			if err != nil {
+				return header, err
+			}
+			lines.Write(line)
+			lines.WriteByte('\n')
+		}
+		if err := writeTarFile(archive, section+".jsonl", lines.Bytes(), header.CreatedAt); err != nil {
+			return header, err
+		}
+	}
+
+	for _, id := range files {
+		audio, err := handler.DownloadAudioFile(ctx, id)
+		if errors.Is(err, dao.ErrNotFound) {
+			logrus.WithField("file", id.Hex()).Warn("Audio file missing from store, leaving it out of the backup")
+			continue
+		} else if err != nil {
+			return header, fmt.Errorf("error getting audio file %v: %w", id.Hex(), err)
+		}
+		if err := writeTarFile(archive, "audio/"+id.Hex(), audio, id.Timestamp()); err != nil {
+			return header, err
+		}
+	}
+	return header, archive.Close()
+}
+
+// BackupFiles lists the files used by the tracks, each once: their audio, originals, variants and artwork if audio is
+// set, and their previous versions if versions is.
+func BackupFiles(tracks []models.Track, audio bool, versions bool) []primitive.ObjectID {
+	var files []primitive.ObjectID
+	seen := make(map[primitive.ObjectID]bool)
+	add := func(id primitive.ObjectID) {
+		if !id.IsZero() && !seen[id] {
+			seen[id] = true
+			files = append(files, id)
+		}
+	}
+
+	for _, track := range tracks {
+		if audio {
+			add(track.AudioFileID)
+			add(track.ArtworkFileID)
+			if track.Original != nil {
+				add(track.Original.AudioFileID)
+			}
+			for _, variant := range track.Variants {
+				add(variant.AudioFileID)
+			}
+		}
+		if versions {
+			for _, version := range track.Versions {
+				add(version.AudioFileID)
+			}
+		}
+	}
+	return files
+}
+
+func writeTarFile(archive *tar.Writer, name string, contents []byte, modified time.Time) error {
+	if err := archive.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(contents)),
+		ModTime:  modified,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err := archive.Write(contents)
+	return err
+}
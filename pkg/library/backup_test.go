@@ -0,0 +1,95 @@
+package library
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// readTar returns the contents of each file in a tar archive, by name, in the order of the archive.
+func readTar(t *testing.T, archive []byte) ([]string, map[string][]byte) {
+	var names []string
+	files := make(map[string][]byte)
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return names, files
+		}
+		require.Nil(t, err)
+		contents, err := ioutil.ReadAll(reader)
+		require.Nil(t, err)
+		names = append(names, header.Name)
+		files[header.Name] = contents
+	}
+}
+
+func TestLibrary_SelectBackupSections_ShouldApplyIncludeAndExclude(t *testing.T) {
+	sections, err := SelectBackupSections(nil, []string{BackupVersions, BackupAPIKeys})
+	require.Nil(t, err)
+	require.Equal(t, []string{BackupTracks, BackupPlaylists, BackupPodcasts, BackupShares, BackupAudio}, sections)
+
+	sections, err = SelectBackupSections([]string{BackupAudio, BackupTracks}, nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{BackupTracks, BackupAudio}, sections)
+
+	_, err = SelectBackupSections([]string{"users"}, nil)
+	require.NotNil(t, err)
+	_, err = SelectBackupSections([]string{BackupTracks}, []string{BackupTracks})
+	require.NotNil(t, err)
+}
+
+func TestLibrary_WriteBackup_ShouldArchiveDocumentsAndAudio(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := StoreTrack(ctx, handler, models.Track{Name: "test", Fingerprint: []uint32{1, 2}}, testAudio)
+	require.Nil(t, err)
+	require.Nil(t, handler.AddPlaylist(ctx, models.Playlist{ID: primitive.NewObjectID(), Name: "test", Tracks: []primitive.ObjectID{track.ID}}))
+
+	var archive bytes.Buffer
+	header, err := WriteBackup(ctx, handler, &archive, []string{BackupTracks, BackupPlaylists, BackupAudio})
+	require.Nil(t, err)
+	require.Equal(t, map[string]int{BackupTracks: 1, BackupPlaylists: 1, BackupAudio: 1}, header.Counts)
+
+	names, files := readTar(t, archive.Bytes())
+	require.Equal(t, []string{"backup.json", "tracks.jsonl", "playlists.jsonl", "audio/" + track.AudioFileID.Hex()}, names)
+	require.Equal(t, testAudio, files["audio/"+track.AudioFileID.Hex()])
+
+	var written BackupHeader
+	require.Nil(t, json.Unmarshal(files["backup.json"], &written))
+	require.Equal(t, BackupFormat, written.Format)
+	// Fields hidden from the API, such as fingerprints, are kept.
+	require.Contains(t, string(files["tracks.jsonl"]), `"fingerprint"`)
+	require.Contains(t, string(files["tracks.jsonl"]), `{"$oid":"`+track.ID.Hex()+`"}`)
+}
+
+func TestLibrary_WriteBackupSince_ShouldOnlyHoldTracksChangedSince(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	old := models.Track{ID: primitive.NewObjectID(), Name: "old"}
+	require.Nil(t, handler.RestoreDocument(ctx, dao.CollectionTracks, models.Track{ID: old.ID, Name: "old", UpdatedAt: time.Now().Add(-time.Hour)}, false))
+	since := time.Now().Add(-time.Minute)
+	track, err := StoreTrack(ctx, handler, models.Track{ID: primitive.NewObjectID(), Name: "new"}, testAudio)
+	require.Nil(t, err)
+
+	var archive bytes.Buffer
+	header, err := WriteBackupSince(ctx, handler, &archive, []string{BackupTracks, BackupAudio}, since)
+	require.Nil(t, err)
+	require.Equal(t, since.UTC(), *header.Since)
+	require.Equal(t, map[string]int{BackupTracks: 1, BackupAudio: 1}, header.Counts)
+
+	_, files := readTar(t, archive.Bytes())
+	require.Contains(t, string(files["tracks.jsonl"]), track.ID.Hex())
+	require.NotContains(t, string(files["tracks.jsonl"]), old.ID.Hex())
+}
@@ -0,0 +1,62 @@
+package library
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"music-stream-api/pkg/models"
+)
+
+// DefaultFilenamePattern matches file names such as "Artist - Title.mp3" and "03 - Artist - Title.flac".
+const DefaultFilenamePattern = `^(?:(?P<track>\d{1,3})\s*(?:[-.]\s*|\s))?(?P<artist>.+?)\s+-\s+(?P<title>.+)$`
+
+// FilenameParser fills in the details of an uploaded track missing from its tags and the request from the name of the
+// file it was uploaded as, using a regular expression with groups named artist, title and track. The file's extension
+// is removed before it is matched.
+type FilenameParser struct {
+	pattern *regexp.Regexp
+}
+
+// NewFilenameParser returns a FilenameParser matching file names against pattern, which must have a group named title
+// or artist.
+func NewFilenameParser(pattern string) (*FilenameParser, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if compiled.SubexpIndex("title") < 0 && compiled.SubexpIndex("artist") < 0 {
+		return nil, errors.New("file name pattern has no group named title or artist")
+	}
+	return &FilenameParser{pattern: compiled}, nil
+}
+
+// Apply sets the name, artist and track number of a track from the file name, where they are not set already. File
+// names the pattern does not match are left alone.
+func (p *FilenameParser) Apply(track *models.Track, fileName string) {
+	base := path.Base(strings.ReplaceAll(fileName, `\`, "/"))
+	base = strings.TrimSuffix(base, path.Ext(base))
+
+	match := p.pattern.FindStringSubmatch(base)
+	if match == nil {
+		return
+	}
+	group := func(name string) string {
+		if i := p.pattern.SubexpIndex(name); i >= 0 {
+			return strings.TrimSpace(strings.ReplaceAll(match[i], "_", " "))
+		}
+		return ""
+	}
+
+	if track.Name == "" {
+		track.Name = group("title")
+	}
+	if track.Artist == "" {
+		track.Artist = group("artist")
+	}
+	if track.TrackNumber == 0 {
+		track.TrackNumber, _ = strconv.Atoi(group("track"))
+	}
+}
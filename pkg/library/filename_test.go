@@ -0,0 +1,44 @@
+package library
+
+import (
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary_FilenameParser_ShouldInferDetailsFromFileName(t *testing.T) {
+	parser, err := NewFilenameParser(DefaultFilenamePattern)
+	require.Nil(t, err)
+
+	cases := map[string]models.Track{
+		"Artist - Title.mp3":                 {Name: "Title", Artist: "Artist"},
+		"03 - The Band - Song - Live.flac":   {Name: "Song - Live", Artist: "The Band", TrackNumber: 3},
+		"12. Someone - Something.ogg":        {Name: "Something", Artist: "Someone", TrackNumber: 12},
+		`C:\music\Some_Artist - A_Title.wav`: {Name: "A Title", Artist: "Some Artist"},
+		"recording.mp3":                      {},
+	}
+	for fileName, expected := range cases {
+		var track models.Track
+		parser.Apply(&track, fileName)
+		require.Equal(t, expected, track, fileName)
+	}
+}
+
+func TestLibrary_FilenameParser_ShouldKeepDetailsAlreadySet(t *testing.T) {
+	parser, err := NewFilenameParser(DefaultFilenamePattern)
+	require.Nil(t, err)
+
+	track := models.Track{Name: "Tagged", TrackNumber: 7}
+	parser.Apply(&track, "01 - Artist - Title.mp3")
+	require.Equal(t, models.Track{Name: "Tagged", Artist: "Artist", TrackNumber: 7}, track)
+}
+
+func TestLibrary_NewFilenameParser_ShouldRejectPatternWithoutGroups(t *testing.T) {
+	_, err := NewFilenameParser(`^(.+) - (.+)$`)
+	require.NotNil(t, err)
+
+	_, err = NewFilenameParser(`(`)
+	require.NotNil(t, err)
+}
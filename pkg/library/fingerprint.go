@@ -0,0 +1,69 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"sort"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MinMatchScore is the similarity above which two fingerprints are taken to be the same recording. Unrelated audio
+// scores around 0.5, while re-encodes of the same audio typically score above 0.85.
+const MinMatchScore = 0.75
+
+// minClipLength is the fewest sub-fingerprints, roughly two seconds of audio, that can be matched reliably.
+const minClipLength = 16
+
+var ErrClipTooShort = errors.New("clip is too short to identify")
+
+// FingerprintSimilarity scores how alike two raw fingerprints sound, as the fraction of bits they share. The shorter
+// fingerprint is slid along the longer one and the best alignment counts, so a clip matches the track it was cut from.
+func FingerprintSimilarity(a, b []uint32) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return 0
+	}
+
+	best := 0
+	for offset := 0; offset <= len(b)-len(a); offset++ {
+		matching := 0
+		for i, x := range a {
+			matching += 32 - bits.OnesCount32(x^b[offset+i])
+		}
+		if matching > best {
+			best = matching
+		}
+	}
+	return float64(best) / float64(32*len(a))
+}
+
+// IdentifyTracks finds the tracks whose fingerprint matches the clip, best match first.
+func IdentifyTracks(ctx context.Context, handler dao.DbHandler, clip []uint32) ([]models.TrackMatch, error) {
+	if len(clip) < minClipLength {
+		return nil, ErrClipTooShort
+	}
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"fingerprint": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []models.TrackMatch{}
+	for _, track := range tracks {
+		if score := FingerprintSimilarity(clip, track.Fingerprint); score >= MinMatchScore {
+			matches = append(matches, models.TrackMatch{Track: track, Score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches, nil
+}
@@ -0,0 +1,79 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testFingerprint(seed uint32, length int) []uint32 {
+	fingerprint := make([]uint32, length)
+	for i := range fingerprint {
+		seed = seed*1664525 + 1013904223
+		fingerprint[i] = seed
+	}
+	return fingerprint
+}
+
+func TestLibrary_FingerprintSimilarity_ShouldFindClipWithinTrack(t *testing.T) {
+	track := testFingerprint(1, 200)
+
+	require.Equal(t, 1.0, FingerprintSimilarity(track[50:90], track))
+	require.Equal(t, 1.0, FingerprintSimilarity(track, track[50:90]))
+}
+
+func TestLibrary_FingerprintSimilarity_ShouldScoreUnrelatedAudioLow(t *testing.T) {
+	require.Less(t, FingerprintSimilarity(testFingerprint(1, 40), testFingerprint(2, 200)), MinMatchScore)
+}
+
+func TestLibrary_FingerprintSimilarity_ShouldToleratePerturbedBits(t *testing.T) {
+	track := testFingerprint(1, 200)
+	clip := append([]uint32{}, track[20:60]...)
+	for i := range clip {
+		clip[i] ^= 0x80000101
+	}
+
+	require.InDelta(t, 29.0/32.0, FingerprintSimilarity(clip, track), 0.0001)
+}
+
+func TestLibrary_IdentifyTracks_ShouldReturnErrorIfClipIsTooShort(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	_, err := IdentifyTracks(context.Background(), dbHandler, testFingerprint(1, minClipLength-1))
+	require.Equal(t, ErrClipTooShort, err)
+}
+
+func TestLibrary_IdentifyTracks_ShouldReturnErrorIfGetTracksErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	_, err := IdentifyTracks(context.Background(), dbHandler, testFingerprint(1, 40))
+	require.NotNil(t, err)
+}
+
+func TestLibrary_IdentifyTracks_ShouldReturnMatchingTracksBestFirst(t *testing.T) {
+	original := testFingerprint(1, 200)
+	reencoded := append([]uint32{}, original...)
+	for i := range reencoded {
+		reencoded[i] ^= 0x10000001
+	}
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{
+		{Name: "reencoded", Fingerprint: reencoded},
+		{Name: "unrelated", Fingerprint: testFingerprint(2, 200)},
+		{Name: "original", Fingerprint: original},
+	}, nil)
+
+	matches, err := IdentifyTracks(context.Background(), dbHandler, original[100:140])
+	require.Nil(t, err)
+	require.Len(t, matches, 2)
+	require.Equal(t, "original", matches[0].Track.Name)
+	require.Equal(t, "reencoded", matches[1].Track.Name)
+}
@@ -0,0 +1,107 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var ErrNotAudio = errors.New("file is not a supported audio format")
+
+// DetectFormat identifies the container and codec of an audio file from its leading bytes. It returns ErrNotAudio for
+// anything it does not recognise as audio.
+func DetectFormat(audio []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(audio, []byte("ID3")):
+		return "mp3", "mp3", nil
+	case bytes.HasPrefix(audio, []byte("fLaC")):
+		return "flac", "flac", nil
+	case len(audio) >= 12 && bytes.Equal(audio[:4], []byte("RIFF")) && bytes.Equal(audio[8:12], []byte("WAVE")):
+		return "wav", wavCodec(audio), nil
+	case bytes.HasPrefix(audio, []byte("OggS")):
+		return "ogg", oggCodec(audio), nil
+	case len(audio) >= 12 && bytes.Equal(audio[4:8], []byte("ftyp")):
+		return "mp4", "aac", nil
+	case bytes.HasPrefix(audio, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return "webm", "opus", nil
+	case len(audio) >= 2 && audio[0] == 0xff && audio[1]&0xf6 == 0xf0:
+		return "adts", "aac", nil
+	case len(audio) >= 2 && audio[0] == 0xff && audio[1]&0xe0 == 0xe0 && audio[1]&0x06 != 0:
+		return "mp3", "mp3", nil
+	}
+	return "", "", ErrNotAudio
+}
+
+func oggCodec(audio []byte) string {
+	header := audio
+	if len(header) > 128 {
+		header = header[:128]
+	}
+
+	switch {
+	case bytes.Contains(header, []byte("OpusHead")):
+		return "opus"
+	case bytes.Contains(header, []byte("\x01vorbis")):
+		return "vorbis"
+	case bytes.Contains(header, []byte("\x7fFLAC")):
+		return "flac"
+	}
+	return "unknown"
+}
+
+func wavCodec(audio []byte) string {
+	// The fmt chunk normally directly follows the RIFF header, with the format tag as its first field.
+	if len(audio) < 22 || !bytes.Equal(audio[12:16], []byte("fmt ")) {
+		return "unknown"
+	}
+
+	switch binary.LittleEndian.Uint16(audio[20:22]) {
+	case 1:
+		return "pcm"
+	case 3:
+		return "pcm_float"
+	case 85:
+		return "mp3"
+	}
+	return "unknown"
+}
+
+// containerMIMETypes are the media types of the containers DetectFormat reports.
+var containerMIMETypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"ogg":  "audio/ogg",
+	"mp4":  "audio/mp4",
+	"webm": "audio/webm",
+	"adts": "audio/aac",
+}
+
+// MIMEType returns the media type of audio in a container DetectFormat reports, or audio/mpeg when the container is not
+// known, as for tracks stored before it was recorded.
+func MIMEType(container string) string {
+	if mimeType, ok := containerMIMETypes[container]; ok {
+		return mimeType
+	}
+	return "audio/mpeg"
+}
+
+// containerExtensions are the file extensions of the containers DetectFormat reports.
+var containerExtensions = map[string]string{
+	"mp3":  ".mp3",
+	"flac": ".flac",
+	"wav":  ".wav",
+	"ogg":  ".ogg",
+	"mp4":  ".m4a",
+	"webm": ".webm",
+	"adts": ".aac",
+}
+
+// FileExtension returns the file extension, with its dot, for audio in a container DetectFormat reports, or .mp3 when
+// the container is not known.
+func FileExtension(container string) string {
+	if extension, ok := containerExtensions[container]; ok {
+		return extension
+	}
+	return ".mp3"
+}
@@ -0,0 +1,33 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary_DetectFormat_ShouldRecogniseAudioFormats(t *testing.T) {
+	cases := map[string][2]string{
+		"ID3\x04\x00":          {"mp3", "mp3"},
+		"\xff\xfb\x90\x00":     {"mp3", "mp3"},
+		"fLaC\x00\x00\x00\x22": {"flac", "flac"},
+		"OggS\x00\x02" + "\x00\x00\x00\x00OpusHead":            {"ogg", "opus"},
+		"OggS\x00\x02" + "\x00\x00\x00\x00\x01vorbis":          {"ogg", "vorbis"},
+		"RIFF\x24\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00": {"wav", "pcm"},
+		"\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00":             {"mp4", "aac"},
+	}
+
+	for header, expected := range cases {
+		container, codec, err := DetectFormat([]byte(header))
+		require.Nil(t, err)
+		require.Equal(t, expected[0], container)
+		require.Equal(t, expected[1], codec)
+	}
+}
+
+func TestLibrary_DetectFormat_ShouldReturnErrorForNonAudio(t *testing.T) {
+	for _, data := range []string{"", "test", "<html></html>", "\x89PNG\r\n\x1a\n"} {
+		_, _, err := DetectFormat([]byte(data))
+		require.Equal(t, ErrNotAudio, err)
+	}
+}
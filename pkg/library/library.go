@@ -0,0 +1,101 @@
+package library
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+)
+
+var ErrInvalidAudioID = errors.New("invalid audioID received from handler")
+
+// ApplyDefaults fills in placeholder values for any metadata a track was stored without.
+func ApplyDefaults(track *models.Track) {
+	if track.Name == "" {
+		track.Name = "Unknown"
+	}
+	if track.Artist == "" {
+		track.Artist = "Unknown Artist"
+	}
+	if track.AlbumName == "" {
+		track.AlbumName = "Unknown Album"
+	}
+}
+
+// ApplyTags fills in the album artist, composer and compilation flag of a track from the tags embedded in its audio,
+// where they were not given with the track. Tags are named differently by each format: ID3 and MP4 tags are reported by
+// ffprobe as album_artist, Vorbis comments as albumartist or "album artist", and the compilation flag (TCMP or cpil) as
+// compilation.
+func ApplyTags(track *models.Track) {
+	if track.AudioInfo == nil {
+		return
+	}
+	tags := track.AudioInfo.Tags
+
+	if track.AlbumArtist == "" {
+		for _, key := range []string{"album_artist", "albumartist", "album artist"} {
+			if value := strings.TrimSpace(tags[key]); value != "" {
+				track.AlbumArtist = value
+				break
+			}
+		}
+	}
+	if track.Composer == "" {
+		track.Composer = strings.TrimSpace(tags["composer"])
+	}
+	if compilation := strings.TrimSpace(tags["compilation"]); compilation == "1" || strings.EqualFold(compilation, "true") {
+		track.IsCompilation = true
+	}
+}
+
+// Checksum returns the hex SHA-256 of audio, as kept in a track's Checksum.
+func Checksum(audio []byte) string {
+	sum := sha256.Sum256(audio)
+	return hex.EncodeToString(sum[:])
+}
+
+// StoreTrack uploads the audio for a track and then adds the track, referencing the uploaded file, to the library,
+// returning the track as stored. The track's checksum is taken from the audio unless it has one. It is attributed to
+// the context's dao user, if it has one. It returns ErrNotAudio without storing anything if the audio is not in a
+// recognised format.
+func StoreTrack(ctx context.Context, handler dao.DbHandler, track models.Track, audio []byte) (models.Track, error) {
+	return storeTrack(ctx, handler, track, audioSource{data: audio})
+}
+
+func storeTrack(ctx context.Context, handler dao.DbHandler, track models.Track, audio audioSource) (models.Track, error) {
+	container, codec, err := audio.format()
+	if err != nil {
+		return track, err
+	}
+	track.Container, track.Codec = container, codec
+	if track.Checksum == "" {
+		if track.Checksum, err = audio.checksum(); err != nil {
+			return track, err
+		}
+	}
+
+	fileID, err := audio.upload(ctx, handler, track.Name)
+	if err != nil {
+		return track, err
+	}
+	track.AudioFileID = fileID
+
+	if user := dao.UserFromContext(ctx); user != "" {
+		track.UploadedBy = user
+	}
+	now := time.Now()
+	if track.CreatedAt.IsZero() {
+		track.CreatedAt = now
+	}
+	track.UpdatedAt = now
+
+	if err := handler.AddTrack(ctx, track); err != nil {
+		return track, err
+	}
+	return track, nil
+}
@@ -0,0 +1,227 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testAudio is the start of an mp3 file, enough to pass format detection.
+var testAudio = []byte("ID3\x04\x00\x00\x00\x00\x00\x00")
+
+func TestLibrary_StoreTrack_ShouldReturnErrorIfAudioIsNotRecognised(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+
+	_, err := StoreTrack(context.Background(), dbHandler, models.Track{}, []byte("test"))
+	require.Equal(t, ErrNotAudio, err)
+	dbHandler.AssertNotCalled(t, "UploadAudioFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestLibrary_StoreTrack_ShouldReturnErrorIfAudioIDIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return("test", nil)
+
+	_, err := StoreTrack(context.Background(), dbHandler, models.Track{}, testAudio)
+	require.Equal(t, ErrInvalidAudioID, err)
+}
+
+func TestLibrary_StoreTrack_ShouldAddTrackReferencingUploadedAudio(t *testing.T) {
+	audioID := primitive.NewObjectID()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(audioID, nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.AudioFileID == audioID && track.Container == "mp3" && track.Codec == "mp3"
+	})).Return(nil)
+
+	track, err := StoreTrack(context.Background(), dbHandler, models.Track{}, testAudio)
+	require.Nil(t, err)
+	require.Equal(t, audioID, track.AudioFileID)
+}
+
+func TestLibrary_StoreTrack_ShouldAttributeTrackToUserInContext(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.Anything).Return(nil)
+
+	track, err := StoreTrack(dao.WithUser(context.Background(), "user-1"), dbHandler, models.Track{UploadedBy: "someone-else"}, testAudio)
+	require.Nil(t, err)
+	require.Equal(t, "user-1", track.UploadedBy)
+
+	// Tracks stored outside a request, such as on import from an export, keep who they were uploaded by.
+	track, err = StoreTrack(context.Background(), dbHandler, models.Track{UploadedBy: "someone-else"}, testAudio)
+	require.Nil(t, err)
+	require.Equal(t, "someone-else", track.UploadedBy)
+}
+
+func TestLibrary_ImportDirectory_ShouldOnlyImportAudioFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "song.mp3"), testAudio, 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "other.FLAC"), []byte("fLaC\x00\x00\x00\x22"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("test"), 0644))
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, "song").Return(primitive.NewObjectID(), nil)
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, "other").Return(primitive.NewObjectID(), nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(nil, nil)
+
+	report, err := ImportDirectory(context.Background(), dbHandler, dir, nil)
+	require.Nil(t, err)
+	require.Equal(t, models.DirectoryImportReport{Imported: 2}, report)
+}
+
+type tagProber map[string]string
+
+func (p tagProber) Validate(ctx context.Context, audio io.Reader) (*models.AudioInfo, error) {
+	if len(p) == 0 {
+		return nil, errors.New("invalid audio")
+	}
+	return &models.AudioInfo{Tags: p}, nil
+}
+
+func TestLibrary_ImportDirectory_ShouldNameTracksFromTagsAndSkipFilesAlreadyImported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "album"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "album", "01.mp3"), testAudio, 0644))
+
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	prober := tagProber{"title": "Song", "artist": "Artist", "album": "Album", "track": "3/12", "date": "2001-05-04"}
+
+	report, err := ImportDirectory(ctx, handler, dir, prober)
+	require.Nil(t, err)
+	require.Equal(t, models.DirectoryImportReport{Imported: 1}, report)
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, "Song", tracks[0].Name)
+	require.Equal(t, "Artist", tracks[0].Artist)
+	require.Equal(t, "Album", tracks[0].AlbumName)
+	require.Equal(t, 3, tracks[0].TrackNumber)
+	require.Equal(t, 2001, tracks[0].Year)
+	require.Equal(t, Checksum(testAudio), tracks[0].Checksum)
+
+	// A copy of the file is skipped by its checksum, and a file that cannot be probed is reported.
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "copy.mp3"), testAudio, 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "broken.mp3"), append(testAudio, 0), 0644))
+	report, err = ImportDirectory(ctx, handler, dir, tagProber{})
+	require.Nil(t, err)
+	require.Equal(t, 2, report.Duplicates)
+	require.Equal(t, 0, report.Imported)
+	require.Equal(t, []models.DirectoryImportFailure{{File: "broken.mp3", Error: "invalid audio"}}, report.Failed)
+}
+
+func TestLibrary_ExportImport_ShouldRoundTripLibrary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	track := models.Track{ID: primitive.NewObjectID(), Name: "test", AudioFileID: primitive.NewObjectID()}
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Tracks: []primitive.ObjectID{track.ID}}
+
+	source := &mocks.DbHandler{}
+	source.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{track}, nil)
+	source.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{playlist}, nil)
+	source.On("DownloadAudioFile", mock.Anything, track.AudioFileID).Return(testAudio, nil)
+
+	_, err = Export(context.Background(), source, dir)
+	require.Nil(t, err)
+
+	target := &mocks.DbHandler{}
+	target.On("GetTracks", mock.Anything, mock.Anything).Return([]models.Track{}, nil)
+	target.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{}, nil)
+	target.On("UploadAudioFile", mock.Anything, testAudio, "test").Return(primitive.NewObjectID(), nil)
+	target.On("AddTrack", mock.Anything, mock.Anything).Return(nil)
+	target.On("AddPlaylist", mock.Anything, playlist).Return(nil)
+
+	tracks, playlists, err := Import(context.Background(), target, dir)
+	require.Nil(t, err)
+	require.Equal(t, 1, tracks)
+	require.Equal(t, 1, playlists)
+}
+
+func TestLibrary_PurgeOrphans_ShouldNotDeleteOnDryRun(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("FindOrphanedAudioFiles", mock.Anything).Return([]primitive.ObjectID{primitive.NewObjectID()}, nil)
+
+	orphans, err := PurgeOrphans(context.Background(), dbHandler, true, 0)
+	require.Nil(t, err)
+	require.Len(t, orphans, 1)
+	dbHandler.AssertNotCalled(t, "DeleteAudioFile", mock.Anything, mock.Anything)
+}
+
+func TestLibrary_PurgeOrphans_ShouldReturnErrorIfDeleteFails(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("FindOrphanedAudioFiles", mock.Anything).Return([]primitive.ObjectID{primitive.NewObjectID()}, nil)
+	dbHandler.On("DeleteAudioFile", mock.Anything, mock.Anything).Return(errors.New("test"))
+
+	_, err := PurgeOrphans(context.Background(), dbHandler, false, 0)
+	require.NotNil(t, err)
+}
+
+func TestLibrary_PurgeOrphans_ShouldLeaveRecentlyStoredFiles(t *testing.T) {
+	old := primitive.NewObjectIDFromTimestamp(time.Now().Add(-2 * time.Hour))
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("FindOrphanedAudioFiles", mock.Anything).Return([]primitive.ObjectID{old, primitive.NewObjectID()}, nil)
+	dbHandler.On("DeleteAudioFile", mock.Anything, old).Return(nil)
+
+	orphans, err := PurgeOrphans(context.Background(), dbHandler, false, time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, []primitive.ObjectID{old}, orphans)
+	dbHandler.AssertNumberOfCalls(t, "DeleteAudioFile", 1)
+}
+
+func TestLibrary_ReplaceAudio_ShouldDeleteVersionsBeyondRetention(t *testing.T) {
+	oldest := primitive.NewObjectID()
+	track := models.Track{
+		AudioFileID: primitive.NewObjectID(),
+		Versions:    []models.AudioVersion{{AudioFileID: primitive.NewObjectID()}, {AudioFileID: oldest}},
+	}
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, mock.Anything, mock.Anything).Return(primitive.NewObjectID(), nil)
+	dbHandler.On("SetTrackAudio", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	dbHandler.On("DeleteAudioFile", mock.Anything, oldest).Return(nil)
+
+	updated, err := ReplaceAudio(context.Background(), dbHandler, track, testAudio, nil, nil, 2)
+	require.Nil(t, err)
+	require.Len(t, updated.Versions, 2)
+	require.Equal(t, track.AudioFileID, updated.Versions[0].AudioFileID)
+	dbHandler.AssertCalled(t, "DeleteAudioFile", mock.Anything, oldest)
+}
+
+func TestLibrary_RestoreVersion_ShouldSwapCurrentAudioIntoVersions(t *testing.T) {
+	version := primitive.NewObjectID()
+	track := models.Track{AudioFileID: primitive.NewObjectID(), Versions: []models.AudioVersion{{AudioFileID: version}}}
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("SetTrackAudio", mock.Anything, mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.AudioFileID == version
+	})).Return(nil)
+
+	updated, err := RestoreVersion(context.Background(), dbHandler, track, version, 0)
+	require.Nil(t, err)
+	require.Equal(t, version, updated.AudioFileID)
+	require.Len(t, updated.Versions, 1)
+	require.Equal(t, track.AudioFileID, updated.Versions[0].AudioFileID)
+}
@@ -0,0 +1,127 @@
+package library
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"music-stream-api/pkg/models"
+)
+
+// MinNameSimilarity is how alike, from 0 to 1, the normalised title and an artist of a library track must be to those
+// of an entry of another service's playlist for the track to be taken as the entry. It allows for small differences in
+// spelling and punctuation, but not for a different song by the same artist.
+const MinNameSimilarity = 0.8
+
+// versionNoise matches the version details services add to titles but libraries often leave out, such as
+// " - Remastered 2011" or " (feat. Someone)".
+var versionNoise = regexp.MustCompile(`(?i)\s+-\s+.*(remaster|version|edit|mix|mono|stereo|live|single).*$|\s*[(\[][^)\]]*[)\]]`)
+
+// MatchTracks finds the library track that each entry of another service's playlist is, comparing titles and artists
+// loosely, as the same song is rarely named exactly alike by two sources. It returns the tracks matched, in the order of
+// the entries, and the entries no track matched. Where several tracks match an entry, the most alike wins.
+func MatchTracks(tracks []models.Track, entries []models.ExternalTrack) ([]models.Track, []models.ExternalTrack) {
+	// Artists are compared once per entry rather than once per track, and titles only for tracks by artists that match.
+	artists := make([][]string, len(tracks))
+	titles := make([]string, len(tracks))
+	distinct := make(map[string]bool)
+	for i, track := range tracks {
+		for _, artist := range TrackArtists(track) {
+			if key := normalizeName(artist); key != "" {
+				artists[i] = append(artists[i], key)
+				distinct[key] = true
+			}
+		}
+		titles[i] = normalizeName(versionNoise.ReplaceAllString(track.Name, ""))
+	}
+
+	matched := make([]models.Track, 0, len(entries))
+	unmatched := make([]models.ExternalTrack, 0)
+	for _, entry := range entries {
+		artistScores := make(map[string]float64)
+		for key := range distinct {
+			for _, name := range entry.Artists {
+				if score := similarity(key, normalizeName(name)); score >= MinNameSimilarity && score > artistScores[key] {
+					artistScores[key] = score
+				}
+			}
+		}
+		title := normalizeName(versionNoise.ReplaceAllString(entry.Name, ""))
+
+		best, bestScore := -1, 0.0
+		for i := range tracks {
+			artistScore := 0.0
+			for _, key := range artists[i] {
+				if artistScores[key] > artistScore {
+					artistScore = artistScores[key]
+				}
+			}
+			if artistScore == 0 {
+				continue
+			}
+			if titleScore := similarity(title, titles[i]); titleScore >= MinNameSimilarity && titleScore+artistScore > bestScore {
+				best, bestScore = i, titleScore+artistScore
+			}
+		}
+
+		if best < 0 {
+			unmatched = append(unmatched, entry)
+		} else {
+			matched = append(matched, tracks[best])
+		}
+	}
+	return matched, unmatched
+}
+
+// normalizeName reduces a title or artist to lower-case words separated by single spaces, without punctuation or a
+// leading "the".
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(strings.ReplaceAll(name, "&", " and ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+	for i, word := range words {
+		words[i] = strings.ReplaceAll(word, "'", "")
+	}
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// similarity scores how alike two strings are, from 0 for nothing in common to 1 for equal, as one less the edit
+// distance between them over the length of the longer.
+func similarity(a string, b string) float64 {
+	ar, br := []rune(a), []rune(b)
+	longest := len(ar)
+	if len(br) > longest {
+		longest = len(br)
+	}
+	if longest == 0 {
+		return 0
+	}
+
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(br)])/float64(longest)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
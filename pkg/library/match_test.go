@@ -0,0 +1,37 @@
+package library
+
+import (
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLibrary_MatchTracks_ShouldMatchLooselyByTitleAndArtist(t *testing.T) {
+	tracks := []models.Track{
+		{ID: primitive.NewObjectID(), Name: "Dont Stop Me Now", Artist: "Queen"},
+		{ID: primitive.NewObjectID(), Name: "Under Pressure", Artist: "Queen", FeaturedArtists: []string{"David Bowie"}},
+		{ID: primitive.NewObjectID(), Name: "Paint It Black", Artist: "The Rolling Stones"},
+		{ID: primitive.NewObjectID(), Name: "Paint It, Black", Artist: "Rolling Stones Tribute Band"},
+	}
+	entries := []models.ExternalTrack{
+		{Position: 1, Name: "Don't Stop Me Now - Remastered 2011", Artists: []string{"Queen"}},
+		{Position: 2, Name: "Under Pressure", Artists: []string{"David Bowie"}},
+		{Position: 3, Name: "Paint It, Black", Artists: []string{"Rolling Stones"}},
+		{Position: 4, Name: "Bohemian Rhapsody", Artists: []string{"Queen"}},
+		{Position: 5, Name: "Dont Stop Me Now", Artists: []string{"Someone Else"}},
+	}
+
+	matched, unmatched := MatchTracks(tracks, entries)
+	require.Equal(t, []models.Track{tracks[0], tracks[1], tracks[2]}, matched)
+	require.Equal(t, []models.ExternalTrack{entries[3], entries[4]}, unmatched)
+}
+
+func TestLibrary_NormalizeName_ShouldDropPunctuationAndLeadingThe(t *testing.T) {
+	require.Equal(t, "rolling stones", normalizeName("The Rolling Stones"))
+	require.Equal(t, "simon and garfunkel", normalizeName("Simon & Garfunkel"))
+	require.Equal(t, "dont stop me now", normalizeName("Don't  Stop Me Now!"))
+	require.Equal(t, "the", normalizeName("The"))
+}
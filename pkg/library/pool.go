@@ -0,0 +1,139 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolFull is returned by FFmpegPool.Acquire when the queue for a slot is already as long as it may get.
+var ErrPoolFull = errors.New("too many conversions are waiting, try again later")
+
+// FFmpegPool limits how many ffmpeg processes run at once, so that a burst of conversions queues up instead of
+// saturating the CPU and disk. Callers waiting for a slot are served in the order they arrived. A nil pool places no
+// limit.
+type FFmpegPool struct {
+	maxQueued int
+
+	mu      sync.Mutex
+	free    int
+	waiting []*poolWaiter
+}
+
+type poolWaiter struct {
+	ready chan struct{}
+	moved chan struct{}
+}
+
+// NewFFmpegPool returns a pool running at most maxParallel processes, with at most maxQueued callers waiting for one
+// to finish. A maxQueued of 0 or less lets any number wait.
+func NewFFmpegPool(maxParallel int, maxQueued int) *FFmpegPool {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	return &FFmpegPool{free: maxParallel, maxQueued: maxQueued}
+}
+
+// Acquire waits for a slot and returns the function that gives it back, which must be called once the caller's
+// ffmpeg work is done. While the caller waits, queued is told its place in the queue, starting at 1 for the next in
+// line, whenever that changes; queued may be nil. It returns ErrPoolFull without waiting if the queue is full, and the
+// context's error if the context is done first.
+func (p *FFmpegPool) Acquire(ctx context.Context, queued func(position int)) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+
+	p.mu.Lock()
+	if p.free > 0 && len(p.waiting) == 0 {
+		p.free--
+		p.mu.Unlock()
+		return p.releaser(), nil
+	}
+	if p.maxQueued > 0 && len(p.waiting) >= p.maxQueued {
+		p.mu.Unlock()
+		return nil, ErrPoolFull
+	}
+	waiter := &poolWaiter{ready: make(chan struct{}), moved: make(chan struct{}, 1)}
+	p.waiting = append(p.waiting, waiter)
+	position := len(p.waiting)
+	p.mu.Unlock()
+
+	for {
+		if queued != nil && position > 0 {
+			queued(position)
+		}
+
+		select {
+		case <-waiter.ready:
+			return p.releaser(), nil
+		case <-waiter.moved:
+			p.mu.Lock()
+			position = p.position(waiter)
+			p.mu.Unlock()
+		case <-ctx.Done():
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			select {
+			case <-waiter.ready:
+				// The slot was handed over just as the context ended, so it goes to the next in line instead.
+				p.releaseLocked()
+			default:
+				p.remove(waiter)
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// releaser returns the function giving back a slot, which does nothing if called again.
+func (p *FFmpegPool) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.releaseLocked()
+		})
+	}
+}
+
+// releaseLocked hands a freed slot straight to the first waiter, if there is one.
+func (p *FFmpegPool) releaseLocked() {
+	if len(p.waiting) == 0 {
+		p.free++
+		return
+	}
+	next := p.waiting[0]
+	p.waiting = p.waiting[1:]
+	close(next.ready)
+	p.notifyMoved(0)
+}
+
+func (p *FFmpegPool) remove(waiter *poolWaiter) {
+	for i, w := range p.waiting {
+		if w == waiter {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			p.notifyMoved(i)
+			return
+		}
+	}
+}
+
+// notifyMoved tells the waiters from index i on that they have moved up the queue.
+func (p *FFmpegPool) notifyMoved(i int) {
+	for _, w := range p.waiting[i:] {
+		select {
+		case w.moved <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *FFmpegPool) position(waiter *poolWaiter) int {
+	for i, w := range p.waiting {
+		if w == waiter {
+			return i + 1
+		}
+	}
+	return 0
+}
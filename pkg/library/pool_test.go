@@ -0,0 +1,79 @@
+package library
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary_FFmpegPool_ShouldQueueCallersBeyondTheLimitInOrder(t *testing.T) {
+	pool := NewFFmpegPool(1, 0)
+	release, err := pool.Acquire(context.Background(), nil)
+	require.Nil(t, err)
+
+	positions := make(chan int, 10)
+	acquired := make(chan string, 2)
+	done := make(chan struct{})
+	for _, name := range []string{"first", "second"} {
+		name := name
+		queued := make(chan struct{})
+		var once sync.Once
+		go func() {
+			next, err := pool.Acquire(context.Background(), func(position int) {
+				positions <- position
+				once.Do(func() { close(queued) })
+			})
+			require.Nil(t, err)
+			acquired <- name
+			<-done
+			next()
+		}()
+		<-queued
+	}
+	require.Equal(t, 1, <-positions)
+	require.Equal(t, 2, <-positions)
+
+	release()
+	require.Equal(t, "first", <-acquired)
+	// The second caller moved up to first in line when the first got the slot.
+	require.Equal(t, 1, <-positions)
+
+	close(done)
+	require.Equal(t, "second", <-acquired)
+}
+
+func TestLibrary_FFmpegPool_ShouldRejectCallersOnceTheQueueIsFull(t *testing.T) {
+	pool := NewFFmpegPool(1, 1)
+	release, err := pool.Acquire(context.Background(), nil)
+	require.Nil(t, err)
+	defer release()
+
+	queued := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.Acquire(ctx, func(int) { close(queued) })
+	<-queued
+
+	_, err = pool.Acquire(context.Background(), nil)
+	require.Equal(t, ErrPoolFull, err)
+}
+
+func TestLibrary_FFmpegPool_ShouldStopWaitingWhenContextEnds(t *testing.T) {
+	pool := NewFFmpegPool(1, 0)
+	release, err := pool.Acquire(context.Background(), nil)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.Acquire(ctx, nil)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// The abandoned place in the queue does not hold up the slot once it is free.
+	release()
+	next, err := pool.Acquire(context.Background(), nil)
+	require.Nil(t, err)
+	next()
+}
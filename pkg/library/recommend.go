@@ -0,0 +1,152 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// favoriteCount is how many of the most played tracks are treated as favorites when looking for tracks that share
+// playlists with them.
+const favoriteCount = 10
+
+// Recommend suggests tracks from listening history since the given time: tracks by the artists and with the tags that
+// get played most, and tracks that share playlists with the most played ones. Each signal is divided by how often the
+// track has itself been played, so under-played tracks rise to the top and favorites are not recommended back. Plays
+// count towards featured artists as well as primary ones.
+func Recommend(ctx context.Context, handler dao.DbHandler, since time.Time, limit int) ([]models.Recommendation, error) {
+	counts, err := handler.GetPlayCounts(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return []models.Recommendation{}, nil
+	}
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"podcastId": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+
+	plays := make(map[primitive.ObjectID]int, len(counts))
+	for _, count := range counts {
+		plays[count.TrackID] = count.Plays
+	}
+
+	artistPlays := make(map[string]int)
+	tagPlays := make(map[string]int)
+	var played []models.Track
+	for _, track := range tracks {
+		if n := plays[track.ID]; n > 0 {
+			for _, artist := range TrackArtists(track) {
+				artistPlays[artist] += n
+			}
+			for _, tag := range track.Tags {
+				tagPlays[tag] += n
+			}
+			played = append(played, track)
+		}
+	}
+	delete(artistPlays, "Unknown Artist")
+
+	sort.SliceStable(played, func(i, j int) bool {
+		return plays[played[i].ID] > plays[played[j].ID]
+	})
+	if len(played) > favoriteCount {
+		played = played[:favoriteCount]
+	}
+	favorites := make(map[primitive.ObjectID]bool, len(played))
+	for _, track := range played {
+		favorites[track.ID] = true
+	}
+
+	companions, err := playlistCompanions(ctx, handler, favorites)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPlays := 0
+	for _, count := range counts {
+		totalPlays += count.Plays
+	}
+
+	var recommendations []models.Recommendation
+	for _, track := range tracks {
+		if favorites[track.ID] {
+			continue
+		}
+
+		var score float64
+		var reasons []string
+		for _, artist := range TrackArtists(track) {
+			if n := artistPlays[artist]; n > 0 {
+				score += float64(n) / float64(totalPlays)
+				reasons = append(reasons, fmt.Sprintf("You often play %v", artist))
+			}
+		}
+		for _, tag := range track.Tags {
+			if n := tagPlays[tag]; n > 0 {
+				score += float64(n) / float64(totalPlays) / 2
+				reasons = append(reasons, fmt.Sprintf("Tagged %v, like tracks you play", tag))
+			}
+		}
+		if n := companions[track.ID]; n > 0 {
+			score += float64(n) / float64(len(favorites))
+			reasons = append(reasons, "Shares playlists with your favorites")
+		}
+		if score == 0 {
+			continue
+		}
+
+		recommendations = append(recommendations, models.Recommendation{
+			Track:   track,
+			Score:   score / float64(1+plays[track.ID]),
+			Reasons: reasons,
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+	if limit > 0 && len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	if recommendations == nil {
+		recommendations = []models.Recommendation{}
+	}
+	return recommendations, nil
+}
+
+// playlistCompanions counts, for every track, how many favorites it shares a playlist with.
+func playlistCompanions(ctx context.Context, handler dao.DbHandler, favorites map[primitive.ObjectID]bool) (map[primitive.ObjectID]int, error) {
+	ids := make([]primitive.ObjectID, 0, len(favorites))
+	for id := range favorites {
+		ids = append(ids, id)
+	}
+
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"tracks": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	companions := make(map[primitive.ObjectID]int)
+	for _, playlist := range playlists {
+		shared := 0
+		for _, id := range playlist.Tracks {
+			if favorites[id] {
+				shared++
+			}
+		}
+		for _, id := range playlist.Tracks {
+			companions[id] += shared
+		}
+	}
+	return companions, nil
+}
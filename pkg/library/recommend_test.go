@@ -0,0 +1,80 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLibrary_Recommend_ShouldReturnErrorIfGetPlayCountsErrors(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlayCounts", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+
+	_, err := Recommend(context.Background(), dbHandler, time.Time{}, 10)
+	require.NotNil(t, err)
+}
+
+func TestLibrary_Recommend_ShouldReturnNothingWithoutHistory(t *testing.T) {
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlayCounts", mock.Anything, mock.Anything).Return([]models.PlayCount{}, nil)
+
+	recommendations, err := Recommend(context.Background(), dbHandler, time.Time{}, 10)
+	require.Nil(t, err)
+	require.Empty(t, recommendations)
+	dbHandler.AssertNotCalled(t, "GetTracks", mock.Anything, mock.Anything)
+}
+
+func TestLibrary_Recommend_ShouldFavorUnderPlayedTracksRelatedToFavorites(t *testing.T) {
+	favorite := models.Track{ID: primitive.NewObjectID(), Name: "favorite", Artist: "A", Tags: []string{"workout"}}
+	sameArtistPlayed := models.Track{ID: primitive.NewObjectID(), Name: "same artist, played", Artist: "A"}
+	sameArtistUnplayed := models.Track{ID: primitive.NewObjectID(), Name: "same artist, unplayed", Artist: "A"}
+	sameTag := models.Track{ID: primitive.NewObjectID(), Name: "same tag", Artist: "B", Tags: []string{"workout"}}
+	sharedPlaylist := models.Track{ID: primitive.NewObjectID(), Name: "shared playlist", Artist: "C"}
+	unrelated := models.Track{ID: primitive.NewObjectID(), Name: "unrelated", Artist: "D"}
+
+	tracks := []models.Track{favorite, sameArtistPlayed, sameArtistUnplayed, sameTag, sharedPlaylist, unrelated}
+	counts := []models.PlayCount{{TrackID: favorite.ID, Plays: 20}, {TrackID: sameArtistPlayed.ID, Plays: 1}}
+	for i := 1; i < favoriteCount; i++ {
+		other := models.Track{ID: primitive.NewObjectID(), Artist: "E"}
+		tracks = append(tracks, other)
+		counts = append(counts, models.PlayCount{TrackID: other.ID, Plays: 5})
+	}
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("GetPlayCounts", mock.Anything, mock.Anything).Return(counts, nil)
+	dbHandler.On("GetTracks", mock.Anything, mock.Anything).Return(tracks, nil)
+	dbHandler.On("GetPlaylists", mock.Anything, mock.Anything).Return([]models.Playlist{
+		{Tracks: []primitive.ObjectID{favorite.ID, sharedPlaylist.ID}},
+	}, nil)
+
+	recommendations, err := Recommend(context.Background(), dbHandler, time.Time{}, 10)
+	require.Nil(t, err)
+
+	var names []string
+	for _, recommendation := range recommendations {
+		names = append(names, recommendation.Track.Name)
+		require.NotEmpty(t, recommendation.Reasons)
+	}
+	require.NotContains(t, names, "favorite")
+	require.NotContains(t, names, "unrelated")
+	require.Contains(t, names, "same tag")
+	require.Contains(t, names, "shared playlist")
+
+	indexOf := func(name string) int {
+		for i, n := range names {
+			if n == name {
+				return i
+			}
+		}
+		return -1
+	}
+	require.Less(t, indexOf("same artist, unplayed"), indexOf("same artist, played"))
+}
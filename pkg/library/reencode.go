@@ -0,0 +1,142 @@
+package library
+
+import (
+	"context"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NeedsReencode reports whether a track matches a re-encode's filter and is not already in the shape it asks for:
+// audio in the target format at no more than the target's bit rate, or a variant of the quality the target encoded. A
+// filter on bit rate only matches tracks whose audio info has been probed.
+func NeedsReencode(track models.Track, request models.ReencodeRequest, target *Transcoder) bool {
+	filter := request.Filter
+	if filter.BitRateAbove > 0 && (track.AudioInfo == nil || track.AudioInfo.BitRate <= filter.BitRateAbove) {
+		return false
+	}
+	if len(filter.Codecs) > 0 && !containsString(filter.Codecs, track.Codec) {
+		return false
+	}
+	if filter.Tag != "" && !containsString(track.Tags, filter.Tag) {
+		return false
+	}
+
+	if request.Quality != "" {
+		for _, variant := range track.Variants {
+			if variant.Quality == request.Quality {
+				return target.Needed(variant.Container, variant.Codec) || variant.BitRate != target.BitRate()
+			}
+		}
+		return true
+	}
+	if target.Needed(track.Container, track.Codec) {
+		return true
+	}
+	// Variable bit rate encoders land near the target rather than on it, so audio a little over it is left alone
+	// rather than encoded again every time.
+	return track.AudioInfo != nil && track.AudioInfo.BitRate > target.BitRate()*11/10
+}
+
+// EstimateReencode works out how much space a re-encode of the tracks would save, from the bit rate and duration of
+// their audio.
+func EstimateReencode(tracks []models.Track, request models.ReencodeRequest, target *Transcoder) models.ReencodeEstimate {
+	var estimate models.ReencodeEstimate
+	for _, track := range tracks {
+		if track.AudioInfo == nil {
+			if request.Filter.BitRateAbove > 0 || NeedsReencode(track, request, target) {
+				estimate.Unprobed++
+			}
+			continue
+		}
+		if !NeedsReencode(track, request, target) {
+			continue
+		}
+
+		estimate.Tracks++
+		estimate.ReencodedBytes += int64(float64(target.BitRate()) * track.AudioInfo.Duration / 8)
+		if request.Quality == "" {
+			estimate.CurrentBytes += int64(float64(track.AudioInfo.BitRate) * track.AudioInfo.Duration / 8)
+		}
+	}
+	estimate.SavedBytes = estimate.CurrentBytes - estimate.ReencodedBytes
+	return estimate
+}
+
+// ReplaceWithReencoded makes audio re-encoded by the target the track's audio, with the given info, and deletes the
+// audio it replaces to free its space. Unlike ReplaceAudio the replaced audio is not kept as a version, and the
+// original and variants are kept, as the recording is the same.
+func ReplaceWithReencoded(ctx context.Context, handler dao.DbHandler, track models.Track, audio []byte, target *Transcoder, info *models.AudioInfo) (models.Track, error) {
+	fileID, err := uploadAudio(ctx, handler, audio, track.Name)
+	if err != nil {
+		return track, err
+	}
+
+	replaced := track.AudioFileID
+	track.AudioFileID, track.Container, track.Codec = fileID, target.Format.Container, target.Format.Codec
+	track.AudioInfo = info
+	if err := handler.SetTrackAudio(ctx, track.ID, track); err != nil {
+		deleteAudioFile(ctx, handler, fileID, "Error deleting audio for failed re-encode")
+		return track, err
+	}
+
+	deleteAudioFile(ctx, handler, replaced, "Error deleting re-encoded audio")
+	return track, nil
+}
+
+// StoreVariant stores audio re-encoded by the target as the track's variant of the given quality, deleting any variant
+// of that quality it replaces.
+func StoreVariant(ctx context.Context, handler dao.DbHandler, track models.Track, quality string, audio []byte, target *Transcoder) (models.Track, error) {
+	fileID, err := uploadAudio(ctx, handler, audio, track.Name)
+	if err != nil {
+		return track, err
+	}
+
+	variant := models.AudioVariant{
+		Quality:     quality,
+		AudioFileID: fileID,
+		Container:   target.Format.Container,
+		Codec:       target.Format.Codec,
+		BitRate:     target.BitRate(),
+	}
+	var replaced []models.AudioVariant
+	variants := make([]models.AudioVariant, 0, len(track.Variants)+1)
+	for _, existing := range track.Variants {
+		if existing.Quality == quality {
+			replaced = append(replaced, existing)
+			continue
+		}
+		variants = append(variants, existing)
+	}
+	track.Variants = append(variants, variant)
+
+	if err := handler.SetTrackAudio(ctx, track.ID, track); err != nil {
+		deleteAudioFile(ctx, handler, fileID, "Error deleting audio for failed re-encode")
+		return track, err
+	}
+
+	for _, existing := range replaced {
+		deleteAudioFile(ctx, handler, existing.AudioFileID, "Error deleting replaced audio variant")
+	}
+	return track, nil
+}
+
+// deleteAudioFile deletes audio no track refers to any longer, logging rather than returning a failure, as the
+// change that left it unused has already been made.
+func deleteAudioFile(ctx context.Context, handler dao.DbHandler, id primitive.ObjectID, message string) {
+	if err := handler.DeleteAudioFile(ctx, id); err != nil {
+		logrus.WithError(err).WithField("audioFile", id.Hex()).Warn(message)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
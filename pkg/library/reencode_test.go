@@ -0,0 +1,75 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary_NeedsReencode_ShouldMatchFilterAndSkipTracksAlreadyReencoded(t *testing.T) {
+	target := &Transcoder{Format: StreamFormats["opus"], Bitrate: "128k"}
+	request := models.ReencodeRequest{Filter: models.ReencodeFilter{BitRateAbove: 192000}, Format: "opus", BitRate: "128k"}
+
+	lossless := models.Track{Container: "flac", Codec: "flac", AudioInfo: &models.AudioInfo{BitRate: 900000}}
+	low := models.Track{Container: "mp3", Codec: "mp3", AudioInfo: &models.AudioInfo{BitRate: 128000}}
+	unprobed := models.Track{Container: "mp3", Codec: "mp3"}
+	reencoded := models.Track{Container: "ogg", Codec: "opus", AudioInfo: &models.AudioInfo{BitRate: 132000}}
+
+	require.True(t, NeedsReencode(lossless, request, target))
+	require.False(t, NeedsReencode(low, request, target))
+	require.False(t, NeedsReencode(unprobed, request, target))
+
+	request.Filter = models.ReencodeFilter{}
+	require.False(t, NeedsReencode(reencoded, request, target))
+
+	request.Quality = "low"
+	reencoded.Variants = []models.AudioVariant{{Quality: "low", Container: "ogg", Codec: "opus", BitRate: 128000}}
+	require.False(t, NeedsReencode(reencoded, request, target))
+	require.True(t, NeedsReencode(low, request, target))
+}
+
+func TestLibrary_EstimateReencode_ShouldReportSpaceSaved(t *testing.T) {
+	target := &Transcoder{Format: StreamFormats["opus"], Bitrate: "128k"}
+	request := models.ReencodeRequest{Filter: models.ReencodeFilter{BitRateAbove: 192000}, Format: "opus", BitRate: "128k"}
+	tracks := []models.Track{
+		{Container: "mp3", Codec: "mp3", AudioInfo: &models.AudioInfo{BitRate: 320000, Duration: 100}},
+		{Container: "mp3", Codec: "mp3", AudioInfo: &models.AudioInfo{BitRate: 128000, Duration: 100}},
+		{Container: "mp3", Codec: "mp3"},
+	}
+
+	estimate := EstimateReencode(tracks, request, target)
+	require.Equal(t, models.ReencodeEstimate{
+		Tracks:         1,
+		Unprobed:       1,
+		CurrentBytes:   4000000,
+		ReencodedBytes: 1600000,
+		SavedBytes:     2400000,
+	}, estimate)
+}
+
+func TestLibrary_ReplaceWithReencoded_ShouldDeleteReplacedAudio(t *testing.T) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := StoreTrack(ctx, handler, models.Track{Name: "test"}, testAudio)
+	require.Nil(t, err)
+
+	target := &Transcoder{Format: StreamFormats["opus"], Bitrate: "128k"}
+	info := &models.AudioInfo{Container: "ogg", Codec: "opus", BitRate: 128000, Duration: 1}
+	updated, err := ReplaceWithReencoded(ctx, handler, track, []byte("OggS"), target, info)
+	require.Nil(t, err)
+	require.NotEqual(t, track.AudioFileID, updated.AudioFileID)
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": track.ID})
+	require.Nil(t, err)
+	require.Equal(t, updated.AudioFileID, tracks[0].AudioFileID)
+	require.Equal(t, "opus", tracks[0].Codec)
+	require.Equal(t, info, tracks[0].AudioInfo)
+	require.Empty(t, tracks[0].Versions)
+
+	_, err = handler.DownloadAudioFile(ctx, track.AudioFileID)
+	require.Equal(t, dao.ErrNotFound, err)
+}
@@ -0,0 +1,107 @@
+package library
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReplayGainReference is the loudness, in LUFS, that ReplayGain 2.0 gains bring audio to.
+const ReplayGainReference = -18.0
+
+// The ways ReplayGain can be applied to streamed audio: not at all, by each track's own gain, or by its album's, which
+// keeps the differences in loudness between the tracks of an album.
+const (
+	ReplayGainOff   = "off"
+	ReplayGainTrack = "track"
+	ReplayGainAlbum = "album"
+)
+
+// NewReplayGain returns the ReplayGain of the audio file with the given integrated loudness, in LUFS, true peak, in
+// dBTP, and duration, in seconds. Its album gain and peak are its own until SetAlbumGains works out those of its album.
+func NewReplayGain(audioFileID primitive.ObjectID, loudness float64, truePeak float64, duration float64) models.ReplayGain {
+	peak := math.Pow(10, truePeak/20)
+	gain := ReplayGainReference - loudness
+	return models.ReplayGain{
+		AudioFileID: audioFileID,
+		Loudness:    loudness,
+		Duration:    duration,
+		TrackGain:   gain,
+		TrackPeak:   peak,
+		AlbumGain:   gain,
+		AlbumPeak:   peak,
+		AnalyzedAt:  time.Now(),
+	}
+}
+
+// SetAlbumGains sets the album gain and peak of each analysed track from all the analysed tracks of its album, grouped
+// as Albums groups them, and returns the indexes of the tracks whose values changed. The loudness of an album is that
+// of its tracks averaged by power, weighted by duration, which comes close to measuring the album as a whole. Tracks on
+// no album, and podcast episodes, keep gains of their own.
+func SetAlbumGains(tracks []models.Track) []int {
+	albums := make(map[string][]int)
+	for i, track := range tracks {
+		if track.ReplayGain == nil {
+			continue
+		}
+		id := track.ID.Hex()
+		if track.AlbumName != "" && track.AlbumName != "Unknown Album" && track.PodcastID.IsZero() {
+			id = AlbumID(AlbumArtist(track), track.AlbumName)
+		}
+		albums[id] = append(albums[id], i)
+	}
+
+	var changed []int
+	for _, indexes := range albums {
+		var power, duration, peak float64
+		for _, i := range indexes {
+			gain := tracks[i].ReplayGain
+			weight := gain.Duration
+			if weight <= 0 {
+				weight = 1
+			}
+			power += weight * math.Pow(10, gain.Loudness/10)
+			duration += weight
+			peak = math.Max(peak, gain.TrackPeak)
+		}
+		albumGain := ReplayGainReference - 10*math.Log10(power/duration)
+
+		for _, i := range indexes {
+			gain := tracks[i].ReplayGain
+			if gain.AlbumGain != albumGain || gain.AlbumPeak != peak {
+				updated := *gain
+				updated.AlbumGain, updated.AlbumPeak = albumGain, peak
+				tracks[i].ReplayGain = &updated
+				changed = append(changed, i)
+			}
+		}
+	}
+	sort.Ints(changed)
+	return changed
+}
+
+// StreamGain returns the gain, in dB, to apply to a track's audio in the given mode, lowered where needed so that its
+// peak does not clip. It is 0 for a track that has not been analysed or when gain is off.
+func StreamGain(gain *models.ReplayGain, mode string) float64 {
+	if gain == nil {
+		return 0
+	}
+
+	var db, peak float64
+	switch mode {
+	case ReplayGainTrack:
+		db, peak = gain.TrackGain, gain.TrackPeak
+	case ReplayGainAlbum:
+		db, peak = gain.AlbumGain, gain.AlbumPeak
+	default:
+		return 0
+	}
+	if peak > 0 {
+		db = math.Min(db, -20*math.Log10(peak))
+	}
+	return db
+}
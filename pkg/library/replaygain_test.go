@@ -0,0 +1,54 @@
+package library
+
+import (
+	"math"
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLibrary_NewReplayGain_ShouldBringAudioToReferenceLoudness(t *testing.T) {
+	gain := NewReplayGain(primitive.NewObjectID(), -12, -6, 180)
+	require.Equal(t, -6.0, gain.TrackGain)
+	require.InDelta(t, 0.501, gain.TrackPeak, 0.001)
+	require.Equal(t, gain.TrackGain, gain.AlbumGain)
+	require.Equal(t, gain.TrackPeak, gain.AlbumPeak)
+}
+
+func TestLibrary_SetAlbumGains_ShouldWeighTracksOfAnAlbumByDuration(t *testing.T) {
+	loud := NewReplayGain(primitive.NewObjectID(), -8, -1, 300)
+	quiet := NewReplayGain(primitive.NewObjectID(), -21, -10, 100)
+	single := NewReplayGain(primitive.NewObjectID(), -20, -3, 100)
+	tracks := []models.Track{
+		{ID: primitive.NewObjectID(), Artist: "Artist", AlbumName: "Album", ReplayGain: &loud},
+		{ID: primitive.NewObjectID(), Artist: "artist", AlbumName: "album", ReplayGain: &quiet},
+		{ID: primitive.NewObjectID(), Artist: "Artist", ReplayGain: &single},
+		{ID: primitive.NewObjectID(), Artist: "Artist", AlbumName: "Album"},
+	}
+
+	require.Equal(t, []int{0, 1}, SetAlbumGains(tracks))
+	album := ReplayGainReference - 10*math.Log10((300*math.Pow(10, -0.8)+100*math.Pow(10, -2.1))/400)
+	require.InDelta(t, album, tracks[0].ReplayGain.AlbumGain, 1e-9)
+	require.InDelta(t, album, tracks[1].ReplayGain.AlbumGain, 1e-9)
+	require.Equal(t, tracks[0].ReplayGain.TrackPeak, tracks[1].ReplayGain.AlbumPeak)
+	require.Equal(t, 3.0, tracks[1].ReplayGain.TrackGain)
+	require.Equal(t, 2.0, tracks[2].ReplayGain.AlbumGain)
+	require.Nil(t, tracks[3].ReplayGain)
+	// The gains the tracks were given are left alone.
+	require.Equal(t, -10.0, loud.AlbumGain)
+
+	require.Empty(t, SetAlbumGains(tracks))
+}
+
+func TestLibrary_StreamGain_ShouldNotLetPeaksClip(t *testing.T) {
+	gain := NewReplayGain(primitive.NewObjectID(), -24, -3, 100)
+	require.Equal(t, 0.0, StreamGain(nil, ReplayGainTrack))
+	require.Equal(t, 0.0, StreamGain(&gain, ReplayGainOff))
+	require.InDelta(t, 3.0, StreamGain(&gain, ReplayGainTrack), 1e-9)
+
+	gain = NewReplayGain(primitive.NewObjectID(), -8, -1, 100)
+	require.InDelta(t, -10.0, StreamGain(&gain, ReplayGainAlbum), 1e-9)
+}
@@ -0,0 +1,391 @@
+package library
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The ways RestoreBackup can resolve an item of a backup whose ID is already in the library: leaving the library's
+// item as it is, replacing it with the backup's, or adding the backup's as a copy under a new ID.
+const (
+	RestoreSkip      = "skip"
+	RestoreOverwrite = "overwrite"
+	RestoreDuplicate = "duplicate"
+)
+
+// ErrInvalidBackup is returned for an archive RestoreBackup cannot read as a backup.
+var ErrInvalidBackup = errors.New("not a valid backup")
+
+// backupDocuments are the documents of a backup, read before any of its audio.
+type backupDocuments struct {
+	tracks    []models.Track
+	playlists []models.Playlist
+	podcasts  []models.Podcast
+	shares    []models.Share
+	keys      []models.APIKey
+}
+
+// restorer restores the documents of a backup, then its audio, keeping track of what became of each so that
+// references follow copies and files follow the tracks using them.
+type restorer struct {
+	handler  dao.DbHandler
+	conflict string
+	report   models.RestoreReport
+
+	// ids maps the ID of each document restored as a copy to the copy's.
+	ids map[primitive.ObjectID]primitive.ObjectID
+	// files maps the ID of each file in the backup to the IDs it is restored under, and names to the name of the track
+	// using it. Files are only restored for tracks that were, unless the backup has no tracks to go by.
+	files     map[primitive.ObjectID][]primitive.ObjectID
+	names     map[primitive.ObjectID]string
+	allFiles  bool
+	restored  bool
+	documents backupDocuments
+}
+
+// RestoreBackup reads a tar archive written by WriteBackup and adds what it holds to the library, keeping the IDs of
+// documents and audio files. A document whose ID the library already has is resolved by the conflict policy; a copy
+// made with RestoreDuplicate gets its own copies of a track's audio, and playlists and shares restored alongside it
+// refer to the copy. Podcasts and API keys must also have a unique feed and key, so one clashing with another is
+// skipped, as is a playlist with tracks the library does not have. Documents are restored before audio, so a failure
+// part way through leaves tracks without their files rather than files without tracks.
+func RestoreBackup(ctx context.Context, handler dao.DbHandler, r io.Reader, conflict string) (models.RestoreReport, error) {
+	switch conflict {
+	case RestoreSkip, RestoreOverwrite, RestoreDuplicate:
+	default:
+		return models.RestoreReport{}, fmt.Errorf("unknown conflict policy %q", conflict)
+	}
+
+	rs := &restorer{
+		handler:  handler,
+		conflict: conflict,
+		report:   models.RestoreReport{Conflict: conflict, Counts: make(map[string]models.RestoreCounts)},
+		ids:      make(map[primitive.ObjectID]primitive.ObjectID),
+		files:    make(map[primitive.ObjectID][]primitive.ObjectID),
+		names:    make(map[primitive.ObjectID]string),
+	}
+
+	archive := tar.NewReader(r)
+	entry, err := archive.Next()
+	if err != nil {
+		return rs.report, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if entry.Name != backupHeaderName {
+		return rs.report, fmt.Errorf("%w: archive does not start with %v", ErrInvalidBackup, backupHeaderName)
+	}
+	var header BackupHeader
+	if err := json.NewDecoder(archive).Decode(&header); err != nil {
+		return rs.report, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if header.Format != BackupFormat {
+		return rs.report, fmt.Errorf("%w: unsupported format %v", ErrInvalidBackup, header.Format)
+	}
+	rs.allFiles = true
+	for _, section := range header.Sections {
+		if section == BackupTracks {
+			rs.allFiles = false
+		}
+	}
+
+	for {
+		entry, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return rs.report, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+
+		if strings.HasPrefix(entry.Name, "audio/") {
+			if err := rs.restoreDocuments(ctx); err != nil {
+				return rs.report, err
+			}
+			id, err := primitive.ObjectIDFromHex(strings.TrimPrefix(entry.Name, "audio/"))
+			if err != nil {
+				return rs.report, fmt.Errorf("%w: %v is not named by a file ID", ErrInvalidBackup, entry.Name)
+			}
+			if err := rs.restoreFile(ctx, id, archive); err != nil {
+				return rs.report, err
+			}
+			continue
+		}
+
+		if rs.restored {
+			return rs.report, fmt.Errorf("%w: %v follows the audio", ErrInvalidBackup, entry.Name)
+		}
+		if err := rs.documents.read(strings.TrimSuffix(entry.Name, ".jsonl"), archive); err != nil {
+			return rs.report, fmt.Errorf("%w: %v: %v", ErrInvalidBackup, entry.Name, err)
+		}
+	}
+	return rs.report, rs.restoreDocuments(ctx)
+}
+
+// read decodes a section's documents, one Extended JSON document per line. Entries that are not a section are ignored.
+func (d *backupDocuments) read(section string, r io.Reader) error {
+	var decode func(line []byte) error
+	switch section {
+	case BackupTracks:
+		decode = func(line []byte) error {
+			var track models.Track
+			err := bson.UnmarshalExtJSON(line, true, &track)
+			d.tracks = append(d.tracks, track)
+			return err
+		}
+	case BackupPlaylists:
+		decode = func(line []byte) error {
+			var playlist models.Playlist
+			err := bson.UnmarshalExtJSON(line, true, &playlist)
+			d.playlists = append(d.playlists, playlist)
+			return err
+		}
+	case BackupPodcasts:
+		decode = func(line []byte) error {
+			var podcast models.Podcast
+			err := bson.UnmarshalExtJSON(line, true, &podcast)
+			d.podcasts = append(d.podcasts, podcast)
+			return err
+		}
+	case BackupShares:
+		decode = func(line []byte) error {
+			var share models.Share
+			err := bson.UnmarshalExtJSON(line, true, &share)
+			d.shares = append(d.shares, share)
+			return err
+		}
+	case BackupAPIKeys:
+		decode = func(line []byte) error {
+			var key models.APIKey
+			err := bson.UnmarshalExtJSON(line, true, &key)
+			d.keys = append(d.keys, key)
+			return err
+		}
+	default:
+		logrus.WithField("entry", section).Warn("Ignoring unknown entry in backup")
+		return nil
+	}
+
+	lines := bufio.NewReader(r)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if err := decode(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// restoreDocuments restores the documents read so far, the first time it is called, in the order they refer to each
+// other: podcasts, then tracks, then the playlists and shares of tracks.
+func (rs *restorer) restoreDocuments(ctx context.Context) error {
+	if rs.restored {
+		return nil
+	}
+	rs.restored = true
+	docs := rs.documents
+
+	for _, podcast := range docs.podcasts {
+		podcast := podcast
+		if _, err := rs.restore(ctx, BackupPodcasts, podcast.ID, podcast, func(id primitive.ObjectID) interface{} {
+			podcast.ID = id
+			return podcast
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, track := range docs.tracks {
+		track := track
+		if id, ok := rs.ids[track.PodcastID]; ok {
+			track.PodcastID = id
+		}
+		files := BackupFiles([]models.Track{track}, true, true)
+		copies := make(map[primitive.ObjectID]primitive.ObjectID)
+		outcome, err := rs.restore(ctx, BackupTracks, track.ID, track, func(id primitive.ObjectID) interface{} {
+			for _, file := range files {
+				copies[file] = primitive.NewObjectID()
+			}
+			track := copyTrackFiles(track, copies)
+			track.ID = id
+			return track
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			rs.names[file] = track.Name
+			switch outcome {
+			case RestoreDuplicate:
+				rs.files[file] = append(rs.files[file], copies[file])
+			case RestoreSkip:
+			default:
+				rs.files[file] = append(rs.files[file], file)
+			}
+		}
+	}
+
+	for _, playlist := range docs.playlists {
+		playlist := playlist
+		for i, trackID := range playlist.Tracks {
+			if id, ok := rs.ids[trackID]; ok {
+				playlist.Tracks[i] = id
+			}
+		}
+		if _, err := rs.restore(ctx, BackupPlaylists, playlist.ID, playlist, func(id primitive.ObjectID) interface{} {
+			playlist.ID = id
+			return playlist
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, share := range docs.shares {
+		share := share
+		if id, ok := rs.ids[share.ResourceID]; ok {
+			share.ResourceID = id
+		}
+		if _, err := rs.restore(ctx, BackupShares, share.ID, share, func(id primitive.ObjectID) interface{} {
+			share.ID = id
+			return share
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range docs.keys {
+		key := key
+		if _, err := rs.restore(ctx, BackupAPIKeys, key.ID, key, func(id primitive.ObjectID) interface{} {
+			key.ID = id
+			return key
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore stores a document of the backup, resolving a clash with the library by the conflict policy, and counts the
+// outcome: "" if the document was restored as it was, or the policy applied to it. duplicate returns the copy to
+// store under a new ID. A document the library cannot take, because of a clash on something other than its ID or
+// because it refers to tracks that are missing, is logged and skipped.
+func (rs *restorer) restore(ctx context.Context, section string, id primitive.ObjectID, doc interface{}, duplicate func(id primitive.ObjectID) interface{}) (string, error) {
+	counts := rs.report.Counts[section]
+	defer func() { rs.report.Counts[section] = counts }()
+
+	outcome := ""
+	err := rs.handler.RestoreDocument(ctx, section, doc, false)
+	if errors.Is(err, dao.ErrDuplicate) {
+		outcome = rs.conflict
+		switch rs.conflict {
+		case RestoreOverwrite:
+			err = rs.handler.RestoreDocument(ctx, section, doc, true)
+		case RestoreDuplicate:
+			copyID := primitive.NewObjectID()
+			if err = rs.handler.RestoreDocument(ctx, section, duplicate(copyID), false); err == nil {
+				rs.ids[id] = copyID
+			}
+		default:
+			counts.Skipped++
+			return RestoreSkip, nil
+		}
+	}
+	if errors.Is(err, dao.ErrDuplicate) || errors.Is(err, dao.ErrNotFound) {
+		logrus.WithError(err).WithFields(logrus.Fields{"section": section, "id": id.Hex()}).Warn("Skipping document the library cannot take")
+		counts.Skipped++
+		return RestoreSkip, nil
+	} else if err != nil {
+		return "", fmt.Errorf("error restoring %v %v: %w", section, id.Hex(), err)
+	}
+
+	switch outcome {
+	case RestoreOverwrite:
+		counts.Overwritten++
+	case RestoreDuplicate:
+		counts.Duplicated++
+	default:
+		counts.Restored++
+	}
+	return outcome, nil
+}
+
+// restoreFile stores a file of the backup under each ID it is restored as, or skips it if no restored track uses it.
+func (rs *restorer) restoreFile(ctx context.Context, id primitive.ObjectID, r io.Reader) error {
+	counts := rs.report.Counts[BackupAudio]
+	defer func() { rs.report.Counts[BackupAudio] = counts }()
+
+	targets := rs.files[id]
+	if rs.allFiles {
+		targets = []primitive.ObjectID{id}
+	}
+	if len(targets) == 0 {
+		counts.Skipped++
+		return nil
+	}
+
+	audio, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	name := rs.names[id]
+	if name == "" {
+		name = id.Hex()
+	}
+	for _, target := range targets {
+		if err := rs.handler.RestoreAudioFile(ctx, target, audio, name); err != nil {
+			return fmt.Errorf("error restoring audio file %v: %w", id.Hex(), err)
+		}
+		if target == id {
+			counts.Restored++
+		} else {
+			counts.Duplicated++
+		}
+	}
+	return nil
+}
+
+// copyTrackFiles returns the track with each of its files replaced by its copy, leaving the original's slices alone.
+func copyTrackFiles(track models.Track, copies map[primitive.ObjectID]primitive.ObjectID) models.Track {
+	rename := func(id primitive.ObjectID) primitive.ObjectID {
+		if copied, ok := copies[id]; ok {
+			return copied
+		}
+		return id
+	}
+
+	track.AudioFileID = rename(track.AudioFileID)
+	track.ArtworkFileID = rename(track.ArtworkFileID)
+	if track.Original != nil {
+		original := *track.Original
+		original.AudioFileID = rename(original.AudioFileID)
+		track.Original = &original
+	}
+	track.Variants = append([]models.AudioVariant(nil), track.Variants...)
+	for i := range track.Variants {
+		track.Variants[i].AudioFileID = rename(track.Variants[i].AudioFileID)
+	}
+	track.Versions = append([]models.AudioVersion(nil), track.Versions...)
+	for i := range track.Versions {
+		track.Versions[i].AudioFileID = rename(track.Versions[i].AudioFileID)
+	}
+	return track
+}
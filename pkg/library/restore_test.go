@@ -0,0 +1,125 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testBackup returns a library with a track on a playlist, and a backup of it.
+func testBackup(t *testing.T) (*dao.MemoryHandler, models.Track, models.Playlist, []byte) {
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	track, err := StoreTrack(ctx, handler, models.Track{Name: "test", Fingerprint: []uint32{1, 2}}, testAudio)
+	require.Nil(t, err)
+	playlist := models.Playlist{ID: primitive.NewObjectID(), Name: "test", Tracks: []primitive.ObjectID{track.ID}}
+	require.Nil(t, handler.AddPlaylist(ctx, playlist))
+
+	var archive bytes.Buffer
+	_, err = WriteBackup(ctx, handler, &archive, BackupSections)
+	require.Nil(t, err)
+	return handler, track, playlist, archive.Bytes()
+}
+
+func TestLibrary_RestoreBackup_ShouldRestoreDocumentsAndAudioWithTheirIDs(t *testing.T) {
+	ctx := context.Background()
+	_, track, playlist, archive := testBackup(t)
+
+	handler := dao.NewMemoryHandler()
+	report, err := RestoreBackup(ctx, handler, bytes.NewReader(archive), RestoreSkip)
+	require.Nil(t, err)
+	require.Equal(t, models.RestoreCounts{Restored: 1}, report.Counts[BackupTracks])
+	require.Equal(t, models.RestoreCounts{Restored: 1}, report.Counts[BackupPlaylists])
+	require.Equal(t, models.RestoreCounts{Restored: 1}, report.Counts[BackupAudio])
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{"_id": track.ID})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, []uint32{1, 2}, tracks[0].Fingerprint)
+	require.Equal(t, track.CreatedAt.Unix(), tracks[0].CreatedAt.Unix())
+
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+	require.Equal(t, []primitive.ObjectID{track.ID}, playlists[0].Tracks)
+
+	audio, err := handler.DownloadAudioFile(ctx, track.AudioFileID)
+	require.Nil(t, err)
+	require.Equal(t, testAudio, audio)
+}
+
+func TestLibrary_RestoreBackup_ShouldSkipItemsTheLibraryHas(t *testing.T) {
+	ctx := context.Background()
+	handler, track, _, archive := testBackup(t)
+	require.Nil(t, handler.UpdateTrack(ctx, track.ID, models.Track{Name: "renamed"}, dao.AnyRevision))
+
+	report, err := RestoreBackup(ctx, handler, bytes.NewReader(archive), RestoreSkip)
+	require.Nil(t, err)
+	require.Equal(t, models.RestoreCounts{Skipped: 1}, report.Counts[BackupTracks])
+	require.Equal(t, models.RestoreCounts{Skipped: 1}, report.Counts[BackupAudio])
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, "renamed", tracks[0].Name)
+}
+
+func TestLibrary_RestoreBackup_ShouldOverwriteItemsTheLibraryHas(t *testing.T) {
+	ctx := context.Background()
+	handler, track, _, archive := testBackup(t)
+	require.Nil(t, handler.UpdateTrack(ctx, track.ID, models.Track{Name: "renamed"}, dao.AnyRevision))
+
+	report, err := RestoreBackup(ctx, handler, bytes.NewReader(archive), RestoreOverwrite)
+	require.Nil(t, err)
+	require.Equal(t, models.RestoreCounts{Overwritten: 1}, report.Counts[BackupTracks])
+	require.Equal(t, models.RestoreCounts{Overwritten: 1}, report.Counts[BackupPlaylists])
+	require.Equal(t, models.RestoreCounts{Restored: 1}, report.Counts[BackupAudio])
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+	require.Nil(t, err)
+	require.Len(t, tracks, 1)
+	require.Equal(t, "test", tracks[0].Name)
+}
+
+func TestLibrary_RestoreBackup_ShouldDuplicateItemsWithTheirOwnAudio(t *testing.T) {
+	ctx := context.Background()
+	handler, track, playlist, archive := testBackup(t)
+
+	report, err := RestoreBackup(ctx, handler, bytes.NewReader(archive), RestoreDuplicate)
+	require.Nil(t, err)
+	require.Equal(t, models.RestoreCounts{Duplicated: 1}, report.Counts[BackupTracks])
+	require.Equal(t, models.RestoreCounts{Duplicated: 1}, report.Counts[BackupPlaylists])
+	require.Equal(t, models.RestoreCounts{Duplicated: 1}, report.Counts[BackupAudio])
+
+	copies, err := handler.GetTracks(ctx, map[string]interface{}{"_id": map[string]interface{}{"$ne": track.ID}})
+	require.Nil(t, err)
+	require.Len(t, copies, 1)
+	require.NotEqual(t, track.AudioFileID, copies[0].AudioFileID)
+	audio, err := handler.DownloadAudioFile(ctx, copies[0].AudioFileID)
+	require.Nil(t, err)
+	require.Equal(t, testAudio, audio)
+
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": map[string]interface{}{"$ne": playlist.ID}})
+	require.Nil(t, err)
+	require.Len(t, playlists, 1)
+	require.Equal(t, []primitive.ObjectID{copies[0].ID}, playlists[0].Tracks)
+}
+
+func TestLibrary_RestoreBackup_ShouldRejectOtherArchives(t *testing.T) {
+	_, err := RestoreBackup(context.Background(), dao.NewMemoryHandler(), strings.NewReader("not a tar file"), RestoreSkip)
+	require.True(t, errors.Is(err, ErrInvalidBackup))
+
+	var archive bytes.Buffer
+	_, err = WriteBackup(context.Background(), dao.NewMemoryHandler(), &archive, []string{BackupTracks})
+	require.Nil(t, err)
+	_, err = RestoreBackup(context.Background(), dao.NewMemoryHandler(), &archive, "merge")
+	require.NotNil(t, err)
+}
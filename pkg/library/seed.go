@@ -0,0 +1,229 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// demoSampleRate is the sample rate of the demo tracks, which is plenty for the tones they are made of.
+const demoSampleRate = 22050
+
+// demoTrack is a public domain melody, written as space separated notes such as C4 or G#3, each optionally followed by
+// its length in beats, as in E4:1.5. R is a rest.
+type demoTrack struct {
+	id     string
+	name   string
+	artist string
+	year   int
+	tags   []string
+	tempo  float64
+	melody string
+}
+
+var demoTracks = []demoTrack{
+	{
+		id: "5eed00000000000000000001", name: "Ode to Joy", artist: "Ludwig van Beethoven", year: 1824,
+		tags: []string{"demo", "classical"}, tempo: 120,
+		melody: "E4 E4 F4 G4 G4 F4 E4 D4 C4 C4 D4 E4 E4:1.5 D4:0.5 D4:2 " +
+			"E4 E4 F4 G4 G4 F4 E4 D4 C4 C4 D4 E4 D4:1.5 C4:0.5 C4:2",
+	},
+	{
+		id: "5eed00000000000000000002", name: "Twinkle, Twinkle, Little Star", artist: "Traditional",
+		tags: []string{"demo", "traditional"}, tempo: 100,
+		melody: "C4 C4 G4 G4 A4 A4 G4:2 F4 F4 E4 E4 D4 D4 C4:2 " +
+			"G4 G4 F4 F4 E4 E4 D4:2 G4 G4 F4 F4 E4 E4 D4:2 " +
+			"C4 C4 G4 G4 A4 A4 G4:2 F4 F4 E4 E4 D4 D4 C4:2",
+	},
+	{
+		id: "5eed00000000000000000003", name: "Frère Jacques", artist: "Traditional",
+		tags: []string{"demo", "traditional"}, tempo: 110,
+		melody: "C4 D4 E4 C4 C4 D4 E4 C4 E4 F4 G4:2 E4 F4 G4:2 " +
+			"G4:0.5 A4:0.5 G4:0.5 F4:0.5 E4 C4 G4:0.5 A4:0.5 G4:0.5 F4:0.5 E4 C4 C4 G3 C4:2 C4 G3 C4:2",
+	},
+	{
+		id: "5eed00000000000000000004", name: "Au Clair de la Lune", artist: "Traditional",
+		tags: []string{"demo", "traditional"}, tempo: 100,
+		melody: "C4 C4 C4 D4 E4:2 D4:2 C4 E4 D4 D4 C4:4",
+	},
+	{
+		id: "5eed00000000000000000005", name: "Canon in D", artist: "Johann Pachelbel", year: 1680,
+		tags: []string{"demo", "classical"}, tempo: 80,
+		melody: "F#5:2 E5:2 D5:2 C#5:2 B4:2 A4:2 B4:2 C#5:2 " +
+			"D5 C#5 B4 A4 G4 F#4 G4 E4 D4 F#4 A4 G4 F#4 D4 F#4 E4:2",
+	},
+}
+
+// demoPlaylist refers to demo tracks by their position in demoTracks.
+type demoPlaylist struct {
+	id     string
+	name   string
+	tracks []int
+}
+
+var demoPlaylists = []demoPlaylist{
+	{id: "5eed00000000000000000101", name: "Demo: Classical", tracks: []int{0, 4}},
+	{id: "5eed00000000000000000102", name: "Demo: Nursery Rhymes", tracks: []int{1, 2, 3}},
+	{id: "5eed00000000000000000103", name: "Demo: Everything", tracks: []int{0, 1, 2, 3, 4}},
+}
+
+// Seed adds a few public domain melodies, synthesized as WAV files, and playlists of them to the library, so that a
+// new deployment has something to play. The demo tracks and playlists have fixed IDs, and any that already exist are
+// skipped. It returns the number of tracks and playlists added.
+func Seed(ctx context.Context, handler dao.DbHandler) (int, int, error) {
+	trackIDs := make([]primitive.ObjectID, len(demoTracks))
+	addedTracks := 0
+	for i, demo := range demoTracks {
+		id, err := primitive.ObjectIDFromHex(demo.id)
+		if err != nil {
+			return addedTracks, 0, err
+		}
+		trackIDs[i] = id
+
+		existing, err := handler.GetTracks(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			return addedTracks, 0, err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		audio, err := synthesizeMelody(demo.melody, demo.tempo)
+		if err != nil {
+			return addedTracks, 0, fmt.Errorf("error synthesizing %v: %w", demo.name, err)
+		}
+		track := models.Track{
+			ID:        id,
+			Name:      demo.name,
+			Artist:    demo.artist,
+			AlbumName: "Public Domain Melodies",
+			Year:      demo.year,
+			Tags:      demo.tags,
+		}
+		if _, err := StoreTrack(ctx, handler, track, audio); err != nil {
+			return addedTracks, 0, err
+		}
+		addedTracks++
+	}
+
+	addedPlaylists := 0
+	for _, demo := range demoPlaylists {
+		id, err := primitive.ObjectIDFromHex(demo.id)
+		if err != nil {
+			return addedTracks, addedPlaylists, err
+		}
+		existing, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": id})
+		if err != nil {
+			return addedTracks, addedPlaylists, err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		playlist := models.Playlist{ID: id, Name: demo.name}
+		for _, i := range demo.tracks {
+			playlist.Tracks = append(playlist.Tracks, trackIDs[i])
+		}
+		if err := handler.AddPlaylist(ctx, playlist); err != nil {
+			return addedTracks, addedPlaylists, err
+		}
+		addedPlaylists++
+	}
+
+	return addedTracks, addedPlaylists, nil
+}
+
+// noteSemitones are the semitones of each note name above C.
+var noteSemitones = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// noteFrequency returns the frequency of a note such as A4, C#5 or Bb3, or 0 for the rest R.
+func noteFrequency(note string) (float64, error) {
+	if note == "R" {
+		return 0, nil
+	}
+	if len(note) < 2 {
+		return 0, fmt.Errorf("invalid note %q", note)
+	}
+	semitone, ok := noteSemitones[note[0]]
+	if !ok {
+		return 0, fmt.Errorf("invalid note %q", note)
+	}
+	rest := note[1:]
+	switch rest[0] {
+	case '#':
+		semitone++
+		rest = rest[1:]
+	case 'b':
+		semitone--
+		rest = rest[1:]
+	}
+	octave, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, fmt.Errorf("invalid note %q", note)
+	}
+
+	// MIDI numbers notes from C-1, with A4, 440Hz, as 69.
+	midi := (octave+1)*12 + semitone
+	return 440 * math.Pow(2, float64(midi-69)/12), nil
+}
+
+// synthesizeMelody renders a melody as a 16 bit mono WAV file of sine tones, each fading in and out so notes do not
+// click.
+func synthesizeMelody(melody string, tempo float64) ([]byte, error) {
+	var samples []int16
+	for _, token := range strings.Fields(melody) {
+		note, beats := token, 1.0
+		if i := strings.IndexByte(token, ':'); i >= 0 {
+			var err error
+			if beats, err = strconv.ParseFloat(token[i+1:], 64); err != nil {
+				return nil, fmt.Errorf("invalid length in %q", token)
+			}
+			note = token[:i]
+		}
+		frequency, err := noteFrequency(note)
+		if err != nil {
+			return nil, err
+		}
+
+		count := int(beats * 60 / tempo * demoSampleRate)
+		fade := demoSampleRate / 100
+		for n := 0; n < count; n++ {
+			envelope := 1.0
+			if n < fade {
+				envelope = float64(n) / float64(fade)
+			} else if count-n < 4*fade {
+				envelope = float64(count-n) / float64(4*fade)
+			}
+			value := 0.3 * envelope * math.Sin(2*math.Pi*frequency*float64(n)/demoSampleRate)
+			samples = append(samples, int16(value*math.MaxInt16))
+		}
+	}
+
+	var wav bytes.Buffer
+	dataSize := uint32(len(samples) * 2)
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, 36+dataSize)
+	wav.WriteString("WAVEfmt ")
+	binary.Write(&wav, binary.LittleEndian, struct {
+		Size          uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{16, 1, 1, demoSampleRate, demoSampleRate * 2, 2, 16})
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, dataSize)
+	binary.Write(&wav, binary.LittleEndian, samples)
+	return wav.Bytes(), nil
+}
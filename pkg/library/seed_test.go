@@ -0,0 +1,48 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary_Seed_ShouldAddPlayableDemoLibraryOnce(t *testing.T) {
+	handler := dao.NewMemoryHandler()
+	ctx := context.Background()
+
+	tracks, playlists, err := Seed(ctx, handler)
+	require.Nil(t, err)
+	require.Equal(t, len(demoTracks), tracks)
+	require.Equal(t, len(demoPlaylists), playlists)
+
+	stored, err := handler.GetTracks(ctx, nil)
+	require.Nil(t, err)
+	require.Len(t, stored, len(demoTracks))
+	for _, track := range stored {
+		require.Equal(t, "wav", track.Container)
+		audio, err := handler.DownloadAudioFile(ctx, track.AudioFileID)
+		require.Nil(t, err)
+		require.Greater(t, len(audio), 44)
+	}
+
+	tracks, playlists, err = Seed(ctx, handler)
+	require.Nil(t, err)
+	require.Equal(t, 0, tracks)
+	require.Equal(t, 0, playlists)
+}
+
+func TestLibrary_NoteFrequency_ShouldTuneToConcertPitch(t *testing.T) {
+	frequency, err := noteFrequency("A4")
+	require.Nil(t, err)
+	require.InDelta(t, 440, frequency, 0.001)
+
+	frequency, err = noteFrequency("C#5")
+	require.Nil(t, err)
+	require.InDelta(t, 554.365, frequency, 0.001)
+
+	_, err = noteFrequency("H2")
+	require.NotNil(t, err)
+}
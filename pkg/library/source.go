@@ -0,0 +1,94 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"music-stream-api/pkg/dao"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// formatHeaderSize is how much of the start of audio DetectFormat looks at.
+const formatHeaderSize = 128
+
+// audioSource is audio being stored, held in memory as data or, when it is too big for that, read from stream, which
+// is rewound each time the audio is needed.
+type audioSource struct {
+	data   []byte
+	stream io.ReadSeeker
+}
+
+// open returns a reader of the audio from its start.
+func (a audioSource) open() (io.Reader, error) {
+	if a.stream == nil {
+		return bytes.NewReader(a.data), nil
+	}
+	if _, err := a.stream.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return a.stream, nil
+}
+
+func (a audioSource) format() (string, string, error) {
+	if a.stream == nil {
+		return DetectFormat(a.data)
+	}
+	r, err := a.open()
+	if err != nil {
+		return "", "", err
+	}
+	header := make([]byte, formatHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", "", err
+	}
+	return DetectFormat(header[:n])
+}
+
+func (a audioSource) checksum() (string, error) {
+	if a.stream == nil {
+		return Checksum(a.data), nil
+	}
+	r, err := a.open()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (a audioSource) transcode(ctx context.Context, transcoder *Transcoder) ([]byte, error) {
+	r, err := a.open()
+	if err != nil {
+		return nil, err
+	}
+	return transcoder.TranscodeStream(ctx, r)
+}
+
+// upload stores the audio, streaming it to the handler rather than reading it into memory when it is not already
+// there.
+func (a audioSource) upload(ctx context.Context, handler dao.DbHandler, name string) (primitive.ObjectID, error) {
+	if a.stream == nil {
+		return uploadAudio(ctx, handler, a.data, name)
+	}
+	r, err := a.open()
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	audioID, err := handler.UploadAudioStream(ctx, r, name)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	fileID, ok := audioID.(primitive.ObjectID)
+	if !ok {
+		return primitive.NilObjectID, ErrInvalidAudioID
+	}
+	return fileID, nil
+}
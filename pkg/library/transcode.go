@@ -0,0 +1,195 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StreamFormat is a format uploads can be transcoded to for streaming. Container and Codec are those DetectFormat
+// reports for audio already in the format.
+type StreamFormat struct {
+	Container string
+	Codec     string
+	encoder   string
+	bitrate   string
+	muxer     string
+}
+
+// StreamFormats are the formats tracks can be transcoded to, by name. Each can be written to a pipe, which rules out
+// mp4.
+var StreamFormats = map[string]StreamFormat{
+	"mp3":  {Container: "mp3", Codec: "mp3", encoder: "libmp3lame", bitrate: "192k", muxer: "mp3"},
+	"opus": {Container: "ogg", Codec: "opus", encoder: "libopus", bitrate: "128k", muxer: "ogg"},
+	"aac":  {Container: "adts", Codec: "aac", encoder: "aac", bitrate: "192k", muxer: "adts"},
+}
+
+// Transcoder converts audio to a single streaming format with ffmpeg, at the format's default bitrate unless Bitrate
+// is set. Gain, in dB, is applied to the audio as it is converted, as for ReplayGain. Each conversion waits for a slot
+// in Pool.
+type Transcoder struct {
+	FFmpeg  string
+	Format  StreamFormat
+	Bitrate string
+	Gain    float64
+	Pool    *FFmpegPool
+}
+
+// Variant is a lower quality copy of uploads, such as for listeners on mobile data, stored alongside the main audio.
+type Variant struct {
+	Quality    string
+	Transcoder *Transcoder
+}
+
+// BitRate returns the bit rate the transcoder encodes at, in bits per second.
+func (t *Transcoder) BitRate() int {
+	bitrate := t.Format.bitrate
+	if t.Bitrate != "" {
+		bitrate = t.Bitrate
+	}
+	kbps, _ := strconv.Atoi(strings.TrimSuffix(bitrate, "k"))
+	return kbps * 1000
+}
+
+// Needed reports whether audio in the given container and codec has to be transcoded to be in the streaming format.
+func (t *Transcoder) Needed(container string, codec string) bool {
+	return container != t.Format.Container || codec != t.Format.Codec
+}
+
+// Transcode converts the audio to the streaming format, dropping any video such as embedded cover art.
+func (t *Transcoder) Transcode(ctx context.Context, audio []byte) ([]byte, error) {
+	return t.TranscodeStream(ctx, bytes.NewReader(audio))
+}
+
+// TranscodeStream is Transcode for audio read from a stream, such as an upload spooled to disk.
+func (t *Transcoder) TranscodeStream(ctx context.Context, audio io.Reader) ([]byte, error) {
+	bitrate := t.Format.bitrate
+	if t.Bitrate != "" {
+		bitrate = t.Bitrate
+	}
+
+	release, err := t.Pool.Acquire(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-vn"}
+	if t.Gain != 0 {
+		args = append(args, "-af", fmt.Sprintf("volume=%.2fdB", t.Gain))
+	}
+	args = append(args, "-c:a", t.Format.encoder, "-b:a", bitrate, "-f", t.Format.muxer, "pipe:1")
+	cmd := exec.CommandContext(ctx, t.FFmpeg, args...)
+	cmd.Stdin = audio
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg transcode failed: %v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// StoreTranscodedTrack stores a track like StoreTrack, except that audio not already in the transcoder's format is
+// converted to it first, and a copy of the audio is stored for each variant. The uploaded audio is kept as the track's
+// original when it was converted, and the track's checksum is that of the uploaded audio. With a nil transcoder and no
+// variants it is the same as StoreTrack.
+func StoreTranscodedTrack(ctx context.Context, handler dao.DbHandler, track models.Track, audio []byte, transcoder *Transcoder, variants []Variant) (models.Track, error) {
+	return storeTranscodedTrack(ctx, handler, track, audioSource{data: audio}, transcoder, variants)
+}
+
+// StoreTranscodedTrackStream is StoreTranscodedTrack for audio too big to hold in memory, such as an upload spooled to
+// disk, which is read from the stream each time it is needed rather than all at once.
+func StoreTranscodedTrackStream(ctx context.Context, handler dao.DbHandler, track models.Track, audio io.ReadSeeker, transcoder *Transcoder, variants []Variant) (models.Track, error) {
+	return storeTranscodedTrack(ctx, handler, track, audioSource{stream: audio}, transcoder, variants)
+}
+
+func storeTranscodedTrack(ctx context.Context, handler dao.DbHandler, track models.Track, audio audioSource, transcoder *Transcoder, variants []Variant) (models.Track, error) {
+	container, codec, err := audio.format()
+	if err != nil {
+		return track, err
+	}
+	if track.Checksum == "" {
+		if track.Checksum, err = audio.checksum(); err != nil {
+			return track, err
+		}
+	}
+
+	// Anything uploaded before the track itself is stored is deleted again if storing it fails.
+	var uploaded []primitive.ObjectID
+	cleanup := func() {
+		for _, id := range uploaded {
+			if err := handler.DeleteAudioFile(ctx, id); err != nil {
+				logrus.WithError(err).WithField("audioFile", id.Hex()).Warn("Error deleting audio for failed upload")
+			}
+		}
+	}
+
+	for _, variant := range variants {
+		converted, err := audio.transcode(ctx, variant.Transcoder)
+		if err != nil {
+			cleanup()
+			return track, err
+		}
+		fileID, err := uploadAudio(ctx, handler, converted, track.Name)
+		if err != nil {
+			cleanup()
+			return track, err
+		}
+		uploaded = append(uploaded, fileID)
+		track.Variants = append(track.Variants, models.AudioVariant{
+			Quality:     variant.Quality,
+			AudioFileID: fileID,
+			Container:   variant.Transcoder.Format.Container,
+			Codec:       variant.Transcoder.Format.Codec,
+			BitRate:     variant.Transcoder.BitRate(),
+		})
+	}
+
+	if transcoder != nil && transcoder.Needed(container, codec) {
+		converted, err := audio.transcode(ctx, transcoder)
+		if err != nil {
+			cleanup()
+			return track, err
+		}
+		originalID, err := audio.upload(ctx, handler, track.Name)
+		if err != nil {
+			cleanup()
+			return track, err
+		}
+		uploaded = append(uploaded, originalID)
+		// What was probed at upload describes the original, not the converted audio the track now plays.
+		track.Original = &models.OriginalAudio{AudioFileID: originalID, Container: container, Codec: codec, AudioInfo: track.AudioInfo}
+		track.AudioInfo = nil
+		audio = audioSource{data: converted}
+	}
+
+	stored, err := storeTrack(ctx, handler, track, audio)
+	if err != nil {
+		cleanup()
+		return track, err
+	}
+	return stored, nil
+}
+
+func uploadAudio(ctx context.Context, handler dao.DbHandler, audio []byte, name string) (primitive.ObjectID, error) {
+	audioID, err := handler.UploadAudioFile(ctx, audio, name)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	fileID, ok := audioID.(primitive.ObjectID)
+	if !ok {
+		return primitive.NilObjectID, ErrInvalidAudioID
+	}
+	return fileID, nil
+}
@@ -0,0 +1,130 @@
+package library
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testFlac = []byte("fLaC\x00\x00\x00\x22")
+
+// stubFFmpeg writes a script that ignores its arguments and outputs the given audio, standing in for ffmpeg.
+func stubFFmpeg(t *testing.T, dir string, output []byte) string {
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "output"), output, 0644))
+	path := filepath.Join(dir, "ffmpeg")
+	require.Nil(t, ioutil.WriteFile(path, []byte("#!/bin/sh\ncat > /dev/null\ncat "+filepath.Join(dir, "output")+"\n"), 0755))
+	return path
+}
+
+func TestLibrary_StoreTranscodedTrack_ShouldNotTranscodeAudioAlreadyInFormat(t *testing.T) {
+	audioID := primitive.NewObjectID()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, testAudio, mock.Anything).Return(audioID, nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.AudioFileID == audioID && track.Original == nil
+	})).Return(nil)
+
+	transcoder := &Transcoder{FFmpeg: "/nonexistent", Format: StreamFormats["mp3"]}
+	_, err := StoreTranscodedTrack(context.Background(), dbHandler, models.Track{}, testAudio, transcoder, nil)
+	require.Nil(t, err)
+	dbHandler.AssertNumberOfCalls(t, "UploadAudioFile", 1)
+}
+
+func TestLibrary_StoreTranscodedTrack_ShouldKeepOriginalAudio(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcode")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	originalID, convertedID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, testFlac, mock.Anything).Return(originalID, nil)
+	dbHandler.On("UploadAudioFile", mock.Anything, testAudio, mock.Anything).Return(convertedID, nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.AudioFileID == convertedID && track.Container == "mp3" &&
+			*track.Original == models.OriginalAudio{AudioFileID: originalID, Container: "flac", Codec: "flac"}
+	})).Return(nil)
+
+	transcoder := &Transcoder{FFmpeg: stubFFmpeg(t, dir, testAudio), Format: StreamFormats["mp3"]}
+	track, err := StoreTranscodedTrack(context.Background(), dbHandler, models.Track{}, testFlac, transcoder, nil)
+	require.Nil(t, err)
+	require.Equal(t, convertedID, track.AudioFileID)
+}
+
+func TestLibrary_StoreTranscodedTrack_ShouldDeleteOriginalIfStoreFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcode")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	originalID := primitive.NewObjectID()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, testFlac, mock.Anything).Return(originalID, nil)
+	dbHandler.On("DeleteAudioFile", mock.Anything, originalID).Return(nil)
+
+	// The stub's output is not audio, so storing the converted track fails.
+	transcoder := &Transcoder{FFmpeg: stubFFmpeg(t, dir, []byte("test")), Format: StreamFormats["mp3"]}
+	_, err = StoreTranscodedTrack(context.Background(), dbHandler, models.Track{}, testFlac, transcoder, nil)
+	require.Equal(t, ErrNotAudio, err)
+	dbHandler.AssertCalled(t, "DeleteAudioFile", mock.Anything, originalID)
+}
+
+func TestLibrary_StoreTranscodedTrack_ShouldStoreVariants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcode")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	variantOutput := []byte("OggS\x00\x02\x00\x00\x00\x00OpusHead")
+	audioID, variantID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	dbHandler := &mocks.DbHandler{}
+	dbHandler.On("UploadAudioFile", mock.Anything, testAudio, mock.Anything).Return(audioID, nil)
+	dbHandler.On("UploadAudioFile", mock.Anything, variantOutput, mock.Anything).Return(variantID, nil)
+	dbHandler.On("AddTrack", mock.Anything, mock.MatchedBy(func(track models.Track) bool {
+		return track.AudioFileID == audioID && track.Original == nil && len(track.Variants) == 1 &&
+			track.Variants[0] == models.AudioVariant{Quality: "low", AudioFileID: variantID, Container: "ogg", Codec: "opus", BitRate: 48000}
+	})).Return(nil)
+
+	variants := []Variant{{
+		Quality:    "low",
+		Transcoder: &Transcoder{FFmpeg: stubFFmpeg(t, dir, variantOutput), Format: StreamFormats["opus"], Bitrate: "48k"},
+	}}
+	_, err = StoreTranscodedTrack(context.Background(), dbHandler, models.Track{}, testAudio, nil, variants)
+	require.Nil(t, err)
+}
+
+func TestLibrary_StoreTranscodedTrackStream_ShouldStoreAudioReadFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcode")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file, err := os.Create(filepath.Join(dir, "upload"))
+	require.Nil(t, err)
+	defer file.Close()
+	_, err = file.Write(testFlac)
+	require.Nil(t, err)
+
+	ctx := context.Background()
+	handler := dao.NewMemoryHandler()
+	transcoder := &Transcoder{FFmpeg: stubFFmpeg(t, dir, testAudio), Format: StreamFormats["mp3"]}
+	track, err := StoreTranscodedTrackStream(ctx, handler, models.Track{ID: primitive.NewObjectID()}, file, transcoder, nil)
+	require.Nil(t, err)
+	require.Equal(t, Checksum(testFlac), track.Checksum)
+
+	original, err := handler.DownloadAudioFile(ctx, track.Original.AudioFileID)
+	require.Nil(t, err)
+	require.Equal(t, testFlac, original)
+	converted, err := handler.DownloadAudioFile(ctx, track.AudioFileID)
+	require.Nil(t, err)
+	require.Equal(t, testAudio, converted)
+}
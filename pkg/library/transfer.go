@@ -0,0 +1,276 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const manifestName = "library.json"
+
+// Manifest describes an exported library. Audio for each track is stored next to it as <audioFileID>.mp3.
+type Manifest struct {
+	Tracks    []models.Track    `json:"tracks"`
+	Playlists []models.Playlist `json:"playlists"`
+}
+
+// Export writes every track, its audio, and every playlist to dir.
+func Export(ctx context.Context, handler dao.DbHandler, dir string) (Manifest, error) {
+	var manifest Manifest
+
+	tracks, err := handler.GetTracks(ctx, map[string]interface{}{})
+	if err != nil {
+		return manifest, err
+	}
+	playlists, err := handler.GetPlaylists(ctx, map[string]interface{}{})
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Tracks, manifest.Playlists = tracks, playlists
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return manifest, err
+	}
+
+	for _, track := range tracks {
+		audio, err := handler.DownloadAudioFile(ctx, track.AudioFileID)
+		if err != nil {
+			return manifest, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, track.AudioFileID.Hex()+".mp3"), audio, 0644); err != nil {
+			return manifest, err
+		}
+	}
+
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, ioutil.WriteFile(filepath.Join(dir, manifestName), body, 0644)
+}
+
+// Import restores a library written by Export. Tracks and playlists keep their IDs so playlist references stay valid;
+// any that already exist are skipped. It returns the number of tracks and playlists added.
+func Import(ctx context.Context, handler dao.DbHandler, dir string) (int, int, error) {
+	body, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return 0, 0, err
+	}
+
+	addedTracks := 0
+	for _, track := range manifest.Tracks {
+		existing, err := handler.GetTracks(ctx, map[string]interface{}{"_id": track.ID})
+		if err != nil {
+			return addedTracks, 0, err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		audio, err := ioutil.ReadFile(filepath.Join(dir, track.AudioFileID.Hex()+".mp3"))
+		if err != nil {
+			return addedTracks, 0, err
+		}
+		// Only current audio is exported, so the restored track starts without version history.
+		track.Versions = nil
+		if _, err := StoreTrack(ctx, handler, track, audio); err != nil {
+			return addedTracks, 0, err
+		}
+		addedTracks++
+	}
+
+	addedPlaylists := 0
+	for _, playlist := range manifest.Playlists {
+		existing, err := handler.GetPlaylists(ctx, map[string]interface{}{"_id": playlist.ID})
+		if err != nil {
+			return addedTracks, addedPlaylists, err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		if err := handler.AddPlaylist(ctx, playlist); err != nil {
+			return addedTracks, addedPlaylists, err
+		}
+		addedPlaylists++
+	}
+
+	return addedTracks, addedPlaylists, nil
+}
+
+// audioExtensions are the file extensions ImportDirectory treats as audio.
+var audioExtensions = map[string]bool{".mp3": true, ".flac": true, ".ogg": true, ".opus": true, ".wav": true, ".m4a": true}
+
+// AudioProber reads the audio info and embedded tags of a file. service.AudioValidator implements it.
+type AudioProber interface {
+	Validate(ctx context.Context, audio io.Reader) (*models.AudioInfo, error)
+}
+
+// ErrAlreadyImported is returned by ImportFile for a file with the checksum of a track already in the library.
+var ErrAlreadyImported = errors.New("a track with the file's checksum is already in the library")
+
+// ProbeError is returned by ImportFile when its prober rejects the file or cannot read it.
+type ProbeError struct {
+	Err error
+}
+
+func (e ProbeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// ImportDirectory adds every audio file below dir to the library with ImportFile. Files with the checksum of a track
+// already in the library are skipped, as are files that are not audio, and files that cannot be read or probed are
+// reported as failed. It stops at the first error storing a track, returning what it did up to then.
+func ImportDirectory(ctx context.Context, handler dao.DbHandler, dir string, prober AudioProber) (models.DirectoryImportReport, error) {
+	var report models.DirectoryImportReport
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !IsAudioFile(path) {
+			return nil
+		}
+		name, _ := filepath.Rel(dir, path)
+		fail := func(err error) {
+			logrus.WithError(err).WithField("file", path).Warn("Skipping file that could not be imported")
+			report.Failed = append(report.Failed, models.DirectoryImportFailure{File: name, Error: err.Error()})
+		}
+
+		audio, err := ioutil.ReadFile(path)
+		if err != nil {
+			fail(err)
+			return nil
+		}
+
+		var probeErr ProbeError
+		_, err = ImportFile(ctx, handler, info.Name(), audio, prober)
+		switch {
+		case errors.Is(err, ErrAlreadyImported):
+			logrus.WithField("file", path).Info("Skipping file already imported")
+			report.Duplicates++
+		case errors.Is(err, ErrNotAudio):
+			logrus.WithField("file", path).Warn("Skipping file that is not audio")
+			report.NotAudio++
+		case errors.As(err, &probeErr):
+			fail(probeErr.Err)
+		case err != nil:
+			return err
+		default:
+			report.Imported++
+		}
+		return nil
+	})
+	return report, err
+}
+
+// IsAudioFile reports whether a file's extension is one ImportDirectory treats as audio.
+func IsAudioFile(path string) bool {
+	return audioExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// ImportFile adds the audio of a file to the library, returning the track stored. The track is named from the title,
+// artist, album, genre, track number and year tags prober finds in the file, falling back to the file's name; with a
+// nil prober the name is all there is to go on. It returns ErrAlreadyImported if a track with the file's checksum is
+// already in the library, ErrNotAudio if the file is not audio, and a ProbeError if the prober rejects it.
+func ImportFile(ctx context.Context, handler dao.DbHandler, fileName string, audio []byte, prober AudioProber) (models.Track, error) {
+	checksum := Checksum(audio)
+	existing, err := handler.GetTracks(ctx, map[string]interface{}{"checksum": checksum})
+	if err != nil {
+		return models.Track{}, err
+	}
+	if len(existing) > 0 {
+		return existing[0], ErrAlreadyImported
+	}
+
+	track := models.Track{
+		ID:       primitive.NewObjectID(),
+		Checksum: checksum,
+	}
+	if prober != nil {
+		if track.AudioInfo, err = prober.Validate(ctx, bytes.NewReader(audio)); err != nil {
+			return track, ProbeError{Err: err}
+		}
+	}
+	applyFileTags(&track)
+	if track.Name == "" {
+		track.Name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	ApplyTags(&track)
+	ApplyDefaults(&track)
+
+	return StoreTrack(ctx, handler, track, audio)
+}
+
+// applyFileTags fills in the name, artist, album, genre, track number and year of a track from the tags embedded in
+// its audio. Track numbers may be given out of the number of tracks, as "3/12", and dates as full dates.
+func applyFileTags(track *models.Track) {
+	if track.AudioInfo == nil {
+		return
+	}
+	tags := track.AudioInfo.Tags
+
+	track.Name = strings.TrimSpace(tags["title"])
+	track.Artist = strings.TrimSpace(tags["artist"])
+	track.AlbumName = strings.TrimSpace(tags["album"])
+	track.Genre = strings.TrimSpace(tags["genre"])
+	if number, err := strconv.Atoi(strings.TrimSpace(strings.SplitN(tags["track"], "/", 2)[0])); err == nil {
+		track.TrackNumber = number
+	}
+	if date := strings.TrimSpace(tags["date"]); len(date) >= 4 {
+		if year, err := strconv.Atoi(date[:4]); err == nil {
+			track.Year = year
+		}
+	}
+}
+
+// PurgeOrphans deletes stored audio files no longer referenced by any track. Files stored less than minAge ago are left
+// alone, as their track may not have been added yet. When dryRun is set the files are only reported. It returns the
+// IDs of the orphaned files.
+func PurgeOrphans(ctx context.Context, handler dao.DbHandler, dryRun bool, minAge time.Duration) ([]primitive.ObjectID, error) {
+	found, err := handler.FindOrphanedAudioFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// File IDs are minted when the file is stored, so they tell its age.
+	cutoff := time.Now().Add(-minAge)
+	var orphans []primitive.ObjectID
+	for _, id := range found {
+		if !id.Timestamp().After(cutoff) {
+			orphans = append(orphans, id)
+		}
+	}
+	if dryRun {
+		return orphans, nil
+	}
+
+	for _, id := range orphans {
+		if err := handler.DeleteAudioFile(ctx, id); err != nil {
+			return orphans, err
+		}
+	}
+	return orphans, nil
+}
@@ -0,0 +1,99 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"music-stream-api/pkg/dao"
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrVersionNotFound = errors.New("audio version not found")
+
+// ReplaceAudio uploads new audio for a track and keeps the audio it replaces as the newest version. At most retain
+// versions are kept, or all of them if retain is zero. The original the replaced audio was transcoded from and its
+// quality variants, if any, are deleted. The fingerprint and info, if any, are those of the new audio. It returns
+// ErrNotAudio if the new audio is not in a recognised format.
+func ReplaceAudio(ctx context.Context, handler dao.DbHandler, track models.Track, audio []byte, fingerprint []uint32, info *models.AudioInfo, retain int) (models.Track, error) {
+	container, codec, err := DetectFormat(audio)
+	if err != nil {
+		return track, err
+	}
+
+	audioID, err := handler.UploadAudioFile(ctx, audio, track.Name)
+	if err != nil {
+		return track, err
+	}
+
+	fileID, ok := audioID.(primitive.ObjectID)
+	if !ok {
+		return track, ErrInvalidAudioID
+	}
+
+	current := models.AudioVersion{AudioFileID: fileID, Container: container, Codec: codec, AudioInfo: info, Fingerprint: fingerprint}
+	versions := append([]models.AudioVersion{currentVersion(track)}, track.Versions...)
+	return setAudio(ctx, handler, track, current, versions, retain)
+}
+
+// RestoreVersion makes a previous version the track's current audio. The audio it replaces becomes the newest
+// version, so a restore can itself be undone.
+func RestoreVersion(ctx context.Context, handler dao.DbHandler, track models.Track, audioFileID primitive.ObjectID, retain int) (models.Track, error) {
+	versions := []models.AudioVersion{currentVersion(track)}
+	var restored *models.AudioVersion
+	for i, version := range track.Versions {
+		if version.AudioFileID == audioFileID {
+			restored = &track.Versions[i]
+			continue
+		}
+		versions = append(versions, version)
+	}
+	if restored == nil {
+		return track, ErrVersionNotFound
+	}
+
+	return setAudio(ctx, handler, track, *restored, versions, retain)
+}
+
+func currentVersion(track models.Track) models.AudioVersion {
+	return models.AudioVersion{
+		AudioFileID: track.AudioFileID,
+		Container:   track.Container,
+		Codec:       track.Codec,
+		AudioInfo:   track.AudioInfo,
+		Fingerprint: track.Fingerprint,
+		ReplacedAt:  time.Now(),
+	}
+}
+
+func setAudio(ctx context.Context, handler dao.DbHandler, track models.Track, current models.AudioVersion, versions []models.AudioVersion, retain int) (models.Track, error) {
+	var expired []models.AudioVersion
+	if retain > 0 && len(versions) > retain {
+		versions, expired = versions[:retain], versions[retain:]
+	}
+	if track.Original != nil {
+		expired = append(expired, models.AudioVersion{AudioFileID: track.Original.AudioFileID})
+		track.Original = nil
+	}
+	for _, variant := range track.Variants {
+		expired = append(expired, models.AudioVersion{AudioFileID: variant.AudioFileID})
+	}
+	track.Variants = nil
+
+	track.AudioFileID, track.Container, track.Codec = current.AudioFileID, current.Container, current.Codec
+	track.AudioInfo = current.AudioInfo
+	track.Fingerprint, track.Versions = current.Fingerprint, versions
+	if err := handler.SetTrackAudio(ctx, track.ID, track); err != nil {
+		return track, err
+	}
+
+	for _, version := range expired {
+		if err := handler.DeleteAudioFile(ctx, version.AudioFileID); err != nil {
+			logrus.WithError(err).WithField("audioFile", version.AudioFileID.Hex()).Warn("Error deleting expired audio version")
+		}
+	}
+	return track, nil
+}
@@ -1,31 +1,709 @@
 package models
 
 import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Track is a track of the library. Artist is its primary artist, and FeaturedArtists any others credited on it.
+// Checksum is the hex SHA-256 of the audio the track was uploaded with, for recognising a file imported before.
+// ReplayGain is set once the track's loudness has been analysed.
 type Track struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id"`
-	Name        string             `json:"name,omitempty" bson:"name,omitempty"`
-	Artist      string             `json:"artist,omitempty" bson:"artist,omitempty,omitempty"`
-	AlbumName   string             `json:"album,omitempty" bson:"album,omitempty"`
-	AudioFileID primitive.ObjectID `json:"audioFile,omitempty" bson:"audioFile,omitempty"`
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	Name            string             `json:"name,omitempty" bson:"name,omitempty"`
+	Artist          string             `json:"artist,omitempty" bson:"artist,omitempty"`
+	FeaturedArtists []string           `json:"featuredArtists,omitempty" bson:"featuredArtists,omitempty"`
+	AlbumName       string             `json:"album,omitempty" bson:"album,omitempty"`
+	AlbumArtist     string             `json:"albumArtist,omitempty" bson:"albumArtist,omitempty"`
+	Composer        string             `json:"composer,omitempty" bson:"composer,omitempty"`
+	Genre           string             `json:"genre,omitempty" bson:"genre,omitempty"`
+	IsCompilation   bool               `json:"isCompilation,omitempty" bson:"isCompilation,omitempty"`
+	TrackNumber     int                `json:"trackNumber,omitempty" bson:"trackNumber,omitempty"`
+	Year            int                `json:"year,omitempty" bson:"year,omitempty"`
+	ArtworkURL      string             `json:"artworkUrl,omitempty" bson:"artworkUrl,omitempty"`
+	ArtworkFileID   primitive.ObjectID `json:"artworkFile,omitempty" bson:"artworkFileId,omitempty"`
+	MusicBrainzID   string             `json:"musicBrainzId,omitempty" bson:"musicBrainzId,omitempty"`
+	Podcast         string             `json:"podcast,omitempty" bson:"podcast,omitempty"`
+	PodcastID       primitive.ObjectID `json:"podcastId,omitempty" bson:"podcastId,omitempty"`
+	EpisodeGUID     string             `json:"episodeGuid,omitempty" bson:"episodeGuid,omitempty"`
+	AudioFileID     primitive.ObjectID `json:"audioFile,omitempty" bson:"audioFileId,omitempty"`
+	Checksum        string             `json:"checksum,omitempty" bson:"checksum,omitempty"`
+	Container       string             `json:"container,omitempty" bson:"container,omitempty"`
+	Codec           string             `json:"codec,omitempty" bson:"codec,omitempty"`
+	AudioInfo       *AudioInfo         `json:"audioInfo,omitempty" bson:"audioInfo,omitempty"`
+	Original        *OriginalAudio     `json:"original,omitempty" bson:"original,omitempty"`
+	Variants        []AudioVariant     `json:"variants,omitempty" bson:"variants,omitempty"`
+	Tags            []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	Fingerprint     []uint32           `json:"-" bson:"fingerprint,omitempty"`
+	Trim            *SilenceTrim       `json:"trim,omitempty" bson:"trim,omitempty"`
+	ReplayGain      *ReplayGain        `json:"replayGain,omitempty" bson:"replayGain,omitempty"`
+	Versions        []AudioVersion     `json:"versions,omitempty" bson:"versions,omitempty"`
+	UploadedBy      string             `json:"uploadedBy,omitempty" bson:"uploadedBy,omitempty"`
+	Revision        int64              `json:"revision" bson:"revision"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt,omitempty"`
+	LastPlayedAt    *time.Time         `json:"lastPlayedAt,omitempty" bson:"lastPlayedAt,omitempty"`
+}
+
+// AudioVersion is audio a track used before it was replaced, newest first.
+type AudioVersion struct {
+	AudioFileID primitive.ObjectID `json:"audioFile" bson:"audioFileId"`
+	Container   string             `json:"container,omitempty" bson:"container,omitempty"`
+	Codec       string             `json:"codec,omitempty" bson:"codec,omitempty"`
+	AudioInfo   *AudioInfo         `json:"audioInfo,omitempty" bson:"audioInfo,omitempty"`
+	Fingerprint []uint32           `json:"-" bson:"fingerprint,omitempty"`
+	ReplacedAt  time.Time          `json:"replacedAt" bson:"replacedAt"`
+}
+
+// OriginalAudio is the audio a track was uploaded with, kept when the track was transcoded for streaming.
+type OriginalAudio struct {
+	AudioFileID primitive.ObjectID `json:"audioFile" bson:"audioFileId"`
+	Container   string             `json:"container,omitempty" bson:"container,omitempty"`
+	Codec       string             `json:"codec,omitempty" bson:"codec,omitempty"`
+	AudioInfo   *AudioInfo         `json:"audioInfo,omitempty" bson:"audioInfo,omitempty"`
+}
+
+// AudioVariant is a copy of a track's audio transcoded to another quality, such as a low bitrate for mobile data.
+type AudioVariant struct {
+	Quality     string             `json:"quality" bson:"quality"`
+	AudioFileID primitive.ObjectID `json:"audioFile" bson:"audioFileId"`
+	Container   string             `json:"container,omitempty" bson:"container,omitempty"`
+	Codec       string             `json:"codec,omitempty" bson:"codec,omitempty"`
+	BitRate     int                `json:"bitRate,omitempty" bson:"bitRate,omitempty"`
+}
+
+// SilenceTrim records the silence cut from the start and end of a track when it was imported. Durations are in
+// seconds.
+type SilenceTrim struct {
+	OriginalDuration float64 `json:"originalDuration" bson:"originalDuration"`
+	TrimmedDuration  float64 `json:"trimmedDuration" bson:"trimmedDuration"`
+	LeadingSilence   float64 `json:"leadingSilence" bson:"leadingSilence"`
+	TrailingSilence  float64 `json:"trailingSilence" bson:"trailingSilence"`
+}
+
+// ReplayGain is the loudness of a track's audio, measured to EBU R128, with the ReplayGain 2.0 gains that bring the
+// track, and its album, to the reference loudness of -18 LUFS. Loudness is in LUFS and gains in dB; peaks are true peaks
+// as a fraction of full scale, and Duration is in seconds. AudioFileID is the audio that was measured, so that audio
+// replaced since is measured again. A track on no album has the album gain and peak of its own.
+type ReplayGain struct {
+	AudioFileID primitive.ObjectID `json:"-" bson:"audioFileId"`
+	Loudness    float64            `json:"loudness" bson:"loudness"`
+	Duration    float64            `json:"duration" bson:"duration"`
+	TrackGain   float64            `json:"trackGain" bson:"trackGain"`
+	TrackPeak   float64            `json:"trackPeak" bson:"trackPeak"`
+	AlbumGain   float64            `json:"albumGain" bson:"albumGain"`
+	AlbumPeak   float64            `json:"albumPeak" bson:"albumPeak"`
+	AnalyzedAt  time.Time          `json:"analyzedAt" bson:"analyzedAt"`
+}
+
+// TrackChange is a change to a stored track. Track holds the track as it is after the change, and is nil once it has
+// been deleted.
+type TrackChange struct {
+	Operation string
+	Tenant    string
+	TrackID   primitive.ObjectID
+	Track     *Track
+}
+
+// PlaylistChange is a change to a stored playlist. Playlist holds the playlist as it is after the change, and is nil
+// once it has been deleted.
+type PlaylistChange struct {
+	Operation  string
+	Tenant     string
+	PlaylistID primitive.ObjectID
+	Playlist   *Playlist
+}
+
+// Event is a change to the library, as sent to clients following GET /events. Track or Playlist holds the document as
+// it is after the change, and neither is set once it has been deleted.
+type Event struct {
+	Type     string             `json:"type"`
+	ID       primitive.ObjectID `json:"id"`
+	Track    *Track             `json:"track,omitempty"`
+	Playlist *Playlist          `json:"playlist,omitempty"`
+}
+
+// PartySessionRequest is the body of POST /party, naming the playlist to listen to together.
+type PartySessionRequest struct {
+	Playlist primitive.ObjectID `json:"playlist"`
+}
+
+// PartySession is a group listening session, in which the host controls playback of a playlist for every listener.
+// Index is the position in Tracks of Track, the track playing. Position is how many seconds into it playback was at
+// UpdatedAt; while Playing, listeners add the time since then to stay in step.
+type PartySession struct {
+	ID        string               `json:"id"`
+	Host      string               `json:"host"`
+	Playlist  primitive.ObjectID   `json:"playlist"`
+	Tracks    []primitive.ObjectID `json:"tracks"`
+	Index     int                  `json:"index"`
+	Track     primitive.ObjectID   `json:"track"`
+	Playing   bool                 `json:"playing"`
+	Position  float64              `json:"position"`
+	Listeners []string             `json:"listeners"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// PartyCommand is a command the host of a party session sends over its WebSocket: "play", "pause", "seek" to Position,
+// "next" or "previous".
+type PartyCommand struct {
+	Action   string  `json:"action"`
+	Position float64 `json:"position,omitempty"`
+}
+
+// PartyMessage is sent to the clients of a party session over its WebSocket. Type is "state", with the session, when
+// a client connects and whenever the session changes, "ended" once the host ends it, and "error" for a command that
+// was refused. ServerTime lets clients allow for their clock differing from the server's.
+type PartyMessage struct {
+	Type       string        `json:"type"`
+	Session    *PartySession `json:"session,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	ServerTime time.Time     `json:"serverTime"`
+}
+
+// Suggestion is a track title, artist or album offered to type-ahead search, with the number of tracks it appears on.
+type Suggestion struct {
+	Kind  string `json:"kind" bson:"kind"`
+	Value string `json:"value" bson:"value"`
+	Count int    `json:"count" bson:"count"`
+}
+
+type DuplicatePlaylistRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+// PlaylistImportRequest is the body of POST /playlist/import/spotify. The playlist is named after the one imported
+// unless a name is given.
+type PlaylistImportRequest struct {
+	URL  string `json:"url"`
+	Name string `json:"name,omitempty"`
+}
+
+// PlaylistImport is a playlist imported from another service, made of the tracks of the library matching its entries,
+// with the entries no track matched left for adding by hand.
+type PlaylistImport struct {
+	Playlist  Playlist        `json:"playlist"`
+	Matched   int             `json:"matched"`
+	Unmatched []ExternalTrack `json:"unmatched"`
+}
+
+// ExternalPlaylist is a playlist on another service, such as Spotify.
+type ExternalPlaylist struct {
+	Name   string          `json:"name"`
+	Tracks []ExternalTrack `json:"tracks"`
+}
+
+// ExternalTrack is an entry of an ExternalPlaylist. Position is its index in the playlist, and Duration is in seconds.
+type ExternalTrack struct {
+	Position  int      `json:"position"`
+	Name      string   `json:"name"`
+	Artists   []string `json:"artists"`
+	AlbumName string   `json:"album,omitempty"`
+	Duration  float64  `json:"duration,omitempty"`
+}
+
+type PlaylistTracksRequest struct {
+	Tracks []primitive.ObjectID `json:"tracks"`
+}
+
+// PlaylistPositionRequest is the position in a playlist, counting from 0, to move a track to.
+type PlaylistPositionRequest struct {
+	Index *int `json:"index"`
+}
+
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type TrackMetadata struct {
+	Name          string `json:"name,omitempty"`
+	Artist        string `json:"artist,omitempty"`
+	AlbumName     string `json:"album,omitempty"`
+	Year          int    `json:"year,omitempty"`
+	ArtworkURL    string `json:"artworkUrl,omitempty"`
+	MusicBrainzID string `json:"musicBrainzId,omitempty"`
 }
 
 type Playlist struct {
-	ID     primitive.ObjectID   `json:"id" bson:"_id"`
-	Name   string               `json:"name" bson:"name"`
-	Tracks []primitive.ObjectID `json:"tracks,omitempty" bson:"tracks,omitempty"`
+	ID        primitive.ObjectID   `json:"id" bson:"_id"`
+	Name      string               `json:"name" bson:"name"`
+	Tracks    []primitive.ObjectID `json:"tracks,omitempty" bson:"tracks,omitempty"`
+	Revision  int64                `json:"revision" bson:"revision"`
+	CreatedBy string               `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	CreatedAt time.Time            `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt time.Time            `json:"updatedAt" bson:"updatedAt,omitempty"`
+}
+
+// PlaylistPage is a playlist with a page of its tracks, starting at Offset, filled in. Total counts the tracks of the
+// whole playlist.
+type PlaylistPage struct {
+	ID        primitive.ObjectID `json:"id"`
+	Name      string             `json:"name"`
+	Tracks    []Track            `json:"tracks"`
+	Offset    int                `json:"offset"`
+	Total     int                `json:"total"`
+	Revision  int64              `json:"revision"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+type Podcast struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Title      string             `json:"title" bson:"title"`
+	FeedURL    string             `json:"feedUrl" bson:"feedUrl"`
+	LastPolled time.Time          `json:"lastPolled,omitempty" bson:"lastPolled,omitempty"`
+}
+
+type PodcastFeed struct {
+	Title    string
+	Episodes []PodcastEpisode
+}
+
+type PodcastEpisode struct {
+	GUID        string
+	Title       string
+	AudioURL    string
+	PublishedAt time.Time
+}
+
+type APIKey struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Name      string             `json:"name" bson:"name"`
+	KeyHash   string             `json:"-" bson:"keyHash"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	// StreamThrottle overrides the multiple of a track's bit rate audio is streamed to the key at. Zero keeps the
+	// server's setting, and a negative value streams without limit.
+	StreamThrottle float64 `json:"streamThrottle,omitempty" bson:"streamThrottle,omitempty"`
+	// Role sets the rate limits the key is held to. Keys without one are treated as a listener's.
+	Role string `json:"role,omitempty" bson:"role,omitempty"`
+}
+
+// Roles a token can have, from the most to the least trusted. Each has its own request and bandwidth budget.
+const (
+	RoleAdmin    = "admin"
+	RoleUploader = "uploader"
+	RoleListener = "listener"
+	RoleGuest    = "guest"
+)
+
+// Roles are the roles a token can have.
+var Roles = []string{RoleAdmin, RoleUploader, RoleListener, RoleGuest}
+
+// Identity is who a validated token was issued to.
+type Identity struct {
+	// UserID is the token's "sub" claim, or for an API key "apikey:" followed by the key's id. It is empty for opaque
+	// tokens, which say nothing about their user.
+	UserID string
+	// Claims are the claims of a JWT, which can be trusted once the token has been validated.
+	Claims map[string]interface{}
+	// APIKey is the key an API key token was found as, carrying its role and stream throttle. It is nil for other
+	// tokens.
+	APIKey *APIKey
+}
+
+// Share records a public link to a single track or playlist. A MaxPlays of zero means the link can be played any
+// number of times until it expires.
+type Share struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Kind       string             `json:"kind" bson:"kind"`
+	ResourceID primitive.ObjectID `json:"resourceId" bson:"resourceId"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time          `json:"expiresAt" bson:"expiresAt"`
+	MaxPlays   int                `json:"maxPlays,omitempty" bson:"maxPlays"`
+	Plays      int                `json:"plays" bson:"plays"`
+}
+
+// ErrorResponse is the body of every error response. Code is stable for clients to match on, while Message is for
+// people and may change.
+type ErrorResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// FieldError explains why one field of a request was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// TrackUpdateRequest is the metadata to set on a track, and the revision of the track it was based on.
+type TrackUpdateRequest struct {
+	Track
+	Revision *int64 `json:"revision"`
+}
+
+// LogLevel is the server's log level, such as debug or info.
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// SeedResult counts the demo tracks and playlists added by seeding, which leaves out any already there.
+type SeedResult struct {
+	Tracks    int `json:"tracks"`
+	Playlists int `json:"playlists"`
+}
+
+// OrphanPurgeRequest asks for the stored audio files no track references to be deleted, or with DryRun only listed.
+type OrphanPurgeRequest struct {
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// OrphanReport lists the orphaned audio files found, and whether they were deleted.
+type OrphanReport struct {
+	Files   []primitive.ObjectID `json:"files"`
+	Deleted bool                 `json:"deleted"`
+}
+
+// RestoreReport is what restoring a backup did with each of its sections, under the conflict policy it was restored
+// with.
+type RestoreReport struct {
+	Conflict string                   `json:"conflict"`
+	Counts   map[string]RestoreCounts `json:"counts"`
+}
+
+// RestoreCounts counts the items of a section of a backup by what restoring them did. Restored items were added as they
+// were, Overwritten ones replaced the item with their ID, Duplicated ones were added under a new ID beside it, and
+// Skipped ones were left out.
+type RestoreCounts struct {
+	Restored    int `json:"restored"`
+	Overwritten int `json:"overwritten"`
+	Duplicated  int `json:"duplicated"`
+	Skipped     int `json:"skipped"`
+}
+
+// DirectoryImportRequest is the body of POST /admin/import-directory. Path is the directory to import, relative to the
+// directory imports are allowed from.
+type DirectoryImportRequest struct {
+	Path string `json:"path"`
+}
+
+// DirectoryImportReport summarises importing a directory of audio files. Imported files were added as tracks,
+// Duplicates were skipped as a track with the same checksum is already in the library, NotAudio were skipped as they
+// are not in a recognised format, and Failed lists the files that could not be read or probed.
+type DirectoryImportReport struct {
+	Imported   int                      `json:"imported"`
+	Duplicates int                      `json:"duplicates"`
+	NotAudio   int                      `json:"notAudio"`
+	Failed     []DirectoryImportFailure `json:"failed,omitempty"`
+}
+
+// DirectoryImportFailure is a file a directory import could not add, with the reason why. File is relative to the
+// imported directory.
+type DirectoryImportFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// ScheduledTask is the state of one of a replica's maintenance tasks. LastDuration is in seconds, and LastError is empty
+// if the last run succeeded.
+type ScheduledTask struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration float64    `json:"lastDuration,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+// LibraryStats are the figures for a tenant's library, as last worked out by the stats task.
+type LibraryStats struct {
+	Tenant       string    `json:"tenant,omitempty"`
+	Tracks       int       `json:"tracks"`
+	Playlists    int       `json:"playlists"`
+	Duration     float64   `json:"duration"`
+	PlaysLastDay int       `json:"playsLastDay"`
+	AggregatedAt time.Time `json:"aggregatedAt"`
+}
+
+// OffsiteBackupStatus is how pushing incremental backups to object storage has gone on this replica. Documents and
+// Files count what the last successful run uploaded across every tenant, and LastError is empty if the last run
+// succeeded.
+type OffsiteBackupStatus struct {
+	Bucket        string     `json:"bucket"`
+	LastRunAt     *time.Time `json:"lastRunAt,omitempty"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	Documents     int        `json:"documents"`
+	Files         int        `json:"files"`
+}
+
+// AdminStats reports on the running replica for operators.
+type AdminStats struct {
+	DeprecatedEndpoints []DeprecatedEndpointUsage `json:"deprecatedEndpoints"`
+	Libraries           []LibraryStats            `json:"libraries,omitempty"`
+	OffsiteBackup       *OffsiteBackupStatus      `json:"offsiteBackup,omitempty"`
+}
+
+// DeprecatedEndpointUsage counts the calls a replica has served to an endpoint due to be removed since it started, so
+// that it is known when the endpoint can go without breaking anyone.
+type DeprecatedEndpointUsage struct {
+	Endpoint      string     `json:"endpoint"`
+	Successor     string     `json:"successor"`
+	Sunset        time.Time  `json:"sunset"`
+	DaysRemaining int        `json:"daysRemaining"`
+	Calls         int64      `json:"calls"`
+	LastCalledAt  *time.Time `json:"lastCalledAt,omitempty"`
+}
+
+type ShareRequest struct {
+	ExpiresIn string `json:"expiresIn,omitempty"`
+	MaxPlays  int    `json:"maxPlays,omitempty"`
+}
+
+type ShareLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	MaxPlays  int       `json:"maxPlays,omitempty"`
+}
+
+// OEmbed is an oEmbed response describing a shared link, as defined at https://oembed.com.
+type OEmbed struct {
+	Type         string `json:"type"`
+	Version      string `json:"version"`
+	Title        string `json:"title,omitempty"`
+	AuthorName   string `json:"author_name,omitempty"`
+	ProviderName string `json:"provider_name,omitempty"`
+	ProviderURL  string `json:"provider_url,omitempty"`
+	CacheAge     int64  `json:"cache_age,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+type GuestTokenRequest struct {
+	ExpiresIn string `json:"expiresIn,omitempty"`
+}
+
+// GuestToken is a bearer token that can only list and stream the tracks of one playlist, at /guest/playlist and
+// /guest/track/{id}.
+type GuestToken struct {
+	Token      string             `json:"token"`
+	PlaylistID primitive.ObjectID `json:"playlistId"`
+	ExpiresAt  time.Time          `json:"expiresAt"`
+}
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a unit of background work, such as an import, run by whichever worker claims it first. A worker holds a job
+// until LockedUntil and keeps extending that while it runs, so the job of a worker that dies is picked up again once
+// the lease runs out. Failed attempts are retried at RunAt until MaxAttempts is reached. QueuePosition is the place of
+// a running job in the queue for an ffmpeg slot while it waits for one, and Progress the percentage of its conversion
+// done once it has one.
+type Job struct {
+	ID            primitive.ObjectID   `json:"id" bson:"_id"`
+	Kind          string               `json:"kind" bson:"kind"`
+	Tenant        string               `json:"-" bson:"tenant"`
+	CreatedBy     string               `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	Status        string               `json:"status" bson:"status"`
+	Payload       bson.Raw             `json:"-" bson:"payload,omitempty"`
+	Attempts      int                  `json:"attempts" bson:"attempts"`
+	MaxAttempts   int                  `json:"maxAttempts" bson:"maxAttempts"`
+	RunAt         time.Time            `json:"runAt" bson:"runAt"`
+	LockedBy      string               `json:"-" bson:"lockedBy,omitempty"`
+	LockedUntil   time.Time            `json:"-" bson:"lockedUntil,omitempty"`
+	Error         string               `json:"error,omitempty" bson:"error,omitempty"`
+	TrackIDs      []primitive.ObjectID `json:"trackIds,omitempty" bson:"trackIds,omitempty"`
+	QueuePosition int                  `json:"queuePosition,omitempty" bson:"queuePosition,omitempty"`
+	Progress      float64              `json:"progress,omitempty" bson:"progress,omitempty"`
+	CreatedAt     time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt" bson:"updatedAt"`
+	FinishedAt    *time.Time           `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+}
+
+// Play is a single listen to a track, reported by the client once playback is under way.
+type Play struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	TrackID  primitive.ObjectID `json:"trackId" bson:"trackId"`
+	PlayedAt time.Time          `json:"playedAt" bson:"playedAt"`
+}
+
+type PlayCount struct {
+	TrackID    primitive.ObjectID `json:"trackId" bson:"_id"`
+	Plays      int                `json:"plays" bson:"plays"`
+	LastPlayed time.Time          `json:"lastPlayed" bson:"lastPlayed"`
+}
+
+const (
+	NowPlayingPrivate = "private"
+	NowPlayingPublic  = "public"
+)
+
+// NowPlaying is what a user is listening to, as last reported by one of their devices, so that another device can take
+// over where it left off. Position is in seconds, as of UpdatedAt. Visibility is NowPlayingPrivate, for the user alone,
+// or NowPlayingPublic, for anyone in the library. Track is the track itself, filled in when the state is read back.
+type NowPlaying struct {
+	User       string             `json:"user" bson:"_id"`
+	TrackID    primitive.ObjectID `json:"trackId" bson:"trackId"`
+	Position   float64            `json:"position" bson:"position"`
+	Playing    bool               `json:"playing" bson:"playing"`
+	Device     string             `json:"device,omitempty" bson:"device,omitempty"`
+	Visibility string             `json:"visibility" bson:"visibility"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt"`
+	Track      *Track             `json:"track,omitempty" bson:"-"`
+}
+
+// NowPlayingRequest is the body of PUT /me/now-playing. A Visibility left empty keeps the one set before.
+type NowPlayingRequest struct {
+	TrackID    primitive.ObjectID `json:"trackId"`
+	Position   float64            `json:"position"`
+	Playing    bool               `json:"playing"`
+	Device     string             `json:"device"`
+	Visibility string             `json:"visibility"`
+}
+
+// Recommendation is a track suggested from listening history, with the reasons it was picked.
+type Recommendation struct {
+	Track   Track    `json:"track"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// Album groups the tracks of an album, listed in track number order. Artist is the album artist, which for
+// compilations without one is "Various Artists". ID is derived from the artist and name, so it is stable for as long
+// as they are.
+type Album struct {
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Artist        string               `json:"artist"`
+	IsCompilation bool                 `json:"isCompilation,omitempty"`
+	Year          int                  `json:"year,omitempty"`
+	ArtworkURL    string               `json:"artworkUrl,omitempty"`
+	ArtworkFileID primitive.ObjectID   `json:"artworkFile,omitempty"`
+	Tracks        []primitive.ObjectID `json:"tracks"`
+}
+
+// Artist is an artist of the library, with the number of tracks they are the primary artist of and the number they are
+// featured on.
+type Artist struct {
+	Name     string `json:"name"`
+	Tracks   int    `json:"tracks"`
+	Featured int    `json:"featured"`
+}
+
+type StreamURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ScanResult is the verdict of an upload scanner. Signature names the threat found when the file is not clean.
+type ScanResult struct {
+	Scanner   string `json:"scanner"`
+	Clean     bool   `json:"clean"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// AudioInfo is the technical metadata ffprobe reports for a file of audio. BitRate is in bits per second and Duration
+// in seconds. It is probed when audio is uploaded and stored with the track. Tags holds the metadata embedded in the
+// file, keyed by lower-cased tag name; it is only used to fill in the track when it is stored, so is not kept itself.
+type AudioInfo struct {
+	Container  string            `json:"container" bson:"container"`
+	Codec      string            `json:"codec" bson:"codec"`
+	BitRate    int               `json:"bitRate,omitempty" bson:"bitRate,omitempty"`
+	SampleRate int               `json:"sampleRate" bson:"sampleRate"`
+	Channels   int               `json:"channels" bson:"channels"`
+	Duration   float64           `json:"duration" bson:"duration"`
+	Tags       map[string]string `json:"-" bson:"-"`
+}
+
+// Fingerprint is a Chromaprint acoustic fingerprint. Raw holds the uncompressed sub-fingerprints, one per ~0.124s of
+// audio, and Encoded the compressed form AcoustID expects.
+type Fingerprint struct {
+	Duration float64
+	Raw      []uint32
+	Encoded  string
+}
+
+type TrackMatch struct {
+	Track Track   `json:"track"`
+	Score float64 `json:"score"`
+}
+
+type AcoustIDMatch struct {
+	ID            string  `json:"id"`
+	Score         float64 `json:"score"`
+	MusicBrainzID string  `json:"musicBrainzId,omitempty"`
+	Name          string  `json:"name,omitempty"`
+	Artist        string  `json:"artist,omitempty"`
+}
+
+type IdentifyResult struct {
+	Matches  []TrackMatch    `json:"matches"`
+	AcoustID []AcoustIDMatch `json:"acoustId,omitempty"`
 }
 
 type YoutubeRequest struct {
-	Name        string `json:"name,omitempty"`
-	Artist      string `json:"artist,omitempty"`
-	AlbumName   string `json:"album,omitempty"`
-	YoutubeLink string `json:"youtubeLink"`
+	Name            string   `json:"name,omitempty"`
+	Artist          string   `json:"artist,omitempty"`
+	FeaturedArtists []string `json:"featuredArtists,omitempty"`
+	AlbumName       string   `json:"album,omitempty"`
+	YoutubeLink     string   `json:"youtubeLink"`
+	Enrichment      string   `json:"enrichment,omitempty"`
+	TrimSilence     bool     `json:"trimSilence,omitempty"`
+	SplitChapters   bool     `json:"splitChapters,omitempty"`
+	Quality         string   `json:"quality,omitempty"`
 }
 
 type UploadRequest struct {
 	YoutubeRequest `json:"youtubeRequest"`
 	AudioBytes     []byte `json:"audioBytes"`
 }
+
+// ImportRequest asks for tracks to be imported from a source, such as a YouTube video or an uploaded file. The fields
+// that apply depend on the source; the audio of a file and the credentials for a URL are not kept when the request is
+// queued as a job.
+type ImportRequest struct {
+	Source         string `json:"source"`
+	YoutubeRequest `bson:",inline"`
+	AudioBytes     []byte `json:"audioBytes,omitempty" bson:"-"`
+	URL            string `json:"url,omitempty" bson:"url,omitempty"`
+	Username       string `json:"username,omitempty" bson:"-"`
+	Password       string `json:"password,omitempty" bson:"-"`
+}
+
+// ReencodeRequest asks for the tracks matching Filter to be re-encoded to one of the streaming formats, at BitRate
+// (such as "128k") or the format's default. The re-encoded audio replaces each track's audio, or is stored as the
+// variant Quality if one is given. A DryRun only estimates the space it would save.
+type ReencodeRequest struct {
+	Filter  ReencodeFilter `json:"filter" bson:"filter"`
+	Format  string         `json:"format" bson:"format"`
+	BitRate string         `json:"bitRate,omitempty" bson:"bitRate,omitempty"`
+	Quality string         `json:"quality,omitempty" bson:"quality,omitempty"`
+	DryRun  bool           `json:"dryRun,omitempty" bson:"-"`
+}
+
+// ReencodeFilter picks the tracks a re-encode applies to. Each field that is set must match: BitRateAbove, in bits
+// per second, by the track's probed audio info, and Codecs and Tag by any of them.
+type ReencodeFilter struct {
+	BitRateAbove int      `json:"bitRateAbove,omitempty" bson:"bitRateAbove,omitempty"`
+	Codecs       []string `json:"codecs,omitempty" bson:"codecs,omitempty"`
+	Tag          string   `json:"tag,omitempty" bson:"tag,omitempty"`
+}
+
+// ReplayGainRequest asks for the loudness of tracks to be analysed: those never analysed or whose audio has changed
+// since, or every track if All is set.
+type ReplayGainRequest struct {
+	All bool `json:"all,omitempty" bson:"all,omitempty"`
+}
+
+// ReencodeEstimate is what a re-encode would do. Byte counts are worked out from the bit rate and duration of each
+// track's audio, so tracks without probed audio info are counted in Unprobed and left out of them. SavedBytes is
+// negative when variants are added.
+type ReencodeEstimate struct {
+	Tracks         int   `json:"tracks"`
+	Unprobed       int   `json:"unprobed"`
+	CurrentBytes   int64 `json:"currentBytes"`
+	ReencodedBytes int64 `json:"reencodedBytes"`
+	SavedBytes     int64 `json:"savedBytes"`
+}
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a task next runs.
+type Schedule interface {
+	// Next returns the first time the task is due after the given one.
+	Next(after time.Time) time.Time
+}
+
+// every runs a task at a fixed interval from when the scheduler started, or from its last run.
+type every time.Duration
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// cron runs a task at the minutes matching all of its fields, in local time. Like cron(8), a day matches if either the
+// day of the month or the day of the week does, when neither field starts with "*".
+type cron struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	anyDayOfMonth, anyDayOfWeek                bool
+}
+
+// cronFields are the bounds of the five fields of a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// Parse reads a schedule: either a five-field cron expression ("minute hour day-of-month month day-of-week", each field
+// a "*", a number, a range such as "1-5", or a list of them, optionally stepped as in "*/15"), "@every" followed by a
+// duration such as "@every 30m", or one of @hourly, @daily and @weekly.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		} else if interval < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: the interval must be at least a second", spec)
+		}
+		return every(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: expected %v fields", spec, len(cronFields))
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v: %w", spec, cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	return cron{
+		minute:        sets[0],
+		hour:          sets[1],
+		dayOfMonth:    sets[2],
+		month:         sets[3],
+		dayOfWeek:     sets[4],
+		anyDayOfMonth: strings.HasPrefix(fields[2], "*"),
+		anyDayOfWeek:  strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseField returns the values a cron field matches as a bit set.
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				// As in cron(8), "5/15" means from 5 to the end of the range.
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, errors.New("value out of range")
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every combination of fields recurs within a few years; one that never does, such as 30 February, gives up.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c cron) matchesDay(t time.Time) bool {
+	dayOfMonth := c.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := c.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.anyDayOfMonth && c.anyDayOfWeek:
+		return true
+	case c.anyDayOfMonth:
+		return dayOfWeek
+	case c.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule_Parse_ShouldRejectInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every soon", "@every 1ms", "@monthly"} {
+		_, err := Parse(spec)
+		require.NotNil(t, err, spec)
+	}
+}
+
+func TestSchedule_Next_ShouldFindNextMatchingMinute(t *testing.T) {
+	after := time.Date(2026, time.January, 31, 23, 50, 30, 0, time.UTC)
+	for spec, expected := range map[string]time.Time{
+		"*/15 * * * *":   time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"0 3 * * *":      time.Date(2026, time.February, 1, 3, 0, 0, 0, time.UTC),
+		"55 23 * * *":    time.Date(2026, time.January, 31, 23, 55, 0, 0, time.UTC),
+		"@hourly":        time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"30 9 * * 1-5":   time.Date(2026, time.February, 2, 9, 30, 0, 0, time.UTC),
+		"0 0 13 * 5":     time.Date(2026, time.February, 6, 0, 0, 0, 0, time.UTC),
+		"0 12 29 2 *":    time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC),
+		"@every 90m":     after.Add(90 * time.Minute),
+		"5,10 0 1 1,2 *": time.Date(2026, time.February, 1, 0, 5, 0, 0, time.UTC),
+	} {
+		schedule, err := Parse(spec)
+		require.Nil(t, err, spec)
+		require.Equal(t, expected, schedule.Next(after), spec)
+	}
+}
+
+func TestSchedule_Next_ShouldGiveUpOnImpossibleDates(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	require.Nil(t, err)
+	require.True(t, schedule.Next(time.Now()).IsZero())
+}
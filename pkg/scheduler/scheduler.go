@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Func runs one pass of a maintenance task.
+type Func func(ctx context.Context) error
+
+type task struct {
+	name     string
+	spec     string
+	schedule Schedule
+	run      Func
+
+	running      bool
+	nextRun      time.Time
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastErr      error
+}
+
+// Scheduler runs maintenance tasks on their schedules for as long as the replica runs, and keeps the outcome of each
+// task's last run for operators. A task never overlaps itself: a run that takes longer than the gap to its next due
+// time makes it skip the runs it missed.
+type Scheduler struct {
+	mu    sync.Mutex
+	tasks map[string]*task
+}
+
+func New() *Scheduler {
+	return &Scheduler{tasks: make(map[string]*task)}
+}
+
+// Add registers a task to run on the schedule spec, as read by Parse. An empty spec or "off" leaves the task disabled.
+func (s *Scheduler) Add(name string, spec string, run Func) error {
+	if spec == "" || spec == "off" {
+		return nil
+	}
+
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("task %v: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("task %v is already scheduled", name)
+	}
+	s.tasks[name] = &task{name: name, spec: spec, schedule: schedule, run: run}
+	return nil
+}
+
+// Run runs every task on its schedule until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	var wg sync.WaitGroup
+	for _, t := range s.tasks {
+		wg.Add(1)
+		go func(t *task) {
+			defer wg.Done()
+			s.loop(ctx, t)
+		}(t)
+	}
+	s.mu.Unlock()
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, t *task) {
+	for {
+		s.mu.Lock()
+		next := t.schedule.Next(time.Now())
+		t.nextRun = next
+		s.mu.Unlock()
+		if next.IsZero() {
+			logrus.WithField("task", t.name).Warn("Scheduled task never falls due")
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.runOnce(ctx, t)
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, t *task) {
+	s.mu.Lock()
+	t.running = true
+	s.mu.Unlock()
+
+	logger := logrus.WithField("task", t.name)
+	logger.Debug("Running scheduled task")
+	started := time.Now()
+	err := t.run(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Scheduled task failed")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.running = false
+	t.lastRun = started
+	t.lastDuration = time.Since(started)
+	t.lastErr = err
+}
+
+// Status reports on every scheduled task, by name.
+func (s *Scheduler) Status() []models.ScheduledTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]models.ScheduledTask, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		status := models.ScheduledTask{Name: t.name, Schedule: t.spec, Running: t.running}
+		if !t.nextRun.IsZero() {
+			next := t.nextRun
+			status.NextRun = &next
+		}
+		if !t.lastRun.IsZero() {
+			last := t.lastRun
+			status.LastRun = &last
+			status.LastDuration = t.lastDuration.Seconds()
+		}
+		if t.lastErr != nil {
+			status.LastError = t.lastErr.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
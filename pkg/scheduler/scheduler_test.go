@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_Add_ShouldSkipDisabledTasks(t *testing.T) {
+	s := New()
+	require.Nil(t, s.Add("test", "off", nil))
+	require.Nil(t, s.Add("test", "", nil))
+	require.Empty(t, s.Status())
+
+	require.NotNil(t, s.Add("test", "never", nil))
+	require.Nil(t, s.Add("test", "@hourly", nil))
+	require.NotNil(t, s.Add("test", "@daily", nil))
+}
+
+func TestScheduler_Run_ShouldRecordOutcomeOfLastRun(t *testing.T) {
+	s := New()
+	ran := make(chan struct{}, 1)
+	require.Nil(t, s.Add("test", "@every 1s", func(ctx context.Context) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return errors.New("disk full")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task did not run")
+	}
+	require.Eventually(t, func() bool {
+		status := s.Status()
+		return len(status) == 1 && status[0].LastRun != nil && !status[0].Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := s.Status()[0]
+	require.Equal(t, "test", status.Name)
+	require.Equal(t, "@every 1s", status.Schedule)
+	require.Equal(t, "disk full", status.LastError)
+	require.NotNil(t, status.NextRun)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"music-stream-api/pkg/models"
+)
+
+// AcoustIDHandler looks fingerprints up in the AcoustID database, returning the MusicBrainz recordings they match.
+type AcoustIDHandler struct {
+	HttpClient Requestor
+	URL        string
+	APIKey     string
+}
+
+type acoustIDLookupResponse struct {
+	Status string `json:"status"`
+	Error  struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Results []struct {
+		ID         string  `json:"id"`
+		Score      float64 `json:"score"`
+		Recordings []struct {
+			ID      string `json:"id"`
+			Title   string `json:"title"`
+			Artists []struct {
+				Name string `json:"name"`
+			} `json:"artists"`
+		} `json:"recordings"`
+	} `json:"results"`
+}
+
+func (a *AcoustIDHandler) Identify(ctx context.Context, fingerprint *models.Fingerprint) ([]models.AcoustIDMatch, error) {
+	if a.URL == "" {
+		return nil, errors.New("acoustid url cannot be empty")
+	}
+	if fingerprint == nil || fingerprint.Encoded == "" {
+		return nil, errors.New("fingerprint cannot be empty")
+	}
+
+	form := url.Values{}
+	form.Set("client", a.APIKey)
+	form.Set("meta", "recordings")
+	form.Set("format", "json")
+	form.Set("duration", strconv.Itoa(int(fingerprint.Duration)))
+	form.Set("fingerprint", fingerprint.Encoded)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%v/lookup", a.URL), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var lookup acoustIDLookupResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lookup); err != nil {
+		return nil, err
+	}
+	if lookup.Status != "ok" {
+		return nil, fmt.Errorf("acoustid lookup failed: %v", lookup.Error.Message)
+	}
+
+	matches := []models.AcoustIDMatch{}
+	for _, result := range lookup.Results {
+		if len(result.Recordings) == 0 {
+			matches = append(matches, models.AcoustIDMatch{ID: result.ID, Score: result.Score})
+			continue
+		}
+
+		for _, recording := range result.Recordings {
+			var artists []string
+			for _, artist := range recording.Artists {
+				artists = append(artists, artist.Name)
+			}
+
+			matches = append(matches, models.AcoustIDMatch{
+				ID:            result.ID,
+				Score:         result.Score,
+				MusicBrainzID: recording.ID,
+				Name:          recording.Title,
+				Artist:        strings.Join(artists, ", "),
+			})
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testFingerprint = &models.Fingerprint{Duration: 180.5, Raw: []uint32{1}, Encoded: "AQAAAQE"}
+
+func TestAcoustID_Identify_ShouldReturnErrorIfURLIsEmpty(t *testing.T) {
+	handler := AcoustIDHandler{HttpClient: &mocks.Requestor{}}
+
+	_, err := handler.Identify(context.Background(), testFingerprint)
+	require.NotNil(t, err)
+	require.Equal(t, "acoustid url cannot be empty", err.Error())
+}
+
+func TestAcoustID_Identify_ShouldReturnErrorIfErrorOccursPerformingRequest(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := AcoustIDHandler{HttpClient: requestor, URL: "http://test"}
+
+	_, err := handler.Identify(context.Background(), testFingerprint)
+	require.NotNil(t, err)
+}
+
+func TestAcoustID_Identify_ShouldReturnErrorIfLookupFails(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusBadRequest, `{"status":"error","error":{"message":"invalid API key"}}`), nil)
+
+	handler := AcoustIDHandler{HttpClient: requestor, URL: "http://test"}
+
+	_, err := handler.Identify(context.Background(), testFingerprint)
+	require.NotNil(t, err)
+	require.Equal(t, "acoustid lookup failed: invalid API key", err.Error())
+}
+
+func TestAcoustID_Identify_ShouldReturnRecordingsOnSuccess(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		body, _ := ioutil.ReadAll(req.Body)
+		return req.URL.String() == "http://test/lookup" &&
+			string(body) == "client=key&duration=180&fingerprint=AQAAAQE&format=json&meta=recordings"
+	})).Return(jsonResponse(http.StatusOK, `{"status":"ok","results":[{"id":"a1","score":0.95,"recordings":[
+		{"id":"mbid","title":"Song","artists":[{"name":"One"},{"name":"Two"}]}]}]}`), nil)
+
+	handler := AcoustIDHandler{HttpClient: requestor, URL: "http://test", APIKey: "key"}
+
+	matches, err := handler.Identify(context.Background(), testFingerprint)
+	require.Nil(t, err)
+	require.Equal(t, []models.AcoustIDMatch{{ID: "a1", Score: 0.95, MusicBrainzID: "mbid", Name: "Song", Artist: "One, Two"}}, matches)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"music-stream-api/pkg/models"
+)
+
+const apiKeyPrefix = "msk_"
+
+type APIKeyStore interface {
+	GetAPIKeys(ctx context.Context, filters map[string]interface{}) ([]models.APIKey, error)
+}
+
+// APIKeyHandler accepts API keys created with musicctl in place of login service tokens. Any token that is not an API
+// key is passed on to Next.
+type APIKeyHandler struct {
+	Keys APIKeyStore
+	Next ExtHandler
+}
+
+func (a *APIKeyHandler) ValidateToken(ctx context.Context, token string) (models.Identity, error) {
+	if !IsAPIKey(token) {
+		return a.Next.ValidateToken(ctx, token)
+	}
+
+	keys, err := a.Keys.GetAPIKeys(ctx, map[string]interface{}{"keyHash": HashAPIKey(token)})
+	if err != nil {
+		return models.Identity{}, err
+	}
+	if len(keys) == 0 {
+		return models.Identity{}, errors.New("invalid api key")
+	}
+	return models.Identity{UserID: "apikey:" + keys[0].ID.Hex(), APIKey: &keys[0]}, nil
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a login service token.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// GenerateAPIKey returns a new random API key along with the hash under which it should be stored. The key itself is
+// never stored.
+func GenerateAPIKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	key := apiKeyPrefix + hex.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
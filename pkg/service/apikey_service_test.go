@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAPIKey_ValidateToken_ShouldPassNonAPIKeyTokensToNextHandler(t *testing.T) {
+	next := &mocks.ExtHandler{}
+	next.On("ValidateToken", mock.Anything, "token").Return(models.Identity{}, errors.New("test"))
+
+	handler := APIKeyHandler{Keys: &mocks.DbHandler{}, Next: next}
+
+	_, err := handler.ValidateToken(context.Background(), "token")
+	require.NotNil(t, err)
+	require.Equal(t, "test", err.Error())
+}
+
+func TestAPIKey_ValidateToken_ShouldReturnErrorIfKeyIsUnknown(t *testing.T) {
+	keys := &mocks.DbHandler{}
+	keys.On("GetAPIKeys", mock.Anything, mock.Anything).Return([]models.APIKey{}, nil)
+
+	handler := APIKeyHandler{Keys: keys, Next: &mocks.ExtHandler{}}
+
+	_, err := handler.ValidateToken(context.Background(), "msk_test")
+	require.NotNil(t, err)
+	require.Equal(t, "invalid api key", err.Error())
+}
+
+func TestAPIKey_ValidateToken_ShouldReturnKeyIdentityIfKeyHashIsStored(t *testing.T) {
+	key, hash, err := GenerateAPIKey()
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(key, "msk_"))
+
+	id := primitive.NewObjectID()
+	keys := &mocks.DbHandler{}
+	keys.On("GetAPIKeys", mock.Anything, map[string]interface{}{"keyHash": hash}).Return([]models.APIKey{{ID: id, Name: "test", Role: models.RoleUploader}}, nil)
+
+	handler := APIKeyHandler{Keys: keys, Next: &mocks.ExtHandler{}}
+
+	identity, err := handler.ValidateToken(context.Background(), key)
+	require.Nil(t, err)
+	require.Equal(t, "apikey:"+id.Hex(), identity.UserID)
+	require.NotNil(t, identity.APIKey)
+	require.Equal(t, models.RoleUploader, identity.APIKey.Role)
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"music-stream-api/pkg/models"
+)
+
+// ErrInvalidAudio is wrapped by the errors validators return for audio that cannot be played, as opposed to failing to
+// check it.
+var ErrInvalidAudio = errors.New("invalid audio")
+
+type AudioValidator interface {
+	Validate(ctx context.Context, audio io.Reader) (*models.AudioInfo, error)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"music-stream-api/pkg/models"
+)
+
+// chromaprintAlgorithm is the fingerprint algorithm fpcalc uses by default, recorded in the header of encoded
+// fingerprints.
+const chromaprintAlgorithm = 1
+
+// ChromaprintHandler computes acoustic fingerprints with Chromaprint's fpcalc tool, piping the audio to it on stdin.
+// At most MaxLength seconds of audio are fingerprinted, or all of it if MaxLength is zero.
+type ChromaprintHandler struct {
+	FpcalcPath string
+	MaxLength  int
+}
+
+type fpcalcOutput struct {
+	Duration    float64  `json:"duration"`
+	Fingerprint []uint32 `json:"fingerprint"`
+}
+
+func (c *ChromaprintHandler) Fingerprint(ctx context.Context, audio io.Reader) (*models.Fingerprint, error) {
+	path := c.FpcalcPath
+	if path == "" {
+		path = "fpcalc"
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "-json", "-raw", "-length", strconv.Itoa(c.MaxLength), "-")
+	cmd.Stdin = audio
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("fpcalc failed: %v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var output fpcalcOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, err
+	}
+	if len(output.Fingerprint) == 0 {
+		return nil, fmt.Errorf("fpcalc produced an empty fingerprint")
+	}
+
+	return &models.Fingerprint{
+		Duration: output.Duration,
+		Raw:      output.Fingerprint,
+		Encoded:  encodeFingerprint(output.Fingerprint, chromaprintAlgorithm),
+	}, nil
+}
+
+// encodeFingerprint compresses raw sub-fingerprints the way Chromaprint does. Each sub-fingerprint is XORed with the
+// previous one and the positions of its set bits written as gaps: gaps below 7 in three bits each, followed by the
+// excess of any larger gaps in five bits each. The result is base64 encoded with the URL-safe alphabet.
+func encodeFingerprint(raw []uint32, algorithm byte) string {
+	var gaps []uint32
+	var previous uint32
+	for _, x := range raw {
+		x, previous = x^previous, x
+		bit, lastBit := uint32(1), uint32(0)
+		for ; x != 0; x >>= 1 {
+			if x&1 != 0 {
+				gaps = append(gaps, bit-lastBit)
+				lastBit = bit
+			}
+			bit++
+		}
+		gaps = append(gaps, 0)
+	}
+
+	size := len(raw)
+	out := []byte{algorithm, byte(size >> 16), byte(size >> 8), byte(size)}
+
+	var writer bitWriter
+	for _, gap := range gaps {
+		if gap > 7 {
+			writer.write(7, 3)
+		} else {
+			writer.write(gap, 3)
+		}
+	}
+	out = append(out, writer.flush()...)
+
+	for _, gap := range gaps {
+		if gap >= 7 {
+			writer.write(gap-7, 5)
+		}
+	}
+	out = append(out, writer.flush()...)
+
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+// bitWriter packs values least significant bit first.
+type bitWriter struct {
+	out    []byte
+	buffer uint32
+	size   uint
+}
+
+func (b *bitWriter) write(value uint32, bits uint) {
+	b.buffer |= value << b.size
+	b.size += bits
+	for b.size >= 8 {
+		b.out = append(b.out, byte(b.buffer))
+		b.buffer >>= 8
+		b.size -= 8
+	}
+}
+
+func (b *bitWriter) flush() []byte {
+	if b.size > 0 {
+		b.out = append(b.out, byte(b.buffer))
+	}
+	out := b.out
+	b.out, b.buffer, b.size = nil, 0, 0
+	return out
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChromaprint_EncodeFingerprint_ShouldMatchChromaprintCompression(t *testing.T) {
+	cases := []struct {
+		raw      []uint32
+		expected []byte
+	}{
+		{raw: []uint32{1}, expected: []byte{0, 0, 0, 1, 1}},
+		{raw: []uint32{7}, expected: []byte{0, 0, 0, 1, 73, 0}},
+		{raw: []uint32{1 << 6}, expected: []byte{0, 0, 0, 1, 7, 0}},
+		{raw: []uint32{1 << 8}, expected: []byte{0, 0, 0, 1, 7, 2}},
+	}
+
+	for _, c := range cases {
+		require.Equal(t, base64.RawURLEncoding.EncodeToString(c.expected), encodeFingerprint(c.raw, 0))
+	}
+}
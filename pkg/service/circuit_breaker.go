@@ -0,0 +1,40 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops calls to a failing dependency. After Threshold consecutive failures it opens for Cooldown,
+// during which Allow reports false. Once the cooldown passes calls are let through again, and a single further failure
+// reopens it.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func (c *CircuitBreaker) Allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !time.Now().Before(c.openUntil)
+}
+
+func (c *CircuitBreaker) Success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = 0
+}
+
+func (c *CircuitBreaker) Failure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	if c.Threshold > 0 && c.failures >= c.Threshold {
+		c.openUntil = time.Now().Add(c.Cooldown)
+	}
+}
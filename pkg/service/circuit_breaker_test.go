@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_Allow_ShouldReturnFalseOnceThresholdReached(t *testing.T) {
+	breaker := CircuitBreaker{Threshold: 2, Cooldown: time.Minute}
+
+	breaker.Failure()
+	require.True(t, breaker.Allow())
+
+	breaker.Failure()
+	require.False(t, breaker.Allow())
+}
+
+func TestCircuitBreaker_Allow_ShouldReturnTrueAfterCooldown(t *testing.T) {
+	breaker := CircuitBreaker{Threshold: 1, Cooldown: time.Millisecond}
+
+	breaker.Failure()
+	time.Sleep(2 * time.Millisecond)
+	require.True(t, breaker.Allow())
+}
+
+func TestCircuitBreaker_Success_ShouldResetFailures(t *testing.T) {
+	breaker := CircuitBreaker{Threshold: 2, Cooldown: time.Minute}
+
+	breaker.Failure()
+	breaker.Success()
+	breaker.Failure()
+	require.True(t, breaker.Allow())
+}
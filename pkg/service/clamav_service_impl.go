@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/models"
+)
+
+const clamAVChunkSize = 64 << 10
+
+// ClamAVHandler scans files by streaming them to a clamd daemon with the INSTREAM command. Address is a host:port, or
+// the path of clamd's unix socket if it begins with a slash.
+type ClamAVHandler struct {
+	Address string
+	Timeout time.Duration
+}
+
+func (c *ClamAVHandler) Scan(ctx context.Context, file io.Reader) (*models.ScanResult, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4+clamAVChunkSize)
+	for {
+		n, err := io.ReadFull(file, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return parseClamAVReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// Ping checks that clamd is running and answering commands.
+func (c *ClamAVHandler) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if reply = strings.TrimRight(reply, "\x00\n"); reply != "PONG" {
+		return fmt.Errorf("unexpected reply from clamd: %q", reply)
+	}
+	return nil
+}
+
+func (c *ClamAVHandler) dial(ctx context.Context) (net.Conn, error) {
+	if c.Address == "" {
+		return nil, errors.New("clamav address cannot be empty")
+	}
+
+	network := "tcp"
+	if strings.HasPrefix(c.Address, "/") {
+		network = "unix"
+	}
+
+	dialer := net.Dialer{Timeout: c.Timeout}
+	conn, err := dialer.DialContext(ctx, network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if c.Timeout > 0 && (!ok || time.Now().Add(c.Timeout).Before(deadline)) {
+		deadline, ok = time.Now().Add(c.Timeout), true
+	}
+	if ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// parseClamAVReply reads a clamd INSTREAM reply, which is "stream: OK" for a clean file, "stream: <signature> FOUND"
+// for an infected one and "<reason> ERROR" when the scan could not be completed.
+func parseClamAVReply(reply string) (*models.ScanResult, error) {
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return &models.ScanResult{Scanner: "clamav", Clean: true}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &models.ScanResult{Scanner: "clamav", Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd failed to scan file: %v", reply)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClamd accepts a single connection, records the streamed file and answers with reply.
+func fakeClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		if command, err := reader.ReadString(0); err != nil || command != "zINSTREAM\x00" {
+			return
+		}
+
+		var file bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(&file, reader, int64(size)); err != nil {
+				return
+			}
+		}
+		received <- file.Bytes()
+		conn.Write([]byte(reply + "\x00"))
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func TestClamAV_Scan_ShouldReturnErrorIfAddressIsEmpty(t *testing.T) {
+	handler := ClamAVHandler{}
+
+	_, err := handler.Scan(context.Background(), strings.NewReader("test"))
+	require.NotNil(t, err)
+}
+
+func TestClamAV_Scan_ShouldStreamFileAndReportCleanResult(t *testing.T) {
+	addr, received := fakeClamd(t, "stream: OK")
+	handler := ClamAVHandler{Address: addr, Timeout: time.Second}
+	file := bytes.Repeat([]byte("a"), clamAVChunkSize+10)
+
+	result, err := handler.Scan(context.Background(), bytes.NewReader(file))
+	require.Nil(t, err)
+	require.True(t, result.Clean)
+	require.Equal(t, "clamav", result.Scanner)
+	require.Equal(t, file, <-received)
+}
+
+func TestClamAV_Scan_ShouldReportSignatureIfFileIsInfected(t *testing.T) {
+	addr, _ := fakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+	handler := ClamAVHandler{Address: addr, Timeout: time.Second}
+
+	result, err := handler.Scan(context.Background(), strings.NewReader("test"))
+	require.Nil(t, err)
+	require.False(t, result.Clean)
+	require.Equal(t, "Eicar-Test-Signature", result.Signature)
+}
+
+func TestClamAV_Scan_ShouldReturnErrorIfClamdReportsError(t *testing.T) {
+	addr, _ := fakeClamd(t, "INSTREAM size limit exceeded. ERROR")
+	handler := ClamAVHandler{Address: addr, Timeout: time.Second}
+
+	_, err := handler.Scan(context.Background(), strings.NewReader("test"))
+	require.NotNil(t, err)
+}
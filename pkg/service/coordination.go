@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by Lock when the lock is already held.
+var ErrLocked = errors.New("lock is already held")
+
+// Locker hands out locks that expire after ttl, so a holder that dies cannot keep one forever. The returned function
+// releases the lock.
+type Locker interface {
+	Lock(ctx context.Context, key string, ttl time.Duration) (func(), error)
+}
+
+// RateCounter counts hits on a key, which expires ttl after its first hit.
+type RateCounter interface {
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// LocalCoordinator keeps locks and counters in memory, which is enough for a single replica. Replicas that share work
+// use RedisHandler instead.
+type LocalCoordinator struct {
+	mu       sync.Mutex
+	locks    map[string]localEntry
+	counters map[string]localEntry
+}
+
+type localEntry struct {
+	value   int64
+	expires time.Time
+}
+
+func NewLocalCoordinator() *LocalCoordinator {
+	return &LocalCoordinator{locks: make(map[string]localEntry), counters: make(map[string]localEntry)}
+}
+
+func (l *LocalCoordinator) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if lock, ok := l.locks[key]; ok && now.Before(lock.expires) {
+		return nil, ErrLocked
+	}
+
+	holder := now.UnixNano()
+	l.locks[key] = localEntry{value: holder, expires: now.Add(ttl)}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.locks[key].value == holder {
+			delete(l.locks, key)
+		}
+	}, nil
+}
+
+func (l *LocalCoordinator) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	counter, ok := l.counters[key]
+	if !ok || !now.Before(counter.expires) {
+		for k, c := range l.counters {
+			if !now.Before(c.expires) {
+				delete(l.counters, k)
+			}
+		}
+		counter = localEntry{expires: now.Add(ttl)}
+	}
+	counter.value++
+	l.counters[key] = counter
+	return counter.value, nil
+}
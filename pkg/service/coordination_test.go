@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCoordinator_Lock_ShouldRefuseHeldLockUntilReleased(t *testing.T) {
+	coordinator := NewLocalCoordinator()
+
+	unlock, err := coordinator.Lock(context.Background(), "key", time.Minute)
+	require.Nil(t, err)
+
+	_, err = coordinator.Lock(context.Background(), "key", time.Minute)
+	require.Equal(t, ErrLocked, err)
+
+	unlock()
+	_, err = coordinator.Lock(context.Background(), "key", time.Minute)
+	require.Nil(t, err)
+}
+
+func TestLocalCoordinator_Lock_ShouldGrantExpiredLock(t *testing.T) {
+	coordinator := NewLocalCoordinator()
+
+	_, err := coordinator.Lock(context.Background(), "key", time.Nanosecond)
+	require.Nil(t, err)
+	time.Sleep(time.Millisecond)
+
+	_, err = coordinator.Lock(context.Background(), "key", time.Minute)
+	require.Nil(t, err)
+}
+
+func TestLocalCoordinator_Increment_ShouldResetAfterExpiry(t *testing.T) {
+	coordinator := NewLocalCoordinator()
+
+	for i := int64(1); i <= 2; i++ {
+		n, err := coordinator.Increment(context.Background(), "key", time.Millisecond)
+		require.Nil(t, err)
+		require.Equal(t, i, n)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	n, err := coordinator.Increment(context.Background(), "key", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), n)
+}
+
+func TestRedis_Lock_ShouldReturnErrLockedIfKeyIsSet(t *testing.T) {
+	addr, commands := fakeRedis(t, "$-1\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	_, err := handler.Lock(context.Background(), "key", time.Minute)
+	require.Equal(t, ErrLocked, err)
+
+	command := <-commands
+	require.Equal(t, []string{"SET", "key"}, command[:2])
+	require.Equal(t, []string{"NX", "PX", "60000"}, command[3:])
+}
+
+func TestRedis_Lock_ShouldReleaseWithItsToken(t *testing.T) {
+	addr, commands := fakeRedis(t, "+OK\r\n", ":1\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	unlock, err := handler.Lock(context.Background(), "key", time.Minute)
+	require.Nil(t, err)
+	unlock()
+
+	token := (<-commands)[2]
+	release := <-commands
+	require.Equal(t, "EVAL", release[0])
+	require.Equal(t, []string{"1", "key", token}, release[2:])
+}
+
+func TestRedis_Increment_ShouldReturnCount(t *testing.T) {
+	addr, commands := fakeRedis(t, ":3\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	n, err := handler.Increment(context.Background(), "key", time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, int64(3), n)
+	require.Equal(t, []string{"1", "key", "60000"}, (<-commands)[2:])
+}
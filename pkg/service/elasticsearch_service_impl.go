@@ -0,0 +1,208 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ElasticsearchHandler keeps a search index of track metadata in Elasticsearch or OpenSearch, using only the REST API
+// both share. Every tenant's tracks go in the same index, told apart by a tenant field that searches filter on.
+type ElasticsearchHandler struct {
+	HttpClient Requestor
+	URL        string
+	Index      string
+	Username   string
+	Password   string
+}
+
+type searchDocument struct {
+	Tenant  string   `json:"tenant"`
+	TrackID string   `json:"trackId"`
+	Name    string   `json:"name"`
+	Artist  string   `json:"artist"`
+	Album   string   `json:"album"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+type searchResponse struct {
+	Hits struct {
+		Hits []struct {
+			Source searchDocument `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+var searchIndexMappings = map[string]interface{}{
+	"mappings": map[string]interface{}{
+		"properties": map[string]interface{}{
+			"tenant":  map[string]string{"type": "keyword"},
+			"trackId": map[string]string{"type": "keyword"},
+			"name":    map[string]string{"type": "text"},
+			"artist":  map[string]string{"type": "text"},
+			"album":   map[string]string{"type": "text"},
+			"tags":    map[string]string{"type": "text"},
+		},
+	},
+}
+
+// EnsureIndex creates the index with its mappings if it does not exist yet.
+func (e *ElasticsearchHandler) EnsureIndex(ctx context.Context) error {
+	resp, err := e.do(ctx, http.MethodHead, e.indexURL(), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = e.do(ctx, http.MethodPut, e.indexURL(), searchIndexMappings)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkSearchResponse(resp)
+}
+
+func (e *ElasticsearchHandler) IndexTrack(ctx context.Context, tenant string, track models.Track) error {
+	document := searchDocument{
+		Tenant:  tenant,
+		TrackID: track.ID.Hex(),
+		Name:    track.Name,
+		Artist:  strings.Join(append([]string{track.Artist}, track.FeaturedArtists...), ", "),
+		Album:   track.AlbumName,
+		Tags:    track.Tags,
+	}
+
+	resp, err := e.do(ctx, http.MethodPut, e.documentURL(tenant, track.ID), document)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkSearchResponse(resp)
+}
+
+func (e *ElasticsearchHandler) DeleteTrack(ctx context.Context, tenant string, id primitive.ObjectID) error {
+	resp, err := e.do(ctx, http.MethodDelete, e.documentURL(tenant, id), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkSearchResponse(resp)
+}
+
+// Search returns the ids of up to limit of the tenant's tracks matching the query, best match first. Titles weigh
+// more than artists, and artists more than albums and tags, and small typos are forgiven.
+func (e *ElasticsearchHandler) Search(ctx context.Context, tenant string, query string, limit int) ([]primitive.ObjectID, error) {
+	body := map[string]interface{}{
+		"size":    limit,
+		"_source": []string{"trackId"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":     query,
+						"fields":    []string{"name^3", "artist^2", "album", "tags"},
+						"fuzziness": "AUTO",
+					},
+				},
+				"filter": map[string]interface{}{
+					"term": map[string]string{"tenant": tenant},
+				},
+			},
+		},
+	}
+
+	resp, err := e.do(ctx, http.MethodPost, e.indexURL()+"/_search", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkSearchResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var results searchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(results.Hits.Hits))
+	for _, hit := range results.Hits.Hits {
+		id, err := primitive.ObjectIDFromHex(hit.Source.TrackID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Ping checks that the cluster can be reached.
+func (e *ElasticsearchHandler) Ping(ctx context.Context) error {
+	resp, err := e.do(ctx, http.MethodGet, e.URL, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkSearchResponse(resp)
+}
+
+func (e *ElasticsearchHandler) indexURL() string {
+	return fmt.Sprintf("%v/%v", e.URL, url.PathEscape(e.Index))
+}
+
+// documentURL names documents after both tenant and track, so tenants sharing a track id cannot overwrite each other.
+func (e *ElasticsearchHandler) documentURL(tenant string, id primitive.ObjectID) string {
+	return fmt.Sprintf("%v/_doc/%v?refresh=wait_for", e.indexURL(), url.PathEscape(tenant+":"+id.Hex()))
+}
+
+func (e *ElasticsearchHandler) do(ctx context.Context, method string, target string, body interface{}) (*http.Response, error) {
+	if e.URL == "" {
+		return nil, errors.New("elasticsearch url cannot be empty")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.Username != "" {
+		req.SetBasicAuth(e.Username, e.Password)
+	}
+	return e.HttpClient.Do(req)
+}
+
+func checkSearchResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("elasticsearch returned %v: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
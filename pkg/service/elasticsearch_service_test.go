@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestElasticsearch_Search_ShouldReturnErrorIfURLIsEmpty(t *testing.T) {
+	handler := ElasticsearchHandler{HttpClient: &mocks.Requestor{}}
+
+	_, err := handler.Search(context.Background(), "", "test", 10)
+	require.NotNil(t, err)
+	require.Equal(t, "elasticsearch url cannot be empty", err.Error())
+}
+
+func TestElasticsearch_Search_ShouldReturnErrorIfErrorOccursPerformingRequest(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := ElasticsearchHandler{HttpClient: requestor, URL: "http://test", Index: "tracks"}
+
+	_, err := handler.Search(context.Background(), "", "test", 10)
+	require.NotNil(t, err)
+}
+
+func TestElasticsearch_Search_ShouldReturnErrorIfSearchFails(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusBadRequest, `{"error":"bad query"}`), nil)
+
+	handler := ElasticsearchHandler{HttpClient: requestor, URL: "http://test", Index: "tracks"}
+
+	_, err := handler.Search(context.Background(), "", "test", 10)
+	require.NotNil(t, err)
+	require.Equal(t, `elasticsearch returned 400: {"error":"bad query"}`, err.Error())
+}
+
+func TestElasticsearch_Search_ShouldFilterByTenantAndReturnTrackIDsInOrder(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		filter := body["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"]
+		return req.URL.String() == "http://test/tracks/_search" &&
+			filter.(map[string]interface{})["term"].(map[string]interface{})["tenant"] == "acme" &&
+			body["size"] == float64(5)
+	})).Return(jsonResponse(http.StatusOK, `{"hits":{"hits":[
+		{"_source":{"trackId":"`+second.Hex()+`"}},{"_source":{"trackId":"`+first.Hex()+`"}}]}}`), nil)
+
+	handler := ElasticsearchHandler{HttpClient: requestor, URL: "http://test", Index: "tracks"}
+
+	ids, err := handler.Search(context.Background(), "acme", "test", 5)
+	require.Nil(t, err)
+	require.Equal(t, []primitive.ObjectID{second, first}, ids)
+}
+
+func TestElasticsearch_IndexTrack_ShouldPutDocumentNamedAfterTenantAndTrack(t *testing.T) {
+	track := models.Track{ID: primitive.NewObjectID(), Name: "Song", Artist: "Artist", AlbumName: "Album", Tags: []string{"rock"}}
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		var document searchDocument
+		json.NewDecoder(req.Body).Decode(&document)
+		username, password, _ := req.BasicAuth()
+		return req.Method == http.MethodPut &&
+			req.URL.Path == "/tracks/_doc/acme:"+track.ID.Hex() &&
+			document.Tenant == "acme" && document.TrackID == track.ID.Hex() && document.Album == "Album" &&
+			username == "user" && password == "pass"
+	})).Return(jsonResponse(http.StatusCreated, `{}`), nil)
+
+	handler := ElasticsearchHandler{HttpClient: requestor, URL: "http://test", Index: "tracks", Username: "user", Password: "pass"}
+
+	require.Nil(t, handler.IndexTrack(context.Background(), "acme", track))
+}
+
+func TestElasticsearch_DeleteTrack_ShouldIgnoreMissingDocument(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == http.MethodDelete
+	})).Return(jsonResponse(http.StatusNotFound, `{"result":"not_found"}`), nil)
+
+	handler := ElasticsearchHandler{HttpClient: requestor, URL: "http://test", Index: "tracks"}
+
+	require.Nil(t, handler.DeleteTrack(context.Background(), "", primitive.NewObjectID()))
+}
+
+func TestElasticsearch_EnsureIndex_ShouldCreateIndexIfMissing(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == http.MethodHead
+	})).Return(jsonResponse(http.StatusNotFound, ``), nil)
+	requestor.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == http.MethodPut && req.URL.String() == "http://test/tracks"
+	})).Return(jsonResponse(http.StatusOK, `{"acknowledged":true}`), nil)
+
+	handler := ElasticsearchHandler{HttpClient: requestor, URL: "http://test", Index: "tracks"}
+
+	require.Nil(t, handler.EnsureIndex(context.Background()))
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+}
@@ -1,5 +1,45 @@
 package service
 
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"music-stream-api/pkg/models"
+)
+
 type ExtHandler interface {
-	ValidateToken(token string) error
+	ValidateToken(ctx context.Context, token string) (models.Identity, error)
+}
+
+// tokenIdentity reads the identity of a token the login service has accepted from its claims.
+func tokenIdentity(token string) models.Identity {
+	claims, err := TokenClaims(token)
+	if err != nil {
+		return models.Identity{}
+	}
+	subject, _ := claims["sub"].(string)
+	return models.Identity{UserID: subject, Claims: claims}
+}
+
+// TokenClaims decodes the claims of a JWT without verifying its signature, so they are only to be trusted once the
+// token has been validated by the login service.
+func TokenClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
@@ -1,40 +1,168 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
+
+	"music-stream-api/pkg/models"
 )
 
+// ErrLoginServiceUnavailable is returned when a token could not be checked because the login service is down or
+// failing, as opposed to the token being rejected.
+var ErrLoginServiceUnavailable = errors.New("login service unavailable")
+
+// unavailableError marks an error as ErrLoginServiceUnavailable while keeping the underlying error's message.
+type unavailableError struct {
+	err error
+}
+
+func (u unavailableError) Error() string {
+	return u.err.Error()
+}
+
+func (u unavailableError) Is(target error) bool {
+	return target == ErrLoginServiceUnavailable
+}
+
+func (u unavailableError) Unwrap() error {
+	return u.err
+}
+
 type Requestor interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
+// ExternalHandler validates tokens with the login service. When Cache is set, accepted tokens are remembered so that
+// repeat requests do not each call the service.
+//
+// Each attempt is bounded by Timeout. Network errors and 502, 503 and 504 responses are retried up to MaxRetries times
+// with exponential backoff starting at RetryBackoff, and when Breaker is set, repeated failures stop calls to the
+// service altogether until it has had time to recover.
 type ExternalHandler struct {
 	HttpClient      Requestor
 	LoginServiceURL string
+	Cache           *TokenCache
+	Timeout         time.Duration
+	MaxRetries      int
+	RetryBackoff    time.Duration
+	Breaker         *CircuitBreaker
 }
 
-func (e *ExternalHandler) ValidateToken(token string) error {
+// ValidateToken checks a token with the login service, returning the identity its claims give once it is accepted.
+func (e *ExternalHandler) ValidateToken(ctx context.Context, token string) (models.Identity, error) {
+	if e.LoginServiceURL == "" {
+		return models.Identity{}, errors.New("login service url cannot be emtpy")
+	}
+
+	if e.Cache != nil && e.Cache.Valid(token) {
+		return tokenIdentity(token), nil
+	}
+
+	if e.Breaker != nil && !e.Breaker.Allow() {
+		return models.Identity{}, fmt.Errorf("%w: circuit breaker is open", ErrLoginServiceUnavailable)
+	}
+
+	var err error
+	for attempt := 0; attempt <= e.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return models.Identity{}, ctx.Err()
+			case <-time.After(e.RetryBackoff << (attempt - 1)):
+			}
+		}
+
+		var transient bool
+		transient, err = e.validate(ctx, token)
+		if !transient {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return models.Identity{}, ctx.Err()
+	}
+	if errors.Is(err, ErrLoginServiceUnavailable) {
+		if e.Breaker != nil {
+			e.Breaker.Failure()
+		}
+		return models.Identity{}, err
+	}
+	if e.Breaker != nil {
+		e.Breaker.Success()
+	}
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	if e.Cache != nil {
+		e.Cache.Add(token)
+	}
+	return tokenIdentity(token), nil
+}
+
+// Ping checks that the login service can be reached. Any HTTP response counts, since only the connection is of
+// interest.
+func (e *ExternalHandler) Ping(ctx context.Context) error {
 	if e.LoginServiceURL == "" {
 		return errors.New("login service url cannot be emtpy")
 	}
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v/token", e.LoginServiceURL), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%v/", e.LoginServiceURL), nil)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", token))
-
 	resp, err := e.HttpClient.Do(req)
 	if err != nil {
 		return err
 	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// validate makes a single call to the login service, reporting whether any error is transient and worth retrying.
+// Transient errors wrap ErrLoginServiceUnavailable.
+func (e *ExternalHandler) validate(ctx context.Context, token string) (bool, error) {
+	attemptCtx := ctx
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprintf("non-200 status code received: %v", resp.StatusCode))
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, fmt.Sprintf("http://%v/token", e.LoginServiceURL), nil)
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", token))
+
+	resp, err := e.HttpClient.Do(req)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up, which says nothing about the health of the login service.
+		return false, ctx.Err()
+	} else if err != nil {
+		return true, unavailableError{err: err}
+	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return false, nil
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, unavailableError{err: errors.New(fmt.Sprintf("non-200 status code received: %v", resp.StatusCode))}
+	case http.StatusUnauthorized:
+		if e.Cache != nil {
+			e.Cache.Remove(token)
+		}
+	}
+	return false, errors.New(fmt.Sprintf("non-200 status code received: %v", resp.StatusCode))
 }
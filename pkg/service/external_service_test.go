@@ -1,10 +1,13 @@
 package service
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"music-stream-api/pkg/testhelper/mocks"
 
@@ -20,7 +23,7 @@ func TestExternal_ValidateToken_ShouldReturnErrorIfLoginServiceURLIsEmpty(t *tes
 		LoginServiceURL: "",
 	}
 
-	err := handler.ValidateToken("test")
+	_, err := handler.ValidateToken(context.Background(), "test")
 	require.NotNil(t, err)
 	require.Equal(t, "login service url cannot be emtpy", err.Error())
 }
@@ -34,7 +37,7 @@ func TestExternal_ValidateToken_ShouldReturnErrorIfErrorOccursPerformingRequest(
 		LoginServiceURL: "test",
 	}
 
-	err := handler.ValidateToken("test")
+	_, err := handler.ValidateToken(context.Background(), "test")
 	require.NotNil(t, err)
 	require.Equal(t, "test", err.Error())
 }
@@ -48,7 +51,7 @@ func TestExternal_ValidateToken_ShouldReturnErrorIfResponseCodeIsNot200(t *testi
 		LoginServiceURL: "test",
 	}
 
-	err := handler.ValidateToken("test")
+	_, err := handler.ValidateToken(context.Background(), "test")
 	require.NotNil(t, err)
 	require.Equal(t, fmt.Sprintf("non-200 status code received: %v", http.StatusTeapot), err.Error())
 }
@@ -62,5 +65,143 @@ func TestExternal_ValidateToken_ShouldReturnNilOnSuccess(t *testing.T) {
 		LoginServiceURL: "test",
 	}
 
-	require.Nil(t, handler.ValidateToken("test"))
+	_, err := handler.ValidateToken(context.Background(), "test")
+	require.Nil(t, err)
+}
+
+func TestExternal_ValidateToken_ShouldReturnIdentityFromTokenClaims(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK}, nil)
+
+	handler := ExternalHandler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+		Cache:           NewTokenCache(time.Minute, 10),
+	}
+
+	token := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1","name":"Jo"}`)) + ".signature"
+	for i := 0; i < 2; i++ {
+		identity, err := handler.ValidateToken(context.Background(), token)
+		require.Nil(t, err)
+		require.Equal(t, "user-1", identity.UserID)
+		require.Equal(t, "Jo", identity.Claims["name"])
+	}
+
+	identity, err := handler.ValidateToken(context.Background(), "opaque")
+	require.Nil(t, err)
+	require.Empty(t, identity.UserID)
+}
+
+func TestExternal_ValidateToken_ShouldNotCallLoginServiceForCachedToken(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK}, nil).Once()
+
+	handler := ExternalHandler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+		Cache:           NewTokenCache(time.Minute, 10),
+	}
+
+	_, err := handler.ValidateToken(context.Background(), "test")
+	require.Nil(t, err)
+	_, err = handler.ValidateToken(context.Background(), "test")
+	require.Nil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestExternal_ValidateToken_ShouldNotCacheRejectedToken(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusUnauthorized}, nil)
+
+	handler := ExternalHandler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+		Cache:           NewTokenCache(time.Minute, 10),
+	}
+
+	_, err := handler.ValidateToken(context.Background(), "test")
+	require.NotNil(t, err)
+	_, err = handler.ValidateToken(context.Background(), "test")
+	require.NotNil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+}
+
+func TestExternal_ValidateToken_ShouldRetryTransientErrors(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil).Once()
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK}, nil).Once()
+
+	handler := ExternalHandler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+		MaxRetries:      2,
+	}
+
+	_, err := handler.ValidateToken(context.Background(), "test")
+	require.Nil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+}
+
+func TestExternal_ValidateToken_ShouldNotRetryRejectedToken(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusUnauthorized}, nil)
+
+	handler := ExternalHandler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+		MaxRetries:      2,
+	}
+
+	_, err := handler.ValidateToken(context.Background(), "test")
+	require.NotNil(t, err)
+	require.False(t, errors.Is(err, ErrLoginServiceUnavailable))
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestExternal_ValidateToken_ShouldFailFastWhenCircuitBreakerIsOpen(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := ExternalHandler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+		Breaker:         &CircuitBreaker{Threshold: 1, Cooldown: time.Minute},
+	}
+
+	_, err := handler.ValidateToken(context.Background(), "test")
+	require.True(t, errors.Is(err, ErrLoginServiceUnavailable))
+	_, err = handler.ValidateToken(context.Background(), "test")
+	require.True(t, errors.Is(err, ErrLoginServiceUnavailable))
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestExternal_ValidateToken_ShouldNotCallLoginServiceIfContextCancelled(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := ExternalHandler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+		MaxRetries:      2,
+		Breaker:         &CircuitBreaker{Threshold: 1, Cooldown: time.Minute},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := handler.ValidateToken(ctx, "test")
+	require.Equal(t, context.Canceled, err)
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+	require.True(t, handler.Breaker.Allow())
+}
+
+func TestExternal_TokenClaims_ShouldDecodeClaimsOfJWT(t *testing.T) {
+	claims, err := TokenClaims("header." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1","exp":10}`)) + ".signature")
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{"sub": "user-1", "exp": float64(10)}, claims)
+
+	_, err = TokenClaims("opaque")
+	require.NotNil(t, err)
+	_, err = TokenClaims("header.!.signature")
+	require.NotNil(t, err)
 }
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"music-stream-api/pkg/models"
+)
+
+// FFprobeHandler validates audio by probing it with ffprobe, then decoding all of it with ffmpeg, which finds damage
+// beyond the headers ffprobe reads, and measuring its loudest sample on the way. Audio with no duration, or no sample
+// louder than SilenceThreshold dB, is rejected. Without FFmpegPath only the probe is run.
+type FFprobeHandler struct {
+	FFprobePath      string
+	FFmpegPath       string
+	SilenceThreshold float64
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType  string            `json:"codec_type"`
+		CodecName  string            `json:"codec_name"`
+		SampleRate string            `json:"sample_rate"`
+		Channels   int               `json:"channels"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+var maxVolumePattern = regexp.MustCompile(`max_volume: (-?[0-9.]+|-inf) dB`)
+
+func (f *FFprobeHandler) Validate(ctx context.Context, audio io.Reader) (*models.AudioInfo, error) {
+	path, size, remove, err := probeFile(audio)
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+	if size == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidAudio)
+	}
+
+	output, err := runTool(ctx, f.FFprobePath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseFFprobeOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.FFmpegPath == "" {
+		return info, nil
+	}
+	output, err = runTool(ctx, f.FFmpegPath, "-hide_banner", "-nostats", "-xerror", "-i", path, "-vn", "-af", "volumedetect", "-f", "null", "-")
+	if err != nil {
+		return nil, err
+	}
+	maxVolume, err := parseMaxVolume(output)
+	if err != nil {
+		return nil, err
+	}
+	if maxVolume <= f.SilenceThreshold {
+		return nil, fmt.Errorf("%w: the audio is silent", ErrInvalidAudio)
+	}
+	return info, nil
+}
+
+// probeFile writes the audio to a temporary file, which remove deletes, as it is probed from a file rather than a pipe:
+// formats such as m4a may keep their index at the end.
+func probeFile(audio io.Reader) (path string, size int64, remove func(), err error) {
+	file, err := ioutil.TempFile("", "validate-*")
+	if err != nil {
+		return "", 0, nil, err
+	}
+	remove = func() { os.Remove(file.Name()) }
+	size, err = io.Copy(file, audio)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		remove()
+		return "", 0, nil, err
+	}
+	return file.Name(), size, remove, nil
+}
+
+// runTool runs ffprobe or ffmpeg and returns what it wrote to stdout and stderr. A tool that ran and failed is taken
+// to have been given invalid audio, and its last message is returned as the reason.
+func runTool(ctx context.Context, path string, args ...string) ([]byte, error) {
+	var output, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAudio, strings.TrimSpace(lines[len(lines)-1]))
+	} else if err != nil {
+		return nil, err
+	}
+	return append(output.Bytes(), stderr.Bytes()...), nil
+}
+
+// parseFFprobeOutput reads the technical metadata of the first audio stream from ffprobe's JSON output.
+func parseFFprobeOutput(output []byte) (*models.AudioInfo, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, err
+	}
+
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+
+		duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+		if duration <= 0 || math.IsNaN(duration) {
+			return nil, fmt.Errorf("%w: the audio has no duration", ErrInvalidAudio)
+		}
+		sampleRate, _ := strconv.Atoi(stream.SampleRate)
+		bitRate, err := strconv.Atoi(stream.BitRate)
+		if err != nil {
+			// Containers such as Ogg only report the bit rate of the file as a whole.
+			bitRate, _ = strconv.Atoi(probe.Format.BitRate)
+		}
+
+		return &models.AudioInfo{
+			Container:  strings.Split(probe.Format.FormatName, ",")[0],
+			Codec:      stream.CodecName,
+			BitRate:    bitRate,
+			SampleRate: sampleRate,
+			Channels:   stream.Channels,
+			Duration:   duration,
+			Tags:       mergeTags(probe.Format.Tags, stream.Tags),
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: the file has no audio stream", ErrInvalidAudio)
+}
+
+// mergeTags combines the tags of a file and of its audio stream, with keys lower-cased as their case depends on the
+// format: ID3 and MP4 tags are reported on the file, but Vorbis comments in Ogg files on the stream, as ALBUMARTIST
+// and so on. Tags of the file win where both are set.
+func mergeTags(sources ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, tags := range sources {
+		for key, value := range tags {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			key = strings.ToLower(key)
+			if _, ok := merged[key]; !ok {
+				merged[key] = value
+			}
+		}
+	}
+	return merged
+}
+
+// parseMaxVolume reads the loudest sample, in dB, from the report of ffmpeg's volumedetect filter. Digital silence is
+// reported as -inf.
+func parseMaxVolume(output []byte) (float64, error) {
+	match := maxVolumePattern.FindSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("%w: no audio could be decoded", ErrInvalidAudio)
+	}
+	if string(match[1]) == "-inf" {
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(string(match[1]), 64)
+}
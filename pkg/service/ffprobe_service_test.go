@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"music-stream-api/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFFprobe_ParseFFprobeOutput_ShouldReadFirstAudioStream(t *testing.T) {
+	output := `{
+		"streams": [
+			{"codec_type": "video", "codec_name": "mjpeg"},
+			{"codec_type": "audio", "codec_name": "vorbis", "sample_rate": "44100", "channels": 2}
+		],
+		"format": {"format_name": "ogg", "duration": "12.500000", "bit_rate": "160000"}
+	}`
+
+	info, err := parseFFprobeOutput([]byte(output))
+	require.Nil(t, err)
+	require.Equal(t, &models.AudioInfo{
+		Container:  "ogg",
+		Codec:      "vorbis",
+		BitRate:    160000,
+		SampleRate: 44100,
+		Channels:   2,
+		Duration:   12.5,
+	}, info)
+}
+
+func TestFFprobe_ParseFFprobeOutput_ShouldMergeFileAndStreamTags(t *testing.T) {
+	output := `{
+		"streams": [
+			{"codec_type": "audio", "codec_name": "vorbis", "tags": {"ALBUMARTIST": "Various Artists", "TITLE": "stream title"}}
+		],
+		"format": {"format_name": "ogg", "duration": "3.0", "tags": {"title": "file title", "Composer": "Someone"}}
+	}`
+
+	info, err := parseFFprobeOutput([]byte(output))
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		"albumartist": "Various Artists",
+		"title":       "file title",
+		"composer":    "Someone",
+	}, info.Tags)
+}
+
+func TestFFprobe_ParseFFprobeOutput_ShouldRejectAudioWithoutDurationOrStream(t *testing.T) {
+	_, err := parseFFprobeOutput([]byte(`{"streams": [{"codec_type": "audio"}], "format": {"duration": "0.000000"}}`))
+	require.True(t, errors.Is(err, ErrInvalidAudio))
+
+	_, err = parseFFprobeOutput([]byte(`{"streams": [], "format": {"duration": "3.0"}}`))
+	require.True(t, errors.Is(err, ErrInvalidAudio))
+}
+
+func TestFFprobe_ParseMaxVolume_ShouldReadVolumedetectReport(t *testing.T) {
+	volume, err := parseMaxVolume([]byte("[Parsed_volumedetect_0 @ 0x1] mean_volume: -20.1 dB\n[Parsed_volumedetect_0 @ 0x1] max_volume: -0.5 dB\n"))
+	require.Nil(t, err)
+	require.Equal(t, -0.5, volume)
+
+	volume, err = parseMaxVolume([]byte("[Parsed_volumedetect_0 @ 0x1] max_volume: -inf dB\n"))
+	require.Nil(t, err)
+	require.True(t, math.IsInf(volume, -1))
+
+	_, err = parseMaxVolume([]byte("Output file is empty, nothing was encoded\n"))
+	require.True(t, errors.Is(err, ErrInvalidAudio))
+}
+
+func TestFFprobe_Validate_ShouldRejectEmptyFile(t *testing.T) {
+	validator := &FFprobeHandler{FFprobePath: "ffprobe"}
+
+	_, err := validator.Validate(context.Background(), bytes.NewReader(nil))
+	require.True(t, errors.Is(err, ErrInvalidAudio))
+}
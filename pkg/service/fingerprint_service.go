@@ -0,0 +1,16 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"music-stream-api/pkg/models"
+)
+
+type Fingerprinter interface {
+	Fingerprint(ctx context.Context, audio io.Reader) (*models.Fingerprint, error)
+}
+
+type RecordingIdentifier interface {
+	Identify(ctx context.Context, fingerprint *models.Fingerprint) ([]models.AcoustIDMatch, error)
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"music-stream-api/pkg/models"
+)
+
+type MetadataProvider interface {
+	LookupTrack(ctx context.Context, artist string, title string) (*models.TrackMetadata, error)
+}
+
+// ErrInvalidPlaylistURL is returned by a PlaylistProvider for a URL that is not one of its playlists.
+var ErrInvalidPlaylistURL = errors.New("not a playlist URL")
+
+// ErrPlaylistNotFound is returned by a PlaylistProvider for a playlist that does not exist or is not public.
+var ErrPlaylistNotFound = errors.New("playlist not found")
+
+// PlaylistProvider lists the tracks of a public playlist on another service, given the playlist's URL.
+type PlaylistProvider interface {
+	GetPlaylist(ctx context.Context, playlistURL string) (*models.ExternalPlaylist, error)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/models"
+)
+
+// MusicBrainzHandler looks up recordings on MusicBrainz and their artwork on the Cover Art Archive. MusicBrainz
+// allows a single request per second per client, so lookups are spaced by RequestInterval and cached for CacheTTL.
+type MusicBrainzHandler struct {
+	HttpClient      Requestor
+	MusicBrainzURL  string
+	CoverArtURL     string
+	UserAgent       string
+	RequestInterval time.Duration
+	CacheTTL        time.Duration
+
+	mu          sync.Mutex
+	lastRequest time.Time
+	cache       map[string]cachedMetadata
+}
+
+type cachedMetadata struct {
+	metadata *models.TrackMetadata
+	expires  time.Time
+}
+
+type musicBrainzRecordingResponse struct {
+	Recordings []struct {
+		ID               string `json:"id"`
+		Title            string `json:"title"`
+		FirstReleaseDate string `json:"first-release-date"`
+		ArtistCredit     []struct {
+			Name string `json:"name"`
+		} `json:"artist-credit"`
+		Releases []struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"releases"`
+	} `json:"recordings"`
+}
+
+type coverArtResponse struct {
+	Images []struct {
+		Front bool   `json:"front"`
+		Image string `json:"image"`
+	} `json:"images"`
+}
+
+func (m *MusicBrainzHandler) LookupTrack(ctx context.Context, artist string, title string) (*models.TrackMetadata, error) {
+	if m.MusicBrainzURL == "" {
+		return nil, errors.New("musicbrainz url cannot be empty")
+	}
+	if title == "" {
+		return nil, errors.New("title cannot be empty")
+	}
+
+	key := strings.ToLower(artist) + "\x00" + strings.ToLower(title)
+	if metadata, ok := m.getCached(key); ok {
+		return metadata, nil
+	}
+
+	metadata, err := m.lookupRecording(ctx, artist, title)
+	if err != nil {
+		return nil, err
+	}
+
+	m.setCached(key, metadata)
+	return metadata, nil
+}
+
+func (m *MusicBrainzHandler) lookupRecording(ctx context.Context, artist string, title string) (*models.TrackMetadata, error) {
+	query := fmt.Sprintf("recording:\"%v\"", title)
+	if artist != "" {
+		query = fmt.Sprintf("%v AND artist:\"%v\"", query, artist)
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("fmt", "json")
+	params.Set("limit", "1")
+
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	var recordings musicBrainzRecordingResponse
+	if err := m.getJSON(ctx, fmt.Sprintf("%v/recording?%v", m.MusicBrainzURL, params.Encode()), &recordings); err != nil {
+		return nil, err
+	}
+	if len(recordings.Recordings) == 0 {
+		return nil, nil
+	}
+
+	recording := recordings.Recordings[0]
+	metadata := &models.TrackMetadata{
+		Name:          recording.Title,
+		MusicBrainzID: recording.ID,
+	}
+
+	var artists []string
+	for _, credit := range recording.ArtistCredit {
+		artists = append(artists, credit.Name)
+	}
+	metadata.Artist = strings.Join(artists, ", ")
+
+	if len(recording.FirstReleaseDate) >= 4 {
+		if year, err := strconv.Atoi(recording.FirstReleaseDate[:4]); err == nil {
+			metadata.Year = year
+		}
+	}
+
+	if len(recording.Releases) > 0 {
+		metadata.AlbumName = recording.Releases[0].Title
+		if m.CoverArtURL != "" {
+			metadata.ArtworkURL = m.lookupArtwork(ctx, recording.Releases[0].ID)
+		}
+	}
+
+	return metadata, nil
+}
+
+func (m *MusicBrainzHandler) lookupArtwork(ctx context.Context, releaseID string) string {
+	var coverArt coverArtResponse
+	if err := m.getJSON(ctx, fmt.Sprintf("%v/release/%v", m.CoverArtURL, releaseID), &coverArt); err != nil {
+		return ""
+	}
+
+	for _, image := range coverArt.Images {
+		if image.Front {
+			return image.Image
+		}
+	}
+	return ""
+}
+
+func (m *MusicBrainzHandler) getJSON(ctx context.Context, address string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Accept", "application/json")
+	if m.UserAgent != "" {
+		req.Header.Add("User-Agent", m.UserAgent)
+	}
+
+	resp, err := m.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("non-200 status code received: %v", resp.StatusCode))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func (m *MusicBrainzHandler) wait(ctx context.Context) error {
+	m.mu.Lock()
+	next := m.lastRequest.Add(m.RequestInterval)
+	now := time.Now()
+	if next.Before(now) {
+		next = now
+	}
+	m.lastRequest = next
+	m.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(next)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *MusicBrainzHandler) getCached(key string) (*models.TrackMetadata, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cached, ok := m.cache[key]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	return cached.metadata, true
+}
+
+func (m *MusicBrainzHandler) setCached(key string, metadata *models.TrackMetadata) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cache == nil {
+		m.cache = make(map[string]cachedMetadata)
+	}
+	for k, cached := range m.cache {
+		if time.Now().After(cached.expires) {
+			delete(m.cache, k)
+		}
+	}
+	m.cache[key] = cachedMetadata{metadata: metadata, expires: time.Now().Add(m.CacheTTL)}
+}
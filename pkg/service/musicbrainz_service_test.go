@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testRecordingResponse = `{"recordings":[{"id":"rec-1","title":"Song","first-release-date":"1999-05-01",` +
+	`"artist-credit":[{"name":"Band"}],"releases":[{"id":"rel-1","title":"Album"}]}]}`
+
+func jsonResponse(code int, body string) *http.Response {
+	return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+func TestMusicBrainz_LookupTrack_ShouldReturnErrorIfMusicBrainzURLIsEmpty(t *testing.T) {
+	handler := MusicBrainzHandler{HttpClient: &mocks.Requestor{}}
+
+	_, err := handler.LookupTrack(context.Background(), "artist", "title")
+	require.NotNil(t, err)
+	require.Equal(t, "musicbrainz url cannot be empty", err.Error())
+}
+
+func TestMusicBrainz_LookupTrack_ShouldReturnErrorIfErrorOccursPerformingRequest(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := MusicBrainzHandler{HttpClient: requestor, MusicBrainzURL: "http://test"}
+
+	_, err := handler.LookupTrack(context.Background(), "artist", "title")
+	require.NotNil(t, err)
+	require.Equal(t, "test", err.Error())
+}
+
+func TestMusicBrainz_LookupTrack_ShouldReturnErrorIfResponseCodeIsNot200(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusServiceUnavailable, ""), nil)
+
+	handler := MusicBrainzHandler{HttpClient: requestor, MusicBrainzURL: "http://test"}
+
+	_, err := handler.LookupTrack(context.Background(), "artist", "title")
+	require.NotNil(t, err)
+	require.Equal(t, "non-200 status code received: 503", err.Error())
+}
+
+func TestMusicBrainz_LookupTrack_ShouldReturnNilIfNoRecordingsFound(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusOK, `{"recordings":[]}`), nil)
+
+	handler := MusicBrainzHandler{HttpClient: requestor, MusicBrainzURL: "http://test"}
+
+	metadata, err := handler.LookupTrack(context.Background(), "artist", "title")
+	require.Nil(t, err)
+	require.Nil(t, metadata)
+}
+
+func TestMusicBrainz_LookupTrack_ShouldReturnMetadataWithArtworkOnSuccess(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.String(), "http://test/recording")
+	})).Return(jsonResponse(http.StatusOK, testRecordingResponse), nil)
+	requestor.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.URL.String() == "http://art/release/rel-1"
+	})).Return(jsonResponse(http.StatusOK, `{"images":[{"front":true,"image":"http://art/front.jpg"}]}`), nil)
+
+	handler := MusicBrainzHandler{HttpClient: requestor, MusicBrainzURL: "http://test", CoverArtURL: "http://art"}
+
+	metadata, err := handler.LookupTrack(context.Background(), "band", "song")
+	require.Nil(t, err)
+	require.Equal(t, "Song", metadata.Name)
+	require.Equal(t, "Band", metadata.Artist)
+	require.Equal(t, "Album", metadata.AlbumName)
+	require.Equal(t, 1999, metadata.Year)
+	require.Equal(t, "http://art/front.jpg", metadata.ArtworkURL)
+	require.Equal(t, "rec-1", metadata.MusicBrainzID)
+}
+
+func TestMusicBrainz_LookupTrack_ShouldReturnCachedMetadataOnRepeatedLookup(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusOK, testRecordingResponse), nil).Once()
+
+	handler := MusicBrainzHandler{HttpClient: requestor, MusicBrainzURL: "http://test", CacheTTL: time.Hour}
+
+	first, err := handler.LookupTrack(context.Background(), "band", "song")
+	require.Nil(t, err)
+
+	second, err := handler.LookupTrack(context.Background(), "Band", "Song")
+	require.Nil(t, err)
+	require.Equal(t, first, second)
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrObjectNotFound is returned by an ObjectStore for a key it holds no object under.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore keeps objects under keys in a bucket, such as S3 or a service compatible with it.
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, body []byte, contentType string) error
+	GetObject(ctx context.Context, key string) ([]byte, error)
+	ObjectExists(ctx context.Context, key string) (bool, error)
+}
@@ -0,0 +1,12 @@
+package service
+
+import (
+	"context"
+
+	"music-stream-api/pkg/models"
+)
+
+type PodcastHandler interface {
+	FetchFeed(ctx context.Context, feedURL string) (*models.PodcastFeed, error)
+	DownloadEpisode(ctx context.Context, audioURL string) ([]byte, error)
+}
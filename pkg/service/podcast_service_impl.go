@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"music-stream-api/pkg/models"
+)
+
+// FeedHandler reads podcast RSS feeds and downloads their episode enclosures.
+type FeedHandler struct {
+	HttpClient      Requestor
+	MaxEpisodeBytes int64
+}
+
+type rssFeed struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title     string `xml:"title"`
+			GUID      string `xml:"guid"`
+			PubDate   string `xml:"pubDate"`
+			Enclosure struct {
+				URL  string `xml:"url,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func (f *FeedHandler) FetchFeed(ctx context.Context, feedURL string) (*models.PodcastFeed, error) {
+	body, err := f.get(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var feed rssFeed
+	if err := xml.NewDecoder(body).Decode(&feed); err != nil {
+		return nil, err
+	}
+	if feed.Channel.Title == "" {
+		return nil, errors.New("feed has no channel title")
+	}
+
+	result := &models.PodcastFeed{Title: strings.TrimSpace(feed.Channel.Title)}
+	for _, item := range feed.Channel.Items {
+		if item.Enclosure.URL == "" {
+			continue
+		}
+
+		episode := models.PodcastEpisode{
+			GUID:     strings.TrimSpace(item.GUID),
+			Title:    strings.TrimSpace(item.Title),
+			AudioURL: item.Enclosure.URL,
+		}
+		if episode.GUID == "" {
+			episode.GUID = item.Enclosure.URL
+		}
+		if published, err := time.Parse(time.RFC1123Z, strings.TrimSpace(item.PubDate)); err == nil {
+			episode.PublishedAt = published
+		} else if published, err := time.Parse(time.RFC1123, strings.TrimSpace(item.PubDate)); err == nil {
+			episode.PublishedAt = published
+		}
+
+		result.Episodes = append(result.Episodes, episode)
+	}
+
+	return result, nil
+}
+
+func (f *FeedHandler) DownloadEpisode(ctx context.Context, audioURL string) ([]byte, error) {
+	body, err := f.get(ctx, audioURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if f.MaxEpisodeBytes <= 0 {
+		return ioutil.ReadAll(body)
+	}
+
+	audio, err := ioutil.ReadAll(io.LimitReader(body, f.MaxEpisodeBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(audio)) > f.MaxEpisodeBytes {
+		return nil, errors.New(fmt.Sprintf("episode exceeds maximum size of %v bytes", f.MaxEpisodeBytes))
+	}
+	return audio, nil
+}
+
+func (f *FeedHandler) get(ctx context.Context, address string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(fmt.Sprintf("non-200 status code received: %v", resp.StatusCode))
+	}
+
+	return resp.Body, nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testFeed = `<?xml version="1.0"?><rss version="2.0"><channel><title>Show</title>
+<item><title>Episode 2</title><guid>ep-2</guid><pubDate>Tue, 02 Feb 2021 10:00:00 +0000</pubDate><enclosure url="http://cdn/2.mp3" type="audio/mpeg"/></item>
+<item><title>Episode 1</title><pubDate>Mon, 01 Feb 2021 10:00:00 +0000</pubDate><enclosure url="http://cdn/1.mp3" type="audio/mpeg"/></item>
+<item><title>Announcement</title><guid>no-audio</guid></item>
+</channel></rss>`
+
+func TestFeed_FetchFeed_ShouldReturnErrorIfErrorOccursPerformingRequest(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := FeedHandler{HttpClient: requestor}
+
+	_, err := handler.FetchFeed(context.Background(), "http://test/feed")
+	require.NotNil(t, err)
+	require.Equal(t, "test", err.Error())
+}
+
+func TestFeed_FetchFeed_ShouldReturnErrorIfFeedIsInvalid(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusOK, "<html></html>"), nil)
+
+	handler := FeedHandler{HttpClient: requestor}
+
+	_, err := handler.FetchFeed(context.Background(), "http://test/feed")
+	require.NotNil(t, err)
+}
+
+func TestFeed_FetchFeed_ShouldReturnEpisodesWithEnclosuresOnSuccess(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusOK, testFeed), nil)
+
+	handler := FeedHandler{HttpClient: requestor}
+
+	feed, err := handler.FetchFeed(context.Background(), "http://test/feed")
+	require.Nil(t, err)
+	require.Equal(t, "Show", feed.Title)
+	require.Len(t, feed.Episodes, 2)
+	require.Equal(t, "ep-2", feed.Episodes[0].GUID)
+	require.Equal(t, 2021, feed.Episodes[0].PublishedAt.Year())
+	require.Equal(t, "http://cdn/1.mp3", feed.Episodes[1].GUID)
+}
+
+func TestFeed_DownloadEpisode_ShouldReturnErrorIfEpisodeExceedsMaximumSize(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusOK, "0123456789"), nil)
+
+	handler := FeedHandler{HttpClient: requestor, MaxEpisodeBytes: 5}
+
+	_, err := handler.DownloadEpisode(context.Background(), "http://cdn/1.mp3")
+	require.NotNil(t, err)
+	require.Equal(t, "episode exceeds maximum size of 5 bytes", err.Error())
+}
+
+func TestFeed_DownloadEpisode_ShouldReturnAudioOnSuccess(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusOK, "audio"), nil)
+
+	handler := FeedHandler{HttpClient: requestor, MaxEpisodeBytes: 5}
+
+	audio, err := handler.DownloadEpisode(context.Background(), "http://cdn/1.mp3")
+	require.Nil(t, err)
+	require.Equal(t, []byte("audio"), audio)
+}
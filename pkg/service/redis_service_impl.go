@@ -0,0 +1,268 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redisMaxIdleConns = 10
+
+// redisUnlockScript deletes a lock only if it is still held with the given token, so a holder whose lock expired and
+// was taken over cannot release the new holder's lock.
+const redisUnlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// redisIncrementScript increments a counter and starts its expiry on the first hit, in one step so a crash in between
+// cannot leave a counter that never expires.
+const redisIncrementScript = `local n = redis.call("INCR", KEYS[1]) if n == 1 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end return n`
+
+// RedisHandler is a minimal Redis client speaking RESP over a small pool of connections, enough for the cache and
+// coordination commands the API needs without another dependency.
+type RedisHandler struct {
+	Address  string
+	Password string
+	Database int
+	Timeout  time.Duration
+
+	once sync.Once
+	idle chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// RedisError is an error reply from the server, such as one for a command run against a key of the wrong type.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// Do runs a command and returns its reply: a string for status replies, int64 for integers, []byte for bulk strings,
+// []interface{} for arrays and nil for a null reply.
+func (r *RedisHandler) Do(ctx context.Context, args ...string) (interface{}, error) {
+	if r.Address == "" {
+		return nil, errors.New("redis address cannot be empty")
+	}
+	r.once.Do(func() {
+		r.idle = make(chan *redisConn, redisMaxIdleConns)
+	})
+
+	conn, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, r.Timeout, args)
+	if _, ok := err.(RedisError); err != nil && !ok {
+		conn.conn.Close()
+		return nil, err
+	}
+
+	select {
+	case r.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+	return reply, err
+}
+
+// Get returns the value stored at key, or nil if there is none.
+func (r *RedisHandler) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return value, nil
+}
+
+// Set stores value at key, expiring after ttl when it is positive.
+func (r *RedisHandler) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.Do(ctx, args...)
+	return err
+}
+
+// Incr increments the counter at key, starting from zero, and returns its new value.
+func (r *RedisHandler) Incr(ctx context.Context, key string) (int64, error) {
+	reply, err := r.Do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply to INCR: %v", reply)
+	}
+	return value, nil
+}
+
+// Lock takes the lock at key, shared by every replica using the same server, or returns ErrLocked if it is held.
+func (r *RedisHandler) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	holder := hex.EncodeToString(token)
+
+	reply, err := r.Do(ctx, "SET", key, holder, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrLocked
+	}
+
+	return func() {
+		timeout := r.Timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if _, err := r.Do(ctx, "EVAL", redisUnlockScript, "1", key, holder); err != nil {
+			logrus.WithError(err).WithField("key", key).Warn("Error releasing lock, it will expire instead")
+		}
+	}, nil
+}
+
+// Increment counts a hit on key, shared by every replica using the same server.
+func (r *RedisHandler) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	reply, err := r.Do(ctx, "EVAL", redisIncrementScript, "1", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	value, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply to increment: %v", reply)
+	}
+	return value, nil
+}
+
+// Ping checks that the server can be reached.
+func (r *RedisHandler) Ping(ctx context.Context) error {
+	_, err := r.Do(ctx, "PING")
+	return err
+}
+
+func (r *RedisHandler) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-r.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: r.Timeout}
+	network := "tcp"
+	if strings.HasPrefix(r.Address, "/") {
+		network = "unix"
+	}
+	c, err := dialer.DialContext(ctx, network, r.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{conn: c, reader: bufio.NewReader(c)}
+	if r.Password != "" {
+		if _, err := conn.do(ctx, r.Timeout, []string{"AUTH", r.Password}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.Database != 0 {
+		if _, err := conn.do(ctx, r.Timeout, []string{"SELECT", strconv.Itoa(r.Database)}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args []string) (interface{}, error) {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.reader)
+}
+
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+		return value[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			if values[i], err = readRedisReply(reader); err != nil {
+				if _, ok := err.(RedisError); !ok {
+					return nil, err
+				}
+				values[i] = err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply: %q", line)
+	}
+}
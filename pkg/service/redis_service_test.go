@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis accepts connections and answers each command it receives with the next of replies, recording the
+// commands.
+func fakeRedis(t *testing.T, replies ...string) (string, <-chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	commands := make(chan []string, len(replies))
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			for len(replies) > 0 {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					break
+				}
+				count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+				command := make([]string, count)
+				for i := range command {
+					reader.ReadString('\n')
+					arg, _ := reader.ReadString('\n')
+					command[i] = strings.TrimSuffix(arg, "\r\n")
+				}
+				commands <- command
+				conn.Write([]byte(replies[0]))
+				replies = replies[1:]
+			}
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().String(), commands
+}
+
+func TestRedis_Do_ShouldReturnErrorIfAddressIsEmpty(t *testing.T) {
+	handler := RedisHandler{}
+
+	_, err := handler.Do(context.Background(), "PING")
+	require.NotNil(t, err)
+}
+
+func TestRedis_Get_ShouldReturnValue(t *testing.T) {
+	addr, commands := fakeRedis(t, "$5\r\nvalue\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	value, err := handler.Get(context.Background(), "key")
+	require.Nil(t, err)
+	require.Equal(t, []byte("value"), value)
+	require.Equal(t, []string{"GET", "key"}, <-commands)
+}
+
+func TestRedis_Get_ShouldReturnNilIfKeyIsMissing(t *testing.T) {
+	addr, _ := fakeRedis(t, "$-1\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	value, err := handler.Get(context.Background(), "key")
+	require.Nil(t, err)
+	require.Nil(t, value)
+}
+
+func TestRedis_Set_ShouldAuthenticateAndSetExpiry(t *testing.T) {
+	addr, commands := fakeRedis(t, "+OK\r\n", "+OK\r\n", "+OK\r\n")
+	handler := RedisHandler{Address: addr, Password: "secret", Database: 2, Timeout: time.Second}
+
+	require.Nil(t, handler.Set(context.Background(), "key", []byte("value"), time.Minute))
+	require.Equal(t, []string{"AUTH", "secret"}, <-commands)
+	require.Equal(t, []string{"SELECT", "2"}, <-commands)
+	require.Equal(t, []string{"SET", "key", "value", "PX", "60000"}, <-commands)
+}
+
+func TestRedis_Incr_ShouldReturnNewValueAndReuseConnection(t *testing.T) {
+	addr, _ := fakeRedis(t, ":1\r\n", ":2\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	value, err := handler.Incr(context.Background(), "counter")
+	require.Nil(t, err)
+	require.Equal(t, int64(1), value)
+
+	value, err = handler.Incr(context.Background(), "counter")
+	require.Nil(t, err)
+	require.Equal(t, int64(2), value)
+}
+
+func TestRedis_Do_ShouldReturnErrorReplies(t *testing.T) {
+	addr, _ := fakeRedis(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	_, err := handler.Incr(context.Background(), "key")
+	require.NotNil(t, err)
+	require.IsType(t, RedisError(""), err)
+}
+
+func TestRedis_Do_ShouldParseArrayReplies(t *testing.T) {
+	addr, _ := fakeRedis(t, "*3\r\n$1\r\na\r\n:5\r\n$-1\r\n")
+	handler := RedisHandler{Address: addr, Timeout: time.Second}
+
+	reply, err := handler.Do(context.Background(), "EXEC")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{[]byte("a"), int64(5), nil}, reply)
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Handler is an ObjectStore for a bucket in S3 or a service compatible with it, such as MinIO, signing requests with
+// AWS Signature Version 4. Objects are addressed as bucket.host/key on the endpoint unless PathStyle is set, which
+// addresses them as host/bucket/key as most self-hosted services expect.
+type S3Handler struct {
+	HttpClient      Requestor
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+}
+
+func (s *S3Handler) PutObject(ctx context.Context, key string, body []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, body, map[string]string{"Content-Type": contentType})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkS3Response(resp)
+}
+
+func (s *S3Handler) GetObject(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if err := checkS3Response(resp); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *S3Handler) ObjectExists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return true, checkS3Response(resp)
+}
+
+// objectURL returns the URL of the object with the key.
+func (s *S3Handler) objectURL(key string) (*url.URL, error) {
+	if s.Endpoint == "" || s.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket cannot be empty")
+	}
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.TrimSuffix(endpoint.Path, "/") + "/" + key
+	if s.PathStyle {
+		path = strings.TrimSuffix(endpoint.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+	}
+	endpoint.Path = path
+	endpoint.RawPath = uriEncode(path, false)
+	return endpoint, nil
+}
+
+func (s *S3Handler) do(ctx context.Context, method string, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	hash := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(hash[:]), time.Now())
+	return s.HttpClient.Do(req)
+}
+
+// sign adds the date, payload hash and Authorization headers of Signature Version 4 to a request, signing the host and
+// every header already set on it.
+func (s *S3Handler) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonical := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		canonical[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(canonical))
+	for name := range canonical {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%v:%v\n", name, canonical[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(request))
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v,SignedHeaders=%v,Signature=%v",
+		s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as Signature Version 4 signs them.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and slashes unless encodeSlash is set.
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+func checkS3Response(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 returned %v: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
@@ -0,0 +1,12 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"music-stream-api/pkg/models"
+)
+
+type Scanner interface {
+	Scan(ctx context.Context, file io.Reader) (*models.ScanResult, error)
+}
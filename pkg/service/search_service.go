@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+
+	"music-stream-api/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SearchIndex interface {
+	IndexTrack(ctx context.Context, tenant string, track models.Track) error
+	DeleteTrack(ctx context.Context, tenant string, id primitive.ObjectID) error
+	Search(ctx context.Context, tenant string, query string, limit int) ([]primitive.ObjectID, error)
+}
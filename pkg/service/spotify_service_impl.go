@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"music-stream-api/pkg/models"
+)
+
+// SpotifyHandler looks up track metadata and lists the tracks of public playlists on the Spotify Web API using the
+// client credentials flow. Access tokens are cached until shortly before they expire.
+type SpotifyHandler struct {
+	HttpClient   Requestor
+	AccountsURL  string
+	APIURL       string
+	ClientID     string
+	ClientSecret string
+
+	mu           sync.Mutex
+	accessToken  string
+	tokenExpires time.Time
+}
+
+type spotifyTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type spotifySearchResponse struct {
+	Tracks struct {
+		Items []struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			Artists []struct {
+				Name string `json:"name"`
+			} `json:"artists"`
+			Album struct {
+				Name        string `json:"name"`
+				ReleaseDate string `json:"release_date"`
+				Images      []struct {
+					URL string `json:"url"`
+				} `json:"images"`
+			} `json:"album"`
+		} `json:"items"`
+	} `json:"tracks"`
+}
+
+var titleNoise = regexp.MustCompile(`(?i)\s*[(\[][^)\]]*(official|video|audio|lyric|visuali[sz]er|hd|hq|4k|remaster)[^)\]]*[)\]]`)
+
+func (s *SpotifyHandler) LookupTrack(ctx context.Context, artist string, title string) (*models.TrackMetadata, error) {
+	if s.ClientID == "" || s.ClientSecret == "" {
+		return nil, errors.New("spotify client credentials cannot be empty")
+	}
+
+	artist, title = CleanTitle(artist, title)
+	if title == "" {
+		return nil, errors.New("title cannot be empty")
+	}
+
+	query := fmt.Sprintf("track:%v", title)
+	if artist != "" {
+		query = fmt.Sprintf("%v artist:%v", query, artist)
+	}
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("type", "track")
+	params.Set("limit", "1")
+
+	var search spotifySearchResponse
+	if _, err := s.getJSON(ctx, fmt.Sprintf("%v/search?%v", s.APIURL, params.Encode()), &search); err != nil {
+		return nil, err
+	}
+	if len(search.Tracks.Items) == 0 {
+		return nil, nil
+	}
+
+	item := search.Tracks.Items[0]
+	metadata := &models.TrackMetadata{
+		Name:      item.Name,
+		AlbumName: item.Album.Name,
+	}
+
+	var artists []string
+	for _, a := range item.Artists {
+		artists = append(artists, a.Name)
+	}
+	metadata.Artist = strings.Join(artists, ", ")
+
+	if len(item.Album.ReleaseDate) >= 4 {
+		if year, err := strconv.Atoi(item.Album.ReleaseDate[:4]); err == nil {
+			metadata.Year = year
+		}
+	}
+	if len(item.Album.Images) > 0 {
+		metadata.ArtworkURL = item.Album.Images[0].URL
+	}
+
+	return metadata, nil
+}
+
+// spotifyPlaylistID matches the ID in a playlist's open.spotify.com URL, which may carry a locale such as /intl-de, or
+// in its spotify: URI.
+var spotifyPlaylistID = regexp.MustCompile(`^(?:https?://open\.spotify\.com(?:/intl-[a-zA-Z-]+)?/playlist/|spotify:playlist:)([0-9A-Za-z]+)(?:[/?#].*)?$`)
+
+// spotifyPlaylistFields limits a playlist response to what GetPlaylist uses.
+const spotifyPlaylistFields = "name,tracks(next,items(track(name,duration_ms,artists(name),album(name))))"
+
+type spotifyPlaylistTracks struct {
+	Next  string `json:"next"`
+	Items []struct {
+		// Track is null for entries that are no longer available.
+		Track *struct {
+			Name       string `json:"name"`
+			DurationMS int    `json:"duration_ms"`
+			Artists    []struct {
+				Name string `json:"name"`
+			} `json:"artists"`
+			Album struct {
+				Name string `json:"name"`
+			} `json:"album"`
+		} `json:"track"`
+	} `json:"items"`
+}
+
+type spotifyPlaylistResponse struct {
+	Name   string                `json:"name"`
+	Tracks spotifyPlaylistTracks `json:"tracks"`
+}
+
+// GetPlaylist lists the tracks of a public playlist, following its pages of tracks to the end. Entries that are no
+// longer available on Spotify are left out, though they keep their place in the numbering of positions.
+func (s *SpotifyHandler) GetPlaylist(ctx context.Context, playlistURL string) (*models.ExternalPlaylist, error) {
+	if s.ClientID == "" || s.ClientSecret == "" {
+		return nil, errors.New("spotify client credentials cannot be empty")
+	}
+	match := spotifyPlaylistID.FindStringSubmatch(strings.TrimSpace(playlistURL))
+	if match == nil {
+		return nil, ErrInvalidPlaylistURL
+	}
+
+	params := url.Values{}
+	params.Set("fields", spotifyPlaylistFields)
+	var response spotifyPlaylistResponse
+	if status, err := s.getJSON(ctx, fmt.Sprintf("%v/playlists/%v?%v", s.APIURL, match[1], params.Encode()), &response); status == http.StatusNotFound {
+		return nil, ErrPlaylistNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	playlist := &models.ExternalPlaylist{Name: response.Name, Tracks: []models.ExternalTrack{}}
+	page, position := response.Tracks, 0
+	for {
+		for _, item := range page.Items {
+			position++
+			if item.Track == nil {
+				continue
+			}
+
+			track := models.ExternalTrack{
+				Position:  position,
+				Name:      item.Track.Name,
+				AlbumName: item.Track.Album.Name,
+				Duration:  float64(item.Track.DurationMS) / 1000,
+			}
+			for _, artist := range item.Track.Artists {
+				track.Artists = append(track.Artists, artist.Name)
+			}
+			playlist.Tracks = append(playlist.Tracks, track)
+		}
+
+		if page.Next == "" {
+			return playlist, nil
+		}
+		next := page.Next
+		page = spotifyPlaylistTracks{}
+		if _, err := s.getJSON(ctx, next, &page); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// getJSON makes an authorised GET request to the Web API and decodes its response into v, returning the response's
+// status code along with any error. A 401 drops the cached access token, so that the next request fetches a new one.
+func (s *SpotifyHandler) getJSON(ctx context.Context, requestURL string, v interface{}) (int, error) {
+	token, err := s.getAccessToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", token))
+
+	resp, err := s.HttpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		s.clearAccessToken()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, errors.New(fmt.Sprintf("non-200 status code received: %v", resp.StatusCode))
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (s *SpotifyHandler) getAccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.tokenExpires) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%v/api/token", s.AccountsURL), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.ClientID, s.ClientSecret)
+
+	resp, err := s.HttpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf("non-200 status code received requesting token: %v", resp.StatusCode))
+	}
+
+	var token spotifyTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	s.accessToken = token.AccessToken
+	s.tokenExpires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - 30*time.Second)
+	return s.accessToken, nil
+}
+
+func (s *SpotifyHandler) clearAccessToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = ""
+}
+
+// CleanTitle strips the decorations YouTube uploads tend to carry, such as "(Official Video)" or "[HD]", from a
+// title. If no artist is given and the title is in the common "Artist - Title" form, it is split into both parts.
+func CleanTitle(artist string, title string) (string, string) {
+	title = strings.TrimSpace(titleNoise.ReplaceAllString(title, ""))
+
+	if artist == "" {
+		if parts := strings.SplitN(title, " - ", 2); len(parts) == 2 {
+			artist, title = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+	}
+
+	return artist, title
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"music-stream-api/pkg/models"
+	"music-stream-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testSpotifySearchResponse = `{"tracks":{"items":[{"id":"1","name":"Song","artists":[{"name":"Band"}],` +
+	`"album":{"name":"Album","release_date":"2004-02-01","images":[{"url":"http://art/cover.jpg"}]}}]}}`
+
+func isTokenRequest(r *http.Request) bool {
+	return r.URL.Path == "/api/token"
+}
+
+func TestSpotify_LookupTrack_ShouldReturnErrorIfCredentialsAreEmpty(t *testing.T) {
+	handler := SpotifyHandler{HttpClient: &mocks.Requestor{}}
+
+	_, err := handler.LookupTrack(context.Background(), "artist", "title")
+	require.NotNil(t, err)
+	require.Equal(t, "spotify client credentials cannot be empty", err.Error())
+}
+
+func TestSpotify_LookupTrack_ShouldReturnErrorIfErrorOccursRequestingToken(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(isTokenRequest)).Return(nil, errors.New("test"))
+
+	handler := SpotifyHandler{HttpClient: requestor, AccountsURL: "http://accounts", APIURL: "http://api", ClientID: "id", ClientSecret: "secret"}
+
+	_, err := handler.LookupTrack(context.Background(), "artist", "title")
+	require.NotNil(t, err)
+	require.Equal(t, "test", err.Error())
+}
+
+func TestSpotify_LookupTrack_ShouldReturnErrorIfSearchResponseCodeIsNot200(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(isTokenRequest)).Return(jsonResponse(http.StatusOK, `{"access_token":"token","expires_in":3600}`), nil)
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusTooManyRequests, ""), nil)
+
+	handler := SpotifyHandler{HttpClient: requestor, AccountsURL: "http://accounts", APIURL: "http://api", ClientID: "id", ClientSecret: "secret"}
+
+	_, err := handler.LookupTrack(context.Background(), "artist", "title")
+	require.NotNil(t, err)
+	require.Equal(t, "non-200 status code received: 429", err.Error())
+}
+
+func TestSpotify_LookupTrack_ShouldReturnMetadataOnSuccess(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(isTokenRequest)).Return(jsonResponse(http.StatusOK, `{"access_token":"token","expires_in":3600}`), nil)
+	requestor.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.URL.Path == "/search" && r.URL.Query().Get("q") == "track:Song artist:Band" && r.Header.Get("Authorization") == "Bearer token"
+	})).Return(jsonResponse(http.StatusOK, testSpotifySearchResponse), nil)
+
+	handler := SpotifyHandler{HttpClient: requestor, AccountsURL: "http://accounts", APIURL: "http://api", ClientID: "id", ClientSecret: "secret"}
+
+	metadata, err := handler.LookupTrack(context.Background(), "", "Band - Song (Official Video) [HD]")
+	require.Nil(t, err)
+	require.Equal(t, "Song", metadata.Name)
+	require.Equal(t, "Band", metadata.Artist)
+	require.Equal(t, "Album", metadata.AlbumName)
+	require.Equal(t, 2004, metadata.Year)
+	require.Equal(t, "http://art/cover.jpg", metadata.ArtworkURL)
+}
+
+func TestSpotify_CleanTitle_ShouldStripVideoDecorations(t *testing.T) {
+	artist, title := CleanTitle("", "Band - Song (Official Music Video) [4K Remaster]")
+	require.Equal(t, "Band", artist)
+	require.Equal(t, "Song", title)
+
+	artist, title = CleanTitle("Other", "Song (Lyrics)")
+	require.Equal(t, "Other", artist)
+	require.Equal(t, "Song", title)
+}
+
+func TestSpotify_GetPlaylist_ShouldFollowPagesOfTracks(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(isTokenRequest)).Return(jsonResponse(http.StatusOK, `{"access_token":"token","expires_in":3600}`), nil)
+	requestor.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.URL.Path == "/playlists/abc123" && r.URL.Query().Get("fields") != ""
+	})).Return(jsonResponse(http.StatusOK, `{"name":"Mix","tracks":{"next":"http://api/playlists/abc123/tracks?offset=2","items":[`+
+		`{"track":{"name":"Song","duration_ms":180500,"artists":[{"name":"Band"},{"name":"Guest"}],"album":{"name":"Album"}}},`+
+		`{"track":null}]}}`), nil)
+	requestor.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.URL.Path == "/playlists/abc123/tracks" && r.URL.Query().Get("offset") == "2"
+	})).Return(jsonResponse(http.StatusOK, `{"items":[{"track":{"name":"Other","artists":[{"name":"Singer"}],"album":{"name":""}}}]}`), nil)
+
+	handler := SpotifyHandler{HttpClient: requestor, AccountsURL: "http://accounts", APIURL: "http://api", ClientID: "id", ClientSecret: "secret"}
+
+	playlist, err := handler.GetPlaylist(context.Background(), "https://open.spotify.com/intl-de/playlist/abc123?si=xyz")
+	require.Nil(t, err)
+	require.Equal(t, &models.ExternalPlaylist{
+		Name: "Mix",
+		Tracks: []models.ExternalTrack{
+			{Position: 1, Name: "Song", Artists: []string{"Band", "Guest"}, AlbumName: "Album", Duration: 180.5},
+			{Position: 3, Name: "Other", Artists: []string{"Singer"}},
+		},
+	}, playlist)
+}
+
+func TestSpotify_GetPlaylist_ShouldRejectOtherURLsAndReportMissingPlaylists(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.MatchedBy(isTokenRequest)).Return(jsonResponse(http.StatusOK, `{"access_token":"token","expires_in":3600}`), nil)
+	requestor.On("Do", mock.Anything).Return(jsonResponse(http.StatusNotFound, ""), nil)
+
+	handler := SpotifyHandler{HttpClient: requestor, AccountsURL: "http://accounts", APIURL: "http://api", ClientID: "id", ClientSecret: "secret"}
+
+	_, err := handler.GetPlaylist(context.Background(), "https://open.spotify.com/album/abc123")
+	require.Equal(t, ErrInvalidPlaylistURL, err)
+
+	_, err = handler.GetPlaylist(context.Background(), "spotify:playlist:abc123")
+	require.Equal(t, ErrPlaylistNotFound, err)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// TokenCache remembers tokens the login service has accepted so that repeat requests with the same token skip the
+// round trip. Entries live for at most TTL, never beyond the token's own "exp" claim, and the cache holds at most
+// MaxEntries tokens. Tokens are stored hashed.
+type TokenCache struct {
+	TTL        time.Duration
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]time.Time
+}
+
+func NewTokenCache(ttl time.Duration, maxEntries int) *TokenCache {
+	return &TokenCache{TTL: ttl, MaxEntries: maxEntries, entries: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// Valid reports whether the token was accepted recently enough to trust without asking the login service again.
+func (c *TokenCache) Valid(token string) bool {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if !time.Now().Before(expires) {
+		delete(c.entries, key)
+		return false
+	}
+	return true
+}
+
+func (c *TokenCache) Add(token string) {
+	if c.TTL <= 0 || c.MaxEntries <= 0 {
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(c.TTL)
+	if exp, ok := tokenExpiry(token); ok && exp.Before(expires) {
+		expires = exp
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.MaxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = expires
+}
+
+// Remove forgets a token, so that its next use is checked with the login service.
+func (c *TokenCache) Remove(token string) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// evict makes room for a new entry by dropping expired entries, or failing that the entry closest to expiry.
+func (c *TokenCache) evict(now time.Time) {
+	var oldestKey [sha256.Size]byte
+	var oldest time.Time
+	for key, expires := range c.entries {
+		if !now.Before(expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest.IsZero() || expires.Before(oldest) {
+			oldestKey, oldest = key, expires
+		}
+	}
+
+	if len(c.entries) >= c.MaxEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// tokenExpiry reads the "exp" claim of a JWT without verifying it. Tokens that are not JWTs have no known expiry.
+func tokenExpiry(token string) (time.Time, bool) {
+	claims, err := TokenClaims(token)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok || exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp": %v}`, exp.Unix())))
+	return "header." + payload + ".signature"
+}
+
+func TestTokenCache_Valid_ShouldReturnTrueForAddedToken(t *testing.T) {
+	cache := NewTokenCache(time.Minute, 10)
+	cache.Add("test")
+	require.True(t, cache.Valid("test"))
+	require.False(t, cache.Valid("other"))
+}
+
+func TestTokenCache_Valid_ShouldReturnFalseAfterRemove(t *testing.T) {
+	cache := NewTokenCache(time.Minute, 10)
+	cache.Add("test")
+	cache.Remove("test")
+	require.False(t, cache.Valid("test"))
+}
+
+func TestTokenCache_Add_ShouldNotCacheBeyondTokenExpiry(t *testing.T) {
+	cache := NewTokenCache(time.Minute, 10)
+	token := testJWT(time.Now().Add(-time.Second))
+	cache.Add(token)
+	require.False(t, cache.Valid(token))
+}
+
+func TestTokenCache_Add_ShouldEvictEntryClosestToExpiryWhenFull(t *testing.T) {
+	cache := NewTokenCache(time.Hour, 2)
+	soonest := testJWT(time.Now().Add(time.Minute))
+	cache.Add(soonest)
+	cache.Add("second")
+	cache.Add("third")
+
+	require.False(t, cache.Valid(soonest))
+	require.True(t, cache.Valid("second"))
+	require.True(t, cache.Valid("third"))
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLSigner_Verify_ShouldReturnClaimsForValidToken(t *testing.T) {
+	signer := URLSigner{Secret: []byte("secret")}
+
+	token, err := signer.Sign(SignedClaims{Subject: "test", Tenant: "tenant", Expires: time.Now().Add(time.Minute).Unix()})
+	require.Nil(t, err)
+
+	claims, err := signer.Verify(token)
+	require.Nil(t, err)
+	require.Equal(t, "test", claims.Subject)
+	require.Equal(t, "tenant", claims.Tenant)
+}
+
+func TestURLSigner_Verify_ShouldReturnErrorIfTokenSignedWithAnotherSecret(t *testing.T) {
+	token, err := (&URLSigner{Secret: []byte("other")}).Sign(SignedClaims{Subject: "test", Expires: time.Now().Add(time.Minute).Unix()})
+	require.Nil(t, err)
+
+	_, err = (&URLSigner{Secret: []byte("secret")}).Verify(token)
+	require.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestURLSigner_Verify_ShouldReturnErrorIfTokenExpired(t *testing.T) {
+	signer := URLSigner{Secret: []byte("secret")}
+
+	token, err := signer.Sign(SignedClaims{Subject: "test", Expires: time.Now().Add(-time.Minute).Unix()})
+	require.Nil(t, err)
+
+	_, err = signer.Verify(token)
+	require.Equal(t, ErrSignatureExpired, err)
+}
+
+func TestURLSigner_Verify_ShouldReturnErrorIfTokenMalformed(t *testing.T) {
+	signer := URLSigner{Secret: []byte("secret")}
+
+	_, err := signer.Verify("test")
+	require.Equal(t, ErrInvalidSignature, err)
+}
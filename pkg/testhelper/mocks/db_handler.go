@@ -5,10 +5,12 @@ package mocks
 import (
 	context "context"
 
-	mock "github.com/stretchr/testify/mock"
+	io "io"
 
 	models "music-stream-api/pkg/models"
+	time "time"
 
+	mock "github.com/stretchr/testify/mock"
 	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -17,6 +19,48 @@ type DbHandler struct {
 	mock.Mock
 }
 
+// AddAPIKey provides a mock function with given fields: ctx, key
+func (_m *DbHandler) AddAPIKey(ctx context.Context, key models.APIKey) error {
+	ret := _m.Called(ctx, key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.APIKey) error); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddJob provides a mock function with given fields: ctx, job
+func (_m *DbHandler) AddJob(ctx context.Context, job models.Job) error {
+	ret := _m.Called(ctx, job)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Job) error); ok {
+		r0 = rf(ctx, job)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddPlay provides a mock function with given fields: ctx, play
+func (_m *DbHandler) AddPlay(ctx context.Context, play models.Play) error {
+	ret := _m.Called(ctx, play)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Play) error); ok {
+		r0 = rf(ctx, play)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // AddPlaylist provides a mock function with given fields: ctx, playlist
 func (_m *DbHandler) AddPlaylist(ctx context.Context, playlist models.Playlist) error {
 	ret := _m.Called(ctx, playlist)
@@ -31,6 +75,34 @@ func (_m *DbHandler) AddPlaylist(ctx context.Context, playlist models.Playlist)
 	return r0
 }
 
+// AddPodcast provides a mock function with given fields: ctx, podcast
+func (_m *DbHandler) AddPodcast(ctx context.Context, podcast models.Podcast) error {
+	ret := _m.Called(ctx, podcast)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Podcast) error); ok {
+		r0 = rf(ctx, podcast)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddShare provides a mock function with given fields: ctx, share
+func (_m *DbHandler) AddShare(ctx context.Context, share models.Share) error {
+	ret := _m.Called(ctx, share)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Share) error); ok {
+		r0 = rf(ctx, share)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // AddTrack provides a mock function with given fields: ctx, track
 func (_m *DbHandler) AddTrack(ctx context.Context, track models.Track) error {
 	ret := _m.Called(ctx, track)
@@ -45,6 +117,55 @@ func (_m *DbHandler) AddTrack(ctx context.Context, track models.Track) error {
 	return r0
 }
 
+// AddTrackTags provides a mock function with given fields: ctx, id, tags, revision
+func (_m *DbHandler) AddTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	ret := _m.Called(ctx, id, tags, revision)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, []string, int64) error); ok {
+		r0 = rf(ctx, id, tags, revision)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ClaimJob provides a mock function with given fields: ctx, worker, kinds, lease
+func (_m *DbHandler) ClaimJob(ctx context.Context, worker string, kinds []string, lease time.Duration) (models.Job, error) {
+	ret := _m.Called(ctx, worker, kinds, lease)
+
+	var r0 models.Job
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string, time.Duration) models.Job); ok {
+		r0 = rf(ctx, worker, kinds, lease)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string, time.Duration) error); ok {
+		r1 = rf(ctx, worker, kinds, lease)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteAudioFile provides a mock function with given fields: ctx, audioFileID
+func (_m *DbHandler) DeleteAudioFile(ctx context.Context, audioFileID primitive.ObjectID) error {
+	ret := _m.Called(ctx, audioFileID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) error); ok {
+		r0 = rf(ctx, audioFileID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeletePlaylist provides a mock function with given fields: ctx, id
 func (_m *DbHandler) DeletePlaylist(ctx context.Context, id primitive.ObjectID) error {
 	ret := _m.Called(ctx, id)
@@ -59,6 +180,20 @@ func (_m *DbHandler) DeletePlaylist(ctx context.Context, id primitive.ObjectID)
 	return r0
 }
 
+// DeletePodcast provides a mock function with given fields: ctx, id
+func (_m *DbHandler) DeletePodcast(ctx context.Context, id primitive.ObjectID) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteTrack provides a mock function with given fields: ctx, id
 func (_m *DbHandler) DeleteTrack(ctx context.Context, id primitive.ObjectID) error {
 	ret := _m.Called(ctx, id)
@@ -96,6 +231,154 @@ func (_m *DbHandler) DownloadAudioFile(ctx context.Context, audioFileID primitiv
 	return r0, r1
 }
 
+// EnsureIndexes provides a mock function with given fields: ctx
+func (_m *DbHandler) EnsureIndexes(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FindOrphanedAudioFiles provides a mock function with given fields: ctx
+func (_m *DbHandler) FindOrphanedAudioFiles(ctx context.Context) ([]primitive.ObjectID, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []primitive.ObjectID
+	if rf, ok := ret.Get(0).(func(context.Context) []primitive.ObjectID); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]primitive.ObjectID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAPIKeys provides a mock function with given fields: ctx, filters
+func (_m *DbHandler) GetAPIKeys(ctx context.Context, filters map[string]interface{}) ([]models.APIKey, error) {
+	ret := _m.Called(ctx, filters)
+
+	var r0 []models.APIKey
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}) []models.APIKey); ok {
+		r0 = rf(ctx, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}) error); ok {
+		r1 = rf(ctx, filters)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobs provides a mock function with given fields: ctx, filters
+func (_m *DbHandler) GetJobs(ctx context.Context, filters map[string]interface{}) ([]models.Job, error) {
+	ret := _m.Called(ctx, filters)
+
+	var r0 []models.Job
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}) []models.Job); ok {
+		r0 = rf(ctx, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Job)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}) error); ok {
+		r1 = rf(ctx, filters)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNowPlaying provides a mock function with given fields: ctx, user
+func (_m *DbHandler) GetNowPlaying(ctx context.Context, user string) (models.NowPlaying, error) {
+	ret := _m.Called(ctx, user)
+
+	var r0 models.NowPlaying
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.NowPlaying); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Get(0).(models.NowPlaying)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPlayCounts provides a mock function with given fields: ctx, since
+func (_m *DbHandler) GetPlayCounts(ctx context.Context, since time.Time) ([]models.PlayCount, error) {
+	ret := _m.Called(ctx, since)
+
+	var r0 []models.PlayCount
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) []models.PlayCount); ok {
+		r0 = rf(ctx, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.PlayCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPlaylistPage provides a mock function with given fields: ctx, id, offset, limit
+func (_m *DbHandler) GetPlaylistPage(ctx context.Context, id primitive.ObjectID, offset int, limit int) (models.PlaylistPage, error) {
+	ret := _m.Called(ctx, id, offset, limit)
+
+	var r0 models.PlaylistPage
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, int, int) models.PlaylistPage); ok {
+		r0 = rf(ctx, id, offset, limit)
+	} else {
+		r0 = ret.Get(0).(models.PlaylistPage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, int, int) error); ok {
+		r1 = rf(ctx, id, offset, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetPlaylists provides a mock function with given fields: ctx, filters
 func (_m *DbHandler) GetPlaylists(ctx context.Context, filters map[string]interface{}) ([]models.Playlist, error) {
 	ret := _m.Called(ctx, filters)
@@ -119,6 +402,98 @@ func (_m *DbHandler) GetPlaylists(ctx context.Context, filters map[string]interf
 	return r0, r1
 }
 
+// GetPodcasts provides a mock function with given fields: ctx, filters
+func (_m *DbHandler) GetPodcasts(ctx context.Context, filters map[string]interface{}) ([]models.Podcast, error) {
+	ret := _m.Called(ctx, filters)
+
+	var r0 []models.Podcast
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}) []models.Podcast); ok {
+		r0 = rf(ctx, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Podcast)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}) error); ok {
+		r1 = rf(ctx, filters)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRecentTracks provides a mock function with given fields: ctx, since
+func (_m *DbHandler) GetRecentTracks(ctx context.Context, since time.Time) ([]models.Track, error) {
+	ret := _m.Called(ctx, since)
+
+	var r0 []models.Track
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) []models.Track); ok {
+		r0 = rf(ctx, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Track)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetShares provides a mock function with given fields: ctx, filters
+func (_m *DbHandler) GetShares(ctx context.Context, filters map[string]interface{}) ([]models.Share, error) {
+	ret := _m.Called(ctx, filters)
+
+	var r0 []models.Share
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}) []models.Share); ok {
+		r0 = rf(ctx, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Share)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}) error); ok {
+		r1 = rf(ctx, filters)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSuggestions provides a mock function with given fields: ctx, prefix, limit
+func (_m *DbHandler) GetSuggestions(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	ret := _m.Called(ctx, prefix, limit)
+
+	var r0 []models.Suggestion
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []models.Suggestion); ok {
+		r0 = rf(ctx, prefix, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Suggestion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, prefix, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetTracks provides a mock function with given fields: ctx, filters
 func (_m *DbHandler) GetTracks(ctx context.Context, filters map[string]interface{}) ([]models.Track, error) {
 	ret := _m.Called(ctx, filters)
@@ -142,6 +517,20 @@ func (_m *DbHandler) GetTracks(ctx context.Context, filters map[string]interface
 	return r0, r1
 }
 
+// MovePlaylistTrack provides a mock function with given fields: ctx, playlistId, trackId, index, revision
+func (_m *DbHandler) MovePlaylistTrack(ctx context.Context, playlistId primitive.ObjectID, trackId primitive.ObjectID, index int, revision int64) error {
+	ret := _m.Called(ctx, playlistId, trackId, index, revision)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, primitive.ObjectID, int, int64) error); ok {
+		r0 = rf(ctx, playlistId, trackId, index, revision)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Ping provides a mock function with given fields: ctx
 func (_m *DbHandler) Ping(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -156,13 +545,55 @@ func (_m *DbHandler) Ping(ctx context.Context) error {
 	return r0
 }
 
-// UpdatePlaylist provides a mock function with given fields: ctx, playlistId, update
-func (_m *DbHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update primitive.M) error {
-	ret := _m.Called(ctx, playlistId, update)
+// PingAudioStore provides a mock function with given fields: ctx
+func (_m *DbHandler) PingAudioStore(ctx context.Context) error {
+	ret := _m.Called(ctx)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, primitive.M) error); ok {
-		r0 = rf(ctx, playlistId, update)
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RecordSharePlay provides a mock function with given fields: ctx, id
+func (_m *DbHandler) RecordSharePlay(ctx context.Context, id primitive.ObjectID) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveTrackTags provides a mock function with given fields: ctx, id, tags, revision
+func (_m *DbHandler) RemoveTrackTags(ctx context.Context, id primitive.ObjectID, tags []string, revision int64) error {
+	ret := _m.Called(ctx, id, tags, revision)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, []string, int64) error); ok {
+		r0 = rf(ctx, id, tags, revision)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreAudioFile provides a mock function with given fields: ctx, id, audioFile, name
+func (_m *DbHandler) RestoreAudioFile(ctx context.Context, id primitive.ObjectID, audioFile []byte, name string) error {
+	ret := _m.Called(ctx, id, audioFile, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, []byte, string) error); ok {
+		r0 = rf(ctx, id, audioFile, name)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -170,13 +601,178 @@ func (_m *DbHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.Ob
 	return r0
 }
 
-// UpdateTrack provides a mock function with given fields: ctx, id, updatedTrack
-func (_m *DbHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track) error {
-	ret := _m.Called(ctx, id, updatedTrack)
+// RestoreDocument provides a mock function with given fields: ctx, collection, doc, replace
+func (_m *DbHandler) RestoreDocument(ctx context.Context, collection string, doc interface{}, replace bool) error {
+	ret := _m.Called(ctx, collection, doc, replace)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}, bool) error); ok {
+		r0 = rf(ctx, collection, doc, replace)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SampleTracks provides a mock function with given fields: ctx, filters, count
+func (_m *DbHandler) SampleTracks(ctx context.Context, filters map[string]interface{}, count int) ([]models.Track, error) {
+	ret := _m.Called(ctx, filters, count)
+
+	var r0 []models.Track
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}, int) []models.Track); ok {
+		r0 = rf(ctx, filters, count)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Track)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}, int) error); ok {
+		r1 = rf(ctx, filters, count)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SearchTracks provides a mock function with given fields: ctx, query, limit
+func (_m *DbHandler) SearchTracks(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	ret := _m.Called(ctx, query, limit)
+
+	var r0 []models.Track
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []models.Track); ok {
+		r0 = rf(ctx, query, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Track)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, query, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetNowPlaying provides a mock function with given fields: ctx, state
+func (_m *DbHandler) SetNowPlaying(ctx context.Context, state models.NowPlaying) error {
+	ret := _m.Called(ctx, state)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.NowPlaying) error); ok {
+		r0 = rf(ctx, state)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTrackAudio provides a mock function with given fields: ctx, id, track
+func (_m *DbHandler) SetTrackAudio(ctx context.Context, id primitive.ObjectID, track models.Track) error {
+	ret := _m.Called(ctx, id, track)
 
 	var r0 error
 	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, models.Track) error); ok {
-		r0 = rf(ctx, id, updatedTrack)
+		r0 = rf(ctx, id, track)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTrackLastPlayed provides a mock function with given fields: ctx, id, playedAt
+func (_m *DbHandler) SetTrackLastPlayed(ctx context.Context, id primitive.ObjectID, playedAt time.Time) error {
+	ret := _m.Called(ctx, id, playedAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, time.Time) error); ok {
+		r0 = rf(ctx, id, playedAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TransitionJob provides a mock function with given fields: ctx, id, from, update
+func (_m *DbHandler) TransitionJob(ctx context.Context, id primitive.ObjectID, from []string, update primitive.M) (models.Job, error) {
+	ret := _m.Called(ctx, id, from, update)
+
+	var r0 models.Job
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, []string, primitive.M) models.Job); ok {
+		r0 = rf(ctx, id, from, update)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, []string, primitive.M) error); ok {
+		r1 = rf(ctx, id, from, update)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateJob provides a mock function with given fields: ctx, id, update
+func (_m *DbHandler) UpdateJob(ctx context.Context, id primitive.ObjectID, update primitive.M) error {
+	ret := _m.Called(ctx, id, update)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, primitive.M) error); ok {
+		r0 = rf(ctx, id, update)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdatePlaylist provides a mock function with given fields: ctx, playlistId, update, revision
+func (_m *DbHandler) UpdatePlaylist(ctx context.Context, playlistId primitive.ObjectID, update primitive.M, revision int64) error {
+	ret := _m.Called(ctx, playlistId, update, revision)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, primitive.M, int64) error); ok {
+		r0 = rf(ctx, playlistId, update, revision)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdatePodcast provides a mock function with given fields: ctx, id, update
+func (_m *DbHandler) UpdatePodcast(ctx context.Context, id primitive.ObjectID, update primitive.M) error {
+	ret := _m.Called(ctx, id, update)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, primitive.M) error); ok {
+		r0 = rf(ctx, id, update)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateTrack provides a mock function with given fields: ctx, id, updatedTrack, revision
+func (_m *DbHandler) UpdateTrack(ctx context.Context, id primitive.ObjectID, updatedTrack models.Track, revision int64) error {
+	ret := _m.Called(ctx, id, updatedTrack, revision)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, models.Track, int64) error); ok {
+		r0 = rf(ctx, id, updatedTrack, revision)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -206,3 +802,54 @@ func (_m *DbHandler) UploadAudioFile(ctx context.Context, audioFile []byte, trac
 
 	return r0, r1
 }
+
+// UploadAudioStream provides a mock function with given fields: ctx, audio, trackName
+func (_m *DbHandler) UploadAudioStream(ctx context.Context, audio io.Reader, trackName string) (interface{}, error) {
+	ret := _m.Called(ctx, audio, trackName)
+
+	var r0 interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, io.Reader, string) interface{}); ok {
+		r0 = rf(ctx, audio, trackName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, io.Reader, string) error); ok {
+		r1 = rf(ctx, audio, trackName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WatchPlaylists provides a mock function with given fields: ctx, handle
+func (_m *DbHandler) WatchPlaylists(ctx context.Context, handle func(models.PlaylistChange) error) error {
+	ret := _m.Called(ctx, handle)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(models.PlaylistChange) error) error); ok {
+		r0 = rf(ctx, handle)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WatchTracks provides a mock function with given fields: ctx, handle
+func (_m *DbHandler) WatchTracks(ctx context.Context, handle func(models.TrackChange) error) error {
+	ret := _m.Called(ctx, handle)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(models.TrackChange) error) error); ok {
+		r0 = rf(ctx, handle)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -2,23 +2,36 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	models "music-stream-api/pkg/models"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // ExtHandler is an autogenerated mock type for the ExtHandler type
 type ExtHandler struct {
 	mock.Mock
 }
 
-// ValidateToken provides a mock function with given fields: token
-func (_m *ExtHandler) ValidateToken(token string) error {
-	ret := _m.Called(token)
+// ValidateToken provides a mock function with given fields: ctx, token
+func (_m *ExtHandler) ValidateToken(ctx context.Context, token string) (models.Identity, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 models.Identity
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Identity); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Get(0).(models.Identity)
+	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(token)
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
 	} else {
-		r0 = ret.Error(0)
+		r1 = ret.Error(1)
 	}
 
-	return r0
+	return r0, r1
 }
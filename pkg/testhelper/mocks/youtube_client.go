@@ -3,6 +3,7 @@
 package mocks
 
 import (
+	context "context"
 	io "io"
 
 	youtube "github.com/kkdai/youtube/v2"
@@ -14,13 +15,13 @@ type YoutubeClient struct {
 	mock.Mock
 }
 
-// GetStream provides a mock function with given fields: video, format
-func (_m *YoutubeClient) GetStream(video *youtube.Video, format *youtube.Format) (io.ReadCloser, int64, error) {
-	ret := _m.Called(video, format)
+// GetStreamContext provides a mock function with given fields: ctx, video, format
+func (_m *YoutubeClient) GetStreamContext(ctx context.Context, video *youtube.Video, format *youtube.Format) (io.ReadCloser, int64, error) {
+	ret := _m.Called(ctx, video, format)
 
 	var r0 io.ReadCloser
-	if rf, ok := ret.Get(0).(func(*youtube.Video, *youtube.Format) io.ReadCloser); ok {
-		r0 = rf(video, format)
+	if rf, ok := ret.Get(0).(func(context.Context, *youtube.Video, *youtube.Format) io.ReadCloser); ok {
+		r0 = rf(ctx, video, format)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(io.ReadCloser)
@@ -28,15 +29,15 @@ func (_m *YoutubeClient) GetStream(video *youtube.Video, format *youtube.Format)
 	}
 
 	var r1 int64
-	if rf, ok := ret.Get(1).(func(*youtube.Video, *youtube.Format) int64); ok {
-		r1 = rf(video, format)
+	if rf, ok := ret.Get(1).(func(context.Context, *youtube.Video, *youtube.Format) int64); ok {
+		r1 = rf(ctx, video, format)
 	} else {
 		r1 = ret.Get(1).(int64)
 	}
 
 	var r2 error
-	if rf, ok := ret.Get(2).(func(*youtube.Video, *youtube.Format) error); ok {
-		r2 = rf(video, format)
+	if rf, ok := ret.Get(2).(func(context.Context, *youtube.Video, *youtube.Format) error); ok {
+		r2 = rf(ctx, video, format)
 	} else {
 		r2 = ret.Error(2)
 	}
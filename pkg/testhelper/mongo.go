@@ -0,0 +1,144 @@
+// Package testhelper provides the real services integration tests run against.
+package testhelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// MongoURIEnv names the environment variable giving a MongoDB to test against instead of starting one, such as a
+// service container in CI. It must be a replica set for change streams to work.
+const MongoURIEnv = "MONGO_TEST_URI"
+
+// MongoImage is the image StartMongo runs.
+const MongoImage = "mongo:4.4"
+
+// mongoStartTimeout bounds how long StartMongo waits for a container to accept connections and elect itself primary.
+const mongoStartTimeout = time.Minute
+
+// ErrNoMongo is returned by StartMongo when there is neither a MongoDB configured nor Docker to start one.
+var ErrNoMongo = fmt.Errorf("set %v or install docker to run MongoDB integration tests", MongoURIEnv)
+
+// Mongo is a MongoDB server for integration tests.
+type Mongo struct {
+	Client    *mongo.Client
+	container string
+}
+
+// StartMongo connects to the MongoDB named by MONGO_TEST_URI, or otherwise starts a single-node replica set in
+// Docker, so that change streams work as well as queries and GridFS. Close removes the container.
+func StartMongo(ctx context.Context) (*Mongo, error) {
+	ctx, cancel := context.WithTimeout(ctx, mongoStartTimeout)
+	defer cancel()
+
+	if uri := os.Getenv(MongoURIEnv); uri != "" {
+		client, err := connectMongo(ctx, options.Client().ApplyURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		return &Mongo{Client: client}, nil
+	}
+
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, ErrNoMongo
+	}
+
+	// The port is published on a free one of the host's, so tests can run while another MongoDB is listening.
+	output, err := exec.CommandContext(ctx, docker, "run", "--detach", "--rm", "--publish", "127.0.0.1::27017",
+		MongoImage, "--replSet", "rs0", "--bind_ip_all").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error starting %v: %w", MongoImage, commandError(err))
+	}
+	server := &Mongo{container: strings.TrimSpace(string(output))}
+
+	if err := server.start(ctx, docker); err != nil {
+		server.Close()
+		return nil, err
+	}
+	return server, nil
+}
+
+// start initiates the container's replica set and connects to it.
+func (m *Mongo) start(ctx context.Context, docker string) error {
+	output, err := exec.CommandContext(ctx, docker, "port", m.container, "27017/tcp").Output()
+	if err != nil {
+		return fmt.Errorf("error finding MongoDB port: %w", commandError(err))
+	}
+	address := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+
+	// The shell fails until the server accepts connections, which takes a few seconds.
+	initiate := `rs.initiate({_id: "rs0", members: [{_id: 0, host: "localhost:27017"}]})`
+	for {
+		err := exec.CommandContext(ctx, docker, "exec", m.container, "mongo", "--quiet", "--eval", initiate).Run()
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error initiating replica set: %w", commandError(err))
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	// The replica set knows its member as localhost:27017 inside the container, so the client connects directly to
+	// the published port rather than discovering the member.
+	client, err := connectMongo(ctx, options.Client().ApplyURI("mongodb://"+address).SetDirect(true))
+	if err != nil {
+		return err
+	}
+	m.Client = client
+	return nil
+}
+
+// connectMongo connects and waits for the server to have a primary, which a new replica set takes a moment to elect.
+func connectMongo(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := client.Ping(ctx, readpref.Primary())
+		if err == nil {
+			return client, nil
+		}
+		select {
+		case <-ctx.Done():
+			client.Disconnect(context.Background())
+			return nil, fmt.Errorf("error connecting to MongoDB: %w", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// Close disconnects from the server, and removes its container if StartMongo started one.
+func (m *Mongo) Close() error {
+	if m.Client != nil {
+		m.Client.Disconnect(context.Background())
+	}
+	if m.container == "" {
+		return nil
+	}
+	if err := exec.Command("docker", "rm", "--force", m.container).Run(); err != nil {
+		return fmt.Errorf("error removing container %v: %w", m.container, commandError(err))
+	}
+	return nil
+}
+
+// commandError adds what a failed command wrote to stderr to its error.
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}